@@ -0,0 +1,296 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains single-signature xpub accounts with default derivation paths.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScriptType selects the output script of a single-signature account.
+type ScriptType string
+
+const (
+	ScriptP2WPKH ScriptType = "p2wpkh" // BIP-84 native SegWit (default)
+	ScriptP2TR   ScriptType = "p2tr"   // BIP-86 taproot key path
+	ScriptP2PKH  ScriptType = "p2pkh"  // BIP-44 legacy
+)
+
+// Purpose of the BIP-44 style path for each script type
+var scriptPurposes = map[ScriptType]uint32{
+	ScriptP2PKH:  44,
+	ScriptP2WPKH: 84,
+	ScriptP2TR:   86,
+}
+
+// XPubAccount is a single-signature account given by its account-level
+// extended public key. Receive addresses use child path 0/i and change
+// addresses 1/i; Fingerprint and Path are the key origin written into PSBT
+// derivation fields so signers can find the key.
+type XPubAccount struct {
+	XPub        *ExtendedPubKey
+	ScriptType  ScriptType
+	Fingerprint [4]byte  // Master key fingerprint
+	Path        []uint32 // Origin path from the master key to XPub
+	Network     Network
+}
+
+// accountKey is one derived account address with its signing metadata.
+type accountKey struct {
+	Address    string
+	PubKey     []byte // Compressed public key
+	Derivation *Bip32Derivation
+	Change     bool
+	Index      uint32
+}
+
+// DefaultAccountPath returns purpose'/coin'/account' for the script type:
+// 84' for P2WPKH, 86' for P2TR and 44' for P2PKH; coin type 0' on Bitcoin
+// mainnet, 2' on Litecoin mainnet and 1' on the test networks.
+func DefaultAccountPath(st ScriptType, network Network, account uint32) ([]uint32, error) {
+	purpose, ok := scriptPurposes[st]
+	if !ok {
+		return nil, fmt.Errorf("unsupported script type %q - use p2wpkh, p2tr or p2pkh", st)
+	}
+	coin := uint32(1)
+	switch network {
+	case BitcoinMainnet:
+		coin = 0
+	case LitecoinMainnet:
+		coin = 2
+	}
+	return []uint32{purpose + hardenedOffset, coin + hardenedOffset, account + hardenedOffset}, nil
+}
+
+// NewXPubAccount builds an account from an xpub. An empty scriptType means
+// P2WPKH and an empty path the script type's default account path. The master
+// fingerprint (8 hex characters) is required unless the xpub is the master
+// key itself, since signers match derivations by it.
+func NewXPubAccount(xpub string, scriptType ScriptType, fingerprint, path string, network Network) (*XPubAccount, error) {
+	k, err := ParseExtendedPubKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if scriptType == "" {
+		scriptType = ScriptP2WPKH
+	}
+	a := &XPubAccount{XPub: k, ScriptType: scriptType, Network: network}
+	if path == "" {
+		if k.Depth == 0 {
+			a.Path = nil
+		} else if a.Path, err = DefaultAccountPath(scriptType, network, 0); err != nil {
+			return nil, err
+		}
+	} else if a.Path, err = parseDerivationPath(path); err != nil {
+		return nil, err
+	}
+	switch {
+	case fingerprint != "":
+		fp, err := hex.DecodeString(fingerprint)
+		if err != nil || len(fp) != 4 {
+			return nil, fmt.Errorf("master fingerprint %q must be 8 hex characters", fingerprint)
+		}
+		copy(a.Fingerprint[:], fp)
+	case k.Depth == 0:
+		a.Fingerprint = k.Fingerprint()
+	default:
+		return nil, errors.New("the master key fingerprint is required for an account xpub - copy it from your wallet's key details")
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// validate checks the script type and that the origin path matches the xpub depth
+func (a *XPubAccount) validate() error {
+	if a.XPub == nil {
+		return errors.New("account has no xpub")
+	}
+	if _, ok := scriptPurposes[a.ScriptType]; !ok {
+		return fmt.Errorf("unsupported script type %q - use p2wpkh, p2tr or p2pkh", a.ScriptType)
+	}
+	if len(a.Path) != int(a.XPub.Depth) {
+		return fmt.Errorf("origin path %s has %d steps but the xpub is at depth %d - set the account path explicitly", formatDerivationPath(a.Path), len(a.Path), a.XPub.Depth)
+	}
+	return nil
+}
+
+// String describes the account as a key origin, e.g. "p2wpkh [d34db33f/84h/0h/0h]".
+func (a *XPubAccount) String() string {
+	return fmt.Sprintf("%s [%x%s]", a.ScriptType, a.Fingerprint, strings.TrimPrefix(formatDerivationPath(a.Path), "m"))
+}
+
+// Address returns the receive (change=false) or change address at index.
+func (a *XPubAccount) Address(change bool, index uint32) (string, error) {
+	k, err := a.derive(change, index)
+	if err != nil {
+		return "", err
+	}
+	return k.Address, nil
+}
+
+// Derive the key, address and origin derivation for one index
+func (a *XPubAccount) derive(change bool, index uint32) (*accountKey, error) {
+	branch := uint32(0)
+	if change {
+		branch = 1
+	}
+	child, err := a.XPub.Derive(branch, index)
+	if err != nil {
+		return nil, err
+	}
+	pub := append([]byte{}, child.PubKey[:]...)
+	k := &accountKey{
+		PubKey:     pub,
+		Derivation: &Bip32Derivation{MasterFingerprint: a.Fingerprint, Path: append(append([]uint32{}, a.Path...), branch, index)},
+		Change:     change,
+		Index:      index,
+	}
+	switch a.ScriptType {
+	case ScriptP2TR:
+		k.Address, err = CreateP2TRFromInternalKey(pub, a.Network)
+	case ScriptP2PKH:
+		k.Address, err = CreateP2PKH(Hash160(pub), a.Network)
+	default:
+		k.Address, err = CreateP2WPKH(Hash160(pub), a.Network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Parse "m/84'/0'/0'" (the leading m is optional)
+func parseDerivationPath(path string) ([]uint32, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "m"), "/")
+	if path == "" {
+		return nil, nil
+	}
+	var out []uint32
+	for _, step := range strings.Split(path, "/") {
+		i, err := parsePathStep(step)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// Format a path as m/84h/0h/0h
+func formatDerivationPath(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range path {
+		b.WriteString("/")
+		if i >= hardenedOffset {
+			b.WriteString(strconv.FormatUint(uint64(i-hardenedOffset), 10) + "h")
+		} else {
+			b.WriteString(strconv.FormatUint(uint64(i), 10))
+		}
+	}
+	return b.String()
+}
+
+// SetXPubAccount makes a single-signature xpub account the sweeper's wallet:
+// its first lookahead receive and change addresses (0 = 20) are recognized,
+// plans spending them carry the key origin of every input and change output,
+// and change goes to the next unused change address.
+func (s *Sweeper) SetXPubAccount(a *XPubAccount, lookahead int) error {
+	if a == nil {
+		s.account, s.accountKeys = nil, nil
+		return nil
+	}
+	if s.multisig != nil {
+		return errors.New("a multisig account is already configured - use either multisig_descriptor or xpub")
+	}
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if a.Network != s.network {
+		return errors.New("xpub account network does not match the sweeper network")
+	}
+	if lookahead < 0 {
+		return fmt.Errorf("xpub lookahead must be non-negative (got %d)", lookahead)
+	}
+	if lookahead == 0 {
+		lookahead = defaultMultisigLookahead
+	}
+	keys := map[string]*accountKey{}
+	for _, change := range []bool{false, true} {
+		for i := 0; i < lookahead; i++ {
+			k, err := a.derive(change, uint32(i))
+			if err != nil {
+				return err
+			}
+			keys[k.Address] = k
+		}
+	}
+	s.account, s.accountKeys = a, keys
+	if err := s.deriveToCounters(lookahead, s.accountAddress); err != nil {
+		s.account, s.accountKeys = nil, nil
+		return err
+	}
+	return nil
+}
+
+// Next change address of the account from the persisted change counter; it
+// is reserved only when a plan paying it is tracked
+func (s *Sweeper) nextAccountChange() (string, error) {
+	_, addr, err := s.peekIndex(true, func(i uint32) (string, error) {
+		return s.accountAddress(true, i)
+	})
+	return addr, err
+}
+
+// Derive an account address and register it, which extends the lookahead
+func (s *Sweeper) accountAddress(change bool, i uint32) (string, error) {
+	k, err := s.account.derive(change, i)
+	if err != nil {
+		return "", err
+	}
+	s.accountKeys[k.Address] = k
+	return k.Address, nil
+}
+
+// Add key origins for account inputs and outputs: BIP-32 derivations keyed by
+// the compressed key, or for taproot the x-only internal key with its
+// tap_bip32_derivation
+func (s *Sweeper) decorateAccount(psbt *PSBT, inputs []UTXO, outputs []TxOutput) {
+	if s.accountKeys == nil {
+		return
+	}
+	taproot := s.account.ScriptType == ScriptP2TR
+	for i, in := range inputs {
+		if k := s.accountKeys[in.Address]; k != nil {
+			if taproot {
+				psbt.Inputs[i].TapInternalKey = k.PubKey[1:]
+				psbt.Inputs[i].TapBip32Derivation[string(k.PubKey[1:])] = k.Derivation
+			} else {
+				psbt.Inputs[i].Bip32Derivation[string(k.PubKey)] = k.Derivation
+			}
+		}
+	}
+	for i, out := range outputs {
+		if k := s.accountKeys[out.Address]; k != nil {
+			if taproot {
+				psbt.Outputs[i].TapInternalKey = k.PubKey[1:]
+				psbt.Outputs[i].TapBip32Derivation[string(k.PubKey[1:])] = k.Derivation
+			} else {
+				psbt.Outputs[i].Bip32Derivation[string(k.PubKey)] = k.Derivation
+			}
+		}
+	}
+}
+
+// Describe the xpub account for settings snapshots
+func (s *Sweeper) accountPolicy() string {
+	if s.account == nil {
+		return ""
+	}
+	return s.account.String()
+}
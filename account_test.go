@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// BIP-84 and BIP-86 test vectors for the "abandon ... about" mnemonic
+const (
+	tvZpubBIP84   = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	tvXpubBIP86   = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+	tvMasterFP    = "73c5da0a"
+	tvBIP84Recv0  = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+	tvBIP84Change = "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"
+	tvBIP86Recv0  = "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"
+)
+
+func TestXPubAccountDefaults(t *testing.T) {
+	a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount: %v", err)
+	}
+	if a.String() != "p2wpkh [73c5da0a/84h/0h/0h]" {
+		t.Fatalf("unexpected origin %s", a)
+	}
+	if addr, _ := a.Address(false, 0); addr != tvBIP84Recv0 {
+		t.Fatalf("receive 0 = %s, want %s", addr, tvBIP84Recv0)
+	}
+	if addr, _ := a.Address(true, 0); addr != tvBIP84Change {
+		t.Fatalf("change 0 = %s, want %s", addr, tvBIP84Change)
+	}
+
+	tr, err := NewXPubAccount(tvXpubBIP86, ScriptP2TR, tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount p2tr: %v", err)
+	}
+	if tr.String() != "p2tr [73c5da0a/86h/0h/0h]" {
+		t.Fatalf("unexpected origin %s", tr)
+	}
+	if addr, _ := tr.Address(false, 0); addr != tvBIP86Recv0 {
+		t.Fatalf("p2tr receive 0 = %s, want %s", addr, tvBIP86Recv0)
+	}
+
+	if p, _ := DefaultAccountPath(ScriptP2PKH, BitcoinTestnet, 2); formatDerivationPath(p) != "m/44h/1h/2h" {
+		t.Fatalf("unexpected BIP-44 testnet path %s", formatDerivationPath(p))
+	}
+	if a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "m/84'/0'/7'", BitcoinMainnet); err != nil || a.String() != "p2wpkh [73c5da0a/84h/0h/7h]" {
+		t.Fatalf("path override not applied: %v %v", a, err)
+	}
+	if _, err := NewXPubAccount(tvZpubBIP84, "", "", "", BitcoinMainnet); err == nil {
+		t.Fatalf("expected the master fingerprint to be required")
+	}
+	if _, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "m/84'/0'", BitcoinMainnet); err == nil {
+		t.Fatalf("expected a path/depth mismatch error")
+	}
+	if _, err := NewXPubAccount(tvZpubBIP84, "p2sh", tvMasterFP, "", BitcoinMainnet); err == nil {
+		t.Fatalf("expected an unsupported script type error")
+	}
+}
+
+func TestXPubAccountPSBTDerivations(t *testing.T) {
+	for _, tc := range []struct {
+		xpub string
+		st   ScriptType
+	}{{tvZpubBIP84, ScriptP2WPKH}, {tvXpubBIP86, ScriptP2TR}} {
+		a, err := NewXPubAccount(tc.xpub, tc.st, tvMasterFP, "", BitcoinMainnet)
+		if err != nil {
+			t.Fatalf("NewXPubAccount: %v", err)
+		}
+		recv, _ := a.derive(false, 0)
+		s := mustNewSweeper(t, recv.PubKey, BitcoinMainnet)
+		if err := s.SetXPubAccount(a, 5); err != nil {
+			t.Fatalf("SetXPubAccount: %v", err)
+		}
+		if err := s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 150_000, Address: recv.Address, Confirmed: true}); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+		dest, _ := a.Address(false, 3)
+		plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 40_000}})
+		if err != nil {
+			t.Fatalf("Spend: %v", err)
+		}
+		change, _ := a.derive(true, 0)
+		if len(plan.Change) != 1 || plan.Change[0].Address != change.Address {
+			t.Fatalf("expected change to the first account change address, got %+v", plan.Change)
+		}
+		if plan.Settings.Account != a.String() {
+			t.Fatalf("settings record account %q", plan.Settings.Account)
+		}
+
+		parsed, err := ParsePSBT(plan.PSBT.Serialize())
+		if err != nil {
+			t.Fatalf("ParsePSBT: %v", err)
+		}
+		in, out := parsed.Inputs[0], parsed.Outputs[plan.ChangeIdxs[0]]
+		inDerivs, outDerivs, inKey, outKey := in.Bip32Derivation, out.Bip32Derivation, string(recv.PubKey), string(change.PubKey)
+		if tc.st == ScriptP2TR {
+			inDerivs, outDerivs, inKey, outKey = in.TapBip32Derivation, out.TapBip32Derivation, inKey[1:], outKey[1:]
+			if !bytes.Equal(in.TapInternalKey, recv.PubKey[1:]) || !bytes.Equal(out.TapInternalKey, change.PubKey[1:]) {
+				t.Fatalf("%s: missing taproot internal keys", tc.st)
+			}
+		}
+		d := inDerivs[inKey]
+		if d == nil || formatDerivationPath(d.Path) != "m/"+map[ScriptType]string{ScriptP2WPKH: "84", ScriptP2TR: "86"}[tc.st]+"h/0h/0h/0/0" || d.MasterFingerprint != a.Fingerprint {
+			t.Fatalf("%s: input derivation %+v", tc.st, d)
+		}
+		if d := outDerivs[outKey]; d == nil || d.Path[len(d.Path)-2] != 1 {
+			t.Fatalf("%s: change output derivation %+v", tc.st, d)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the accounting export of sweep history with fiat valuations.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccountingRecord is one output of one plan with its fee share and fiat
+// valuations at plan, broadcast and confirmation time (the cost-basis points),
+// in the sweeper's fiat currency.
+type AccountingRecord struct {
+	PlanID      string     `json:"plan_id"`
+	OutputIndex int        `json:"output_index"`
+	Address     string     `json:"address"`
+	ValueSats   int64      `json:"value_sats"`
+	IsChange    bool       `json:"is_change"`
+	FeeShare    int64      `json:"fee_share_sats"` // Portion of the plan fee attributed to this output
+	PlanFeeSats int64      `json:"plan_fee_sats"`
+	PlannedAt   time.Time  `json:"planned_at"`
+	BroadcastAt *time.Time `json:"broadcast_at,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+
+	Currency         string   `json:"currency"` // ISO 4217 code of the fiat fields
+	PriceAtPlan      float64  `json:"price_at_plan"`
+	PriceAtBroadcast *float64 `json:"price_at_broadcast,omitempty"`
+	PriceAtConfirm   *float64 `json:"price_at_confirm,omitempty"`
+	ValueFiatAtPlan  float64  `json:"value_at_plan"`
+	FeeFiatAtPlan    float64  `json:"fee_share_at_plan"`
+
+	Annotation *PlanAnnotation `json:"annotation,omitempty"` // Off-chain plan metadata (travel rule)
+}
+
+// AccountingRecords builds one record per output for every tracked plan, in
+// plan order. The plan fee is split across recipient outputs pro rata by value;
+// change outputs carry no fee share since the value stays in the wallet.
+func (s *Sweeper) AccountingRecords(prices PriceProvider) ([]AccountingRecord, error) {
+	var recs []AccountingRecord
+	cur := s.FiatCurrency()
+	for _, p := range s.PendingPlans() {
+		shares := feeShares(p)
+		pricePlan, err := priceIn(prices, cur, p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("price at plan time for %s: %w", p.ID, err)
+		}
+		var priceBroadcast, priceConfirm *float64
+		if p.BroadcastAt != nil {
+			v, err := priceIn(prices, cur, *p.BroadcastAt)
+			if err != nil {
+				return nil, fmt.Errorf("price at broadcast time for %s: %w", p.ID, err)
+			}
+			priceBroadcast = &v
+		}
+		if p.ConfirmedAt != nil {
+			v, err := priceIn(prices, cur, *p.ConfirmedAt)
+			if err != nil {
+				return nil, fmt.Errorf("price at confirmation time for %s: %w", p.ID, err)
+			}
+			priceConfirm = &v
+		}
+		for i, o := range p.Outputs {
+			recs = append(recs, AccountingRecord{
+				PlanID:           p.ID,
+				OutputIndex:      i,
+				Address:          o.Address,
+				ValueSats:        o.ValueSats,
+				IsChange:         p.IsChange(i),
+				FeeShare:         shares[i],
+				PlanFeeSats:      p.FeeSats,
+				PlannedAt:        p.CreatedAt,
+				BroadcastAt:      p.BroadcastAt,
+				ConfirmedAt:      p.ConfirmedAt,
+				Currency:         cur,
+				PriceAtPlan:      pricePlan,
+				PriceAtBroadcast: priceBroadcast,
+				PriceAtConfirm:   priceConfirm,
+				ValueFiatAtPlan:  satsToFiat(o.ValueSats, pricePlan),
+				FeeFiatAtPlan:    satsToFiat(shares[i], pricePlan),
+				Annotation:       p.Annotation,
+			})
+		}
+	}
+	return recs, nil
+}
+
+// ExportAccounting writes the sweep history as "csv" or "json".
+func (s *Sweeper) ExportAccounting(w io.Writer, format string, prices PriceProvider) error {
+	recs, err := s.AccountingRecords(prices)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(recs)
+	case "csv":
+		return writeAccountingCSV(w, recs, s.FiatCurrency())
+	default:
+		return fmt.Errorf("unsupported accounting format '%s' - must be 'csv' or 'json'", format)
+	}
+}
+
+// Write records as CSV with a header row; fiat columns are named after the
+// currency, e.g. price_eur_at_plan
+func writeAccountingCSV(w io.Writer, recs []AccountingRecord, currency string) error {
+	cw := csv.NewWriter(w)
+	c := strings.ToLower(currency)
+	header := []string{
+		"plan_id", "output_index", "address", "value_sats", "is_change", "fee_share_sats", "plan_fee_sats",
+		"planned_at", "broadcast_at", "confirmed_at",
+		"price_" + c + "_at_plan", "price_" + c + "_at_broadcast", "price_" + c + "_at_confirm",
+		"value_" + c + "_at_plan", "fee_share_" + c + "_at_plan",
+		"reference", "originator_name", "originator_account", "originator_vasp",
+		"beneficiary_name", "beneficiary_account", "beneficiary_vasp",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		row := []string{
+			r.PlanID,
+			strconv.Itoa(r.OutputIndex),
+			r.Address,
+			strconv.FormatInt(r.ValueSats, 10),
+			strconv.FormatBool(r.IsChange),
+			strconv.FormatInt(r.FeeShare, 10),
+			strconv.FormatInt(r.PlanFeeSats, 10),
+			r.PlannedAt.Format(time.RFC3339),
+			formatOptTime(r.BroadcastAt),
+			formatOptTime(r.ConfirmedAt),
+			formatFiat(r.PriceAtPlan, currency),
+			formatOptFiat(r.PriceAtBroadcast, currency),
+			formatOptFiat(r.PriceAtConfirm, currency),
+			formatFiat(r.ValueFiatAtPlan, currency),
+			formatFiat(r.FeeFiatAtPlan, currency),
+		}
+		row = append(row, annotationColumns(r.Annotation)...)
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Split the plan fee across recipient outputs pro rata; remainder goes to the last one
+func feeShares(p *TransactionPlan) []int64 {
+	shares := make([]int64, len(p.Outputs))
+	var total int64
+	last := -1
+	for i, o := range p.Outputs {
+		if !p.IsChange(i) {
+			total += o.ValueSats
+			last = i
+		}
+	}
+	if last < 0 || total <= 0 {
+		return shares
+	}
+	var acc int64
+	for i, o := range p.Outputs {
+		if p.IsChange(i) {
+			continue
+		}
+		if i == last {
+			shares[i] = p.FeeSats - acc
+			break
+		}
+		shares[i] = p.FeeSats * o.ValueSats / total
+		acc += shares[i]
+	}
+	return shares
+}
+
+// Flatten the travel-rule fields of an annotation into CSV columns
+func annotationColumns(a *PlanAnnotation) []string {
+	cols := make([]string, 7)
+	if a == nil {
+		return cols
+	}
+	cols[0] = a.Reference
+	if o := a.Originator; o != nil {
+		cols[1], cols[2], cols[3] = o.Name, o.AccountID, o.VASP
+	}
+	if b := a.Beneficiary; b != nil {
+		cols[4], cols[5], cols[6] = b.Name, b.AccountID, b.VASP
+	}
+	return cols
+}
+
+func formatOptTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatOptFiat(v *float64, currency string) string {
+	if v == nil {
+		return ""
+	}
+	return formatFiat(*v, currency)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestAccountingFeeSplitAndCSV(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in1"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("A"), ValueSats: 100_000}, {Address: testAddr("B"), ValueSats: 300_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if err := s.MarkBroadcast(plan.ID, time.Now()); err != nil {
+		t.Fatalf("MarkBroadcast: %v", err)
+	}
+
+	recs, err := s.AccountingRecords(StaticPrice(50_000))
+	if err != nil {
+		t.Fatalf("AccountingRecords: %v", err)
+	}
+	var feeSum int64
+	for _, r := range recs {
+		feeSum += r.FeeShare
+		if r.IsChange && r.FeeShare != 0 {
+			t.Fatalf("change output must not carry a fee share")
+		}
+		if r.PriceAtBroadcast == nil || r.PriceAtConfirm != nil {
+			t.Fatalf("expected broadcast price only")
+		}
+	}
+	if feeSum != plan.FeeSats {
+		t.Fatalf("fee shares %d do not sum to plan fee %d", feeSum, plan.FeeSats)
+	}
+	if recs[1].FeeShare < 3*recs[0].FeeShare-1 {
+		t.Fatalf("fee split not pro rata: %d vs %d", recs[0].FeeShare, recs[1].FeeShare)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportAccounting(&buf, "csv", StaticPrice(50_000)); err != nil {
+		t.Fatalf("ExportAccounting: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(rows) != len(recs)+1 || rows[0][0] != "plan_id" {
+		t.Fatalf("unexpected CSV shape: %d rows", len(rows))
+	}
+}
+
+func TestAccountingInOtherFiatCurrency(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in1"), Confirmed: true})
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("A"), ValueSats: 100_000}}); err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if err := s.SetFiatCurrency("jpy"); err != nil {
+		t.Fatalf("SetFiatCurrency: %v", err)
+	}
+	if _, err := s.AccountingRecords(StaticPrice(50_000)); err == nil {
+		t.Fatalf("expected a USD-only provider to be refused for JPY")
+	}
+	prices := StaticPrices{"USD": 50_000, "JPY": 7_500_000}
+	recs, err := s.AccountingRecords(prices)
+	if err != nil {
+		t.Fatalf("AccountingRecords: %v", err)
+	}
+	if recs[0].Currency != "JPY" || recs[0].ValueFiatAtPlan != 7_500 {
+		t.Fatalf("unexpected JPY valuation: %+v", recs[0])
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportAccounting(&buf, "csv", prices); err != nil {
+		t.Fatalf("ExportAccounting: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if rows[0][10] != "price_jpy_at_plan" || rows[1][13] != "7500" {
+		t.Fatalf("unexpected JPY columns: %v / %v", rows[0][10], rows[1][13])
+	}
+}
@@ -0,0 +1,147 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the LRU cache of decoded addresses and output scripts.
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultAddressCacheSize holds the addresses of a few thousand-input plans.
+const defaultAddressCacheSize = 4096
+
+// addressCache is a least-recently-used cache of DecodeAddress results and
+// the output scripts built from them, keyed by network and address so a
+// cache is never consulted for another network's addresses. It is safe for
+// concurrent use.
+type addressCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+// addressEntry is one cached address.
+type addressEntry struct {
+	key    string
+	dec    *Address
+	err    error
+	script []byte // Built on first use
+}
+
+// Cache of up to size addresses
+func newAddressCache(size int) *addressCache {
+	return &addressCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// SetAddressCacheSize sets how many decoded addresses and their output
+// scripts the sweeper keeps (default 4096), so planning does not decode the
+// same address again for filtering, validation, size estimation and script
+// building; the least recently used are evicted first. 0 turns the cache off.
+func (s *Sweeper) SetAddressCacheSize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("address cache size must be non-negative (got %d)", n)
+	}
+	if n == 0 {
+		s.addrCache = nil
+		return nil
+	}
+	s.addrCache = newAddressCache(n)
+	return nil
+}
+
+// DecodeAddress through the address cache. The result is shared and must not
+// be modified.
+func (s *Sweeper) decodeAddress(addr string) (*Address, error) {
+	if s.addrCache == nil {
+		return DecodeAddress(addr)
+	}
+	e := s.addrCache.get(s.network, addr)
+	return e.dec, e.err
+}
+
+// Output script paying a decoded address, built once per cached address
+func (s *Sweeper) addressScript(addr string, dec *Address) ([]byte, error) {
+	if s.addrCache == nil {
+		return scriptForAddress(dec)
+	}
+	c := s.addrCache
+	c.mu.Lock()
+	el, ok := c.entries[cacheKey(s.network, addr)]
+	var script []byte
+	if ok {
+		script = el.Value.(*addressEntry).script
+	}
+	c.mu.Unlock()
+	if script == nil {
+		var err error
+		if script, err = scriptForAddress(dec); err != nil {
+			return nil, err
+		}
+		if ok {
+			c.mu.Lock()
+			el.Value.(*addressEntry).script = script
+			c.mu.Unlock()
+		}
+	}
+	return script[:len(script):len(script)], nil // Appends must not write into the cache
+}
+
+// Output script for a decoded address
+func scriptForAddress(dec *Address) ([]byte, error) {
+	switch dec.Type {
+	case P2WPKH:
+		return BuildP2WPKHScript(dec.Data), nil
+	case P2TR:
+		return BuildP2TRScript(dec.Data), nil
+	case P2WSH:
+		return BuildP2WSHScript(dec.Data), nil
+	case P2PKH:
+		return BuildP2PKHScript(dec.Data), nil
+	default:
+		return nil, errors.New("unsupported address type")
+	}
+}
+
+// Cached entry for addr, decoding it on a miss and evicting the least
+// recently used entry when full
+func (c *addressCache) get(network Network, addr string) *addressEntry {
+	key := cacheKey(network, addr)
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*addressEntry)
+		c.mu.Unlock()
+		return e
+	}
+	c.mu.Unlock()
+
+	dec, err := DecodeAddress(addr)
+	e := &addressEntry{key: key, dec: dec, err: err}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok { // Decoded concurrently
+		return el.Value.(*addressEntry)
+	}
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*addressEntry).key)
+	}
+	return e
+}
+
+// Number of cached addresses
+func (c *addressCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Cache key scoping addr to network
+func cacheKey(network Network, addr string) string {
+	return network.String() + ":" + addr
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestAddressCache(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinTestnet)
+	if err := s.SetAddressCacheSize(-1); err == nil {
+		t.Fatalf("expected a negative size to be refused")
+	}
+	_ = s.SetAddressCacheSize(2)
+	a, _ := CreateP2WPKH(Hash160(pub), BitcoinTestnet)
+	b, _ := CreateP2TR(make([]byte, 32), BitcoinTestnet)
+	c, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+
+	first, err := s.decodeAddress(a)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if again, _ := s.decodeAddress(a); again != first {
+		t.Fatalf("second decode missed the cache")
+	}
+	script, err := s.buildOutputScript(a)
+	if err != nil || !bytes.Equal(script, BuildP2WPKHScript(Hash160(pub))) {
+		t.Fatalf("cached script %x, %v", script, err)
+	}
+	if _, err := s.decodeAddress("not-an-address"); err == nil {
+		t.Fatalf("expected the decode error to be returned")
+	}
+	if _, err := s.decodeAddress("not-an-address"); err == nil {
+		t.Fatalf("expected the cached decode error to be returned")
+	}
+
+	// Least recently used entries are evicted
+	_, _ = s.decodeAddress(b)
+	_, _ = s.decodeAddress(c)
+	if n := s.addrCache.len(); n != 2 {
+		t.Fatalf("cache holds %d entries, want 2", n)
+	}
+	if _, ok := s.addrCache.entries[cacheKey(BitcoinTestnet, a)]; ok {
+		t.Fatalf("least recently used address not evicted")
+	}
+	if _, ok := s.addrCache.entries[cacheKey(BitcoinMainnet, c)]; ok {
+		t.Fatalf("entry not scoped to the sweeper's network")
+	}
+
+	_ = s.SetAddressCacheSize(0)
+	if dec, err := s.decodeAddress(b); err != nil || dec.Type != P2TR {
+		t.Fatalf("uncached decode: %+v, %v", dec, err)
+	}
+}
+
+// Planning a 1000-input spend from 100 addresses, with and without the cache
+func BenchmarkPlanManyInputs(b *testing.B) {
+	for _, size := range []int{defaultAddressCacheSize, 0} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			pub, _ := hex.DecodeString(legacyTestPub)
+			s, _ := NewSweeper(pub, BitcoinTestnet, WithOwnershipValidator(func(UTXO) error { return nil }))
+			_ = s.SetAddressCacheSize(size)
+			var total int64
+			for i := 0; i < 1000; i++ {
+				h := make([]byte, 20)
+				h[0] = byte(i % 100)
+				addr, _ := CreateP2WPKH(h, BitcoinTestnet)
+				txid := fmt.Sprintf("%064x", i+1)
+				if err := s.Index(UTXO{TxID: txid, Vout: 0, ValueSats: 10_000, Address: addr, Confirmed: true, Confirmations: 6}); err != nil {
+					b.Fatalf("Index: %v", err)
+				}
+				total += 10_000
+			}
+			dest, _ := CreateP2TR(make([]byte, 32), BitcoinTestnet)
+			out := []TxOutput{{Address: dest, ValueSats: total * 9 / 10}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Spend(out); err != nil {
+					b.Fatalf("Spend: %v", err)
+				}
+			}
+		})
+	}
+}
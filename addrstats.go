@@ -0,0 +1,116 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains per-address usage statistics and reuse warnings.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// defaultReuseThreshold is the number of received UTXOs at which an address
+// is reported as reused.
+const defaultReuseThreshold = 3
+
+// AddressStats counts how often an address has received and spent UTXOs.
+type AddressStats struct {
+	Address      string `json:"address"`
+	Received     int    `json:"received"`      // Distinct UTXOs indexed for the address
+	ReceivedSats int64  `json:"received_sats"` // Their combined value
+	Spent        int    `json:"spent"`         // UTXOs spent by broadcast plans
+}
+
+// Reused reports whether the address received at least threshold UTXOs.
+func (a AddressStats) Reused(threshold int) bool {
+	return a.Received >= threshold
+}
+
+// SetAddressReuseThreshold sets how many received UTXOs mark an address as
+// heavily reused (minimum 2).
+func (s *Sweeper) SetAddressReuseThreshold(n int) error {
+	if n < 2 {
+		return fmt.Errorf("address reuse threshold must be at least 2 (got %d)", n)
+	}
+	s.reuseThreshold = n
+	return nil
+}
+
+// AddressStats returns usage statistics for every address seen, sorted by
+// received count (most reused first).
+func (s *Sweeper) AddressStats() []AddressStats {
+	stats := s.loadAddrStats()
+	out := make([]AddressStats, 0, len(stats))
+	for _, a := range stats {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Received != out[j].Received {
+			return out[i].Received > out[j].Received
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+// AddressReuseWarnings returns one warning per heavily reused address so
+// operators can rotate deposit addresses before clustering gets worse.
+func (s *Sweeper) AddressReuseWarnings() []string {
+	var warns []string
+	for _, a := range s.AddressStats() {
+		if a.Reused(s.reuseThreshold) {
+			warns = append(warns, fmt.Sprintf("address %s received %d UTXOs (%d spent) - rotate to a fresh deposit address", a.Address, a.Received, a.Spent))
+		}
+	}
+	return warns
+}
+
+// Load address stats from the KV store on first use
+func (s *Sweeper) loadAddrStats() map[string]*AddressStats {
+	if s.addrStats != nil {
+		return s.addrStats
+	}
+	s.addrStats = map[string]*AddressStats{}
+	if b, err := s.kv.Get([]byte("address:stats")); err == nil {
+		_ = json.Unmarshal(b, &s.addrStats)
+	}
+	return s.addrStats
+}
+
+// Get or create the stats entry for an address
+func (s *Sweeper) addrStat(addr string) *AddressStats {
+	stats := s.loadAddrStats()
+	a, ok := stats[addr]
+	if !ok {
+		a = &AddressStats{Address: addr}
+		stats[addr] = a
+	}
+	return a
+}
+
+// Persist address stats
+func (s *Sweeper) saveAddrStats() error {
+	b, err := json.Marshal(s.loadAddrStats())
+	if err != nil {
+		return err
+	}
+	return s.kv.Put([]byte("address:stats"), b)
+}
+
+// Count a newly seen UTXO as received by its address
+func (s *Sweeper) recordReceived(u UTXO) error {
+	a := s.addrStat(u.Address)
+	a.Received++
+	a.ReceivedSats += u.ValueSats
+	if a.Received == s.reuseThreshold {
+		s.logger.Printf("address %s reached %d received UTXOs - consider rotating it", u.Address, a.Received)
+	}
+	return s.saveAddrStats()
+}
+
+// Count a broadcast plan's inputs as spent from their addresses
+func (s *Sweeper) recordSpent(p *TransactionPlan) error {
+	for _, in := range p.Inputs {
+		s.addrStat(in.Address).Spent++
+	}
+	return s.saveAddrStats()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressReuseStatsAndWarnings(t *testing.T) {
+	s := newTestSweeper(t)
+	for i, id := range []string{"a", "b", "c"} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(id, 64), Vout: uint32(i), ValueSats: 100_000, Address: testAddr("reused"), Confirmed: true})
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("fresh"), Confirmed: true})
+	// Re-indexing the same outpoint is not a new receipt
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("fresh"), Confirmed: true})
+
+	stats := s.AddressStats()
+	if len(stats) != 2 || stats[0].Address != testAddr("reused") || stats[0].Received != 3 || stats[1].Received != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	warns := s.AddressReuseWarnings()
+	if len(warns) != 1 || !strings.Contains(warns[0], testAddr("reused")) {
+		t.Fatalf("expected one reuse warning, got %v", warns)
+	}
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.MarkBroadcast(plan.ID, time.Now())
+	_ = s.MarkBroadcast(plan.ID, time.Now())
+	var spent int
+	for _, a := range s.AddressStats() {
+		spent += a.Spent
+	}
+	if spent != len(plan.Inputs) {
+		t.Fatalf("spent = %d, want %d", spent, len(plan.Inputs))
+	}
+}
@@ -0,0 +1,120 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains ancestor-aware (package) fee accounting for unconfirmed inputs.
+package main
+
+import "fmt"
+
+// SetMempoolSource sets the backend used to look up unconfirmed transactions.
+// With a source set, plans spending unconfirmed outputs pay for their
+// low-fee ancestors so the package reaches the target fee rate.
+func (s *Sweeper) SetMempoolSource(src MempoolSource) {
+	s.mempool = src
+}
+
+// SetMinPackageFeeRate requires plans spending unconfirmed outputs to bring
+// their package (the plan plus its unconfirmed ancestors) up to at least rate,
+// so a chained sweep is not stuck behind an underpaying parent even when its
+// own target rate is lower (0 = only the target rate). The child pays the
+// difference from change; plans that cannot fail with a *FeeLimitError.
+func (s *Sweeper) SetMinPackageFeeRate(rate FeeRate) error {
+	if rate < 0 {
+		return fmt.Errorf("minimum package fee rate must be non-negative (got %d sat/kvB)", rate)
+	}
+	s.minPackageFeeRate = rate
+	return nil
+}
+
+// Sum ancestor fees and vsizes of the unconfirmed parents spent by the inputs.
+// Parents built by this sweeper and not yet broadcast are taken from their
+// plans, so chained plans account for them before the mempool knows them;
+// others are looked up in the mempool source. Each parent's totals already
+// include the parent itself; ancestors shared by several parents are counted
+// once per parent, which overstates both sides.
+func (s *Sweeper) ancestorTotals(inputs []UTXO) (fee, vsize int64, err error) {
+	seen := map[string]bool{}
+	for _, u := range inputs {
+		if u.Confirmed || seen[u.TxID] {
+			continue
+		}
+		seen[u.TxID] = true
+		parent := s.parentPlan(u.TxID)
+		if s.mempool != nil && (parent == nil || parent.BroadcastAt != nil) {
+			info, err := s.mempool.MempoolTx(u.TxID)
+			if err != nil {
+				return 0, 0, fmt.Errorf("mempool lookup for unconfirmed parent %s: %w", u.TxID, err)
+			}
+			fee += info.AncestorFeeSats
+			vsize += info.AncestorVSize
+		} else if parent != nil {
+			fee += parent.PackageFeeSats
+			vsize += parent.PackageVBytes
+		}
+	}
+	return fee, vsize, nil
+}
+
+// Unconfirmed tracked plan whose transaction is txid
+func (s *Sweeper) parentPlan(txid string) *TransactionPlan {
+	for _, p := range s.plans {
+		if p.ConfirmedAt == nil && p.RawTx != nil && p.ExpectedTxID() == txid {
+			return p
+		}
+	}
+	return nil
+}
+
+// Fee rate a package with unconfirmed ancestors must reach
+func (s *Sweeper) packageTarget(feeRate FeeRate) FeeRate {
+	if s.minPackageFeeRate > feeRate {
+		return s.minPackageFeeRate
+	}
+	return feeRate
+}
+
+// packageFee returns the fee a transaction of vbytes spending inputs must pay
+// so that it and its unconfirmed ancestors together meet feeRate, or the
+// minimum package fee rate if higher. It never returns less than baseFee.
+func (s *Sweeper) packageFee(inputs []UTXO, vbytes, baseFee int64, feeRate FeeRate) (int64, error) {
+	ancFee, ancVB, err := s.ancestorTotals(inputs)
+	if err != nil {
+		return 0, err
+	}
+	if ancVB == 0 {
+		return baseFee, nil
+	}
+	need := s.packageTarget(feeRate).Fee(vbytes+ancVB) - ancFee
+	if need > baseFee {
+		return need, nil
+	}
+	return baseFee, nil
+}
+
+// Record the package fee and rates miners see for the plan and its
+// ancestors, refusing packages below the minimum package fee rate
+func (s *Sweeper) setPackageFee(plan *TransactionPlan) error {
+	ancFee, ancVB, err := s.ancestorTotals(plan.Inputs)
+	if err != nil {
+		return err
+	}
+	vbytes := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	plan.PackageFeeSats = plan.FeeSats + ancFee
+	plan.PackageVBytes = vbytes + ancVB
+	plan.setPackageRates(vbytes)
+	if min := s.minPackageFeeRate; ancVB > 0 && plan.PackageFeeSats < min.Fee(plan.PackageVBytes) {
+		return &FeeLimitError{Kind: FeeBelowMinPackage, FeeSats: plan.PackageFeeSats, VBytes: plan.PackageVBytes, Limit: min.SatPerVB(),
+			Reason: fmt.Sprintf("package of %d sats for %d vB with unconfirmed ancestors (%.2f sat/vB) is below the minimum package fee rate of %s set with SetMinPackageFeeRate; add UTXOs so change can pay for the ancestors", plan.PackageFeeSats, plan.PackageVBytes, plan.PackageFeeRate, min)}
+	}
+	return nil
+}
+
+// Derive the package and ancestor fee rates from the package totals and the
+// plan's own size
+func (p *TransactionPlan) setPackageRates(vbytes int64) {
+	p.PackageFeeRate, p.AncestorFeeRate = 0, 0
+	if p.PackageVBytes > 0 {
+		p.PackageFeeRate = float64(p.PackageFeeSats) / float64(p.PackageVBytes)
+	}
+	if ancVB := p.PackageVBytes - vbytes; ancVB > 0 {
+		p.AncestorFeeRate = float64(p.PackageFeeSats-p.FeeSats) / float64(ancVB)
+	}
+}
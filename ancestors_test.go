@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChainedPlanPackageFeeRate(t *testing.T) {
+	s := newTestSweeper(t, WithUnconfirmedPolicy(true, 5, 5), WithFeeRate(1))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	parent, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("parent Spend: %v", err)
+	}
+	if parent.AncestorFeeRate != 0 {
+		t.Fatalf("confirmed inputs have no ancestors, got %.2f", parent.AncestorFeeRate)
+	}
+	_ = s.RemoveUTXO(stringsRepeat("a", 64), 0)
+	for _, u := range parent.ChangeUTXOs() {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index change: %v", err)
+		}
+	}
+
+	// The unbroadcast parent pays 1 sat/vB; the child lifts the package to 5
+	if err := s.SetMinPackageFeeRate(SatPerVByte(5)); err != nil {
+		t.Fatalf("SetMinPackageFeeRate: %v", err)
+	}
+	child, err := s.Spend([]TxOutput{{Address: testAddr("dest2"), ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("child Spend: %v", err)
+	}
+	if child.AncestorFeeRate < 1 || child.AncestorFeeRate >= 1.1 {
+		t.Fatalf("ancestor rate %.2f, want the parent's 1 sat/vB", child.AncestorFeeRate)
+	}
+	if child.PackageFeeRate < 5 || child.PackageFeeSats != child.FeeSats+parent.FeeSats {
+		t.Fatalf("package %d sats at %.2f sat/vB, want at least 5 sat/vB including the parent", child.PackageFeeSats, child.PackageFeeRate)
+	}
+
+	// A plan below the floor is refused with a typed error
+	child.FeeSats = 1
+	s.minPackageFeeRate = SatPerVByte(50)
+	var fl *FeeLimitError
+	if err := s.setPackageFee(child); !errors.As(err, &fl) || fl.Kind != FeeBelowMinPackage {
+		t.Fatalf("expected a below_min_package error, got %v", err)
+	}
+}
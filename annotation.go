@@ -0,0 +1,167 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains off-chain plan annotations such as travel-rule data.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TravelRuleParty identifies the originator or beneficiary of a transfer.
+type TravelRuleParty struct {
+	Name          string `json:"name"`
+	AccountID     string `json:"account_id,omitempty"`       // Customer or wallet account at the VASP
+	PhysicalAddr  string `json:"physical_address,omitempty"` // Postal address
+	NationalID    string `json:"national_id,omitempty"`
+	Country       string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	VASP          string `json:"vasp,omitempty"`    // Name or LEI of the service provider holding the account
+	WalletAddress string `json:"wallet_address,omitempty"`
+	DateOfBirth   string `json:"date_of_birth,omitempty"` // YYYY-MM-DD, natural persons only
+	IsLegalPerson bool   `json:"is_legal_person,omitempty"`
+}
+
+// PlanAnnotation is structured metadata attached to a plan, e.g. travel-rule
+// data for sweeps that are exchange withdrawals. It is stored with the plan,
+// encrypted when an annotation key is set, and included in webhook payloads
+// and accounting exports, but never written to the transaction.
+type PlanAnnotation struct {
+	Reference   string            `json:"reference,omitempty"` // Withdrawal or case reference
+	Originator  *TravelRuleParty  `json:"originator,omitempty"`
+	Beneficiary *TravelRuleParty  `json:"beneficiary,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"` // Free-form key/value pairs
+}
+
+// validate checks that any party given is identifiable.
+func (a *PlanAnnotation) validate() error {
+	var errs []error
+	roles := []string{"originator", "beneficiary"}
+	for i, p := range []*TravelRuleParty{a.Originator, a.Beneficiary} {
+		role := roles[i]
+		if p == nil {
+			continue
+		}
+		if strings.TrimSpace(p.Name) == "" {
+			errs = append(errs, fmt.Errorf("%s needs a name", role))
+		}
+		if p.Country != "" && len(p.Country) != 2 {
+			errs = append(errs, fmt.Errorf("%s country %q must be an ISO 3166-1 alpha-2 code", role, p.Country))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check an annotation can be stored: valid, and carrying personal data only
+// if it will be encrypted
+func (s *Sweeper) checkAnnotation(a *PlanAnnotation) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if s.annotationKey == nil && (a.Originator != nil || a.Beneficiary != nil) {
+		return errors.New("travel-rule parties hold personal data - set an encryption key with SetAnnotationKey, or annotate with a Reference to the record in your compliance system")
+	}
+	return nil
+}
+
+// SetAnnotationKey sets the 32-byte AES-256 key annotations are encrypted
+// with in plan records and the event outbox. Until a key is set, annotations
+// with travel-rule parties are refused and only references and extra fields
+// are stored, in plaintext. Webhook payloads and exports carry the decrypted
+// annotation.
+func (s *Sweeper) SetAnnotationKey(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("annotation key must be 32 bytes (got %d)", len(key))
+	}
+	s.annotationKey = append([]byte(nil), key...)
+	return nil
+}
+
+// Encrypt an annotation with AES-256-GCM as base64 of nonce and ciphertext
+func (s *Sweeper) sealAnnotation(a *PlanAnnotation) (string, error) {
+	plain, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := annotationCipher(s.annotationKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Decrypt an annotation sealed by sealAnnotation
+func (s *Sweeper) openAnnotation(sealed string) (*PlanAnnotation, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("sealed annotation: %w", err)
+	}
+	gcm, err := annotationCipher(s.annotationKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("sealed annotation is truncated")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("sealed annotation does not decrypt - wrong annotation key?")
+	}
+	var a PlanAnnotation
+	if err := json.Unmarshal(plain, &a); err != nil {
+		return nil, fmt.Errorf("sealed annotation: %w", err)
+	}
+	return &a, nil
+}
+
+// AES-256-GCM under key
+func annotationCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Stored forms of an annotation: plaintext, or sealed when a key is set. A
+// sealed annotation this Sweeper cannot open is kept as it was.
+func (s *Sweeper) storedAnnotation(p *TransactionPlan) (*PlanAnnotation, string, error) {
+	switch {
+	case p.Annotation == nil:
+		return nil, p.sealedAnnotation, nil
+	case s.annotationKey == nil:
+		return p.Annotation, "", nil
+	}
+	sealed, err := s.sealAnnotation(p.Annotation)
+	return nil, sealed, err
+}
+
+// AnnotatePlan attaches (or with nil, removes) an annotation on a tracked plan,
+// persists it and sends a plan.annotated event. Annotations can be set at any
+// point in the plan's life; pass SpendOptions.Annotation to have plan.created
+// carry it.
+func (s *Sweeper) AnnotatePlan(id string, a *PlanAnnotation) error {
+	p, ok := s.plans[id]
+	if !ok {
+		return fmt.Errorf("unknown plan %q", id)
+	}
+	if a != nil {
+		if err := s.checkAnnotation(a); err != nil {
+			return fmt.Errorf("invalid annotation for plan %s: %w", id, err)
+		}
+	}
+	p.Annotation, p.sealedAnnotation = a, ""
+	if err := s.savePlan(p); err != nil {
+		return err
+	}
+	s.notify(EventAnnotated, p)
+	return nil
+}
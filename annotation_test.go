@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlanAnnotationInWebhookAndExport(t *testing.T) {
+	var mu sync.Mutex
+	var got []WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p WebhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	if err := s.SetWebhook(&Webhook{URL: "ftp://example"}); err == nil {
+		t.Fatalf("expected non-http webhook URL to be rejected")
+	}
+	if err := s.SetWebhook(&Webhook{URL: srv.URL}); err != nil {
+		t.Fatalf("SetWebhook: %v", err)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	ann := &PlanAnnotation{
+		Reference:   "wd-42",
+		Originator:  &TravelRuleParty{Name: "Alice Example", AccountID: "cust-1", VASP: "ExampleX", Country: "DE"},
+		Beneficiary: &TravelRuleParty{Name: "Bob Example", VASP: "OtherX"},
+	}
+
+	// Personal data is refused until it can be encrypted at rest
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{Annotation: ann}); err == nil {
+		t.Fatalf("expected travel-rule parties without an annotation key to be refused")
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+	if err := s.SetAnnotationKey(key); err != nil {
+		t.Fatalf("SetAnnotationKey: %v", err)
+	}
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{Annotation: ann})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	before := plan.RawTx.TxID()
+
+	if err := s.AnnotatePlan(plan.ID, &PlanAnnotation{Originator: &TravelRuleParty{}}); err == nil {
+		t.Fatalf("expected a nameless originator to be rejected")
+	}
+	ann.Beneficiary.AccountID = "cust-9"
+	if err := s.AnnotatePlan(plan.ID, ann); err != nil {
+		t.Fatalf("AnnotatePlan: %v", err)
+	}
+	if plan.RawTx.TxID() != before {
+		t.Fatalf("annotation must not change the transaction")
+	}
+	if err := s.MarkBroadcast(plan.ID, time.Now()); err != nil {
+		t.Fatalf("MarkBroadcast: %v", err)
+	}
+	s.WaitWebhooks()
+
+	mu.Lock()
+	if len(got) != 3 || got[0].Event != EventPlanned || got[1].Event != EventAnnotated || got[2].Event != EventBroadcast {
+		t.Fatalf("unexpected webhook events: %+v", got)
+	}
+	if a := got[0].Annotation; a == nil || a.Originator.Name != "Alice Example" || a.Reference != "wd-42" {
+		t.Fatalf("expected annotation in the plan.created payload, got %+v", a)
+	}
+	if a := got[2].Annotation; a == nil || a.Beneficiary.AccountID != "cust-9" {
+		t.Fatalf("expected the updated annotation in the broadcast payload, got %+v", a)
+	}
+	mu.Unlock()
+
+	// Nothing personal is stored in plaintext
+	rec, _ := kv.Get([]byte("plan:" + plan.ID))
+	ev, _ := kv.Get(outboxKey(1))
+	if bytes.Contains(rec, []byte("Alice")) || bytes.Contains(ev, []byte("Alice")) {
+		t.Fatalf("travel-rule data stored in plaintext")
+	}
+
+	// Without the key a reload keeps the sealed annotation through saves
+	s2 := newTestSweeper(t, WithKV(kv))
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	if p, _ := s2.GetPlan(plan.ID); p.Annotation != nil {
+		t.Fatalf("annotation readable without the key")
+	}
+	if err := s2.MarkConfirmed(plan.ID, time.Now()); err != nil {
+		t.Fatalf("MarkConfirmed: %v", err)
+	}
+	s2 = newTestSweeper(t, WithKV(kv))
+	_ = s2.SetAnnotationKey(key)
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	p2, _ := s2.GetPlan(plan.ID)
+	if p2.Annotation == nil || p2.Annotation.Beneficiary.VASP != "OtherX" {
+		t.Fatalf("annotation not persisted")
+	}
+	if evs, _ := s2.ReplayEvents(0); len(evs) == 0 || evs[0].Payload.Annotation == nil || evs[0].SealedAnnotation != "" {
+		t.Fatalf("replayed events should carry the decrypted annotation: %+v", evs)
+	}
+
+	// References alone need no key
+	s3 := newTestSweeper(t)
+	_ = s3.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s3.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{Annotation: &PlanAnnotation{Reference: "wd-43"}}); err != nil {
+		t.Fatalf("Spend with a reference: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s2.ExportAccounting(&buf, "csv", StaticPrice(50_000)); err != nil {
+		t.Fatalf("ExportAccounting: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if !strings.Contains(strings.Join(rows[1], ","), "wd-42,Alice Example,cust-1,ExampleX,Bob Example") {
+		t.Fatalf("annotation columns missing: %v", rows[1])
+	}
+}
@@ -0,0 +1,203 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the versioned JSON output format.
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// APIVersion is the version of the JSON output format, reported as
+// "api_version" in every JSON document the CLI prints. Version 1 is the
+// original shape, which mixed Go field names (TxID, ValueSats) with snake_case
+// and carried no version marker.
+const APIVersion = 2
+
+// Output compatibility modes
+const (
+	CompatCurrent = ""   // Latest format
+	CompatV1      = "v1" // Original shape: Go field names kept, no api_version
+)
+
+// validateCompat rejects unknown output compatibility modes.
+func validateCompat(c string) error {
+	switch c {
+	case CompatCurrent, CompatV1:
+		return nil
+	}
+	return fmt.Errorf("unknown output compatibility '%s' - must be 'v1' or empty for the current format", c)
+}
+
+// MarshalOutput encodes a top-level JSON document in the given compatibility
+// mode. The current format converts every struct field name to snake_case and
+// adds "api_version"; v1 encodes doc unchanged.
+func MarshalOutput(doc map[string]interface{}, compat string, indent bool) ([]byte, error) {
+	if err := validateCompat(compat); err != nil {
+		return nil, err
+	}
+	var v interface{} = doc
+	if compat != CompatV1 {
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var generic map[string]interface{}
+		if err := json.Unmarshal(raw, &generic); err != nil {
+			return nil, err
+		}
+		generic = snakeCaseFields(reflect.ValueOf(doc), generic).(map[string]interface{})
+		generic["api_version"] = APIVersion
+		v = generic
+	}
+	if indent {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// Rename the keys of generic, the JSON decoding of v, that come from struct
+// fields to snake_case. Map keys are data, such as txids, addresses and
+// Annotation.Extra names, and are kept as they are; so is the output of types
+// with their own JSON encoding.
+func snakeCaseFields(v reflect.Value, generic interface{}) interface{} {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return generic
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Type().Implements(jsonMarshalerType) || reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) {
+		return generic
+	}
+	switch t := generic.(type) {
+	case map[string]interface{}:
+		switch v.Kind() {
+		case reflect.Struct:
+			fields := jsonFieldIndex(v.Type())
+			out := make(map[string]interface{}, len(t))
+			for k, val := range t {
+				idx, ok := fields[k]
+				if !ok {
+					out[k] = val
+					continue
+				}
+				if fv, err := v.FieldByIndexErr(idx); err == nil {
+					val = snakeCaseFields(fv, val)
+				}
+				out[snakeCase(k)] = val
+			}
+			return out
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				name := mapKeyName(iter.Key())
+				if val, ok := t[name]; ok {
+					t[name] = snakeCaseFields(iter.Value(), val)
+				}
+			}
+		}
+	case []interface{}:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			for i := range t {
+				if i < v.Len() {
+					t[i] = snakeCaseFields(v.Index(i), t[i])
+				}
+			}
+		}
+	}
+	return generic
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// JSON object key of each encoded field of struct type t and its index path;
+// fields of untagged embedded structs are promoted, shallower names winning
+func jsonFieldIndex(t reflect.Type) map[string][]int {
+	out := map[string][]int{}
+	var embedded [][]int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, []int{i})
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out[name] = []int{i}
+	}
+	for _, idx := range embedded {
+		ft := t.Field(idx[0]).Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		for name, sub := range jsonFieldIndex(ft) {
+			if _, ok := out[name]; !ok {
+				out[name] = append(append([]int(nil), idx...), sub...)
+			}
+		}
+	}
+	return out
+}
+
+// Object key encoding/json writes for a map key
+func mapKeyName(k reflect.Value) string {
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if b, err := tm.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// snakeCase converts a Go identifier such as "TxID" or "WeightBP" to
+// "tx_id" / "weight_bp"; other strings are returned unchanged.
+func snakeCase(s string) string {
+	r := []rune(s)
+	if len(r) == 0 || !unicode.IsUpper(r[0]) {
+		return s
+	}
+	for _, c := range r {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return s
+		}
+	}
+	var out []rune
+	for i, c := range r {
+		if unicode.IsUpper(c) {
+			prevLower := i > 0 && (unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1]))
+			acronymEnd := i > 0 && unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1])
+			if prevLower || acronymEnd {
+				out = append(out, '_')
+			}
+			c = unicode.ToLower(c)
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
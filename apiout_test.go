@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"TxID":          "tx_id",
+		"ValueSats":     "value_sats",
+		"WeightBP":      "weight_bp",
+		"Confirmations": "confirmations",
+		"fee_sats":      "fee_sats",
+		"tb1qabc":       "tb1qabc",
+		"HTTPServer":    "http_server",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Fatalf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMarshalOutputVersions(t *testing.T) {
+	doc := map[string]interface{}{
+		"transaction_plan": map[string]interface{}{
+			"inputs": []UTXO{{TxID: "ab", Vout: 1, ValueSats: 1000, Address: testAddr("in"), Confirmed: true}},
+		},
+	}
+	cur, err := MarshalOutput(doc, CompatCurrent, false)
+	if err != nil {
+		t.Fatalf("MarshalOutput: %v", err)
+	}
+	var m map[string]interface{}
+	_ = json.Unmarshal(cur, &m)
+	if m["api_version"] != float64(APIVersion) {
+		t.Fatalf("missing api_version: %s", cur)
+	}
+	if !strings.Contains(string(cur), `"tx_id":"ab"`) || strings.Contains(string(cur), "TxID") {
+		t.Fatalf("expected snake_case keys: %s", cur)
+	}
+
+	v1, err := MarshalOutput(doc, CompatV1, false)
+	if err != nil {
+		t.Fatalf("MarshalOutput v1: %v", err)
+	}
+	if strings.Contains(string(v1), "api_version") || !strings.Contains(string(v1), `"TxID":"ab"`) {
+		t.Fatalf("expected the original v1 shape: %s", v1)
+	}
+	if _, err := MarshalOutput(doc, "v9", false); err == nil {
+		t.Fatalf("expected unknown compat mode to be rejected")
+	}
+}
+
+func TestMarshalOutputKeepsMapKeys(t *testing.T) {
+	type inner struct{ ValueSats int64 }
+	type embedded struct{ WeightBP int }
+	doc := map[string]interface{}{
+		"annotation": &PlanAnnotation{Reference: "wd-1", Extra: map[string]string{"CaseID": "7", "TxID": "x"}},
+		"by_txid":    map[string]inner{"ABCD": {ValueSats: 5}},
+		"nested": struct {
+			embedded
+			Items []inner
+		}{embedded{3}, []inner{{1}}},
+	}
+	out, err := MarshalOutput(doc, CompatCurrent, false)
+	if err != nil {
+		t.Fatalf("MarshalOutput: %v", err)
+	}
+	for _, want := range []string{`"CaseID":"7"`, `"TxID":"x"`, `"ABCD":{"value_sats":5}`, `"weight_bp":3`, `"items":[{"value_sats":1}]`} {
+		if !strings.Contains(string(out), want) {
+			t.Fatalf("expected %s in %s", want, out)
+		}
+	}
+}
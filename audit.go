@@ -0,0 +1,112 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains auditing of the local UTXO index against a backend.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UTXOSource lists the unspent outputs held by a set of addresses, e.g. a
+// node or indexer backend.
+type UTXOSource interface {
+	ListUnspent(addresses []string) ([]UTXO, error)
+}
+
+// UTXOMismatch is an outpoint known locally and to the backend with differing details.
+type UTXOMismatch struct {
+	Local  UTXO `json:"local"`
+	Remote UTXO `json:"remote"`
+}
+
+// AuditReport lists drift between the local index and a backend.
+type AuditReport struct {
+	Addresses  []string       `json:"addresses"`  // Addresses queried
+	Missing    []UTXO         `json:"missing"`    // Reported by the backend but not indexed
+	Extra      []UTXO         `json:"extra"`      // Indexed but not reported (spent or never existed)
+	Mismatched []UTXOMismatch `json:"mismatched"` // Value or address differs
+}
+
+// InSync reports whether the audit found no drift.
+func (r *AuditReport) InSync() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// AuditAgainst compares the local index with what source reports for our
+// addresses (every address seen by Index plus the change address) and lists
+// missing, extra and value-mismatched UTXOs. It does not modify the index.
+func (s *Sweeper) AuditAgainst(source UTXOSource) (*AuditReport, error) {
+	if source == nil {
+		return nil, errors.New("no UTXO source given")
+	}
+	addrs := s.ownAddresses()
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to audit - index UTXOs first")
+	}
+	remote, err := source.ListUnspent(addrs)
+	if err != nil {
+		return nil, fmt.Errorf("backend ListUnspent failed: %w", err)
+	}
+
+	rep := &AuditReport{Addresses: addrs}
+	local := map[string]UTXO{}
+	for _, u := range s.indexedUTXOs {
+		local[outpointKey(u)] = u
+	}
+	seen := map[string]bool{}
+	for _, r := range remote {
+		k := outpointKey(r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		l, ok := local[k]
+		switch {
+		case !ok:
+			rep.Missing = append(rep.Missing, r)
+		case l.ValueSats != r.ValueSats || l.Address != r.Address:
+			rep.Mismatched = append(rep.Mismatched, UTXOMismatch{Local: l, Remote: r})
+		}
+	}
+	for k, l := range local {
+		if !seen[k] {
+			rep.Extra = append(rep.Extra, l)
+		}
+	}
+	sortUTXOs(rep.Missing)
+	sortUTXOs(rep.Extra)
+	sort.Slice(rep.Mismatched, func(i, j int) bool {
+		return outpointKey(rep.Mismatched[i].Local) < outpointKey(rep.Mismatched[j].Local)
+	})
+	return rep, nil
+}
+
+// Collect our addresses: those seen by Index plus the change address
+func (s *Sweeper) ownAddresses() []string {
+	set := map[string]bool{}
+	for _, a := range s.AddressStats() {
+		set[a.Address] = true
+	}
+	for _, u := range s.indexedUTXOs {
+		set[u.Address] = true
+	}
+	if ch, err := s.getChangeAddress(); err == nil {
+		set[ch] = true
+	}
+	out := make([]string, 0, len(set))
+	for a := range set {
+		out = append(out, a)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Key a UTXO by its outpoint
+func outpointKey(u UTXO) string {
+	return fmt.Sprintf("%s:%d", u.TxID, u.Vout)
+}
+
+func sortUTXOs(us []UTXO) {
+	sort.Slice(us, func(i, j int) bool { return outpointKey(us[i]) < outpointKey(us[j]) })
+}
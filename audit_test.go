@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+type fakeSource []UTXO
+
+func (f fakeSource) ListUnspent(addresses []string) ([]UTXO, error) {
+	want := map[string]bool{}
+	for _, a := range addresses {
+		want[a] = true
+	}
+	var out []UTXO
+	for _, u := range f {
+		if want[u.Address] {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func TestAuditAgainstReportsDrift(t *testing.T) {
+	s := newTestSweeper(t)
+	same := UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true}
+	spent := UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 50_000, Address: testAddr("in"), Confirmed: true}
+	changed := UTXO{TxID: stringsRepeat("c", 64), Vout: 1, ValueSats: 70_000, Address: testAddr("in"), Confirmed: true}
+	for _, u := range []UTXO{same, spent, changed} {
+		_ = s.Index(u)
+	}
+	remoteChanged := changed
+	remoteChanged.ValueSats = 71_000
+	change, _ := s.getChangeAddress()
+	missing := UTXO{TxID: stringsRepeat("d", 64), Vout: 2, ValueSats: 30_000, Address: change, Confirmed: true}
+	foreign := UTXO{TxID: stringsRepeat("e", 64), Vout: 0, ValueSats: 30_000, Address: testAddr("someoneelse"), Confirmed: true}
+
+	rep, err := s.AuditAgainst(fakeSource{same, remoteChanged, missing, foreign})
+	if err != nil {
+		t.Fatalf("AuditAgainst: %v", err)
+	}
+	if rep.InSync() {
+		t.Fatalf("expected drift")
+	}
+	if len(rep.Missing) != 1 || rep.Missing[0].TxID != missing.TxID {
+		t.Fatalf("missing = %+v", rep.Missing)
+	}
+	if len(rep.Extra) != 1 || rep.Extra[0].TxID != spent.TxID {
+		t.Fatalf("extra = %+v", rep.Extra)
+	}
+	if len(rep.Mismatched) != 1 || rep.Mismatched[0].Remote.ValueSats != 71_000 {
+		t.Fatalf("mismatched = %+v", rep.Mismatched)
+	}
+
+	rep, err = s.AuditAgainst(fakeSource{same, spent, changed})
+	if err != nil || !rep.InSync() {
+		t.Fatalf("expected in-sync audit, got %+v (%v)", rep, err)
+	}
+}
@@ -0,0 +1,351 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains an in-memory fake backend for hermetic integration tests.
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// mockBlockInterval is the time between blocks mined by MockBackend.
+const mockBlockInterval = 10 * time.Minute
+
+// MockBackend is an in-memory chain and mempool implementing UTXOSource,
+// Broadcaster, FeeRateProvider, ChainInfoProvider, ConfirmationSource and
+// MempoolSource, so sweep flows can be tested without a node. Coins are
+// created with Fund, broadcast transactions enter the mempool, and MineBlocks,
+// Reorg and Evict control when (and whether) they confirm. Signatures are not
+// checked; inputs must exist and be unspent. It is safe for concurrent use.
+type MockBackend struct {
+	// BroadcastErr, if set, makes Broadcast fail with it (e.g. a relay policy
+	// rejection) without touching the mempool.
+	BroadcastErr error
+
+	mu       sync.Mutex
+	network  Network
+	height   int64
+	times    map[int64]time.Time // Block times by height
+	feeRate  FeeRate
+	txs      map[string]*mockTx
+	order    []string          // Txids in the order they were first seen
+	spent    map[string]string // Outpoint -> spending txid
+	funded   uint64
+	accepted []string
+}
+
+// A transaction known to the mock: mined (height > 0) or in the mempool
+type mockTx struct {
+	txid      string
+	inputs    []string // Outpoints spent
+	outputs   []UTXO   // Outputs with a standard script; Confirmed is filled on query
+	height    int64
+	fee       int64
+	vsize     int64
+	rbf       bool
+	version   int32
+	firstSeen time.Time
+}
+
+// NewMockBackend starts a chain at height whose tip was mined at tipTime, with
+// a fee rate of 1 sat/vB.
+func NewMockBackend(network Network, height int64, tipTime time.Time) *MockBackend {
+	m := &MockBackend{network: network, height: height, times: map[int64]time.Time{}, feeRate: 1000, txs: map[string]*mockTx{}, spent: map[string]string{}}
+	for h := height; h >= 0 && h > height-11; h-- {
+		m.times[h] = tipTime.Add(-time.Duration(height-h) * mockBlockInterval)
+	}
+	return m
+}
+
+// SetFeeRate sets the rate in whole sat/vB EstimateFeeRate returns for every target.
+func (m *MockBackend) SetFeeRate(satsPerVB int64) {
+	m.SetFeeRateKVB(SatPerVByte(satsPerVB))
+}
+
+// SetFeeRateKVB sets the rate in sat/kvB EstimateFeeRate returns for every target.
+func (m *MockBackend) SetFeeRateKVB(rate FeeRate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feeRate = rate
+}
+
+// Fund creates a coin paying value to addr in a new mempool transaction; mine
+// a block to confirm it.
+func (m *MockBackend) Fund(addr string, value int64) UTXO {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funded++
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], m.funded)
+	h := sha256Double(append([]byte("mock-funding"), seed[:]...))
+	u := UTXO{TxID: hashToStr(h), Vout: 0, ValueSats: value, Address: addr}
+	m.add(&mockTx{txid: u.TxID, outputs: []UTXO{u}, vsize: 100, firstSeen: m.now()})
+	return u
+}
+
+// MineBlocks mines n blocks, the first confirming every mempool transaction.
+func (m *MockBackend) MineBlocks(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < n; i++ {
+		m.height++
+		m.times[m.height] = m.times[m.height-1].Add(mockBlockInterval)
+		if i > 0 {
+			continue
+		}
+		for _, tx := range m.txs {
+			if tx.height == 0 {
+				tx.height = m.height
+			}
+		}
+	}
+}
+
+// Reorg disconnects the top depth blocks and mines depth+1 empty ones in their
+// place; transactions from the disconnected blocks return to the mempool.
+func (m *MockBackend) Reorg(depth int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if depth < 1 || int64(depth) > m.height {
+		return fmt.Errorf("cannot reorg %d blocks at height %d", depth, m.height)
+	}
+	fork := m.height - int64(depth)
+	for _, tx := range m.txs {
+		if tx.height > fork {
+			tx.height = 0
+		}
+	}
+	for h := fork + 1; h <= m.height+1; h++ {
+		m.times[h] = m.times[h-1].Add(mockBlockInterval)
+	}
+	m.height++
+	return nil
+}
+
+// Evict drops a mempool transaction and its descendants, as after expiry or
+// replacement, making its inputs spendable again.
+func (m *MockBackend) Evict(txid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.txs[txid]
+	if !ok || tx.height != 0 {
+		return fmt.Errorf("transaction %s is not in the mempool", txid)
+	}
+	m.evict(tx)
+	return nil
+}
+
+func (m *MockBackend) evict(tx *mockTx) {
+	for _, o := range tx.outputs {
+		if child, ok := m.spent[outpointKey(o)]; ok {
+			m.evict(m.txs[child])
+		}
+	}
+	for _, in := range tx.inputs {
+		delete(m.spent, in)
+	}
+	delete(m.txs, tx.txid)
+	for i, id := range m.order {
+		if id == tx.txid {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Accepted returns the txids of transactions accepted by Broadcast, in order.
+func (m *MockBackend) Accepted() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.accepted...)
+}
+
+// ListUnspent returns unspent coins paying the addresses, oldest first.
+func (m *MockBackend) ListUnspent(addresses []string) ([]UTXO, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	want := map[string]bool{}
+	for _, a := range addresses {
+		want[a] = true
+	}
+	var out []UTXO
+	for _, id := range m.order {
+		tx := m.txs[id]
+		for _, o := range tx.outputs {
+			if !want[o.Address] || m.spent[outpointKey(o)] != "" {
+				continue
+			}
+			if tx.height > 0 {
+				o.Confirmed, o.Confirmations = true, int(m.height-tx.height+1)
+			}
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+// Broadcast accepts a transaction into the mempool if its inputs exist and
+// are unspent, and returns its txid.
+func (m *MockBackend) Broadcast(rawTx []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.BroadcastErr != nil {
+		return "", m.BroadcastErr
+	}
+	msg, err := DeserializeMsgTx(rawTx)
+	if err != nil {
+		return "", fmt.Errorf("TX decode failed: %w", err)
+	}
+	txid := msg.TxID()
+	if _, ok := m.txs[txid]; ok {
+		return "", errors.New("txn-already-known")
+	}
+	tx := &mockTx{txid: txid, version: msg.Version, firstSeen: m.now()}
+	var in int64
+	for _, txin := range msg.TxIn {
+		key := fmt.Sprintf("%s:%d", hashToStr(txin.PreviousOutPoint.Hash), txin.PreviousOutPoint.Index)
+		prev := m.output(key)
+		if prev == nil {
+			return "", fmt.Errorf("bad-txns-inputs-missingorspent: %s", key)
+		}
+		if by := m.spent[key]; by != "" {
+			return "", fmt.Errorf("txn-mempool-conflict: %s is spent by %s", key, by)
+		}
+		in += prev.ValueSats
+		tx.inputs = append(tx.inputs, key)
+		tx.rbf = tx.rbf || txin.Sequence < 0xfffffffe
+	}
+	var out int64
+	for i, txout := range msg.TxOut {
+		out += txout.Value
+		if addr, ok := scriptAddress(txout.PkScript, m.network); ok {
+			tx.outputs = append(tx.outputs, UTXO{TxID: txid, Vout: uint32(i), ValueSats: txout.Value, Address: addr})
+		}
+	}
+	if out > in {
+		return "", fmt.Errorf("bad-txns-in-belowout: %d in, %d out", in, out)
+	}
+	tx.fee = in - out
+	tx.vsize = int64((len(msg.Serialize(false))*3 + len(rawTx) + 3) / 4)
+	m.add(tx)
+	m.accepted = append(m.accepted, txid)
+	return txid, nil
+}
+
+// EstimateFeeRate returns the rate set with SetFeeRate.
+func (m *MockBackend) EstimateFeeRate(int) (FeeRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.feeRate, nil
+}
+
+// ChainTip returns the tip height and its median time past.
+func (m *MockBackend) ChainTip() (int64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var times []time.Time
+	for h := m.height; h > m.height-11 && h >= 0; h-- {
+		if t, ok := m.times[h]; ok {
+			times = append(times, t)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return m.height, times[len(times)/2], nil
+}
+
+// Confirmations returns 0 for mempool transactions and an error for unknown
+// (e.g. evicted) ones.
+func (m *MockBackend) Confirmations(txid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.txs[txid]
+	if !ok {
+		return 0, fmt.Errorf("transaction %s not found", txid)
+	}
+	if tx.height == 0 {
+		return 0, nil
+	}
+	return int(m.height - tx.height + 1), nil
+}
+
+// MempoolTx describes a mempool transaction, or fails if it is not in the
+// mempool.
+func (m *MockBackend) MempoolTx(txid string) (*MempoolTxInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.txs[txid]
+	if !ok || tx.height != 0 {
+		return nil, fmt.Errorf("transaction %s is not in the mempool", txid)
+	}
+	info := &MempoolTxInfo{SignalsRBF: tx.rbf, FirstSeen: tx.firstSeen, AncestorFeeSats: tx.fee, AncestorVSize: tx.vsize, Version: tx.version}
+	if tx.vsize > 0 {
+		info.FeeRateSatsVB = float64(tx.fee) / float64(tx.vsize)
+	}
+	// Walk unconfirmed ancestors once each
+	seen := map[string]bool{}
+	queue := append([]string(nil), tx.inputs...)
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		parent := m.txs[key[:64]]
+		if parent == nil || parent.height != 0 || seen[parent.txid] {
+			continue
+		}
+		seen[parent.txid] = true
+		info.UnconfirmedAncestors++
+		info.AncestorFeeSats += parent.fee
+		info.AncestorVSize += parent.vsize
+		info.SignalsRBF = info.SignalsRBF || parent.rbf
+		queue = append(queue, parent.inputs...)
+	}
+	return info, nil
+}
+
+func (m *MockBackend) add(tx *mockTx) {
+	m.txs[tx.txid] = tx
+	m.order = append(m.order, tx.txid)
+	for _, in := range tx.inputs {
+		m.spent[in] = tx.txid
+	}
+}
+
+// Output at an outpoint key, if known
+func (m *MockBackend) output(key string) *UTXO {
+	tx := m.txs[key[:64]]
+	if tx == nil {
+		return nil
+	}
+	for i := range tx.outputs {
+		if outpointKey(tx.outputs[i]) == key {
+			return &tx.outputs[i]
+		}
+	}
+	return nil
+}
+
+// Mock clock: the tip's block time
+func (m *MockBackend) now() time.Time {
+	return m.times[m.height]
+}
+
+// Address of a standard output script
+func scriptAddress(script []byte, network Network) (string, bool) {
+	cfg := networkConfigs[network]
+	var addr string
+	var err error
+	switch {
+	case len(script) == 22 && script[0] == 0x00 && script[1] == 0x14,
+		len(script) == 34 && script[0] == 0x00 && script[1] == 0x20:
+		addr, err = EncodeSegWitAddress(cfg.Bech32HRP, 0, script[2:])
+	case len(script) == 34 && script[0] == 0x51 && script[1] == 0x20:
+		addr, err = EncodeSegWitAddress(cfg.Bech32mHRP, 1, script[2:])
+	case len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 0x14 && script[23] == 0x88 && script[24] == 0xac:
+		addr, err = CreateP2PKH(script[3:23], network)
+	default:
+		return "", false
+	}
+	return addr, err == nil
+}
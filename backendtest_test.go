@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMockBackendSweepFlow(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMockBackend(BitcoinTestnet, 100, t0)
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinTestnet)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinTestnet)
+	dest, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+
+	m.Fund(own, 150_000)
+	m.Fund(own, 80_000)
+	m.MineBlocks(2)
+	utxos, _ := m.ListUnspent([]string{own})
+	if len(utxos) != 2 || utxos[0].Confirmations != 2 {
+		t.Fatalf("unexpected UTXOs %+v", utxos)
+	}
+	for _, u := range utxos {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	m.SetFeeRate(3)
+	rate, _ := m.EstimateFeeRate(6)
+	_ = s.SetFeeRateKVB(rate)
+	s.SetChainInfo(m)
+	if h, mtp, _ := m.ChainTip(); h != 102 || !mtp.Equal(t0.Add(-3*mockBlockInterval)) {
+		t.Fatalf("tip %d at %s", h, mtp)
+	}
+
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx // The mock does not check signatures
+	m.BroadcastErr = errors.New("min relay fee not met")
+	if _, err := s.BroadcastPlan(plan.ID, m); err == nil {
+		t.Fatalf("expected the injected broadcast error")
+	}
+	m.BroadcastErr = nil
+	if txid, err := s.BroadcastPlan(plan.ID, m); err != nil || txid != plan.ID {
+		t.Fatalf("BroadcastPlan = %s, %v", txid, err)
+	}
+	if _, err := m.Broadcast(plan.RawTx.Serialize(true)); err == nil {
+		t.Fatalf("expected a duplicate broadcast to be refused")
+	}
+	info, err := m.MempoolTx(plan.ID)
+	if err != nil || info.FeeRateSatsVB < 3 {
+		t.Fatalf("MempoolTx = %+v, %v", info, err)
+	}
+	// The spent coins are gone; the outputs are unconfirmed
+	utxos, _ = m.ListUnspent([]string{own, dest})
+	if len(utxos) != len(plan.Outputs) || utxos[0].TxID != plan.ID || utxos[0].Confirmed {
+		t.Fatalf("unexpected UTXOs after broadcast %+v", utxos)
+	}
+
+	tr := NewConfirmationTracker(s, m)
+	m.MineBlocks(2)
+	sts, err := tr.Poll(time.Now())
+	if err != nil || sts[0].State != PlanConfirmed || sts[0].Confirmations != 2 {
+		t.Fatalf("Poll = %+v, %v", sts, err)
+	}
+
+	// A reorg deeper than the confirmations returns the sweep to the mempool
+	if err := m.Reorg(2); err != nil {
+		t.Fatalf("Reorg: %v", err)
+	}
+	if n, _ := m.Confirmations(plan.ID); n != 0 {
+		t.Fatalf("%d confirmations after reorg, want 0", n)
+	}
+	if err := m.Evict(plan.ID); err != nil {
+		t.Fatalf("Evict: %v", err)
+	}
+	if _, err := m.Confirmations(plan.ID); err == nil {
+		t.Fatalf("evicted transaction still known")
+	}
+	if utxos, _ := m.ListUnspent([]string{own}); len(utxos) != 2 {
+		t.Fatalf("evicted sweep's inputs not restored: %+v", utxos)
+	}
+	if got := m.Accepted(); len(got) != 1 || got[0] != plan.ID {
+		t.Fatalf("Accepted = %v", got)
+	}
+	if _, err := m.Broadcast(plan.RawTx.Serialize(true)); err != nil || m.Accepted()[1] != plan.ID {
+		t.Fatalf("rebroadcast after eviction failed: %v", err)
+	}
+}
+
+func TestRegtestSweepWithRealAddresses(t *testing.T) {
+	m := NewMockBackend(BitcoinRegtest, 200, time.Now())
+	pub, _ := hex.DecodeString(legacyTestPub)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinRegtest)
+	cold, _ := CreateP2WPKH(Hash160([]byte("cold wallet")), BitcoinRegtest)
+	dest, _ := CreateP2WPKH(make([]byte, 20), BitcoinRegtest)
+	wrongNet, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+	if own[:6] != "bcrt1q" {
+		t.Fatalf("regtest address %s", own)
+	}
+	s := mustNewSweeper(t, pub, BitcoinRegtest)
+
+	m.Fund(own, 120_000)
+	m.Fund(cold, 90_000)
+	m.MineBlocks(1)
+	utxos, _ := m.ListUnspent([]string{own, cold})
+	for _, u := range utxos {
+		if err := s.Index(u); (err != nil) != (u.Address == cold) {
+			t.Fatalf("Index(%s): %v", u.Address, err)
+		}
+	}
+
+	// An injected validator accepts coins the public key does not own, but
+	// decoding and the network check still apply
+	s.SetOwnershipValidator(func(u UTXO) error {
+		if u.Address != cold && u.Address != wrongNet {
+			return errors.New("not ours")
+		}
+		return nil
+	})
+	for _, u := range utxos {
+		if u.Address == cold {
+			if err := s.Index(u); err != nil {
+				t.Fatalf("Index with validator: %v", err)
+			}
+		}
+	}
+	if err := s.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: 0, ValueSats: 50_000, Address: wrongNet, Confirmed: true}); err == nil {
+		t.Fatalf("expected a testnet address to be refused on regtest")
+	}
+	if _, err := s.Spend([]TxOutput{{Address: wrongNet, ValueSats: 10_000}}); err == nil {
+		t.Fatalf("expected a testnet destination to be refused on regtest")
+	}
+
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 150_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	change, _ := DeriveChangeAddress(pub, BitcoinRegtest)
+	if len(plan.ChangeIdxs) != 1 || plan.Outputs[plan.ChangeIdxs[0]].Address != change {
+		t.Fatalf("change %+v, want %s", plan.Outputs, change)
+	}
+	// Every output script encodes its planned address
+	for i, out := range plan.RawTx.TxOut {
+		if addr, ok := scriptAddress(out.PkScript, BitcoinRegtest); !ok || addr != plan.Outputs[i].Address {
+			t.Fatalf("output %d script pays %s, planned %s", i, addr, plan.Outputs[i].Address)
+		}
+	}
+	plan.SignedTx = plan.RawTx
+	if _, err := s.BroadcastPlan(plan.ID, m); err != nil {
+		t.Fatalf("BroadcastPlan: %v", err)
+	}
+	if got, _ := m.ListUnspent([]string{change}); len(got) != 1 || got[0].TxID != plan.ID {
+		t.Fatalf("change not found on the fake network: %+v", got)
+	}
+	if (&Config{Network: "bitcoin_regtest"}).ToNetwork() != BitcoinRegtest {
+		t.Fatalf("bitcoin_regtest config not mapped")
+	}
+}
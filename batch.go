@@ -0,0 +1,363 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains batch export of pending plans for offline signing and
+// manifest-driven import of the signed results.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BatchManifestVersion is the manifest format version written by ExportBatch.
+const BatchManifestVersion = 1
+
+// batchManifestFile is the manifest file name inside a batch directory.
+const batchManifestFile = "manifest.json"
+
+// BatchManifest describes a set of plans exported for signing.
+// Signers drop each signed PSBT at the entry's SignedFile path.
+type BatchManifest struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Entries   []BatchEntry `json:"entries"`
+}
+
+// BatchEntry describes a single exported plan inside a batch.
+type BatchEntry struct {
+	PlanID     string   `json:"plan_id"`              // ID of the pending plan
+	File       string   `json:"file"`                 // Unsigned PSBT (base64), relative to the batch dir
+	SignedFile string   `json:"signed_file"`          // Expected signed PSBT, relative to the batch dir
+	DependsOn  []string `json:"depends_on,omitempty"` // Plans whose outputs this plan spends
+	FeeSats    int64    `json:"fee_sats"`             // Planned fee for reviewers
+	Inputs     int      `json:"inputs"`               // Number of inputs
+	Outputs    int      `json:"outputs"`              // Number of outputs
+}
+
+// FinalizedPlan is a plan whose signed PSBT was imported and finalized.
+type FinalizedPlan struct {
+	Plan *TransactionPlan // The pending plan the signatures belong to
+	Tx   *MsgTx           // Fully signed transaction ready to broadcast
+}
+
+// ExportBatch writes the given plans as base64 PSBT files plus a manifest into dir.
+// The manifest records dependencies between plans so ImportSignedBatch can
+// return transactions in a valid broadcast order.
+func (s *Sweeper) ExportBatch(dir string, plans []*TransactionPlan) (*BatchManifest, error) {
+	if len(plans) == 0 {
+		return nil, errors.New("no plans to export")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create batch dir '%s': %w", dir, err)
+	}
+	m := &BatchManifest{Version: BatchManifestVersion, CreatedAt: time.Now().UTC()}
+	for _, p := range plans {
+		if _, ok := s.plans[p.ID]; !ok {
+			return nil, fmt.Errorf("plan %q is not pending in this sweeper", p.ID)
+		}
+		b64, err := p.PSBT.B64Encode()
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: %w", p.ID, err)
+		}
+		e := BatchEntry{
+			PlanID:     p.ID,
+			File:       p.ID + ".psbt",
+			SignedFile: p.ID + ".signed.psbt",
+			DependsOn:  planDependencies(p, plans),
+			FeeSats:    p.FeeSats,
+			Inputs:     len(p.Inputs),
+			Outputs:    len(p.Outputs),
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.File), []byte(b64), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write PSBT for plan %s: %w", p.ID, err)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, batchManifestFile), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return m, nil
+}
+
+// ImportSignedBatch reads the manifest in dir, matches each signed PSBT to its
+// pending plan by ID, validates that the signer did not alter the transaction,
+// finalizes every input, and returns the transactions in dependency order
+// (parents before the children that spend them).
+func (s *Sweeper) ImportSignedBatch(dir string) ([]*FinalizedPlan, error) {
+	data, err := os.ReadFile(filepath.Join(dir, batchManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch manifest: %w", err)
+	}
+	var m BatchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse batch manifest: %w", err)
+	}
+	if m.Version != BatchManifestVersion {
+		return nil, fmt.Errorf("unsupported batch manifest version %d (expected %d)", m.Version, BatchManifestVersion)
+	}
+	if len(m.Entries) == 0 {
+		return nil, errors.New("batch manifest has no entries")
+	}
+
+	seen := make(map[string]bool, len(m.Entries))
+	for _, e := range m.Entries {
+		if seen[e.PlanID] {
+			return nil, fmt.Errorf("batch manifest lists plan %q more than once", e.PlanID)
+		}
+		seen[e.PlanID] = true
+	}
+
+	finalized := make([]*FinalizedPlan, 0, len(m.Entries))
+	plans := make([]*TransactionPlan, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		plan, ok := s.plans[e.PlanID]
+		if !ok {
+			return nil, fmt.Errorf("manifest references unknown plan %q", e.PlanID)
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, e.SignedFile))
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: signed PSBT missing: %w", e.PlanID, err)
+		}
+		psbt, err := decodePSBTFile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: %w", e.PlanID, err)
+		}
+		tx, err := finalizeSignedPSBT(plan, psbt)
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: %w", e.PlanID, err)
+		}
+		finalized = append(finalized, &FinalizedPlan{Plan: plan, Tx: tx})
+		plans = append(plans, plan)
+	}
+
+	ordered, err := orderByDependencies(finalized, plans)
+	if err != nil {
+		return nil, err
+	}
+	// Check every plan can be marked signed before changing any of them
+	for _, f := range ordered {
+		if f.Plan.BroadcastAt == nil {
+			if err := checkTransition(f.Plan, PlanSigned); err != nil {
+				return nil, err
+			}
+		}
+	}
+	now := time.Now()
+	for _, f := range ordered {
+		f.Plan.SignedTx = f.Tx
+		if f.Plan.BroadcastAt == nil {
+			_ = transitionPlan(f.Plan, PlanSigned, now, "")
+		}
+		if err := s.savePlan(f.Plan); err != nil {
+			return nil, fmt.Errorf("plan %s: %w", f.Plan.ID, err)
+		}
+	}
+	return ordered, nil
+}
+
+// Accept binary PSBTs or their base64 or base43 (Electrum QR) text forms
+func decodePSBTFile(raw []byte) (*PSBT, error) {
+	if bytes.HasPrefix(raw, []byte("psbt\xff")) {
+		return ParsePSBT(raw)
+	}
+	text := strings.TrimSpace(string(raw))
+	if b, err := DecodeBase43(text); err == nil && bytes.HasPrefix(b, []byte("psbt\xff")) {
+		return ParsePSBT(b) // Scanned from an Electrum QR code
+	}
+	if _, err := base64.StdEncoding.DecodeString(text); err != nil {
+		return nil, errors.New("signed file is neither a binary, base64 nor base43 PSBT")
+	}
+	return DecodePSBTB64(text)
+}
+
+// finalizeSignedPSBT checks that the PSBT signs exactly the planned transaction
+// and returns the transaction with final scriptSigs and witnesses attached.
+func finalizeSignedPSBT(plan *TransactionPlan, psbt *PSBT) (*MsgTx, error) {
+	want := plan.RawTx.Serialize(false)
+	if !bytes.Equal(psbt.UnsignedTx.Serialize(false), want) {
+		return nil, errors.New("signed PSBT does not match the planned transaction")
+	}
+	tx, err := DeserializeMsgTx(want)
+	if err != nil {
+		return nil, err
+	}
+	h := &sigHasher{tx: tx, prevs: make([]*TxOut, len(tx.TxIn))}
+	for i := range h.prevs {
+		h.prevs[i] = spentOutput(&plan.PSBT.Inputs[i], tx.TxIn[i].PreviousOutPoint)
+	}
+	for i := range psbt.Inputs {
+		in := &psbt.Inputs[i]
+		if prev := h.prevs[i]; in.WitnessUtxo != nil && prev != nil {
+			if in.WitnessUtxo.Value != prev.Value || !bytes.Equal(in.WitnessUtxo.PkScript, prev.PkScript) {
+				return nil, fmt.Errorf("input %d: witness UTXO differs from plan", i)
+			}
+		}
+		sigScript, witness, err := finalizeInput(h, i, in)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+		tx.TxIn[i].Witness = witness
+	}
+	return tx, nil
+}
+
+// finalizeInput derives the final scriptSig and witness for input idx of the
+// transaction h hashes. P2WPKH and P2WSH multisig partial signatures and
+// taproot key-path signatures are assembled into witnesses, and P2PKH
+// signatures into a scriptSig, each only once it verifies against the
+// spent output. Already-finalized inputs are taken as-is, after checking the
+// signature of P2WPKH and taproot key-path witnesses.
+func finalizeInput(h *sigHasher, idx int, in *PSBTInput) ([]byte, [][]byte, error) {
+	prev := h.prevs[idx]
+	if len(in.FinalScriptWitness) > 0 || len(in.FinalScriptSig) > 0 {
+		if prev != nil {
+			if err := h.checkFinalWitness(idx, prev, in.FinalScriptWitness); err != nil {
+				return nil, nil, err
+			}
+		}
+		return in.FinalScriptSig, in.FinalScriptWitness, nil
+	}
+	if prev == nil {
+		return nil, nil, errors.New("no UTXO data to finalize against")
+	}
+	script := prev.PkScript
+	switch {
+	case isP2TRScript(script):
+		if len(in.TapKeySig) == 0 {
+			return nil, nil, errors.New("missing taproot key-path signature")
+		}
+		if err := h.checkTaprootSig(idx, script, in.TapKeySig); err != nil {
+			return nil, nil, fmt.Errorf("taproot key-path signature: %w", err)
+		}
+		return nil, [][]byte{in.TapKeySig}, nil
+	case isP2WPKHScript(script):
+		for pk, sig := range in.PartialSigs {
+			if bytesEqual(Hash160([]byte(pk)), script[2:]) {
+				if err := h.checkP2WPKHSig(idx, prev, []byte(pk), sig); err != nil {
+					return nil, nil, fmt.Errorf("P2WPKH partial signature: %w", err)
+				}
+				return nil, [][]byte{sig, []byte(pk)}, nil
+			}
+		}
+		return nil, nil, errors.New("no partial signature for the P2WPKH key")
+	case len(script) == 34 && script[0] == 0x00 && script[1] == 0x20:
+		return finalizeMultisig(h, idx, in, prev)
+	case isP2PKHScript(script):
+		return finalizeP2PKH(h, idx, in, script)
+	default:
+		return nil, nil, errors.New("unsupported script type for finalization")
+	}
+}
+
+func isP2TRScript(script []byte) bool {
+	return len(script) == 34 && script[0] == 0x51 && script[1] == 0x20
+}
+
+func isP2WPKHScript(script []byte) bool {
+	return len(script) == 22 && script[0] == 0x00 && script[1] == 0x14
+}
+
+// Check the BIP-143 signature sig by pk of input idx spending P2WPKH prev
+func (h *sigHasher) checkP2WPKHSig(idx int, prev *TxOut, pk, sig []byte) error {
+	scriptCode := BuildP2PKHScript(prev.PkScript[2:])
+	return checkECDSASig(pk, sig, func(ht uint32) ([32]byte, error) {
+		return h.witnessV0(idx, scriptCode, prev.Value, ht), nil
+	})
+}
+
+// Check the signature of a finalized P2WPKH or taproot key-path witness;
+// other templates are not checked
+func (h *sigHasher) checkFinalWitness(idx int, prev *TxOut, witness [][]byte) error {
+	switch {
+	case isP2TRScript(prev.PkScript) && len(witness) == 1:
+		if err := h.checkTaprootSig(idx, prev.PkScript, witness[0]); err != nil {
+			return fmt.Errorf("finalized taproot witness: %w", err)
+		}
+	case isP2WPKHScript(prev.PkScript) && len(witness) == 2:
+		if !bytesEqual(Hash160(witness[1]), prev.PkScript[2:]) {
+			return errors.New("finalized P2WPKH witness key does not match the spent output")
+		}
+		if err := h.checkP2WPKHSig(idx, prev, witness[1], witness[0]); err != nil {
+			return fmt.Errorf("finalized P2WPKH witness: %w", err)
+		}
+	}
+	return nil
+}
+
+// Assemble a multisig witness: empty dummy, k signatures in script key order,
+// then the witness script. Every signature used must verify.
+func finalizeMultisig(h *sigHasher, idx int, in *PSBTInput, prev *TxOut) ([]byte, [][]byte, error) {
+	if len(in.WitnessScript) == 0 || !bytesEqual(SHA256(in.WitnessScript), prev.PkScript[2:]) {
+		return nil, nil, errors.New("missing or mismatched witness script for P2WSH input")
+	}
+	k, pubs, err := parseMultisigScript(in.WitnessScript)
+	if err != nil {
+		return nil, nil, err
+	}
+	witness := [][]byte{{}}
+	for _, pk := range pubs {
+		sig := in.PartialSigs[string(pk)]
+		if len(sig) == 0 || len(witness) > k {
+			continue
+		}
+		err := checkECDSASig(pk, sig, func(ht uint32) ([32]byte, error) {
+			return h.witnessV0(idx, in.WitnessScript, prev.Value, ht), nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("multisig partial signature for %x: %w", pk, err)
+		}
+		witness = append(witness, sig)
+	}
+	if got := len(witness) - 1; got < k {
+		return nil, nil, fmt.Errorf("multisig input has %d of %d required signatures", got, k)
+	}
+	return nil, append(witness, in.WitnessScript), nil
+}
+
+// Order finalized plans so that parents precede the children spending them
+func orderByDependencies(items []*FinalizedPlan, plans []*TransactionPlan) ([]*FinalizedPlan, error) {
+	byID := make(map[string]*FinalizedPlan, len(items))
+	pending := make(map[string][]string, len(items))
+	for _, f := range items {
+		byID[f.Plan.ID] = f
+		pending[f.Plan.ID] = planDependencies(f.Plan, plans)
+	}
+	done := make(map[string]bool, len(items))
+	ordered := make([]*FinalizedPlan, 0, len(items))
+	for len(ordered) < len(items) {
+		progressed := false
+		for _, f := range items {
+			id := f.Plan.ID
+			if done[id] {
+				continue
+			}
+			ready := true
+			for _, dep := range pending[id] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[id] = true
+				ordered = append(ordered, byID[id])
+				progressed = true
+			}
+		}
+		if !progressed {
+			return nil, errors.New("dependency cycle between batch plans")
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchExportImportOrdersByDependency(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(0xba7c4)}
+	pk := key.pub()
+	addr, err := CreateP2WPKH(Hash160(pk), BitcoinTestnet)
+	if err != nil {
+		t.Fatalf("CreateP2WPKH: %v", err)
+	}
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: addr, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	parent, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend parent: %v", err)
+	}
+
+	// Spend the parent's change output in a chained child plan
+	s.ClearIndex()
+	change := parent.Outputs[parent.ChangeIdxs[0]]
+	if err := s.Index(UTXO{TxID: parent.ExpectedTxID(), Vout: uint32(parent.ChangeIdxs[0]), ValueSats: change.ValueSats, Address: addr, Confirmed: false}); err != nil {
+		t.Fatalf("Index child input: %v", err)
+	}
+	child, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 40_000}})
+	if err != nil {
+		t.Fatalf("Spend child: %v", err)
+	}
+
+	dir := t.TempDir()
+	m, err := s.ExportBatch(dir, []*TransactionPlan{child, parent})
+	if err != nil {
+		t.Fatalf("ExportBatch: %v", err)
+	}
+	if len(m.Entries[0].DependsOn) != 1 || m.Entries[0].DependsOn[0] != parent.ID {
+		t.Fatalf("expected child to depend on parent, got %v", m.Entries[0].DependsOn)
+	}
+
+	// Simulate the external signer
+	for _, e := range m.Entries {
+		raw, err := os.ReadFile(filepath.Join(dir, e.File))
+		if err != nil {
+			t.Fatalf("read exported psbt: %v", err)
+		}
+		ps, err := DecodePSBTB64(string(raw))
+		if err != nil {
+			t.Fatalf("DecodePSBTB64: %v", err)
+		}
+		key.signPSBT(t, ps)
+		b64, _ := ps.B64Encode()
+		if err := os.WriteFile(filepath.Join(dir, e.SignedFile), []byte(b64), 0o644); err != nil {
+			t.Fatalf("write signed psbt: %v", err)
+		}
+	}
+
+	out, err := s.ImportSignedBatch(dir)
+	if err != nil {
+		t.Fatalf("ImportSignedBatch: %v", err)
+	}
+	if len(out) != 2 || out[0].Plan.ID != parent.ID || out[1].Plan.ID != child.ID {
+		t.Fatalf("unexpected broadcast order")
+	}
+	w := out[1].Tx.TxIn[0].Witness
+	if len(w) != 2 || !bytesEqual(w[1], pk) {
+		t.Fatalf("expected P2WPKH witness [sig, pubkey]")
+	}
+	if out[0].Tx.TxID() != parent.ExpectedTxID() {
+		t.Fatalf("finalized txid must match the planned txid")
+	}
+}
+
+func TestImportSignedBatchRejectsTamperedTx(t *testing.T) {
+	pk := make([]byte, 33)
+	pk[0] = 0x03
+	addr, _ := CreateP2WPKH(Hash160(pk), BitcoinTestnet)
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 1, ValueSats: 100_000, Address: addr, Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 30_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	dir := t.TempDir()
+	m, err := s.ExportBatch(dir, []*TransactionPlan{plan})
+	if err != nil {
+		t.Fatalf("ExportBatch: %v", err)
+	}
+	tampered, err := DeserializeMsgTx(plan.RawTx.Serialize(false))
+	if err != nil {
+		t.Fatalf("DeserializeMsgTx: %v", err)
+	}
+	tampered.TxOut[0].Value++
+	b64, _ := NewPSBTFromUnsignedTx(tampered).B64Encode()
+	_ = os.WriteFile(filepath.Join(dir, m.Entries[0].SignedFile), []byte(b64), 0o644)
+	if _, err := s.ImportSignedBatch(dir); err == nil {
+		t.Fatalf("expected mismatch error for altered transaction")
+	}
+}
+
+func TestImportSignedBatchChecksBeforeMarkingSigned(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(0xba7c5)}
+	pk := key.pub()
+	addr, _ := CreateP2WPKH(Hash160(pk), BitcoinTestnet)
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 100_000, Address: addr, Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100_000, Address: addr, Confirmed: true})
+	first, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 30_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	second, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 30_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	dir := t.TempDir()
+	m, err := s.ExportBatch(dir, []*TransactionPlan{first, second})
+	if err != nil {
+		t.Fatalf("ExportBatch: %v", err)
+	}
+	for _, e := range m.Entries {
+		raw, _ := os.ReadFile(filepath.Join(dir, e.File))
+		ps, _ := DecodePSBTB64(string(raw))
+		key.signPSBT(t, ps)
+		b64, _ := ps.B64Encode()
+		_ = os.WriteFile(filepath.Join(dir, e.SignedFile), []byte(b64), 0o644)
+	}
+
+	// A plan listed twice is named as such, not as a dependency cycle
+	dup := *m
+	dup.Entries = append(append([]BatchEntry{}, m.Entries...), m.Entries[0])
+	data, _ := json.Marshal(dup)
+	_ = os.WriteFile(filepath.Join(dir, batchManifestFile), data, 0o644)
+	if _, err := s.ImportSignedBatch(dir); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Fatalf("expected a duplicate plan to be reported, got %v", err)
+	}
+
+	// A plan that cannot be marked signed leaves every plan of the batch as it was
+	data, _ = json.Marshal(m)
+	_ = os.WriteFile(filepath.Join(dir, batchManifestFile), data, 0o644)
+	if err := s.AbandonPlan(second.ID, "test", time.Now()); err != nil {
+		t.Fatalf("AbandonPlan: %v", err)
+	}
+	if _, err := s.ImportSignedBatch(dir); err == nil {
+		t.Fatalf("expected an abandoned plan to be refused")
+	}
+	for _, p := range []*TransactionPlan{first, second} {
+		if p.SignedTx != nil || p.Status == PlanSigned {
+			t.Fatalf("plan %s changed by a failed import: %s", p.ID, p.Status)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains BIP-32 extended public keys and public child derivation.
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Extended public key version bytes (BIP-32 and SLIP-132 native SegWit variants)
+var xpubVersions = map[[4]byte]bool{
+	{0x04, 0x88, 0xb2, 0x1e}: true, // xpub
+	{0x04, 0x35, 0x87, 0xcf}: true, // tpub
+	{0x04, 0xb2, 0x47, 0x46}: true, // zpub (P2WPKH, mainnet)
+	{0x04, 0x5f, 0x1c, 0xf6}: true, // vpub (P2WPKH, testnet)
+	{0x02, 0xaa, 0x7e, 0xd3}: true, // Zpub (P2WSH multisig, mainnet)
+	{0x02, 0x57, 0x54, 0x83}: true, // Vpub (P2WSH multisig, testnet)
+}
+
+// hardenedOffset marks hardened BIP-32 child indices.
+const hardenedOffset = 0x80000000
+
+// ExtendedPubKey is a BIP-32 extended public key.
+type ExtendedPubKey struct {
+	Version     [4]byte
+	Depth       byte
+	ParentFP    [4]byte // Fingerprint of the parent key
+	ChildNumber uint32
+	ChainCode   [32]byte
+	PubKey      [33]byte // Compressed public key
+}
+
+// ParseExtendedPubKey decodes a base58check xpub, tpub, zpub, vpub, Zpub or Vpub.
+func ParseExtendedPubKey(s string) (*ExtendedPubKey, error) {
+	b, err := base58CheckDecode(s)
+	if err != nil {
+		return nil, fmt.Errorf("extended key %q: %w", s, err)
+	}
+	if len(b) != 78 {
+		return nil, fmt.Errorf("extended key %q has %d bytes, want 78", s, len(b))
+	}
+	k := &ExtendedPubKey{Depth: b[4], ChildNumber: binary.BigEndian.Uint32(b[9:13])}
+	copy(k.Version[:], b[:4])
+	copy(k.ParentFP[:], b[5:9])
+	copy(k.ChainCode[:], b[13:45])
+	copy(k.PubKey[:], b[45:])
+	if !xpubVersions[k.Version] {
+		return nil, fmt.Errorf("extended key %q is not a public key (xpub/tpub/zpub/vpub/Zpub/Vpub) - never share private keys", s)
+	}
+	if _, err := decompressPubKey(k.PubKey[:]); err != nil {
+		return nil, fmt.Errorf("extended key %q: %w", s, err)
+	}
+	return k, nil
+}
+
+// String encodes the key in base58check.
+func (k *ExtendedPubKey) String() string {
+	b := make([]byte, 0, 78)
+	b = append(b, k.Version[:]...)
+	b = append(b, k.Depth)
+	b = append(b, k.ParentFP[:]...)
+	b = binary.BigEndian.AppendUint32(b, k.ChildNumber)
+	b = append(b, k.ChainCode[:]...)
+	b = append(b, k.PubKey[:]...)
+	return base58CheckEncode(b)
+}
+
+// Fingerprint returns the first four bytes of HASH160 of the public key.
+func (k *ExtendedPubKey) Fingerprint() [4]byte {
+	var fp [4]byte
+	copy(fp[:], Hash160(k.PubKey[:]))
+	return fp
+}
+
+// Child derives the non-hardened child i (public derivation, BIP-32 CKDpub).
+func (k *ExtendedPubKey) Child(i uint32) (*ExtendedPubKey, error) {
+	if i >= hardenedOffset {
+		return nil, errors.New("hardened children cannot be derived from a public key")
+	}
+	mac := hmac.New(sha512.New, k.ChainCode[:])
+	mac.Write(k.PubKey[:])
+	binary.Write(mac, binary.BigEndian, i)
+	sum := mac.Sum(nil)
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(secpN) >= 0 {
+		return nil, fmt.Errorf("child %d is invalid - skip to the next index", i)
+	}
+	parent, err := decompressPubKey(k.PubKey[:])
+	if err != nil {
+		return nil, err
+	}
+	pt := ecAdd(ecMul(&ecPoint{secpGx, secpGy}, il), parent)
+	if pt == nil {
+		return nil, fmt.Errorf("child %d is invalid - skip to the next index", i)
+	}
+	c := &ExtendedPubKey{Version: k.Version, Depth: k.Depth + 1, ParentFP: k.Fingerprint(), ChildNumber: i}
+	copy(c.ChainCode[:], sum[32:])
+	copy(c.PubKey[:], compressPubKey(pt))
+	return c, nil
+}
+
+// Derive follows a path of non-hardened child indices.
+func (k *ExtendedPubKey) Derive(path ...uint32) (*ExtendedPubKey, error) {
+	cur := k
+	for _, i := range path {
+		next, err := cur.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// Serialize a point as a 33-byte compressed public key
+func compressPubKey(pt *ecPoint) []byte {
+	out := make([]byte, 33)
+	out[0] = 0x02 + byte(pt.y.Bit(0))
+	pt.x.FillBytes(out[1:])
+	return out
+}
+
+// Parse a 33-byte compressed public key into a point
+func decompressPubKey(b []byte) (*ecPoint, error) {
+	if len(b) != 33 || (b[0] != 0x02 && b[0] != 0x03) {
+		return nil, errors.New("public key must be 33 bytes compressed")
+	}
+	pt, err := liftX(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	if b[0] == 0x03 {
+		pt.y = new(big.Int).Sub(secpP, pt.y)
+	}
+	return pt, nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Encode bytes with a 4-byte double-SHA256 checksum in base58
+func base58CheckEncode(payload []byte) string {
+	sum := sha256Double(payload)
+	b := append(append([]byte{}, payload...), sum[:4]...)
+	n := new(big.Int).SetBytes(b)
+	var out []byte
+	mod := new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, big.NewInt(58), mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, '1')
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Decode base58 and verify the trailing checksum
+func base58CheckDecode(s string) ([]byte, error) {
+	n := new(big.Int)
+	for _, c := range []byte(s) {
+		d := bytes.IndexByte([]byte(base58Alphabet), c)
+		if d < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, big.NewInt(58)).Add(n, big.NewInt(int64(d)))
+	}
+	b := n.Bytes()
+	for _, c := range []byte(s) {
+		if c != '1' {
+			break
+		}
+		b = append([]byte{0}, b...)
+	}
+	if len(b) < 4 {
+		return nil, errors.New("base58 string too short")
+	}
+	payload, check := b[:len(b)-4], b[len(b)-4:]
+	sum := sha256Double(payload)
+	if !bytes.Equal(sum[:4], check) {
+		return nil, errors.New("base58 checksum mismatch")
+	}
+	return payload, nil
+}
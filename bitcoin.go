@@ -4,8 +4,10 @@
 package main
 
 import (
-	"crypto/sha256"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 )
 
 // Network represents the blockchain network type.
@@ -16,8 +18,26 @@ const (
 	BitcoinTestnet                 // Bitcoin testnet
 	LitecoinMainnet                // Litecoin mainnet
 	LitecoinTestnet                // Litecoin testnet
+	BitcoinRegtest                 // Bitcoin regression test network (local nodes and fakes)
 )
 
+// networkNames are the config names of the networks.
+var networkNames = map[Network]string{
+	BitcoinMainnet:  "bitcoin_mainnet",
+	BitcoinTestnet:  "bitcoin_testnet",
+	LitecoinMainnet: "litecoin_mainnet",
+	LitecoinTestnet: "litecoin_testnet",
+	BitcoinRegtest:  "bitcoin_regtest",
+}
+
+// String returns the network's config name, e.g. "bitcoin_testnet".
+func (n Network) String() string {
+	if name, ok := networkNames[n]; ok {
+		return name
+	}
+	return fmt.Sprintf("network(%d)", int(n))
+}
+
 // Asset represents the cryptocurrency asset type.
 type Asset int
 
@@ -32,6 +52,8 @@ type AddressType int
 const (
 	P2WPKH AddressType = iota // Pay-to-Witness-Public-Key-Hash (SegWit v0)
 	P2TR                      // Pay-to-Taproot (SegWit v1)
+	P2WSH                     // Pay-to-Witness-Script-Hash (SegWit v0)
+	P2PKH                     // Pay-to-Public-Key-Hash (legacy base58)
 )
 
 // NetworkConfig holds configuration parameters for a specific blockchain network.
@@ -80,6 +102,14 @@ var networkConfigs = map[Network]NetworkConfig{
 		P2PKHPrefix: 0x6f,   // Legacy: m/n...
 		P2SHPrefix:  0xc4,   // Legacy: Q...
 	},
+	BitcoinRegtest: {
+		Network:     BitcoinRegtest,
+		Asset:       BTC,
+		Bech32HRP:   "bcrt", // Bitcoin Core regtest: bcrt1...
+		Bech32mHRP:  "bcrt", // Bitcoin Core regtest: bcrt1p... (Taproot)
+		P2PKHPrefix: 0x6f,   // Legacy: m/n... (as testnet)
+		P2SHPrefix:  0xc4,   // Legacy: 2... (as testnet)
+	},
 }
 
 // Bech32 encoding constants
@@ -153,26 +183,103 @@ func bech32CreateChecksum(hrp string, data []int, constant int) []int {
 }
 
 // Bech32Encode creates a Bech32-encoded string from a human-readable part and 5-bit data.
-// It automatically selects the correct checksum constant (1 for SegWit v0, 0x2bc830a3 for Taproot).
+// It selects the checksum constant from data[0] as a witness version (1 for SegWit v0,
+// 0x2bc830a3 otherwise) and does not validate the input; use EncodeSegWitAddress for
+// addresses.
 func Bech32Encode(hrp string, data []int) string {
 	// Select bech32 (1) for v0, bech32m (0x2bc830a3) for v>=1
 	constant := 1
 	if len(data) > 0 && data[0] != 0 {
 		constant = 0x2bc830a3
 	}
-	combined := append(data, bech32CreateChecksum(hrp, data, constant)...)
-	result := hrp + "1"
+	return bech32Encode(hrp, data, constant)
+}
+
+// Append the checksum and map to the charset without touching the caller's slice
+func bech32Encode(hrp string, data []int, constant int) string {
+	combined := append(append(make([]int, 0, len(data)+6), data...), bech32CreateChecksum(hrp, data, constant)...)
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
 	for _, v := range combined {
-		result += string(charset[v])
+		b.WriteByte(charset[v])
 	}
-	return result
+	return b.String()
+}
+
+// EncodeSegWitAddress encodes a witness program as a SegWit address: Bech32
+// for version 0 and Bech32m for versions 1-16 (BIP-173/350). The HRP must be
+// 1-83 lowercase printable characters and the program must follow BIP-141
+// (2-40 bytes, exactly 20 or 32 for version 0); anything else is rejected
+// rather than producing a string no wallet could decode.
+func EncodeSegWitAddress(hrp string, version int, program []byte) (string, error) {
+	if len(hrp) == 0 || len(hrp) > 83 {
+		return "", fmt.Errorf("HRP must be 1-83 characters (got %d)", len(hrp))
+	}
+	for i := 0; i < len(hrp); i++ {
+		if c := hrp[i]; c < 33 || c > 126 || (c >= 'A' && c <= 'Z') {
+			return "", fmt.Errorf("invalid HRP character %q - use lowercase printable ASCII", c)
+		}
+	}
+	if err := checkWitnessProgram(version, len(program)); err != nil {
+		return "", err
+	}
+	prog5, err := convert8to5(program)
+	if err != nil {
+		return "", err
+	}
+	data := append([]int{version}, prog5...)
+	if n := len(hrp) + 1 + len(data) + 6; n > 90 {
+		return "", fmt.Errorf("address would be %d characters, over the 90 character limit - shorten the HRP", n)
+	}
+	constant := 1
+	if version > 0 {
+		constant = 0x2bc830a3
+	}
+	return bech32Encode(hrp, data, constant), nil
+}
+
+// BIP-141 witness version and program length rules
+func checkWitnessProgram(version, length int) error {
+	if version < 0 || version > 16 {
+		return fmt.Errorf("witness version %d out of range 0-16", version)
+	}
+	if length < 2 || length > 40 {
+		return fmt.Errorf("witness program must be 2-40 bytes (got %d)", length)
+	}
+	if version == 0 && length != 20 && length != 32 {
+		return fmt.Errorf("witness v0 program must be 20 or 32 bytes (got %d)", length)
+	}
+	return nil
 }
 
 // Bech32Decode parses a Bech32/Bech32m string and returns HRP and the 5-bit data
 // (including witness version in data[0]). It validates HRP charset, forbids mixed
 // case, and verifies the checksum constant using the version (BIP-173/350).
 func Bech32Decode(bech string) (string, []int, error) {
-	if len(bech) < 8 || len(bech) > 90 {
+	hrp, dataInt, err := bech32Parse(bech, 90)
+	if err != nil {
+		return "", nil, err
+	}
+	ver := dataInt[0]
+	var constant int
+	switch ver {
+	case 0:
+		constant = 1
+	default:
+		constant = 0x2bc830a3
+	}
+	if !bech32VerifyChecksum(hrp, dataInt, constant) {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	return hrp, dataInt[:len(dataInt)-6], nil
+}
+
+// Split a bech32 string of at most maxLen characters into its HRP and 5-bit
+// data including the unverified checksum
+func bech32Parse(bech string, maxLen int) (string, []int, error) {
+	if len(bech) < 8 || len(bech) > maxLen {
 		return "", nil, errors.New("invalid bech32 string length")
 	}
 
@@ -232,26 +339,10 @@ func Bech32Decode(bech string) (string, []int, error) {
 		dataInt[i] = charsetMap[byte(c)]
 	}
 
-	// Verify checksum constant based on witness version per BIP-350
 	if len(dataInt) < 7 { // at least version + checksum(6)
 		return "", nil, errors.New("invalid data length")
 	}
-	ver := dataInt[0]
-	if ver < 0 || ver > 31 { // 5-bit value range
-		return "", nil, errors.New("invalid witness version value")
-	}
-	var constant int
-	switch ver {
-	case 0:
-		constant = 1
-	default:
-		constant = 0x2bc830a3
-	}
-	if !bech32VerifyChecksum(hrp, dataInt, constant) {
-		return "", nil, errors.New("invalid checksum")
-	}
-
-	return hrp, dataInt[:len(dataInt)-6], nil
+	return hrp, dataInt, nil
 }
 
 // Convert string to lowercase
@@ -267,21 +358,6 @@ func toLower(s string) string {
 	return string(result)
 }
 
-// Hash160 (RIPEMD160(SHA256(data)))
-func Hash160(data []byte) []byte {
-	sha := sha256.Sum256(data)
-	return ripemd160(sha[:])
-}
-
-// RIPEMD160 implementation (simplified)
-func ripemd160(data []byte) []byte { h := NewRIPEMD160(); h.Write(data); return h.Sum(nil) }
-
-// SHA256
-func SHA256(data []byte) []byte {
-	hash := sha256.Sum256(data)
-	return hash[:]
-}
-
 // Convert 5-bit groups to 8-bit groups
 func convertBits(data []int, fromBits, toBits int, pad bool) ([]byte, error) {
 	acc := 0
@@ -354,16 +430,7 @@ func CreateP2WPKH(pubKeyHash []byte, network Network) (string, error) {
 		return "", errors.New("unsupported network")
 	}
 
-	// Convert witness program to 5-bit groups
-	prog5, err := convert8to5(pubKeyHash)
-	if err != nil {
-		return "", err
-	}
-	data5bit := make([]int, 0, 1+len(prog5))
-	data5bit = append(data5bit, 0) // witness version 0
-	data5bit = append(data5bit, prog5...)
-
-	return Bech32Encode(config.Bech32HRP, data5bit), nil
+	return EncodeSegWitAddress(config.Bech32HRP, 0, pubKeyHash)
 }
 
 // CreateP2TR creates a Pay-to-Taproot (SegWit v1) address.
@@ -378,24 +445,104 @@ func CreateP2TR(taprootOutputKey []byte, network Network) (string, error) {
 		return "", errors.New("unsupported network")
 	}
 
-	// Convert witness program to 5-bit groups
-	prog5, err := convert8to5(taprootOutputKey)
+	return EncodeSegWitAddress(config.Bech32mHRP, 1, taprootOutputKey)
+}
+
+// CreateP2PKH creates a legacy Pay-to-Public-Key-Hash address from a 20-byte
+// public key hash.
+func CreateP2PKH(pubKeyHash []byte, network Network) (string, error) {
+	if len(pubKeyHash) != 20 {
+		return "", errors.New("invalid pubkey hash length")
+	}
+	config, ok := networkConfigs[network]
+	if !ok {
+		return "", errors.New("unsupported network")
+	}
+	return base58CheckEncode(append([]byte{config.P2PKHPrefix}, pubKeyHash...)), nil
+}
+
+// XOnlyPubKey converts a 33-byte compressed public key to its 32-byte x-only
+// form (BIP-340) and reports whether the dropped y coordinate was odd. Signers
+// negate the private key of odd-y keys before producing Schnorr signatures.
+func XOnlyPubKey(compressed []byte) ([]byte, bool, error) {
+	if _, err := decompressPubKey(compressed); err != nil {
+		return nil, false, err
+	}
+	return append([]byte(nil), compressed[1:]...), compressed[0] == 0x03, nil
+}
+
+// TaprootOutputKey tweaks an x-only internal key for a key-path-only output
+// (BIP-86: Q = P + H_TapTweak(P)G) and returns the x-only output key and
+// whether its y coordinate is odd (the control block parity bit).
+func TaprootOutputKey(internalKey []byte) ([]byte, bool, error) {
+	if len(internalKey) != 32 {
+		return nil, false, errors.New("taproot internal key must be a 32-byte x-only public key")
+	}
+	p, err := liftX(internalKey)
+	if err != nil {
+		return nil, false, err
+	}
+	tw := TapTweakHash(internalKey, nil)
+	t := new(big.Int).SetBytes(tw[:])
+	if t.Cmp(secpN) >= 0 {
+		return nil, false, errors.New("taproot tweak out of range")
+	}
+	q := ecAdd(p, ecMul(&ecPoint{secpGx, secpGy}, t))
+	if q == nil {
+		return nil, false, errors.New("tweaked taproot key is the point at infinity")
+	}
+	return q.x.FillBytes(make([]byte, 32)), q.y.Bit(0) == 1, nil
+}
+
+// CreateP2TRFromInternalKey creates the BIP-86 Pay-to-Taproot address of a
+// 33-byte compressed (or 32-byte x-only) internal key, applying the taproot
+// tweak so the output key need not be computed externally.
+func CreateP2TRFromInternalKey(internalKey []byte, network Network) (string, error) {
+	xOnly, err := internalXOnly(internalKey)
+	if err != nil {
+		return "", err
+	}
+	out, _, err := TaprootOutputKey(xOnly)
 	if err != nil {
 		return "", err
 	}
-	data5bit := make([]int, 0, 1+len(prog5)) // 1 for version
-	data5bit = append(data5bit, 1)           // witness version 1
-	data5bit = append(data5bit, prog5...)
+	return CreateP2TR(out, network)
+}
 
-	return Bech32Encode(config.Bech32mHRP, data5bit), nil
+// Accept an internal key as 33-byte compressed or 32-byte x-only
+func internalXOnly(key []byte) ([]byte, error) {
+	switch len(key) {
+	case 32:
+		return key, nil
+	case 33:
+		x, _, err := XOnlyPubKey(key)
+		return x, err
+	default:
+		return nil, fmt.Errorf("taproot internal key must be 33 bytes compressed or 32 bytes x-only (got %d)", len(key))
+	}
 }
 
-// DecodeAddress parses a Bech32/Bech32m address and returns address components.
-// Network is determined by HRP; type is determined by witness version (v0=P2WPKH,
-// v1=P2TR). Only these types are supported by this library.
+// CreateP2WSH creates a Pay-to-Witness-Script-Hash (SegWit v0) address for a
+// witness script.
+func CreateP2WSH(witnessScript []byte, network Network) (string, error) {
+	config, ok := networkConfigs[network]
+	if !ok {
+		return "", errors.New("unsupported network")
+	}
+	return EncodeSegWitAddress(config.Bech32HRP, 0, SHA256(witnessScript))
+}
+
+// DecodeAddress parses a Bech32/Bech32m or legacy base58 P2PKH address and
+// returns address components. For SegWit, network is determined by HRP and type
+// by witness version and program length (v0 20 bytes=P2WPKH, v0 32 bytes=P2WSH,
+// v1=P2TR); legacy addresses are matched by version byte. Only these types are
+// supported by this library.
 func DecodeAddress(addr string) (*Address, error) {
 	hrp, data, err := Bech32Decode(addr)
 	if err != nil {
+		if legacy, lerr := decodeP2PKH(addr); lerr == nil {
+			return legacy, nil
+		}
 		return nil, err
 	}
 
@@ -421,12 +568,19 @@ func DecodeAddress(addr string) (*Address, error) {
 
 	// Determine address type by witness version (data[0])
 	version := data[0]
+	if err := checkWitnessProgram(version, len(decoded)); err != nil {
+		return nil, err
+	}
 	var addrType AddressType
 	switch version {
 	case 0:
-		addrType = P2WPKH
-		if len(decoded) != 20 {
-			return nil, errors.New("invalid P2WPKH data length")
+		switch len(decoded) {
+		case 20:
+			addrType = P2WPKH
+		case 32:
+			addrType = P2WSH
+		default:
+			return nil, errors.New("invalid witness v0 program length")
 		}
 	case 1:
 		addrType = P2TR
@@ -444,6 +598,34 @@ func DecodeAddress(addr string) (*Address, error) {
 	}, nil
 }
 
+// Decode a base58 P2PKH address. Networks sharing a version byte (the test
+// networks) decode as the first in declaration order; use OnNetwork to
+// compare.
+func decodeP2PKH(addr string) (*Address, error) {
+	b, err := base58CheckDecode(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 21 {
+		return nil, errors.New("invalid P2PKH payload length")
+	}
+	for _, net := range []Network{BitcoinMainnet, BitcoinTestnet, LitecoinMainnet, LitecoinTestnet, BitcoinRegtest} {
+		if networkConfigs[net].P2PKHPrefix == b[0] {
+			return &Address{Type: P2PKH, Network: net, Data: b[1:]}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown P2PKH version byte 0x%02x", b[0])
+}
+
+// OnNetwork reports whether the address is valid on network. Legacy addresses
+// match every network sharing their version byte.
+func (a *Address) OnNetwork(network Network) bool {
+	if a.Type == P2PKH {
+		return networkConfigs[a.Network].P2PKHPrefix == networkConfigs[network].P2PKHPrefix
+	}
+	return a.Network == network
+}
+
 // ValidateAddress verifies that an address is valid and matches the provided public key.
 // It checks the address format, network compatibility, and cryptographic validation.
 func ValidateAddress(addr string, pubKey []byte, network Network) error {
@@ -452,12 +634,12 @@ func ValidateAddress(addr string, pubKey []byte, network Network) error {
 		return err
 	}
 
-	if decoded.Network != network {
-		return errors.New("address network mismatch")
+	if !decoded.OnNetwork(network) {
+		return fmt.Errorf("%w: %s is a %s address, not %s", ErrNetworkMismatch, addr, decoded.Network, network)
 	}
 
-	// For P2WPKH, check if address matches pubkey hash
-	if decoded.Type == P2WPKH {
+	// For P2WPKH and P2PKH, check if address matches pubkey hash
+	if decoded.Type == P2WPKH || decoded.Type == P2PKH {
 		expectedHash := Hash160(pubKey)
 		if !bytesEqual(decoded.Data, expectedHash) {
 			return errors.New("address does not match public key")
@@ -516,6 +698,32 @@ func BuildP2WPKHScript(pubKeyHash []byte) []byte {
 	return script
 }
 
+// BuildP2PKHScript returns OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG.
+func BuildP2PKHScript(pubKeyHash []byte) []byte {
+	if len(pubKeyHash) != 20 {
+		panic("invalid pubkey hash length")
+	}
+	script := make([]byte, 25)
+	script[0] = 0x76 // OP_DUP
+	script[1] = 0xa9 // OP_HASH160
+	script[2] = 0x14 // 20 bytes
+	copy(script[3:], pubKeyHash)
+	script[23] = 0x88 // OP_EQUALVERIFY
+	script[24] = 0xac // OP_CHECKSIG
+	return script
+}
+
+func BuildP2WSHScript(scriptHash []byte) []byte {
+	if len(scriptHash) != 32 {
+		panic("invalid script hash length")
+	}
+	script := make([]byte, 34)
+	script[0] = 0x00 // OP_0
+	script[1] = 0x20 // 32 bytes
+	copy(script[2:], scriptHash)
+	return script
+}
+
 func BuildP2TRScript(taprootOutputKey []byte) []byte {
 	if len(taprootOutputKey) != 32 {
 		panic("invalid taproot output key length")
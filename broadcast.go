@@ -0,0 +1,85 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains broadcasting signed plans.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Broadcaster submits a fully signed raw transaction to the network and
+// returns its txid.
+type Broadcaster interface {
+	Broadcast(rawTx []byte) (string, error)
+}
+
+// BroadcastPlan submits the signed transaction of plan id through b and marks
+// the plan broadcast. Transactions whose locktime has not been reached are
+// refused with the earliest block or time they become valid, instead of being
+// rejected by the node as non-final. The preflight validators then run, each
+// verdict is recorded on the plan, and any failure refuses the broadcast with
+// a *PreflightError. A backend answering that it already has the transaction
+// counts as success, so a broadcast whose response was lost can simply be
+// retried. Other backend failures put the plan on the broadcast retry queue
+// (see ProcessBroadcastQueue).
+func (s *Sweeper) BroadcastPlan(id string, b Broadcaster) (string, error) {
+	return s.broadcastPlan(id, b, time.Now())
+}
+
+// BroadcastPlan at now; failures of the broadcast itself go to the retry queue
+func (s *Sweeper) broadcastPlan(id string, b Broadcaster, now time.Time) (string, error) {
+	p, ok := s.plans[id]
+	if !ok {
+		return "", fmt.Errorf("unknown plan %q", id)
+	}
+	if b == nil {
+		return "", errors.New("no broadcaster given")
+	}
+	if p.SignedTx == nil {
+		return "", fmt.Errorf("plan %s is not signed - import the signed PSBT first", id)
+	}
+	if v := p.Validity(); v != nil {
+		if s.chain == nil {
+			return "", fmt.Errorf("plan %s has a locktime but no chain info source is set to check it - call SetChainInfo", id)
+		}
+		h, mtp, err := s.chain.ChainTip()
+		if err != nil {
+			return "", fmt.Errorf("chain tip lookup failed: %w", err)
+		}
+		if !v.ReadyAt(h, mtp) {
+			return "", fmt.Errorf("plan %s is not valid until %s (tip is block %d) - broadcast it later", id, v, h)
+		}
+	}
+	if err := s.runPreflight(p, now); err != nil {
+		return "", err
+	}
+	txid, err := b.Broadcast(p.SignedTx.Serialize(true))
+	if err != nil {
+		if !alreadyBroadcast(err) {
+			return "", fmt.Errorf("broadcast of plan %s failed, %s: %w", id, s.queueFailedBroadcast(id, err, now), err)
+		}
+		s.logger.Printf("plan %s already known to the backend: %v", id, err)
+		txid = p.SignedTx.TxID()
+	}
+	if err := s.DropBroadcast(id); err != nil {
+		s.logger.Printf("failed to clear plan %s from the broadcast queue: %v", id, err)
+	}
+	if err := s.MarkBroadcast(id, now); err != nil {
+		return txid, err
+	}
+	return txid, nil
+}
+
+// Whether a broadcast error is the node reporting it already has the
+// transaction (Bitcoin Core reject reasons, as relayed by Esplora and RPC)
+func alreadyBroadcast(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, r := range []string{"txn-already-known", "txn-already-in-mempool", "already in block chain", "outputs already in utxo set"} {
+		if strings.Contains(msg, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the persistent retry queue for failed broadcasts.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// broadcastQueueKey is where the retry queue is stored.
+const broadcastQueueKey = "broadcast:queue"
+
+// Retry defaults: attempts before dead-lettering and the backoff bounds
+const (
+	defaultBroadcastMaxAttempts = 8
+	defaultBroadcastBaseDelay   = 30 * time.Second
+	defaultBroadcastMaxDelay    = time.Hour
+)
+
+// BroadcastFailure classifies why a broadcast failed.
+type BroadcastFailure string
+
+const (
+	BroadcastRetryable BroadcastFailure = "retryable" // Backend down, timeouts, fees below the mempool minimum, ...
+	BroadcastPermanent BroadcastFailure = "permanent" // The node rejected the transaction itself
+)
+
+// QueueState is where a failed broadcast stands in the retry queue.
+type QueueState string
+
+const (
+	QueueWaiting QueueState = "queued" // Retried by ProcessBroadcastQueue once NextAttempt passes
+	QueueDead    QueueState = "dead"   // Permanent failure or out of attempts; needs manual intervention
+)
+
+// QueuedBroadcast is a plan whose broadcast failed, with its retry state.
+type QueuedBroadcast struct {
+	PlanID      string           `json:"plan_id"`
+	State       QueueState       `json:"state"`
+	Attempts    int              `json:"attempts"`
+	LastError   string           `json:"last_error"`
+	Failure     BroadcastFailure `json:"failure"`
+	NextAttempt time.Time        `json:"next_attempt,omitempty"` // Zero once dead
+	EnqueuedAt  time.Time        `json:"enqueued_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// BroadcastRetryPolicy bounds retries of failed broadcasts. Attempt n waits
+// BaseDelay * 2^(n-1), capped at MaxDelay, before the next one.
+type BroadcastRetryPolicy struct {
+	MaxAttempts int           // Attempts before dead-lettering (0 = 8)
+	BaseDelay   time.Duration // Wait after the first failure (0 = 30s)
+	MaxDelay    time.Duration // Longest wait between attempts (0 = 1h)
+}
+
+// SetBroadcastRetryPolicy replaces the default retry policy for failed broadcasts.
+func (s *Sweeper) SetBroadcastRetryPolicy(p BroadcastRetryPolicy) error {
+	if p.MaxAttempts < 0 || p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("broadcast retry policy must be non-negative (got %d attempts, %s base, %s max)", p.MaxAttempts, p.BaseDelay, p.MaxDelay)
+	}
+	s.broadcastRetry = p
+	return nil
+}
+
+// Policy with defaults filled in
+func (s *Sweeper) broadcastRetryPolicy() BroadcastRetryPolicy {
+	p := s.broadcastRetry
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultBroadcastMaxAttempts
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = defaultBroadcastBaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = defaultBroadcastMaxDelay
+	}
+	return p
+}
+
+// ClassifyBroadcastError tells node rejections of the transaction itself,
+// which no retry fixes, from failures worth retrying. Bitcoin Core reject
+// reasons (as relayed by RPC and Esplora) for invalid scripts, spent or
+// conflicting inputs and non-standard transactions are permanent; anything
+// else, such as network errors, a fee below the current mempool minimum or a
+// not-yet-final sequence lock, is retryable.
+func ClassifyBroadcastError(err error) BroadcastFailure {
+	msg := strings.ToLower(err.Error())
+	for _, r := range []string{
+		"mandatory-script-verify-flag", "non-mandatory-script-verify-flag", "bad-txns", "missingorspent",
+		"txn-mempool-conflict", "insufficient fee", "dust", "tx-size", "scriptsig-size",
+		"scriptpubkey", "bad-witness", "multi-op-return",
+	} {
+		if strings.Contains(msg, r) {
+			return BroadcastPermanent
+		}
+	}
+	return BroadcastRetryable
+}
+
+// BroadcastQueue returns failed broadcasts, queued and dead-lettered, oldest first.
+func (s *Sweeper) BroadcastQueue() []QueuedBroadcast {
+	q := s.loadBroadcastQueue(nil)
+	out := make([]QueuedBroadcast, 0, len(q))
+	for _, e := range q {
+		out = append(out, e)
+	}
+	sortBroadcastQueue(out)
+	return out
+}
+
+// ProcessBroadcastQueue retries, through b, every queued broadcast whose next
+// attempt is due at now, and returns how many were sent. Sent plans leave the
+// queue; failures are rescheduled or dead-lettered. Plans that were forgotten
+// or broadcast some other way are dropped from the queue.
+func (s *Sweeper) ProcessBroadcastQueue(b Broadcaster, now time.Time) (int, error) {
+	sent := 0
+	for _, e := range s.BroadcastQueue() {
+		if e.State != QueueWaiting || now.Before(e.NextAttempt) {
+			continue
+		}
+		if p, ok := s.plans[e.PlanID]; !ok || p.BroadcastAt != nil {
+			if err := s.DropBroadcast(e.PlanID); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if _, err := s.broadcastPlan(e.PlanID, b, now); err != nil {
+			s.logger.Printf("broadcast retry of plan %s: %v", e.PlanID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// RequeueBroadcast returns a dead-lettered broadcast to the queue with its
+// attempts reset, to be retried on the next ProcessBroadcastQueue, e.g. after
+// the plan was re-signed or the backend fixed.
+func (s *Sweeper) RequeueBroadcast(id string) error {
+	now := time.Now().UTC()
+	found := false
+	err := s.updateBroadcastQueue(func(q map[string]QueuedBroadcast) bool {
+		e, ok := q[id]
+		if !ok {
+			return false
+		}
+		found = true
+		e.State, e.Attempts, e.NextAttempt, e.UpdatedAt = QueueWaiting, 0, now, now
+		q[id] = e
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("plan %s is not in the broadcast queue - see BroadcastQueue", id)
+	}
+	s.logger.Printf("requeued broadcast of plan %s", id)
+	return nil
+}
+
+// DropBroadcast removes a plan from the broadcast queue, queued or dead.
+func (s *Sweeper) DropBroadcast(id string) error {
+	return s.updateBroadcastQueue(func(q map[string]QueuedBroadcast) bool {
+		if _, ok := q[id]; !ok {
+			return false
+		}
+		delete(q, id)
+		return true
+	})
+}
+
+// Record a failed broadcast of plan id, scheduling a retry or dead-lettering
+// it, and describe the outcome for the caller's error
+func (s *Sweeper) queueFailedBroadcast(id string, cause error, now time.Time) string {
+	pol := s.broadcastRetryPolicy()
+	class := ClassifyBroadcastError(cause)
+	var e QueuedBroadcast
+	err := s.updateBroadcastQueue(func(q map[string]QueuedBroadcast) bool {
+		e = q[id]
+		if e.PlanID == "" {
+			e = QueuedBroadcast{PlanID: id, EnqueuedAt: now.UTC()}
+		}
+		e.Attempts++
+		e.LastError, e.Failure, e.UpdatedAt = cause.Error(), class, now.UTC()
+		if class == BroadcastPermanent || e.Attempts >= pol.MaxAttempts {
+			e.State, e.NextAttempt = QueueDead, time.Time{}
+		} else {
+			e.State, e.NextAttempt = QueueWaiting, now.UTC().Add(backoffDelay(pol, e.Attempts))
+		}
+		q[id] = e
+		return true
+	})
+	if err != nil {
+		s.logger.Printf("failed to queue broadcast of plan %s for retry: %v", id, err)
+		return "not queued for retry"
+	}
+	if e.State == QueueDead {
+		s.logger.Printf("broadcast of plan %s dead-lettered after %d attempt(s): %s", id, e.Attempts, e.LastError)
+		return fmt.Sprintf("dead-lettered after %d attempt(s) (%s) - see BroadcastQueue and RequeueBroadcast", e.Attempts, class)
+	}
+	return fmt.Sprintf("queued for retry %d of %d at %s", e.Attempts+1, pol.MaxAttempts, e.NextAttempt.Format(time.RFC3339))
+}
+
+// Wait before the attempt after the given number of failures
+func backoffDelay(pol BroadcastRetryPolicy, attempts int) time.Duration {
+	d := pol.BaseDelay
+	for i := 1; i < attempts && d < pol.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > pol.MaxDelay {
+		d = pol.MaxDelay
+	}
+	return d
+}
+
+// Queue stored as b (nil when absent), keyed by plan ID
+func (s *Sweeper) loadBroadcastQueue(b []byte) map[string]QueuedBroadcast {
+	if b == nil {
+		b, _ = s.kv.Get([]byte(broadcastQueueKey))
+	}
+	q := map[string]QueuedBroadcast{}
+	var list []QueuedBroadcast
+	_ = json.Unmarshal(b, &list)
+	for _, e := range list {
+		q[e.PlanID] = e
+	}
+	return q
+}
+
+// Change the stored queue atomically with fn, which reports whether it
+// changed anything
+func (s *Sweeper) updateBroadcastQueue(fn func(q map[string]QueuedBroadcast) bool) error {
+	return s.updateKV(broadcastQueueKey, func(cur []byte) ([]byte, error) {
+		q := map[string]QueuedBroadcast{}
+		if cur != nil {
+			q = s.loadBroadcastQueue(cur)
+		}
+		if !fn(q) {
+			return nil, nil
+		}
+		list := make([]QueuedBroadcast, 0, len(q))
+		for _, e := range q {
+			list = append(list, e)
+		}
+		sortBroadcastQueue(list)
+		return json.Marshal(list)
+	})
+}
+
+// Oldest first, then by plan ID
+func sortBroadcastQueue(q []QueuedBroadcast) {
+	sort.Slice(q, func(i, j int) bool {
+		if !q[i].EnqueuedAt.Equal(q[j].EnqueuedAt) {
+			return q[i].EnqueuedAt.Before(q[j].EnqueuedAt)
+		}
+		return q[i].PlanID < q[j].PlanID
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingBroadcaster struct {
+	err   error
+	calls int
+}
+
+func (f *failingBroadcaster) Broadcast(raw []byte) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return "ok", nil
+}
+
+func TestClassifyBroadcastError(t *testing.T) {
+	for msg, want := range map[string]BroadcastFailure{
+		"dial tcp: connection refused":                                 BroadcastRetryable,
+		"mempool min fee not met, 110 < 180":                           BroadcastRetryable,
+		"non-BIP68-final":                                              BroadcastRetryable,
+		"bad-txns-inputs-missingorspent":                               BroadcastPermanent,
+		"mandatory-script-verify-flag-failed (Signature must be zero)": BroadcastPermanent,
+		"txn-mempool-conflict":                                         BroadcastPermanent,
+	} {
+		if got := ClassifyBroadcastError(errors.New(msg)); got != want {
+			t.Errorf("%q classified %s, want %s", msg, got, want)
+		}
+	}
+}
+
+func TestBroadcastQueueRetriesAndDeadLetters(t *testing.T) {
+	s := newTestSweeper(t)
+	if err := s.SetBroadcastRetryPolicy(BroadcastRetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 90 * time.Second}); err != nil {
+		t.Fatalf("SetBroadcastRetryPolicy: %v", err)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx
+
+	b := &failingBroadcaster{err: errors.New("connection reset by peer")}
+	if _, err := s.BroadcastPlan(plan.ID, b); err == nil || !strings.Contains(err.Error(), "queued for retry 2 of 3") {
+		t.Fatalf("expected the failure to be queued, got %v", err)
+	}
+	q := s.BroadcastQueue()
+	if len(q) != 1 || q[0].State != QueueWaiting || q[0].Failure != BroadcastRetryable {
+		t.Fatalf("queue %+v", q)
+	}
+
+	// Not due yet, then due: the second failure backs off for 90s (capped)
+	now := q[0].NextAttempt
+	if n, _ := s.ProcessBroadcastQueue(b, now.Add(-time.Second)); n != 0 || b.calls != 1 {
+		t.Fatalf("retried before the backoff elapsed")
+	}
+	if n, _ := s.ProcessBroadcastQueue(b, now); n != 0 || b.calls != 2 {
+		t.Fatalf("due entry not retried")
+	}
+	if q = s.BroadcastQueue(); q[0].Attempts != 2 || !q[0].NextAttempt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("backoff not applied: %+v", q[0])
+	}
+	_, _ = s.ProcessBroadcastQueue(b, now.Add(time.Hour))
+	if q = s.BroadcastQueue(); q[0].State != QueueDead || q[0].Attempts != 3 {
+		t.Fatalf("expected dead-letter after 3 attempts, got %+v", q[0])
+	}
+	if n, _ := s.ProcessBroadcastQueue(b, now.Add(2*time.Hour)); n != 0 || b.calls != 3 {
+		t.Fatalf("dead-lettered entry retried")
+	}
+
+	// Requeued after the backend recovers, it is sent and leaves the queue
+	if err := s.RequeueBroadcast(plan.ID); err != nil {
+		t.Fatalf("RequeueBroadcast: %v", err)
+	}
+	b.err = nil
+	if n, err := s.ProcessBroadcastQueue(b, time.Now().Add(time.Second)); n != 1 || err != nil {
+		t.Fatalf("requeued broadcast not sent: %d, %v", n, err)
+	}
+	if len(s.BroadcastQueue()) != 0 || plan.BroadcastAt == nil {
+		t.Fatalf("sent plan still queued or not marked broadcast")
+	}
+	if err := s.RequeueBroadcast(plan.ID); err == nil {
+		t.Fatalf("expected requeue of an unknown entry to fail")
+	}
+}
+
+func TestBroadcastQueuePermanentFailure(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx
+	b := &failingBroadcaster{err: errors.New("bad-txns-inputs-missingorspent")}
+	if _, err := s.BroadcastPlan(plan.ID, b); err == nil || !strings.Contains(err.Error(), "dead-lettered after 1 attempt") {
+		t.Fatalf("expected a permanent failure to be dead-lettered, got %v", err)
+	}
+	if err := s.DropBroadcast(plan.ID); err != nil || len(s.BroadcastQueue()) != 0 {
+		t.Fatalf("DropBroadcast: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains replace-by-fee (BIP-125) fee bumps of broadcast plans.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// incrementalRelayFeeRate is Bitcoin Core's default -incrementalrelayfee: a
+// replacement must add at least this much per vbyte of its own size on top of
+// the fee it replaces.
+const incrementalRelayFeeRate FeeRate = 1000
+
+// BumpFee builds a replacement for a broadcast plan that pays newRate sat/vB;
+// BumpFeeKVB takes fractional rates.
+// It spends the same inputs and pays the same recipients, taking the extra
+// fee out of change; change that would drop below dust is given up to the fee.
+// The BIP-125 rules are enforced: the plan must signal replaceability, and the
+// replacement must pay a higher fee rate and at least the original fee plus the
+// incremental relay fee for its own size. The replacement is tracked as a new
+// plan with Replaces set; broadcasting it marks the original replaced.
+func (s *Sweeper) BumpFee(plan *TransactionPlan, newRate int64) (*TransactionPlan, error) {
+	if newRate <= 0 {
+		return nil, fmt.Errorf("fee rate must be positive (got %d sat/vB)", newRate)
+	}
+	return s.BumpFeeKVB(plan, SatPerVByte(newRate))
+}
+
+// BumpFeeKVB is BumpFee with the new rate in sat/kvB, e.g. 2500 for 2.5 sat/vB.
+func (s *Sweeper) BumpFeeKVB(plan *TransactionPlan, newRate FeeRate) (*TransactionPlan, error) {
+	defer s.templateScope()()
+	if plan == nil {
+		return nil, errors.New("no plan to bump")
+	}
+	old, ok := s.plans[plan.ID]
+	if !ok {
+		return nil, fmt.Errorf("unknown plan %q", plan.ID)
+	}
+	if old.Status != PlanBroadcast {
+		return nil, fmt.Errorf("plan %s is %s - only broadcast, unconfirmed plans can be fee-bumped", old.ID, old.Status)
+	}
+	if !signalsRBF(old.RawTx) {
+		return nil, fmt.Errorf("plan %s does not signal replaceability (BIP-125) - plan with SpendOptions{RBF: true} to allow fee bumps", old.ID)
+	}
+	if newRate <= 0 {
+		return nil, fmt.Errorf("fee rate must be positive (got %s)", newRate)
+	}
+
+	p := paramsFromSettings(old.Settings)
+	p.feeRate = newRate
+	p.replacement = true
+	vbytes := estimateTxVBytesDetailed(s, old.Inputs, old.Outputs)
+	fee := newRate.Fee(vbytes)
+	if min := old.FeeSats + incrementalRelayFeeRate.Fee(vbytes); fee < min {
+		return nil, fmt.Errorf("a replacement of plan %s must pay at least %d sats (%s), the original fee plus the incremental relay fee - raise the fee rate", old.ID, min, FeeRate((min*1000+vbytes-1)/vbytes))
+	}
+
+	// Take the extra fee from change, last output first. Change that would
+	// fall below dust is dropped, which also shrinks the transaction.
+	var totalIn int64
+	for _, u := range old.Inputs {
+		totalIn += u.ValueSats
+	}
+	final := append([]TxOutput(nil), old.Outputs...)
+	changeIdxs := old.ChangeIndices()
+	dropped := false
+	for k := len(changeIdxs) - 1; k >= 0; k-- {
+		need := bumpFeeFor(s, old, final, newRate) - (totalIn - sumOutputs(final))
+		if need <= 0 {
+			break
+		}
+		i := changeIdxs[k]
+		if final[i].ValueSats-need > s.dustFor(final[i].Address, p) {
+			final[i].ValueSats -= need
+			break
+		}
+		final = append(final[:i], final[i+1:]...)
+		changeIdxs = changeIdxs[:k]
+		dropped = true
+	}
+	fee = totalIn - sumOutputs(final)
+	if short := bumpFeeFor(s, old, final, newRate) - fee; short > 0 {
+		return nil, fmt.Errorf("plan %s has %d sats too little change to pay %s - bump it with a child spend (CPFP) instead", old.ID, short, newRate)
+	}
+	vbytes = estimateTxVBytesDetailed(s, old.Inputs, final)
+	if extra := fee - newRate.Fee(vbytes); dropped && extra > 0 {
+		p.dustChange = extra
+		s.logger.Printf("bump of plan %s drops change below dust: adding %d sats to the fee", old.ID, extra)
+	}
+	oldVB := estimateTxVBytesDetailed(s, old.Inputs, old.Outputs)
+	if fee*oldVB <= old.FeeSats*vbytes {
+		return nil, fmt.Errorf("a replacement of plan %s must pay a higher fee rate than the original", old.ID)
+	}
+
+	// Keep the original out of exposure limits while building its replacement
+	delete(s.plans, old.ID)
+	bump, err := s.assemblePlan(old.Inputs, final, fee, changeIdxs, p)
+	s.plans[old.ID] = old
+	if err != nil {
+		return nil, fmt.Errorf("cannot build a replacement for plan %s: %w", old.ID, err)
+	}
+	bump.Replaces = old.ID
+	if err := s.savePlan(bump); err != nil {
+		return nil, err
+	}
+	s.logger.Printf("fee bump of %s: %s pays %d sats (was %d)", old.ID, bump.ID, bump.FeeSats, old.FeeSats)
+	return bump, nil
+}
+
+// Whether any input opts into replacement (BIP-125)
+func signalsRBF(tx *MsgTx) bool {
+	for _, in := range tx.TxIn {
+		if in.Sequence < 0xfffffffe {
+			return true
+		}
+	}
+	return false
+}
+
+// Fee a replacement of old with outputs must pay at rate: the rate itself, but
+// no less than the original fee plus the incremental relay fee (BIP-125)
+func bumpFeeFor(s *Sweeper, old *TransactionPlan, outputs []TxOutput, rate FeeRate) int64 {
+	vbytes := estimateTxVBytesDetailed(s, old.Inputs, outputs)
+	return max64(rate.Fee(vbytes), old.FeeSats+incrementalRelayFeeRate.Fee(vbytes))
+}
+
+// Total value of outputs
+func sumOutputs(outputs []TxOutput) int64 {
+	var total int64
+	for _, o := range outputs {
+		total += o.ValueSats
+	}
+	return total
+}
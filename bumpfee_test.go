@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBumpFee(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.SetFeeRate(2)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	now := time.Now()
+
+	final, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.MarkBroadcast(final.ID, now)
+	if _, err := s.BumpFee(final, 10); err == nil || !strings.Contains(err.Error(), "replaceability") {
+		t.Fatalf("expected a non-RBF plan to be refused, got %v", err)
+	}
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 60_000}}, SpendOptions{RBF: true})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if _, err := s.BumpFee(plan, 10); err == nil || !strings.Contains(err.Error(), "only broadcast") {
+		t.Fatalf("expected an unbroadcast plan to be refused, got %v", err)
+	}
+	_ = s.MarkBroadcast(plan.ID, now)
+	// 2 sat/vB plus the 1 sat/vB incremental relay fee is the least allowed
+	if _, err := s.BumpFee(plan, 2); err == nil || !strings.Contains(err.Error(), "(3 sat/vB)") {
+		t.Fatalf("expected the incremental relay fee rule, got %v", err)
+	}
+
+	bump, err := s.BumpFee(plan, 10)
+	if err != nil {
+		t.Fatalf("BumpFee: %v", err)
+	}
+	vbytes := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	if bump.FeeSats != vbytes*10 || bump.Replaces != plan.ID || bump.Settings.FeeRate != 10 {
+		t.Fatalf("bump pays %d (want %d), replaces %q", bump.FeeSats, vbytes*10, bump.Replaces)
+	}
+	if len(bump.Inputs) != 1 || outpointKey(bump.Inputs[0]) != outpointKey(plan.Inputs[0]) || bump.Outputs[0] != plan.Outputs[0] {
+		t.Fatalf("bump must spend the same inputs and pay the same recipients: %+v", bump)
+	}
+	if got, want := bump.Outputs[1].ValueSats, plan.Outputs[1].ValueSats-(bump.FeeSats-plan.FeeSats); got != want {
+		t.Fatalf("change %d, want %d", got, want)
+	}
+	if bump.RawTx.TxIn[0].Sequence != plan.RawTx.TxIn[0].Sequence {
+		t.Fatalf("bump must keep signalling replaceability")
+	}
+
+	// Broadcasting the bump retires the original
+	if err := s.MarkBroadcast(bump.ID, now); err != nil {
+		t.Fatalf("MarkBroadcast: %v", err)
+	}
+	if plan.Status != PlanReplaced || !strings.Contains(plan.History[len(plan.History)-1].Reason, bump.ID) {
+		t.Fatalf("original is %s", plan.Status)
+	}
+
+	// A rate the change cannot cover is refused; one that leaves dust drops it
+	if _, err := s.BumpFee(bump, 1_000); err == nil || !strings.Contains(err.Error(), "CPFP") {
+		t.Fatalf("expected too little change, got %v", err)
+	}
+	rate := (39_000 + bump.FeeSats) / vbytes
+	noChange, err := s.BumpFee(bump, rate)
+	if err != nil {
+		t.Fatalf("BumpFee: %v", err)
+	}
+	if len(noChange.Outputs) != 1 || len(noChange.ChangeIdxs) != 0 || noChange.FeeSats != 40_000 || noChange.DustChangeSats == 0 {
+		t.Fatalf("expected change given up to the fee, got outputs %+v fee %d", noChange.Outputs, noChange.FeeSats)
+	}
+}
+
+func TestBumpFeeKeepsChainDepth(t *testing.T) {
+	s := newTestSweeper(t, WithUnconfirmedPolicy(true, 2, 2))
+	parent := stringsRepeat("c", 64)
+	_ = s.Index(UTXO{TxID: parent, Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: false})
+	now := time.Now()
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{RBF: true})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.MarkBroadcast(plan.ID, now)
+	for _, rate := range []int64{10, 20} {
+		bump, err := s.BumpFee(plan, rate)
+		if err != nil {
+			t.Fatalf("BumpFee(%d): %v", rate, err)
+		}
+		_ = s.MarkBroadcast(bump.ID, now)
+		plan = bump
+	}
+	if got := s.PendingChainDepth()[parent]; got != 1 {
+		t.Fatalf("replacements must not deepen the chain: depth %d, want 1", got)
+	}
+
+	// The parent's other output is still one spend short of the limit
+	if err := s.Index(UTXO{TxID: parent, Vout: 1, ValueSats: 80_000, Address: testAddr("in"), Confirmed: false}); err != nil {
+		t.Fatalf("Index sibling: %v", err)
+	}
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}}); err != nil {
+		t.Fatalf("Spend sibling: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains identification of change outputs independent of position.
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// ChangeOutput identifies a change output by what it pays rather than where it
+// sits, so it is found again whatever position output ordering gives it.
+type ChangeOutput struct {
+	Address   string `json:"address"`
+	Script    []byte `json:"script"`
+	ValueSats int64  `json:"value_sats"`
+}
+
+// ChangeIndices returns the positions of the plan's change outputs in its
+// transaction, matched by script and value. Equal outputs are interchangeable;
+// the position recorded at build time wins ties. Plans without change records
+// fall back to ChangeIdxs.
+func (p *TransactionPlan) ChangeIndices() []int {
+	if len(p.Change) == 0 || p.RawTx == nil {
+		return p.ChangeIdxs
+	}
+	outs := p.RawTx.TxOut
+	used := make([]bool, len(outs))
+	matches := func(i int, c ChangeOutput) bool {
+		return i >= 0 && i < len(outs) && !used[i] && outs[i].Value == c.ValueSats && bytes.Equal(outs[i].PkScript, c.Script)
+	}
+	idxs := make([]int, 0, len(p.Change))
+	for k, c := range p.Change {
+		found := -1
+		if k < len(p.ChangeIdxs) && matches(p.ChangeIdxs[k], c) {
+			found = p.ChangeIdxs[k]
+		}
+		for i := 0; found < 0 && i < len(outs); i++ {
+			if matches(i, c) {
+				found = i
+			}
+		}
+		if found >= 0 {
+			used[found] = true
+			idxs = append(idxs, found)
+		}
+	}
+	sort.Ints(idxs)
+	return idxs
+}
+
+// IsChange reports whether output i of the plan's transaction is change.
+func (p *TransactionPlan) IsChange(i int) bool {
+	for _, c := range p.ChangeIndices() {
+		if c == i {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeUTXOs returns the plan's change outputs as unconfirmed UTXOs, ready to
+// index for child plans (chained spends or CPFP).
+func (p *TransactionPlan) ChangeUTXOs() []UTXO {
+	var out []UTXO
+	for _, i := range p.ChangeIndices() {
+		out = append(out, UTXO{
+			TxID:      p.ExpectedTxID(),
+			Vout:      uint32(i),
+			ValueSats: p.RawTx.TxOut[i].Value,
+			Address:   p.Outputs[i].Address,
+		})
+	}
+	return out
+}
+
+// Record change outputs by script and derive ChangeIdxs from the transaction
+func (s *Sweeper) recordChange(plan *TransactionPlan) error {
+	plan.Change = plan.Change[:0]
+	for _, i := range plan.ChangeIdxs {
+		o := plan.Outputs[i]
+		script, err := s.buildOutputScript(o.Address)
+		if err != nil {
+			return err
+		}
+		plan.Change = append(plan.Change, ChangeOutput{Address: o.Address, Script: script, ValueSats: o.ValueSats})
+	}
+	plan.ChangeIdxs = plan.ChangeIndices()
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestChangeIndicesFollowReorderedOutputs(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.ChangeIdxs) != 1 || plan.ChangeIdxs[0] != 1 {
+		t.Fatalf("expected change at index 1, got %v", plan.ChangeIdxs)
+	}
+	change := plan.Outputs[1]
+
+	// Swap the outputs as an output-ordering step would
+	tx := plan.RawTx
+	tx.TxOut[0], tx.TxOut[1] = tx.TxOut[1], tx.TxOut[0]
+	plan.Outputs[0], plan.Outputs[1] = plan.Outputs[1], plan.Outputs[0]
+	if got := plan.ChangeIndices(); len(got) != 1 || got[0] != 0 {
+		t.Fatalf("change not tracked after reordering: %v", got)
+	}
+	if !plan.IsChange(0) || plan.IsChange(1) {
+		t.Fatalf("IsChange disagrees with ChangeIndices")
+	}
+	us := plan.ChangeUTXOs()
+	if len(us) != 1 || us[0].Vout != 0 || us[0].ValueSats != change.ValueSats || us[0].TxID != plan.ExpectedTxID() {
+		t.Fatalf("unexpected change UTXOs: %+v", us)
+	}
+}
+
+func TestSubDustChangeGoesToFee(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	probe, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.DiscardPlan(probe.ID)
+
+	// Leave about 100 sats of change, far below dust
+	amount := 100_000 - probe.FeeSats - 100
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: amount}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Outputs) != 1 || len(plan.ChangeIdxs) != 0 {
+		t.Fatalf("expected no change output, got %+v", plan.Outputs)
+	}
+	target := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs) * 5
+	if plan.FeeSats != 100_000-amount || plan.DustChangeSats != plan.FeeSats-target {
+		t.Fatalf("fee %d with %d dust change, want %d and %d", plan.FeeSats, plan.DustChangeSats, 100_000-amount, plan.FeeSats-target)
+	}
+	if !hasWarning(plan, WarnChangeAbsorbed) {
+		t.Fatalf("expected a change_absorbed warning, got %+v", plan.Warnings)
+	}
+
+	// The decision survives a restart
+	s2 := newTestSweeper(t, WithKV(kv))
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	if got, _ := s2.GetPlan(plan.ID); got == nil || got.DustChangeSats != plan.DustChangeSats {
+		t.Fatalf("dust change not persisted: %+v", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains proof that the taproot change key is spendable.
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// TaprootSigner produces BIP-340 key-path signatures, e.g. an HSM or a
+// hardware wallet reached through HWI.
+type TaprootSigner interface {
+	SignSchnorr(xOnlyKey []byte, msg [32]byte) ([]byte, error)
+}
+
+// VerifyTaprootChangeKey proves the configured taproot change key is
+// spendable by asking signer to sign a fresh random challenge with it and
+// checking the signature. A mistyped or untweaked x-only key would otherwise
+// send change to an output nobody can spend.
+func (s *Sweeper) VerifyTaprootChangeKey(signer TaprootSigner) error {
+	if len(s.taprootChangeKey) != 32 {
+		return errors.New("no taproot change key configured")
+	}
+	if signer == nil {
+		return errors.New("no signer given")
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	msg := taggedHash("utxo-sweeper/change-key-proof", s.taprootChangeKey, nonce)
+	sig, err := signer.SignSchnorr(s.taprootChangeKey, msg)
+	if err != nil {
+		return fmt.Errorf("signer could not sign for the taproot change key: %w", err)
+	}
+	if err := VerifySchnorr(s.taprootChangeKey, msg[:], sig); err != nil {
+		return fmt.Errorf("signer cannot spend the taproot change key (%v) - check that the configured key is the tweaked output key your signer holds", err)
+	}
+	s.changeKeyVerified = true
+	s.logger.Printf("taproot change key %x verified", s.taprootChangeKey)
+	return nil
+}
+
+// ChangeKeyChallenge returns the message an offline signer signs with the
+// taproot change key to prove it is spendable when no signer is reachable at
+// planning time, as in the CLI. Unlike VerifyTaprootChangeKey's challenge it
+// is fixed per key, so the proof can be stored in configuration.
+func (s *Sweeper) ChangeKeyChallenge() ([32]byte, error) {
+	if len(s.taprootChangeKey) != 32 {
+		return [32]byte{}, errors.New("no taproot change key configured")
+	}
+	return taggedHash("utxo-sweeper/change-key-proof", s.taprootChangeKey), nil
+}
+
+// ProveTaprootChangeKey accepts a BIP-340 signature of ChangeKeyChallenge by
+// the taproot change key as proof that it is spendable.
+func (s *Sweeper) ProveTaprootChangeKey(sig []byte) error {
+	msg, err := s.ChangeKeyChallenge()
+	if err != nil {
+		return err
+	}
+	if err := VerifySchnorr(s.taprootChangeKey, msg[:], sig); err != nil {
+		return fmt.Errorf("change key proof does not verify (%v) - sign the challenge with the tweaked output key", err)
+	}
+	s.changeKeyVerified = true
+	s.logger.Printf("taproot change key %x verified by stored proof", s.taprootChangeKey)
+	return nil
+}
+
+// SetRequireVerifiedChangeKey makes planning fail instead of routing change to
+// a taproot key that VerifyTaprootChangeKey has not proven spendable.
+func (s *Sweeper) SetRequireVerifiedChangeKey(required bool) {
+	s.requireChangeKeyProof = required
+}
+
+// Refuse an unproven taproot change key when proof is required
+func (s *Sweeper) checkChangeKeyProof() error {
+	if s.requireChangeKeyProof && len(s.taprootChangeKey) == 32 && !s.changeKeyVerified {
+		return errors.New("taproot change key has not been verified - call VerifyTaprootChangeKey with your signer first")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestVerifySchnorrBIP340Vectors(t *testing.T) {
+	for i, v := range []struct{ pk, msg, sig string }{
+		{"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0"},
+		{"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+			"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+			"6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A"},
+	} {
+		pk, _ := hex.DecodeString(v.pk)
+		msg, _ := hex.DecodeString(v.msg)
+		sig, _ := hex.DecodeString(v.sig)
+		if err := VerifySchnorr(pk, msg, sig); err != nil {
+			t.Fatalf("vector %d: %v", i, err)
+		}
+		sig[40] ^= 1
+		if err := VerifySchnorr(pk, msg, sig); err == nil {
+			t.Fatalf("vector %d: tampered signature accepted", i)
+		}
+	}
+}
+
+// testSigner holds one secret key and signs per BIP-340 with a deterministic nonce
+type testSigner struct{ d *big.Int }
+
+func (ts testSigner) xOnly() []byte {
+	P := ecMul(&ecPoint{secpGx, secpGy}, ts.d)
+	return P.x.FillBytes(make([]byte, 32))
+}
+
+func (ts testSigner) SignSchnorr(_ []byte, msg [32]byte) ([]byte, error) {
+	G := &ecPoint{secpGx, secpGy}
+	d := new(big.Int).Set(ts.d)
+	P := ecMul(G, d)
+	if P.y.Bit(0) == 1 {
+		d.Sub(secpN, d)
+	}
+	kh := sha256.Sum256(append(d.FillBytes(make([]byte, 32)), msg[:]...))
+	k := new(big.Int).Mod(new(big.Int).SetBytes(kh[:]), secpN)
+	R := ecMul(G, k)
+	if R.y.Bit(0) == 1 {
+		k.Sub(secpN, k)
+	}
+	rx := R.x.FillBytes(make([]byte, 32))
+	eh := taggedHash("BIP0340/challenge", rx, P.x.FillBytes(make([]byte, 32)), msg[:])
+	e := new(big.Int).Mod(new(big.Int).SetBytes(eh[:]), secpN)
+	s := e.Mul(e, d).Add(e, k).Mod(e, secpN)
+	return append(rx, s.FillBytes(make([]byte, 32))...), nil
+}
+
+func TestTaprootChangeKeyProofGatesChange(t *testing.T) {
+	signer := testSigner{d: big.NewInt(0x5eed)}
+	other := testSigner{d: big.NewInt(0xbad)}
+
+	s := mustNewSweeper(t, make([]byte, 33), BitcoinTestnet)
+	if err := s.SetTaprootChangeKey(signer.xOnly()); err != nil {
+		t.Fatalf("SetTaprootChangeKey: %v", err)
+	}
+	s.SetRequireVerifiedChangeKey(true)
+	if _, err := s.getChangeAddress(); err == nil {
+		t.Fatalf("expected unverified change key to be refused")
+	}
+	if err := s.VerifyTaprootChangeKey(other); err == nil {
+		t.Fatalf("expected a signer without the key to fail verification")
+	}
+	if err := s.VerifyTaprootChangeKey(signer); err != nil {
+		t.Fatalf("VerifyTaprootChangeKey: %v", err)
+	}
+	if _, err := s.getChangeAddress(); err != nil {
+		t.Fatalf("verified change key refused: %v", err)
+	}
+	_ = s.SetTaprootChangeKey(other.xOnly())
+	if _, err := s.getChangeAddress(); err == nil {
+		t.Fatalf("expected a new key to need verification again")
+	}
+}
+
+func TestStoredChangeKeyProof(t *testing.T) {
+	signer := testSigner{d: big.NewInt(0x5eed)}
+	s := mustNewSweeper(t, make([]byte, 33), BitcoinTestnet)
+	_ = s.SetTaprootChangeKey(signer.xOnly())
+	cfg := DefaultConfig()
+	cfg.RequireVerifiedChangeKey = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "change_key_proof") {
+		t.Fatalf("expected require_verified_change_key without a proof to be rejected, got %v", err)
+	}
+	s.SetRequireVerifiedChangeKey(true)
+
+	msg, err := s.ChangeKeyChallenge()
+	if err != nil {
+		t.Fatalf("ChangeKeyChallenge: %v", err)
+	}
+	forged, _ := testSigner{d: big.NewInt(0xbad)}.SignSchnorr(nil, msg)
+	cfg.ChangeKeyProof = hex.EncodeToString(forged)
+	if err := cfg.ApplyChangeKeyProof(s); err == nil {
+		t.Fatalf("expected a proof by another key to be refused")
+	}
+	sig, _ := signer.SignSchnorr(nil, msg)
+	cfg.ChangeKeyProof = hex.EncodeToString(sig)
+	if err := cfg.ApplyChangeKeyProof(s); err != nil {
+		t.Fatalf("ApplyChangeKeyProof: %v", err)
+	}
+	if _, err := s.getChangeAddress(); err != nil {
+		t.Fatalf("proven change key refused: %v", err)
+	}
+}
+
+func TestTaprootInternalKeyTweak(t *testing.T) {
+	// BIP-86 test vector: first receive key of the "abandon ... about" mnemonic
+	internal, _ := hex.DecodeString("03cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115")
+	xOnly, odd, err := XOnlyPubKey(internal)
+	if err != nil || !odd || hex.EncodeToString(xOnly) != "cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115" {
+		t.Fatalf("XOnlyPubKey = %x odd=%v (%v)", xOnly, odd, err)
+	}
+	out, _, err := TaprootOutputKey(xOnly)
+	if err != nil || hex.EncodeToString(out) != "a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c" {
+		t.Fatalf("TaprootOutputKey = %x (%v)", out, err)
+	}
+	const want = "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"
+	for _, key := range [][]byte{internal, xOnly} {
+		if addr, err := CreateP2TRFromInternalKey(key, BitcoinMainnet); err != nil || addr != want {
+			t.Fatalf("CreateP2TRFromInternalKey = %s (%v), want %s", addr, err, want)
+		}
+	}
+	if _, _, err := XOnlyPubKey(append([]byte{0x04}, xOnly...)); err == nil {
+		t.Fatalf("expected a non-compressed prefix to be rejected")
+	}
+
+	s := mustNewSweeper(t, internal, BitcoinMainnet)
+	if err := s.SetTaprootChangeInternalKey(internal); err != nil {
+		t.Fatalf("SetTaprootChangeInternalKey: %v", err)
+	}
+	if addr, _ := s.getChangeAddress(); addr != want {
+		t.Fatalf("change address = %s, want %s", addr, want)
+	}
+}
@@ -0,0 +1,33 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the changeless spend window.
+package main
+
+import "fmt"
+
+// SetChangelessTolerance makes plans skip the change output when the selected
+// inputs exceed the outputs and the fee of a changeless transaction by less
+// than sats: the excess goes to the fee instead of into a small change UTXO
+// that would cost nearly its value to spend and links the payment to the
+// wallet. 0 (the default) only absorbs change below the dust threshold.
+func (s *Sweeper) SetChangelessTolerance(sats int64) error {
+	if sats < 0 {
+		return fmt.Errorf("changeless tolerance must be non-negative (got %d)", sats)
+	}
+	s.changelessTolerance = sats
+	return nil
+}
+
+// Whether available (inputs minus outputs) exceeds the fee of a changeless
+// spend, ancestors included, by less than the changeless tolerance
+func (s *Sweeper) withinChangelessTolerance(selected []UTXO, outputs []TxOutput, available int64, p spendParams) bool {
+	if s.changelessTolerance <= 0 {
+		return false
+	}
+	vbytes := estimateTxVBytesDetailed(s, selected, outputs)
+	fee, err := s.packageFee(selected, vbytes, p.feeRate.Fee(vbytes), p.feeRate)
+	if err != nil {
+		return false
+	}
+	excess := available - fee
+	return excess >= 0 && excess < s.changelessTolerance
+}
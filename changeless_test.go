@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestChangelessTolerance(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 98_000}}
+	changelessFee := estimateTxVBytesDetailed(s, s.indexedUTXOs, out) * 5
+	excess := 2_000 - changelessFee
+
+	// Without a tolerance the excess is worth a change output
+	plan, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.ChangeIdxs) != 1 {
+		t.Fatalf("expected change, got outputs %+v", plan.Outputs)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	if err := s.SetChangelessTolerance(excess); err != nil {
+		t.Fatalf("SetChangelessTolerance: %v", err)
+	}
+	if plan, err = s.Spend(out); err != nil || len(plan.ChangeIdxs) != 1 {
+		t.Fatalf("an excess equal to the tolerance keeps its change: %+v, %v", plan, err)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	_ = s.SetChangelessTolerance(excess + 1)
+	plan, err = s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Outputs) != 1 || plan.FeeSats != 2_000 || plan.Settings.ChangelessTolerance != excess+1 {
+		t.Fatalf("expected a changeless spend paying 2000 sats, got outputs %+v fee %d", plan.Outputs, plan.FeeSats)
+	}
+	absorbed := false
+	for _, w := range plan.Warnings {
+		absorbed = absorbed || w.Code == WarnChangeAbsorbed
+	}
+	if !absorbed {
+		t.Fatalf("expected the absorbed change to be flagged: %+v", plan.Warnings)
+	}
+	if err := s.SetChangelessTolerance(-1); err == nil {
+		t.Fatalf("expected a negative tolerance to be refused")
+	}
+}
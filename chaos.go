@@ -0,0 +1,224 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains a fault-injecting wrapper for backend implementations.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrChaos is the error injected by ChaosBackend.
+var ErrChaos = errors.New("chaos: injected backend failure")
+
+// ChaosConfig sets how often and how badly a ChaosBackend misbehaves. Rates
+// are probabilities per call (or per item, for DropRate) from 0 to 1.
+type ChaosConfig struct {
+	Seed      int64         // Seed for the fault schedule; equal seeds replay the same faults
+	Latency   time.Duration // Added to every call
+	Jitter    time.Duration // Random extra latency up to this much
+	ErrorRate float64       // Calls failing with ErrChaos before reaching the backend
+	StaleRate float64       // ChainTip and Confirmations answering with an earlier response
+	DropRate  float64       // UTXOs missing from ListUnspent, transactions missing from MempoolTx
+	// Broadcasts the backend accepts but that are reported as failed, like a
+	// timeout after relay
+	LostBroadcastRate float64
+	// Sleep waits out latency (nil = time.Sleep); tests can record instead
+	Sleep func(time.Duration)
+}
+
+// ChaosBackend wraps any backend and injects latency, errors and inconsistent
+// responses, to test how callers cope with a flapping server. It implements
+// UTXOSource, Broadcaster, FeeRateProvider, ChainInfoProvider,
+// ConfirmationSource and MempoolSource; calls for an interface the wrapped
+// backend lacks fail.
+type ChaosBackend struct {
+	inner any
+	cfg   ChaosConfig
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	faults int
+	tips   []chaosTip
+	confs  map[string]int
+}
+
+// An earlier ChainTip answer, replayed when stale
+type chaosTip struct {
+	height int64
+	mtp    time.Time
+}
+
+// NewChaosBackend wraps inner with the faults in cfg.
+func NewChaosBackend(inner any, cfg ChaosConfig) (*ChaosBackend, error) {
+	for _, r := range []float64{cfg.ErrorRate, cfg.StaleRate, cfg.DropRate, cfg.LostBroadcastRate} {
+		if r < 0 || r > 1 {
+			return nil, fmt.Errorf("chaos rates must be between 0 and 1 (got %v)", r)
+		}
+	}
+	if cfg.Latency < 0 || cfg.Jitter < 0 {
+		return nil, errors.New("chaos latency and jitter must be non-negative")
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = time.Sleep
+	}
+	return &ChaosBackend{inner: inner, cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed)), confs: map[string]int{}}, nil
+}
+
+// Faults returns how many faults (errors, stale answers, drops, lost
+// broadcasts) have been injected.
+func (c *ChaosBackend) Faults() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.faults
+}
+
+// Roll for a fault at rate, counting it
+func (c *ChaosBackend) roll(rate float64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rate <= 0 || c.rng.Float64() >= rate {
+		return false
+	}
+	c.faults++
+	return true
+}
+
+// Wait out the latency, then fail with ErrChaos at the error rate
+func (c *ChaosBackend) enter() error {
+	d := c.cfg.Latency
+	if c.cfg.Jitter > 0 {
+		c.mu.Lock()
+		d += time.Duration(c.rng.Int63n(int64(c.cfg.Jitter) + 1))
+		c.mu.Unlock()
+	}
+	if d > 0 {
+		c.cfg.Sleep(d)
+	}
+	if c.roll(c.cfg.ErrorRate) {
+		return ErrChaos
+	}
+	return nil
+}
+
+func chaosUnsupported(iface string) error {
+	return fmt.Errorf("wrapped backend does not implement %s", iface)
+}
+
+// ListUnspent drops each UTXO at the drop rate.
+func (c *ChaosBackend) ListUnspent(addresses []string) ([]UTXO, error) {
+	src, ok := c.inner.(UTXOSource)
+	if !ok {
+		return nil, chaosUnsupported("UTXOSource")
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	utxos, err := src.ListUnspent(addresses)
+	if err != nil {
+		return nil, err
+	}
+	var out []UTXO
+	for _, u := range utxos {
+		if !c.roll(c.cfg.DropRate) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// Broadcast may report failure for a transaction the backend accepted.
+func (c *ChaosBackend) Broadcast(rawTx []byte) (string, error) {
+	b, ok := c.inner.(Broadcaster)
+	if !ok {
+		return "", chaosUnsupported("Broadcaster")
+	}
+	if err := c.enter(); err != nil {
+		return "", err
+	}
+	txid, err := b.Broadcast(rawTx)
+	if err == nil && c.roll(c.cfg.LostBroadcastRate) {
+		return "", fmt.Errorf("%w: response lost after relay", ErrChaos)
+	}
+	return txid, err
+}
+
+// EstimateFeeRate passes through with latency and errors.
+func (c *ChaosBackend) EstimateFeeRate(confTarget int) (FeeRate, error) {
+	f, ok := c.inner.(FeeRateProvider)
+	if !ok {
+		return 0, chaosUnsupported("FeeRateProvider")
+	}
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	return f.EstimateFeeRate(confTarget)
+}
+
+// ChainTip may answer with an earlier tip, as a lagging server behind a load
+// balancer would.
+func (c *ChaosBackend) ChainTip() (int64, time.Time, error) {
+	ci, ok := c.inner.(ChainInfoProvider)
+	if !ok {
+		return 0, time.Time{}, chaosUnsupported("ChainInfoProvider")
+	}
+	if err := c.enter(); err != nil {
+		return 0, time.Time{}, err
+	}
+	h, mtp, err := ci.ChainTip()
+	if err != nil {
+		return h, mtp, err
+	}
+	c.mu.Lock()
+	past := append([]chaosTip(nil), c.tips...)
+	c.tips = append(c.tips, chaosTip{h, mtp})
+	c.mu.Unlock()
+	if len(past) > 0 && c.roll(c.cfg.StaleRate) {
+		c.mu.Lock()
+		t := past[c.rng.Intn(len(past))]
+		c.mu.Unlock()
+		return t.height, t.mtp, nil
+	}
+	return h, mtp, nil
+}
+
+// Confirmations may repeat the previous answer for txid.
+func (c *ChaosBackend) Confirmations(txid string) (int, error) {
+	cs, ok := c.inner.(ConfirmationSource)
+	if !ok {
+		return 0, chaosUnsupported("ConfirmationSource")
+	}
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	n, err := cs.Confirmations(txid)
+	if err != nil {
+		return n, err
+	}
+	c.mu.Lock()
+	prev, seen := c.confs[txid]
+	c.confs[txid] = n
+	c.mu.Unlock()
+	if seen && prev != n && c.roll(c.cfg.StaleRate) {
+		return prev, nil
+	}
+	return n, nil
+}
+
+// MempoolTx may claim a transaction is missing from the mempool.
+func (c *ChaosBackend) MempoolTx(txid string) (*MempoolTxInfo, error) {
+	m, ok := c.inner.(MempoolSource)
+	if !ok {
+		return nil, chaosUnsupported("MempoolSource")
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	info, err := m.MempoolTx(txid)
+	if err == nil && c.roll(c.cfg.DropRate) {
+		return nil, fmt.Errorf("%w: transaction %s not found", ErrChaos, txid)
+	}
+	return info, err
+}
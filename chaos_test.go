@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A funded mock chain and a sweeper with one signed plan over it
+func chaosFixture(t *testing.T) (*MockBackend, *Sweeper, *TransactionPlan) {
+	t.Helper()
+	m := NewMockBackend(BitcoinTestnet, 100, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinTestnet)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinTestnet)
+	dest, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+	m.Fund(own, 150_000)
+	m.MineBlocks(1)
+	utxos, _ := m.ListUnspent([]string{own})
+	for _, u := range utxos {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx
+	return m, s, plan
+}
+
+func TestChaosBackendFaults(t *testing.T) {
+	m := NewMockBackend(BitcoinTestnet, 100, time.Now())
+	if _, err := NewChaosBackend(m, ChaosConfig{ErrorRate: 1.5}); err == nil {
+		t.Fatalf("expected an out-of-range rate to be refused")
+	}
+
+	var slept []time.Duration
+	c, _ := NewChaosBackend(m, ChaosConfig{ErrorRate: 1, Latency: time.Second, Sleep: func(d time.Duration) { slept = append(slept, d) }})
+	if _, err := c.EstimateFeeRate(6); !errors.Is(err, ErrChaos) {
+		t.Fatalf("EstimateFeeRate error = %v, want ErrChaos", err)
+	}
+	if len(slept) != 1 || slept[0] != time.Second || c.Faults() != 1 {
+		t.Fatalf("slept %v with %d faults", slept, c.Faults())
+	}
+
+	// A lagging server answers with tips it has already reported
+	c, _ = NewChaosBackend(m, ChaosConfig{StaleRate: 1, Sleep: func(time.Duration) {}})
+	h1, _, _ := c.ChainTip()
+	m.MineBlocks(1)
+	if h2, _, _ := c.ChainTip(); h2 != h1 {
+		t.Fatalf("stale tip = %d, want %d", h2, h1)
+	}
+
+	// Equal seeds replay the same faults
+	drops := func() int {
+		m := NewMockBackend(BitcoinTestnet, 100, time.Now())
+		dest, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+		for i := 0; i < 20; i++ {
+			m.Fund(dest, 1000)
+		}
+		c, _ := NewChaosBackend(m, ChaosConfig{Seed: 7, DropRate: 0.5})
+		utxos, _ := c.ListUnspent([]string{dest})
+		return len(utxos)
+	}
+	if a, b := drops(), drops(); a != b || a == 0 || a == 20 {
+		t.Fatalf("drops not deterministic or not partial: %d, %d", a, b)
+	}
+
+	if _, err := (&ChaosBackend{inner: struct{}{}}).Broadcast(nil); err == nil {
+		t.Fatalf("expected an unsupported interface to fail")
+	}
+}
+
+// The backend relays the sweep but the response is lost: retrying must
+// settle the plan as broadcast rather than fail forever on "already known".
+func TestChaosLostBroadcastRetry(t *testing.T) {
+	m, s, plan := chaosFixture(t)
+	c, _ := NewChaosBackend(m, ChaosConfig{LostBroadcastRate: 1})
+	if _, err := s.BroadcastPlan(plan.ID, c); !errors.Is(err, ErrChaos) {
+		t.Fatalf("BroadcastPlan error = %v, want ErrChaos", err)
+	}
+	if p, _ := s.GetPlan(plan.ID); p.BroadcastAt != nil {
+		t.Fatalf("plan marked broadcast after a failed call")
+	}
+	if got := m.Accepted(); len(got) != 1 {
+		t.Fatalf("backend accepted %v", got)
+	}
+	if txid, err := s.BroadcastPlan(plan.ID, m); err != nil || txid != plan.ID {
+		t.Fatalf("retry = %s, %v", txid, err)
+	}
+	if p, _ := s.GetPlan(plan.ID); p.BroadcastAt == nil {
+		t.Fatalf("retry did not mark the plan broadcast")
+	}
+}
+
+// A flapping backend must never make the tracker regress a confirmed plan or
+// lose track of a pending one; errors surface and the next poll recovers.
+func TestChaosTrackerFlappingBackend(t *testing.T) {
+	m, s, plan := chaosFixture(t)
+	if _, err := s.BroadcastPlan(plan.ID, m); err != nil {
+		t.Fatalf("BroadcastPlan: %v", err)
+	}
+	c, _ := NewChaosBackend(m, ChaosConfig{Seed: 3, ErrorRate: 0.3, StaleRate: 0.5, DropRate: 0.3})
+	s.SetMempoolSource(c)
+	tr := NewConfirmationTracker(s, c)
+
+	var failures, dropped int
+	confirmed := false
+	for i := 0; i < 40; i++ {
+		if i >= 20 && i%5 == 0 {
+			m.MineBlocks(1)
+		}
+		sts, err := tr.Poll(time.Now())
+		if err != nil {
+			if !errors.Is(err, ErrChaos) {
+				t.Fatalf("unexpected Poll error: %v", err)
+			}
+			failures++
+			continue
+		}
+		switch st := sts[0]; {
+		case confirmed && st.State != PlanConfirmed:
+			t.Fatalf("poll %d: confirmed plan regressed to %s", i, st.State)
+		case st.State == PlanConfirmed:
+			confirmed = true
+		case st.State == PlanDropped:
+			if st.Action != "rebroadcast" {
+				t.Fatalf("dropped plan suggests %q", st.Action)
+			}
+			dropped++
+		case st.State != PlanPending:
+			t.Fatalf("poll %d: unexpected state %s", i, st.State)
+		}
+	}
+	if !confirmed || failures == 0 || dropped == 0 || c.Faults() == 0 {
+		t.Fatalf("confirmed=%v failures=%d dropped=%d faults=%d", confirmed, failures, dropped, c.Faults())
+	}
+}
+
+// The doctor reports an unreachable backend instead of failing outright.
+func TestChaosDoctorBackendDown(t *testing.T) {
+	m, s, _ := chaosFixture(t)
+	c, _ := NewChaosBackend(m, ChaosConfig{ErrorRate: 1})
+	s.SetChainInfo(c)
+	rep := s.Doctor(time.Now())
+	if rep.Healthy() {
+		t.Fatalf("doctor healthy with the backend down: %+v", rep.Findings)
+	}
+}
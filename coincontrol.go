@@ -0,0 +1,64 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains manual coin control: spending caller-chosen outpoints.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SpendFrom builds a plan spending exactly the indexed UTXOs at outpoints,
+// for wallets that let users pick coins. Automatic selection is skipped, but
+// the coins still pass the sweeper's policy (dust, confirmations, unconfirmed
+// limits, filter hooks) and must cover the outputs and fee; any excess
+// becomes change as usual.
+func (s *Sweeper) SpendFrom(outpoints []OutPoint, outputs []TxOutput, opts ...SpendOptions) (*TransactionPlan, error) {
+	p, err := s.resolveSpendOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(outpoints) == 0 {
+		return nil, errors.New("no outpoints given - pass the UTXOs to spend, or use Spend for automatic selection")
+	}
+	seen := map[string]bool{}
+	for _, op := range outpoints {
+		txid := hashToStr(op.Hash)
+		u, ok := s.GetUTXO(txid, op.Index)
+		if !ok {
+			return nil, fmt.Errorf("outpoint %s:%d is not indexed - index it before spending", txid, op.Index)
+		}
+		if seen[outpointKey(u)] {
+			return nil, fmt.Errorf("outpoint %s:%d given twice", txid, op.Index)
+		}
+		seen[outpointKey(u)] = true
+		p.inputs = append(p.inputs, u)
+	}
+	screened, rejected := s.screenUTXOs(p.inputs, p)
+	if len(rejected) > 0 {
+		r := rejected[0]
+		return nil, fmt.Errorf("outpoint %s cannot be spent: %s", outpointKey(r.UTXO), r.Reason)
+	}
+	p.inputs = screened
+	return s.spend(outputs, p)
+}
+
+// Take the caller's inputs as the selection, checking they cover the outputs
+// and a fee with change (or, failing that, without)
+func (s *Sweeper) fixedSelection(inputs []UTXO, outputs []TxOutput, totalOut int64, p spendParams) ([]UTXO, int64, int64, error) {
+	if err := s.checkInputCount(len(inputs)); err != nil {
+		return nil, 0, 0, err
+	}
+	var totalIn int64
+	for _, u := range inputs {
+		totalIn += u.ValueSats
+	}
+	fee := p.feeRate.Fee(s.selectionVBytes(inputs, len(outputs)+1))
+	if totalIn >= totalOut+fee {
+		return inputs, totalIn, fee, nil
+	}
+	fee = p.feeRate.Fee(estimateTxVBytesDetailed(s, inputs, outputs))
+	if totalIn < totalOut+fee {
+		return nil, 0, 0, fmt.Errorf("chosen UTXOs hold %d sats, short of %d for outputs + fee - add outpoints or reduce outputs", totalIn, totalOut+fee)
+	}
+	return inputs, totalIn, fee, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestSpendFromExplicitOutpoints(t *testing.T) {
+	s := newTestSweeper(t)
+	var ops []OutPoint
+	for i, v := range []int64{30_000, 40_000, 500_000, 300} {
+		u := UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 1, ValueSats: v, Address: testAddr("in"), Confirmed: true}
+		_ = s.Index(u)
+		op, _ := NewOutPointFromStr(u.TxID, u.Vout)
+		ops = append(ops, op)
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 60_000}}
+
+	// Automatic selection would take the two small coins; coin control wins
+	plan, err := s.SpendFrom(ops[2:3], out)
+	if err != nil {
+		t.Fatalf("SpendFrom: %v", err)
+	}
+	if len(plan.Inputs) != 1 || plan.Inputs[0].ValueSats != 500_000 || len(plan.ChangeIdxs) != 1 {
+		t.Fatalf("expected the chosen coin with change, got inputs %+v", plan.Inputs)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	if _, err := s.SpendFrom(ops[:1], out); err == nil {
+		t.Fatalf("expected too small a coin set to be refused")
+	}
+	if _, err := s.SpendFrom([]OutPoint{ops[2], ops[2]}, out); err == nil {
+		t.Fatalf("expected a duplicate outpoint to be refused")
+	}
+	if _, err := s.SpendFrom([]OutPoint{ops[2], ops[3]}, out); err == nil {
+		t.Fatalf("expected a dust outpoint to be refused")
+	}
+	missing, _ := NewOutPointFromStr(stringsRepeat("f", 64), 0)
+	if _, err := s.SpendFrom([]OutPoint{missing}, out); err == nil {
+		t.Fatalf("expected an unindexed outpoint to be refused")
+	}
+	if plan, err = s.SpendFrom(ops[:2], out); err != nil || len(plan.Inputs) != 2 {
+		t.Fatalf("SpendFrom two coins: %+v, %v", plan, err)
+	}
+}
@@ -0,0 +1,202 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains coin selectors: the pluggable CoinSelector with its
+// greedy default, and branch-and-bound selection for changeless spends.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CoinSelector picks the inputs of a spend. candidates have passed every
+// policy filter, are economical at feeRate (sat/kvB) and are ordered by the selection
+// strategy. target is the value to cover before input fees: outputs plus the
+// fee for the transaction overhead, outputs and one change output. Each input
+// adds its own fee at feeRate; the sweeper re-checks that the selection covers
+// target and the input fees, and refuses coins that were not candidates.
+type CoinSelector interface {
+	Select(candidates []UTXO, target int64, feeRate FeeRate) ([]UTXO, error)
+}
+
+// WeightedCoinSelector is a CoinSelector that is also told the virtual size
+// of spending each candidate, so wallets mixing script types (P2WPKH, P2TR,
+// P2PKH, multisig) are priced per input rather than at one flat size. The
+// sweeper calls SelectWeighted instead of Select when a selector has it.
+type WeightedCoinSelector interface {
+	CoinSelector
+	SelectWeighted(candidates []UTXO, target int64, feeRate FeeRate, inputVBytes func(UTXO) int64) ([]UTXO, error)
+}
+
+// GreedySelector, the default, takes candidates in order until they cover
+// target plus their own fees.
+type GreedySelector struct{}
+
+// Select implements CoinSelector, pricing every input at the taproot size.
+func (g GreedySelector) Select(candidates []UTXO, target int64, feeRate FeeRate) ([]UTXO, error) {
+	return g.SelectWeighted(candidates, target, feeRate, flatInputVBytes)
+}
+
+// SelectWeighted implements WeightedCoinSelector.
+func (GreedySelector) SelectWeighted(candidates []UTXO, target int64, feeRate FeeRate, inputVBytes func(UTXO) int64) ([]UTXO, error) {
+	var totalIn, inFees int64
+	for i, u := range candidates {
+		totalIn += u.ValueSats
+		inFees += feeRate.Fee(inputVBytes(u))
+		if totalIn >= target+inFees {
+			return candidates[:i+1], nil
+		}
+	}
+	return nil, errors.New("balance is not enough for outputs + fee")
+}
+
+// Input size of the flat estimate, for selectors not told the real ones
+func flatInputVBytes(UTXO) int64 {
+	return estimateTxVBytes(1, 0) - estimateTxVBytes(0, 0)
+}
+
+// SetCoinSelector replaces the greedy input selection (nil restores it). The
+// selection strategy still orders the candidates, and SelectBranchAndBound
+// still tries a changeless match first.
+func (s *Sweeper) SetCoinSelector(sel CoinSelector) {
+	s.coinSelector = sel
+}
+
+// Type name of a custom coin selector for plan settings ("" = default)
+func (s *Sweeper) coinSelectorName() string {
+	if s.coinSelector == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", s.coinSelector)
+}
+
+// Validate a selector's picks: non-empty, distinct and all candidates. The
+// candidates' own copies are returned, so a selector cannot alter values.
+func checkSelection(cands, picked []UTXO) ([]UTXO, int64, error) {
+	if len(picked) == 0 {
+		return nil, 0, errors.New("selected no inputs")
+	}
+	known := map[string]UTXO{}
+	for _, u := range cands {
+		known[outpointKey(u)] = u
+	}
+	used := map[string]bool{}
+	var total int64
+	out := make([]UTXO, 0, len(picked))
+	for _, p := range picked {
+		key := outpointKey(p)
+		u, ok := known[key]
+		switch {
+		case !ok:
+			return nil, 0, fmt.Errorf("selected %s, which is not a candidate", key)
+		case used[key]:
+			return nil, 0, fmt.Errorf("selected %s twice", key)
+		}
+		used[key] = true
+		total += u.ValueSats
+		out = append(out, u)
+	}
+	return out, total, nil
+}
+
+// bnbMaxTries bounds the branch-and-bound search, as in Bitcoin Core.
+const bnbMaxTries = 100_000
+
+// selectBnB searches for inputs whose value after their own spending fee
+// covers the outputs and base fee with an excess small enough to give up as
+// fee instead of making change: below both the cost of creating and later
+// spending a change output and the change dust threshold. It returns nil if
+// no such set is found within bnbMaxTries; the fee returned leaves exactly
+// the excess as change, which the caller then drops.
+func (s *Sweeper) selectBnB(utxos []UTXO, outputs []TxOutput, changeAddr string, dust int64, p spendParams) ([]UTXO, int64, int64) {
+	var cands []UTXO
+	var values []int64
+	for _, u := range s.candidates(utxos, p) {
+		if ev := u.ValueSats - p.feeRate.Fee(inputVBytes(s, u)); ev > 0 {
+			cands = append(cands, u)
+			values = append(values, ev)
+		}
+	}
+	// Largest first, so the search reaches the target with few inputs
+	idx := make([]int, len(cands))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return values[idx[a]] > values[idx[b]] })
+	sorted := make([]int64, len(idx))
+	for i, j := range idx {
+		sorted[i] = values[j]
+	}
+
+	var totalOut int64
+	for _, o := range outputs {
+		totalOut += o.ValueSats
+	}
+	target := totalOut + p.feeRate.Fee(estimateTxVBytesDetailed(s, nil, outputs))
+	changeOut := estimateTxVBytesDetailed(s, nil, []TxOutput{{Address: changeAddr}}) - estimateTxVBytesDetailed(s, nil, nil)
+	window := p.feeRate.Fee(changeOut + inputVBytes(s, UTXO{Address: changeAddr}))
+	if dust < window {
+		window = dust
+	}
+
+	pick := bnbSearch(sorted, target, window, bnbMaxTries)
+	if pick == nil {
+		return nil, 0, 0
+	}
+	var selected []UTXO
+	var totalIn int64
+	for _, i := range pick {
+		u := cands[idx[i]]
+		selected = append(selected, u)
+		totalIn += u.ValueSats
+	}
+	vbytes := estimateTxVBytesDetailed(s, selected, outputs)
+	fee := p.feeRate.Fee(vbytes)
+	// Unconfirmed parents paying too little would need change to bump them
+	if pkg, err := s.packageFee(selected, vbytes, fee, p.feeRate); err != nil || pkg > totalIn-totalOut {
+		return nil, 0, 0
+	}
+	return selected, totalIn, fee
+}
+
+// bnbSearch returns the indexes of values (sorted descending) summing to
+// between target and target+window with the least excess, exploring at most
+// maxTries branches, or nil.
+func bnbSearch(values []int64, target, window int64, maxTries int) []int {
+	remaining := make([]int64, len(values)+1) // Sum of values[i:]
+	for i := len(values) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + values[i]
+	}
+	var best, cur []int
+	bestExcess := int64(-1)
+	tries := 0
+	var walk func(i int, sum int64)
+	walk = func(i int, sum int64) {
+		if tries >= maxTries || bestExcess == 0 {
+			return
+		}
+		tries++
+		switch {
+		case sum > target+window:
+			return
+		case sum >= target:
+			if excess := sum - target; bestExcess < 0 || excess < bestExcess {
+				best, bestExcess = append([]int(nil), cur...), excess
+			}
+			return
+		case i == len(values) || sum+remaining[i] < target:
+			return
+		}
+		cur = append(cur, i)
+		walk(i+1, sum+values[i])
+		cur = cur[:len(cur)-1]
+		// Leaving out values[i] then taking an equal value repeats a branch
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		walk(j, sum)
+	}
+	walk(0, 0)
+	return best
+}
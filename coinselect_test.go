@@ -0,0 +1,127 @@
+package main
+
+import "testing"
+
+func TestBranchAndBoundAvoidsChange(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.SetFeeRate(2)
+	// Each test-mode input costs 68 vB = 136 sats; the output and overhead 82
+	coins := []int64{40_218, 60_136, 70_000, 200_000}
+	for i, v := range coins {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 0, ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}
+
+	plan, err := s.Spend(out, SpendOptions{Selection: SelectBranchAndBound})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 2 || len(plan.ChangeIdxs) != 0 || len(plan.Outputs) != 1 {
+		t.Fatalf("expected a changeless 2-input match, got inputs %+v outputs %+v", plan.Inputs, plan.Outputs)
+	}
+	if plan.FeeSats != 354 || plan.Settings.Selection != SelectBranchAndBound {
+		t.Fatalf("fee %d, selection %s", plan.FeeSats, plan.Settings.Selection)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	// No subset lands in the window: fall back to smallest-first with change
+	plan, err = s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}}, SpendOptions{Selection: SelectBranchAndBound})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.ChangeIdxs) != 1 || plan.Inputs[0].ValueSats != 40_218 {
+		t.Fatalf("expected smallest-first fallback with change, got inputs %+v", plan.Inputs)
+	}
+}
+
+func TestBnBSearch(t *testing.T) {
+	cases := []struct {
+		values         []int64
+		target, window int64
+		want           []int
+	}{
+		{[]int64{10, 7, 5, 3}, 8, 0, []int{2, 3}},
+		{[]int64{10, 7, 5, 3}, 9, 1, []int{0}}, // Least excess wins
+		{[]int64{10, 7, 5, 3}, 11, 0, nil},     // No exact subset
+		{[]int64{4, 4, 4, 4, 4}, 12, 0, []int{0, 1, 2}},
+	}
+	for _, c := range cases {
+		got := bnbSearch(c.values, c.target, c.window, bnbMaxTries)
+		if len(got) != len(c.want) {
+			t.Fatalf("bnbSearch(%v, %d, %d) = %v, want %v", c.values, c.target, c.window, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("bnbSearch(%v, %d, %d) = %v, want %v", c.values, c.target, c.window, got, c.want)
+			}
+		}
+	}
+	// The search gives up after maxTries branches
+	if got := bnbSearch([]int64{10, 7, 5, 3}, 8, 0, 2); got != nil {
+		t.Fatalf("search ran past its bound: %v", got)
+	}
+}
+
+// Picks the last candidate, or returns a coin of its own making
+type lastSelector struct{ forge bool }
+
+func (l lastSelector) Select(candidates []UTXO, target int64, feeRate FeeRate) ([]UTXO, error) {
+	u := candidates[len(candidates)-1]
+	if l.forge {
+		u.ValueSats *= 10
+		u.Vout = 99
+	}
+	return []UTXO{u}, nil
+}
+
+func TestCustomCoinSelector(t *testing.T) {
+	s := newTestSweeper(t)
+	for i, v := range []int64{30_000, 40_000, 500_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 0, ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}
+
+	s.SetCoinSelector(lastSelector{})
+	plan, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 1 || plan.Inputs[0].ValueSats != 500_000 || plan.Settings.CoinSelector != "main.lastSelector" {
+		t.Fatalf("custom selector ignored: inputs %+v, settings %q", plan.Inputs, plan.Settings.CoinSelector)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	s.SetCoinSelector(lastSelector{forge: true})
+	if _, err := s.Spend(out); err == nil {
+		t.Fatalf("expected a coin outside the candidates to be refused")
+	}
+
+	s.SetCoinSelector(nil)
+	plan, err = s.Spend(out)
+	if err != nil || len(plan.Inputs) != 2 || plan.Settings.CoinSelector != "" {
+		t.Fatalf("default greedy selection not restored: %+v, %v", plan.Inputs, err)
+	}
+}
+
+func TestSelectionPricesMixedScriptTypes(t *testing.T) {
+	s := mustNewSweeper(t, make([]byte, 33), BitcoinMainnet)
+	wpkh := UTXO{ValueSats: 10_000, Address: tvBIP84Recv0}
+	tr := UTXO{ValueSats: 10_000, Address: tvBIP86Recv0}
+	if got, want := s.selectionVBytes([]UTXO{wpkh, tr}, 1), estimateTxVBytes(0, 1)+68+58; got != want {
+		t.Fatalf("selectionVBytes = %d, want %d", got, want)
+	}
+
+	// At 10 sat/vB a P2WPKH input nets 9_320 and a taproot one 9_420: the
+	// flat taproot size would wrongly accept the first coin alone
+	weigh := func(u UTXO) int64 { return inputVBytes(s, u) }
+	picked, err := GreedySelector{}.SelectWeighted([]UTXO{wpkh, tr}, 9_400, SatPerVByte(10), weigh)
+	if err != nil || len(picked) != 2 {
+		t.Fatalf("expected both inputs, got %+v, %v", picked, err)
+	}
+	if picked, _ := (GreedySelector{}).Select([]UTXO{wpkh, tr}, 9_400, SatPerVByte(10)); len(picked) != 1 {
+		t.Fatalf("flat pricing picked %d inputs", len(picked))
+	}
+	if picked, _ := (GreedySelector{}).SelectWeighted([]UTXO{tr, wpkh}, 9_400, SatPerVByte(10), weigh); len(picked) != 1 {
+		t.Fatalf("a taproot coin alone should cover the target, got %d inputs", len(picked))
+	}
+}
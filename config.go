@@ -3,40 +3,154 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 )
 
 // Config represents the configuration file structure.
 // It allows users to specify settings without hardcoding them in the program.
 type Config struct {
 	// Network settings
-	Network string `json:"network"` // "bitcoin_mainnet", "bitcoin_testnet", "litecoin_mainnet", "litecoin_testnet"
+	Network string `json:"network"` // "bitcoin_mainnet", "bitcoin_testnet", "bitcoin_regtest", "litecoin_mainnet", "litecoin_testnet"
 
 	// Fee settings
-	FeeRate int64 `json:"fee_rate"` // Fee rate in satoshis per virtual byte
+	FeeRate float64 `json:"fee_rate"` // Fee rate in satoshis per virtual byte; fractions such as 1.5 are kept to 0.001 sat/vB
+	// Outlier handling for provider fee rates: "clamp", "error" or "warn" (empty = off)
+	FeeGuardMode     string  `json:"fee_guard_mode,omitempty"`
+	FeeGuardMaxRatio float64 `json:"fee_guard_max_ratio,omitempty"` // Allowed deviation from the reference (0 = 3x)
+	FeeGuardWindow   int     `json:"fee_guard_window,omitempty"`    // Rates in the rolling median (0 = 12)
+	// Fee guards: relay floor in sat/vB (0 = 1), absolute cap and cap as a percentage of the amount sent (0 = unlimited)
+	MinRelayFeeRate float64 `json:"min_relay_fee_rate,omitempty"`
+	MaxFeeSats      int64   `json:"max_fee_sats,omitempty"`
+	MaxFeePercent   float64 `json:"max_fee_percent,omitempty"`
+	MaxFeeRate      float64 `json:"max_fee_rate,omitempty"` // Fee rate cap in sat/vB (0 = unlimited)
+	// Fee rate in sat/vB expected on average over time, for waste and consolidation choices (0 = unset)
+	LongTermFeeRate float64 `json:"long_term_fee_rate,omitempty"`
+	// Lowest sat/vB a plan and its unconfirmed ancestors must pay together (0 = fee_rate)
+	MinPackageFeeRate float64 `json:"min_package_fee_rate,omitempty"`
+	// Esplora/mempool.space API consulted for live fee rates, e.g. "https://mempool.space/api" (empty = fee_rate)
+	FeeProviderURL string `json:"fee_provider_url,omitempty"`
+	FeeConfTarget  int    `json:"fee_conf_target,omitempty"` // Blocks to confirm within (0 = 6)
+	// Price at this percentile of the next block from fee_provider_url's
+	// mempool histogram instead of its estimates (0 = off), clamped to the
+	// floor and ceiling in sat/vB (0 = 1 sat/vB floor, no ceiling)
+	FeePercentile        float64 `json:"fee_percentile,omitempty"`
+	FeePercentileFloor   float64 `json:"fee_percentile_floor,omitempty"`
+	FeePercentileCeiling float64 `json:"fee_percentile_ceiling,omitempty"`
 
 	// Dust filtering
 	DustThresholdUSD float64 `json:"dust_threshold_usd"` // Dust threshold in USD
 	PriceUSDPerBTC   float64 `json:"price_usd_per_btc"`  // BTC price for dust calculation
+	// Dust policy: "usd" (default, dust_threshold_usd), "fiat" (dust_threshold_fiat
+	// in fiat_currency) or "relay" (Bitcoin Core's relay rule)
+	DustPolicy       string `json:"dust_policy,omitempty"`
+	DustRelayFeeRate int64  `json:"dust_relay_fee_rate,omitempty"` // sat/kvB for the relay policy (0 = 3000)
+	// Fiat currency for the "fiat" dust policy and accounting exports (ISO 4217, default USD)
+	FiatCurrency      string  `json:"fiat_currency,omitempty"`
+	DustThresholdFiat float64 `json:"dust_threshold_fiat,omitempty"` // Dust threshold in fiat_currency
+	PriceFiatPerBTC   float64 `json:"price_fiat_per_btc,omitempty"`  // BTC price in fiat_currency
+	// mempool.space-compatible API the dust price is sampled from, e.g.
+	// "https://mempool.space/api" (empty = the static prices above)
+	PriceProviderURL string `json:"price_provider_url,omitempty"`
+	// How often the live price is sampled (Go duration, empty = 1h)
+	PriceRefreshInterval string `json:"price_refresh_interval,omitempty"`
+	// Smooth the dust price over this window (Go duration, e.g. "24h"; empty = spot price; needs price_provider_url)
+	DustPriceWindow string `json:"dust_price_window,omitempty"`
 
 	// Unconfirmed transaction handling
 	AllowUnconfirmed bool `json:"allow_unconfirmed"` // Whether to allow unconfirmed UTXOs
 	MaxUnconfirmed   int  `json:"max_unconfirmed"`   // Maximum unconfirmed inputs per transaction
 	MaxChainDepth    int  `json:"max_chain_depth"`   // Maximum unconfirmed transaction chain depth
+	// Maximum unconfirmed input value across pending plans (0 = unlimited)
+	MaxUnconfirmedExposureSats int64 `json:"max_unconfirmed_exposure_sats,omitempty"`
+	// Maximum value in unconfirmed plans to any one destination address (0 = unlimited)
+	MaxDestinationExposureSats int64 `json:"max_destination_exposure_sats,omitempty"`
+	// Recipients broadcast plans may pay (empty = any) and whether they must be approved first
+	DestinationAllowlist []string `json:"destination_allowlist,omitempty"`
+	// Smallest output each address accepts, e.g. exchange deposit minimums
+	DestinationMinimums map[string]int64 `json:"destination_minimums,omitempty"`
+	RequireApproval     bool             `json:"require_approval,omitempty"`
+
+	// Privacy
+	AddressReuseThreshold int `json:"address_reuse_threshold,omitempty"` // Received UTXOs that flag an address as reused (0 = default 3)
+
+	// Coin selection
+	Selection    string `json:"selection,omitempty"`      // Default order: "smallest-first" (default), "largest-first", "oldest-first", "branch-and-bound", "single-random-draw", "privacy"
+	TieBreak     string `json:"tie_break,omitempty"`      // Order of equal-value UTXOs: "fifo" (default), "oldest-first", "random"
+	TieBreakSeed int64  `json:"tie_break_seed,omitempty"` // Seed for "random"
+	// Order confirmed UTXOs before unconfirmed ones under any selection order
+	ConfirmedFirst bool `json:"confirmed_first,omitempty"`
+
+	// Transaction nVersion: 1, 2 (default) or 3 for TRUC (BIP-431) packages
+	TxVersion int32 `json:"tx_version,omitempty"`
 
 	// Change handling
 	ChangeSplitParts int   `json:"change_split_parts"` // Number of parts to split change into
 	TargetChunkSats  int64 `json:"target_chunk_sats"`  // Target size for change chunks
 	MinChunkSats     int64 `json:"min_chunk_sats"`     // Minimum size for change chunks
+	// Maximum recipient + change outputs per transaction (0 = unlimited)
+	MaxOutputsPerTx int `json:"max_outputs_per_tx,omitempty"`
+	// Inputs exceeding outputs plus the changeless fee by less than this pay it as fee instead of change
+	ChangelessToleranceSats int64 `json:"changeless_tolerance_sats,omitempty"`
+	// At or below this fee rate in sat/vB (fractions such as 1.5 are kept), spends also sweep in up to consolidate_max_extra_inputs spare coins
+	ConsolidateBelowFeeRate   float64 `json:"consolidate_below_fee_rate,omitempty"`
+	ConsolidateMaxExtraInputs int     `json:"consolidate_max_extra_inputs,omitempty"`
+	// Confirmed coins are held back until mature, by value tier
+	MaturityTiers []MaturityTierConfig `json:"maturity_tiers,omitempty"`
+	// Bounds on inputs per transaction (0 = no minimum / unlimited)
+	MinInputs int `json:"min_inputs,omitempty"`
+	MaxInputs int `json:"max_inputs,omitempty"`
 
 	// Output settings
-	OutputFormat string `json:"output_format"` // "human", "json"
+	OutputFormat string `json:"output_format"`           // "human", "json"
+	OutputCompat string `json:"output_compat,omitempty"` // JSON shape: "" (current) or "v1"
+	WebhookURL   string `json:"webhook_url,omitempty"`   // Receives plan lifecycle events as JSON POSTs
 
 	// Validation settings
 	TestMode      bool `json:"test_mode"`      // Skip strict address validation
 	EnforcePubKey bool `json:"enforce_pubkey"` // Enforce public key validation
+	// Refuse P2TR change until a signer proves it can spend the key (VerifyTaprootChangeKey)
+	RequireVerifiedChangeKey bool `json:"require_verified_change_key,omitempty"`
+	// Hex BIP-340 signature of the change-key-challenge by the taproot change key
+	ChangeKeyProof string `json:"change_key_proof,omitempty"`
+
+	// Threshold multisig wallet: wsh(sortedmulti(k,xpub,...)) descriptor
+	MultisigDescriptor string `json:"multisig_descriptor,omitempty"`
+	MultisigLookahead  int    `json:"multisig_lookahead,omitempty"` // Addresses derived per branch (0 = 20)
+	// Single-signature account xpub; the path defaults to 84'/86'/44' by script type
+	XPub            string `json:"xpub,omitempty"`
+	XPubScriptType  string `json:"xpub_script_type,omitempty"` // "p2wpkh" (default), "p2tr" or "p2pkh"
+	XPubFingerprint string `json:"xpub_fingerprint,omitempty"` // Master key fingerprint (8 hex characters)
+	XPubPath        string `json:"xpub_path,omitempty"`        // Origin path override, e.g. "m/84'/0'/1'"
+	XPubLookahead   int    `json:"xpub_lookahead,omitempty"`   // Addresses derived per branch (0 = 20)
+	// Cosigner public keys (hex, compressed) aggregated with MuSig2 into the taproot change key
+	MuSig2Participants []string `json:"musig2_participants,omitempty"`
+
+	// Persistence
+	KVPath string `json:"kv_path,omitempty"` // File-backed KV store path (empty = in-memory)
+
+	// Chain backend: an Esplora-compatible API (e.g. https://mempool.space/api)
+	BackendURL string `json:"backend_url,omitempty"`
+	// How often the daemon re-checks indexed UTXOs against the backend (Go duration, empty = never)
+	RevalidateInterval string `json:"revalidate_interval,omitempty"`
+	RevalidateBatch    int    `json:"revalidate_batch,omitempty"` // Addresses per pass (0 = all)
+	// Check the merkle proof and raw transaction of every confirmed UTXO before indexing it (needs backend_url)
+	VerifyInclusion bool `json:"verify_inclusion,omitempty"`
+	// Esplora-compatible API the proofs' block headers are read from (empty = backend_url)
+	HeadersURL string `json:"headers_url,omitempty"`
+
+	// Recurring sweeps
+	Templates []PlanTemplate `json:"templates,omitempty"` // Named plan templates
+
+	// Consolidation of several accounts into one destination (orchestrate command)
+	Orchestration *OrchestrationConfig `json:"orchestration,omitempty"`
+
+	// Daemon lifecycle
+	ShutdownTimeout string `json:"shutdown_timeout,omitempty"` // Max time to drain in-flight runs on SIGTERM (Go duration, default 25s)
 }
 
 // DefaultConfig returns a sensible default configuration.
@@ -105,16 +219,43 @@ func (c *Config) Validate() error {
 	validNetworks := map[string]bool{
 		"bitcoin_mainnet":  true,
 		"bitcoin_testnet":  true,
+		"bitcoin_regtest":  true,
 		"litecoin_mainnet": true,
 		"litecoin_testnet": true,
 	}
 	if !validNetworks[c.Network] {
-		return fmt.Errorf("invalid network '%s' - must be one of: bitcoin_mainnet, bitcoin_testnet, litecoin_mainnet, litecoin_testnet", c.Network)
+		return fmt.Errorf("invalid network '%s' - must be one of: bitcoin_mainnet, bitcoin_testnet, bitcoin_regtest, litecoin_mainnet, litecoin_testnet", c.Network)
 	}
 
 	// Validate fee rate
-	if c.FeeRate <= 0 {
-		return fmt.Errorf("fee_rate must be positive (got %d)", c.FeeRate)
+	if FeeRateFromSatPerVB(c.FeeRate) <= 0 {
+		return fmt.Errorf("fee_rate must be at least 0.001 sat/vB (got %g)", c.FeeRate)
+	}
+
+	if c.FeeGuardMode != "" {
+		if err := c.feeGuard().validate(); err != nil {
+			return fmt.Errorf("fee_guard: %w", err)
+		}
+	}
+
+	if c.MinRelayFeeRate < 0 || c.MaxFeeSats < 0 || c.MaxFeePercent < 0 || c.MinPackageFeeRate < 0 || c.LongTermFeeRate < 0 || c.MaxFeeRate < 0 {
+		return fmt.Errorf("min_relay_fee_rate, max_fee_sats, max_fee_percent, max_fee_rate, min_package_fee_rate and long_term_fee_rate must be non-negative (got %g, %d, %g, %g, %g, %g)", c.MinRelayFeeRate, c.MaxFeeSats, c.MaxFeePercent, c.MaxFeeRate, c.MinPackageFeeRate, c.LongTermFeeRate)
+	}
+	if c.FeeConfTarget < 0 {
+		return fmt.Errorf("fee_conf_target must be non-negative (got %d)", c.FeeConfTarget)
+	}
+	if c.FeeProviderURL != "" {
+		fp, err := NewEsploraFeeProvider(c.FeeProviderURL)
+		if err != nil {
+			return fmt.Errorf("fee_provider_url: %w", err)
+		}
+		if c.FeePercentile != 0 || c.FeePercentileFloor != 0 || c.FeePercentileCeiling != 0 {
+			if _, err := NewPercentileFeeStrategy(fp, c.FeePercentile, FeeRateFromSatPerVB(c.FeePercentileFloor), FeeRateFromSatPerVB(c.FeePercentileCeiling)); err != nil {
+				return fmt.Errorf("fee_percentile: %w", err)
+			}
+		}
+	} else if c.FeePercentile != 0 {
+		return fmt.Errorf("fee_percentile needs fee_provider_url for the mempool fee histogram")
 	}
 
 	// Validate dust threshold
@@ -122,6 +263,31 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("dust_threshold_usd must be non-negative (got %f)", c.DustThresholdUSD)
 	}
 
+	switch c.DustPolicy {
+	case "", "usd", "relay":
+	case "fiat":
+		p := FiatDustPolicy{MinFiat: c.DustThresholdFiat, PricePerBTC: c.PriceFiatPerBTC, Currency: c.FiatCurrency}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("dust_policy 'fiat': %w (set fiat_currency, dust_threshold_fiat and price_fiat_per_btc)", err)
+		}
+	default:
+		return fmt.Errorf("invalid dust_policy '%s' - must be 'usd', 'fiat' or 'relay'", c.DustPolicy)
+	}
+	if _, err := normalizeCurrency(c.FiatCurrency); err != nil {
+		return fmt.Errorf("fiat_currency: %w", err)
+	}
+	if w, err := c.dustPriceWindow(); err != nil {
+		return err
+	} else if w > 0 && c.PriceProviderURL == "" {
+		return errors.New("dust_price_window needs price_provider_url - static prices have nothing to smooth")
+	}
+	if _, _, err := c.priceProvider(); err != nil {
+		return err
+	}
+	if c.DustRelayFeeRate < 0 {
+		return fmt.Errorf("dust_relay_fee_rate must be non-negative (got %d)", c.DustRelayFeeRate)
+	}
+
 	// Validate BTC price
 	if c.PriceUSDPerBTC <= 0 {
 		return fmt.Errorf("price_usd_per_btc must be positive (got %f)", c.PriceUSDPerBTC)
@@ -134,6 +300,80 @@ func (c *Config) Validate() error {
 	if c.MaxChainDepth < 0 {
 		return fmt.Errorf("max_chain_depth must be non-negative (got %d)", c.MaxChainDepth)
 	}
+	if c.AddressReuseThreshold != 0 && c.AddressReuseThreshold < 2 {
+		return fmt.Errorf("address_reuse_threshold must be at least 2 (got %d)", c.AddressReuseThreshold)
+	}
+	if c.MaxUnconfirmedExposureSats < 0 {
+		return fmt.Errorf("max_unconfirmed_exposure_sats must be non-negative (got %d)", c.MaxUnconfirmedExposureSats)
+	}
+	if c.MaxDestinationExposureSats < 0 {
+		return fmt.Errorf("max_destination_exposure_sats must be non-negative (got %d)", c.MaxDestinationExposureSats)
+	}
+	for addr, min := range c.DestinationMinimums {
+		if addr == "" || min < 0 {
+			return fmt.Errorf("destination_minimums entries need an address and a non-negative amount (got %q: %d)", addr, min)
+		}
+	}
+
+	if c.Selection != "" {
+		if err := SelectionStrategy(c.Selection).validate(); err != nil {
+			return fmt.Errorf("selection: %w", err)
+		}
+	}
+	if err := TieBreak(c.TieBreak).validate(); err != nil {
+		return fmt.Errorf("tie_break: %w", err)
+	}
+
+	if c.ConsolidateBelowFeeRate < 0 || c.ConsolidateMaxExtraInputs < 0 {
+		return fmt.Errorf("consolidate_below_fee_rate and consolidate_max_extra_inputs must be non-negative (got %g, %d)", c.ConsolidateBelowFeeRate, c.ConsolidateMaxExtraInputs)
+	}
+	if c.ChangelessToleranceSats < 0 {
+		return fmt.Errorf("changeless_tolerance_sats must be non-negative (got %d)", c.ChangelessToleranceSats)
+	}
+	if c.MaxOutputsPerTx < 0 || c.MaxOutputsPerTx == 1 {
+		return fmt.Errorf("max_outputs_per_tx must be 0 (unlimited) or at least 2 (got %d)", c.MaxOutputsPerTx)
+	}
+
+	if err := validateInputCountLimits(c.MinInputs, c.MaxInputs); err != nil {
+		return fmt.Errorf("min_inputs/max_inputs: %w", err)
+	}
+	if _, err := c.maturityPolicy(); err != nil {
+		return err
+	}
+
+	if c.TxVersion != 0 {
+		if err := validateTxVersion(c.TxVersion); err != nil {
+			return fmt.Errorf("tx_version: %w", err)
+		}
+	}
+
+	if c.MultisigLookahead < 0 {
+		return fmt.Errorf("multisig_lookahead must be non-negative (got %d)", c.MultisigLookahead)
+	}
+	if c.MultisigDescriptor != "" {
+		if _, err := ParseMultisigDescriptor(c.MultisigDescriptor, c.ToNetwork()); err != nil {
+			return fmt.Errorf("multisig_descriptor: %w", err)
+		}
+	}
+	if c.XPubLookahead < 0 {
+		return fmt.Errorf("xpub_lookahead must be non-negative (got %d)", c.XPubLookahead)
+	}
+	if c.XPub != "" {
+		if c.MultisigDescriptor != "" || len(c.MuSig2Participants) > 0 {
+			return fmt.Errorf("xpub cannot be combined with multisig_descriptor or musig2_participants - configure one wallet type")
+		}
+		if _, err := c.xpubAccount(); err != nil {
+			return fmt.Errorf("xpub: %w", err)
+		}
+	}
+	if len(c.MuSig2Participants) > 0 {
+		if c.MultisigDescriptor != "" {
+			return fmt.Errorf("musig2_participants and multisig_descriptor both set change addresses - configure only one")
+		}
+		if _, err := ParseMuSig2Participants(c.MuSig2Participants); err != nil {
+			return fmt.Errorf("musig2_participants: %w", err)
+		}
+	}
 
 	// Validate change settings
 	if c.ChangeSplitParts < 1 {
@@ -154,10 +394,154 @@ func (c *Config) Validate() error {
 	if !validFormats[c.OutputFormat] {
 		return fmt.Errorf("invalid output_format '%s' - must be 'human' or 'json'", c.OutputFormat)
 	}
+	if err := validateCompat(c.OutputCompat); err != nil {
+		return fmt.Errorf("output_compat: %w", err)
+	}
+
+	// Validate shutdown timeout
+	if _, err := c.ShutdownDeadline(); err != nil {
+		return err
+	}
+
+	// Validate the chain backend
+	if _, err := c.Backend(); err != nil {
+		return err
+	}
+	if _, err := c.Revalidation(); err != nil {
+		return err
+	}
+	if _, err := c.headerSource(); err != nil {
+		return err
+	}
+
+	// The CLI has no signer to run VerifyTaprootChangeKey with
+	if _, err := c.changeKeyProof(); err != nil {
+		return err
+	}
+	if c.RequireVerifiedChangeKey && c.ChangeKeyProof == "" {
+		return errors.New("require_verified_change_key needs change_key_proof: sign the output of the change-key-challenge command with the taproot change key")
+	}
+
+	// Validate templates
+	seen := map[string]bool{}
+	for i := range c.Templates {
+		if err := c.Templates[i].Validate(); err != nil {
+			return fmt.Errorf("templates[%d]: %w", i, err)
+		}
+		if seen[c.Templates[i].Name] {
+			return fmt.Errorf("duplicate template name '%s'", c.Templates[i].Name)
+		}
+		seen[c.Templates[i].Name] = true
+	}
+
+	// Validate the orchestration section
+	if o := c.Orchestration; o != nil {
+		if err := o.Validate(); err != nil {
+			return fmt.Errorf("orchestration: %w", err)
+		}
+		for _, a := range o.Accounts {
+			if a.KVPath != "" && a.KVPath == c.KVPath {
+				return fmt.Errorf("orchestration: account %q shares kv_path with the top-level wallet", a.Name)
+			}
+		}
+	}
 
 	return nil
 }
 
+// defaultShutdownTimeout leaves headroom under Kubernetes' default 30s grace period.
+const defaultShutdownTimeout = 25 * time.Second
+
+// ShutdownDeadline returns how long daemon modes may spend draining on shutdown.
+func (c *Config) ShutdownDeadline() (time.Duration, error) {
+	if c.ShutdownTimeout == "" {
+		return defaultShutdownTimeout, nil
+	}
+	d, err := time.ParseDuration(c.ShutdownTimeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("shutdown_timeout must be a positive duration like \"25s\" (got %q)", c.ShutdownTimeout)
+	}
+	return d, nil
+}
+
+// Backend returns the configured chain backend, or nil without backend_url.
+func (c *Config) Backend() (*EsploraBackend, error) {
+	if c.BackendURL == "" {
+		return nil, nil
+	}
+	b, err := NewEsploraBackend(c.BackendURL)
+	if err != nil {
+		return nil, fmt.Errorf("backend_url: %w", err)
+	}
+	return b, nil
+}
+
+// Backend that serves the block headers inclusion proofs are checked
+// against, or nil without verify_inclusion
+func (c *Config) headerSource() (*EsploraBackend, error) {
+	if !c.VerifyInclusion {
+		if c.HeadersURL != "" {
+			return nil, errors.New("headers_url is only used with verify_inclusion")
+		}
+		return nil, nil
+	}
+	if c.BackendURL == "" {
+		return nil, errors.New("verify_inclusion needs backend_url to fetch proofs from")
+	}
+	url := c.HeadersURL
+	if url == "" {
+		url = c.BackendURL
+	}
+	b, err := NewEsploraBackend(url)
+	if err != nil {
+		return nil, fmt.Errorf("headers_url: %w", err)
+	}
+	return b, nil
+}
+
+// Revalidation returns how often the daemon re-validates the index (0 = never).
+func (c *Config) Revalidation() (time.Duration, error) {
+	if c.RevalidateBatch < 0 {
+		return 0, fmt.Errorf("revalidate_batch must be non-negative (got %d)", c.RevalidateBatch)
+	}
+	if c.RevalidateInterval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.RevalidateInterval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("revalidate_interval must be a positive duration like \"1h\" (got %q)", c.RevalidateInterval)
+	}
+	if c.BackendURL == "" {
+		return 0, fmt.Errorf("revalidate_interval needs backend_url to re-check UTXOs against")
+	}
+	return d, nil
+}
+
+// Decoded change_key_proof, or nil when unset
+func (c *Config) changeKeyProof() ([]byte, error) {
+	if c.ChangeKeyProof == "" {
+		return nil, nil
+	}
+	sig, err := hex.DecodeString(c.ChangeKeyProof)
+	if err != nil || len(sig) != 64 {
+		return nil, errors.New("change_key_proof must be a 64-byte BIP-340 signature in hex")
+	}
+	return sig, nil
+}
+
+// ApplyChangeKeyProof proves the sweeper's taproot change key with
+// change_key_proof, if set. Call it once the change key is final.
+func (c *Config) ApplyChangeKeyProof(s *Sweeper) error {
+	sig, err := c.changeKeyProof()
+	if err != nil || sig == nil {
+		return err
+	}
+	if err := s.ProveTaprootChangeKey(sig); err != nil {
+		return fmt.Errorf("change_key_proof: %w", err)
+	}
+	return nil
+}
+
 // ToNetwork converts the string network to the Network enum.
 func (c *Config) ToNetwork() Network {
 	switch c.Network {
@@ -165,6 +549,8 @@ func (c *Config) ToNetwork() Network {
 		return BitcoinMainnet
 	case "bitcoin_testnet":
 		return BitcoinTestnet
+	case "bitcoin_regtest":
+		return BitcoinRegtest
 	case "litecoin_mainnet":
 		return LitecoinMainnet
 	case "litecoin_testnet":
@@ -174,28 +560,356 @@ func (c *Config) ToNetwork() Network {
 	}
 }
 
+// Static prices from the config: USD, plus fiat_currency when priced
+func (c *Config) prices() StaticPrices {
+	p := StaticPrices{"USD": c.PriceUSDPerBTC}
+	if cur, err := normalizeCurrency(c.FiatCurrency); err == nil && c.PriceFiatPerBTC > 0 {
+		p[cur] = c.PriceFiatPerBTC
+	}
+	return p
+}
+
+// Fee guard described by the config
+func (c *Config) feeGuard() *FeeGuard {
+	return &FeeGuard{Mode: FeeGuardMode(c.FeeGuardMode), MaxRatio: c.FeeGuardMaxRatio, Window: c.FeeGuardWindow}
+}
+
+// Live dust price provider and refresh interval described by the config
+// (nil = static prices)
+func (c *Config) priceProvider() (PriceProvider, time.Duration, error) {
+	if c.PriceProviderURL == "" {
+		if c.PriceRefreshInterval != "" {
+			return nil, 0, errors.New("price_refresh_interval needs price_provider_url")
+		}
+		return nil, 0, nil
+	}
+	if c.DustPolicy == "relay" {
+		return nil, 0, errors.New("price_provider_url has no effect with dust_policy 'relay', which has no fiat price")
+	}
+	p, err := NewMempoolPriceProvider(c.PriceProviderURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("price_provider_url: %w", err)
+	}
+	var every time.Duration
+	if c.PriceRefreshInterval != "" {
+		if every, err = time.ParseDuration(c.PriceRefreshInterval); err != nil || every <= 0 {
+			return nil, 0, fmt.Errorf("price_refresh_interval must be a positive duration like \"1h\" (got %q)", c.PriceRefreshInterval)
+		}
+	}
+	return p, every, nil
+}
+
+// Dust price smoothing window (0 = off)
+func (c *Config) dustPriceWindow() (time.Duration, error) {
+	if c.DustPriceWindow == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.DustPriceWindow)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("dust_price_window must be a positive duration like \"24h\" (got %q)", c.DustPriceWindow)
+	}
+	return d, nil
+}
+
+// Maturity policy described by the config
+func (c *Config) maturityPolicy() ([]MaturityTier, error) {
+	tiers := make([]MaturityTier, 0, len(c.MaturityTiers))
+	for i, t := range c.MaturityTiers {
+		tier := MaturityTier{MinValueSats: t.MinValueSats, MinConfirmations: t.MinConfirmations}
+		if t.MinAge != "" {
+			d, err := time.ParseDuration(t.MinAge)
+			if err != nil {
+				return nil, fmt.Errorf("maturity_tiers[%d]: min_age must be a duration like \"30m\" (got %q)", i, t.MinAge)
+			}
+			tier.MinAge = d
+		}
+		tiers = append(tiers, tier)
+	}
+	return sortMaturityTiers(tiers)
+}
+
 // ApplyToSweeper applies the configuration to a Sweeper instance.
 func (c *Config) ApplyToSweeper(s *Sweeper) error {
 	// Set network
 	s.SetNetwork(c.ToNetwork())
 
 	// Set fee rate
-	if err := s.SetFeeRate(c.FeeRate); err != nil {
+	if err := s.SetFeeRateKVB(FeeRateFromSatPerVB(c.FeeRate)); err != nil {
 		return fmt.Errorf("failed to set fee rate: %w", err)
 	}
 
-	// Set dust rate
-	s.SetDustRate(int64(c.DustThresholdUSD*100), c.DustThresholdUSD, c.PriceUSDPerBTC)
+	if c.FeeGuardMode != "" {
+		if err := s.SetFeeGuard(c.feeGuard()); err != nil {
+			return err
+		}
+	}
+	if err := s.SetFeeLimits(0, c.MaxFeeSats, c.MaxFeePercent); err != nil {
+		return err
+	}
+	if err := s.SetMinRelayFeeRateKVB(FeeRateFromSatPerVB(c.MinRelayFeeRate)); err != nil {
+		return err
+	}
+	if err := s.SetMinPackageFeeRate(FeeRateFromSatPerVB(c.MinPackageFeeRate)); err != nil {
+		return err
+	}
+	if err := s.SetMaxFeeRate(FeeRateFromSatPerVB(c.MaxFeeRate)); err != nil {
+		return err
+	}
+	if err := s.SetLongTermFeeRate(FeeRateFromSatPerVB(c.LongTermFeeRate)); err != nil {
+		return err
+	}
+	if c.FeeProviderURL != "" {
+		fp, err := NewEsploraFeeProvider(c.FeeProviderURL)
+		if err != nil {
+			return fmt.Errorf("fee_provider_url: %w", err)
+		}
+		var provider FeeRateProvider = fp
+		if c.FeePercentile > 0 {
+			if provider, err = NewPercentileFeeStrategy(fp, c.FeePercentile, FeeRateFromSatPerVB(c.FeePercentileFloor), FeeRateFromSatPerVB(c.FeePercentileCeiling)); err != nil {
+				return fmt.Errorf("fee_percentile: %w", err)
+			}
+		}
+		if err := s.SetFeeRateProvider(provider, c.FeeConfTarget); err != nil {
+			return err
+		}
+	}
+
+	// Chain tip and mempool lookups go to the backend
+	backend, err := c.Backend()
+	if err != nil {
+		return err
+	}
+	if backend != nil {
+		s.SetChainInfo(backend)
+		s.SetMempoolSource(backend)
+	}
+	headers, err := c.headerSource()
+	if err != nil {
+		return err
+	}
+	if headers != nil {
+		if err := s.SetMerkleVerification(backend, headers); err != nil {
+			return err
+		}
+	}
+
+	// Set dust policy
+	if err := s.SetFiatCurrency(c.FiatCurrency); err != nil {
+		return err
+	}
+	switch c.DustPolicy {
+	case "relay":
+		if err := s.SetDustPolicy(RelayDustPolicy{DustRelayFeeRate: c.DustRelayFeeRate}); err != nil {
+			return err
+		}
+	case "fiat":
+		p := FiatDustPolicy{MinFiat: c.DustThresholdFiat, PricePerBTC: c.PriceFiatPerBTC, Currency: s.FiatCurrency()}
+		if err := s.SetDustPolicy(p); err != nil {
+			return err
+		}
+	default:
+		s.SetDustRate(int64(c.DustThresholdUSD*100), c.DustThresholdUSD, c.PriceUSDPerBTC)
+	}
+	if w, err := c.dustPriceWindow(); err != nil {
+		return err
+	} else if w > 0 {
+		s.SetDustPriceSmoothing(w)
+	}
+	if p, every, err := c.priceProvider(); err != nil {
+		return err
+	} else if p != nil {
+		if err := s.SetDustPriceProvider(p, every); err != nil {
+			return err
+		}
+	}
 
 	// Set unconfirmed policy
 	s.SetUnconfirmedPolicy(c.AllowUnconfirmed, c.MaxUnconfirmed, c.MaxChainDepth)
+	if err := s.SetMaxUnconfirmedExposure(c.MaxUnconfirmedExposureSats); err != nil {
+		return err
+	}
+	if err := s.SetMaxDestinationExposure(c.MaxDestinationExposureSats); err != nil {
+		return err
+	}
+	if err := s.SetDestinationAllowlist(c.DestinationAllowlist); err != nil {
+		return err
+	}
+	for addr, min := range c.DestinationMinimums {
+		if err := s.SetDestinationMinimum(addr, min); err != nil {
+			return err
+		}
+	}
+	s.SetRequireApproval(c.RequireApproval)
+
+	if c.AddressReuseThreshold > 0 {
+		if err := s.SetAddressReuseThreshold(c.AddressReuseThreshold); err != nil {
+			return err
+		}
+	}
+
+	if c.Selection != "" {
+		if err := s.SetSelectionStrategy(SelectionStrategy(c.Selection)); err != nil {
+			return err
+		}
+	}
+	if err := s.SetTieBreak(TieBreak(c.TieBreak), c.TieBreakSeed); err != nil {
+		return err
+	}
+	s.SetConfirmedFirst(c.ConfirmedFirst)
+
+	if c.TxVersion != 0 {
+		if err := s.SetTxVersion(c.TxVersion); err != nil {
+			return err
+		}
+	}
+	if err := s.SetMaxOutputsPerTx(c.MaxOutputsPerTx); err != nil {
+		return err
+	}
+	if err := s.SetChangelessTolerance(c.ChangelessToleranceSats); err != nil {
+		return err
+	}
+	if err := s.SetOpportunisticConsolidationKVB(FeeRateFromSatPerVB(c.ConsolidateBelowFeeRate), c.ConsolidateMaxExtraInputs); err != nil {
+		return err
+	}
+	if err := s.SetInputCountLimits(c.MinInputs, c.MaxInputs); err != nil {
+		return err
+	}
+	tiers, err := c.maturityPolicy()
+	if err != nil {
+		return err
+	}
+	if err := s.SetMaturityPolicy(tiers); err != nil {
+		return err
+	}
 
 	// Set test mode and pubkey check
 	s.SetTestMode(c.TestMode)
 	s.SetPubKeyCheck(c.EnforcePubKey)
+	s.SetRequireVerifiedChangeKey(c.RequireVerifiedChangeKey)
+
+	if c.MultisigDescriptor != "" {
+		acct, err := ParseMultisigDescriptor(c.MultisigDescriptor, c.ToNetwork())
+		if err != nil {
+			return fmt.Errorf("multisig_descriptor: %w", err)
+		}
+		if err := s.SetMultisigAccount(acct, c.MultisigLookahead); err != nil {
+			return fmt.Errorf("multisig_descriptor: %w", err)
+		}
+	}
+	if c.XPub != "" {
+		acct, err := c.xpubAccount()
+		if err != nil {
+			return fmt.Errorf("xpub: %w", err)
+		}
+		if err := s.SetXPubAccount(acct, c.XPubLookahead); err != nil {
+			return fmt.Errorf("xpub: %w", err)
+		}
+	}
+	if len(c.MuSig2Participants) > 0 {
+		k, err := ParseMuSig2Participants(c.MuSig2Participants)
+		if err != nil {
+			return fmt.Errorf("musig2_participants: %w", err)
+		}
+		if err := s.SetMuSig2ChangeKey(k.Participants); err != nil {
+			return fmt.Errorf("musig2_participants: %w", err)
+		}
+		if err := c.ApplyChangeKeyProof(s); err != nil {
+			return err
+		}
+	}
+
+	if c.WebhookURL != "" {
+		if err := s.SetWebhook(&Webhook{URL: c.WebhookURL}); err != nil {
+			return err
+		}
+	}
 
 	// Set change split
 	s.SetChangeSplit(c.ChangeSplitParts, c.TargetChunkSats, c.MinChunkSats)
 
+	// Use durable storage when configured
+	if c.KVPath != "" {
+		kv, err := OpenFileKV(c.KVPath)
+		if err != nil {
+			return err
+		}
+		s.SetKV(kv)
+		if _, err := s.Migrate(); err != nil {
+			return fmt.Errorf("failed to migrate '%s': %w", c.KVPath, err)
+		}
+		if err := s.LoadPlans(); err != nil {
+			return fmt.Errorf("failed to load plans from '%s': %w", c.KVPath, err)
+		}
+	}
+
+	// Store templates so they can be run by name
+	for _, t := range c.Templates {
+		if err := s.SaveTemplate(t); err != nil {
+			return fmt.Errorf("failed to store template '%s': %w", t.Name, err)
+		}
+	}
+
 	return nil
 }
+
+// Orchestrator builds the orchestrator described by the orchestration
+// section. Each account's sweeper is created with opts and configured like
+// the top-level one, with the account's key, xpub and store in place of the
+// top-level wallet's. Coins are not indexed: load each account's utxo_file
+// into its sweeper before planning.
+func (c *Config) Orchestrator(opts ...Option) (*ConsolidationOrchestrator, error) {
+	o := c.Orchestration
+	if o == nil {
+		return nil, errors.New("no orchestration section in the config")
+	}
+	spacing, err := o.spacing()
+	if err != nil {
+		return nil, fmt.Errorf("orchestration: %w", err)
+	}
+	orch := &ConsolidationOrchestrator{
+		Destination:   o.Destination,
+		FeeRateKVB:    FeeRateFromSatPerVB(o.FeeRate),
+		FeeBudgetSats: o.FeeBudgetSats,
+		MaxWeight:     o.MaxWeight,
+		Spacing:       spacing,
+	}
+	for _, a := range o.Accounts {
+		s, err := c.orchestratedSweeper(a, opts)
+		if err != nil {
+			for _, done := range orch.Accounts {
+				done.Sweeper.Close()
+			}
+			return nil, fmt.Errorf("orchestration account %s: %w", a.Name, err)
+		}
+		orch.Accounts = append(orch.Accounts, ConsolidationAccount{Name: a.Name, Sweeper: s})
+	}
+	return orch, nil
+}
+
+// Sweeper for an orchestrated account: the top-level settings with the
+// account's key, xpub and store, and without the top-level wallet's multisig
+// descriptor, MuSig2 change key or templates
+func (c *Config) orchestratedSweeper(a OrchestrationAccountConfig, opts []Option) (*Sweeper, error) {
+	pub, err := a.pubKey()
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSweeper(pub, c.ToNetwork(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	profile := *c
+	profile.XPub, profile.KVPath = a.XPub, a.KVPath
+	profile.MultisigDescriptor, profile.MuSig2Participants, profile.ChangeKeyProof = "", nil, ""
+	profile.Templates, profile.Orchestration = nil, nil
+	if err := profile.ApplyToSweeper(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Build the xpub account described by the config
+func (c *Config) xpubAccount() (*XPubAccount, error) {
+	return NewXPubAccount(c.XPub, ScriptType(c.XPubScriptType), c.XPubFingerprint, c.XPubPath, c.ToNetwork())
+}
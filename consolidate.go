@@ -0,0 +1,212 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains consolidation across several destinations with per-destination caps.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxStandardTxVBytes is the largest transaction relayed by default policy
+// (400,000 weight units).
+const maxStandardTxVBytes = 100_000
+
+// ConsolidateToMany sweeps all spendable UTXOs across several destinations,
+// spreading proceeds evenly while never sending more than capSats to any one
+// address (capSats <= 0 disables the cap). When the inputs do not fit in one
+// standard-size transaction the sweep is split into several plans, and caps
+// apply to the total each destination receives across all of them.
+func (s *Sweeper) ConsolidateToMany(destAddrs []string, capSats int64) ([]*TransactionPlan, error) {
+	defer s.templateScope()()
+	if len(destAddrs) == 0 {
+		return nil, errors.New("no destination addresses")
+	}
+	if s.maxOutputsPerTx > 0 && len(destAddrs) > s.maxOutputsPerTx {
+		return nil, fmt.Errorf("%d destinations exceed the limit of %d outputs per transaction", len(destAddrs), s.maxOutputsPerTx)
+	}
+	seen := map[string]bool{}
+	for i, a := range destAddrs {
+		if seen[a] {
+			return nil, fmt.Errorf("duplicate destination address at index %d", i)
+		}
+		seen[a] = true
+		if !s.testMode {
+			dec, err := s.decodeDestination(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid destination address at index %d: %w", i, err)
+			}
+			if err := s.checkAddressNetwork(a, dec); err != nil {
+				return nil, fmt.Errorf("destination address at index %d: %w", i, err)
+			}
+		}
+	}
+	if _, err := s.reloadUTXOLocks(); err != nil {
+		return nil, err
+	}
+	p := s.defaultSpendParams()
+	// The proceeds must at least fund the destination with the lowest threshold
+	dust := s.dustFor(destAddrs[0], p)
+	for _, a := range destAddrs[1:] {
+		if d := s.dustFor(a, p); d < dust {
+			dust = d
+		}
+	}
+	cands := s.filterUTXOs(s.indexedUTXOs, p)
+	if len(cands) == 0 {
+		return nil, errors.New("no spendable UTXOs to consolidate")
+	}
+	if len(cands) < s.minInputs {
+		return nil, s.inputCountError(len(cands), fmt.Sprintf("only %d spendable UTXOs are available", len(cands)))
+	}
+
+	// Partition inputs into groups that fit a standard transaction
+	fullOuts := make([]TxOutput, len(destAddrs))
+	for i, a := range destAddrs {
+		fullOuts[i] = TxOutput{Address: a}
+	}
+	overhead := estimateTxVBytesDetailed(s, nil, nil)
+	withOuts := estimateTxVBytesDetailed(s, nil, fullOuts)
+	var groups [][]UTXO
+	var cur []UTXO
+	curVB := withOuts
+	for _, u := range cands {
+		inVB := estimateTxVBytesDetailed(s, []UTXO{u}, nil) - overhead
+		full := s.maxInputs > 0 && len(cur) >= s.maxInputs
+		if len(cur) > 0 && (curVB+inVB > maxStandardTxVBytes || full) {
+			groups = append(groups, cur)
+			cur, curVB = nil, withOuts
+		}
+		cur = append(cur, u)
+		curVB += inVB
+	}
+	groups = append(groups, cur)
+
+	// Remaining capacity per destination across all transactions
+	remaining := make([]int64, len(destAddrs))
+	for i := range remaining {
+		remaining[i] = capSats
+	}
+
+	type draft struct {
+		inputs  []UTXO
+		outputs []TxOutput
+		fee     int64
+	}
+	drafts := make([]draft, 0, len(groups))
+	for gi, g := range groups {
+		totalIn := int64(0)
+		for _, u := range g {
+			totalIn += u.ValueSats
+		}
+		// Allocate, then drop sub-dust outputs and re-price until stable
+		active := make([]bool, len(destAddrs))
+		for i := range active {
+			active[i] = capSats <= 0 || remaining[i] > 0
+		}
+		var outs []TxOutput
+		var fee int64
+		for {
+			outs = outs[:0]
+			for i, a := range destAddrs {
+				if active[i] {
+					outs = append(outs, TxOutput{Address: a})
+				}
+			}
+			if len(outs) == 0 {
+				return nil, fmt.Errorf("proceeds exceed the combined destination caps (%d sats per address)", capSats)
+			}
+			vb := estimateTxVBytesDetailed(s, g, outs)
+			var err error
+			if fee, err = s.packageFee(g, vb, s.feeRate.Fee(vb), s.feeRate); err != nil {
+				return nil, err
+			}
+			net := totalIn - fee
+			if net < dust {
+				return nil, fmt.Errorf("transaction %d: balance too low after fees for consolidation", gi+1)
+			}
+			shares, ok := capFill(net, active, remaining, capSats)
+			if !ok {
+				return nil, fmt.Errorf("proceeds exceed the combined destination caps (%d sats per address)", capSats)
+			}
+			dropped := false
+			outs = outs[:0]
+			for i, a := range destAddrs {
+				if !active[i] {
+					continue
+				}
+				if shares[i] < s.dustFor(a, p) {
+					active[i] = false
+					dropped = true
+					continue
+				}
+				outs = append(outs, TxOutput{Address: a, ValueSats: shares[i]})
+			}
+			if !dropped {
+				for i := range destAddrs {
+					if active[i] && capSats > 0 {
+						remaining[i] -= shares[i]
+					}
+				}
+				break
+			}
+		}
+		drafts = append(drafts, draft{inputs: g, outputs: append([]TxOutput(nil), outs...), fee: fee})
+	}
+
+	plans := make([]*TransactionPlan, 0, len(drafts))
+	for _, d := range drafts {
+		p, err := s.assemblePlan(d.inputs, d.outputs, d.fee, nil, s.defaultSpendParams())
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// capFill splits total evenly across active destinations without exceeding
+// their remaining capacity, redistributing what capped destinations cannot take.
+// It reports false when the total does not fit.
+func capFill(total int64, active []bool, remaining []int64, capSats int64) ([]int64, bool) {
+	shares := make([]int64, len(active))
+	open := make([]bool, len(active))
+	copy(open, active)
+	left := total
+	for left > 0 {
+		n := 0
+		for _, o := range open {
+			if o {
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, false
+		}
+		each := left / int64(n)
+		extra := left % int64(n)
+		progressed := false
+		for i := range open {
+			if !open[i] {
+				continue
+			}
+			want := each
+			if extra > 0 {
+				want++
+				extra--
+			}
+			if capSats > 0 && shares[i]+want >= remaining[i] {
+				want = remaining[i] - shares[i]
+				open[i] = false
+			}
+			if want > 0 {
+				progressed = true
+			}
+			shares[i] += want
+			left -= want
+		}
+		if !progressed && left > 0 {
+			return nil, false
+		}
+	}
+	return shares, true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConsolidateToManyRespectsCaps(t *testing.T) {
+	s := newTestSweeper(t)
+	for i := 0; i < 5; i++ {
+		_ = s.Index(UTXO{TxID: fmt.Sprintf("%064x", i+1), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	}
+	plans, err := s.ConsolidateToMany([]string{testAddr("coldA"), testAddr("coldB"), testAddr("coldC")}, 200_000)
+	if err != nil {
+		t.Fatalf("ConsolidateToMany: %v", err)
+	}
+	if len(plans) != 1 {
+		t.Fatalf("expected a single transaction, got %d", len(plans))
+	}
+	var out int64
+	for _, o := range plans[0].Outputs {
+		if o.ValueSats > 200_000 {
+			t.Fatalf("output %s exceeds cap: %d", o.Address, o.ValueSats)
+		}
+		out += o.ValueSats
+	}
+	if out+plans[0].FeeSats != 500_000 {
+		t.Fatalf("value not conserved: out %d + fee %d", out, plans[0].FeeSats)
+	}
+
+	if _, err := s.ConsolidateToMany([]string{testAddr("coldA"), testAddr("coldB")}, 200_000); err == nil {
+		t.Fatalf("expected error when proceeds exceed combined caps")
+	}
+}
+
+func TestConsolidateToManySplitsOversizedSweeps(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(false, 0, 2)
+	// 68 vB per test-mode input: 2000 inputs need two standard transactions
+	for i := 0; i < 2000; i++ {
+		_ = s.Index(UTXO{TxID: fmt.Sprintf("%064x", i+1), Vout: 0, ValueSats: 10_000, Address: testAddr("in"), Confirmed: true})
+	}
+	plans, err := s.ConsolidateToMany([]string{testAddr("coldA"), testAddr("coldB")}, 0)
+	if err != nil {
+		t.Fatalf("ConsolidateToMany: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(plans))
+	}
+	inputs := 0
+	for _, p := range plans {
+		inputs += len(p.Inputs)
+		if v := estimateTxVBytesDetailed(s, p.Inputs, p.Outputs); v > maxStandardTxVBytes {
+			t.Fatalf("plan %s is %d vB, above the standard limit", p.ID, v)
+		}
+	}
+	if inputs != 2000 {
+		t.Fatalf("expected all inputs to be swept, got %d", inputs)
+	}
+}
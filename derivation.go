@@ -0,0 +1,289 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains persisted receive/change derivation counters.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// casRetries bounds how often a counter update is retried after losing a race.
+const casRetries = 8
+
+// DerivationCounter is the persisted next-unused index of one receive or
+// change chain of the configured multisig or xpub account. Indices are
+// reserved by compare-and-swap in the KV store, so none is handed out twice
+// across restarts or concurrent sweepers sharing the store.
+type DerivationCounter struct {
+	s   *Sweeper
+	key []byte
+}
+
+// DerivationCounter returns the counter of the account's receive (change=false)
+// or change chain.
+func (s *Sweeper) DerivationCounter(change bool) (*DerivationCounter, error) {
+	id, err := s.walletID()
+	if err != nil {
+		return nil, err
+	}
+	chain := "receive"
+	if change {
+		chain = "change"
+	}
+	return &DerivationCounter{s: s, key: []byte("derivation:" + id + ":" + chain)}, nil
+}
+
+// Peek returns the next index that would be reserved.
+func (c *DerivationCounter) Peek() (uint32, error) {
+	n, _, err := c.load()
+	return n, err
+}
+
+// AdvanceTo moves the counter forward so the next reserved index is at least
+// index, e.g. after restoring a wallet whose addresses were handed out
+// elsewhere. The counter never moves backwards; an index below it is refused.
+func (c *DerivationCounter) AdvanceTo(index uint32) error {
+	for i := 0; i < casRetries; i++ {
+		cur, raw, err := c.load()
+		if err != nil {
+			return err
+		}
+		if index < cur {
+			return fmt.Errorf("counter is already at %d - derivation indices cannot be reused", cur)
+		}
+		if index == cur {
+			return nil
+		}
+		ok, err := c.swap(raw, index)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("derivation counter is being updated concurrently - retry")
+}
+
+// reserve durably claims the first index at or above the counter for which
+// skip is false and advances the counter past it
+func (c *DerivationCounter) reserve(skip func(uint32) bool) (uint32, error) {
+	for i := 0; i < casRetries; i++ {
+		cur, raw, err := c.load()
+		if err != nil {
+			return 0, err
+		}
+		idx := cur
+		for skip != nil && skip(idx) {
+			idx++
+		}
+		ok, err := c.swap(raw, idx+1)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return idx, nil
+		}
+	}
+	return 0, errors.New("derivation counter is being updated concurrently - retry")
+}
+
+// claim durably reserves index, which was peeked earlier, and advances the
+// counter past it; it fails if another plan or sweeper reserved it meanwhile
+func (c *DerivationCounter) claim(index uint32) error {
+	for i := 0; i < casRetries; i++ {
+		cur, raw, err := c.load()
+		if err != nil {
+			return err
+		}
+		if index < cur {
+			return fmt.Errorf("index %d was reserved concurrently (counter at %d) - plan again", index, cur)
+		}
+		ok, err := c.swap(raw, index+1)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("derivation counter is being updated concurrently - retry")
+}
+
+// Current counter value and its raw stored form (nil when unset)
+func (c *DerivationCounter) load() (uint32, []byte, error) {
+	if c.s.kv == nil {
+		return 0, nil, errors.New("no KV store configured for derivation counters")
+	}
+	raw, err := c.s.kv.Get(c.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil, nil // Not stored yet
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not read derivation counter %s: %w", c.key, err)
+	}
+	n, err := strconv.ParseUint(string(raw), 10, 32)
+	if err != nil {
+		return 0, nil, fmt.Errorf("corrupt derivation counter %s: %w", c.key, err)
+	}
+	return uint32(n), raw, nil
+}
+
+// Compare-and-swap the counter from raw to next
+func (c *DerivationCounter) swap(raw []byte, next uint32) (bool, error) {
+	cas, ok := c.s.kv.(KVCompareAndSwapper)
+	if !ok {
+		return false, errors.New("KV store cannot update derivation counters atomically - use a store implementing CompareAndSwap")
+	}
+	swapped, err := cas.CompareAndSwap(c.key, raw, []byte(strconv.FormatUint(uint64(next), 10)))
+	if err != nil {
+		return false, fmt.Errorf("could not persist derivation counter: %w", err)
+	}
+	return swapped, nil
+}
+
+// Stable identifier of the configured account: its first receive address
+func (s *Sweeper) walletID() (string, error) {
+	switch {
+	case s.multisig != nil:
+		ms, err := s.multisig.derive(false, 0)
+		if err != nil {
+			return "", err
+		}
+		return ms.Address, nil
+	case s.account != nil:
+		return s.account.Address(false, 0)
+	}
+	return "", errors.New("no multisig or xpub account configured")
+}
+
+// Reserve the next index of a chain, skipping addresses already in use
+func (s *Sweeper) reserveIndex(change bool, address func(uint32) (string, error)) (uint32, string, error) {
+	c, err := s.DerivationCounter(change)
+	if err != nil {
+		return 0, "", err
+	}
+	return s.reserveFrom(c, address)
+}
+
+// Reserve the next index of a counter, skipping addresses already in use
+func (s *Sweeper) reserveFrom(c *DerivationCounter, address func(uint32) (string, error)) (uint32, string, error) {
+	used := s.usedAddresses()
+	var derr error
+	idx, err := c.reserve(func(i uint32) bool {
+		addr, err := address(i)
+		if err != nil {
+			derr = err
+			return false
+		}
+		return used[addr]
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("refusing to derive an address: %w", err)
+	}
+	if derr != nil {
+		return 0, "", derr
+	}
+	addr, err := address(idx)
+	return idx, addr, err
+}
+
+// First index at or above a chain's counter whose address is not in use,
+// without reserving it
+func (s *Sweeper) peekIndex(change bool, address func(uint32) (string, error)) (uint32, string, error) {
+	c, err := s.DerivationCounter(change)
+	if err != nil {
+		return 0, "", err
+	}
+	idx, err := c.Peek()
+	if err != nil {
+		return 0, "", fmt.Errorf("refusing to derive an address: %w", err)
+	}
+	used := s.usedAddresses()
+	for {
+		addr, err := address(idx)
+		if err != nil {
+			return 0, "", err
+		}
+		if !used[addr] {
+			return idx, addr, nil
+		}
+		idx++
+	}
+}
+
+// Reserve the account change indices a plan pays once it is tracked. Planning
+// only peeks at the change counter, so read-only callers, failed plans and
+// changeless plans leave it alone.
+func (s *Sweeper) claimChangeIndices(plan *TransactionPlan) error {
+	claimed := map[uint32]bool{}
+	for _, ch := range plan.Change {
+		idx, ok := s.changeIndexOf(ch.Address)
+		if !ok || claimed[idx] {
+			continue
+		}
+		c, err := s.DerivationCounter(true)
+		if err != nil {
+			return err
+		}
+		if err := c.claim(idx); err != nil {
+			return fmt.Errorf("change address %s: %w", ch.Address, err)
+		}
+		claimed[idx] = true
+	}
+	return nil
+}
+
+// Index of addr on the change chain of the configured account
+func (s *Sweeper) changeIndexOf(addr string) (uint32, bool) {
+	if ms := s.multisigScripts[addr]; s.multisig != nil && ms != nil && ms.Change {
+		return ms.Index, true
+	}
+	if k := s.accountKeys[addr]; s.account != nil && k != nil && k.Change {
+		return k.Index, true
+	}
+	return 0, false
+}
+
+// Derive each chain of the configured account up to lookahead past its
+// persisted counter, so addresses handed out before a restart are recognized
+func (s *Sweeper) deriveToCounters(lookahead int, address func(change bool, i uint32) (string, error)) error {
+	if s.kv == nil {
+		return nil
+	}
+	for _, change := range []bool{false, true} {
+		c, err := s.DerivationCounter(change)
+		if err != nil {
+			return err
+		}
+		n, err := c.Peek()
+		if err != nil {
+			return err
+		}
+		for i := uint64(lookahead); i < uint64(n)+uint64(lookahead); i++ {
+			if _, err := address(change, uint32(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NextReceiveAddress reserves and returns the next receive address of the
+// configured multisig or xpub account.
+func (s *Sweeper) NextReceiveAddress() (string, error) {
+	switch {
+	case s.multisig != nil:
+		_, addr, err := s.reserveIndex(false, func(i uint32) (string, error) {
+			return s.multisigAddress(false, i)
+		})
+		return addr, err
+	case s.account != nil:
+		_, addr, err := s.reserveIndex(false, func(i uint32) (string, error) {
+			return s.accountAddress(false, i)
+		})
+		return addr, err
+	}
+	return "", errors.New("no multisig or xpub account configured")
+}
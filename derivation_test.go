@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// KV without compare-and-swap support
+type plainKV struct{ KV }
+
+// Sweeper with the BIP-84 test account on the given store
+func accountSweeper(t *testing.T, kv KV) (*Sweeper, *XPubAccount) {
+	t.Helper()
+	a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount: %v", err)
+	}
+	recv, _ := a.derive(false, 0)
+	s := mustNewSweeper(t, recv.PubKey, BitcoinMainnet, WithKV(kv))
+	if err := s.SetXPubAccount(a, 5); err != nil {
+		t.Fatalf("SetXPubAccount: %v", err)
+	}
+	return s, a
+}
+
+func TestDerivationCounterSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.json")
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("OpenFileKV: %v", err)
+	}
+	s, a := accountSweeper(t, kv)
+	for i := uint32(0); i < 2; i++ {
+		addr, err := s.NextReceiveAddress()
+		if err != nil {
+			t.Fatalf("NextReceiveAddress: %v", err)
+		}
+		if want, _ := a.Address(false, i); addr != want {
+			t.Fatalf("receive %d = %s, want %s", i, addr, want)
+		}
+	}
+	if err := kv.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	kv2, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s2, _ := accountSweeper(t, kv2)
+	addr, err := s2.NextReceiveAddress()
+	if want, _ := a.Address(false, 2); err != nil || addr != want {
+		t.Fatalf("after restart got %s (%v), want %s", addr, err, want)
+	}
+	change, _ := s2.DerivationCounter(true)
+	if n, _ := change.Peek(); n != 0 {
+		t.Fatalf("change counter moved with the receive chain: %d", n)
+	}
+}
+
+func TestDerivationCounterAdvanceTo(t *testing.T) {
+	s, a := accountSweeper(t, NewMemKV())
+	c, err := s.DerivationCounter(false)
+	if err != nil {
+		t.Fatalf("DerivationCounter: %v", err)
+	}
+	if err := c.AdvanceTo(10); err != nil {
+		t.Fatalf("AdvanceTo: %v", err)
+	}
+	if err := c.AdvanceTo(10); err != nil {
+		t.Fatalf("AdvanceTo the current index should be a no-op: %v", err)
+	}
+	if err := c.AdvanceTo(3); err == nil {
+		t.Fatalf("expected moving the counter backwards to be refused")
+	}
+	addr, _ := s.NextReceiveAddress()
+	if want, _ := a.Address(false, 10); addr != want {
+		t.Fatalf("got %s, want index 10 address %s", addr, want)
+	}
+	if n, _ := c.Peek(); n != 11 {
+		t.Fatalf("counter at %d, want 11", n)
+	}
+}
+
+func TestDerivationSkipsUsedAddresses(t *testing.T) {
+	s, a := accountSweeper(t, NewMemKV())
+	s.SetPubKeyCheck(false)
+	used, _ := a.Address(true, 0)
+	if err := s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 50_000, Address: used, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	addr, err := s.nextAccountChange()
+	if want, _ := a.Address(true, 1); err != nil || addr != want {
+		t.Fatalf("got %s (%v), want change 1 %s", addr, err, want)
+	}
+	// Looking at the change address reserves nothing; tracking a plan that
+	// pays it does
+	c, _ := s.DerivationCounter(true)
+	if n, _ := c.Peek(); n != 0 {
+		t.Fatalf("counter at %d after a peek, want 0", n)
+	}
+	dest, _ := a.Address(false, 3)
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 20_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Change) != 1 || plan.Change[0].Address != addr {
+		t.Fatalf("expected change to %s, got %+v", addr, plan.Change)
+	}
+	if n, _ := c.Peek(); n != 2 {
+		t.Fatalf("counter at %d, want 2", n)
+	}
+	// Another sweeper on the store reserved the peeked index first
+	if err := c.claim(1); err == nil {
+		t.Fatalf("expected a reserved index to be refused")
+	}
+}
+
+// KV whose reads fail
+type failingGetKV struct{ KV }
+
+func (failingGetKV) Get([]byte) ([]byte, error) { return nil, errors.New("disk error") }
+
+func TestDerivationFollowsPersistedCounter(t *testing.T) {
+	kv := NewMemKV()
+	s, a := accountSweeper(t, kv)
+	c, _ := s.DerivationCounter(false)
+	if err := c.AdvanceTo(30); err != nil {
+		t.Fatalf("AdvanceTo: %v", err)
+	}
+	// A restarted sweeper recognizes the addresses handed out before
+	s2, _ := accountSweeper(t, kv)
+	if addr, _ := a.Address(false, 34); s2.accountKeys[addr] == nil {
+		t.Fatalf("expected the lookahead to extend past the persisted counter")
+	}
+	if addr, _ := a.Address(false, 35); s2.accountKeys[addr] != nil {
+		t.Fatalf("derived past counter plus lookahead")
+	}
+
+	// A failed read is not an unset counter
+	recv, _ := a.derive(false, 0)
+	s3 := mustNewSweeper(t, recv.PubKey, BitcoinMainnet, WithKV(failingGetKV{kv}))
+	if err := s3.SetXPubAccount(a, 5); err == nil || !strings.Contains(err.Error(), "disk error") {
+		t.Fatalf("expected the read failure to be reported, got %v", err)
+	}
+}
+
+func TestDerivationRefusedWithoutCAS(t *testing.T) {
+	s, _ := accountSweeper(t, plainKV{NewMemKV()})
+	if _, err := s.NextReceiveAddress(); err == nil || !strings.Contains(err.Error(), "CompareAndSwap") {
+		t.Fatalf("expected derivation to be refused, got %v", err)
+	}
+	if _, err := newTestSweeper(t).NextReceiveAddress(); err == nil {
+		t.Fatalf("expected an error without an account")
+	}
+}
@@ -0,0 +1,228 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains sweeping to the next unused address of a wildcard descriptor.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DestinationDescriptor is a ranged single-key output descriptor such as a
+// cold wallet's wpkh([d34db33f/84h/0h/0h]xpub.../0/*). Each recurring sweep
+// pays the next unused index, so the cold wallet never sees an address twice.
+type DestinationDescriptor struct {
+	Descriptor  string // As given, without the checksum
+	ScriptType  ScriptType
+	XPub        *ExtendedPubKey
+	Fingerprint [4]byte  // Master key fingerprint (the xpub's own without an origin)
+	Path        []uint32 // Origin path from the master key to XPub
+	Steps       []uint32 // Non-hardened steps between XPub and the wildcard
+	Network     Network
+}
+
+// DescriptorDestination records which index of a descriptor a plan paid.
+type DescriptorDestination struct {
+	Descriptor string `json:"descriptor"`
+	Index      uint32 `json:"index"`
+	Address    string `json:"address"`
+}
+
+// Script functions accepted for destination descriptors
+var destinationScripts = map[string]ScriptType{
+	"wpkh": ScriptP2WPKH,
+	"tr":   ScriptP2TR,
+	"pkh":  ScriptP2PKH,
+}
+
+// IsDescriptor reports whether a destination is written as a descriptor
+// rather than an address.
+func IsDescriptor(dest string) bool {
+	return strings.Contains(dest, "(")
+}
+
+// ParseDestinationDescriptor parses wpkh(KEY), tr(KEY) or pkh(KEY) with an
+// optional #checksum, where KEY is an optional [fingerprint/path] origin, an
+// xpub and a non-hardened path ending in the /* wildcard.
+func ParseDestinationDescriptor(desc string, network Network) (*DestinationDescriptor, error) {
+	desc = strings.TrimSpace(desc)
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		want, err := descriptorChecksum(desc[:i])
+		if err != nil {
+			return nil, err
+		}
+		if desc[i+1:] != want {
+			return nil, fmt.Errorf("descriptor checksum %q does not match (want %s)", desc[i+1:], want)
+		}
+		desc = desc[:i]
+	}
+	open := strings.IndexByte(desc, '(')
+	if open < 0 || !strings.HasSuffix(desc, ")") {
+		return nil, fmt.Errorf("invalid descriptor %q - use wpkh(KEY/0/*), tr(KEY/0/*) or pkh(KEY/0/*)", desc)
+	}
+	st, ok := destinationScripts[desc[:open]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported destination descriptor %s() - use wpkh, tr or pkh", desc[:open])
+	}
+	d := &DestinationDescriptor{Descriptor: desc, ScriptType: st, Network: network}
+	key := desc[open+1 : len(desc)-1]
+	hasOrigin := strings.HasPrefix(key, "[")
+	if hasOrigin {
+		end := strings.IndexByte(key, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated key origin in %q", key)
+		}
+		origin := strings.Split(key[1:end], "/")
+		fp, err := hex.DecodeString(origin[0])
+		if err != nil || len(fp) != 4 {
+			return nil, fmt.Errorf("key origin fingerprint %q must be 8 hex characters", origin[0])
+		}
+		copy(d.Fingerprint[:], fp)
+		for _, step := range origin[1:] {
+			i, err := parsePathStep(step)
+			if err != nil {
+				return nil, err
+			}
+			d.Path = append(d.Path, i)
+		}
+		key = key[end+1:]
+	}
+	parts := strings.Split(key, "/")
+	if len(parts) < 2 || parts[len(parts)-1] != "*" {
+		return nil, fmt.Errorf("descriptor key %q must end in the /* wildcard so each sweep gets a fresh address", key)
+	}
+	for _, step := range parts[1 : len(parts)-1] {
+		i, err := parsePathStep(step)
+		if err != nil {
+			return nil, err
+		}
+		if i >= hardenedOffset {
+			return nil, fmt.Errorf("hardened step %s cannot be derived from an xpub", step)
+		}
+		d.Steps = append(d.Steps, i)
+	}
+	xpub, err := ParseExtendedPubKey(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	d.XPub = xpub
+	if !hasOrigin {
+		d.Fingerprint = xpub.Fingerprint()
+	}
+	if _, err := d.Address(0); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// String returns the descriptor with its checksum.
+func (d *DestinationDescriptor) String() string {
+	sum, err := descriptorChecksum(d.Descriptor)
+	if err != nil {
+		return d.Descriptor
+	}
+	return d.Descriptor + "#" + sum
+}
+
+// Address returns the address at index of the wildcard.
+func (d *DestinationDescriptor) Address(index uint32) (string, error) {
+	k, err := d.derive(index)
+	if err != nil {
+		return "", err
+	}
+	return k.Address, nil
+}
+
+// Derive the key, address and origin derivation for one index
+func (d *DestinationDescriptor) derive(index uint32) (*accountKey, error) {
+	child, err := d.XPub.Derive(append(append([]uint32{}, d.Steps...), index)...)
+	if err != nil {
+		return nil, err
+	}
+	pub := append([]byte{}, child.PubKey[:]...)
+	path := append(append(append([]uint32{}, d.Path...), d.Steps...), index)
+	k := &accountKey{PubKey: pub, Derivation: &Bip32Derivation{MasterFingerprint: d.Fingerprint, Path: path}, Index: index}
+	switch d.ScriptType {
+	case ScriptP2TR:
+		k.Address, err = CreateP2TRFromInternalKey(pub, d.Network)
+	case ScriptP2PKH:
+		k.Address, err = CreateP2PKH(Hash160(pub), d.Network)
+	default:
+		k.Address, err = CreateP2WPKH(Hash160(pub), d.Network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// DescriptorCounter returns the persisted next-unused index of a destination
+// descriptor, keyed by its first address so the same cold wallet shares one
+// counter however its descriptor is written.
+func (s *Sweeper) DescriptorCounter(d *DestinationDescriptor) (*DerivationCounter, error) {
+	id, err := d.Address(0)
+	if err != nil {
+		return nil, err
+	}
+	return &DerivationCounter{s: s, key: []byte("derivation:descriptor:" + id)}, nil
+}
+
+// NextDescriptorAddress reserves the next unused index of a destination
+// descriptor, skipping addresses that already received funds, and returns it
+// with its address. A reserved index is never handed out again, even if the
+// sweep paying it is abandoned.
+func (s *Sweeper) NextDescriptorAddress(d *DestinationDescriptor) (uint32, string, error) {
+	if d.Network != s.network {
+		return 0, "", errors.New("destination descriptor network does not match the sweeper network")
+	}
+	c, err := s.DescriptorCounter(d)
+	if err != nil {
+		return 0, "", err
+	}
+	return s.reserveFrom(c, d.Address)
+}
+
+// SweepToDescriptor consolidates all spendable UTXOs to the next unused
+// address of a wildcard descriptor and records the index on the plan, so
+// recurring sweeps to a cold wallet never reuse an address.
+func (s *Sweeper) SweepToDescriptor(d *DestinationDescriptor, opts ...SpendOptions) (*TransactionPlan, error) {
+	index, addr, err := s.NextDescriptorAddress(d)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.ConsolidateAll(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("sweep to %s index %d: %w", d.Descriptor, index, err)
+	}
+	plan.DescriptorDest = &DescriptorDestination{Descriptor: d.String(), Index: index, Address: addr}
+	if err := d.decorateOutputs(plan.PSBT, plan.Outputs, index); err != nil {
+		return nil, err
+	}
+	if err := s.savePlan(plan); err != nil {
+		return nil, fmt.Errorf("failed to persist plan %s: %w", plan.ID, err)
+	}
+	s.logger.Printf("plan %s pays %s index %d (%s)", plan.ID, d.Descriptor, index, addr)
+	return plan, nil
+}
+
+// Add the descriptor key origin to outputs paying index, so the cold wallet
+// can verify the address is its own
+func (d *DestinationDescriptor) decorateOutputs(psbt *PSBT, outputs []TxOutput, index uint32) error {
+	k, err := d.derive(index)
+	if err != nil {
+		return err
+	}
+	for i, out := range outputs {
+		if out.Address != k.Address {
+			continue
+		}
+		if d.ScriptType == ScriptP2TR {
+			psbt.Outputs[i].TapInternalKey = k.PubKey[1:]
+			psbt.Outputs[i].TapBip32Derivation[string(k.PubKey[1:])] = k.Derivation
+		} else {
+			psbt.Outputs[i].Bip32Derivation[string(k.PubKey)] = k.Derivation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDestinationDescriptor(t *testing.T) {
+	desc := "wpkh([" + tvMasterFP + "/84h/0h/0h]" + tvZpubBIP84 + "/0/*)"
+	d, err := ParseDestinationDescriptor(desc, BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("ParseDestinationDescriptor: %v", err)
+	}
+	if addr, _ := d.Address(0); addr != tvBIP84Recv0 {
+		t.Fatalf("index 0 = %s, want %s", addr, tvBIP84Recv0)
+	}
+	if _, err := ParseDestinationDescriptor(d.String(), BitcoinMainnet); err != nil {
+		t.Fatalf("descriptor with checksum rejected: %v", err)
+	}
+	tr, err := ParseDestinationDescriptor("tr(["+tvMasterFP+"/86h/0h/0h]"+tvXpubBIP86+"/0/*)", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("tr descriptor: %v", err)
+	}
+	if addr, _ := tr.Address(0); addr != tvBIP86Recv0 {
+		t.Fatalf("tr index 0 = %s, want %s", addr, tvBIP86Recv0)
+	}
+
+	for _, bad := range []string{
+		"wpkh(" + tvZpubBIP84 + "/0/0)",  // No wildcard
+		"wpkh(" + tvZpubBIP84 + "/0h/*)", // Hardened step
+		"sh(" + tvZpubBIP84 + "/0/*)",    // Unsupported script
+		desc + "#qqqqqqqq",               // Wrong checksum
+	} {
+		if _, err := ParseDestinationDescriptor(bad, BitcoinMainnet); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSweepToDescriptorAdvancesIndex(t *testing.T) {
+	a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount: %v", err)
+	}
+	src, _ := a.derive(true, 5)
+	s := mustNewSweeper(t, src.PubKey, BitcoinMainnet)
+	if err := s.SetXPubAccount(a, 10); err != nil {
+		t.Fatalf("SetXPubAccount: %v", err)
+	}
+	d, err := ParseDestinationDescriptor("wpkh(["+tvMasterFP+"/84h/0h/0h]"+tvZpubBIP84+"/0/*)", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("ParseDestinationDescriptor: %v", err)
+	}
+
+	// Index 0 (the account's own first receive address) already received
+	// funds, so the first sweep skips it
+	if err := s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 10_000, Address: tvBIP84Recv0, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	_ = s.RemoveUTXO(stringsRepeat("d", 64), 0)
+	for i, want := range []uint32{1, 2} {
+		txid := stringsRepeat(string(rune('a'+i)), 64)
+		if err := s.Index(UTXO{TxID: txid, Vout: 0, ValueSats: 150_000, Address: src.Address, Confirmed: true}); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+		plan, err := s.SweepToDescriptor(d)
+		if err != nil {
+			t.Fatalf("SweepToDescriptor: %v", err)
+		}
+		dd := plan.DescriptorDest
+		wantAddr, _ := d.Address(want)
+		if dd == nil || dd.Index != want || dd.Address != wantAddr || plan.Outputs[0].Address != wantAddr {
+			t.Fatalf("sweep %d paid %+v, want index %d (%s)", i, dd, want, wantAddr)
+		}
+		if len(plan.PSBT.Outputs[0].Bip32Derivation) != 1 {
+			t.Fatalf("expected the output key origin in the PSBT")
+		}
+		_ = s.RemoveUTXO(txid, 0)
+	}
+
+	// The recorded index and output origin survive a reload
+	s2 := mustNewSweeper(t, src.PubKey, BitcoinMainnet, WithKV(s.kv))
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	var reloaded int
+	for _, p := range s2.plans {
+		if p.DescriptorDest == nil || !strings.HasPrefix(p.DescriptorDest.Descriptor, "wpkh(") || len(p.PSBT.Outputs[0].Bip32Derivation) != 1 {
+			t.Fatalf("plan %s lost its descriptor destination: %+v", p.ID, p.DescriptorDest)
+		}
+		reloaded++
+	}
+	if reloaded != 2 {
+		t.Fatalf("reloaded %d plans, want 2", reloaded)
+	}
+}
+
+func TestConsolidateTemplateToDescriptor(t *testing.T) {
+	desc := "wpkh([" + tvMasterFP + "/84h/0h/0h]" + tvZpubBIP84 + "/0/*)"
+	spend := PlanTemplate{Name: "cold", Kind: TemplateSpend, AmountSats: 1000, Destinations: []TemplateDestination{{Address: desc}}}
+	if err := spend.Validate(); err == nil {
+		t.Fatalf("expected spend templates to refuse descriptor destinations")
+	}
+	tmpl := PlanTemplate{Name: "cold", Kind: TemplateConsolidate, Destinations: []TemplateDestination{{Address: desc}}}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	a, _ := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	src, _ := a.derive(true, 0)
+	s := mustNewSweeper(t, src.PubKey, BitcoinMainnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("e", 64), Vout: 0, ValueSats: 150_000, Address: src.Address, Confirmed: true})
+	plan, err := s.RunTemplate(tmpl)
+	if err != nil {
+		t.Fatalf("RunTemplate: %v", err)
+	}
+	if plan.DescriptorDest == nil || plan.DescriptorDest.Address != tvBIP84Recv0 {
+		t.Fatalf("template paid %+v, want index 0", plan.DescriptorDest)
+	}
+}
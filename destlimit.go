@@ -0,0 +1,73 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the per-destination limit on value in unconfirmed plans.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetMaxDestinationExposure limits how much value tracked plans that have not
+// confirmed yet may send to any single address, new plan included (0 disables
+// the limit). A mistyped destination then loses at most this much before the
+// first sweep to it confirms and someone notices. Change outputs do not count.
+// A plan over the limit is refused unless SpendOptions.OverrideDestLimit is
+// set, in which case the override is logged and recorded in its settings.
+func (s *Sweeper) SetMaxDestinationExposure(sats int64) error {
+	if sats < 0 {
+		return errors.New("maximum destination exposure must be non-negative")
+	}
+	s.maxDestExposure = sats
+	return nil
+}
+
+// DestinationExposure returns the value tracked plans that have not confirmed
+// yet send to addr, excluding change.
+func (s *Sweeper) DestinationExposure(addr string) int64 {
+	var total int64
+	for _, p := range s.plans {
+		if !p.inFlight() {
+			continue
+		}
+		for i, o := range p.Outputs {
+			if o.Address == addr && !p.IsChange(i) {
+				total += o.ValueSats
+			}
+		}
+	}
+	return total
+}
+
+// Reject (or log the override of) a new plan that would push any destination
+// over the limit
+func (s *Sweeper) checkDestinationExposure(outputs []TxOutput, changeIdxs []int, p spendParams) error {
+	if s.maxDestExposure <= 0 {
+		return nil
+	}
+	change := map[int]bool{}
+	for _, i := range changeIdxs {
+		change[i] = true
+	}
+	adds := map[string]int64{}
+	var order []string
+	for i, o := range outputs {
+		if change[i] {
+			continue
+		}
+		if _, ok := adds[o.Address]; !ok {
+			order = append(order, o.Address)
+		}
+		adds[o.Address] += o.ValueSats
+	}
+	for _, addr := range order {
+		cur := s.DestinationExposure(addr)
+		if cur+adds[addr] <= s.maxDestExposure {
+			continue
+		}
+		if !p.overrideDestLimit {
+			return fmt.Errorf("unconfirmed value sent to %s would reach %d sats (limit %d, in flight %d) - wait for earlier sweeps to it to confirm, or set SpendOptions.OverrideDestLimit", addr, cur+adds[addr], s.maxDestExposure, cur)
+		}
+		s.logger.Printf("destination limit overridden: %d sats to %s (limit %d, in flight %d)", cur+adds[addr], addr, s.maxDestExposure, cur)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDestinationExposureLimit(t *testing.T) {
+	var logged []string
+	s := newTestSweeper(t, WithLogger(logFunc(func(f string, v ...any) { logged = append(logged, fmt.Sprintf(f, v...)) })))
+	if err := s.SetMaxDestinationExposure(-1); err == nil {
+		t.Fatalf("expected a negative limit to be rejected")
+	}
+	_ = s.SetMaxDestinationExposure(100_000)
+	for _, c := range "abcd" {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(c), 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	}
+	first, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 60_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if got := s.DestinationExposure(testAddr("dest")); got != 60_000 {
+		t.Fatalf("exposure %d, want 60000", got)
+	}
+	// Split across outputs still counts as one destination
+	outs := []TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}, {Address: testAddr("dest"), ValueSats: 20_000}}
+	if _, err := s.Spend(outs); err == nil || !strings.Contains(err.Error(), "OverrideDestLimit") {
+		t.Fatalf("expected the destination limit to refuse the plan, got %v", err)
+	}
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("other"), ValueSats: 90_000}}); err != nil {
+		t.Fatalf("other destinations are not limited: %v", err)
+	}
+
+	plan, err := s.Spend(outs, SpendOptions{OverrideDestLimit: true})
+	if err != nil {
+		t.Fatalf("Spend with override: %v", err)
+	}
+	if !plan.Settings.DestLimitOverride || plan.Settings.MaxDestExposure != 100_000 {
+		t.Fatalf("override not recorded in settings: %+v", plan.Settings)
+	}
+	if !strings.Contains(strings.Join(logged, "\n"), "destination limit overridden: 110000 sats to "+testAddr("dest")) {
+		t.Fatalf("override not logged: %v", logged)
+	}
+
+	// Confirmed plans stop counting
+	_ = s.MarkConfirmed(first.ID, time.Now())
+	_ = s.MarkConfirmed(plan.ID, time.Now())
+	if got := s.DestinationExposure(testAddr("dest")); got != 0 {
+		t.Fatalf("exposure %d after confirmation, want 0", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains per-destination minimum output amounts.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetDestinationMinimum sets the smallest amount an output to addr may carry,
+// e.g. an exchange's minimum deposit, which is often well above dust and
+// below which the deposit is never credited (0 removes the minimum). Spend
+// refuses explicit outputs under it; weighted allocations (SpendWeighted,
+// SpendToWallets and weighted change) drop shares under it and keep their
+// value as change instead.
+func (s *Sweeper) SetDestinationMinimum(addr string, sats int64) error {
+	if addr == "" {
+		return errors.New("destination minimum needs an address")
+	}
+	if sats < 0 {
+		return fmt.Errorf("destination minimum for %s must be non-negative (got %d)", addr, sats)
+	}
+	if sats == 0 {
+		delete(s.destMinimums, addr)
+		return nil
+	}
+	if s.destMinimums == nil {
+		s.destMinimums = map[string]int64{}
+	}
+	s.destMinimums[addr] = sats
+	return nil
+}
+
+// DestinationMinimum returns the minimum output amount set for addr (0 = none).
+func (s *Sweeper) DestinationMinimum(addr string) int64 {
+	return s.destMinimums[addr]
+}
+
+// Refuse an explicit output below its destination's minimum
+func (s *Sweeper) checkDestinationMinimums(outputs []TxOutput) error {
+	for i, o := range outputs {
+		if min := s.destMinimums[o.Address]; o.ValueSats < min {
+			return fmt.Errorf("output %d pays %d sats to %s, below its minimum of %d sats - the deposit would not be credited; send at least the minimum or use SetDestinationMinimum", i, o.ValueSats, o.Address, min)
+		}
+	}
+	return nil
+}
+
+// Drop weighted shares below their destination's minimum, returning the rest
+// and the value dropped, which stays with the wallet as change
+func (s *Sweeper) dropBelowDestinationMinimum(outs []TxOutput) ([]TxOutput, int64) {
+	if len(s.destMinimums) == 0 {
+		return outs, 0
+	}
+	kept := outs[:0:0]
+	var shortfall int64
+	for _, o := range outs {
+		if min := s.destMinimums[o.Address]; o.ValueSats < min {
+			s.logger.Printf("share of %d sats to %s is below its minimum of %d sats: keeping it as change", o.ValueSats, o.Address, min)
+			shortfall += o.ValueSats
+			continue
+		}
+		kept = append(kept, o)
+	}
+	return kept, shortfall
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDestinationMinimums(t *testing.T) {
+	s := newTestSweeper(t)
+	if err := s.SetDestinationMinimum(testAddr("exchange"), -1); err == nil {
+		t.Fatalf("expected a negative minimum to be rejected")
+	}
+	_ = s.SetDestinationMinimum(testAddr("exchange"), 50_000)
+	for _, c := range "abc" {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(c), 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	}
+
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("exchange"), ValueSats: 40_000}}); err == nil || !strings.Contains(err.Error(), "minimum of 50000") {
+		t.Fatalf("expected an output below the minimum to be refused, got %v", err)
+	}
+
+	// A 30% share of 100k is below the exchange minimum: it stays as change
+	ws := []WeightedAddr{{Address: testAddr("exchange"), WeightBP: 3000}, {Address: testAddr("cold"), WeightBP: 7000}}
+	plan, err := s.SpendWeighted(ws, 100_000, 1_000)
+	if err != nil {
+		t.Fatalf("SpendWeighted: %v", err)
+	}
+	var sent int64
+	for i, o := range plan.Outputs {
+		if o.Address == testAddr("exchange") {
+			t.Fatalf("share below the minimum was paid: %+v", plan.Outputs)
+		}
+		if !plan.IsChange(i) {
+			sent += o.ValueSats
+		}
+	}
+	if sent != 70_000 {
+		t.Fatalf("sent %d, want only the 70000 cold share", sent)
+	}
+
+	// Weighted change redirects short shares to the change address
+	s.SetAllocationWeights([]WeightedAddr{{Address: testAddr("exchange"), WeightBP: 1000}, {Address: testAddr("cold"), WeightBP: 9000}})
+	plan, err = s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	for i, o := range plan.Outputs {
+		if o.Address == testAddr("exchange") {
+			t.Fatalf("change share below the minimum was paid: %+v", plan.Outputs)
+		}
+		if o.Address == testAddr("cold") && !plan.IsChange(i) {
+			t.Fatalf("weighted change not marked as change")
+		}
+	}
+	if len(plan.ChangeIdxs) != 2 {
+		t.Fatalf("expected the cold share plus redirected change, got %+v", plan.Outputs)
+	}
+
+	_ = s.SetDestinationMinimum(testAddr("exchange"), 0)
+	if s.DestinationMinimum(testAddr("exchange")) != 0 {
+		t.Fatalf("minimum not removed")
+	}
+}
@@ -0,0 +1,198 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains deployment health checks for the doctor command.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// DoctorStatus is the outcome of one doctor check.
+type DoctorStatus string
+
+// Doctor check outcomes
+const (
+	DoctorOK      DoctorStatus = "ok"
+	DoctorWarn    DoctorStatus = "warn"
+	DoctorFail    DoctorStatus = "fail"
+	DoctorSkipped DoctorStatus = "skipped"
+)
+
+// maxTipAge is how far the chain's median time past may trail the local
+// clock before the backend or clock is suspect. MTP normally lags by about an
+// hour, and blocks can be slow, so this is generous.
+const maxTipAge = 6 * time.Hour
+
+// DoctorFinding is the result of one check, with a fix when it is not ok.
+type DoctorFinding struct {
+	Check   string       `json:"check"`
+	Status  DoctorStatus `json:"status"`
+	Message string       `json:"message"`
+	Fix     string       `json:"fix,omitempty"`
+}
+
+// DoctorReport collects the findings of a doctor run.
+type DoctorReport struct {
+	Findings []DoctorFinding `json:"findings"`
+}
+
+// Healthy reports whether no check failed.
+func (r *DoctorReport) Healthy() bool {
+	for _, f := range r.Findings {
+		if f.Status == DoctorFail {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *DoctorReport) add(check string, status DoctorStatus, msg, fix string) {
+	r.Findings = append(r.Findings, DoctorFinding{Check: check, Status: status, Message: msg, Fix: fix})
+}
+
+// Doctor checks that the sweeper's deployment is usable: the KV store reads
+// back what it writes, the chain backend answers and is synced, the local
+// clock agrees with the chain, the configured keys derive addresses that
+// verify against themselves, and no webhook events are stuck in the outbox.
+// Checks that need something not configured are reported as skipped.
+func (s *Sweeper) Doctor(now time.Time) *DoctorReport {
+	r := &DoctorReport{}
+	s.doctorKV(r, now)
+	s.doctorChain(r, now)
+	s.doctorKeys(r)
+	s.doctorOutbox(r)
+	return r
+}
+
+// Write, read back and delete a probe key
+func (s *Sweeper) doctorKV(r *DoctorReport, now time.Time) {
+	const fix = "check kv_path points at a writable location with free space"
+	key := []byte("doctor:probe")
+	val := []byte(now.UTC().Format(time.RFC3339Nano))
+	if err := s.kv.Put(key, val); err != nil {
+		r.add("kv", DoctorFail, fmt.Sprintf("write failed: %v", err), fix)
+		return
+	}
+	got, err := s.kv.Get(key)
+	if err != nil || !bytes.Equal(got, val) {
+		r.add("kv", DoctorFail, fmt.Sprintf("read back %q, wrote %q (%v)", got, val, err), fix)
+		return
+	}
+	if err := s.kvDelete(string(key)); err != nil {
+		r.add("kv", DoctorWarn, fmt.Sprintf("probe key could not be deleted: %v", err), fix)
+		return
+	}
+	r.add("kv", DoctorOK, "read/write round trip succeeded", "")
+}
+
+// Backend connectivity, sync height and clock skew against the chain tip
+func (s *Sweeper) doctorChain(r *DoctorReport, now time.Time) {
+	if s.chain == nil {
+		const fix = "set backend_url in the config, or call SetChainInfo or SetHeaderChain with your backend"
+		r.add("backend", DoctorSkipped, "no chain backend configured", fix)
+		r.add("clock", DoctorSkipped, "no chain backend to compare against", fix)
+		return
+	}
+	height, mtp, err := s.chain.ChainTip()
+	if err != nil {
+		r.add("backend", DoctorFail, fmt.Sprintf("chain tip request failed: %v", err), "check the backend URL, credentials and that the node is running")
+		r.add("clock", DoctorSkipped, "no chain tip to compare against", "")
+		return
+	}
+	if height <= 0 {
+		r.add("backend", DoctorFail, fmt.Sprintf("backend reports height %d", height), "wait for the node to sync or point at a synced backend")
+	} else {
+		r.add("backend", DoctorOK, fmt.Sprintf("connected, tip height %d", height), "")
+	}
+
+	switch lag := now.Sub(mtp); {
+	case lag < 0:
+		r.add("clock", DoctorFail, fmt.Sprintf("local clock is %s behind the chain's median time past", (-lag).Round(time.Second)), "sync the system clock with NTP - lock times and schedules depend on it")
+	case lag > maxTipAge:
+		r.add("clock", DoctorWarn, fmt.Sprintf("chain median time past is %s behind the local clock", lag.Round(time.Minute)), "check the backend is synced and the system clock is not ahead")
+	default:
+		r.add("clock", DoctorOK, fmt.Sprintf("median time past is %s behind the local clock", lag.Round(time.Minute)), "")
+	}
+}
+
+// Derive the first receive address of the configured wallet and verify it
+// against the key it came from
+func (s *Sweeper) doctorKeys(r *DoctorReport) {
+	addr, err := s.doctorDerive()
+	if err != nil {
+		r.add("keys", DoctorFail, err.Error(), "check pubkey, xpub or multisig_descriptor and the network they are for")
+		return
+	}
+	if s.testMode {
+		r.add("keys", DoctorWarn, fmt.Sprintf("derived %s, but test mode skips address validation", addr), "set test_mode to false in production")
+		return
+	}
+	r.add("keys", DoctorOK, "derived and verified "+addr, "")
+
+	if len(s.taprootChangeKey) == 32 {
+		if _, err := liftX(s.taprootChangeKey); err != nil {
+			r.add("change_key", DoctorFail, fmt.Sprintf("taproot change key is not a valid x-only key: %v", err), "check TAPROOT_XONLY_HEX/taproot_xonly")
+		} else if !s.changeKeyVerified {
+			r.add("change_key", DoctorWarn, "taproot change key has not been proven spendable", "run VerifyTaprootChangeKey with your signer")
+		} else {
+			r.add("change_key", DoctorOK, "taproot change key verified by a signer", "")
+		}
+	}
+}
+
+// First receive address of the multisig, xpub or single-key wallet
+func (s *Sweeper) doctorDerive() (string, error) {
+	switch {
+	case s.multisig != nil:
+		ms, err := s.multisig.derive(false, 0)
+		if err != nil {
+			return "", fmt.Errorf("multisig derivation failed: %w", err)
+		}
+		dec, err := DecodeAddress(ms.Address)
+		if err != nil || dec.Type != P2WSH || !dec.OnNetwork(s.network) || !bytes.Equal(dec.Data, SHA256(ms.WitnessScript)) {
+			return "", fmt.Errorf("multisig address %s does not commit to its witness script on this network", ms.Address)
+		}
+		return ms.Address, nil
+	case s.account != nil:
+		k, err := s.account.derive(false, 0)
+		if err != nil {
+			return "", fmt.Errorf("xpub derivation failed: %w", err)
+		}
+		if _, err := decompressPubKey(k.PubKey); err != nil {
+			return "", fmt.Errorf("xpub derived an invalid key: %w", err)
+		}
+		if k.Address == "" || (s.account.ScriptType != ScriptP2TR && ValidateAddress(k.Address, k.PubKey, s.network) != nil) {
+			return "", fmt.Errorf("xpub address %s does not verify against its key", k.Address)
+		}
+		return k.Address, nil
+	}
+	if _, err := decompressPubKey(s.pubKey); err != nil {
+		return "", fmt.Errorf("public key is not a valid compressed secp256k1 key: %w", err)
+	}
+	addr, err := DeriveChangeAddress(s.pubKey, s.network)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateAddress(addr, s.pubKey, s.network); err != nil {
+		return "", fmt.Errorf("derived address %s does not verify: %w", addr, err)
+	}
+	return addr, nil
+}
+
+// Count webhook events still waiting for delivery
+func (s *Sweeper) doctorOutbox(r *DoctorReport) {
+	st, err := s.outboxState()
+	pending := 0
+	if err == nil {
+		pending, err = s.outboxPending()
+	}
+	switch {
+	case err != nil:
+		r.add("outbox", DoctorFail, err.Error(), "restore the KV store from backup")
+	case pending > 0 && s.webhook != nil:
+		r.add("outbox", DoctorWarn, fmt.Sprintf("%d webhook event(s) not delivered", pending), "check the webhook receiver, then run DeliverOutbox")
+	default:
+		r.add("outbox", DoctorOK, fmt.Sprintf("%d event(s) retained, %d unacknowledged", st.Next-st.First, pending), "")
+	}
+}
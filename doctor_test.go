@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func doctorStatuses(r *DoctorReport) map[string]DoctorStatus {
+	out := map[string]DoctorStatus{}
+	for _, f := range r.Findings {
+		out[f.Check] = f.Status
+	}
+	return out
+}
+
+func TestDoctor(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	r := s.Doctor(now)
+	got := doctorStatuses(r)
+	if got["kv"] != DoctorOK || got["keys"] != DoctorOK || got["backend"] != DoctorSkipped || got["clock"] != DoctorSkipped || !r.Healthy() {
+		t.Fatalf("unexpected findings %+v", r.Findings)
+	}
+	if _, err := s.kv.Get([]byte("doctor:probe")); err == nil {
+		t.Fatalf("probe key left behind")
+	}
+
+	s.SetChainInfo(&fixedTip{height: 840_000, mtp: now.Add(-time.Hour)})
+	if got := doctorStatuses(s.Doctor(now)); got["backend"] != DoctorOK || got["clock"] != DoctorOK {
+		t.Fatalf("unexpected findings %+v", got)
+	}
+	s.SetChainInfo(&fixedTip{height: 840_000, mtp: now.Add(time.Hour)})
+	if r := s.Doctor(now); doctorStatuses(r)["clock"] != DoctorFail || r.Healthy() {
+		t.Fatalf("expected a clock behind the chain to fail: %+v", r.Findings)
+	}
+	s.SetChainInfo(&fixedTip{height: 840_000, mtp: now.Add(-24 * time.Hour)})
+	if got := doctorStatuses(s.Doctor(now)); got["clock"] != DoctorWarn {
+		t.Fatalf("expected a stale tip warning, got %+v", got)
+	}
+
+	bad := mustNewSweeper(t, make([]byte, 33), BitcoinMainnet)
+	if r := bad.Doctor(now); doctorStatuses(r)["keys"] != DoctorFail || r.Healthy() {
+		t.Fatalf("expected an invalid public key to fail: %+v", r.Findings)
+	}
+}
+
+func TestDoctorUsesConfiguredBackend(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	now := time.Unix(1700000600, 0)
+	backend := esploraServer(t, map[string]string{
+		"/api/blocks/tip/hash": "00ab",
+		"/api/block/00ab":      `{"height": 840000, "mediantime": 1700000000}`,
+	})
+	c := DefaultConfig()
+	c.BackendURL = backend.BaseURL
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	if err := c.ApplyToSweeper(s); err != nil {
+		t.Fatalf("ApplyToSweeper: %v", err)
+	}
+	if got := doctorStatuses(s.Doctor(now)); got["backend"] != DoctorOK || got["clock"] != DoctorOK {
+		t.Fatalf("expected doctor to check backend_url, got %+v", got)
+	}
+}
@@ -0,0 +1,193 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains pluggable dust policies.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DustPolicy decides the smallest value worth holding or creating for a
+// script type. UTXOs below it are not indexed or selected and outputs below it
+// are not created. Integrators can plug their own rules, e.g. an exchange's
+// minimum-credit thresholds.
+type DustPolicy interface {
+	MinForScript(t AddressType) int64
+}
+
+// FixedDustPolicy applies the larger of MinSats and MinUSD (converted at
+// PriceUSDPerBTC) to every script type. This is the Sweeper's default.
+type FixedDustPolicy struct {
+	MinSats        int64   // Minimum in satoshis
+	MinUSD         float64 // Minimum in USD (0 = none)
+	PriceUSDPerBTC float64 // BTC price used to convert MinUSD
+}
+
+// MinForScript returns the threshold, which does not depend on the script type.
+func (p FixedDustPolicy) MinForScript(AddressType) int64 {
+	return max64(p.MinSats, dustFromUSD(p.MinUSD, p.PriceUSDPerBTC))
+}
+
+// validate rejects negative or unusable settings
+func (p FixedDustPolicy) validate() error {
+	var errs []error
+	if p.MinSats < 0 || p.MinUSD < 0 || p.PriceUSDPerBTC < 0 {
+		errs = append(errs, errors.New("dust policy values must be non-negative"))
+	}
+	if p.MinUSD > 0 && p.PriceUSDPerBTC == 0 {
+		errs = append(errs, errors.New("a USD dust threshold needs a BTC price"))
+	}
+	return errors.Join(errs...)
+}
+
+// FiatDustPolicy is FixedDustPolicy for any fiat currency: the larger of
+// MinSats and MinFiat converted at PricePerBTC, both in Currency.
+type FiatDustPolicy struct {
+	MinSats     int64   // Minimum in satoshis
+	MinFiat     float64 // Minimum in Currency (0 = none)
+	PricePerBTC float64 // BTC price in Currency used to convert MinFiat
+	Currency    string  // ISO 4217 code, e.g. "EUR" (empty = USD)
+}
+
+// MinForScript returns the threshold, which does not depend on the script type.
+func (p FiatDustPolicy) MinForScript(AddressType) int64 {
+	return max64(p.MinSats, dustFromUSD(p.MinFiat, p.PricePerBTC))
+}
+
+// validate rejects negative or unusable settings
+func (p FiatDustPolicy) validate() error {
+	var errs []error
+	if p.MinSats < 0 || p.MinFiat < 0 || p.PricePerBTC < 0 {
+		errs = append(errs, errors.New("dust policy values must be non-negative"))
+	}
+	cur, err := normalizeCurrency(p.Currency)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if p.MinFiat > 0 && p.PricePerBTC == 0 {
+		errs = append(errs, fmt.Errorf("a %s dust threshold needs a BTC price in %s", cur, cur))
+	}
+	return errors.Join(errs...)
+}
+
+// defaultDustRelayFeeRate is Bitcoin Core's default -dustrelayfee in sat/kvB.
+const defaultDustRelayFeeRate = 3000
+
+// RelayDustPolicy follows Bitcoin Core's relay rule: an output is dust when it
+// is worth less than the cost of creating and spending it at DustRelayFeeRate.
+// At the default rate this is 294 sats for P2WPKH, 330 sats for P2TR and P2WSH
+// and 546 sats for P2PKH.
+type RelayDustPolicy struct {
+	DustRelayFeeRate int64 // sat/kvB (0 = 3000)
+}
+
+// MinForScript returns Core's dust threshold for the script type.
+func (p RelayDustPolicy) MinForScript(t AddressType) int64 {
+	rate := p.DustRelayFeeRate
+	if rate <= 0 {
+		rate = defaultDustRelayFeeRate
+	}
+	// Serialized output (value + script length + script) plus Core's estimate
+	// for spending a witness output: outpoint, sequence, script length and a
+	// quarter of a typical 107-byte witness. Legacy outputs pay the full
+	// 107-byte scriptSig.
+	if t == P2PKH {
+		return (8 + 1 + 25 + 32 + 4 + 1 + 107 + 4) * rate / 1000
+	}
+	outSize := int64(8 + 1 + 22)
+	if t == P2TR || t == P2WSH {
+		outSize = 8 + 1 + 34
+	}
+	const spendSize = 32 + 4 + 1 + 107/4 + 4
+	return (outSize + spendSize) * rate / 1000
+}
+
+// Core's dust threshold for an arbitrary output script at the policy's rate,
+// as GetDustThreshold computes it: witness programs are spent with a quarter
+// of the 107-byte witness estimate, anything else with a full scriptSig
+func (p RelayDustPolicy) minForOutputScript(script []byte) int64 {
+	rate := p.DustRelayFeeRate
+	if rate <= 0 {
+		rate = defaultDustRelayFeeRate
+	}
+	spendSize := int64(32 + 4 + 1 + 107 + 4)
+	if isWitnessProgram(script) {
+		spendSize = 32 + 4 + 1 + 107/4 + 4
+	}
+	return (outputSize(script) + spendSize) * rate / 1000
+}
+
+// Whether script is a segwit output: a version opcode and a 2- to 40-byte push
+func isWitnessProgram(script []byte) bool {
+	if len(script) < 4 || len(script) > 42 || int(script[1]) != len(script)-2 {
+		return false
+	}
+	return script[0] == 0x00 || (script[0] >= 0x51 && script[0] <= 0x60)
+}
+
+// Dust threshold for a script built by an output script template. Standard
+// scripts use the policy for their type; other scripts are held to at least
+// Core's relay threshold for their size, below which nodes do not relay
+// them, and OP_RETURN outputs are unspendable and never dust.
+func (s *Sweeper) templateDust(script []byte) int64 {
+	if script[0] == 0x6a {
+		return 0
+	}
+	if addr, ok := scriptAddress(script, s.network); ok {
+		return s.dustPolicy.MinForScript(s.scriptTypeOf(addr))
+	}
+	relay, ok := s.dustPolicy.(RelayDustPolicy)
+	if ok {
+		return relay.minForOutputScript(script)
+	}
+	return max64(s.dustPolicy.MinForScript(P2WPKH), relay.minForOutputScript(script))
+}
+
+// SetDustPolicy replaces the dust policy.
+func (s *Sweeper) SetDustPolicy(p DustPolicy) error {
+	if p == nil {
+		return errors.New("dust policy must not be nil")
+	}
+	switch f := p.(type) {
+	case FixedDustPolicy:
+		if err := f.validate(); err != nil {
+			return err
+		}
+	case FiatDustPolicy:
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	s.dustPolicy = p
+	return nil
+}
+
+// Script type of an address; test mode and undecodable addresses count as P2WPKH
+func (s *Sweeper) scriptTypeOf(addr string) AddressType {
+	if s.testMode {
+		return P2WPKH
+	}
+	if dec, err := s.decodeAddress(addr); err == nil {
+		return dec.Type
+	}
+	if isSilentPaymentAddress(addr) {
+		return P2TR
+	}
+	return P2WPKH
+}
+
+// Dust threshold for an output to or input from addr under the call's settings
+func (s *Sweeper) dustFor(addr string, p spendParams) int64 {
+	if p.dustOverride > 0 {
+		return p.dustOverride
+	}
+	if script, ok := s.templateScript(addr); ok {
+		return s.templateDust(script)
+	}
+	return s.dustPolicy.MinForScript(s.scriptTypeOf(addr))
+}
+
+// Describe a dust policy for settings snapshots
+func describeDustPolicy(p DustPolicy) string {
+	return fmt.Sprintf("%T%+v", p, p)
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestRelayDustPolicyMatchesCore(t *testing.T) {
+	p := RelayDustPolicy{}
+	if got := p.MinForScript(P2WPKH); got != 294 {
+		t.Fatalf("P2WPKH dust = %d, want 294", got)
+	}
+	if got := p.MinForScript(P2TR); got != 330 {
+		t.Fatalf("P2TR dust = %d, want 330", got)
+	}
+	if got := (RelayDustPolicy{DustRelayFeeRate: 6000}).MinForScript(P2WPKH); got != 588 {
+		t.Fatalf("P2WPKH dust at 6000 sat/kvB = %d, want 588", got)
+	}
+}
+
+// minCredit mimics an exchange that only credits deposits of at least 10k sats
+type minCredit struct{}
+
+func (minCredit) MinForScript(AddressType) int64 { return 10_000 }
+
+func TestCustomDustPolicyFiltersInputsAndChange(t *testing.T) {
+	s := newTestSweeper(t, WithDustPolicy(minCredit{}))
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 5_000, Address: testAddr("in1"), Confirmed: true}); err == nil {
+		t.Fatalf("expected a UTXO below the custom threshold to be rejected")
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 60_000, Address: testAddr("in2"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 45_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	for _, i := range plan.ChangeIdxs {
+		if plan.Outputs[i].ValueSats < 10_000 {
+			t.Fatalf("change output %d below the custom threshold", plan.Outputs[i].ValueSats)
+		}
+	}
+	if plan.Settings.DustPolicy == "" {
+		t.Fatalf("expected the dust policy in the plan settings")
+	}
+	if err := s.SetDustPolicy(nil); err == nil {
+		t.Fatalf("expected nil policy to be rejected")
+	}
+}
+
+func TestFiatDustPolicyInEUR(t *testing.T) {
+	p := FiatDustPolicy{MinFiat: 0.5, PricePerBTC: 50_000, Currency: "EUR"}
+	if got := p.MinForScript(P2WPKH); got < 1000 || got > 1001 {
+		t.Fatalf("EUR dust = %d, want about 1000", got)
+	}
+	s := newTestSweeper(t)
+	if err := s.SetDustPolicy(FiatDustPolicy{MinFiat: 1, Currency: "EUR"}); err == nil {
+		t.Fatalf("expected a fiat threshold without a price to be rejected")
+	}
+	if err := s.SetDustPolicy(FiatDustPolicy{Currency: "EURO"}); err == nil {
+		t.Fatalf("expected an invalid currency code to be rejected")
+	}
+
+	c := DefaultConfig()
+	c.DustPolicy, c.FiatCurrency, c.DustThresholdFiat, c.PriceFiatPerBTC = "fiat", "eur", 0.5, 50_000
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	c.PriceFiatPerBTC = 0
+	if err := c.Validate(); err == nil {
+		t.Fatalf("expected missing EUR price to be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the Electrum export of unsigned transactions and base43.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// base43Alphabet is the alphabet Electrum packs transactions into QR codes
+// with: all of it fits QR alphanumeric mode.
+const base43Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ$*+-./:"
+
+// ElectrumExport holds a plan's unsigned transaction in the forms Electrum
+// (4.0 and later, whose partially signed format is PSBT) loads for signing.
+type ElectrumExport struct {
+	PSBT   []byte // Binary PSBT, as Electrum reads from a .psbt file
+	Base64 string // For "Load transaction > From text"
+	Base43 string // QR payload for "Load transaction > From QR code"
+}
+
+// ExportElectrum encodes the plan's PSBT for an Electrum cosigner or
+// signer. Electrum recognises its inputs by the BIP32 derivations the PSBT
+// carries, so plans for an xpub or multisig account can be signed directly.
+// ImportElectrum takes back what Electrum saves or shows once it has signed.
+func (p *TransactionPlan) ExportElectrum() (*ElectrumExport, error) {
+	if p.PSBT == nil {
+		return nil, errors.New("plan has no PSBT to export")
+	}
+	raw := p.PSBT.Serialize()
+	return &ElectrumExport{
+		PSBT:   raw,
+		Base64: base64.StdEncoding.EncodeToString(raw),
+		Base43: EncodeBase43(raw),
+	}, nil
+}
+
+// EncodeBase43 encodes data with Electrum's base43 alphabet: big-endian
+// digits, with one '0' per leading zero byte.
+func EncodeBase43(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	base, mod := big.NewInt(43), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base43Alphabet[mod.Int64()])
+	}
+	for _, c := range data {
+		if c != 0 {
+			break
+		}
+		out = append(out, base43Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// DecodeBase43 reverses EncodeBase43.
+func DecodeBase43(s string) ([]byte, error) {
+	n := new(big.Int)
+	base := big.NewInt(43)
+	for _, c := range []byte(s) {
+		d := bytes.IndexByte([]byte(base43Alphabet), c)
+		if d < 0 {
+			return nil, fmt.Errorf("invalid base43 character %q", c)
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(d)))
+	}
+	b := n.Bytes()
+	for _, c := range []byte(s) {
+		if c != base43Alphabet[0] {
+			break
+		}
+		b = append([]byte{0}, b...)
+	}
+	return b, nil
+}
+
+// ImportElectrum attaches the signatures Electrum returned for a pending
+// plan and returns the signed transaction. data may be a PSBT (binary,
+// base64 or base43 from a QR code), or the complete transaction Electrum
+// shows once every signature is in (hex or base43); either way it must be
+// the planned transaction.
+func (s *Sweeper) ImportElectrum(id string, data []byte) (*MsgTx, error) {
+	plan, ok := s.plans[id]
+	if !ok {
+		return nil, fmt.Errorf("plan %q is not pending in this sweeper - call LoadPlans", id)
+	}
+	psbt, tx, err := decodeElectrum(data)
+	if err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	if psbt != nil {
+		tx, err = finalizeSignedPSBT(plan, psbt)
+	} else if !bytes.Equal(tx.Serialize(false), plan.RawTx.Serialize(false)) {
+		err = errors.New("Electrum transaction does not match the planned transaction")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	plan.SignedTx = tx
+	if plan.BroadcastAt == nil {
+		if err := transitionPlan(plan, PlanSigned, time.Now(), "electrum"); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.savePlan(plan); err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	return tx, nil
+}
+
+// Decode an Electrum export into a PSBT or, for a complete transaction, a
+// MsgTx
+func decodeElectrum(data []byte) (*PSBT, *MsgTx, error) {
+	raw := data
+	if !bytes.HasPrefix(data, []byte("psbt\xff")) {
+		text := strings.TrimSpace(string(data))
+		if b, err := hex.DecodeString(text); err == nil {
+			raw = b
+		} else if b, err := DecodeBase43(text); err == nil && text != "" {
+			raw = b
+		} else if _, err := base64.StdEncoding.DecodeString(text); err == nil {
+			p, err := DecodePSBTB64(text)
+			return p, nil, err
+		} else {
+			return nil, nil, errors.New("not a PSBT or transaction in binary, hex, base64 or base43")
+		}
+	}
+	if bytes.HasPrefix(raw, []byte("psbt\xff")) {
+		p, err := ParsePSBT(raw)
+		return p, nil, err
+	}
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a PSBT or transaction: %w", err)
+	}
+	return nil, tx, nil
+}
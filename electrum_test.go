@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBase43RoundTrip(t *testing.T) {
+	for _, data := range [][]byte{{}, {0}, {0, 0, 1}, []byte("psbt\xff"), bytes.Repeat([]byte{0xff}, 40)} {
+		enc := EncodeBase43(data)
+		dec, err := DecodeBase43(enc)
+		if err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("round trip of %x: %q -> %x, %v", data, enc, dec, err)
+		}
+	}
+	if _, err := DecodeBase43("abc"); err == nil {
+		t.Fatalf("expected lowercase to be refused")
+	}
+}
+
+func TestImportElectrumForms(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(0xe1ec7)}
+	pk := key.pub()
+	addr, _ := CreateP2WPKH(Hash160(pk), BitcoinTestnet)
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("e1", 32), Vout: 0, ValueSats: 200_000, Address: addr, Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	exp, err := plan.ExportElectrum()
+	if err != nil {
+		t.Fatalf("ExportElectrum: %v", err)
+	}
+
+	// Electrum signs and shows the PSBT back as a QR code
+	ps, err := ParsePSBT(exp.PSBT)
+	if err != nil {
+		t.Fatalf("ParsePSBT: %v", err)
+	}
+	key.signPSBT(t, ps)
+	signed := ps.Serialize()
+	tx, err := s.ImportElectrum(plan.ID, []byte(EncodeBase43(signed)))
+	if err != nil {
+		t.Fatalf("ImportElectrum base43: %v", err)
+	}
+	if tx.TxID() != plan.ExpectedTxID() || plan.Status != PlanSigned {
+		t.Fatalf("expected the planned transaction signed, got %s (%s)", tx.TxID(), plan.Status)
+	}
+
+	// A complete transaction in hex is accepted as-is
+	full := hex.EncodeToString(tx.Serialize(true))
+	if _, err := s.ImportElectrum(plan.ID, []byte(full+"\n")); err != nil {
+		t.Fatalf("ImportElectrum hex: %v", err)
+	}
+	if _, err := decodePSBTFile([]byte(EncodeBase43(signed))); err != nil {
+		t.Fatalf("batch import of base43: %v", err)
+	}
+
+	other, _ := DeserializeMsgTx(plan.RawTx.Serialize(false))
+	other.LockTime++
+	_, err = s.ImportElectrum(plan.ID, []byte(hex.EncodeToString(other.Serialize(false))))
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a different transaction to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains a chain backend over the Esplora HTTP API.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EsploraBackend reads chain state from an Esplora-compatible HTTP API
+// (Blockstream's Esplora, mempool.space and their self-hosted instances). It
+// is a UTXOSource, ScanSource, ChainInfoProvider, ConfirmationSource,
+// MempoolSource, MerkleProofSource and HeaderSource, so the CLI can scan
+// accounts, re-validate its index, track plans, score unconfirmed coins and
+// verify inclusion proofs against it.
+type EsploraBackend struct {
+	BaseURL string        // e.g. MempoolSpaceAPI or "https://blockstream.info/testnet/api"
+	Timeout time.Duration // Per request (0 = 10s)
+	Client  *http.Client  // nil = http.DefaultClient
+}
+
+// Esplora's status object of a transaction
+type esploraStatus struct {
+	Confirmed   bool  `json:"confirmed"`
+	BlockHeight int64 `json:"block_height"`
+}
+
+// NewEsploraBackend checks the base URL. It must be https; plain http is
+// accepted only for loopback addresses.
+func NewEsploraBackend(baseURL string) (*EsploraBackend, error) {
+	if err := checkAPIURL("backend", baseURL); err != nil {
+		return nil, err
+	}
+	return &EsploraBackend{BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// GET a path under BaseURL
+func (b *EsploraBackend) get(path string) ([]byte, error) {
+	return httpGet(b.Client, b.Timeout, b.BaseURL+path)
+}
+
+// GET a path under BaseURL and decode its JSON into v
+func (b *EsploraBackend) getJSON(path string, v interface{}) error {
+	raw, err := b.get(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", path, err)
+	}
+	return nil
+}
+
+// TipHeight returns the height of the backend's best block.
+func (b *EsploraBackend) TipHeight() (int64, error) {
+	raw, err := b.get("/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	h, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil || h < 0 {
+		return 0, fmt.Errorf("invalid tip height %q", raw)
+	}
+	return h, nil
+}
+
+// ListUnspent returns the coins paying the addresses (GET
+// /address/:address/utxo), with confirmations counted from the tip.
+func (b *EsploraBackend) ListUnspent(addresses []string) ([]UTXO, error) {
+	var tip int64
+	var out []UTXO
+	for _, addr := range addresses {
+		var coins []struct {
+			TxID   string        `json:"txid"`
+			Vout   uint32        `json:"vout"`
+			Value  int64         `json:"value"`
+			Status esploraStatus `json:"status"`
+		}
+		if err := b.getJSON("/address/"+url.PathEscape(addr)+"/utxo", &coins); err != nil {
+			return nil, err
+		}
+		for _, c := range coins {
+			u := UTXO{TxID: c.TxID, Vout: c.Vout, ValueSats: c.Value, Address: addr, Confirmed: c.Status.Confirmed}
+			if c.Status.Confirmed && c.Status.BlockHeight > 0 {
+				if tip == 0 {
+					h, err := b.TipHeight()
+					if err != nil {
+						return nil, err
+					}
+					tip = h
+				}
+				u.BlockHeight = c.Status.BlockHeight
+				if n := tip - c.Status.BlockHeight + 1; n > 0 {
+					u.Confirmations = int(n)
+				}
+			}
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// AddressUsed reports whether any confirmed or mempool transaction pays or
+// spends from the address (GET /address/:address/txs).
+func (b *EsploraBackend) AddressUsed(address string) (bool, error) {
+	var txs []struct {
+		TxID string `json:"txid"`
+	}
+	if err := b.getJSON("/address/"+url.PathEscape(address)+"/txs", &txs); err != nil {
+		return false, err
+	}
+	return len(txs) > 0, nil
+}
+
+// ChainTip returns the best block's height and median time past (GET
+// /blocks/tip/hash, then /block/:hash).
+func (b *EsploraBackend) ChainTip() (int64, time.Time, error) {
+	hash, err := b.get("/blocks/tip/hash")
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var blk struct {
+		Height     int64 `json:"height"`
+		MedianTime int64 `json:"mediantime"`
+	}
+	if err := b.getJSON("/block/"+url.PathEscape(strings.TrimSpace(string(hash))), &blk); err != nil {
+		return 0, time.Time{}, err
+	}
+	return blk.Height, time.Unix(blk.MedianTime, 0), nil
+}
+
+// Confirmations counts the blocks on top of and including the one that mined
+// txid (GET /tx/:txid/status); 0 while it is unconfirmed or unknown.
+func (b *EsploraBackend) Confirmations(txid string) (int, error) {
+	var st esploraStatus
+	if err := b.getJSON("/tx/"+url.PathEscape(txid)+"/status", &st); err != nil {
+		if errors.Is(err, errHTTPNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !st.Confirmed || st.BlockHeight <= 0 {
+		return 0, nil
+	}
+	tip, err := b.TipHeight()
+	if err != nil {
+		return 0, err
+	}
+	if n := tip - st.BlockHeight + 1; n > 0 {
+		return int(n), nil
+	}
+	return 1, nil
+}
+
+// maxEsploraAncestors bounds the unconfirmed ancestors MempoolTx walks, as
+// the mempool's own ancestor limit does.
+const maxEsploraAncestors = 25
+
+// Esplora's transaction object, as far as the mempool details need it
+type esploraTx struct {
+	Version int32 `json:"version"`
+	Weight  int64 `json:"weight"`
+	Fee     int64 `json:"fee"`
+	Vin     []struct {
+		TxID     string `json:"txid"`
+		Sequence uint32 `json:"sequence"`
+	} `json:"vin"`
+	Status esploraStatus `json:"status"`
+}
+
+// MempoolTx describes an unconfirmed transaction (GET /tx/:txid) with its
+// unconfirmed ancestors. Esplora reports neither when it first saw the
+// transaction nor conflicts, so FirstSeen is zero and ConflictSeen false. A
+// transaction that is confirmed or unknown is not in the mempool.
+func (b *EsploraBackend) MempoolTx(txid string) (*MempoolTxInfo, error) {
+	tx, err := b.tx(txid)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status.Confirmed {
+		return nil, fmt.Errorf("transaction %s is confirmed, not in the mempool", txid)
+	}
+	info := &MempoolTxInfo{Version: tx.Version}
+	seen := map[string]bool{txid: true}
+	queue := []*esploraTx{tx}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		vsize := (cur.Weight + 3) / 4
+		info.AncestorFeeSats += cur.Fee
+		info.AncestorVSize += vsize
+		for _, in := range cur.Vin {
+			info.SignalsRBF = info.SignalsRBF || in.Sequence < 0xfffffffe
+			if seen[in.TxID] {
+				continue
+			}
+			seen[in.TxID] = true
+			parent, err := b.tx(in.TxID)
+			if err != nil {
+				return nil, fmt.Errorf("parent %s: %w", in.TxID, err)
+			}
+			if parent.Status.Confirmed {
+				continue
+			}
+			if info.UnconfirmedAncestors++; info.UnconfirmedAncestors > maxEsploraAncestors {
+				return nil, fmt.Errorf("transaction %s has more than %d unconfirmed ancestors", txid, maxEsploraAncestors)
+			}
+			queue = append(queue, parent)
+		}
+	}
+	if vsize := (tx.Weight + 3) / 4; vsize > 0 {
+		info.FeeRateSatsVB = float64(tx.Fee) / float64(vsize)
+	}
+	return info, nil
+}
+
+// GET /tx/:txid
+func (b *EsploraBackend) tx(txid string) (*esploraTx, error) {
+	var tx esploraTx
+	if err := b.getJSON("/tx/"+url.PathEscape(txid), &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// RawTransaction returns the serialized transaction (GET /tx/:txid/hex).
+func (b *EsploraBackend) RawTransaction(txid string) ([]byte, error) {
+	return b.getHex("/tx/" + url.PathEscape(txid) + "/hex")
+}
+
+// TxMerkleProof returns the inclusion proof of a confirmed transaction (GET
+// /tx/:txid/merkle-proof); nil while it is unconfirmed or unknown.
+func (b *EsploraBackend) TxMerkleProof(txid string) (*MerkleProof, error) {
+	var proof MerkleProof
+	if err := b.getJSON("/tx/"+url.PathEscape(txid)+"/merkle-proof", &proof); err != nil {
+		if errors.Is(err, errHTTPNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// BlockHeader returns the raw header of the block at height (GET
+// /block-height/:height, then /block/:hash/header).
+func (b *EsploraBackend) BlockHeader(height int) ([]byte, error) {
+	hash, err := b.get("/block-height/" + strconv.Itoa(height))
+	if err != nil {
+		return nil, err
+	}
+	return b.getHex("/block/" + url.PathEscape(strings.TrimSpace(string(hash))) + "/header")
+}
+
+// GET a path under BaseURL whose body is hex
+func (b *EsploraBackend) getHex(path string) ([]byte, error) {
+	raw, err := b.get(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", path, err)
+	}
+	return out, nil
+}
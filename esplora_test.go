@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// An Esplora server answering from fixed JSON bodies by path
+func esploraServer(t *testing.T, routes map[string]string) *EsploraBackend {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	b, err := NewEsploraBackend(srv.URL + "/api")
+	if err != nil {
+		t.Fatalf("NewEsploraBackend: %v", err)
+	}
+	return b
+}
+
+func TestEsploraListUnspent(t *testing.T) {
+	b := esploraServer(t, map[string]string{
+		"/api/blocks/tip/height": "800010",
+		"/api/address/tb1a/utxo": `[{"txid":"` + stringsRepeat("a", 64) + `","vout":1,"value":5000,"status":{"confirmed":true,"block_height":800001}},
+			{"txid":"` + stringsRepeat("b", 64) + `","vout":0,"value":7000,"status":{"confirmed":false}}]`,
+		"/api/address/tb1b/utxo": `[]`,
+		"/api/address/tb1b/txs":  `[{"txid":"` + stringsRepeat("c", 64) + `"}]`,
+		"/api/address/tb1c/txs":  `[]`,
+	})
+	got, err := b.ListUnspent([]string{"tb1a", "tb1b"})
+	if err != nil {
+		t.Fatalf("ListUnspent: %v", err)
+	}
+	if len(got) != 2 || got[0].Address != "tb1a" || got[0].Confirmations != 10 || got[0].BlockHeight != 800001 || got[1].Confirmed {
+		t.Fatalf("unexpected UTXOs %+v", got)
+	}
+	if _, err := b.ListUnspent([]string{"tb1missing"}); err == nil {
+		t.Fatalf("expected a backend error to be reported")
+	}
+	// An emptied address still has history
+	if used, err := b.AddressUsed("tb1b"); err != nil || !used {
+		t.Fatalf("AddressUsed(tb1b) = %v, %v", used, err)
+	}
+	if used, err := b.AddressUsed("tb1c"); err != nil || used {
+		t.Fatalf("AddressUsed(tb1c) = %v, %v", used, err)
+	}
+	if _, err := NewEsploraBackend("http://example.com/api"); err == nil {
+		t.Fatalf("expected plain http to a remote host to be refused")
+	}
+}
+
+func TestConfigRevalidationNeedsBackend(t *testing.T) {
+	c := &Config{RevalidateInterval: "1h"}
+	if _, err := c.Revalidation(); err == nil {
+		t.Fatalf("expected revalidate_interval without backend_url to be rejected")
+	}
+	c.BackendURL = "https://blockstream.info/testnet/api"
+	if d, err := c.Revalidation(); err != nil || d.Hours() != 1 {
+		t.Fatalf("Revalidation: %v %v", d, err)
+	}
+	if b, err := c.Backend(); err != nil || b == nil {
+		t.Fatalf("Backend: %v %v", b, err)
+	}
+}
+
+func TestEsploraTrackingLookups(t *testing.T) {
+	tx, parent, root := stringsRepeat("c", 64), stringsRepeat("d", 64), stringsRepeat("e", 64)
+	b := esploraServer(t, map[string]string{
+		"/api/blocks/tip/height":      "800010",
+		"/api/blocks/tip/hash":        "00ab",
+		"/api/block/00ab":             `{"height": 800010, "mediantime": 1700000000}`,
+		"/api/tx/" + root + "/status": `{"confirmed": true, "block_height": 800008}`,
+		"/api/tx/" + tx + "/status":   `{"confirmed": false}`,
+		"/api/tx/" + tx:               `{"version": 2, "weight": 561, "fee": 1410, "vin": [{"txid": "` + parent + `", "sequence": 4294967295}], "status": {"confirmed": false}}`,
+		"/api/tx/" + parent:           `{"version": 2, "weight": 800, "fee": 200, "vin": [{"txid": "` + root + `", "sequence": 4294967293}], "status": {"confirmed": false}}`,
+		"/api/tx/" + root:             `{"version": 2, "weight": 800, "fee": 300, "vin": [], "status": {"confirmed": true, "block_height": 800008}}`,
+	})
+	h, mtp, err := b.ChainTip()
+	if err != nil || h != 800010 || mtp.Unix() != 1700000000 {
+		t.Fatalf("ChainTip = %d, %v, %v", h, mtp, err)
+	}
+	for id, want := range map[string]int{root: 3, tx: 0, stringsRepeat("f", 64): 0} {
+		if n, err := b.Confirmations(id); err != nil || n != want {
+			t.Fatalf("Confirmations(%s) = %d, %v; want %d", id[:4], n, err, want)
+		}
+	}
+
+	// The parent is unconfirmed and signals RBF; the root is confirmed
+	info, err := b.MempoolTx(tx)
+	if err != nil {
+		t.Fatalf("MempoolTx: %v", err)
+	}
+	if info.UnconfirmedAncestors != 1 || info.AncestorFeeSats != 1610 || info.AncestorVSize != 141+200 || !info.SignalsRBF || info.FeeRateSatsVB != 10 {
+		t.Fatalf("unexpected mempool info %+v", info)
+	}
+	if _, err := b.MempoolTx(root); err == nil {
+		t.Fatalf("expected a confirmed transaction not to be in the mempool")
+	}
+	if _, err := b.MempoolTx(stringsRepeat("f", 64)); err == nil {
+		t.Fatalf("expected an unknown transaction not to be in the mempool")
+	}
+}
+
+func TestEsploraInclusionProof(t *testing.T) {
+	s := newTestSweeper(t)
+	addr, _ := CreateP2WPKH(make([]byte, 20), BitcoinRegtest)
+	script, _ := s.buildOutputScript(addr)
+	ta, tb := payingTx(script, 1, 50_000), payingTx(script, 2, 70_000)
+	a, b := ta.TxHash(), tb.TxHash()
+	header := mineHeader(t, sha256Double(append(a[:], b[:]...)))
+	backend := esploraServer(t, map[string]string{
+		"/api/tx/" + ta.TxID() + "/hex":          hex.EncodeToString(ta.Serialize(true)),
+		"/api/tx/" + ta.TxID() + "/merkle-proof": `{"block_height": 812, "merkle": ["` + hashHex(b) + `"], "pos": 0}`,
+		"/api/block-height/812":                  "00cd",
+		"/api/block/00cd/header":                 hex.EncodeToString(header),
+	})
+	if p, err := backend.TxMerkleProof(tb.TxID()); err != nil || p != nil {
+		t.Fatalf("expected no proof for an unknown transaction, got %+v %v", p, err)
+	}
+	if err := s.SetMerkleVerification(backend, backend); err != nil {
+		t.Fatalf("SetMerkleVerification: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: ta.TxID(), ValueSats: 50_000, Address: addr, Confirmed: true, BlockHeight: 812}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: tb.TxID(), ValueSats: 70_000, Address: addr, Confirmed: true}); err == nil {
+		t.Fatalf("expected a UTXO without a proof to be rejected")
+	}
+
+	// The CLI turns it on with verify_inclusion
+	c := DefaultConfig()
+	c.VerifyInclusion = true
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "verify_inclusion") {
+		t.Fatalf("expected verify_inclusion without backend_url to be rejected, got %v", err)
+	}
+	c.BackendURL = backend.BaseURL
+	s2 := newTestSweeper(t)
+	if err := c.ApplyToSweeper(s2); err != nil {
+		t.Fatalf("ApplyToSweeper: %v", err)
+	}
+	if s2.merkleProofs == nil || s2.headers == nil {
+		t.Fatalf("verify_inclusion did not enable merkle verification")
+	}
+}
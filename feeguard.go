@@ -0,0 +1,194 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains sanity checks for fee rates reported by backends.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FeeRateProvider estimates the fee rate (in sat/kvB, see FeeRate) needed to
+// confirm within confTarget blocks.
+type FeeRateProvider interface {
+	EstimateFeeRate(confTarget int) (FeeRate, error)
+}
+
+// FeeGuardMode decides what happens to an outlier fee rate.
+type FeeGuardMode string
+
+const (
+	FeeGuardClamp FeeGuardMode = "clamp" // Plan at the nearest acceptable rate
+	FeeGuardError FeeGuardMode = "error" // Refuse the rate
+	FeeGuardWarn  FeeGuardMode = "warn"  // Log and use the rate anyway
+)
+
+const (
+	defaultFeeGuardMaxRatio = 3.0
+	defaultFeeGuardWindow   = 12
+	feeGuardMinSamples      = 3 // Rolling median needs this many samples before it is trusted
+)
+
+// FeeGuard cross-checks fee rates against a second provider or, failing that,
+// the rolling median of recently accepted rates. A rate more than MaxRatio
+// times above or below the reference is an outlier and is handled per Mode.
+// It is safe for concurrent use.
+type FeeGuard struct {
+	Mode      FeeGuardMode    // Default clamp
+	MaxRatio  float64         // Allowed deviation from the reference (0 = 3x)
+	Window    int             // Samples in the rolling median (0 = 12)
+	Secondary FeeRateProvider // Optional second opinion, preferred over the median
+
+	mu      sync.Mutex
+	samples []FeeRate
+}
+
+// FeeAnomaly describes an outlier fee rate.
+type FeeAnomaly struct {
+	Rate      FeeRate `json:"rate"`      // Rate reported by the provider
+	Reference FeeRate `json:"reference"` // Secondary estimate or rolling median
+	Source    string  `json:"source"`    // "secondary" or "median"
+	Applied   FeeRate `json:"applied"`   // Rate used after the guard (0 in error mode)
+}
+
+func (a *FeeAnomaly) String() string {
+	return fmt.Sprintf("fee rate %s deviates from the %s reference of %s", a.Rate, a.Source, a.Reference)
+}
+
+// validate rejects unknown modes and nonsensical limits
+func (g *FeeGuard) validate() error {
+	switch g.Mode {
+	case "", FeeGuardClamp, FeeGuardError, FeeGuardWarn:
+	default:
+		return fmt.Errorf("unknown fee guard mode '%s' - must be clamp, error or warn", g.Mode)
+	}
+	if g.MaxRatio != 0 && g.MaxRatio <= 1 {
+		return fmt.Errorf("fee guard max ratio must be greater than 1 (got %g)", g.MaxRatio)
+	}
+	if g.Window < 0 {
+		return fmt.Errorf("fee guard window must be non-negative (got %d)", g.Window)
+	}
+	return nil
+}
+
+// Check returns the rate to plan with. Outliers yield a non-nil anomaly; in
+// error mode they also yield an error. Accepted rates feed the rolling median.
+func (g *FeeGuard) Check(rate FeeRate, confTarget int) (FeeRate, *FeeAnomaly, error) {
+	if rate <= 0 {
+		return 0, nil, fmt.Errorf("fee rate must be positive (got %s)", rate)
+	}
+	ref, source := g.reference(confTarget)
+	ratio := g.MaxRatio
+	if ratio == 0 {
+		ratio = defaultFeeGuardMaxRatio
+	}
+	applied := rate
+	if ref > 0 {
+		hi := FeeRate(float64(ref) * ratio)
+		lo := FeeRate(float64(ref) / ratio)
+		if lo < 1 {
+			lo = 1
+		}
+		if rate > hi {
+			applied = hi
+		} else if rate < lo {
+			applied = lo
+		}
+	}
+	if applied == rate {
+		g.record(rate)
+		return rate, nil, nil
+	}
+
+	an := &FeeAnomaly{Rate: rate, Reference: ref, Source: source}
+	switch g.Mode {
+	case FeeGuardError:
+		return 0, an, fmt.Errorf("%s - check the fee provider or raise the fee guard ratio", an)
+	case FeeGuardWarn:
+		applied = rate
+	}
+	an.Applied = applied
+	g.record(applied)
+	return applied, an, nil
+}
+
+// Reference rate from the secondary provider, falling back to the rolling median
+func (g *FeeGuard) reference(confTarget int) (FeeRate, string) {
+	if g.Secondary != nil {
+		if r, err := g.Secondary.EstimateFeeRate(confTarget); err == nil && r > 0 {
+			return r, "secondary"
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.samples) < feeGuardMinSamples {
+		return 0, ""
+	}
+	s := append([]FeeRate(nil), g.samples...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)/2], "median"
+}
+
+// Add an accepted rate to the rolling window
+func (g *FeeGuard) record(rate FeeRate) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w := g.Window
+	if w == 0 {
+		w = defaultFeeGuardWindow
+	}
+	g.samples = append(g.samples, rate)
+	if len(g.samples) > w {
+		g.samples = g.samples[len(g.samples)-w:]
+	}
+}
+
+// SetFeeGuard installs a guard for rates applied with UpdateFeeRate (nil disables it).
+func (s *Sweeper) SetFeeGuard(g *FeeGuard) error {
+	if g != nil {
+		if err := g.validate(); err != nil {
+			return err
+		}
+	}
+	s.feeGuard = g
+	return nil
+}
+
+// UpdateFeeRate asks provider for a rate for confTarget blocks, passes it
+// through the fee guard (if any) and makes the result the Sweeper's fee rate.
+// The anomaly, if any, is returned so callers can alert on it.
+func (s *Sweeper) UpdateFeeRate(provider FeeRateProvider, confTarget int) (FeeRate, *FeeAnomaly, error) {
+	if provider == nil {
+		return 0, nil, errors.New("no fee rate provider given")
+	}
+	rate, err := provider.EstimateFeeRate(confTarget)
+	if err != nil {
+		return 0, nil, fmt.Errorf("fee rate provider failed: %w", err)
+	}
+	var an *FeeAnomaly
+	if s.feeGuard != nil {
+		rate, an, err = s.feeGuard.Check(rate, confTarget)
+		if an != nil {
+			s.logger.Printf("fee guard (%s): %s", s.feeGuardMode(), an)
+		}
+		if err != nil {
+			return 0, an, err
+		}
+	}
+	if err := s.SetFeeRateKVB(rate); err != nil {
+		return 0, an, err
+	}
+	return rate, an, nil
+}
+
+// Effective fee guard mode ("" when no guard is installed)
+func (s *Sweeper) feeGuardMode() FeeGuardMode {
+	if s.feeGuard == nil {
+		return ""
+	}
+	if s.feeGuard.Mode == "" {
+		return FeeGuardClamp
+	}
+	return s.feeGuard.Mode
+}
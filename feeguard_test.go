@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+type fixedFee int64
+
+func (f fixedFee) EstimateFeeRate(int) (FeeRate, error) { return SatPerVByte(int64(f)), nil }
+
+func TestFeeGuardClampsOutlierAgainstMedian(t *testing.T) {
+	s := newTestSweeper(t)
+	if err := s.SetFeeGuard(&FeeGuard{}); err != nil {
+		t.Fatalf("SetFeeGuard: %v", err)
+	}
+	for _, r := range []int64{10, 12, 11} {
+		if _, an, err := s.UpdateFeeRate(fixedFee(r), 6); err != nil || an != nil {
+			t.Fatalf("normal rate %d flagged: %v %v", r, an, err)
+		}
+	}
+	rate, an, err := s.UpdateFeeRate(fixedFee(900), 6)
+	if err != nil || an == nil {
+		t.Fatalf("expected a clamped anomaly, got %v %v", an, err)
+	}
+	if rate != SatPerVByte(33) || s.feeRate != SatPerVByte(33) || an.Source != "median" {
+		t.Fatalf("expected a clamp to 3x the median of 11, got %d (%+v)", rate, an)
+	}
+}
+
+func TestFeeGuardModesWithSecondary(t *testing.T) {
+	g := &FeeGuard{Mode: FeeGuardError, Secondary: fixedFee(20)}
+	if _, an, err := g.Check(SatPerVByte(900), 2); err == nil || an == nil || an.Source != "secondary" {
+		t.Fatalf("expected error mode to refuse the outlier, got %v %v", an, err)
+	}
+	g.Mode = FeeGuardWarn
+	if rate, an, err := g.Check(SatPerVByte(900), 2); err != nil || an == nil || rate != SatPerVByte(900) {
+		t.Fatalf("expected warn mode to keep the rate, got %d %v %v", rate, an, err)
+	}
+	if rate, an, _ := g.Check(SatPerVByte(25), 2); an != nil || rate != SatPerVByte(25) {
+		t.Fatalf("rate within ratio should pass, got %d %v", rate, an)
+	}
+	if err := (&FeeGuard{Mode: "panic"}).validate(); err == nil {
+		t.Fatalf("expected unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,149 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the minimum relay fee and absurd-fee guards.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// defaultMinRelayFeeRate is Bitcoin Core's default -minrelaytxfee.
+const defaultMinRelayFeeRate FeeRate = 1000
+
+// FeeLimitKind names the fee guard a plan failed.
+type FeeLimitKind string
+
+const (
+	FeeBelowMinRelay   FeeLimitKind = "below_min_relay"   // Fee rate under the relay floor
+	FeeAboveMaxSats    FeeLimitKind = "above_max_sats"    // Absolute fee over the cap
+	FeeAboveMaxRate    FeeLimitKind = "above_max_rate"    // Fee rate over the cap
+	FeeAbovePercent    FeeLimitKind = "above_percent"     // Fee over the share of the amount sent
+	FeeBelowMinPackage FeeLimitKind = "below_min_package" // Package with unconfirmed ancestors under SetMinPackageFeeRate
+)
+
+// FeeLimitError reports a plan whose fee breaks a limit set with
+// SetFeeLimits; test for it with errors.As.
+type FeeLimitError struct {
+	Kind    FeeLimitKind
+	FeeSats int64
+	VBytes  int64
+	Limit   float64 // sat/vB, sats or percent, by Kind
+	Reason  string
+}
+
+// Error implements error.
+func (e *FeeLimitError) Error() string {
+	return e.Reason + " - check the fee rate or adjust SetFeeLimits"
+}
+
+// ErrFeeCapExceeded matches, with errors.Is, a *FeeLimitError for a fee over
+// one of the operator's caps (absolute, rate or percentage) rather than under
+// a relay floor: the plan is valid but needs a human to accept the fee, so
+// callers can route it to an approval workflow.
+var ErrFeeCapExceeded = errors.New("fee cap exceeded")
+
+// Is reports whether target is ErrFeeCapExceeded and the error is a cap.
+func (e *FeeLimitError) Is(target error) bool {
+	if target != ErrFeeCapExceeded {
+		return false
+	}
+	switch e.Kind {
+	case FeeAboveMaxSats, FeeAboveMaxRate, FeeAbovePercent:
+		return true
+	}
+	return false
+}
+
+// SetFeeLimits guards every plan against unbroadcastable and wildly
+// overpaying fees. minRelayFeeRate is the lowest fee rate in sat/vB a plan
+// may pay (0 = 1, Core's default relay floor); maxFeeSats caps the absolute
+// fee (0 = unlimited) and maxFeePercent caps the fee as a percentage of the
+// amount sent to recipients (0 = unlimited). Plans breaking them fail with a
+// *FeeLimitError, and the broadcast preflight repeats the checks against the
+// signed transaction's actual size. SetMaxFeeRate adds a fee rate cap.
+func (s *Sweeper) SetFeeLimits(minRelayFeeRate, maxFeeSats int64, maxFeePercent float64) error {
+	if minRelayFeeRate < 0 || maxFeeSats < 0 || maxFeePercent < 0 || math.IsNaN(maxFeePercent) {
+		return fmt.Errorf("fee limits must be non-negative (got min relay %d sat/vB, max %d sats, max %g%%)", minRelayFeeRate, maxFeeSats, maxFeePercent)
+	}
+	s.minRelayFeeRate, s.maxFeeSats, s.maxFeePercent = SatPerVByte(minRelayFeeRate), maxFeeSats, maxFeePercent
+	return nil
+}
+
+// SetMinRelayFeeRateKVB sets the relay floor of SetFeeLimits in sat/kvB, for
+// nodes relaying below 1 sat/vB (e.g. 100 for -minrelaytxfee=0.000001);
+// 0 restores the 1 sat/vB default.
+func (s *Sweeper) SetMinRelayFeeRateKVB(rate FeeRate) error {
+	if rate < 0 {
+		return fmt.Errorf("minimum relay fee rate must be non-negative (got %d sat/kvB)", rate)
+	}
+	s.minRelayFeeRate = rate
+	return nil
+}
+
+// SetMaxFeeRate caps the effective fee rate of every plan, e.g. against a
+// fee provider reporting a spike or a mistyped rate (0 = unlimited). Plans
+// over it fail with a *FeeLimitError matching ErrFeeCapExceeded.
+func (s *Sweeper) SetMaxFeeRate(rate FeeRate) error {
+	if rate < 0 {
+		return fmt.Errorf("maximum fee rate must be non-negative (got %d sat/kvB)", rate)
+	}
+	s.maxFeeRate = rate
+	return nil
+}
+
+// Caps of a plan with settings st: the Sweeper's, tightened by any the plan
+// was made with
+func (s *Sweeper) planFeeCaps(st PlanSettings) (int64, FeeRate) {
+	return lowerCap(s.maxFeeSats, st.MaxFeeSats), FeeRate(lowerCap(int64(s.maxFeeRate), int64(st.MaxFeeRate)))
+}
+
+// Lower of two caps where 0 means unlimited
+func lowerCap(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Effective relay floor
+func (s *Sweeper) minRelayRate() FeeRate {
+	if s.minRelayFeeRate == 0 {
+		return defaultMinRelayFeeRate
+	}
+	return s.minRelayFeeRate
+}
+
+// Check a fee of vbytes-sized transaction paying outputs against the relay
+// floor, the percentage cap and the given absolute and rate caps
+func (s *Sweeper) checkFeeLimits(fee, vbytes int64, outputs []TxOutput, changeIdxs []int, maxFeeSats int64, maxFeeRate FeeRate) error {
+	if floor := s.minRelayRate(); fee < floor.Fee(vbytes) {
+		return &FeeLimitError{Kind: FeeBelowMinRelay, FeeSats: fee, VBytes: vbytes, Limit: floor.SatPerVB(),
+			Reason: fmt.Sprintf("fee of %d sats for %d vB is below the minimum relay fee rate of %s; nodes would not relay it", fee, vbytes, floor)}
+	}
+	if maxFeeSats > 0 && fee > maxFeeSats {
+		return &FeeLimitError{Kind: FeeAboveMaxSats, FeeSats: fee, VBytes: vbytes, Limit: float64(maxFeeSats),
+			Reason: fmt.Sprintf("fee of %d sats exceeds the maximum of %d sats", fee, maxFeeSats)}
+	}
+	if maxFeeRate > 0 && fee > maxFeeRate.Fee(vbytes) {
+		return &FeeLimitError{Kind: FeeAboveMaxRate, FeeSats: fee, VBytes: vbytes, Limit: maxFeeRate.SatPerVB(),
+			Reason: fmt.Sprintf("fee of %d sats for %d vB (%.2f sat/vB) exceeds the maximum fee rate of %s", fee, vbytes, float64(fee)/float64(vbytes), maxFeeRate)}
+	}
+	if s.maxFeePercent > 0 {
+		change := map[int]bool{}
+		for _, i := range changeIdxs {
+			change[i] = true
+		}
+		var sent int64
+		for i, o := range outputs {
+			if !change[i] {
+				sent += o.ValueSats
+			}
+		}
+		if sent > 0 && float64(fee) > float64(sent)*s.maxFeePercent/100 {
+			return &FeeLimitError{Kind: FeeAbovePercent, FeeSats: fee, VBytes: vbytes, Limit: s.maxFeePercent,
+				Reason: fmt.Sprintf("fee of %d sats is %.2f%% of the %d sats sent, above the maximum of %g%%", fee, float64(fee)*100/float64(sent), sent, s.maxFeePercent)}
+		}
+	}
+	return nil
+}
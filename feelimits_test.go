@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFeeLimits(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	send := []TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}}
+	if err := s.SetFeeLimits(-1, 0, 0); err == nil {
+		t.Fatalf("expected negative limits to be refused")
+	}
+
+	cases := []struct {
+		minRelay, maxSats int64
+		maxPercent        float64
+		want              FeeLimitKind
+	}{
+		{10, 0, 0, FeeBelowMinRelay},
+		{0, 500, 0, FeeAboveMaxSats},
+		{0, 0, 2.5, FeeAbovePercent},
+	}
+	for _, c := range cases {
+		_ = s.SetFeeLimits(c.minRelay, c.maxSats, c.maxPercent)
+		_, err := s.Spend(send)
+		var fe *FeeLimitError
+		if !errors.As(err, &fe) || fe.Kind != c.want || fe.FeeSats == 0 {
+			t.Fatalf("limits %+v: expected %s, got %v", c, c.want, err)
+		}
+	}
+
+	// Within the limits the plan goes through; tightening them before
+	// broadcast is caught by the preflight
+	_ = s.SetFeeLimits(0, 0, 5)
+	plan, err := s.Spend(send)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx
+	_ = s.SetFeeLimits(0, plan.FeeSats-1, 0)
+	var pe *PreflightError
+	if _, err := s.BroadcastPlan(plan.ID, &recordingBroadcaster{}); !errors.As(err, &pe) || pe.Failed[0].Validator != "fee" {
+		t.Fatalf("expected the fee preflight to fail, got %v", err)
+	}
+}
+
+func TestOptsFeeCaps(t *testing.T) {
+	s := newTestSweeper(t, WithFeeCaps(0, SatPerVByte(30)), WithOpts(Opts{FeeRateSatsVB: 5, MaxFeeSats: 400}))
+	if s.maxFeeSats != 400 || s.maxFeeRate != SatPerVByte(30) {
+		t.Fatalf("expected Opts to set the fee cap and keep the rate cap, got %d sats, %s", s.maxFeeSats, s.maxFeeRate)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}}, SpendOptions{FeeRate: 10}); !errors.Is(err, ErrFeeCapExceeded) {
+		t.Fatalf("expected the Opts fee cap, got %v", err)
+	}
+	s = newTestSweeper(t, WithOpts(Opts{FeeRateSatsVB: 5, MaxFeeRate: SatPerVByte(8)}))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	var fe *FeeLimitError
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}}, SpendOptions{FeeRate: 10}); !errors.As(err, &fe) || fe.Kind != FeeAboveMaxRate {
+		t.Fatalf("expected the Opts rate cap, got %v", err)
+	}
+	if _, err := NewSweeper(nil, BitcoinRegtest, WithOpts(Opts{MaxFeeSats: -1})); err == nil || !strings.Contains(err.Error(), "fee caps") {
+		t.Fatalf("expected a negative cap to be rejected like WithFeeCaps, got %v", err)
+	}
+}
+
+func TestFeeCaps(t *testing.T) {
+	s := newTestSweeper(t, WithFeeRate(5), WithFeeCaps(0, SatPerVByte(20)))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	send := []TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}}
+
+	_, err := s.Spend(send, SpendOptions{FeeRate: 25})
+	var fe *FeeLimitError
+	if !errors.As(err, &fe) || fe.Kind != FeeAboveMaxRate || !errors.Is(err, ErrFeeCapExceeded) {
+		t.Fatalf("expected the rate cap, got %v", err)
+	}
+	if _, err := s.Spend(send, SpendOptions{FeeRate: 20}); err != nil {
+		t.Fatalf("plan at the cap refused: %v", err)
+	}
+
+	// Per-call caps tighten the Sweeper's but never lift them
+	if _, err := s.Spend(send, SpendOptions{MaxFeeSats: 100}); !errors.Is(err, ErrFeeCapExceeded) {
+		t.Fatalf("expected the per-call sats cap, got %v", err)
+	}
+	if _, err := s.Spend(send, SpendOptions{FeeRate: 25, MaxFeeRate: SatPerVByte(50)}); !errors.Is(err, ErrFeeCapExceeded) {
+		t.Fatalf("per-call cap lifted the Sweeper's, got %v", err)
+	}
+	plan, err := s.Spend(send, SpendOptions{MaxFeeSats: 5_000})
+	if err != nil || plan.Settings.MaxFeeSats != 5_000 || plan.Settings.MaxFeeRate != SatPerVByte(20) {
+		t.Fatalf("caps not recorded: %+v, %v", plan.Settings, err)
+	}
+
+	// The relay floor is not a cap
+	_ = s.SetFeeLimits(10, 0, 0)
+	if _, err := s.Spend(send); err == nil || errors.Is(err, ErrFeeCapExceeded) {
+		t.Fatalf("relay floor reported as a cap: %v", err)
+	}
+	if err := s.SetMaxFeeRate(-1); err == nil {
+		t.Fatalf("expected a negative cap to be refused")
+	}
+}
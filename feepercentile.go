@@ -0,0 +1,154 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains fee rates priced at a percentile of the projected next block.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// defaultBlockVSize is the virtual size of a full block template.
+const defaultBlockVSize = 1_000_000
+
+// FeeHistogramBin is one bucket of a mempool fee histogram: VSize vbytes of
+// transactions paying at least FeeRate sat/vB and less than the next higher
+// bucket.
+type FeeHistogramBin struct {
+	FeeRate float64 `json:"fee_rate"` // sat/vB
+	VSize   int64   `json:"vsize"`
+}
+
+// FeeHistogramSource is a backend that reports the mempool's fee histogram.
+type FeeHistogramSource interface {
+	FeeHistogram() ([]FeeHistogramBin, error)
+}
+
+// FeeHistogram reads GET {BaseURL}/mempool, whose fee_histogram Esplora and
+// mempool.space both serve, caching it for CacheTTL like the estimates.
+func (p *EsploraFeeProvider) FeeHistogram() ([]FeeHistogramBin, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.histogram == nil || p.stale(p.histFetched) {
+		raw, err := p.get("/mempool")
+		if err != nil {
+			return nil, fmt.Errorf("fee histogram: %w", err)
+		}
+		var r struct {
+			Histogram [][2]float64 `json:"fee_histogram"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("fee histogram: invalid response: %w", err)
+		}
+		bins := make([]FeeHistogramBin, 0, len(r.Histogram))
+		for _, b := range r.Histogram {
+			if b[0] > 0 && b[1] > 0 && !math.IsInf(b[0], 0) {
+				bins = append(bins, FeeHistogramBin{FeeRate: b[0], VSize: int64(b[1])})
+			}
+		}
+		p.histogram, p.histFetched = bins, p.clock()
+	}
+	return append([]FeeHistogramBin(nil), p.histogram...), nil
+}
+
+// PercentileFeeStrategy is a FeeRateProvider that prices transactions at a
+// percentile of the block template the mempool would fill next, e.g. the 30th
+// percentile of the next block, rather than at a fixed sat/vB: the mempool's
+// highest-paying transactions fill the template and the rate is read where
+// Percentile percent of its vbytes pay less. Non-urgent consolidations using
+// it pay what the cheaper end of the next block pays and confirm as fees
+// allow. Floor and Ceiling clamp the result; when the template is not full,
+// anything confirms and the rate is the floor.
+type PercentileFeeStrategy struct {
+	Source     FeeHistogramSource
+	Percentile float64 // 0 to 100 by vbytes of the template
+	Floor      FeeRate // Lowest rate returned (0 = 1 sat/vB)
+	Ceiling    FeeRate // Highest rate returned (0 = unlimited)
+	Block      int     // Projected block priced against (0 = the next one)
+	BlockVSize int64   // vbytes per block template (0 = 1,000,000)
+}
+
+// NewPercentileFeeStrategy prices at percentile of the next block template of
+// source, clamped to floor and ceiling (0 = unclamped).
+func NewPercentileFeeStrategy(source FeeHistogramSource, percentile float64, floor, ceiling FeeRate) (*PercentileFeeStrategy, error) {
+	st := &PercentileFeeStrategy{Source: source, Percentile: percentile, Floor: floor, Ceiling: ceiling}
+	if err := st.validate(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// validate checks the source, percentile and clamps
+func (st *PercentileFeeStrategy) validate() error {
+	if st.Source == nil {
+		return errors.New("percentile fee strategy needs a fee histogram source")
+	}
+	if st.Percentile < 0 || st.Percentile > 100 || math.IsNaN(st.Percentile) {
+		return fmt.Errorf("fee percentile must be between 0 and 100 (got %g)", st.Percentile)
+	}
+	if st.Floor < 0 || st.Ceiling < 0 || st.Block < 0 || st.BlockVSize < 0 {
+		return errors.New("fee percentile floor, ceiling, block and block size must be non-negative")
+	}
+	if st.Ceiling > 0 && st.Floor > st.Ceiling {
+		return fmt.Errorf("fee percentile floor %s is above the ceiling %s", st.Floor, st.Ceiling)
+	}
+	return nil
+}
+
+// EstimateFeeRate prices at the percentile of the projected block; the
+// confirmation target is not used.
+func (st *PercentileFeeStrategy) EstimateFeeRate(int) (FeeRate, error) {
+	if err := st.validate(); err != nil {
+		return 0, err
+	}
+	bins, err := st.Source.FeeHistogram()
+	if err != nil {
+		return 0, err
+	}
+	blockVB := st.BlockVSize
+	if blockVB == 0 {
+		blockVB = defaultBlockVSize
+	}
+	rate := st.Floor
+	if rate == 0 {
+		rate = SatPerVByte(1)
+	}
+	if r := histogramPercentile(bins, st.Percentile, int64(st.Block)*blockVB, blockVB); r > 0 {
+		if pr := ceilFeeRate(r); pr > rate {
+			rate = pr
+		}
+	}
+	if st.Ceiling > 0 && rate > st.Ceiling {
+		rate = st.Ceiling
+	}
+	return rate, nil
+}
+
+// Rate in sat/vB below which pct percent of the vbytes of a block template
+// pay, the template holding the blockVB vbytes after the first skipVB of the
+// mempool in descending fee-rate order; 0 when the template is not full
+func histogramPercentile(bins []FeeHistogramBin, pct float64, skipVB, blockVB int64) float64 {
+	sorted := append([]FeeHistogramBin(nil), bins...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FeeRate > sorted[j].FeeRate })
+	var total int64
+	for _, b := range sorted {
+		total += b.VSize
+	}
+	if total < skipVB+blockVB {
+		return 0
+	}
+	// The pct-th percentile from the bottom is (100-pct)% down from the top
+	target := skipVB + int64(math.Ceil(float64(blockVB)*(100-pct)/100))
+	if target <= skipVB {
+		target = skipVB + 1
+	}
+	var cum int64
+	for _, b := range sorted {
+		if cum += b.VSize; cum >= target {
+			return b.FeeRate
+		}
+	}
+	return 0
+}
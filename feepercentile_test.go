@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type staticHistogram []FeeHistogramBin
+
+func (h staticHistogram) FeeHistogram() ([]FeeHistogramBin, error) { return h, nil }
+
+type failingHistogram struct{}
+
+func (failingHistogram) FeeHistogram() ([]FeeHistogramBin, error) {
+	return nil, errors.New("backend down")
+}
+
+func TestPercentileFeeStrategy(t *testing.T) {
+	// 1.5 MvB of mempool: the next block holds the 40, 20 and 10 sat/vB bins
+	// (200k, 300k and 500k vB), the 5 sat/vB bin waits for the one after
+	hist := staticHistogram{{FeeRate: 10, VSize: 500_000}, {FeeRate: 40, VSize: 200_000}, {FeeRate: 5, VSize: 500_000}, {FeeRate: 20, VSize: 300_000}}
+	for pct, want := range map[float64]FeeRate{30: SatPerVByte(10), 60: SatPerVByte(20), 90: SatPerVByte(40), 0: SatPerVByte(10), 100: SatPerVByte(40)} {
+		st, err := NewPercentileFeeStrategy(hist, pct, 0, 0)
+		if err != nil {
+			t.Fatalf("NewPercentileFeeStrategy: %v", err)
+		}
+		if got, err := st.EstimateFeeRate(6); err != nil || got != want {
+			t.Fatalf("percentile %g: got %s, %v; want %s", pct, got, err, want)
+		}
+	}
+
+	// Clamps, and the floor when the template is not full
+	st, _ := NewPercentileFeeStrategy(hist, 30, SatPerVByte(12), SatPerVByte(15))
+	if got, _ := st.EstimateFeeRate(1); got != SatPerVByte(12) {
+		t.Fatalf("floor not applied: %s", got)
+	}
+	st, _ = NewPercentileFeeStrategy(hist, 90, 0, SatPerVByte(15))
+	if got, _ := st.EstimateFeeRate(1); got != SatPerVByte(15) {
+		t.Fatalf("ceiling not applied: %s", got)
+	}
+	st, _ = NewPercentileFeeStrategy(staticHistogram{{FeeRate: 50, VSize: 10_000}}, 30, FeeRateFromSatPerVB(1.5), 0)
+	if got, _ := st.EstimateFeeRate(1); got != 1500 {
+		t.Fatalf("a block that is not full should price at the floor, got %s", got)
+	}
+
+	if _, err := NewPercentileFeeStrategy(hist, 101, 0, 0); err == nil {
+		t.Fatalf("expected a percentile above 100 to be rejected")
+	}
+	if _, err := NewPercentileFeeStrategy(hist, 30, SatPerVByte(20), SatPerVByte(10)); err == nil {
+		t.Fatalf("expected a floor above the ceiling to be rejected")
+	}
+
+	// Plans take the strategy's rate through the fee rate provider hook
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	st, _ = NewPercentileFeeStrategy(hist, 60, 0, 0)
+	if err := s.SetFeeRateProvider(st, 0); err != nil {
+		t.Fatalf("SetFeeRateProvider: %v", err)
+	}
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}})
+	if err != nil || plan.Settings.FeeRate != 20 {
+		t.Fatalf("expected a plan at 20 sat/vB, got %v %v", plan, err)
+	}
+	st.Source = failingHistogram{}
+	if _, err := st.EstimateFeeRate(1); err == nil {
+		t.Fatalf("expected a histogram failure to be reported")
+	}
+}
+
+func TestEsploraFeeHistogram(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/api/mempool" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"count": 3, "vsize": 1600000, "fee_histogram": [[40.5, 200000], [20, 300000], [10, 1100000], [0, 5]]}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewEsploraFeeProvider(srv.URL + "/api")
+	if err != nil {
+		t.Fatalf("NewEsploraFeeProvider: %v", err)
+	}
+	bins, err := p.FeeHistogram()
+	if err != nil || len(bins) != 3 || bins[0].FeeRate != 40.5 || bins[2].VSize != 1_100_000 {
+		t.Fatalf("FeeHistogram: %+v, %v", bins, err)
+	}
+	st, _ := NewPercentileFeeStrategy(p, 90, 0, 0)
+	if got, err := st.EstimateFeeRate(1); err != nil || got != 40_500 {
+		t.Fatalf("90th percentile: got %s, %v", got, err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected the histogram to be cached, got %d requests", calls)
+	}
+}
@@ -0,0 +1,251 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains live fee rates from mempool.space and Esplora backends.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MempoolSpaceAPI is the base URL of the public mempool.space API.
+const MempoolSpaceAPI = "https://mempool.space/api"
+
+const (
+	defaultFeeProviderTimeout  = 10 * time.Second
+	defaultFeeProviderCacheTTL = time.Minute
+	defaultFeeConfTarget       = 6
+)
+
+// EsploraFeeProvider is a FeeRateProvider backed by an Esplora-compatible
+// HTTP API (Blockstream's Esplora, mempool.space and their self-hosted
+// instances). It reads GET {BaseURL}/fee-estimates, or with Recommended set
+// mempool.space's GET {BaseURL}/v1/fees/recommended, and caches the answer
+// for CacheTTL so planning many transactions costs one request. Rates are
+// rounded up to whole sat/kvB, so fractional sat/vB estimates are kept. It is
+// safe for concurrent use.
+type EsploraFeeProvider struct {
+	BaseURL     string        // e.g. MempoolSpaceAPI or "https://blockstream.info/api"
+	Recommended bool          // Use mempool.space's recommended fees instead of fee-estimates
+	Timeout     time.Duration // Per request (0 = 10s)
+	CacheTTL    time.Duration // How long estimates are reused (0 = 1 minute, negative = never)
+	Client      *http.Client  // nil = http.DefaultClient; Timeout still bounds each request
+
+	mu          sync.Mutex
+	estimates   map[int]float64 // sat/vB by confirmation target
+	fetched     time.Time
+	histogram   []FeeHistogramBin // Mempool fee histogram (see FeeHistogram)
+	histFetched time.Time
+	now         func() time.Time // Clock for the cache (nil = time.Now)
+}
+
+// mempool.space /v1/fees/recommended response
+type recommendedFees struct {
+	Fastest  float64 `json:"fastestFee"`
+	HalfHour float64 `json:"halfHourFee"`
+	Hour     float64 `json:"hourFee"`
+	Economy  float64 `json:"economyFee"`
+	Minimum  float64 `json:"minimumFee"`
+}
+
+// NewEsploraFeeProvider checks the base URL. It must be https; plain http is
+// accepted only for loopback addresses.
+func NewEsploraFeeProvider(baseURL string) (*EsploraFeeProvider, error) {
+	if err := checkAPIURL("fee provider", baseURL); err != nil {
+		return nil, err
+	}
+	return &EsploraFeeProvider{BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// Check that an HTTP API base URL is absolute and https (http for loopback)
+func checkAPIURL(what, baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%s URL %q must be an absolute https URL", what, baseURL)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return fmt.Errorf("%s URL %q must use https (http only for loopback)", what, baseURL)
+	}
+	return nil
+}
+
+// EstimateFeeRate returns the rate for the nearest published target at or
+// below confTarget (the fastest one when confTarget is below them all).
+func (p *EsploraFeeProvider) EstimateFeeRate(confTarget int) (FeeRate, error) {
+	if confTarget <= 0 {
+		return 0, fmt.Errorf("confirmation target must be positive (got %d)", confTarget)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.estimates == nil || p.stale(p.fetched) {
+		est, err := p.fetch()
+		if err != nil {
+			return 0, err
+		}
+		p.estimates, p.fetched = est, p.clock()
+	}
+	return pickEstimate(p.estimates, confTarget)
+}
+
+// Current time on the provider's clock
+func (p *EsploraFeeProvider) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// Whether an answer fetched at fetched is past CacheTTL
+func (p *EsploraFeeProvider) stale(fetched time.Time) bool {
+	ttl := p.CacheTTL
+	if ttl == 0 {
+		ttl = defaultFeeProviderCacheTTL
+	}
+	return ttl < 0 || p.clock().Sub(fetched) >= ttl
+}
+
+// Download the estimates, keyed by confirmation target
+func (p *EsploraFeeProvider) fetch() (map[int]float64, error) {
+	path := "/fee-estimates"
+	if p.Recommended {
+		path = "/v1/fees/recommended"
+	}
+	raw, err := p.get(path)
+	if err != nil {
+		return nil, fmt.Errorf("fee estimates: %w", err)
+	}
+
+	est := map[int]float64{}
+	if p.Recommended {
+		var r recommendedFees
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("fee estimates: invalid response: %w", err)
+		}
+		// mempool.space's targets: next block, 30 minutes, 1 hour, then economy
+		est = map[int]float64{1: r.Fastest, 3: r.HalfHour, 6: r.Hour, 144: r.Economy}
+		if r.Economy == 0 {
+			est[144] = r.Minimum
+		}
+	} else {
+		var byTarget map[string]float64
+		if err := json.Unmarshal(raw, &byTarget); err != nil {
+			return nil, fmt.Errorf("fee estimates: invalid response: %w", err)
+		}
+		for k, v := range byTarget {
+			n, err := strconv.Atoi(k)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("fee estimates: invalid confirmation target %q", k)
+			}
+			est[n] = v
+		}
+	}
+	for n, v := range est {
+		if v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			delete(est, n)
+		}
+	}
+	if len(est) == 0 {
+		return nil, errors.New("fee estimates: response has no usable rates")
+	}
+	return est, nil
+}
+
+// GET a path under BaseURL within Timeout
+func (p *EsploraFeeProvider) get(path string) ([]byte, error) {
+	return httpGet(p.Client, p.Timeout, p.BaseURL+path)
+}
+
+// errHTTPNotFound wraps the 404 an API answers for unknown transactions
+var errHTTPNotFound = errors.New("not found")
+
+// GET target within timeout (0 = 10s) and return up to 1 MiB of a 200 response
+func httpGet(client *http.Client, timeout time.Duration, target string) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = defaultFeeProviderTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", target, errHTTPNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(target + " returned " + resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// Rate for the highest target at or below confTarget, rounded up to a whole sat/kvB
+func pickEstimate(est map[int]float64, confTarget int) (FeeRate, error) {
+	targets := make([]int, 0, len(est))
+	for n := range est {
+		targets = append(targets, n)
+	}
+	if len(targets) == 0 {
+		return 0, errors.New("no fee estimates available")
+	}
+	sort.Ints(targets)
+	pick := targets[0]
+	for _, n := range targets {
+		if n <= confTarget {
+			pick = n
+		}
+	}
+	return ceilFeeRate(est[pick]), nil
+}
+
+// sat/vB rounded up to a whole sat/kvB
+func ceilFeeRate(satPerVB float64) FeeRate {
+	// Round away float noise (40.2 * 1000 is 40200.000000000004) before rounding up
+	return FeeRate(math.Ceil(math.Round(satPerVB*1e6) / 1000))
+}
+
+// SetFeeRateProvider makes planning ask provider for a rate to confirm within
+// confTarget blocks (0 = 6) instead of using the static fee rate. Each plan
+// that does not set SpendOptions.FeeRate or FeeRateKVB refreshes the rate through
+// UpdateFeeRate, so the fee guard still applies. When the provider fails, the
+// last rate is kept and the failure logged. nil restores the static rate.
+func (s *Sweeper) SetFeeRateProvider(provider FeeRateProvider, confTarget int) error {
+	if confTarget < 0 {
+		return fmt.Errorf("confirmation target must be non-negative (got %d)", confTarget)
+	}
+	if provider != nil && s.offline {
+		return errors.New("offline mode cannot consult a fee rate provider - set the fee rate instead")
+	}
+	if confTarget == 0 {
+		confTarget = defaultFeeConfTarget
+	}
+	s.feeProvider, s.feeConfTarget = provider, confTarget
+	return nil
+}
+
+// Refresh the fee rate from the provider, if one is set
+func (s *Sweeper) refreshFeeRate() {
+	if s.feeProvider == nil {
+		return
+	}
+	if _, _, err := s.UpdateFeeRate(s.feeProvider, s.feeConfTarget); err != nil {
+		s.logger.Printf("fee rate provider: %v - keeping %s", err, s.feeRate)
+	}
+}
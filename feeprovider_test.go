@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEsploraFeeProvider(t *testing.T) {
+	var calls int32
+	status := int32(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		switch r.URL.Path {
+		case "/api/fee-estimates":
+			_, _ = w.Write([]byte(`{"1": 40.2, "2": 31.0, "6": 12.5, "25": 4.0, "144": 1.001}`))
+		case "/api/v1/fees/recommended":
+			_, _ = w.Write([]byte(`{"fastestFee": 30, "halfHourFee": 20, "hourFee": 10, "economyFee": 3, "minimumFee": 1}`))
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := NewEsploraFeeProvider("http://example.com/api"); err == nil {
+		t.Fatalf("expected plain http to a remote host to be refused")
+	}
+	p, err := NewEsploraFeeProvider(srv.URL + "/api/")
+	if err != nil {
+		t.Fatalf("NewEsploraFeeProvider: %v", err)
+	}
+	clock := time.Unix(1_700_000_000, 0)
+	p.now = func() time.Time { return clock }
+	for target, want := range map[int]FeeRate{1: 40_200, 3: 31_000, 6: 12_500, 100: 4_000, 1008: 1_001} {
+		if got, err := p.EstimateFeeRate(target); err != nil || got != want {
+			t.Fatalf("target %d: got %d, %v; want %d", target, got, err, want)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected one request while cached, got %d", calls)
+	}
+
+	// An expired cache refetches; failures are reported
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	clock = clock.Add(2 * time.Minute)
+	if _, err := p.EstimateFeeRate(6); err == nil {
+		t.Fatalf("expected a 503 to fail")
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	rec, _ := NewEsploraFeeProvider(srv.URL + "/api")
+	rec.Recommended = true
+	if got, err := rec.EstimateFeeRate(2); err != nil || got != SatPerVByte(30) {
+		t.Fatalf("recommended target 2: got %d, %v", got, err)
+	}
+	if got, _ := rec.EstimateFeeRate(12); got != SatPerVByte(10) {
+		t.Fatalf("recommended target 12: got %d", got)
+	}
+}
+
+type failingFee struct{}
+
+func (failingFee) EstimateFeeRate(int) (FeeRate, error) { return 0, errors.New("backend down") }
+
+func TestSweeperConsultsFeeRateProvider(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	if err := s.SetFeeRateProvider(fixedFee(17), 0); err != nil || s.feeConfTarget != defaultFeeConfTarget {
+		t.Fatalf("SetFeeRateProvider: %v", err)
+	}
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if plan.Settings.FeeRate != 17 {
+		t.Fatalf("expected the provider's rate, planned at %d", plan.Settings.FeeRate)
+	}
+	// Explicit per-call rates win, and a failing provider keeps the last rate
+	if plan, _ := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}, SpendOptions{FeeRate: 3}); plan.Settings.FeeRate != 3 {
+		t.Fatalf("per-call rate ignored: %d", plan.Settings.FeeRate)
+	}
+	_ = s.SetFeeRateProvider(failingFee{}, 2)
+	if plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err != nil || plan.Settings.FeeRate != 17 {
+		t.Fatalf("expected the last rate after a provider failure, got %+v, %v", plan, err)
+	}
+	if err := s.SetOfflineMode(true); err == nil {
+		t.Fatalf("expected the fee provider to block offline mode")
+	}
+}
@@ -0,0 +1,60 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the sat/kvB fee rate type used throughout planning.
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// FeeRate is a fee rate in satoshis per 1000 virtual bytes (sat/kvB), the
+// unit Bitcoin Core uses internally, so fractional sat/vB rates such as
+// 1.5 sat/vB (1500) are exact.
+type FeeRate int64
+
+// SatPerVByte converts a whole sat/vB rate to a FeeRate.
+func SatPerVByte(rate int64) FeeRate {
+	return FeeRate(rate * 1000)
+}
+
+// FeeRateFromSatPerVB converts a sat/vB rate such as 1.5, rounding to the
+// nearest sat/kvB.
+func FeeRateFromSatPerVB(rate float64) FeeRate {
+	return FeeRate(math.Round(rate * 1000))
+}
+
+// Fee returns the fee for vbytes at the rate, rounded up to a whole satoshi
+// so the transaction never pays less than the rate.
+func (r FeeRate) Fee(vbytes int64) int64 {
+	return (vbytes*int64(r) + 999) / 1000
+}
+
+// SatPerVB returns the rate in sat/vB.
+func (r FeeRate) SatPerVB() float64 {
+	return float64(r) / 1000
+}
+
+// CeilSatPerVB returns the rate in whole sat/vB, rounded up.
+func (r FeeRate) CeilSatPerVB() int64 {
+	return (int64(r) + 999) / 1000
+}
+
+// String formats the rate in sat/vB, e.g. "1.5 sat/vB".
+func (r FeeRate) String() string {
+	return strconv.FormatFloat(r.SatPerVB(), 'f', -1, 64) + " sat/vB"
+}
+
+// SetFeeRateKVB sets the fee rate in sat/kvB, e.g. 1500 for 1.5 sat/vB.
+func (s *Sweeper) SetFeeRateKVB(rate FeeRate) error {
+	if rate <= 0 {
+		return fmt.Errorf("fee rate must be positive (got %d sat/kvB) - try values like 1000-100000", rate)
+	}
+	s.feeRate = rate
+	return nil
+}
+
+// FeeRate returns the Sweeper's default fee rate.
+func (s *Sweeper) FeeRate() FeeRate {
+	return s.feeRate
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFeeRateUnits(t *testing.T) {
+	r := FeeRateFromSatPerVB(1.5)
+	if r != 1500 || r.String() != "1.5 sat/vB" || r.CeilSatPerVB() != 2 {
+		t.Fatalf("1.5 sat/vB: got %d (%s, ceil %d)", r, r, r.CeilSatPerVB())
+	}
+	// Fees round up so the rate is always met
+	if got := r.Fee(141); got != 212 {
+		t.Fatalf("fee for 141 vB at 1.5 sat/vB = %d, want 212", got)
+	}
+	if got := SatPerVByte(5).Fee(141); got != 705 {
+		t.Fatalf("whole rates must be unchanged, got %d", got)
+	}
+}
+
+func TestFractionalFeeRatePlanning(t *testing.T) {
+	s := newTestSweeper(t)
+	if err := s.SetFeeRateKVB(0); err == nil {
+		t.Fatalf("expected a zero rate to be refused")
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{FeeRate: 9, FeeRateKVB: 1500})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	vbytes := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	if plan.FeeSats != (vbytes*1500+999)/1000 {
+		t.Fatalf("fee %d for %d vB is not 1.5 sat/vB", plan.FeeSats, vbytes)
+	}
+	if plan.Settings.FeeRateKVB != 1500 || plan.Settings.FeeRate != 2 {
+		t.Fatalf("settings record %d sat/kvB (%d sat/vB)", plan.Settings.FeeRateKVB, plan.Settings.FeeRate)
+	}
+
+	// Config takes fractional sat/vB
+	var c Config
+	if err := json.Unmarshal([]byte(`{"fee_rate": 2.25, "min_relay_fee_rate": 0.1}`), &c); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if FeeRateFromSatPerVB(c.FeeRate) != 2250 || FeeRateFromSatPerVB(c.MinRelayFeeRate) != 100 {
+		t.Fatalf("config rates %g and %g", c.FeeRate, c.MinRelayFeeRate)
+	}
+}
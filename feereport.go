@@ -0,0 +1,101 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the per-plan fee breakdown report.
+package main
+
+// FeeReport explains how a plan's fee came out: the virtual size each input
+// and output contributes, the rate it was priced at, the dust threshold change
+// was settled against, and the parts of the fee beyond the rate. FeeSats is
+// always RateFeeSats + AncestorFeeSats + ChangeAdjustmentSats.
+type FeeReport struct {
+	FeeSats          int64   `json:"fee_sats"`
+	VBytes           int64   `json:"vbytes"`          // Estimated size the fee was priced on
+	OverheadVBytes   int64   `json:"overhead_vbytes"` // Version, counts and locktime
+	TargetFeeRate    float64 `json:"target_fee_rate"` // sat/vB the plan was built for
+	EffectiveFeeRate float64 `json:"effective_fee_rate"`
+	// Threshold below which change was given to the fee instead of an output
+	DustThresholdSats int64 `json:"dust_threshold_sats"`
+
+	RateFeeSats int64 `json:"rate_fee_sats"` // VBytes at the target rate
+	// Paid so the plan and its unconfirmed ancestors reach the package rate
+	AncestorFeeSats int64 `json:"ancestor_fee_sats"`
+	// The rest: change given to the fee because it fell below the dust
+	// threshold or within the changeless tolerance, or for sweeps without
+	// change the difference between their fee estimate and VBytes
+	ChangeAdjustmentSats int64 `json:"change_adjustment_sats"`
+
+	Inputs  []FeeReportItem `json:"inputs"`
+	Outputs []FeeReportItem `json:"outputs"`
+}
+
+// FeeReportItem is one input's or output's share of a plan's size and fee.
+type FeeReportItem struct {
+	Index     int    `json:"index"`
+	Outpoint  string `json:"outpoint,omitempty"` // txid:vout of inputs
+	Address   string `json:"address"`
+	ValueSats int64  `json:"value_sats"`
+	Change    bool   `json:"change,omitempty"`
+	VBytes    int64  `json:"vbytes"`
+	FeeSats   int64  `json:"fee_sats"` // VBytes at the target rate
+}
+
+// FeeReport returns the plan's fee breakdown, computed when it was planned,
+// for auditing why the fee came out the way it did. The result is a copy.
+func (p *TransactionPlan) FeeReport() FeeReport {
+	if p.feeReport == nil {
+		return FeeReport{FeeSats: p.FeeSats}
+	}
+	r := *p.feeReport
+	r.Inputs = append([]FeeReportItem(nil), r.Inputs...)
+	r.Outputs = append([]FeeReportItem(nil), r.Outputs...)
+	return r
+}
+
+// Break down a plan's fee priced at rate with change settled against dust
+func (s *Sweeper) buildFeeReport(plan *TransactionPlan, rate FeeRate, dust int64) *FeeReport {
+	overhead := estimateTxVBytesDetailed(s, nil, nil)
+	vbytes := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	r := &FeeReport{
+		FeeSats:           plan.FeeSats,
+		VBytes:            vbytes,
+		OverheadVBytes:    overhead,
+		TargetFeeRate:     rate.SatPerVB(),
+		DustThresholdSats: dust,
+		RateFeeSats:       rate.Fee(vbytes),
+	}
+	if vbytes > 0 {
+		r.EffectiveFeeRate = float64(plan.FeeSats) / float64(vbytes)
+	}
+	if ancVB := plan.PackageVBytes - vbytes; ancVB > 0 {
+		ancFee := plan.PackageFeeSats - plan.FeeSats
+		need := s.packageTarget(rate).Fee(plan.PackageVBytes) - ancFee - r.RateFeeSats
+		r.AncestorFeeSats = max64(need, 0)
+		if room := max64(plan.FeeSats-r.RateFeeSats, 0); r.AncestorFeeSats > room {
+			r.AncestorFeeSats = room
+		}
+	}
+	r.ChangeAdjustmentSats = plan.FeeSats - r.RateFeeSats - r.AncestorFeeSats
+	for i, in := range plan.Inputs {
+		vb := inputVBytes(s, in)
+		r.Inputs = append(r.Inputs, FeeReportItem{Index: i, Outpoint: outpointKey(in), Address: in.Address, ValueSats: in.ValueSats, VBytes: vb, FeeSats: rate.Fee(vb)})
+	}
+	for i, out := range plan.Outputs {
+		vb := estimateTxVBytesDetailed(s, nil, []TxOutput{out}) - overhead
+		r.Outputs = append(r.Outputs, FeeReportItem{Index: i, Address: out.Address, ValueSats: out.ValueSats, Change: plan.IsChange(i), VBytes: vb, FeeSats: rate.Fee(vb)})
+	}
+	return r
+}
+
+// Dust threshold change of a plan built with p is settled against: the one
+// planning recorded, or else the policy's for its change or first output
+func (s *Sweeper) reportDust(plan *TransactionPlan, p spendParams) int64 {
+	if p.changeDust > 0 {
+		return p.changeDust
+	}
+	switch {
+	case len(plan.ChangeIdxs) > 0:
+		return s.dustFor(plan.Outputs[plan.ChangeIdxs[0]].Address, p)
+	case len(plan.Outputs) > 0:
+		return s.dustFor(plan.Outputs[0].Address, p)
+	}
+	return 0
+}
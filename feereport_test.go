@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFeeReportBreakdown(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("e", 64), Vout: 1, ValueSats: 30_000, Address: testAddr("in2"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 110_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	r := plan.FeeReport()
+	if len(r.Inputs) != len(plan.Inputs) || len(r.Outputs) != len(plan.Outputs) {
+		t.Fatalf("report covers %d inputs and %d outputs, plan has %d and %d", len(r.Inputs), len(r.Outputs), len(plan.Inputs), len(plan.Outputs))
+	}
+	vb := r.OverheadVBytes
+	for _, it := range append(r.Inputs, r.Outputs...) {
+		vb += it.VBytes
+	}
+	if vb != r.VBytes || r.VBytes != estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs) {
+		t.Fatalf("contributions sum to %d vB, report says %d", vb, r.VBytes)
+	}
+	if r.FeeSats != plan.FeeSats || r.RateFeeSats+r.AncestorFeeSats+r.ChangeAdjustmentSats != r.FeeSats {
+		t.Fatalf("fee %d does not reconcile: %+v", plan.FeeSats, r)
+	}
+	if r.TargetFeeRate != 5 || r.DustThresholdSats <= 0 || !r.Outputs[len(r.Outputs)-1].Change {
+		t.Fatalf("unexpected rate, dust or change flag: %+v", r)
+	}
+	b, err := json.Marshal(r)
+	if err != nil || !json.Valid(b) {
+		t.Fatalf("report does not marshal: %v", err)
+	}
+
+	// Sub-dust change given to the fee is the change adjustment
+	_ = s.DiscardPlan(plan.ID)
+	amount := 130_000 - plan.FeeSats - 100
+	absorbed, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: amount}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if r := absorbed.FeeReport(); r.ChangeAdjustmentSats != absorbed.DustChangeSats || r.ChangeAdjustmentSats <= 0 {
+		t.Fatalf("change adjustment %d, want the %d sats of dust change", r.ChangeAdjustmentSats, absorbed.DustChangeSats)
+	}
+
+	// The report is persisted with the plan
+	s2 := newTestSweeper(t, WithKV(kv))
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	got, _ := s2.GetPlan(absorbed.ID)
+	if got == nil || got.FeeReport().ChangeAdjustmentSats != absorbed.DustChangeSats || len(got.FeeReport().Inputs) != len(absorbed.Inputs) {
+		t.Fatalf("fee report not persisted: %+v", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains a file-backed key-value store for state that must survive restarts.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileKV is a key-value store persisted as a single JSON file.
+// Every Put rewrites the file atomically (write to temp file, then rename),
+// which is adequate for the small amount of state the sweeper keeps.
+// It is safe for concurrent use within one process.
+type FileKV struct {
+	mu     sync.RWMutex
+	path   string
+	m      map[string][]byte
+	closed bool
+}
+
+// OpenFileKV opens (or creates) a file-backed store at path.
+func OpenFileKV(path string) (*FileKV, error) {
+	k := &FileKV{path: path, m: map[string][]byte{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KV file '%s': %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &k.m); err != nil {
+			return nil, fmt.Errorf("failed to parse KV file '%s': %w", path, err)
+		}
+	}
+	return k, nil
+}
+
+// Put stores a key-value pair and persists the store.
+func (k *FileKV) Put(key, v []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return errors.New("KV store is closed")
+	}
+	prev, had := k.m[string(key)]
+	k.m[string(key)] = append([]byte(nil), v...)
+	if err := k.flushLocked(); err != nil {
+		// Keep memory consistent with disk
+		if had {
+			k.m[string(key)] = prev
+		} else {
+			delete(k.m, string(key))
+		}
+		return err
+	}
+	return nil
+}
+
+// Get retrieves a value by key.
+func (k *FileKV) Get(key []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	v, ok := k.m[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return v, nil
+}
+
+// Delete removes a key and persists the store. Missing keys are not an error.
+func (k *FileKV) Delete(key []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return errors.New("KV store is closed")
+	}
+	prev, had := k.m[string(key)]
+	if !had {
+		return nil
+	}
+	delete(k.m, string(key))
+	if err := k.flushLocked(); err != nil {
+		k.m[string(key)] = prev
+		return err
+	}
+	return nil
+}
+
+// CompareAndSwap stores new under key if the current value equals old (nil
+// old: the key must be absent) and persists the store before reporting success.
+func (k *FileKV) CompareAndSwap(key, old, new []byte) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return false, errors.New("KV store is closed")
+	}
+	cur, had := k.m[string(key)]
+	if had != (old != nil) || !bytes.Equal(cur, old) {
+		return false, nil
+	}
+	k.m[string(key)] = append([]byte(nil), new...)
+	if err := k.flushLocked(); err != nil {
+		if had {
+			k.m[string(key)] = cur
+		} else {
+			delete(k.m, string(key))
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Close flushes the store and rejects further writes. Every Put is already
+// durable, so the final flush only matters if the file was removed underneath.
+func (k *FileKV) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+	return k.flushLocked()
+}
+
+// Write the whole map to disk atomically
+func (k *FileKV) flushLocked() error {
+	data, err := json.Marshal(k.m)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), ".kv-*")
+	if err != nil {
+		return fmt.Errorf("failed to write KV file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write KV file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to sync KV file: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace KV file: %w", err)
+	}
+	return nil
+}
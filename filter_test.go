@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUTXOFilterVetoesAndExplains(t *testing.T) {
+	reserved := stringsRepeat("b", 64)
+	s := newTestSweeper(t, WithUTXOFilter("reservations", func(u UTXO) error {
+		if u.TxID == reserved {
+			return errors.New("reserved by order 42")
+		}
+		return nil
+	}))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in1"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: reserved, Vout: 0, ValueSats: 500_000, Address: testAddr("in2"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 70_000, Address: testAddr("in3"), Confirmed: true})
+
+	rep, err := s.ExplainSelection(SpendOptions{DustSats: 80_000})
+	if err != nil {
+		t.Fatalf("ExplainSelection: %v", err)
+	}
+	if len(rep.Candidates) != 1 || rep.CandidateSats != 100_000 {
+		t.Fatalf("expected one candidate of 100000 sats, got %+v", rep.Candidates)
+	}
+	reasons := map[string]string{}
+	for _, r := range rep.Rejected {
+		reasons[r.UTXO.TxID[:1]] = r.Reason
+	}
+	if !strings.Contains(reasons["b"], "reservations") || !strings.Contains(reasons["b"], "order 42") {
+		t.Fatalf("hook rejection reason missing: %q", reasons["b"])
+	}
+	if !strings.Contains(reasons["c"], "dust") {
+		t.Fatalf("policy rejection reason missing: %q", reasons["c"])
+	}
+
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 200_000}}); err == nil {
+		t.Fatalf("expected the reserved coin to stay out of selection")
+	}
+	if err := s.AddUTXOFilter("", nil); err == nil {
+		t.Fatalf("expected an unnamed filter to be rejected")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Regenerate with: go test -run TestGolden -update-golden
+var updateGolden = flag.Bool("update-golden", false, "rewrite testdata/golden fixtures")
+
+// goldenPlans builds representative plans from fixed inputs; anything that
+// changes their bytes must be a deliberate serializer change.
+func goldenPlans(t *testing.T) map[string]*TransactionPlan {
+	t.Helper()
+	pub, _ := hex.DecodeString(legacyTestPub)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinMainnet)
+	dest, _ := CreateP2WPKH(SHA256([]byte("golden destination"))[:20], BitcoinMainnet)
+	coin := func(c string, vout uint32, value int64) UTXO {
+		return UTXO{TxID: stringsRepeat(c, 64), Vout: vout, ValueSats: value, Address: own, Confirmed: true, Confirmations: 6}
+	}
+	build := func(utxos []UTXO, outs []TxOutput, setup func(s *Sweeper)) *TransactionPlan {
+		s := mustNewSweeper(t, pub, BitcoinMainnet)
+		_ = s.SetFeeRate(4)
+		if setup != nil {
+			setup(s)
+		}
+		for _, u := range utxos {
+			if err := s.Index(u); err != nil {
+				t.Fatalf("Index: %v", err)
+			}
+		}
+		plan, err := s.Spend(outs)
+		if err != nil {
+			t.Fatalf("Spend: %v", err)
+		}
+		return plan
+	}
+
+	plans := map[string]*TransactionPlan{}
+	plans["single_input"] = build([]UTXO{coin("a", 0, 500_000)}, []TxOutput{{Address: dest, ValueSats: 200_000}}, nil)
+	plans["multi_input"] = build([]UTXO{coin("b", 1, 120_000), coin("c", 0, 90_000), coin("d", 2, 70_000)}, []TxOutput{{Address: dest, ValueSats: 250_000}}, nil)
+	plans["multi_change"] = build([]UTXO{coin("e", 0, 1_000_000)}, []TxOutput{{Address: dest, ValueSats: 100_000}}, func(s *Sweeper) {
+		s.SetChangeSplit(3, 250_000, 100_000)
+	})
+	xonly, _ := hex.DecodeString("dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659") // BIP-340 test key
+	p2tr, _ := CreateP2TR(xonly, BitcoinMainnet)
+	plans["taproot"] = build([]UTXO{coin("f", 0, 400_000)}, []TxOutput{{Address: p2tr, ValueSats: 150_000}}, func(s *Sweeper) {
+		if err := s.SetTaprootChangeKey(xonly); err != nil {
+			t.Fatalf("SetTaprootChangeKey: %v", err)
+		}
+	})
+	plans["op_return"] = build([]UTXO{coin("1", 0, 300_000)}, []TxOutput{{Address: dest, ValueSats: 100_000}, {Address: "opreturn:676f6c64656e", ValueSats: 0}}, func(s *Sweeper) {
+		_ = s.RegisterOutputScript("opreturn:", func(addr string, _ Network) ([]byte, error) {
+			data, err := hex.DecodeString(strings.TrimPrefix(addr, "opreturn:"))
+			if err != nil {
+				return nil, err
+			}
+			return append([]byte{0x6a, byte(len(data))}, data...), nil
+		})
+	})
+	return plans
+}
+
+func TestGoldenSerialization(t *testing.T) {
+	for name, plan := range goldenPlans(t) {
+		psbt, err := plan.PSBT.B64Encode()
+		if err != nil {
+			t.Fatalf("%s: B64Encode: %v", name, err)
+		}
+		got := "tx " + hex.EncodeToString(plan.RawTx.Serialize(true)) + "\npsbt " + psbt + "\n"
+		path := filepath.Join("testdata", "golden", name+".txt")
+		if *updateGolden {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v (run with -update-golden to create it)", name, err)
+		}
+		if got != string(want) {
+			t.Fatalf("%s: serialization changed\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+func TestGoldenVectors(t *testing.T) {
+	dir := filepath.Join("testdata", "vectors")
+	if *updateGolden {
+		if _, err := WriteTestVectors(dir); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	got := filepath.Join(t.TempDir(), TestVectorsFile)
+	if _, err := WriteTestVectors(filepath.Dir(got)); err != nil {
+		t.Fatalf("WriteTestVectors: %v", err)
+	}
+	a, _ := os.ReadFile(got)
+	b, err := os.ReadFile(filepath.Join(dir, TestVectorsFile))
+	if err != nil {
+		t.Fatalf("%v (run with -update-golden or gen-vectors to create it)", err)
+	}
+	if string(a) != string(b) {
+		t.Fatalf("test vectors changed - if deliberate, regenerate with -update-golden and note it for downstream users")
+	}
+
+	// The published vectors are what the sweeper plans for them
+	set, _ := GenerateTestVectors()
+	for _, v := range set.Vectors {
+		raw, _ := hex.DecodeString(v.UnsignedTx)
+		tx, err := DeserializeMsgTx(raw)
+		if err != nil || tx.TxID() != v.TxID {
+			t.Fatalf("%s: unsigned tx does not hash to its txid: %v", v.Name, err)
+		}
+		ps, err := DecodePSBTB64(v.PSBT)
+		if err != nil || ps.UnsignedTx.TxID() != v.TxID {
+			t.Fatalf("%s: PSBT does not carry the vector's transaction: %v", v.Name, err)
+		}
+		if v.Descriptor != "" {
+			acct, err := ParseMultisigDescriptor(v.Descriptor, networkByName(t, v.Network))
+			if err != nil {
+				t.Fatalf("%s: descriptor: %v", v.Name, err)
+			}
+			if addr, _ := acct.Address(false, 0); addr != v.Address || hex.EncodeToString(ps.Inputs[0].WitnessScript) != v.WitnessScript {
+				t.Fatalf("%s: descriptor, address and PSBT witness script disagree", v.Name)
+			}
+		}
+	}
+}
+
+// Network named name in the vectors
+func networkByName(t *testing.T, name string) Network {
+	t.Helper()
+	for n, nn := range networkNames {
+		if nn == name {
+			return n
+		}
+	}
+	t.Fatalf("unknown network %q", name)
+	return 0
+}
+
+// Optional: decode the golden PSBTs with Bitcoin Core. Set BITCOIN_CLI to the
+// bitcoin-cli command line (e.g. "bitcoin-cli -regtest") of a running node.
+func TestGoldenPSBTBitcoinCore(t *testing.T) {
+	cli := strings.Fields(os.Getenv("BITCOIN_CLI"))
+	if len(cli) == 0 {
+		t.Skip("BITCOIN_CLI not set")
+	}
+	for name, plan := range goldenPlans(t) {
+		psbt, _ := plan.PSBT.B64Encode()
+		out, err := exec.Command(cli[0], append(cli[1:], "decodepsbt", psbt)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: decodepsbt: %v\n%s", name, err, out)
+		}
+		if !strings.Contains(string(out), `"txid": "`+plan.RawTx.TxID()+`"`) {
+			t.Fatalf("%s: Bitcoin Core decoded a different transaction:\n%s", name, out)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the hashing primitives: SHA-256, double SHA-256,
+// RIPEMD-160, Hash160 and BIP-340 tagged hashes for taproot.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"hash"
+	"sort"
+)
+
+// Tags with precomputed SHA256(tag)||SHA256(tag) prefixes; other tags are
+// hashed on each call
+var tagPrefixes = map[string][]byte{}
+
+func init() {
+	for _, tag := range []string{"TapTweak", "TapLeaf", "TapBranch", "TapSighash", "BIP0340/challenge", "KeyAgg list", "KeyAgg coefficient"} {
+		tagPrefixes[tag] = tagPrefix(tag)
+	}
+}
+
+// SHA256(tag) written twice, the midstate every tagged hash starts from
+func tagPrefix(tag string) []byte {
+	th := sha256.Sum256([]byte(tag))
+	return append(th[:], th[:]...)
+}
+
+// SHA256 returns the SHA-256 digest of data.
+func SHA256(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// Double SHA256, used for txids and legacy/segwit v0 sighashes
+func sha256Double(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+// NewRIPEMD160 returns a hash.Hash computing RIPEMD-160.
+func NewRIPEMD160() hash.Hash {
+	var h ripemd160Hash
+	h.Reset()
+	return &h
+}
+
+// RIPEMD-160 digest of data
+func ripemd160(data []byte) []byte {
+	h := NewRIPEMD160()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Hash160 returns RIPEMD160(SHA256(data)), the hash in P2PKH and P2WPKH
+// scripts and BIP-32 fingerprints.
+func Hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	return ripemd160(sha[:])
+}
+
+// BIP-340 tagged hash: SHA256(SHA256(tag) || SHA256(tag) || parts...)
+func taggedHash(tag string, parts ...[]byte) [32]byte {
+	prefix, ok := tagPrefixes[tag]
+	if !ok {
+		prefix = tagPrefix(tag)
+	}
+	h := sha256.New()
+	h.Write(prefix)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+// TapLeafHash returns the BIP-341 leaf hash of a tapscript:
+// tagged("TapLeaf", leafVersion || compact_size(len(script)) || script).
+// The leaf version of BIP-342 tapscript is 0xc0.
+func TapLeafHash(leafVersion byte, script []byte) [32]byte {
+	var b bytes.Buffer
+	b.WriteByte(leafVersion)
+	writeVarInt(&b, uint64(len(script)))
+	b.Write(script)
+	return taggedHash("TapLeaf", b.Bytes())
+}
+
+// TapBranchHash combines two child hashes of a taproot script tree. Children
+// are ordered lexicographically, so the result does not depend on their order.
+func TapBranchHash(a, b [32]byte) [32]byte {
+	children := [][]byte{a[:], b[:]}
+	sort.Slice(children, func(i, j int) bool { return bytes.Compare(children[i], children[j]) < 0 })
+	return taggedHash("TapBranch", children[0], children[1])
+}
+
+// TapTweakHash returns tagged("TapTweak", internalKey || merkleRoot) for a
+// 32-byte x-only internal key. A nil merkleRoot gives the key-path-only
+// (BIP-86) tweak.
+func TapTweakHash(internalKey, merkleRoot []byte) [32]byte {
+	return taggedHash("TapTweak", internalKey, merkleRoot)
+}
+
+// HashEqual compares two digests in constant time, for checking secret-derived
+// hashes such as MACs without leaking where they differ.
+func HashEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestHashVectors(t *testing.T) {
+	hx := func(b []byte) string { return hex.EncodeToString(b) }
+	if got := hx(SHA256([]byte("abc"))); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("SHA256 = %s", got)
+	}
+	if d := sha256Double([]byte("abc")); hx(d[:]) != "4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358" {
+		t.Fatalf("double SHA256 = %x", d)
+	}
+	for msg, want := range map[string]string{
+		"":                              "9c1185a5c5e9fc54612808977ee8f548b2258d31",
+		"abc":                           "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc",
+		"message digest":                "5d0689ef49d2fae572b881b123a85ffa21595f36",
+		"abcdefghijklmnopqrstuvwxyz":    "f71c27109c692c1b56bbdceb5b9d2865b3708dbc",
+		strings.Repeat("1234567890", 8): "9b752e45573d4b39f4dbd3323cab82bf63326bfb",
+		strings.Repeat("a", 1_000_000):  "52783243c1697bdbe16d37f97f68f08325dc1528",
+	} {
+		if got := hx(ripemd160([]byte(msg))); got != want {
+			t.Fatalf("RIPEMD160(%.20q) = %s, want %s", msg, got, want)
+		}
+	}
+	g, _ := hex.DecodeString(legacyTestPub)
+	if got := hx(Hash160(g)); got != "751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Fatalf("Hash160 = %s", got)
+	}
+
+	// Streaming in odd chunks and reuse after Reset match the one-shot digest
+	h := NewRIPEMD160()
+	h.Write([]byte("partial"))
+	h.Reset()
+	data := []byte(strings.Repeat("0123456789", 20))
+	for len(data) > 0 {
+		n := 7
+		if n > len(data) {
+			n = len(data)
+		}
+		h.Write(data[:n])
+		data = data[n:]
+	}
+	if got, want := hx(h.Sum(nil)), hx(ripemd160([]byte(strings.Repeat("0123456789", 20)))); got != want {
+		t.Fatalf("chunked RIPEMD160 = %s, want %s", got, want)
+	}
+	if h.Size() != 20 || h.BlockSize() != 64 {
+		t.Fatalf("unexpected RIPEMD160 sizes")
+	}
+}
+
+func TestTaprootTaggedHashes(t *testing.T) {
+	// BIP-341 wallet test vector: single tapscript leaf
+	internal, _ := hex.DecodeString("187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27")
+	script, _ := hex.DecodeString("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac")
+	leaf := TapLeafHash(0xc0, script)
+	if hex.EncodeToString(leaf[:]) != "5b75adecf53548f3ec6ad7d78383bf84cc57b55a3127c72b9a2481752dd88b21" {
+		t.Fatalf("TapLeaf = %x", leaf)
+	}
+	if tw := TapTweakHash(internal, leaf[:]); hex.EncodeToString(tw[:]) != "cbd8679ba636c1110ea247542cfbd964131a6be84f873f7f3b62a777528ed001" {
+		t.Fatalf("TapTweak = %x", tw)
+	}
+
+	other := TapLeafHash(0xc0, []byte{0x51})
+	if TapBranchHash(leaf, other) != TapBranchHash(other, leaf) {
+		t.Fatalf("TapBranch must not depend on child order")
+	}
+	// Uncached tags hash the same as cached ones
+	if taggedHash("TapLeaf", []byte{1}) != func() [32]byte {
+		p := tagPrefix("TapLeaf")
+		var out [32]byte
+		copy(out[:], SHA256(append(p, 1)))
+		return out
+	}() {
+		t.Fatalf("cached tag prefix differs")
+	}
+	if !HashEqual(leaf[:], leaf[:]) || HashEqual(leaf[:], other[:]) || HashEqual(leaf[:], leaf[:31]) {
+		t.Fatalf("HashEqual mismatch")
+	}
+}
+
+func BenchmarkSHA256Double(b *testing.B) {
+	data := make([]byte, 250)
+	for i := 0; i < b.N; i++ {
+		sha256Double(data)
+	}
+}
+
+func BenchmarkHash160(b *testing.B) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	for i := 0; i < b.N; i++ {
+		Hash160(pub)
+	}
+}
+
+func BenchmarkRIPEMD160(b *testing.B) {
+	data := make([]byte, 1024)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		ripemd160(data)
+	}
+}
+
+func BenchmarkTaggedHash(b *testing.B) {
+	key := make([]byte, 32)
+	for i := 0; i < b.N; i++ {
+		TapTweakHash(key, nil)
+	}
+}
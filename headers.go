@@ -0,0 +1,472 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the SPV header chain: download, proof-of-work and
+// difficulty validation, KV persistence and reorg handling.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Headers fetched per request, one difficulty period
+const headerBatch = 2016
+
+// maxReorgDepth bounds how far below the tip a competing branch may fork.
+const maxReorgDepth = 144
+
+// HeaderDownloader serves raw block headers, like Electrum's
+// blockchain.block.headers: count concatenated 80-byte headers from start,
+// fewer (or none) past the backend's tip.
+type HeaderDownloader interface {
+	Headers(start, count int) ([]byte, error)
+}
+
+// Consensus parameters for header validation
+type headerParams struct {
+	powLimitBits     uint32 // Easiest allowed target in compact form
+	retargetInterval int    // Blocks per difficulty period
+	targetTimespan   int64  // Seconds a period should take
+	minDifficulty    bool   // Testnet rule: a block 20 minutes late may use powLimit
+}
+
+// Parameters per supported network. Litecoin headers are proof-of-work checked
+// with scrypt, which this library does not implement.
+var headerParamsByNetwork = map[Network]headerParams{
+	BitcoinMainnet: {powLimitBits: 0x1d00ffff, retargetInterval: 2016, targetTimespan: 14 * 24 * 3600},
+	BitcoinTestnet: {powLimitBits: 0x1d00ffff, retargetInterval: 2016, targetTimespan: 14 * 24 * 3600, minDifficulty: true},
+}
+
+// HeaderChain is a validated chain of block headers starting at a trusted
+// checkpoint and persisted in a KV store. It is the trusted HeaderSource for
+// merkle proof verification and a ChainInfoProvider, giving a watch-only
+// sweeper SPV assurance instead of trusting its backend.
+type HeaderChain struct {
+	kv     KV
+	prefix string
+	params headerParams
+	base   int // Checkpoint height
+	tip    int
+}
+
+// Persisted chain state
+type headerChainState struct {
+	Base int `json:"base"`
+	Tip  int `json:"tip"`
+}
+
+// NewHeaderChain opens the header chain for network in kv, starting it at the
+// trusted checkpoint header if it is new. The checkpoint height must be the
+// first block of a difficulty period (a multiple of 2016) so later retargets
+// can be checked. Reopening with a different checkpoint is refused.
+func NewHeaderChain(kv KV, network Network, checkpointHeight int, checkpointHeader []byte) (*HeaderChain, error) {
+	params, ok := headerParamsByNetwork[network]
+	if !ok {
+		return nil, errors.New("header chain validation supports Bitcoin mainnet and testnet only - Litecoin proof of work (scrypt) and regtest's fixed difficulty are not implemented")
+	}
+	if kv == nil {
+		return nil, errors.New("header chain needs a KV store")
+	}
+	if len(checkpointHeader) != 80 {
+		return nil, fmt.Errorf("checkpoint header must be 80 bytes (got %d)", len(checkpointHeader))
+	}
+	if checkpointHeight < 0 || checkpointHeight%params.retargetInterval != 0 {
+		return nil, fmt.Errorf("checkpoint height %d must be a multiple of %d - pick the first block of a difficulty period", checkpointHeight, params.retargetInterval)
+	}
+	if err := checkHeaderWork(checkpointHeader); err != nil {
+		return nil, fmt.Errorf("checkpoint header: %w", err)
+	}
+	c := &HeaderChain{kv: kv, prefix: "header:" + networkConfigs[network].Bech32HRP + ":", params: params}
+	raw, err := kv.Get([]byte(c.prefix + "state"))
+	if err == nil {
+		var st headerChainState
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("corrupt header chain state: %w", err)
+		}
+		stored, err := c.kv.Get(c.key(st.Base))
+		if err != nil || st.Base != checkpointHeight || string(stored) != string(checkpointHeader) {
+			return nil, fmt.Errorf("stored header chain starts from a different checkpoint (height %d) - use a separate KV store", st.Base)
+		}
+		c.base, c.tip = st.Base, st.Tip
+		return c, nil
+	}
+	c.base, c.tip = checkpointHeight, checkpointHeight
+	if err := kv.Put(c.key(c.base), checkpointHeader); err != nil {
+		return nil, err
+	}
+	return c, c.saveState()
+}
+
+// KV key of the header at height
+func (c *HeaderChain) key(height int) []byte {
+	return []byte(c.prefix + strconv.Itoa(height))
+}
+
+// Persist base and tip
+func (c *HeaderChain) saveState() error {
+	b, _ := json.Marshal(headerChainState{Base: c.base, Tip: c.tip})
+	return c.kv.Put([]byte(c.prefix+"state"), b)
+}
+
+// Height returns the height of the best validated header.
+func (c *HeaderChain) Height() int {
+	return c.tip
+}
+
+// BlockHeader returns the validated header at height. It implements
+// HeaderSource.
+func (c *HeaderChain) BlockHeader(height int) ([]byte, error) {
+	if height < c.base || height > c.tip {
+		return nil, fmt.Errorf("height %d is outside the validated header chain (%d-%d) - sync headers first", height, c.base, c.tip)
+	}
+	raw, err := c.kv.Get(c.key(height))
+	if err != nil || len(raw) != 80 {
+		return nil, fmt.Errorf("header %d missing from the KV store", height)
+	}
+	return raw, nil
+}
+
+// ChainTip reports the tip height and its median time past. It implements
+// ChainInfoProvider.
+func (c *HeaderChain) ChainTip() (int64, time.Time, error) {
+	mtp, err := medianTimePast(c.tip, c.BlockHeader)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int64(c.tip), time.Unix(mtp, 0).UTC(), nil
+}
+
+// Sync downloads headers past the tip until the backend has no more,
+// validating each against its parent and the difficulty rules. When the
+// backend's chain no longer connects to the tip, the fork point is searched up
+// to maxReorgDepth blocks back and the competing branch replaces ours if it
+// carries more work. It returns the new tip height.
+func (c *HeaderChain) Sync(src HeaderDownloader) (int, error) {
+	for {
+		raw, err := src.Headers(c.tip+1, headerBatch)
+		if err != nil {
+			return c.tip, fmt.Errorf("could not download headers from %d: %w", c.tip+1, err)
+		}
+		hs, err := splitHeaders(raw)
+		if err != nil {
+			return c.tip, err
+		}
+		if len(hs) == 0 {
+			return c.tip, nil
+		}
+		tipHeader, err := c.BlockHeader(c.tip)
+		if err != nil {
+			return c.tip, err
+		}
+		if !linksTo(hs[0], tipHeader) {
+			if err := c.reorg(src); err != nil {
+				return c.tip, err
+			}
+			continue
+		}
+		at := c.overlay(c.tip, hs)
+		for i, h := range hs {
+			if err := c.validate(h, c.tip+1+i, at); err != nil {
+				return c.tip, err
+			}
+		}
+		if err := c.connect(c.tip, hs); err != nil {
+			return c.tip, err
+		}
+		if len(hs) < headerBatch {
+			return c.tip, nil
+		}
+	}
+}
+
+// Find where the backend's chain forks from ours and switch to its branch
+// if it has more work
+func (c *HeaderChain) reorg(src HeaderDownloader) error {
+	for fork := c.tip - 1; fork >= c.base; fork-- {
+		if c.tip-fork > maxReorgDepth {
+			return fmt.Errorf("backend chain forks more than %d blocks below our tip - check the backend", maxReorgDepth)
+		}
+		raw, err := src.Headers(fork+1, 1)
+		if err != nil {
+			return fmt.Errorf("could not download header %d: %w", fork+1, err)
+		}
+		ours, err := c.BlockHeader(fork)
+		if err != nil {
+			return err
+		}
+		if len(raw) >= 80 && linksTo(raw[:80], ours) {
+			return c.switchBranch(src, fork)
+		}
+	}
+	return errors.New("backend chain does not connect to the checkpoint - check the network and checkpoint")
+}
+
+// Validate the backend's branch above fork and adopt it if it has more work
+func (c *HeaderChain) switchBranch(src HeaderDownloader, fork int) error {
+	raw, err := src.Headers(fork+1, headerBatch)
+	if err != nil {
+		return fmt.Errorf("could not download headers from %d: %w", fork+1, err)
+	}
+	hs, err := splitHeaders(raw)
+	if err != nil {
+		return err
+	}
+	at := c.overlay(fork, hs)
+	newWork := new(big.Int)
+	for i, h := range hs {
+		if err := c.validate(h, fork+1+i, at); err != nil {
+			return fmt.Errorf("competing branch: %w", err)
+		}
+		newWork.Add(newWork, headerWork(h))
+	}
+	oldWork := new(big.Int)
+	for height := fork + 1; height <= c.tip; height++ {
+		h, err := c.BlockHeader(height)
+		if err != nil {
+			return err
+		}
+		oldWork.Add(oldWork, headerWork(h))
+	}
+	if newWork.Cmp(oldWork) <= 0 {
+		return fmt.Errorf("backend serves a branch from height %d with no more work than ours - keeping the current chain", fork+1)
+	}
+	oldTip := c.tip
+	if err := c.connect(fork, hs); err != nil {
+		return err
+	}
+	if del, ok := c.kv.(KVDeleter); ok {
+		for height := c.tip + 1; height <= oldTip; height++ {
+			del.Delete(c.key(height))
+		}
+	}
+	return nil
+}
+
+// Store validated headers above height and move the tip to the last one
+func (c *HeaderChain) connect(height int, hs [][]byte) error {
+	for i, h := range hs {
+		if err := c.kv.Put(c.key(height+1+i), h); err != nil {
+			return fmt.Errorf("could not persist header %d: %w", height+1+i, err)
+		}
+	}
+	c.tip = height + len(hs)
+	return c.saveState()
+}
+
+// Header lookup over the stored chain up to height followed by pending headers
+func (c *HeaderChain) overlay(height int, pending [][]byte) func(int) ([]byte, error) {
+	return func(h int) ([]byte, error) {
+		if h > height && h-height-1 < len(pending) {
+			return pending[h-height-1], nil
+		}
+		if h > height {
+			return nil, fmt.Errorf("header %d not available", h)
+		}
+		return c.BlockHeader(h)
+	}
+}
+
+// Check a header at height against its parent, its proof of work, the
+// expected difficulty and the median time past of its ancestors
+func (c *HeaderChain) validate(h []byte, height int, at func(int) ([]byte, error)) error {
+	prev, err := at(height - 1)
+	if err != nil {
+		return err
+	}
+	if !linksTo(h, prev) {
+		return fmt.Errorf("header %d does not build on header %d", height, height-1)
+	}
+	if err := checkHeaderWork(h); err != nil {
+		return fmt.Errorf("header %d: %w", height, err)
+	}
+	want, err := c.expectedBits(h, height, at)
+	if err != nil {
+		return err
+	}
+	if bits := headerBits(h); bits != want {
+		return fmt.Errorf("header %d has difficulty bits 0x%08x, want 0x%08x", height, bits, want)
+	}
+	mtp, err := medianTimePast(height-1, at)
+	if err != nil {
+		return err
+	}
+	if int64(headerTime(h)) <= mtp {
+		return fmt.Errorf("header %d timestamp is not after the median time past", height)
+	}
+	return nil
+}
+
+// Difficulty the header at height must carry
+func (c *HeaderChain) expectedBits(h []byte, height int, at func(int) ([]byte, error)) (uint32, error) {
+	p := c.params
+	prev, err := at(height - 1)
+	if err != nil {
+		return 0, err
+	}
+	if height%p.retargetInterval == 0 {
+		first, err := at(height - p.retargetInterval)
+		if err != nil {
+			return 0, err
+		}
+		return retarget(headerBits(prev), int64(headerTime(prev))-int64(headerTime(first)), p), nil
+	}
+	if !p.minDifficulty {
+		return headerBits(prev), nil
+	}
+	spacing := p.targetTimespan / int64(p.retargetInterval)
+	if int64(headerTime(h)) > int64(headerTime(prev))+2*spacing {
+		return p.powLimitBits, nil
+	}
+	// Otherwise the last difficulty that was not the 20-minute exception
+	for n := height - 1; n > c.base && n%p.retargetInterval != 0 && headerBits(prev) == p.powLimitBits; n-- {
+		if prev, err = at(n - 1); err != nil {
+			return 0, err
+		}
+	}
+	return headerBits(prev), nil
+}
+
+// Next target from the last one and how long the period took, clamped to a
+// factor of four and capped at powLimit
+func retarget(lastBits uint32, span int64, p headerParams) uint32 {
+	if span < p.targetTimespan/4 {
+		span = p.targetTimespan / 4
+	}
+	if span > p.targetTimespan*4 {
+		span = p.targetTimespan * 4
+	}
+	t, _ := compactToTarget(lastBits)
+	t.Mul(t, big.NewInt(span))
+	t.Div(t, big.NewInt(p.targetTimespan))
+	if limit, _ := compactToTarget(p.powLimitBits); t.Cmp(limit) > 0 {
+		t = limit
+	}
+	return targetToCompact(t)
+}
+
+// Median timestamp of the up to 11 headers ending at height
+func medianTimePast(height int, at func(int) ([]byte, error)) (int64, error) {
+	var times []int64
+	for n := height; n > height-11 && n >= 0; n-- {
+		h, err := at(n)
+		if err != nil {
+			if len(times) > 0 {
+				break // Below the checkpoint
+			}
+			return 0, err
+		}
+		times = append(times, int64(headerTime(h)))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2], nil
+}
+
+// Split concatenated raw headers
+func splitHeaders(raw []byte) ([][]byte, error) {
+	if len(raw)%80 != 0 {
+		return nil, fmt.Errorf("header data length %d is not a multiple of 80", len(raw))
+	}
+	hs := make([][]byte, 0, len(raw)/80)
+	for i := 0; i < len(raw); i += 80 {
+		hs = append(hs, raw[i:i+80])
+	}
+	return hs, nil
+}
+
+// Whether header h names prev as its parent
+func linksTo(h, prev []byte) bool {
+	ph := sha256Double(prev)
+	return string(h[4:36]) == string(ph[:])
+}
+
+func headerTime(h []byte) uint32 {
+	return uint32(h[68]) | uint32(h[69])<<8 | uint32(h[70])<<16 | uint32(h[71])<<24
+}
+
+func headerBits(h []byte) uint32 {
+	return uint32(h[72]) | uint32(h[73])<<8 | uint32(h[74])<<16 | uint32(h[75])<<24
+}
+
+// Expected number of hashes to find a header at its target: 2^256/(target+1)
+func headerWork(h []byte) *big.Int {
+	t, err := compactToTarget(headerBits(h))
+	if err != nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), t.Add(t, big.NewInt(1)))
+}
+
+// Decode a compact ("nBits") target
+func compactToTarget(bits uint32) (*big.Int, error) {
+	exp, mant := bits>>24, bits&0x007fffff
+	if mant == 0 || bits&0x00800000 != 0 || exp > 32 {
+		return nil, fmt.Errorf("invalid difficulty bits 0x%08x", bits)
+	}
+	t := new(big.Int).SetUint64(uint64(mant))
+	if exp <= 3 {
+		return t.Rsh(t, uint(8*(3-exp))), nil
+	}
+	return t.Lsh(t, uint(8*(exp-3))), nil
+}
+
+// Encode a target in compact form, as Bitcoin Core's GetCompact
+func targetToCompact(t *big.Int) uint32 {
+	size := uint32((t.BitLen() + 7) / 8)
+	var mant uint32
+	if size <= 3 {
+		mant = uint32(t.Uint64() << (8 * (3 - size)))
+	} else {
+		mant = uint32(new(big.Int).Rsh(t, uint(8*(size-3))).Uint64())
+	}
+	if mant&0x00800000 != 0 {
+		mant >>= 8
+		size++
+	}
+	return mant | size<<24
+}
+
+// SPVConfirmations is a ConfirmationSource that counts confirmations from
+// merkle proofs checked against the header chain rather than trusting the
+// backend's count. Proofs should return a nil proof for unconfirmed
+// transactions.
+type SPVConfirmations struct {
+	Proofs MerkleProofSource
+	Chain  *HeaderChain
+}
+
+// Confirmations implements ConfirmationSource.
+func (c SPVConfirmations) Confirmations(txid string) (int, error) {
+	proof, err := c.Proofs.TxMerkleProof(txid)
+	if err != nil {
+		return 0, err
+	}
+	if proof == nil || proof.BlockHeight > c.Chain.Height() {
+		return 0, nil
+	}
+	header, err := c.Chain.BlockHeader(proof.BlockHeight)
+	if err != nil {
+		return 0, err
+	}
+	if err := VerifyMerkleProof(txid, proof, header); err != nil {
+		return 0, fmt.Errorf("transaction %s: %w", txid, err)
+	}
+	return c.Chain.Height() - proof.BlockHeight + 1, nil
+}
+
+// SetHeaderChain uses chain for SPV assurance: confirmed UTXOs need a merkle
+// proof from proofs that checks out against it, and it becomes the chain tip
+// source for locktimes. Use SPVConfirmations with the confirmation tracker.
+func (s *Sweeper) SetHeaderChain(chain *HeaderChain, proofs MerkleProofSource) error {
+	if chain == nil || proofs == nil {
+		return errors.New("SPV needs both a header chain and a merkle proof source")
+	}
+	if err := s.SetMerkleVerification(proofs, chain); err != nil {
+		return err
+	}
+	s.SetChainInfo(chain)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Serves headers from a slice indexed by height
+type fakeHeaderSrc struct{ chain [][]byte }
+
+func (f *fakeHeaderSrc) Headers(start, count int) ([]byte, error) {
+	var out []byte
+	for h := start; h < start+count && h < len(f.chain); h++ {
+		out = append(out, f.chain[h]...)
+	}
+	return out, nil
+}
+
+// Regtest-like difficulty with a 4-block period so retargets are cheap to test
+var testHeaderParams = headerParams{powLimitBits: 0x207fffff, retargetInterval: 4, targetTimespan: 4 * 600}
+
+// Mine n headers on top of chain, spacing seconds apart, with the merkle
+// roots given by height and salt making the branch distinct
+func extendChain(t *testing.T, p headerParams, chain [][]byte, n int, spacing uint32, salt byte, roots map[int][32]byte) [][]byte {
+	t.Helper()
+	chain = append([][]byte(nil), chain...)
+	for i := 0; i < n; i++ {
+		height := len(chain)
+		prev := chain[height-1]
+		bits := headerBits(prev)
+		if height%p.retargetInterval == 0 {
+			first := chain[height-p.retargetInterval]
+			bits = retarget(bits, int64(headerTime(prev))-int64(headerTime(first)), p)
+		}
+		h := make([]byte, 80)
+		h[0], h[1] = 2, salt
+		ph := sha256Double(prev)
+		copy(h[4:36], ph[:])
+		if r, ok := roots[height]; ok {
+			copy(h[36:68], r[:])
+		}
+		tm := headerTime(prev) + spacing
+		h[68], h[69], h[70], h[71] = byte(tm), byte(tm>>8), byte(tm>>16), byte(tm>>24)
+		h[72], h[73], h[74], h[75] = byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24)
+		for nonce := 0; ; nonce++ {
+			h[76], h[77], h[78] = byte(nonce), byte(nonce>>8), byte(nonce>>16)
+			if checkHeaderWork(h) == nil {
+				break
+			}
+		}
+		chain = append(chain, h)
+	}
+	return chain
+}
+
+// Genesis-like regtest checkpoint at height 0
+func testCheckpoint(t *testing.T) []byte {
+	h := make([]byte, 80)
+	h[0] = 1
+	copy(h[68:76], []byte{0x00, 0xe1, 0xf5, 0x05, 0xff, 0xff, 0x7f, 0x20}) // time 100000000, bits 0x207fffff
+	for nonce := 0; checkHeaderWork(h) != nil; nonce++ {
+		h[76], h[77] = byte(nonce), byte(nonce>>8)
+	}
+	return h
+}
+
+func newTestHeaderChain(t *testing.T, kv KV, checkpoint []byte) *HeaderChain {
+	t.Helper()
+	c, err := NewHeaderChain(kv, BitcoinMainnet, 0, checkpoint)
+	if err != nil {
+		t.Fatalf("NewHeaderChain: %v", err)
+	}
+	c.params = testHeaderParams
+	return c
+}
+
+func TestHeaderChainMainnetGenesis(t *testing.T) {
+	genesis, _ := hex.DecodeString("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c")
+	block1, _ := hex.DecodeString("010000006fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e61bc6649ffff001d01e36299")
+	c, err := NewHeaderChain(NewMemKV(), BitcoinMainnet, 0, genesis)
+	if err != nil {
+		t.Fatalf("NewHeaderChain: %v", err)
+	}
+	if tip, err := c.Sync(&fakeHeaderSrc{chain: [][]byte{genesis, block1}}); err != nil || tip != 1 {
+		t.Fatalf("Sync = %d, %v", tip, err)
+	}
+	if _, err := NewHeaderChain(NewMemKV(), LitecoinMainnet, 0, genesis); err == nil {
+		t.Fatalf("expected Litecoin header chains to be refused")
+	}
+	if _, err := NewHeaderChain(NewMemKV(), BitcoinMainnet, 100, genesis); err == nil {
+		t.Fatalf("expected a checkpoint inside a difficulty period to be refused")
+	}
+}
+
+func TestHeaderChainSyncAndRetarget(t *testing.T) {
+	kv := NewMemKV()
+	cp := testCheckpoint(t)
+	c := newTestHeaderChain(t, kv, cp)
+	// Blocks every 60s instead of 600s: difficulty rises at each period
+	chain := extendChain(t, testHeaderParams, [][]byte{cp}, 9, 60, 0, nil)
+	if headerBits(chain[4]) == headerBits(chain[3]) {
+		t.Fatalf("expected a retarget at height 4")
+	}
+	src := &fakeHeaderSrc{chain: chain}
+	if tip, err := c.Sync(src); err != nil || tip != 9 {
+		t.Fatalf("Sync = %d, %v", tip, err)
+	}
+	if h, err := c.BlockHeader(5); err != nil || string(h) != string(chain[5]) {
+		t.Fatalf("BlockHeader(5) mismatch: %v", err)
+	}
+	if _, err := c.BlockHeader(10); err == nil {
+		t.Fatalf("expected headers past the tip to be unavailable")
+	}
+	if height, mtp, err := c.ChainTip(); err != nil || height != 9 || mtp.Unix() != int64(headerTime(chain[5])) {
+		t.Fatalf("ChainTip = %d %v %v", height, mtp, err)
+	}
+
+	// Reopening resumes; a different checkpoint is refused
+	if c2 := newTestHeaderChain(t, kv, cp); c2.Height() != 9 {
+		t.Fatalf("reopened at %d, want 9", c2.Height())
+	}
+	if _, err := NewHeaderChain(kv, BitcoinMainnet, 0, chain[1]); err == nil {
+		t.Fatalf("expected a checkpoint mismatch error")
+	}
+
+	// A header keeping the old difficulty across the retarget is rejected
+	bad := newTestHeaderChain(t, NewMemKV(), cp)
+	noRetarget := testHeaderParams
+	noRetarget.retargetInterval = 1000
+	forged := extendChain(t, noRetarget, chain[:4], 2, 60, 0, nil)
+	if _, err := bad.Sync(&fakeHeaderSrc{chain: forged}); err == nil {
+		t.Fatalf("expected wrong difficulty bits to be rejected")
+	}
+	if bad.Height() != 0 {
+		t.Fatalf("nothing should be connected from a rejected batch, tip %d", bad.Height())
+	}
+}
+
+func TestHeaderChainReorg(t *testing.T) {
+	cp := testCheckpoint(t)
+	c := newTestHeaderChain(t, NewMemKV(), cp)
+	main := extendChain(t, testHeaderParams, [][]byte{cp}, 6, 600, 0, nil)
+	src := &fakeHeaderSrc{chain: main}
+	if _, err := c.Sync(src); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// A branch forking at height 3 with fast blocks (harder after the height 8
+	// retarget) carries more work and replaces ours
+	fork := extendChain(t, testHeaderParams, main[:4], 5, 60, 3, nil)
+	if tip, err := c.Sync(&fakeHeaderSrc{chain: fork}); err != nil || tip != 8 {
+		t.Fatalf("Sync after reorg = %d, %v", tip, err)
+	}
+	if h, _ := c.BlockHeader(5); string(h) != string(fork[5]) {
+		t.Fatalf("header 5 not replaced by the heavier branch")
+	}
+
+	// The original chain is longer by then but lighter, and is refused
+	if _, err := c.Sync(&fakeHeaderSrc{chain: extendChain(t, testHeaderParams, main, 3, 600, 0, nil)}); err == nil || !strings.Contains(err.Error(), "no more work") {
+		t.Fatalf("expected the lighter branch to be refused, got %v", err)
+	}
+}
+
+func TestSPVConfirmations(t *testing.T) {
+	s := newTestSweeper(t)
+	addr, _ := CreateP2WPKH(make([]byte, 20), BitcoinRegtest)
+	script, _ := s.buildOutputScript(addr)
+	ta, tb := payingTx(script, 1, 50_000), payingTx(script, 2, 50_000)
+	a, b := ta.TxHash(), tb.TxHash()
+	root := sha256Double(append(a[:], b[:]...))
+	cp := testCheckpoint(t)
+	chain := newTestHeaderChain(t, NewMemKV(), cp)
+	blocks := extendChain(t, testHeaderParams, [][]byte{cp}, 5, 600, 0, map[int][32]byte{2: root})
+	if _, err := chain.Sync(&fakeHeaderSrc{chain: blocks}); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	proofs := fakeProofs{
+		proofs: map[string]*MerkleProof{
+			hashHex(a): {BlockHeight: 2, Merkle: []string{hashHex(b)}, Pos: 0},
+			hashHex(b): {BlockHeight: 3, Merkle: []string{hashHex(a)}, Pos: 1}, // Wrong block
+		},
+		raw: map[string][]byte{hashHex(a): ta.Serialize(true), hashHex(b): tb.Serialize(true)},
+	}
+	spv := SPVConfirmations{Proofs: proofs, Chain: chain}
+	if n, err := spv.Confirmations(hashHex(a)); err != nil || n != 4 {
+		t.Fatalf("Confirmations = %d, %v; want 4", n, err)
+	}
+	if _, err := spv.Confirmations(hashHex(b)); err == nil {
+		t.Fatalf("expected a proof against the wrong block to fail")
+	}
+
+	if err := s.SetHeaderChain(chain, proofs); err != nil {
+		t.Fatalf("SetHeaderChain: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: hashHex(a), ValueSats: 50_000, Address: addr, Confirmed: true}); err != nil {
+		t.Fatalf("SPV-proven UTXO rejected: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: hashHex(b), ValueSats: 50_000, Address: addr, Confirmed: true}); err == nil {
+		t.Fatalf("expected an unproven UTXO to be rejected")
+	}
+}
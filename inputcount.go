@@ -0,0 +1,107 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the minimum and maximum input count per transaction.
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// InputCountError reports that no selection satisfies the limits set with
+// SetInputCountLimits; test for it with errors.As.
+type InputCountError struct {
+	Min    int    // Minimum inputs per transaction (0 = none)
+	Max    int    // Maximum inputs per transaction (0 = unlimited)
+	Got    int    // Inputs chosen or available when the limit was hit
+	Reason string // What could not be met
+}
+
+// Error implements error.
+func (e *InputCountError) Error() string {
+	return fmt.Sprintf("%s (limits: min %d, max %d inputs) - adjust SetInputCountLimits or the outputs", e.Reason, e.Min, e.Max)
+}
+
+// SetInputCountLimits bounds the inputs of every transaction: maxInputs caps
+// its size (0 = unlimited) and minInputs makes each spend consolidate at
+// least that many coins, topping a selection up with the smallest spare ones
+// (0 = no minimum). Automatic selection that needs more than maxInputs
+// retries with the largest coins, and fails with an *InputCountError when
+// the limits cannot be met. Coin control (SpendFrom) inputs must already fall
+// within them, ConsolidateAll sweeps at most maxInputs coins and
+// ConsolidateToMany starts a new transaction after every maxInputs.
+func (s *Sweeper) SetInputCountLimits(minInputs, maxInputs int) error {
+	if err := validateInputCountLimits(minInputs, maxInputs); err != nil {
+		return err
+	}
+	s.minInputs, s.maxInputs = minInputs, maxInputs
+	return nil
+}
+
+// Check that input count limits are non-negative and ordered
+func validateInputCountLimits(minInputs, maxInputs int) error {
+	if minInputs < 0 || maxInputs < 0 {
+		return fmt.Errorf("input count limits must be non-negative (got min %d, max %d)", minInputs, maxInputs)
+	}
+	if maxInputs > 0 && minInputs > maxInputs {
+		return fmt.Errorf("minimum of %d inputs exceeds the maximum of %d", minInputs, maxInputs)
+	}
+	return nil
+}
+
+// Error for a selection of n inputs that breaks the limits, or nil
+func (s *Sweeper) checkInputCount(n int) error {
+	switch {
+	case s.maxInputs > 0 && n > s.maxInputs:
+		return s.inputCountError(n, fmt.Sprintf("%d inputs exceed the maximum", n))
+	case n < s.minInputs:
+		return s.inputCountError(n, fmt.Sprintf("%d inputs are below the minimum", n))
+	}
+	return nil
+}
+
+// InputCountError for the current limits
+func (s *Sweeper) inputCountError(got int, reason string) *InputCountError {
+	return &InputCountError{Min: s.minInputs, Max: s.maxInputs, Got: got, Reason: reason}
+}
+
+// The n most valuable candidates and their total
+func largestInputs(cands []UTXO, n int) ([]UTXO, int64) {
+	sorted := append([]UTXO{}, cands...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ValueSats > sorted[j].ValueSats })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	var total int64
+	for _, u := range sorted {
+		total += u.ValueSats
+	}
+	return sorted, total
+}
+
+// Top a selection up to the minimum input count with the smallest spare
+// candidates; returns the new selection and its value
+func (s *Sweeper) padToMinInputs(selected []UTXO, totalIn int64, cands []UTXO) ([]UTXO, int64, error) {
+	if len(selected) >= s.minInputs {
+		return selected, totalIn, nil
+	}
+	if len(cands) < s.minInputs {
+		return nil, 0, s.inputCountError(len(cands), fmt.Sprintf("only %d spendable UTXOs are available", len(cands)))
+	}
+	taken := make(map[string]bool, len(selected))
+	for _, u := range selected {
+		taken[outpointKey(u)] = true
+	}
+	var spare []UTXO
+	for _, u := range cands {
+		if !taken[outpointKey(u)] {
+			spare = append(spare, u)
+		}
+	}
+	sort.SliceStable(spare, func(i, j int) bool { return spare[i].ValueSats < spare[j].ValueSats })
+	out := append([]UTXO{}, selected...)
+	for _, u := range spare[:s.minInputs-len(selected)] {
+		out = append(out, u)
+		totalIn += u.ValueSats
+	}
+	return out, totalIn, nil
+}
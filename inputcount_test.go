@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Sweeper holding 50k, 60k, 70k and 200k sat coins
+func inputCountSweeper(t *testing.T, opts ...Option) *Sweeper {
+	t.Helper()
+	s := newTestSweeper(t, opts...)
+	for i, v := range []int64{50_000, 60_000, 70_000, 200_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat("cd", 32), Vout: uint32(i), ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	return s
+}
+
+func TestMaxInputsPrefersLargestCoins(t *testing.T) {
+	s := inputCountSweeper(t, WithInputCountLimits(0, 2))
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}}
+	plan, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) > 2 || plan.Settings.MaxInputs != 2 {
+		t.Fatalf("expected at most 2 inputs, got %+v", plan.Inputs)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	if err := s.SetInputCountLimits(0, 1); err != nil {
+		t.Fatalf("SetInputCountLimits: %v", err)
+	}
+	_, err = s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 250_000}})
+	var ice *InputCountError
+	if !errors.As(err, &ice) || ice.Max != 1 {
+		t.Fatalf("expected an InputCountError, got %v", err)
+	}
+
+	dest, _ := s.getChangeAddress()
+	plan, err = s.ConsolidateAll(dest)
+	if err != nil || len(plan.Inputs) != 1 {
+		t.Fatalf("ConsolidateAll under a limit of 1: %+v, %v", plan, err)
+	}
+}
+
+func TestMinInputsTopsUpSelection(t *testing.T) {
+	s := inputCountSweeper(t, WithInputCountLimits(3, 0))
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}}, SpendOptions{Selection: SelectLargestFirst})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 3 || plan.Inputs[1].ValueSats != 50_000 || plan.Inputs[2].ValueSats != 60_000 {
+		t.Fatalf("expected the two smallest coins added, got %+v", plan.Inputs)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	// Coin control must meet the minimum itself
+	op, _ := NewOutPointFromStr(stringsRepeat("cd", 32), 3)
+	_, err = s.SpendFrom([]OutPoint{op}, []TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}})
+	var ice *InputCountError
+	if !errors.As(err, &ice) || ice.Got != 1 {
+		t.Fatalf("expected an InputCountError for coin control, got %v", err)
+	}
+
+	if err := s.SetInputCountLimits(5, 0); err != nil {
+		t.Fatalf("SetInputCountLimits: %v", err)
+	}
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}}); !errors.As(err, &ice) {
+		t.Fatalf("expected an InputCountError with too few coins, got %v", err)
+	}
+	if err := s.SetInputCountLimits(3, 2); err == nil {
+		t.Fatalf("expected a minimum above the maximum to be refused")
+	}
+}
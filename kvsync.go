@@ -0,0 +1,135 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains atomic updates and advisory locks for KV stores shared
+// by several sweeper instances.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Advisory lock timing: how long a lease lasts if its holder dies, and how
+// long to wait for another instance to release one
+const (
+	kvLockTTL  = 30 * time.Second
+	kvLockWait = 5 * time.Second
+)
+
+// kvLease is a CAS-based advisory lock held under "lock:<name>"; a released
+// or expired lease may be taken by any instance.
+type kvLease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// Identifier of this sweeper instance as a lock owner
+func (s *Sweeper) lockOwner() string {
+	if s.instanceID == "" {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		s.instanceID = hex.EncodeToString(b)
+	}
+	return s.instanceID
+}
+
+// Read-modify-write key atomically: fn maps the current value (nil when
+// absent) to the new one, or to nil to leave it alone, and is run again if
+// another instance changed the key in between. Stores without
+// CompareAndSwap get a plain read and write, which is only safe for one
+// instance.
+func (s *Sweeper) updateKV(key string, fn func(cur []byte) ([]byte, error)) error {
+	cas, atomic := s.kv.(KVCompareAndSwapper)
+	for i := 0; i < casRetries; i++ {
+		cur, err := s.kv.Get([]byte(key))
+		if errors.Is(err, ErrKeyNotFound) {
+			cur = nil // Not stored yet
+		} else if err != nil {
+			return fmt.Errorf("could not read %s: %w", key, err)
+		}
+		next, err := fn(cur)
+		if err != nil || next == nil {
+			return err
+		}
+		if !atomic {
+			return s.kv.Put([]byte(key), next)
+		}
+		swapped, err := cas.CompareAndSwap([]byte(key), cur, next)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is being updated concurrently - retry", key)
+}
+
+// Run fn holding the named advisory lock, so multi-key updates by instances
+// sharing the store do not interleave. The store's own KVLocker is used when
+// it has one, else a lease taken with CompareAndSwap; stores with neither
+// run fn unlocked.
+func (s *Sweeper) withKVLock(name string, fn func() error) error {
+	var unlock func() error
+	var err error
+	if l, ok := s.kv.(KVLocker); ok {
+		unlock, err = l.Lock(name, kvLockTTL)
+	} else if cas, ok := s.kv.(KVCompareAndSwapper); ok {
+		unlock, err = s.takeLease(cas, name)
+	} else {
+		return fn()
+	}
+	if err != nil {
+		return err
+	}
+	ferr := fn()
+	if uerr := unlock(); uerr != nil && ferr == nil {
+		return fmt.Errorf("releasing KV lock %s: %w", name, uerr)
+	}
+	return ferr
+}
+
+// Take the lease on a lock once it is free or expired, waiting up to kvLockWait
+func (s *Sweeper) takeLease(cas KVCompareAndSwapper, name string) (func() error, error) {
+	key := []byte("lock:" + name)
+	deadline := time.Now().Add(kvLockWait)
+	for {
+		cur, err := s.kv.Get(key)
+		if err != nil {
+			cur = nil
+		}
+		var held kvLease
+		if cur != nil {
+			if err := json.Unmarshal(cur, &held); err != nil {
+				return nil, fmt.Errorf("corrupt KV lock %s: %w", name, err)
+			}
+		}
+		now := time.Now().UTC()
+		if cur == nil || !now.Before(held.Expires) {
+			mine, err := json.Marshal(kvLease{Owner: s.lockOwner(), Expires: now.Add(kvLockTTL)})
+			if err != nil {
+				return nil, err
+			}
+			ok, err := cas.CompareAndSwap(key, cur, mine)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return func() error {
+					// Release by expiring the lease; stores need not delete
+					free, _ := json.Marshal(kvLease{})
+					_, err := cas.CompareAndSwap(key, mine, free)
+					return err
+				}, nil
+			}
+			continue
+		}
+		if now.After(deadline) {
+			return nil, fmt.Errorf("KV lock %s is held by instance %s until %s - another sweeper is busy, retry later", name, held.Owner, held.Expires.Format(time.RFC3339))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
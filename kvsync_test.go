@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedKVConcurrentUpdates(t *testing.T) {
+	kv := NewMemKV()
+	const instances, each = 3, 10
+	sweepers := make([]*Sweeper, instances)
+	for i := range sweepers {
+		sweepers[i] = newTestSweeper(t, WithKV(kv))
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, instances*each*3)
+	for i, s := range sweepers {
+		wg.Add(1)
+		go func(i int, s *Sweeper) {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				n := i*each + j
+				errs <- s.LockUTXO(fmt.Sprintf("%064x", n), 0)
+				_, err := s.recordEvent(&WebhookPayload{})
+				errs <- err
+				id := fmt.Sprintf("plan-%d", n)
+				errs <- s.updatePlanIndex(func(ids []string) []string { return append(ids, id) })
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent update: %v", err)
+		}
+	}
+
+	fresh := newTestSweeper(t, WithKV(kv))
+	if locks, err := fresh.ListLocked(); err != nil || len(locks) != instances*each {
+		t.Fatalf("expected %d locks, got %d, %v", instances*each, len(locks), err)
+	}
+	if st, _ := fresh.outboxState(); st.Next != instances*each+1 {
+		t.Fatalf("expected outbox seq %d next, got %d", instances*each+1, st.Next)
+	}
+	if n := len(fresh.planIDs()); n != instances*each {
+		t.Fatalf("expected %d indexed plans, got %d", instances*each, n)
+	}
+}
+
+func TestPlanIDClaimedAcrossInstances(t *testing.T) {
+	kv := NewMemKV()
+	a := newTestSweeper(t, WithKV(kv))
+	_ = a.Index(UTXO{TxID: stringsRepeat("ef", 32), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := a.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+
+	b := newTestSweeper(t, WithKV(kv))
+	if err := b.claimPlanID(plan.ID); err == nil {
+		t.Fatalf("expected a plan tracked by another instance to be refused")
+	}
+	if err := b.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	if err := b.claimPlanID(plan.ID); err != nil {
+		t.Fatalf("claim after LoadPlans: %v", err)
+	}
+}
+
+func TestKVLockTakesOverExpiredLease(t *testing.T) {
+	kv := NewMemKV()
+	stale, _ := json.Marshal(kvLease{Owner: "crashed", Expires: time.Now().Add(-time.Minute)})
+	_ = kv.Put([]byte("lock:outbox"), stale)
+
+	s := newTestSweeper(t, WithKV(kv))
+	ran := false
+	if err := s.withKVLock("outbox", func() error { ran = true; return nil }); err != nil || !ran {
+		t.Fatalf("withKVLock: ran=%v, %v", ran, err)
+	}
+	var l kvLease
+	b, _ := kv.Get([]byte("lock:outbox"))
+	if err := json.Unmarshal(b, &l); err != nil || !l.Expires.IsZero() {
+		t.Fatalf("expected the lease released, got %s", b)
+	}
+}
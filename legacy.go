@@ -0,0 +1,164 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains legacy P2PKH input support: previous transactions and sighash.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PrevTxSource returns the full serialized transaction with the given txid,
+// e.g. from a node's getrawtransaction. Legacy inputs sign over the previous
+// output without committing to its value, so PSBT signers require the whole
+// previous transaction (NonWitnessUtxo) to check the amount.
+type PrevTxSource interface {
+	RawTransaction(txid string) ([]byte, error)
+}
+
+// SetPrevTxSource sets where previous transactions of P2PKH inputs come from.
+func (s *Sweeper) SetPrevTxSource(src PrevTxSource) {
+	s.prevTxSource = src
+	s.prevTxs = nil
+}
+
+// Previous transaction of a legacy UTXO, checked against its txid, value and script
+func (s *Sweeper) prevTxFor(u UTXO, script []byte) (*MsgTx, error) {
+	if tx, ok := s.prevTxs[u.TxID]; ok {
+		return tx, nil
+	}
+	if s.prevTxSource == nil {
+		return nil, fmt.Errorf("P2PKH input %s needs its previous transaction - configure a PrevTxSource with SetPrevTxSource", outpointKey(u))
+	}
+	raw, err := s.prevTxSource.RawTransaction(u.TxID)
+	if err != nil {
+		return nil, fmt.Errorf("previous transaction of %s: %w", outpointKey(u), err)
+	}
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		return nil, fmt.Errorf("previous transaction of %s: %w", outpointKey(u), err)
+	}
+	if tx.TxID() != u.TxID {
+		return nil, fmt.Errorf("previous transaction source returned %s for %s", tx.TxID(), u.TxID)
+	}
+	if int(u.Vout) >= len(tx.TxOut) {
+		return nil, fmt.Errorf("previous transaction %s has no output %d", u.TxID, u.Vout)
+	}
+	out := tx.TxOut[u.Vout]
+	if out.Value != u.ValueSats || !bytes.Equal(out.PkScript, script) {
+		return nil, fmt.Errorf("output %s differs from the indexed UTXO - re-index it", outpointKey(u))
+	}
+	if s.prevTxs == nil {
+		s.prevTxs = map[string]*MsgTx{}
+	}
+	s.prevTxs[u.TxID] = tx
+	return tx, nil
+}
+
+// Attach the spent output to a PSBT input: the full previous transaction for
+// legacy inputs, the output alone for SegWit, plus the previous transaction
+// for SegWit v0 when one was supplied (see IndexRaw)
+func (s *Sweeper) setInputUTXO(in *PSBTInput, u UTXO) error {
+	script, err := s.buildOutputScript(u.Address)
+	if err != nil {
+		return err
+	}
+	if isP2PKHScript(script) {
+		tx, err := s.prevTxFor(u, script)
+		if err != nil {
+			return err
+		}
+		in.NonWitnessUtxo = tx
+		return nil
+	}
+	in.WitnessUtxo = &TxOut{Value: u.ValueSats, PkScript: script}
+	if tx, ok := s.prevTxs[u.TxID]; ok && script[0] == 0x00 {
+		in.NonWitnessUtxo = tx
+	}
+	return nil
+}
+
+// Output spent by a PSBT input, from whichever UTXO field it carries
+func spentOutput(in *PSBTInput, op OutPoint) *TxOut {
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo
+	}
+	if in.NonWitnessUtxo != nil && in.NonWitnessUtxo.TxHash() == op.Hash && int(op.Index) < len(in.NonWitnessUtxo.TxOut) {
+		return &in.NonWitnessUtxo.TxOut[op.Index]
+	}
+	return nil
+}
+
+func isP2PKHScript(script []byte) bool {
+	return len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 0x14 &&
+		script[23] == 0x88 && script[24] == 0xac
+}
+
+// Assemble <sig> <pubkey> for a P2PKH input from the partial signature whose
+// key hashes to the script, once it verifies
+func finalizeP2PKH(h *sigHasher, idx int, in *PSBTInput, script []byte) ([]byte, [][]byte, error) {
+	for pk, sig := range in.PartialSigs {
+		if !bytesEqual(Hash160([]byte(pk)), script[3:23]) {
+			continue
+		}
+		if len(sig) == 0 || len(sig) > 75 || len(pk) > 75 {
+			return nil, nil, errors.New("invalid P2PKH signature or public key length")
+		}
+		err := checkECDSASig([]byte(pk), sig, func(ht uint32) ([32]byte, error) {
+			return LegacySigHash(h.tx, idx, script, ht)
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("P2PKH partial signature: %w", err)
+		}
+		sigScript := append([]byte{byte(len(sig))}, sig...)
+		sigScript = append(sigScript, byte(len(pk)))
+		return append(sigScript, pk...), nil, nil
+	}
+	return nil, nil, errors.New("no partial signature for the P2PKH key")
+}
+
+// LegacySigHash computes the original (pre-SegWit) signature hash of input idx
+// spending prevScript, for signers that need the digest itself. It reproduces
+// consensus quirks, including the SIGHASH_SINGLE hash of 1 when the input has
+// no matching output.
+func LegacySigHash(tx *MsgTx, idx int, prevScript []byte, hashType uint32) ([32]byte, error) {
+	var one [32]byte
+	one[0] = 1
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return [32]byte{}, fmt.Errorf("input index %d out of range", idx)
+	}
+	base := hashType & 0x1f
+	if base == 0x03 && idx >= len(tx.TxOut) {
+		return one, nil
+	}
+
+	c := &MsgTx{Version: tx.Version, LockTime: tx.LockTime}
+	for i, in := range tx.TxIn {
+		in.Witness = nil
+		in.SignatureScript = nil
+		if i == idx {
+			in.SignatureScript = prevScript
+		} else if base == 0x02 || base == 0x03 {
+			in.Sequence = 0
+		}
+		c.TxIn = append(c.TxIn, in)
+	}
+	switch base {
+	case 0x02: // NONE
+		c.TxOut = nil
+	case 0x03: // SINGLE
+		c.TxOut = make([]TxOut, idx+1)
+		for i := 0; i < idx; i++ {
+			c.TxOut[i] = TxOut{Value: -1}
+		}
+		c.TxOut[idx] = tx.TxOut[idx]
+	default:
+		c.TxOut = append([]TxOut(nil), tx.TxOut...)
+	}
+	if hashType&sighashAnyoneCanPay != 0 {
+		c.TxIn = []TxIn{c.TxIn[idx]}
+	}
+	b := binary.LittleEndian.AppendUint32(c.Serialize(false), hashType)
+	return sha256Double(b), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Compressed public key of private key 1 and its well-known P2PKH address
+const (
+	legacyTestPub  = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	legacyTestAddr = "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"
+)
+
+type fakePrevTxs map[string][]byte
+
+func (f fakePrevTxs) RawTransaction(txid string) ([]byte, error) {
+	if raw, ok := f[txid]; ok {
+		return raw, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestP2PKHAddress(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	addr, err := CreateP2PKH(Hash160(pub), BitcoinMainnet)
+	if err != nil || addr != legacyTestAddr {
+		t.Fatalf("CreateP2PKH = %s (%v), want %s", addr, err, legacyTestAddr)
+	}
+	dec, err := DecodeAddress(addr)
+	if err != nil || dec.Type != P2PKH || !dec.OnNetwork(BitcoinMainnet) || dec.OnNetwork(BitcoinTestnet) {
+		t.Fatalf("DecodeAddress: %+v %v", dec, err)
+	}
+	if err := ValidateAddress(addr, pub, BitcoinMainnet); err != nil {
+		t.Fatalf("ValidateAddress: %v", err)
+	}
+	// Bitcoin and Litecoin testnet share a version byte
+	tn, _ := CreateP2PKH(Hash160(pub), LitecoinTestnet)
+	if dec, err := DecodeAddress(tn); err != nil || !dec.OnNetwork(LitecoinTestnet) || !dec.OnNetwork(BitcoinTestnet) {
+		t.Fatalf("testnet P2PKH not accepted on both testnets: %v", err)
+	}
+	if _, err := DecodeAddress(legacyTestAddr[:len(legacyTestAddr)-1] + "N"); err == nil {
+		t.Fatalf("expected a checksum error")
+	}
+}
+
+func TestLegacySigHash(t *testing.T) {
+	tx := NewMsgTx(2)
+	tx.AddTxIn(TxIn{Sequence: 0xffffffff})
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Index: 1}, Sequence: 0xffffffff})
+	tx.AddTxOut(TxOut{Value: 1000, PkScript: []byte{0x51}})
+	script := BuildP2PKHScript(make([]byte, 20))
+
+	all, _ := LegacySigHash(tx, 0, script, sighashAll)
+	acp, _ := LegacySigHash(tx, 0, script, sighashAll|sighashAnyoneCanPay)
+	if all == acp {
+		t.Fatalf("ANYONECANPAY should not commit to the other input")
+	}
+	single, _ := LegacySigHash(tx, 1, script, 0x03)
+	if single != ([32]byte{1}) {
+		t.Fatalf("SIGHASH_SINGLE without a matching output should hash to 1")
+	}
+	none1, _ := LegacySigHash(tx, 0, script, sighashNone)
+	tx.TxOut[0].Value = 2000
+	none2, _ := LegacySigHash(tx, 0, script, sighashNone)
+	all2, _ := LegacySigHash(tx, 0, script, sighashAll)
+	if none1 != none2 || all == all2 {
+		t.Fatalf("SIGHASH_NONE must ignore outputs and SIGHASH_ALL must not")
+	}
+	if _, err := LegacySigHash(tx, 2, script, sighashAll); err == nil {
+		t.Fatalf("expected an out-of-range input error")
+	}
+}
+
+func TestP2PKHSpend(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+
+	prev := NewMsgTx(1)
+	prev.AddTxIn(TxIn{Sequence: 0xffffffff})
+	prev.AddTxOut(TxOut{Value: 300_000, PkScript: BuildP2PKHScript(Hash160(pub))})
+	u := UTXO{TxID: prev.TxID(), Vout: 0, ValueSats: 300_000, Address: legacyTestAddr, Confirmed: true}
+	if err := s.Index(u); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	dest, _ := CreateP2WPKH(make([]byte, 20), BitcoinMainnet)
+	if _, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 100_000}}); err == nil || !strings.Contains(err.Error(), "PrevTxSource") {
+		t.Fatalf("expected a missing previous transaction error, got %v", err)
+	}
+
+	s.SetPrevTxSource(fakePrevTxs{prev.TxID(): prev.Serialize(true)})
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if vb := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs); vb != 10+148+2*31 {
+		t.Fatalf("estimated %d vB, want %d", vb, 10+148+2*31)
+	}
+
+	parsed, err := ParsePSBT(plan.PSBT.Serialize())
+	if err != nil {
+		t.Fatalf("ParsePSBT: %v", err)
+	}
+	in := &parsed.Inputs[0]
+	if in.WitnessUtxo != nil || in.NonWitnessUtxo == nil || in.NonWitnessUtxo.TxID() != prev.TxID() {
+		t.Fatalf("legacy input should carry the previous transaction only")
+	}
+
+	in.PartialSigs[string(pub)] = append(bytes.Repeat([]byte{0x30}, 71), sighashAll)
+	if _, err := finalizeSignedPSBT(plan, parsed); err == nil {
+		t.Fatalf("expected an unverifiable signature to be refused")
+	}
+	testECDSAKey{d: big.NewInt(1)}.signPSBT(t, parsed)
+	sig := in.PartialSigs[string(pub)]
+	tx, err := finalizeSignedPSBT(plan, parsed)
+	if err != nil {
+		t.Fatalf("finalizeSignedPSBT: %v", err)
+	}
+	want := append(append([]byte{72}, sig...), 33)
+	want = append(want, pub...)
+	if !bytes.Equal(tx.TxIn[0].SignatureScript, want) || len(tx.TxIn[0].Witness) != 0 {
+		t.Fatalf("unexpected scriptSig %x", tx.TxIn[0].SignatureScript)
+	}
+
+	// A source returning a different output is refused
+	bad := NewMsgTx(1)
+	bad.AddTxIn(TxIn{Sequence: 0xffffffff})
+	bad.AddTxOut(TxOut{Value: 1, PkScript: BuildP2PKHScript(Hash160(pub))})
+	s.SetPrevTxSource(fakePrevTxs{prev.TxID(): bad.Serialize(true)})
+	if _, err := s.prevTxFor(u, BuildP2PKHScript(Hash160(pub))); err == nil {
+		t.Fatalf("expected a txid mismatch error")
+	}
+}
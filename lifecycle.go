@@ -0,0 +1,258 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the plan lifecycle state machine.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Lifecycle states recorded on TransactionPlan.Status, alongside PlanSigned
+// and PlanConfirmed
+const (
+	PlanDraft      PlanState = "draft"      // Built, not yet approved or signed
+	PlanApproved   PlanState = "approved"   // Cleared for signing
+	PlanBroadcast  PlanState = "broadcast"  // Sent to the network, not yet mined
+	PlanConfirming PlanState = "confirming" // Mined, short of the finality depth
+	PlanAbandoned  PlanState = "abandoned"  // Given up on by the operator
+	PlanReplaced   PlanState = "replaced"   // Superseded by a fee bump or cancellation
+	PlanConflicted PlanState = "conflicted" // Inputs spent by a transaction that is not ours
+)
+
+// defaultFinalityDepth is the confirmation count at which a plan is final.
+const defaultFinalityDepth = 6
+
+// defaultPlanRetention is how many finished plans stay tracked in memory.
+const defaultPlanRetention = 1000
+
+// planTransitions lists the states each state may move to. Observations of
+// the network (broadcast, mined, conflicted) are accepted from any live state
+// because signing and broadcast can happen outside the sweeper; the terminal
+// states (confirmed, abandoned, replaced, conflicted) lead nowhere.
+var planTransitions = map[PlanState][]PlanState{
+	PlanDraft:      {PlanApproved, PlanSigned, PlanBroadcast, PlanConfirming, PlanConfirmed, PlanAbandoned, PlanConflicted},
+	PlanApproved:   {PlanSigned, PlanBroadcast, PlanConfirming, PlanConfirmed, PlanAbandoned, PlanConflicted},
+	PlanSigned:     {PlanBroadcast, PlanConfirming, PlanConfirmed, PlanAbandoned, PlanConflicted},
+	PlanBroadcast:  {PlanConfirming, PlanConfirmed, PlanAbandoned, PlanReplaced, PlanConflicted},
+	PlanConfirming: {PlanConfirmed, PlanBroadcast, PlanConflicted}, // Back to broadcast on a reorg
+}
+
+// PlanTransition is one entry of a plan's state history.
+type PlanTransition struct {
+	State  PlanState `json:"state"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Terminal reports whether no further transitions leave s.
+func (s PlanState) Terminal() bool {
+	return s == PlanConfirmed || s == PlanAbandoned || s == PlanReplaced || s == PlanConflicted
+}
+
+// Whether the plan can still confirm and so counts towards exposure limits
+func (p *TransactionPlan) inFlight() bool {
+	return p.ConfirmedAt == nil && !p.Status.Terminal()
+}
+
+// Check that p may move to state to without changing it
+func checkTransition(p *TransactionPlan, to PlanState) error {
+	if p.Status == to {
+		return nil
+	}
+	for _, st := range planTransitions[p.Status] {
+		if st == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("plan %s cannot go from %s to %s", p.ID, p.Status, to)
+}
+
+// Move p to state to, appending to its history; the caller persists the plan
+func transitionPlan(p *TransactionPlan, to PlanState, at time.Time, reason string) error {
+	if p.Status == to {
+		return nil
+	}
+	if err := checkTransition(p, to); err != nil {
+		return err
+	}
+	p.Status = to
+	p.History = append(p.History, PlanTransition{State: to, At: at.UTC(), Reason: reason})
+	return nil
+}
+
+// Move a tracked plan to a new state and persist it
+func (s *Sweeper) setPlanState(id string, to PlanState, at time.Time, reason string) error {
+	p, ok := s.plans[id]
+	if !ok {
+		return fmt.Errorf("unknown plan %q", id)
+	}
+	if err := transitionPlan(p, to, at, reason); err != nil {
+		return err
+	}
+	s.logger.Printf("plan %s: %s %s", id, to, reason)
+	if err := s.savePlan(p); err != nil {
+		return err
+	}
+	return s.archiveFinishedPlans()
+}
+
+// Lifecycle state of a plan saved before states were recorded, with the
+// history its timestamps imply
+func legacyPlanState(p *TransactionPlan) (PlanState, []PlanTransition) {
+	h := []PlanTransition{{State: PlanDraft, At: p.CreatedAt}}
+	st := PlanDraft
+	if p.SignedTx != nil && p.BroadcastAt == nil {
+		st = PlanSigned
+	}
+	if p.BroadcastAt != nil {
+		st = PlanBroadcast
+		h = append(h, PlanTransition{State: st, At: *p.BroadcastAt})
+	}
+	if p.ConfirmedAt != nil {
+		st = PlanConfirmed
+		h = append(h, PlanTransition{State: st, At: *p.ConfirmedAt})
+	}
+	return st, h
+}
+
+// SetFinalityDepth sets the confirmations after which a mined plan moves
+// from confirming to confirmed (default 6; 1 skips confirming).
+func (s *Sweeper) SetFinalityDepth(n int) error {
+	if n < 1 {
+		return errors.New("finality depth must be at least 1")
+	}
+	s.finalityDepth = n
+	return nil
+}
+
+// SetPlanRetention sets how many finished (terminal) plans stay tracked
+// (default 1000). Beyond it the plans that finished longest ago are archived:
+// dropped from memory and the plan index so tracking stays bounded, their
+// records kept in the KV store for ArchivedPlan.
+func (s *Sweeper) SetPlanRetention(n int) error {
+	if n < 1 {
+		return errors.New("plan retention must be at least 1")
+	}
+	s.planRetention = n
+	return s.archiveFinishedPlans()
+}
+
+// ArchivedPlan reads a plan archived past the retention limit from the KV
+// store. It is not tracked again.
+func (s *Sweeper) ArchivedPlan(id string) (*TransactionPlan, error) {
+	if p, ok := s.plans[id]; ok {
+		return p, nil
+	}
+	b, err := s.kv.Get([]byte("plan:" + id))
+	if err != nil {
+		return nil, fmt.Errorf("unknown plan %q", id)
+	}
+	var rec planRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	return s.planFromRecord(&rec)
+}
+
+// Archive the finished plans beyond the retention limit, oldest first
+func (s *Sweeper) archiveFinishedPlans() error {
+	var done []*TransactionPlan
+	for _, p := range s.plans {
+		if p.Status.Terminal() {
+			done = append(done, p)
+		}
+	}
+	if len(done) <= s.planRetention {
+		return nil
+	}
+	finishedAt := func(p *TransactionPlan) time.Time {
+		if len(p.History) == 0 {
+			return p.CreatedAt
+		}
+		return p.History[len(p.History)-1].At
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if a, b := finishedAt(done[i]), finishedAt(done[j]); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return done[i].ID < done[j].ID
+	})
+	drop := map[string]bool{}
+	for _, p := range done[:len(done)-s.planRetention] {
+		drop[p.ID] = true
+	}
+	err := s.updatePlanIndex(func(ids []string) []string {
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if !drop[id] {
+				out = append(out, id)
+			}
+		}
+		return out
+	})
+	if err != nil {
+		return err
+	}
+	for id := range drop {
+		delete(s.plans, id)
+	}
+	s.logger.Printf("archived %d finished plans", len(drop))
+	return nil
+}
+
+// ApprovePlan records that a draft plan was cleared for signing.
+func (s *Sweeper) ApprovePlan(id string, at time.Time) error {
+	return s.setPlanState(id, PlanApproved, at, "")
+}
+
+// AbandonPlan records that a plan will not be pursued. Unlike DiscardPlan the
+// plan and its history stay tracked; it stops counting towards exposure limits.
+func (s *Sweeper) AbandonPlan(id, reason string, at time.Time) error {
+	return s.setPlanState(id, PlanAbandoned, at, reason)
+}
+
+// MarkReplaced records that a broadcast plan was superseded by byTxID, such
+// as its fee bump or cancellation.
+func (s *Sweeper) MarkReplaced(id, byTxID string, at time.Time) error {
+	return s.setPlanState(id, PlanReplaced, at, "replaced by "+byTxID)
+}
+
+// MarkConflicted records that a plan's inputs were spent by another
+// transaction, so it can never confirm.
+func (s *Sweeper) MarkConflicted(id, reason string, at time.Time) error {
+	return s.setPlanState(id, PlanConflicted, at, reason)
+}
+
+// Record n confirmations of a mined plan: confirmed at the finality depth,
+// back to broadcast if a reorg unmined it
+func (s *Sweeper) observeConfirmations(p *TransactionPlan, n int, at time.Time) error {
+	switch {
+	case n >= s.finalityDepth && p.Status == PlanConfirming:
+		return s.setPlanState(p.ID, PlanConfirmed, at, fmt.Sprintf("%d confirmations", n))
+	case n == 0 && p.Status == PlanConfirming:
+		if err := transitionPlan(p, PlanBroadcast, at, "reorged out"); err != nil {
+			return err
+		}
+		p.ConfirmedAt = nil
+		s.logger.Printf("plan %s: reorged out, back to broadcast", p.ID)
+		return s.savePlan(p)
+	}
+	return nil
+}
+
+// PlansByState returns the tracked plans in any of states, in creation order.
+func (s *Sweeper) PlansByState(states ...PlanState) []*TransactionPlan {
+	var out []*TransactionPlan
+	for _, p := range s.PendingPlans() {
+		for _, st := range states {
+			if p.Status == st {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Plan one 50k payout from a fresh coin
+func lifecyclePlan(t *testing.T, s *Sweeper, c string) *TransactionPlan {
+	t.Helper()
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat(c, 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	p, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	return p
+}
+
+func TestPlanLifecycleTransitions(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	now := time.Now()
+	p := lifecyclePlan(t, s, "a")
+	if p.Status != PlanDraft || len(p.History) != 1 {
+		t.Fatalf("new plan: %s %+v", p.Status, p.History)
+	}
+	if err := s.ApprovePlan(p.ID, now); err != nil {
+		t.Fatalf("ApprovePlan: %v", err)
+	}
+	if err := s.MarkReplaced(p.ID, "ff", now); err == nil {
+		t.Fatalf("an unbroadcast plan cannot be replaced")
+	}
+	_ = s.MarkBroadcast(p.ID, now)
+	_ = s.MarkConfirmed(p.ID, now)
+	if p.Status != PlanConfirming {
+		t.Fatalf("mined plan short of finality is %s", p.Status)
+	}
+
+	// The tracker finalizes at the depth and reverts on a reorg
+	if _, err := NewConfirmationTracker(s, confMap{}).Poll(now); err != nil || p.Status != PlanBroadcast || p.ConfirmedAt != nil {
+		t.Fatalf("reorg: %s, confirmed at %v, %v", p.Status, p.ConfirmedAt, err)
+	}
+	if _, err := NewConfirmationTracker(s, confMap{p.ID: 6}).Poll(now); err != nil || p.Status != PlanConfirmed {
+		t.Fatalf("final: %s, %v", p.Status, err)
+	}
+	if err := s.AbandonPlan(p.ID, "", now); err == nil {
+		t.Fatalf("a confirmed plan cannot be abandoned")
+	}
+	want := []PlanState{PlanDraft, PlanApproved, PlanBroadcast, PlanConfirming, PlanBroadcast, PlanConfirming, PlanConfirmed}
+	if len(p.History) != len(want) {
+		t.Fatalf("history %+v", p.History)
+	}
+	for i, st := range want {
+		if p.History[i].State != st {
+			t.Fatalf("history[%d] = %s, want %s", i, p.History[i].State, st)
+		}
+	}
+
+	// State and history survive a restart
+	s2 := newTestSweeper(t, WithKV(kv))
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	if q, _ := s2.GetPlan(p.ID); q.Status != PlanConfirmed || len(q.History) != len(want) || !q.History[2].At.Equal(p.History[2].At) {
+		t.Fatalf("reloaded %s %+v", q.Status, q.History)
+	}
+}
+
+func TestAbandonedPlansLeaveExposure(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(true, 5, 5)
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in")})
+	p, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	other := lifecyclePlan(t, s, "b")
+	_ = s.MarkBroadcast(other.ID, time.Now())
+	if err := s.MarkConflicted(other.ID, "inputs double-spent", time.Now()); err != nil {
+		t.Fatalf("MarkConflicted: %v", err)
+	}
+	if s.UnconfirmedExposure() != 100_000 {
+		t.Fatalf("exposure %d before abandoning", s.UnconfirmedExposure())
+	}
+	if err := s.AbandonPlan(p.ID, "customer cancelled", time.Now()); err != nil {
+		t.Fatalf("AbandonPlan: %v", err)
+	}
+	if s.UnconfirmedExposure() != 0 || p.History[1].Reason != "customer cancelled" {
+		t.Fatalf("abandoned plan still in flight: %d %+v", s.UnconfirmedExposure(), p.History)
+	}
+	if err := s.MarkBroadcast(p.ID, time.Now()); err == nil {
+		t.Fatalf("an abandoned plan cannot be broadcast")
+	}
+	if got := s.PlansByState(PlanAbandoned, PlanConflicted); len(got) != 2 || got[0] != p {
+		t.Fatalf("PlansByState = %v", got)
+	}
+	if got := s.PlansByState(PlanDraft); len(got) != 0 {
+		t.Fatalf("no drafts expected, got %d", len(got))
+	}
+	if err := s.SetFinalityDepth(0); err == nil {
+		t.Fatalf("expected a zero finality depth to be refused")
+	}
+}
+
+func TestFinishedPlansArchivedPastRetention(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	if err := s.SetPlanRetention(2); err != nil {
+		t.Fatalf("SetPlanRetention: %v", err)
+	}
+	now := time.Now()
+	var ids []string
+	for i, c := range []string{"a", "b", "c", "d"} {
+		p := lifecyclePlan(t, s, c)
+		ids = append(ids, p.ID)
+		if i < 3 {
+			_ = s.AbandonPlan(p.ID, "test", now.Add(time.Duration(i)*time.Minute))
+		}
+	}
+	if _, ok := s.GetPlan(ids[0]); ok || len(s.plans) != 3 {
+		t.Fatalf("expected the oldest finished plan archived, tracking %d plans", len(s.plans))
+	}
+	if _, ok := s.GetPlan(ids[3]); !ok {
+		t.Fatalf("a live plan must never be archived")
+	}
+	p, err := s.ArchivedPlan(ids[0])
+	if err != nil || p.Status != PlanAbandoned {
+		t.Fatalf("ArchivedPlan: %v", err)
+	}
+
+	// Reloading does not bring archived plans back
+	s2 := newTestSweeper(t, WithKV(kv))
+	if err := s2.LoadPlans(); err != nil || len(s2.plans) != 3 {
+		t.Fatalf("LoadPlans: %d plans, %v", len(s2.plans), err)
+	}
+	if err := s.SetPlanRetention(0); err == nil {
+		t.Fatalf("expected a zero retention to be rejected")
+	}
+}
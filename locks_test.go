@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLockedUTXOsAreNeverSpent(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	big := UTXO{TxID: stringsRepeat("ab", 32), Vout: 1, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true}
+	small := UTXO{TxID: stringsRepeat("cd", 32), Vout: 0, ValueSats: 80_000, Address: testAddr("in"), Confirmed: true}
+	_ = s.Index(big)
+	_ = s.Index(small)
+	if err := s.LockUTXO(big.TxID, big.Vout); err != nil {
+		t.Fatalf("LockUTXO: %v", err)
+	}
+	if err := s.LockUTXO("xyz", 0); err == nil {
+		t.Fatalf("expected a malformed txid to be refused")
+	}
+
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err == nil {
+		t.Fatalf("expected the locked coin to be left out")
+	}
+	plan, err := s.ConsolidateAll(testAddr("dest"))
+	if err != nil || len(plan.Inputs) != 1 || plan.Inputs[0].TxID != small.TxID {
+		t.Fatalf("ConsolidateAll spent %+v, %v", plan, err)
+	}
+	_ = s.DiscardPlan(plan.ID)
+	op, _ := NewOutPointFromStr(big.TxID, big.Vout)
+	if _, err := s.SpendFrom([]OutPoint{op}, []TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err == nil {
+		t.Fatalf("expected coin control to refuse a locked coin")
+	}
+
+	// The lock survives a restart and lifts on unlock
+	s2 := newTestSweeper(t, WithKV(kv))
+	_ = s2.Index(big)
+	if got, err := s2.ListLocked(); err != nil || len(got) != 1 || got[0].TxID != big.TxID || got[0].Vout != 1 || got[0].LockedAt.IsZero() {
+		t.Fatalf("ListLocked = %+v", got)
+	}
+	if err := s2.UnlockUTXO(big.TxID, big.Vout); err != nil {
+		t.Fatalf("UnlockUTXO: %v", err)
+	}
+	if err := s2.UnlockUTXO(big.TxID, big.Vout); err == nil {
+		t.Fatalf("expected unlocking twice to fail")
+	}
+	if _, err := s2.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err != nil {
+		t.Fatalf("Spend after unlock: %v", err)
+	}
+}
+
+func TestUnreadableUTXOLocksRefusePlanning(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	_ = s.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	_ = kv.Put([]byte(utxoLocksKey), []byte("{not json"))
+
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err == nil || !strings.Contains(err.Error(), "corrupt UTXO lock set") {
+		t.Fatalf("expected a corrupt lock set to refuse planning, got %v", err)
+	}
+	if _, err := s.ConsolidateToMany([]string{testAddr("dest")}, 0); err == nil {
+		t.Fatalf("expected consolidation to be refused")
+	}
+	if _, err := s.ListLocked(); err == nil {
+		t.Fatalf("expected ListLocked to report the corrupt lock set")
+	}
+	// Locking must not overwrite the locks it cannot read
+	if err := s.LockUTXO(stringsRepeat("cd", 32), 0); err == nil {
+		t.Fatalf("expected LockUTXO to refuse a corrupt lock set")
+	}
+	if b, _ := kv.Get([]byte(utxoLocksKey)); string(b) != "{not json" {
+		t.Fatalf("corrupt lock set overwritten: %s", b)
+	}
+
+	s2 := newTestSweeper(t, WithKV(failingGetKV{kv}))
+	_ = s2.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s2.ConsolidateAll(testAddr("dest")); err == nil || !strings.Contains(err.Error(), "disk error") {
+		t.Fatalf("expected an unreadable lock set to refuse planning, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains locktimes (explicit and anti-fee-sniping) and the
+// earliest point at which a plan's transaction is valid.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lockTimeThreshold separates block-height locktimes from unix timestamps.
+const lockTimeThreshold = 500_000_000
+
+// ChainInfoProvider reports the current chain tip: its height and its median
+// time past (BIP-113), which time-based locktimes are compared against.
+type ChainInfoProvider interface {
+	ChainTip() (height int64, medianTime time.Time, err error)
+}
+
+// SetChainInfo sets the chain tip source used for anti-fee-sniping and for
+// refusing to broadcast transactions that are not yet final.
+func (s *Sweeper) SetChainInfo(src ChainInfoProvider) {
+	s.chain = src
+}
+
+// SetAntiFeeSniping sets nLockTime to the current tip height on plans without
+// an explicit locktime, as Bitcoin Core does, so a miner re-mining the last
+// block cannot include them. It needs a chain info source.
+func (s *Sweeper) SetAntiFeeSniping(enabled bool) error {
+	if enabled && s.chain == nil {
+		return errors.New("anti-fee-sniping needs a chain info source - call SetChainInfo first")
+	}
+	s.antiFeeSniping = enabled
+	return nil
+}
+
+// Locktime for a new plan: explicit, else the tip height with anti-fee-sniping.
+// A tip lookup failure skips anti-fee-sniping rather than blocking the plan.
+func (s *Sweeper) planLockTime(p spendParams) uint32 {
+	if p.lockTime > 0 || !s.antiFeeSniping || s.chain == nil {
+		return p.lockTime
+	}
+	h, _, err := s.chain.ChainTip()
+	if err != nil || h <= 0 || h >= lockTimeThreshold {
+		s.logger.Printf("anti-fee-sniping skipped: chain tip unavailable (%v)", err)
+		return 0
+	}
+	return uint32(h)
+}
+
+// LockTimeValidity is the earliest point a plan's transaction can be mined.
+type LockTimeValidity struct {
+	LockTime uint32    `json:"lock_time"`
+	Height   int64     `json:"valid_from_height,omitempty"` // First block height that may include it
+	Time     time.Time `json:"valid_after_time,omitempty"`  // Median time past must pass this
+}
+
+// Validity reports when the plan's transaction becomes final, or nil when its
+// locktime does not restrict it (no locktime, or every input final).
+func (p *TransactionPlan) Validity() *LockTimeValidity {
+	tx := p.RawTx
+	if tx == nil || tx.LockTime == 0 {
+		return nil
+	}
+	enforced := false
+	for _, in := range tx.TxIn {
+		if in.Sequence != 0xffffffff {
+			enforced = true
+		}
+	}
+	if !enforced {
+		return nil
+	}
+	v := &LockTimeValidity{LockTime: tx.LockTime}
+	if tx.LockTime < lockTimeThreshold {
+		v.Height = int64(tx.LockTime) + 1
+	} else {
+		v.Time = time.Unix(int64(tx.LockTime), 0).UTC()
+	}
+	return v
+}
+
+// ReadyAt reports whether a transaction with this validity can enter the
+// mempool on top of a tip at tipHeight with median time past tipMTP.
+func (v *LockTimeValidity) ReadyAt(tipHeight int64, tipMTP time.Time) bool {
+	if v == nil {
+		return true
+	}
+	if v.Height > 0 {
+		return tipHeight+1 >= v.Height
+	}
+	return tipMTP.After(v.Time)
+}
+
+func (v *LockTimeValidity) String() string {
+	if v.Height > 0 {
+		return fmt.Sprintf("block %d", v.Height)
+	}
+	return "median time past " + v.Time.Format(time.RFC3339)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type fixedTip struct {
+	height int64
+	mtp    time.Time
+}
+
+func (f *fixedTip) ChainTip() (int64, time.Time, error) { return f.height, f.mtp, nil }
+
+type recordingBroadcaster struct{ sent int }
+
+func (r *recordingBroadcaster) Broadcast(raw []byte) (string, error) {
+	r.sent++
+	return "ok", nil
+}
+
+func TestLockTimeValidityAndBroadcast(t *testing.T) {
+	s := newTestSweeper(t)
+	tip := &fixedTip{height: 800_000, mtp: time.Unix(1_700_000_000, 0)}
+	s.SetChainInfo(tip)
+	if err := s.SetAntiFeeSniping(true); err != nil {
+		t.Fatalf("SetAntiFeeSniping: %v", err)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	v := plan.Validity()
+	if v == nil || plan.RawTx.LockTime != 800_000 || v.Height != 800_001 {
+		t.Fatalf("expected anti-fee-sniping locktime at the tip, got %+v", v)
+	}
+	if !v.ReadyAt(800_000, time.Time{}) {
+		t.Fatalf("expected the plan to be valid in the next block")
+	}
+
+	// An explicit future locktime is reported and blocks broadcast
+	future, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{LockTime: 800_100})
+	if err != nil {
+		t.Fatalf("Spend with locktime: %v", err)
+	}
+	if v := future.Validity(); v == nil || v.Height != 800_101 || future.Settings.LockTime != 800_100 {
+		t.Fatalf("expected explicit locktime, got %+v", v)
+	}
+	b := &recordingBroadcaster{}
+	if _, err := s.BroadcastPlan(future.ID, b); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("expected unsigned plan to be refused, got %v", err)
+	}
+	future.SignedTx = future.RawTx
+	if _, err := s.BroadcastPlan(future.ID, b); err == nil || !strings.Contains(err.Error(), "block 800101") {
+		t.Fatalf("expected early broadcast to be refused, got %v", err)
+	}
+	tip.height = 800_100
+	if _, err := s.BroadcastPlan(future.ID, b); err != nil || b.sent != 1 {
+		t.Fatalf("expected broadcast once valid, got %v", err)
+	}
+	if future.BroadcastAt == nil {
+		t.Fatalf("expected plan to be marked broadcast")
+	}
+
+	// Time-based locktimes compare against median time past
+	tv := &LockTimeValidity{LockTime: 1_700_000_100, Time: time.Unix(1_700_000_100, 0)}
+	if tv.ReadyAt(0, tip.mtp) || !tv.ReadyAt(0, time.Unix(1_700_000_101, 0)) {
+		t.Fatalf("unexpected time locktime readiness")
+	}
+}
@@ -0,0 +1,66 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the long-term fee rate and the selection waste metric.
+package main
+
+import "fmt"
+
+// SetLongTermFeeRate sets the fee rate the sweeper expects to pay on average
+// over time, separate from the current spend fee rate (0 = unset, the
+// default), to weigh fees now against fees later. Plans then report their
+// WasteSats as Bitcoin Core's coin selection computes it: what spending the
+// inputs now costs over spending them at the long-term rate, plus the cost of
+// the change output or, when changeless, the excess given up as fee; negative
+// waste means spending the inputs now is cheap. SelectBranchAndBound keeps a
+// changeless match only if it wastes no more than selection with change,
+// opportunistic consolidation without its own fee rate sweeps in spare coins
+// whenever the spend rate is at or below the long-term rate, and
+// ConsolidationCostReport marks the rates at which consolidating now beats
+// spending the inputs later at the long-term rate.
+func (s *Sweeper) SetLongTermFeeRate(rate FeeRate) error {
+	if rate < 0 {
+		return fmt.Errorf("long-term fee rate must be non-negative (got %d sat/kvB)", rate)
+	}
+	s.longTermFeeRate = rate
+	return nil
+}
+
+// LongTermFeeRate returns the rate set with SetLongTermFeeRate (0 = unset).
+func (s *Sweeper) LongTermFeeRate() FeeRate {
+	return s.longTermFeeRate
+}
+
+// Waste of spending inputs at the call's fee rate against the long-term rate,
+// plus the cost of a change output to changeAddr when change is made, or else
+// the excess given up as fee
+func (s *Sweeper) selectionWaste(inputs []UTXO, change bool, excess int64, changeAddr string, p spendParams) int64 {
+	var waste int64
+	for _, u := range inputs {
+		vb := inputVBytes(s, u)
+		waste += p.feeRate.Fee(vb) - s.longTermFeeRate.Fee(vb)
+	}
+	if change {
+		return waste + s.changeCost(changeAddr, p)
+	}
+	return waste + excess
+}
+
+// Cost of creating a change output to addr now and spending it at the
+// long-term rate
+func (s *Sweeper) changeCost(addr string, p spendParams) int64 {
+	out := estimateTxVBytesDetailed(s, nil, []TxOutput{{Address: addr}}) - estimateTxVBytesDetailed(s, nil, nil)
+	return p.feeRate.Fee(out) + s.longTermFeeRate.Fee(inputVBytes(s, UTXO{Address: addr}))
+}
+
+// Waste of a finished plan: its inputs, plus each change output or, when
+// changeless, the fee paid above the rate
+func (s *Sweeper) planWaste(plan *TransactionPlan, p spendParams) int64 {
+	if len(plan.ChangeIdxs) == 0 {
+		excess := plan.FeeSats - p.feeRate.Fee(estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs))
+		return s.selectionWaste(plan.Inputs, false, max64(excess, 0), "", p)
+	}
+	waste := s.selectionWaste(plan.Inputs, false, 0, "", p)
+	for _, i := range plan.ChangeIdxs {
+		waste += s.changeCost(plan.Outputs[i].Address, p)
+	}
+	return waste
+}
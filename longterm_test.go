@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestLongTermFeeRate(t *testing.T) {
+	s := newTestSweeper(t, WithFeeRate(5))
+	if err := s.SetLongTermFeeRate(-1); err == nil {
+		t.Fatalf("expected a negative rate to be refused")
+	}
+	for i, c := range "abcd" {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(c), 64), Vout: 0, ValueSats: int64(50_000 + i*10_000), Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 40_000}}
+	plan, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if plan.WasteSats != 0 || len(plan.Inputs) != 1 {
+		t.Fatalf("unset long-term rate: waste %d, %d inputs", plan.WasteSats, len(plan.Inputs))
+	}
+
+	// Below the long-term rate spare coins are swept in, and spending them
+	// now is cheaper than later
+	_ = s.SetLongTermFeeRate(SatPerVByte(20))
+	_ = s.SetOpportunisticConsolidation(0, 2)
+	plan, err = s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 3 {
+		t.Fatalf("expected 2 spare inputs below the long-term rate, got %d inputs", len(plan.Inputs))
+	}
+	p, _ := s.resolveSpendOptions(nil)
+	want := s.selectionWaste(plan.Inputs, true, 0, plan.Outputs[plan.ChangeIdxs[0]].Address, p)
+	if plan.WasteSats != want || plan.Settings.LongTermFeeRate != SatPerVByte(20) {
+		t.Fatalf("waste %d, want %d", plan.WasteSats, want)
+	}
+	if inputsOnly := s.selectionWaste(plan.Inputs, false, 0, "", p); inputsOnly >= 0 {
+		t.Fatalf("inputs spent below the long-term rate should have negative waste, got %d", inputsOnly)
+	}
+	if plan, _ = s.Spend(out, SpendOptions{FeeRate: 30}); len(plan.Inputs) != 1 {
+		t.Fatalf("consolidated above the long-term rate: %d inputs", len(plan.Inputs))
+	}
+
+	rep, err := s.ConsolidationCostReport([]int64{1, 50})
+	if err != nil {
+		t.Fatalf("ConsolidationCostReport: %v", err)
+	}
+	if !rep.Scenarios[0].ConsolidateNow || rep.Scenarios[1].ConsolidateNow {
+		t.Fatalf("consolidate-now marks %+v", rep.Scenarios)
+	}
+}
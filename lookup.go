@@ -0,0 +1,68 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains lookup and removal of individual indexed UTXOs.
+package main
+
+import "fmt"
+
+// GetUTXO returns the indexed UTXO at txid:vout.
+func (s *Sweeper) GetUTXO(txid string, vout uint32) (UTXO, bool) {
+	for _, u := range s.indexedUTXOs {
+		if u.TxID == txid && u.Vout == vout {
+			return u, true
+		}
+	}
+	return UTXO{}, false
+}
+
+// RemoveUTXO drops txid:vout from the index and, when the KV store supports
+// deletion, from storage. Reconciliation jobs use it to correct drift found by
+// AuditAgainst.
+func (s *Sweeper) RemoveUTXO(txid string, vout uint32) error {
+	n, err := s.removeUTXOs(func(u UTXO) bool { return u.TxID == txid && u.Vout == vout })
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("UTXO %s:%d is not indexed", txid, vout)
+	}
+	return nil
+}
+
+// RemoveByTx drops every indexed output of txid and returns how many were removed.
+func (s *Sweeper) RemoveByTx(txid string) (int, error) {
+	return s.removeUTXOs(func(u UTXO) bool { return u.TxID == txid })
+}
+
+// Remove matching UTXOs from the index and the KV store
+func (s *Sweeper) removeUTXOs(match func(UTXO) bool) (int, error) {
+	var removed []UTXO
+	kept := s.indexedUTXOs[:0]
+	for _, u := range s.indexedUTXOs {
+		if match(u) {
+			removed = append(removed, u)
+			continue
+		}
+		kept = append(kept, u)
+	}
+	s.indexedUTXOs = kept
+	for _, u := range removed {
+		if id := s.pendingPlanSpending(u); id != "" {
+			s.logger.Printf("removed %s:%d is an input of pending plan %s", u.TxID, u.Vout, id)
+		}
+		if err := s.kvDelete("utxo:" + outpointKey(u)); err != nil {
+			return len(removed), fmt.Errorf("failed to delete %s from storage: %w", outpointKey(u), err)
+		}
+		if err := s.kvDelete(receivedKey(u)); err != nil {
+			return len(removed), fmt.Errorf("failed to delete %s from storage: %w", outpointKey(u), err)
+		}
+	}
+	return len(removed), nil
+}
+
+// Delete a key if the KV store supports it
+func (s *Sweeper) kvDelete(key string) error {
+	if d, ok := s.kv.(KVDeleter); ok {
+		return d.Delete([]byte(key))
+	}
+	return nil
+}
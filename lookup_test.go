@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveUTXOAndRemoveByTxDeleteFromKV(t *testing.T) {
+	kv, err := OpenFileKV(filepath.Join(t.TempDir(), "kv.json"))
+	if err != nil {
+		t.Fatalf("OpenFileKV: %v", err)
+	}
+	s := newTestSweeper(t, WithKV(kv))
+	a, b := stringsRepeat("a", 64), stringsRepeat("b", 64)
+	for _, u := range []UTXO{
+		{TxID: a, Vout: 0, ValueSats: 10_000, Address: testAddr("x"), Confirmed: true},
+		{TxID: a, Vout: 1, ValueSats: 20_000, Address: testAddr("x"), Confirmed: true},
+		{TxID: b, Vout: 0, ValueSats: 30_000, Address: testAddr("y"), Confirmed: true},
+	} {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+
+	if u, ok := s.GetUTXO(a, 1); !ok || u.ValueSats != 20_000 {
+		t.Fatalf("GetUTXO = %+v, %v", u, ok)
+	}
+	if err := s.RemoveUTXO(b, 0); err != nil {
+		t.Fatalf("RemoveUTXO: %v", err)
+	}
+	if err := s.RemoveUTXO(b, 0); err == nil {
+		t.Fatalf("expected removing an unindexed UTXO to fail")
+	}
+	if _, err := kv.Get([]byte("utxo:" + b + ":0")); err == nil {
+		t.Fatalf("expected the KV record to be deleted")
+	}
+	if n, err := s.RemoveByTx(a); err != nil || n != 2 {
+		t.Fatalf("RemoveByTx = %d, %v", n, err)
+	}
+	if len(s.GetIndexedUTXOs()) != 0 {
+		t.Fatalf("expected an empty index")
+	}
+}
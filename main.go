@@ -3,11 +3,17 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // DEFAULT_DEST_ADDR is a testnet destination used when none is provided.
@@ -22,8 +28,10 @@ func main() {
 	configFlag := flag.String("config", "config.json", "Configuration file path")
 	pubKeyHexFlag := flag.String("pubkey", "", "33-byte compressed pubkey hex for P2WPKH (overrides PUBKEY_HEX env var)")
 	taprootXOnlyFlag := flag.String("taproot_xonly", "", "32-byte x-only taproot output key hex for P2TR change (overrides TAPROOT_XONLY_HEX env var)")
+	taprootInternalFlag := flag.String("taproot_internal", "", "33-byte compressed taproot internal key hex, tweaked per BIP-86 for P2TR change (overrides TAPROOT_INTERNAL_HEX env var)")
 	helpFlag := flag.Bool("help", false, "Show detailed help information and usage examples")
 	versionFlag := flag.Bool("version", false, "Show version information")
+	compatFlag := flag.String("compat", "", "JSON output shape: 'v1' keeps the original field names without api_version")
 
 	// Custom usage function
 	flag.Usage = func() {
@@ -43,12 +51,39 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Developer commands that need no configuration
+	if args := flag.Args(); len(args) > 0 && args[0] == "gen-vectors" {
+		runGenVectors(args[1:])
+		return
+	}
+
 	// Load configuration
 	config, err := LoadConfig(*configFlag)
 	if err != nil {
+		if args := flag.Args(); len(args) > 0 && args[0] == "doctor" {
+			rep := &DoctorReport{}
+			rep.add("config", DoctorFail, err.Error(), "fix "+*configFlag+" - see -help for the fields")
+			printDoctorReport(rep)
+			os.Exit(1)
+		}
 		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
 		os.Exit(1)
 	}
+	if *compatFlag != "" {
+		if err := validateCompat(*compatFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "-compat: %v\n", err)
+			os.Exit(2)
+		}
+		config.OutputCompat = *compatFlag
+	}
+
+	// Orchestration loads each account's own key and coins
+	if args := flag.Args(); len(args) > 0 && args[0] == "orchestrate" {
+		if code := runOrchestrate(config); code != 0 {
+			os.Exit(code)
+		}
+		return
+	}
 
 	// Determine destination address from flag, environment, or default
 	destAddr := os.Getenv("DEST_ADDR")
@@ -76,6 +111,14 @@ func main() {
 	if *taprootXOnlyFlag != "" {
 		taprootXOnlyHex = *taprootXOnlyFlag
 	}
+	taprootInternalHex := os.Getenv("TAPROOT_INTERNAL_HEX")
+	if *taprootInternalFlag != "" {
+		taprootInternalHex = *taprootInternalFlag
+	}
+	if taprootXOnlyHex != "" && taprootInternalHex != "" {
+		fmt.Fprintf(os.Stderr, "Set either the taproot output key (taproot_xonly) or the internal key (taproot_internal), not both\n")
+		os.Exit(1)
+	}
 
 	var pubKey []byte
 	if pubKeyHex != "" {
@@ -94,7 +137,12 @@ func main() {
 		pubKey = []byte("demo_compressed_pubkey_placeholder_33_bytes!!!!")[:33]
 	}
 
-	sweeper := NewSweeper(pubKey, config.ToNetwork())
+	logs := NewLogBuffer(0, nil)
+	sweeper, err := NewSweeper(pubKey, config.ToNetwork(), WithLogger(logs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 
 	// Apply configuration to sweeper
 	if err := config.ApplyToSweeper(sweeper); err != nil {
@@ -117,6 +165,29 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Taproot change key error: %v\n", err)
 			os.Exit(1)
 		}
+		if config.ChangeKeyProof == "" {
+			fmt.Fprintf(os.Stderr, "Warning: the taproot change key is not verified by a signer; make sure it is the tweaked output key you can sign for\n")
+		}
+	}
+	if taprootInternalHex != "" {
+		b, err := hex.DecodeString(taprootInternalHex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid TAPROOT_INTERNAL_HEX/taproot_internal flag: %v\n", err)
+			os.Exit(1)
+		}
+		if err := sweeper.SetTaprootChangeInternalKey(b); err != nil {
+			fmt.Fprintf(os.Stderr, "Taproot internal key error: %v\n", err)
+			os.Exit(1)
+		}
+		if config.ChangeKeyProof == "" {
+			fmt.Fprintf(os.Stderr, "Warning: the taproot change key is not verified by a signer\n")
+		}
+	}
+	if config.ChangeKeyProof != "" && (taprootXOnlyHex != "" || taprootInternalHex != "" || len(config.MuSig2Participants) == 0) {
+		if err := config.ApplyChangeKeyProof(sweeper); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// Index all UTXOs from the file
@@ -128,20 +199,83 @@ func main() {
 		}
 		fmt.Printf("Indexed UTXO %d: %s:%d (%d sats)\n", i, utxo.TxID, utxo.Vout, utxo.ValueSats)
 	}
-
-	// Create spending transaction with single output
-	outputs := []TxOutput{
-		{Address: destAddr, ValueSats: 150_000}, // Send 150,000 sats to destination
+	for _, w := range sweeper.AddressReuseWarnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
 	}
 
-	fmt.Println("\nCreating spending transaction...")
-	plan, err := sweeper.Spend(outputs)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Transaction creation failed: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Check that you have sufficient UTXOs and valid addresses\n")
-		os.Exit(1)
+	var plan *TransactionPlan
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "run-template":
+			plan = runTemplateCommand(sweeper, args[1:])
+		case "sweep-offline":
+			plan = runSweepOffline(sweeper, destAddr, args[1:])
+		case "daemon":
+			// Exit only after runDaemon's deferred cleanup has run
+			if code := runDaemon(config, sweeper); code != 0 {
+				os.Exit(code)
+			}
+			return
+		case "report":
+			runReportCommand(config, sweeper, args[1:])
+			return
+		case "export-wallet", "import-wallet":
+			runWalletCommand(sweeper, args[0], args[1:])
+			return
+		case "watch":
+			runWatch(config, sweeper, args[1:])
+			return
+		case "doctor":
+			runDoctor(config, sweeper)
+			return
+		case "support-bundle":
+			runSupportBundle(config, sweeper, logs, args[1:])
+			return
+		case "broadcast-queue":
+			runBroadcastQueue(config, sweeper, args[1:])
+			return
+		case "revalidate":
+			runRevalidate(config, sweeper)
+			return
+		case "change-key-challenge":
+			msg, err := sweeper.ChangeKeyChallenge()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(hex.EncodeToString(msg[:]))
+			return
+		case "metrics":
+			if err := sweeper.WritePrometheusMetrics(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "metrics: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command '%s' - run with -help for usage\n", args[0])
+			os.Exit(2)
+		}
+	} else {
+		// Create spending transaction with single output
+		outputs := []TxOutput{
+			{Address: destAddr, ValueSats: 150_000}, // Send 150,000 sats to destination
+		}
+
+		fmt.Println("\nCreating spending transaction...")
+		plan, err = sweeper.Spend(outputs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Transaction creation failed: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Check that you have sufficient UTXOs and valid addresses\n")
+			os.Exit(1)
+		}
 	}
 
+	printPlan(config, plan, sweeper)
+	sweeper.WaitWebhooks()
+}
+
+// printPlan encodes the plan's PSBT and prints it in the configured output format.
+func printPlan(config *Config, plan *TransactionPlan, sweeper *Sweeper) {
 	// Encode PSBT for external signing
 	psbtB64, err := plan.PSBT.B64Encode()
 	if err != nil {
@@ -152,9 +286,544 @@ func main() {
 
 	// Display results based on output format
 	if config.OutputFormat == "json" {
-		outputJSON(plan, psbtB64, sweeper)
+		outputJSON(config, plan, psbtB64, sweeper)
+	} else {
+		outputHuman(config, plan, psbtB64, sweeper)
+	}
+}
+
+// daemonTick is how often the daemon checks template schedules.
+const daemonTick = 30 * time.Second
+
+// runDaemon runs scheduled templates until the process is stopped and returns
+// the exit code, so its deferred cleanup runs before the caller exits.
+func runDaemon(config *Config, sweeper *Sweeper) int {
+	sched, err := NewScheduler(sweeper, config.Templates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Scheduler error: %v\n", err)
+		return 1
+	}
+	if len(sched.Templates()) == 0 {
+		fmt.Fprintf(os.Stderr, "No templates with a schedule - add \"schedule\" to a template in the config\n")
+		return 1
+	}
+	if sched.NeedsHeight() {
+		fmt.Fprintf(os.Stderr, "Warning: block-height schedules need a chain height source and will not fire from the CLI daemon\n")
+	}
+	if config.KVPath == "" {
+		fmt.Fprintf(os.Stderr, "Warning: kv_path is not set; last-run markers will not survive a restart\n")
+	}
+	if every, _ := config.Revalidation(); every > 0 {
+		backend, _ := config.Backend()
+		if err := sched.SetRevalidation(backend, every, config.RevalidateBatch); err != nil {
+			fmt.Fprintf(os.Stderr, "Revalidation error: %v\n", err)
+			return 1
+		}
+		sched.OnRevalidate = func(res *RevalidationResult, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] revalidation failed: %v\n", time.Now().UTC().Format(time.RFC3339), err)
+				return
+			}
+			fmt.Printf("[%s] revalidated %d UTXO(s) at %d address(es): %d evicted, %d updated\n", time.Now().UTC().Format(time.RFC3339), res.Checked, len(res.Addresses), len(res.Evicted), len(res.Updated))
+		}
+	}
+	sched.OnResult = func(name string, plan *TransactionPlan, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] template '%s' failed: %v\n", time.Now().UTC().Format(time.RFC3339), name, err)
+			return
+		}
+		fmt.Printf("[%s] template '%s' produced plan %s\n", time.Now().UTC().Format(time.RFC3339), name, plan.ID)
+		printPlan(config, plan, sweeper)
+	}
+
+	deadline, _ := config.ShutdownDeadline()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	fmt.Printf("\nDaemon started with %d scheduled template(s)\n", len(sched.Templates()))
+	ticker := time.NewTicker(daemonTick)
+	defer ticker.Stop()
+	for running := true; running; {
+		sched.Tick(time.Now(), 0)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	// Stop scheduling, drain in-flight runs, then flush and close storage
+	fmt.Printf("Shutting down (draining for up to %s)...\n", deadline)
+	drainCtx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	code := 0
+	if err := sched.Shutdown(drainCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Shutdown: %v\n", err)
+		code = 1
+	}
+	if err := sweeper.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to close storage: %v\n", err)
+		code = 1
+	}
+	if code == 0 {
+		fmt.Println("Shutdown complete")
+	}
+	return code
+}
+
+// runOrchestrate plans the consolidation of every account in the config's
+// orchestration section and prints the broadcast schedule with each plan's
+// PSBT. It returns the exit code once the accounts' stores are closed.
+func runOrchestrate(config *Config) (code int) {
+	if config.Orchestration == nil {
+		fmt.Fprintf(os.Stderr, "No \"orchestration\" section in the config - see -help\n")
+		return 2
+	}
+	orch, err := config.Orchestrator()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer func() {
+		for _, a := range orch.Accounts {
+			if err := a.Sweeper.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to close storage of account %s: %v\n", a.Name, err)
+				code = 1
+			}
+		}
+	}()
+	for i, a := range orch.Accounts {
+		acct := config.Orchestration.Accounts[i]
+		if acct.KVPath == "" {
+			fmt.Fprintf(os.Stderr, "Warning: account %s has no kv_path; its plan is forgotten when the process exits\n", a.Name)
+		}
+		var utxos []UTXO
+		if err := json.Unmarshal(mustReadFile(acct.UTXOFile), &utxos); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse %s: %v\n", acct.UTXOFile, err)
+			return 1
+		}
+		for j, u := range utxos {
+			if err := a.Sweeper.Index(u); err != nil {
+				fmt.Fprintf(os.Stderr, "Account %s: failed to index UTXO %d (%s:%d): %v\n", a.Name, j, u.TxID, u.Vout, err)
+			}
+		}
+	}
+
+	res, err := orch.Plan(time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Orchestration failed: %v\n", err)
+		return 1
+	}
+	psbts := make([]string, len(res.Plans))
+	for i, op := range res.Plans {
+		if psbts[i], err = op.Plan.PSBT.B64Encode(); err != nil {
+			fmt.Fprintf(os.Stderr, "PSBT encoding failed: %v\n", err)
+			return 1
+		}
+	}
+	if config.OutputFormat == "json" {
+		plans := make([]map[string]interface{}, 0, len(res.Plans))
+		for i, op := range res.Plans {
+			plans = append(plans, map[string]interface{}{
+				"account":         op.Account,
+				"plan_id":         op.Plan.ID,
+				"inputs":          op.Plan.Inputs,
+				"outputs":         op.Plan.Outputs,
+				"fee_sats":        op.Plan.FeeSats,
+				"weight":          op.Weight,
+				"broadcast_after": op.BroadcastAfter,
+				"psbt_b64":        psbts[i],
+			})
+		}
+		printJSON(config, map[string]interface{}{"orchestration": map[string]interface{}{
+			"plans":    plans,
+			"skipped":  res.Skipped,
+			"fee_sats": res.FeeSats,
+			"weight":   res.Weight,
+		}}, true)
+		return 0
+	}
+	fmt.Printf("\nOrchestrated %d consolidation(s) to %s: %d sats in fees, %d WU\n", len(res.Plans), orch.Destination, res.FeeSats, res.Weight)
+	for i, op := range res.Plans {
+		fmt.Printf("  %s %-12s %d input(s), %d sats, fee %d sats, broadcast after %s\n", op.Plan.ID, op.Account, len(op.Plan.Inputs), sumOutputs(op.Plan.Outputs), op.Plan.FeeSats, op.BroadcastAfter.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("    PSBT (b64): %s\n", psbts[i])
+	}
+	for _, sk := range res.Skipped {
+		fmt.Printf("  skipped %s: %s\n", sk.Account, sk.Reason)
+	}
+	return 0
+}
+
+// runWalletCommand exports or imports the encrypted wallet archive
+// (export-wallet|import-wallet <path>), reading the passphrase from WALLET_PASSPHRASE.
+func runWalletCommand(sweeper *Sweeper, cmd string, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: utxo-sweeper [OPTIONS] %s <path>\n", cmd)
+		os.Exit(2)
+	}
+	pass := os.Getenv("WALLET_PASSPHRASE")
+	if pass == "" {
+		fmt.Fprintf(os.Stderr, "WALLET_PASSPHRASE must be set to encrypt or decrypt the wallet archive\n")
+		os.Exit(1)
+	}
+	if cmd == "export-wallet" {
+		if err := sweeper.ExportWallet(args[0], pass); err != nil {
+			fmt.Fprintf(os.Stderr, "Wallet export failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nWallet exported to %s\n", args[0])
+		return
+	}
+	if err := sweeper.ImportWallet(args[0], pass); err != nil {
+		fmt.Fprintf(os.Stderr, "Wallet import failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nWallet imported from %s (%d plans, %d UTXOs indexed)\n", args[0], len(sweeper.PendingPlans()), len(sweeper.GetIndexedUTXOs()))
+}
+
+// runWatch redraws a table of tracked plans until interrupted (-once prints it once).
+func runWatch(config *Config, sweeper *Sweeper, args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 10*time.Second, "Refresh interval")
+	once := fs.Bool("once", false, "Print the table once and exit")
+	fs.Parse(args)
+	if *interval <= 0 {
+		fmt.Fprintf(os.Stderr, "-interval must be positive\n")
+		os.Exit(2)
+	}
+	if config.KVPath == "" {
+		fmt.Fprintf(os.Stderr, "Warning: kv_path is not set; only plans created in this process are shown\n")
+	}
+
+	// The backend reports confirmations; the config already made it the
+	// chain tip and mempool source
+	var src ConfirmationSource
+	if backend, _ := config.Backend(); backend != nil {
+		src = backend
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: backend_url is not set; confirmations and dropped transactions are not detected\n")
+	}
+	tracker := NewConfirmationTracker(sweeper, src)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		// Pick up plans other processes created or advanced, and the fee
+		// rate bumps are judged against
+		var err error
+		if config.KVPath != "" {
+			err = sweeper.LoadPlans()
+		}
+		sweeper.refreshFeeRate()
+		var statuses []PlanStatus
+		if err == nil {
+			statuses, err = tracker.Poll(time.Now())
+		}
+		if err != nil {
+			if *once {
+				fmt.Fprintf(os.Stderr, "Poll failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Poll failed, retrying in %s: %v\n", *interval, err)
+		} else if config.OutputFormat == "json" {
+			printJSON(config, map[string]interface{}{"time": time.Now().UTC(), "plans": statuses}, false)
+		} else {
+			if !*once {
+				fmt.Print("\033[H\033[2J") // Clear the terminal
+			}
+			fmt.Printf("Pending plans at %s (refresh %s, Ctrl-C to quit)\n\n", time.Now().Format("15:04:05"), *interval)
+			if len(statuses) == 0 {
+				fmt.Println("No tracked plans")
+			} else {
+				_ = WritePlanStatusTable(os.Stdout, statuses)
+			}
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runRevalidate re-checks every indexed UTXO against the configured backend
+// once, evicting the ones it no longer reports as unspent.
+func runRevalidate(config *Config, sweeper *Sweeper) {
+	backend, _ := config.Backend()
+	if backend == nil {
+		fmt.Fprintf(os.Stderr, "revalidate needs backend_url in the config\n")
+		os.Exit(2)
+	}
+	res, err := sweeper.RevalidateIndex(backend, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Revalidation failed: %v\n", err)
+		os.Exit(1)
+	}
+	if config.OutputFormat == "json" {
+		printJSON(config, map[string]interface{}{"revalidation": res}, true)
+		return
+	}
+	fmt.Printf("\nRevalidated %d UTXO(s) at %d address(es)\n", res.Checked, len(res.Addresses))
+	for _, u := range res.Evicted {
+		fmt.Printf("  evicted %s:%d (%d sats) - no longer unspent\n", u.TxID, u.Vout, u.ValueSats)
+	}
+	for _, u := range res.Updated {
+		fmt.Printf("  updated %s:%d - %d confirmation(s)\n", u.TxID, u.Vout, u.Confirmations)
+	}
+}
+
+// runBroadcastQueue lists failed broadcasts awaiting retry or dead-lettered,
+// after applying any -requeue or -drop.
+func runBroadcastQueue(config *Config, sweeper *Sweeper, args []string) {
+	fs := flag.NewFlagSet("broadcast-queue", flag.ExitOnError)
+	requeue := fs.String("requeue", "", "Plan ID of a dead-lettered broadcast to retry")
+	drop := fs.String("drop", "", "Plan ID to remove from the queue")
+	fs.Parse(args)
+	if config.KVPath == "" {
+		fmt.Fprintf(os.Stderr, "Warning: kv_path is not set; the queue is empty in a new process\n")
+	}
+	if *requeue != "" {
+		if err := sweeper.RequeueBroadcast(*requeue); err != nil {
+			fmt.Fprintf(os.Stderr, "Requeue failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *drop != "" {
+		if err := sweeper.DropBroadcast(*drop); err != nil {
+			fmt.Fprintf(os.Stderr, "Drop failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	q := sweeper.BroadcastQueue()
+	if config.OutputFormat == "json" {
+		printJSON(config, map[string]interface{}{"broadcast_queue": q}, true)
+		return
+	}
+	fmt.Println("\nBroadcast queue:")
+	if len(q) == 0 {
+		fmt.Println("  (empty)")
+		return
+	}
+	for _, e := range q {
+		next := "-"
+		if e.State == QueueWaiting {
+			next = e.NextAttempt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %-16s %-6s attempts=%-2d next=%-19s %s: %s\n", e.PlanID, e.State, e.Attempts, next, e.Failure, e.LastError)
+	}
+}
+
+// runDoctor checks the deployment and exits non-zero if any check fails.
+func runDoctor(config *Config, sweeper *Sweeper) {
+	rep := sweeper.Doctor(time.Now())
+	rep.Findings = append([]DoctorFinding{{Check: "config", Status: DoctorOK, Message: "configuration is valid"}}, rep.Findings...)
+	if config.OutputFormat == "json" {
+		printJSON(config, map[string]interface{}{"doctor": rep}, true)
 	} else {
-		outputHuman(plan, psbtB64, sweeper)
+		printDoctorReport(rep)
+	}
+	if !rep.Healthy() {
+		os.Exit(1)
+	}
+}
+
+// printDoctorReport prints one line per check with the fix for any problem.
+func printDoctorReport(rep *DoctorReport) {
+	fmt.Println("\nDoctor:")
+	for _, f := range rep.Findings {
+		fmt.Printf("  [%-7s] %-10s %s\n", strings.ToUpper(string(f.Status)), f.Check, f.Message)
+		if f.Fix != "" && f.Status != DoctorOK {
+			fmt.Printf("  %9s %-10s fix: %s\n", "", "", f.Fix)
+		}
+	}
+	if rep.Healthy() {
+		fmt.Println("\nNo failing checks")
+	} else {
+		fmt.Println("\nSome checks failed - apply the fixes above and run doctor again")
+	}
+}
+
+// runSupportBundle writes a redacted diagnostics archive for bug reports
+// (support-bundle [-out path] [-hash-addresses] [-log file]).
+func runSupportBundle(config *Config, sweeper *Sweeper, logs *LogBuffer, args []string) {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	out := fs.String("out", "", "Archive path (default support-bundle-<time>.tar.gz)")
+	hashAddrs := fs.Bool("hash-addresses", false, "Replace addresses with salted hashes")
+	logFile := fs.String("log", "", "Log file whose last 1000 lines are included, e.g. the daemon's")
+	fs.Parse(args)
+	now := time.Now()
+	if *out == "" {
+		*out = "support-bundle-" + now.UTC().Format("20060102-150405") + ".tar.gz"
+	}
+	lines := logs.Lines()
+	if *logFile != "" {
+		b, err := os.ReadFile(*logFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can't read %s: %v\n", *logFile, err)
+			os.Exit(1)
+		}
+		tail := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		if len(tail) > 1000 {
+			tail = tail[len(tail)-1000:]
+		}
+		lines = append(tail, lines...)
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Support bundle failed: %v\n", err)
+		os.Exit(1)
+	}
+	err = sweeper.WriteSupportBundle(f, SupportBundleOptions{Config: config, Logs: lines, HashAddresses: *hashAddrs, Now: now})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		fmt.Fprintf(os.Stderr, "Support bundle failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nSupport bundle written to %s - review it before sharing\n", *out)
+}
+
+// runGenVectors writes the deterministic test vectors (gen-vectors [-out dir]).
+func runGenVectors(args []string) {
+	fs := flag.NewFlagSet("gen-vectors", flag.ExitOnError)
+	out := fs.String("out", "testdata/vectors", "Directory to write "+TestVectorsFile+" to")
+	fs.Parse(args)
+	path, err := WriteTestVectors(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gen-vectors: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Test vectors written to %s\n", path)
+}
+
+// runTemplateCommand plans a sweep from a named template (run-template <name>).
+func runTemplateCommand(sweeper *Sweeper, args []string) *TransactionPlan {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: utxo-sweeper [OPTIONS] run-template <name>\n")
+		if names := sweeper.ListTemplates(); len(names) > 0 {
+			fmt.Fprintf(os.Stderr, "Available templates: %v\n", names)
+		}
+		os.Exit(2)
+	}
+	fmt.Printf("\nRunning template '%s'...\n", args[0])
+	plan, err := sweeper.RunTemplateByName(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Template run failed: %v\n", err)
+		os.Exit(1)
+	}
+	return plan
+}
+
+// runSweepOffline plans a sweep of every coin in a file of raw previous
+// transactions to destAddr without any backend (sweep-offline <raw-utxos.json>).
+func runSweepOffline(sweeper *Sweeper, destAddr string, args []string) *TransactionPlan {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: utxo-sweeper [OPTIONS] sweep-offline <raw-utxos.json>\n")
+		os.Exit(2)
+	}
+	var raws []RawUTXO
+	if err := json.Unmarshal(mustReadFile(args[0]), &raws); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse %s: %v\n", args[0], err)
+		fmt.Fprintf(os.Stderr, "Expected format: [{\"raw_tx\":\"0200...\",\"vout\":0,\"confirmations\":6}]\n")
+		os.Exit(1)
+	}
+	sweeper.ClearIndex() // Only the verified coins
+	if err := sweeper.SetOfflineMode(true); err != nil {
+		fmt.Fprintf(os.Stderr, "Offline mode: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nVerifying %d raw UTXOs offline...\n", len(raws))
+	for i, r := range raws {
+		u, err := sweeper.IndexRaw(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Raw UTXO %d: %v\n", i, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Verified %s:%d (%d sats to %s)\n", u.TxID, u.Vout, u.ValueSats, u.Address)
+	}
+	plan, err := sweeper.ConsolidateAll(destAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Offline sweep failed: %v\n", err)
+		os.Exit(1)
+	}
+	return plan
+}
+
+// runReportCommand prints dry-run reports (report consolidation [-rates 1,5,10] | report selection).
+func runReportCommand(config *Config, sweeper *Sweeper, args []string) {
+	if len(args) > 0 && args[0] == "selection" {
+		runSelectionReport(config, sweeper)
+		return
+	}
+	if len(args) == 0 || args[0] != "consolidation" {
+		fmt.Fprintf(os.Stderr, "Usage: utxo-sweeper [OPTIONS] report consolidation [-rates 1,2,5,10] | report selection\n")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("report consolidation", flag.ExitOnError)
+	ratesFlag := fs.String("rates", "1,2,5,10,20,50", "Comma-separated fee rates in sat/vB")
+	fs.Parse(args[1:])
+
+	var rates []int64
+	for _, f := range strings.Split(*ratesFlag, ",") {
+		r, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid fee rate '%s' in -rates\n", f)
+			os.Exit(2)
+		}
+		rates = append(rates, r)
+	}
+	rep, err := sweeper.ConsolidationCostReport(rates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Consolidation report failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if config.OutputFormat == "json" {
+		printJSON(config, map[string]interface{}{"consolidation_report": rep}, true)
+		return
+	}
+	fmt.Printf("\nConsolidation cost report: %d UTXOs, %d sats, ~%d vB\n", rep.UTXOCount, rep.TotalSats, rep.VBytes)
+	if rep.Note != "" {
+		fmt.Println("Note:", rep.Note)
+	}
+	fmt.Printf("%10s %12s %8s %14s %18s\n", "sat/vB", "fee (sats)", "fee %", "net (sats)", "break-even sat/vB")
+	for _, sc := range rep.Scenarios {
+		note := ""
+		if !sc.Economical {
+			note = "  (uneconomical)"
+		} else if sc.ConsolidateNow {
+			note = fmt.Sprintf("  (consolidate now: below the %.2f sat/vB long-term rate)", rep.LongTermFeeRate)
+		}
+		fmt.Printf("%10d %12d %7.2f%% %14d %18.2f%s\n", sc.FeeRate, sc.FeeSats, sc.FeePercent, sc.NetSats, sc.BreakEvenFeeRate, note)
+	}
+}
+
+// runSelectionReport prints which UTXOs are selectable and why the rest are excluded.
+func runSelectionReport(config *Config, sweeper *Sweeper) {
+	rep, err := sweeper.ExplainSelection()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Selection report failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if config.OutputFormat == "json" {
+		printJSON(config, map[string]interface{}{"selection_report": rep}, true)
+		return
+	}
+	fmt.Printf("\nSelectable: %d UTXOs, %d sats\n", len(rep.Candidates), rep.CandidateSats)
+	for _, u := range rep.Candidates {
+		fmt.Printf("  %s:%d  %d sats\n", u.TxID, u.Vout, u.ValueSats)
+	}
+	fmt.Printf("Rejected: %d UTXOs\n", len(rep.Rejected))
+	for _, r := range rep.Rejected {
+		fmt.Printf("  %s:%d  %d sats  - %s\n", r.UTXO.TxID, r.UTXO.Vout, r.UTXO.ValueSats, r.Reason)
 	}
 }
 
@@ -174,7 +843,7 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, `UTXO Sweeper - Dependency-free Bitcoin UTXO management library
 
 USAGE:
-    utxo-sweeper [OPTIONS]
+    utxo-sweeper [OPTIONS] [COMMAND]
 
 DESCRIPTION:
     A command-line demonstration of the UTXO Sweeper library that loads UTXOs
@@ -199,16 +868,112 @@ OPTIONS:
         32-byte x-only taproot output key in hex for P2TR change
         Overrides TAPROOT_XONLY_HEX env var
         
+    -taproot_internal string
+        33-byte compressed taproot internal key in hex; the BIP-86 tweak is
+        applied to get the P2TR change output key
+        Overrides TAPROOT_INTERNAL_HEX env var
+        
     -help
         Show this help information and usage examples
         
     -version
         Show version information
+        
+    -compat v1
+        Print JSON in the original v1 shape (Go field names such as TxID and
+        ValueSats, no "api_version") for scripts written against it
+
+COMMANDS:
+    (none)
+        Plan a 150,000 sat spend to the destination address
+        
+    run-template <name>
+        Plan a sweep from a named template defined under "templates" in the config
+        
+    sweep-offline <raw-utxos.json>
+        Sweep coins given as full previous transactions ([{"raw_tx", "vout",
+        "confirmations"}]) to the destination with no backend: values and
+        addresses are read from the transactions and utxos.json is ignored,
+        for air-gapped recovery. The PSBT carries the previous transactions
+        
+    report consolidation [-rates 1,2,5,10]
+        Estimate the fee to consolidate all spendable UTXOs at each fee rate and
+        the future fee rate at which consolidating now breaks even
+        
+    report selection
+        List the UTXOs a spend would consider and the reason each other
+        indexed UTXO is excluded (dust, confirmations, policy, filter hooks)
+        
+    daemon
+        Run templates on their "schedule" (cron, "every 6h", "every 144 blocks");
+        set "kv_path" so last-run markers survive restarts. On SIGTERM/SIGINT
+        no new runs start, in-flight runs drain for up to "shutdown_timeout"
+        (default 25s) and storage is closed before exiting. With
+        "revalidate_interval" indexed UTXOs are re-checked against
+        "backend_url" that often, "revalidate_batch" addresses per pass
+        
+    orchestrate
+        Consolidate every account under "orchestration" into its shared
+        "destination": each account is planned with the top-level settings
+        and its own "pubkey_hex" or "xpub", "utxo_file" and "kv_path". Plans
+        that move the most value per fee sat are kept within
+        "fee_budget_sats" and "max_weight", the others are skipped; the
+        schedule lists each PSBT to sign and its broadcast slot, "spacing"
+        (default 10m) apart
+        
+    revalidate
+        Re-check every indexed UTXO against "backend_url" once, evicting
+        those it no longer reports as unspent and refreshing confirmations
+        
+    change-key-challenge
+        Print the message to sign with the taproot change key (BIP-340); put
+        the signature in "change_key_proof" to satisfy
+        "require_verified_change_key"
+        
+    watch [-interval 10s] [-once]
+        Show a refreshing table of tracked plans (set "kv_path") with their
+        state, confirmations, fee rate against the current rate and a
+        suggested action (sign, broadcast, bump, rebroadcast). Confirmations
+        and dropped transactions come from "backend_url"; failed polls are
+        retried at the next refresh
+        
+    doctor
+        Check the configuration, KV read/write, backend connectivity and sync
+        height, key derivation, clock skew and undelivered webhook events,
+        printing a fix for each problem; exits 1 if any check fails
+        
+    support-bundle [-out path] [-hash-addresses] [-log file]
+        Write a .tar.gz with version info, the config with secrets and key
+        material redacted, stats, plan summaries and recent logs for bug
+        reports; -hash-addresses replaces addresses with salted hashes
+        
+    broadcast-queue [-requeue <plan-id>] [-drop <plan-id>]
+        List failed broadcasts (set "kv_path") waiting for retry with
+        exponential backoff, and those dead-lettered after a permanent
+        rejection or too many attempts; -requeue retries a dead-lettered plan,
+        -drop removes one from the queue
+        
+    metrics
+        Print stats and cumulative fee savings from batching (set "kv_path")
+        in the Prometheus text format
+        
+    gen-vectors [-out testdata/vectors]
+        Write deterministic test vectors (addresses, scripts, transactions and
+        PSBTs for every script type and network) to vectors.json; needs no
+        config. The golden tests check the committed copy
+        
+    export-wallet <path>
+    import-wallet <path>
+        Write or restore an encrypted archive of UTXOs, plans, templates and
+        address usage (passphrase from WALLET_PASSPHRASE); set "kv_path" on
+        the target host so the imported state is kept
 
 ENVIRONMENT VARIABLES:
     DEST_ADDR    Bitcoin address to send funds to (overridden by -dest flag)
     PUBKEY_HEX   33-byte compressed public key in hex (overridden by -pubkey)
     TAPROOT_XONLY_HEX 32-byte x-only taproot output key in hex (overridden by -taproot_xonly)
+    TAPROOT_INTERNAL_HEX 33-byte compressed taproot internal key in hex (overridden by -taproot_internal)
+    WALLET_PASSPHRASE Passphrase for export-wallet/import-wallet archives
 
 EXAMPLES:
     # Basic usage with default configuration
@@ -229,6 +994,9 @@ EXAMPLES:
     # Provide Taproot x-only change key
     utxo-sweeper -taproot_xonly 79be667ef9dcbbac55a06295ce870b07...32bytes
     
+    # Run a recurring sweep defined in the config
+    utxo-sweeper -config config.json run-template nightly-cold-sweep
+    
     # JSON output for scripting
     utxo-sweeper -config config.json | jq '.transaction_plan.fee_sats'
     
@@ -274,7 +1042,7 @@ For more information, visit: https://github.com/Tadasu85/utxo-sweeper-go
 
 // printVersion displays version information.
 func printVersion() {
-	fmt.Printf(`UTXO Sweeper v1.0.0
+	fmt.Printf(`UTXO Sweeper v%s
 A dependency-free Go library for Bitcoin UTXO management
 
 Features:
@@ -286,36 +1054,94 @@ Features:
 
 Repository: https://github.com/Tadasu85/utxo-sweeper-go
 License: MIT
-`)
+`, Version)
 }
 
 // outputHuman displays results in human-readable format.
-func outputHuman(plan *TransactionPlan, psbtB64 string, sweeper *Sweeper) {
+func outputHuman(config *Config, plan *TransactionPlan, psbtB64 string, sweeper *Sweeper) {
 	fmt.Println("\nTransaction Plan:")
 	fmt.Println("Inputs:", plan.Inputs)
 	fmt.Println("Outputs:", plan.Outputs)
 	fmt.Println("Fee (sats):", plan.FeeSats)
+	if plan.AncestorFeeRate > 0 {
+		fmt.Printf("Package fee rate: %.2f sat/vB (unconfirmed ancestors %.2f sat/vB)\n", plan.PackageFeeRate, plan.AncestorFeeRate)
+	}
+	if dd := plan.DescriptorDest; dd != nil {
+		fmt.Printf("Destination: %s index %d (%s)\n", dd.Descriptor, dd.Index, dd.Address)
+	}
+	order := string(plan.Settings.Selection)
+	if plan.Settings.ConfirmedFirst {
+		order += ", confirmed first"
+	}
+	fmt.Println("Input order:", order)
+	if sum, err := sweeper.SummarizePlan(plan, config.prices(), time.Now()); err == nil {
+		cur := sum.Currency
+		fmt.Printf("Summary (%s %s/BTC):\n", formatFiat(sum.PricePerBTC, cur), cur)
+		fmt.Printf("  Total in:  %d sats (%s %s)\n", sum.TotalInSats, formatFiat(sum.TotalInFiat, cur), cur)
+		fmt.Printf("  Total out: %d sats (%s %s), %d sats sent\n", sum.TotalOutSats, formatFiat(sum.TotalOutFiat, cur), cur, sum.SentSats)
+		fmt.Printf("  Fee:       %d sats (%s %s per tx), %.2f sat/vB, %.2f%% of amount sent\n", sum.FeeSats, formatFiat(sum.FeeFiat, cur), cur, sum.FeeRateSatsVB, sum.FeePercent)
+	} else {
+		fmt.Println("Summary unavailable:", err)
+	}
+	fmt.Println("Linked addresses:", plan.LinkedAddresses())
+	if v := plan.Validity(); v != nil {
+		fmt.Println("Valid from:", v)
+	}
+	for _, w := range plan.Warnings {
+		fmt.Printf("Warning: %s\n", w.Message)
+	}
 	fmt.Println("PSBT (b64):", psbtB64)
+	fmt.Println("Electrum QR (base43):", EncodeBase43(plan.PSBT.Serialize()))
 	fmt.Println("\nChain Depth:", sweeper.PendingChainDepth())
+	fmt.Println("\nAddress Stats:")
+	for _, a := range sweeper.AddressStats() {
+		mark := ""
+		if a.Reused(sweeper.reuseThreshold) {
+			mark = "  [REUSED]"
+		}
+		fmt.Printf("  %s received=%d spent=%d sats=%d%s\n", a.Address, a.Received, a.Spent, a.ReceivedSats, mark)
+	}
 }
 
 // outputJSON displays results in JSON format for programmatic consumption.
-func outputJSON(plan *TransactionPlan, psbtB64 string, sweeper *Sweeper) {
+func outputJSON(config *Config, plan *TransactionPlan, psbtB64 string, sweeper *Sweeper) {
+	txPlan := map[string]interface{}{
+		"inputs":            plan.Inputs,
+		"outputs":           plan.Outputs,
+		"fee_sats":          plan.FeeSats,
+		"package_fee_rate":  plan.PackageFeeRate,
+		"ancestor_fee_rate": plan.AncestorFeeRate,
+		"validity":          plan.Validity(),
+		"linked_addresses":  plan.LinkedAddresses(),
+		"warnings":          plan.Warnings,
+		"settings":          plan.Settings,
+		"psbt_b64":          psbtB64,
+		"psbt_base43":       EncodeBase43(plan.PSBT.Serialize()),
+	}
+	if plan.DescriptorDest != nil {
+		txPlan["descriptor_dest"] = plan.DescriptorDest
+	}
+	txPlan["fee_report"] = plan.FeeReport()
+	if summary, err := sweeper.SummarizePlan(plan, config.prices(), time.Now()); err == nil {
+		txPlan["summary"] = summary
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: no fiat summary: %v\n", err)
+	}
 	result := map[string]interface{}{
-		"transaction_plan": map[string]interface{}{
-			"inputs":   plan.Inputs,
-			"outputs":  plan.Outputs,
-			"fee_sats": plan.FeeSats,
-			"psbt_b64": psbtB64,
-		},
-		"chain_depth": sweeper.PendingChainDepth(),
+		"transaction_plan": txPlan,
+		"chain_depth":      sweeper.PendingChainDepth(),
+		"address_stats":    sweeper.AddressStats(),
 	}
 
-	jsonData, err := json.MarshalIndent(result, "", "  ")
+	printJSON(config, result, true)
+}
+
+// printJSON prints a JSON document in the configured output compatibility mode.
+func printJSON(config *Config, doc map[string]interface{}, indent bool) {
+	jsonData, err := MarshalOutput(doc, config.OutputCompat, indent)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to marshal JSON output: %v\n", err)
 		os.Exit(1)
 	}
-
 	fmt.Println(string(jsonData))
 }
@@ -0,0 +1,115 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the coin maturity policy and the received cool-down.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaturityTier holds confirmed coins worth at least MinValueSats back until
+// they have MinConfirmations confirmations and were received at least MinAge
+// ago, so a deposit the sender reverses with RBF or a shallow reorg is not
+// swept onward first.
+type MaturityTier struct {
+	MinValueSats     int64         // Smallest coin value the tier covers
+	MinConfirmations int           // Confirmations required (0 = no block requirement)
+	MinAge           time.Duration // Time since the coin was received (0 = no cool-down)
+}
+
+// SetMaturityPolicy holds back freshly received confirmed coins. Each coin
+// follows the tier with the largest MinValueSats not above its value, so
+// larger deposits can be made to wait longer; coins below every tier are not
+// held back. A coin's receive time is when the sweeper first indexed it;
+// coins indexed before it recorded receive times only need their
+// confirmations. Unconfirmed coins stay under the unconfirmed policy. Passing
+// nil removes the policy.
+func (s *Sweeper) SetMaturityPolicy(tiers []MaturityTier) error {
+	sorted, err := sortMaturityTiers(tiers)
+	if err != nil {
+		return err
+	}
+	s.maturityTiers = sorted
+	return nil
+}
+
+// Check tiers and order them by MinValueSats
+func sortMaturityTiers(tiers []MaturityTier) ([]MaturityTier, error) {
+	sorted := append([]MaturityTier(nil), tiers...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].MinValueSats < sorted[j].MinValueSats })
+	for i, t := range sorted {
+		if t.MinValueSats < 0 || t.MinConfirmations < 0 || t.MinAge < 0 {
+			return nil, fmt.Errorf("maturity tier for %d sats must be non-negative (got %d confirmations, %s)", t.MinValueSats, t.MinConfirmations, t.MinAge)
+		}
+		if i > 0 && sorted[i-1].MinValueSats == t.MinValueSats {
+			return nil, fmt.Errorf("two maturity tiers start at %d sats - merge them", t.MinValueSats)
+		}
+	}
+	return sorted, nil
+}
+
+// MaturityTierConfig is a MaturityTier in the config file.
+type MaturityTierConfig struct {
+	MinValueSats     int64  `json:"min_value_sats"`
+	MinConfirmations int    `json:"min_confirmations,omitempty"`
+	MinAge           string `json:"min_age,omitempty"` // Go duration, e.g. "30m"
+}
+
+// Tier covering a coin of value sats, or nil
+func (s *Sweeper) maturityTier(value int64) *MaturityTier {
+	for i := len(s.maturityTiers) - 1; i >= 0; i-- {
+		if s.maturityTiers[i].MinValueSats <= value {
+			return &s.maturityTiers[i]
+		}
+	}
+	return nil
+}
+
+// Why a confirmed coin is still held back by the maturity policy ("" if it
+// is mature)
+func (s *Sweeper) immature(u UTXO, now time.Time) string {
+	if !u.Confirmed {
+		return ""
+	}
+	t := s.maturityTier(u.ValueSats)
+	if t == nil {
+		return ""
+	}
+	if c := confirmations(u); c < t.MinConfirmations {
+		return fmt.Sprintf("immature: %d confirmations, %d required for coins of %d+ sats", c, t.MinConfirmations, t.MinValueSats)
+	}
+	if t.MinAge > 0 {
+		if at, ok := s.receivedAt(u); ok && now.Sub(at) < t.MinAge {
+			return fmt.Sprintf("immature: received %s ago, %s cool-down for coins of %d+ sats", now.Sub(at).Round(time.Second), t.MinAge, t.MinValueSats)
+		}
+	}
+	return ""
+}
+
+// KV key of the time a coin was first indexed
+func receivedKey(u UTXO) string {
+	return "received:" + outpointKey(u)
+}
+
+// Record that a coin was received now
+func (s *Sweeper) recordReceivedAt(u UTXO) error {
+	b, err := time.Now().UTC().MarshalText()
+	if err != nil {
+		return err
+	}
+	return s.kv.Put([]byte(receivedKey(u)), b)
+}
+
+// When a coin was first indexed, if recorded
+func (s *Sweeper) receivedAt(u UTXO) (time.Time, bool) {
+	b, err := s.kv.Get([]byte(receivedKey(u)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var at time.Time
+	if err := at.UnmarshalText(b); err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
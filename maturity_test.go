@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaturityPolicyByTier(t *testing.T) {
+	s := newTestSweeper(t, WithMaturityPolicy([]MaturityTier{
+		{MinValueSats: 1_000_000, MinConfirmations: 6, MinAge: time.Hour},
+		{MinValueSats: 0, MinConfirmations: 2},
+	}))
+	small := UTXO{TxID: stringsRepeat("11", 32), Vout: 0, ValueSats: 50_000, Address: testAddr("in"), Confirmed: true, Confirmations: 1}
+	ripe := UTXO{TxID: stringsRepeat("22", 32), Vout: 0, ValueSats: 60_000, Address: testAddr("in"), Confirmed: true, Confirmations: 3}
+	large := UTXO{TxID: stringsRepeat("33", 32), Vout: 0, ValueSats: 2_000_000, Address: testAddr("in"), Confirmed: true, Confirmations: 10}
+	for _, u := range []UTXO{small, ripe, large} {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+
+	rep, err := s.ExplainSelection()
+	if err != nil {
+		t.Fatalf("ExplainSelection: %v", err)
+	}
+	if len(rep.Candidates) != 1 || rep.Candidates[0].TxID != ripe.TxID {
+		t.Fatalf("expected only the 60k coin to be mature, got %+v", rep.Candidates)
+	}
+	reasons := map[string]string{}
+	for _, r := range rep.Rejected {
+		reasons[r.UTXO.TxID] = r.Reason
+	}
+	if !strings.Contains(reasons[small.TxID], "1 confirmations, 2 required") {
+		t.Fatalf("small coin reason: %q", reasons[small.TxID])
+	}
+	if !strings.Contains(reasons[large.TxID], "1h0m0s cool-down for coins of 1000000+ sats") {
+		t.Fatalf("large coin reason: %q", reasons[large.TxID])
+	}
+
+	// Once the cool-down has passed the large coin can be swept
+	old, _ := time.Now().Add(-2 * time.Hour).MarshalText()
+	_ = s.kv.Put([]byte(receivedKey(large)), old)
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 1_500_000}}); err != nil {
+		t.Fatalf("Spend after cool-down: %v", err)
+	}
+
+	if err := s.SetMaturityPolicy([]MaturityTier{{MinValueSats: 5}, {MinValueSats: 5}}); err == nil {
+		t.Fatalf("expected duplicate tiers to be refused")
+	}
+}
+
+func TestConfigMaturityTiers(t *testing.T) {
+	c := DefaultConfig()
+	c.MaturityTiers = []MaturityTierConfig{{MinValueSats: 0, MinConfirmations: 3, MinAge: "30m"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	c.MaturityTiers[0].MinAge = "soon"
+	if err := c.Validate(); err == nil {
+		t.Fatalf("expected an invalid min_age to be refused")
+	}
+}
@@ -0,0 +1,72 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the per-transaction output limit and batched spends.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoChangeRoom is returned when the recipients fill the output limit, the
+// selection needs change and no changeless selection was found.
+var ErrNoChangeRoom = errors.New("no room for a change output")
+
+// SetMaxOutputsPerTx caps recipient plus change outputs in every transaction
+// (0 = unlimited). Split change collapses into one output to fit; recipients
+// beyond the limit need SpendBatched.
+func (s *Sweeper) SetMaxOutputsPerTx(n int) error {
+	if n < 0 || n == 1 {
+		return fmt.Errorf("max outputs per transaction must be 0 (unlimited) or at least 2 (got %d)", n)
+	}
+	s.maxOutputsPerTx = n
+	return nil
+}
+
+// SpendBatched pays outputs like Spend, but when they do not fit in one
+// transaction under the output limit it spreads them over several, each with
+// room for one change output and with disjoint inputs. Outputs that fill the
+// limit exactly stay in one transaction if it needs no change. Either every
+// plan is created or none is.
+func (s *Sweeper) SpendBatched(outputs []TxOutput, opts ...SpendOptions) ([]*TransactionPlan, error) {
+	p, err := s.resolveSpendOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return nil, errors.New("no outputs specified - provide at least one destination address and amount")
+	}
+	if s.maxOutputsPerTx == 0 || len(outputs) <= s.maxOutputsPerTx {
+		plan, err := s.spend(outputs, p)
+		if err == nil {
+			return []*TransactionPlan{plan}, nil
+		}
+		if !errors.Is(err, ErrNoChangeRoom) {
+			return nil, err
+		}
+	}
+	per := len(outputs)
+	if s.maxOutputsPerTx > 0 {
+		per = s.maxOutputsPerTx - 1
+	}
+
+	p.exclude = map[string]bool{}
+	var plans []*TransactionPlan
+	for start := 0; start < len(outputs); start += per {
+		end := start + per
+		if end > len(outputs) {
+			end = len(outputs)
+		}
+		plan, err := s.spend(outputs[start:end], p)
+		if err != nil {
+			for _, done := range plans {
+				_ = s.DiscardPlan(done.ID)
+			}
+			return nil, fmt.Errorf("transaction %d (outputs %d-%d): %w", len(plans)+1, start, end-1, err)
+		}
+		for _, in := range plan.Inputs {
+			p.exclude[outpointKey(in)] = true
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSpendBatchedRespectsOutputLimit(t *testing.T) {
+	s := newTestSweeper(t, WithMaxOutputsPerTx(3))
+	for _, c := range []string{"a", "b", "c", "d"} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(c, 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	}
+	var outs []TxOutput
+	for i := 0; i < 5; i++ {
+		outs = append(outs, TxOutput{Address: testAddr("dest"), ValueSats: 20_000})
+	}
+	if _, err := s.Spend(outs); err == nil {
+		t.Fatalf("expected Spend to refuse 5 outputs with a limit of 3")
+	}
+	plans, err := s.SpendBatched(outs)
+	if err != nil {
+		t.Fatalf("SpendBatched: %v", err)
+	}
+	if len(plans) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(plans))
+	}
+	used := map[string]bool{}
+	paid := 0
+	for _, p := range plans {
+		if len(p.Outputs) > 3 {
+			t.Fatalf("plan has %d outputs", len(p.Outputs))
+		}
+		paid += len(p.Outputs) - len(p.ChangeIdxs)
+		for _, in := range p.Inputs {
+			if used[outpointKey(in)] {
+				t.Fatalf("input %s spent by two plans", outpointKey(in))
+			}
+			used[outpointKey(in)] = true
+		}
+	}
+	if paid != 5 {
+		t.Fatalf("expected 5 recipients paid, got %d", paid)
+	}
+}
+
+func TestOutputLimitCollapsesSplitChange(t *testing.T) {
+	s := newTestSweeper(t, WithMaxOutputsPerTx(2), WithChangeSplit(4, 50_000, 20_000))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 400_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Outputs) != 2 || len(plan.ChangeIdxs) != 1 {
+		t.Fatalf("expected one recipient and one change output, got %d outputs", len(plan.Outputs))
+	}
+}
+
+func TestRecipientsFillingOutputLimit(t *testing.T) {
+	outs := []TxOutput{{Address: testAddr("d1"), ValueSats: 20_000}, {Address: testAddr("d2"), ValueSats: 20_000}, {Address: testAddr("d3"), ValueSats: 20_000}}
+
+	// Needing change, Spend cannot fit it and SpendBatched splits
+	s := newTestSweeper(t, WithMaxOutputsPerTx(3))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.Spend(outs); !errors.Is(err, ErrNoChangeRoom) {
+		t.Fatalf("expected ErrNoChangeRoom, got %v", err)
+	}
+	plans, err := s.SpendBatched(outs)
+	if err != nil || len(plans) != 2 {
+		t.Fatalf("expected the batch to split in two, got %d plans, %v", len(plans), err)
+	}
+
+	// A coin matching the payments without change fits in one transaction
+	probe := newTestSweeper(t)
+	_ = probe.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	withChange, err := probe.Spend(outs)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	s = newTestSweeper(t, WithMaxOutputsPerTx(3))
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 60_000 + withChange.FeeSats, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend(outs)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Outputs) != 3 || len(plan.ChangeIdxs) != 0 || plan.Inputs[0].TxID != stringsRepeat("c", 64) {
+		t.Fatalf("expected a changeless spend of the matching coin, got %+v", plan)
+	}
+}
@@ -0,0 +1,178 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains merkle inclusion proof verification for confirmed UTXOs.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MerkleProof is a transaction's inclusion proof in the shape of Electrum's
+// blockchain.transaction.get_merkle: the sibling hashes from the leaf up
+// (hex, display byte order like txids) and the transaction's position in the
+// block.
+type MerkleProof struct {
+	BlockHeight int      `json:"block_height"`
+	Merkle      []string `json:"merkle"`
+	Pos         int      `json:"pos"`
+}
+
+// MerkleProofSource serves inclusion proofs for confirmed transactions and
+// the raw transactions they prove. It is usually the same untrusted backend
+// that reports UTXOs.
+type MerkleProofSource interface {
+	TxMerkleProof(txid string) (*MerkleProof, error)
+	RawTransaction(txid string) ([]byte, error)
+}
+
+// HeaderSource returns the raw 80-byte block header at a height. It must be
+// trusted independently of the proof source, e.g. a header chain the caller
+// has validated or a node it runs, since proofs are only as good as the
+// headers they are checked against.
+type HeaderSource interface {
+	BlockHeader(height int) ([]byte, error)
+}
+
+// VerifyMerkleProof checks that txid is committed to by the merkle root of
+// header at proof.Pos, and that header carries the proof of work its
+// difficulty bits claim.
+func VerifyMerkleProof(txid string, proof *MerkleProof, header []byte) error {
+	if proof == nil {
+		return errors.New("no merkle proof")
+	}
+	if len(header) != 80 {
+		return fmt.Errorf("block header must be 80 bytes (got %d)", len(header))
+	}
+	if err := checkHeaderWork(header); err != nil {
+		return err
+	}
+	if len(proof.Merkle) > 32 || proof.Pos < 0 || (len(proof.Merkle) < 32 && proof.Pos >= 1<<len(proof.Merkle)) {
+		return fmt.Errorf("merkle position %d does not fit a branch of %d hashes", proof.Pos, len(proof.Merkle))
+	}
+	h, err := displayHash(txid)
+	if err != nil {
+		return fmt.Errorf("invalid txid: %w", err)
+	}
+	pos := proof.Pos
+	for i, sib := range proof.Merkle {
+		s, err := displayHash(sib)
+		if err != nil {
+			return fmt.Errorf("merkle branch hash %d: %w", i, err)
+		}
+		if pos&1 == 0 {
+			h = sha256Double(append(h[:], s[:]...))
+		} else {
+			h = sha256Double(append(s[:], h[:]...))
+		}
+		pos >>= 1
+	}
+	if !bytes.Equal(h[:], header[36:68]) {
+		return errors.New("merkle proof does not match the block's merkle root")
+	}
+	return nil
+}
+
+// Hex hash in display order to internal byte order
+func displayHash(s string) ([32]byte, error) {
+	var h [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return h, errors.New("need 64 hex characters")
+	}
+	for i := range b {
+		h[31-i] = b[i]
+	}
+	return h, nil
+}
+
+// Check the header hash is at or below the target encoded in its bits field
+func checkHeaderWork(header []byte) error {
+	target, err := compactToTarget(headerBits(header))
+	if err != nil {
+		return fmt.Errorf("block header has %w", err)
+	}
+	hash := sha256Double(header)
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	if new(big.Int).SetBytes(hash[:]).Cmp(target) > 0 {
+		return errors.New("block header does not meet its proof-of-work target")
+	}
+	return nil
+}
+
+// SetMerkleVerification makes Index verify that every UTXO reported as
+// confirmed is included in a block before accepting it: the transaction and
+// its proof come from proofs, the proof is checked against the header from
+// headers, and the UTXO's value, script and height must match what was
+// proven. Pass nil proofs to turn verification off.
+func (s *Sweeper) SetMerkleVerification(proofs MerkleProofSource, headers HeaderSource) error {
+	if proofs != nil && headers == nil {
+		return errors.New("merkle verification needs a trusted header source")
+	}
+	s.merkleProofs, s.headers = proofs, headers
+	s.verifiedTxs = map[string]*provenTx{}
+	return nil
+}
+
+// provenTx is a transaction whose inclusion in a block has been verified
+type provenTx struct {
+	tx     *MsgTx
+	height int
+}
+
+// Verify the inclusion of a confirmed UTXO's transaction, fetched and proven
+// once per txid, and check the UTXO against the proven output
+func (s *Sweeper) verifyInclusion(utxo UTXO) error {
+	if s.merkleProofs == nil || !utxo.Confirmed {
+		return nil
+	}
+	proven := s.verifiedTxs[utxo.TxID]
+	if proven == nil {
+		var err error
+		if proven, err = s.proveTx(utxo.TxID); err != nil {
+			return err
+		}
+		s.verifiedTxs[utxo.TxID] = proven
+	}
+	if utxo.BlockHeight > 0 && utxo.BlockHeight != int64(proven.height) {
+		return fmt.Errorf("%s is reported at height %d but proven at %d", outpointKey(utxo), utxo.BlockHeight, proven.height)
+	}
+	if err := s.matchPrevOut(utxo, proven.tx); err != nil {
+		return fmt.Errorf("%w in the proven transaction", err)
+	}
+	return nil
+}
+
+// Fetch a transaction with its inclusion proof and verify both
+func (s *Sweeper) proveTx(txid string) (*provenTx, error) {
+	raw, err := s.merkleProofs.RawTransaction(txid)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch transaction %s: %w", txid, err)
+	}
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", txid, err)
+	}
+	if got := tx.TxID(); got != txid {
+		return nil, fmt.Errorf("backend returned transaction %s for %s", got, txid)
+	}
+	proof, err := s.merkleProofs.TxMerkleProof(txid)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch merkle proof for %s: %w", txid, err)
+	}
+	if proof == nil {
+		return nil, fmt.Errorf("backend returned no merkle proof for %s", txid)
+	}
+	header, err := s.headers.BlockHeader(proof.BlockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch block header %d: %w", proof.BlockHeight, err)
+	}
+	if err := VerifyMerkleProof(txid, proof, header); err != nil {
+		return nil, fmt.Errorf("transaction %s is not proven confirmed at height %d: %w", txid, proof.BlockHeight, err)
+	}
+	return &provenTx{tx: tx, height: proof.BlockHeight}, nil
+}
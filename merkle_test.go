@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Proofs and raw transactions by txid
+type fakeProofs struct {
+	proofs map[string]*MerkleProof
+	raw    map[string][]byte
+}
+
+func (f fakeProofs) TxMerkleProof(txid string) (*MerkleProof, error) {
+	if p, ok := f.proofs[txid]; ok {
+		return p, nil
+	}
+	return nil, errors.New("unknown transaction")
+}
+
+func (f fakeProofs) RawTransaction(txid string) ([]byte, error) {
+	if raw, ok := f.raw[txid]; ok {
+		return raw, nil
+	}
+	return nil, errors.New("unknown transaction")
+}
+
+// Transaction paying values to script, made unique by tag
+func payingTx(script []byte, tag byte, values ...int64) *MsgTx {
+	tx := NewMsgTx(2)
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{tag}}, Sequence: 0xffffffff})
+	for _, v := range values {
+		tx.AddTxOut(TxOut{Value: v, PkScript: script})
+	}
+	return tx
+}
+
+type fakeHeaders map[int][]byte
+
+func (f fakeHeaders) BlockHeader(height int) ([]byte, error) {
+	if h, ok := f[height]; ok {
+		return h, nil
+	}
+	return nil, errors.New("unknown height")
+}
+
+// Internal-order hash to display hex
+func hashHex(h [32]byte) string {
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// Regtest-difficulty header committing to root, with the nonce ground until
+// it meets the target
+func mineHeader(t *testing.T, root [32]byte) []byte {
+	t.Helper()
+	header := make([]byte, 80)
+	header[0] = 2
+	copy(header[36:68], root[:])
+	copy(header[72:76], []byte{0xff, 0xff, 0x7f, 0x20}) // bits 0x207fffff
+	for nonce := 0; nonce < 1000; nonce++ {
+		header[76], header[77] = byte(nonce), byte(nonce>>8)
+		if checkHeaderWork(header) == nil {
+			return header
+		}
+	}
+	t.Fatalf("could not mine a regtest header")
+	return nil
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	// Three transactions: the last is paired with itself
+	a, b, c := sha256Double([]byte("a")), sha256Double([]byte("b")), sha256Double([]byte("c"))
+	ab := sha256Double(append(a[:], b[:]...))
+	cc := sha256Double(append(c[:], c[:]...))
+	root := sha256Double(append(ab[:], cc[:]...))
+	header := mineHeader(t, root)
+
+	proofC := &MerkleProof{BlockHeight: 100, Merkle: []string{hashHex(c), hashHex(ab)}, Pos: 2}
+	if err := VerifyMerkleProof(hashHex(c), proofC, header); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	proofB := &MerkleProof{Merkle: []string{hashHex(a), hashHex(cc)}, Pos: 1}
+	if err := VerifyMerkleProof(hashHex(b), proofB, header); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		txid   string
+		proof  *MerkleProof
+		header []byte
+	}{
+		"other txid":   {hashHex(a), proofC, header},
+		"wrong pos":    {hashHex(c), &MerkleProof{Merkle: proofC.Merkle, Pos: 0}, header},
+		"pos too big":  {hashHex(c), &MerkleProof{Merkle: proofC.Merkle, Pos: 4}, header},
+		"bad sibling":  {hashHex(c), &MerkleProof{Merkle: []string{hashHex(c), hashHex(a)}, Pos: 2}, header},
+		"short header": {hashHex(c), proofC, header[:79]},
+		"no proof":     {hashHex(c), nil, header},
+	} {
+		if err := VerifyMerkleProof(tc.txid, tc.proof, tc.header); err == nil {
+			t.Fatalf("%s: expected the proof to be rejected", name)
+		}
+	}
+
+	// A header whose hash misses its target is refused even with a matching root
+	weak := append([]byte(nil), header...)
+	copy(weak[72:76], []byte{0xff, 0xff, 0x00, 0x1d}) // mainnet genesis difficulty
+	if err := VerifyMerkleProof(hashHex(c), proofC, weak); err == nil || !strings.Contains(err.Error(), "proof-of-work") {
+		t.Fatalf("expected a proof-of-work error, got %v", err)
+	}
+}
+
+func TestIndexRequiresInclusionProof(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(0x3e4c1e)}
+	addr, _ := CreateP2WPKH(Hash160(key.pub()), BitcoinTestnet)
+	s := mustNewSweeper(t, key.pub(), BitcoinTestnet)
+	s.SetPubKeyCheck(false)
+	script, _ := s.buildOutputScript(addr)
+	ta, tb := payingTx(script, 1, 50_000, 30_000), payingTx(script, 2, 50_000)
+	a, b := ta.TxHash(), tb.TxHash()
+	root := sha256Double(append(a[:], b[:]...))
+	if err := s.SetMerkleVerification(fakeProofs{}, nil); err == nil {
+		t.Fatalf("expected a header source to be required")
+	}
+	other := strings.Repeat("e", 64)
+	proofs := fakeProofs{
+		proofs: map[string]*MerkleProof{
+			hashHex(a): {BlockHeight: 7, Merkle: []string{hashHex(b)}, Pos: 0},
+			hashHex(b): {BlockHeight: 7, Merkle: []string{hashHex(b)}, Pos: 1}, // Forged
+			other:      {BlockHeight: 7, Merkle: []string{hashHex(b)}, Pos: 0},
+		},
+		raw: map[string][]byte{
+			hashHex(a): ta.Serialize(true),
+			hashHex(b): tb.Serialize(true),
+			other:      ta.Serialize(true), // Another transaction
+		},
+	}
+	if err := s.SetMerkleVerification(proofs, fakeHeaders{7: mineHeader(t, root)}); err != nil {
+		t.Fatalf("SetMerkleVerification: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: hashHex(a), ValueSats: 50_000, Address: addr, Confirmed: true, BlockHeight: 7}); err != nil {
+		t.Fatalf("proven UTXO rejected: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: hashHex(b), ValueSats: 50_000, Address: addr, Confirmed: true}); err == nil {
+		t.Fatalf("expected a forged proof to be rejected")
+	}
+	if err := s.Index(UTXO{TxID: other, ValueSats: 50_000, Address: addr, Confirmed: true}); err == nil || !strings.Contains(err.Error(), "returned transaction") {
+		t.Fatalf("expected a raw transaction with another txid to be rejected, got %v", err)
+	}
+	if err := s.Index(UTXO{TxID: strings.Repeat("f", 64), ValueSats: 50_000, Address: addr, Confirmed: true}); err == nil {
+		t.Fatalf("expected a UTXO without a proof to be rejected")
+	}
+
+	// The UTXO must be what was proven
+	elsewhere, _ := CreateP2WPKH(make([]byte, 20), BitcoinTestnet)
+	for name, u := range map[string]UTXO{
+		"value":   {TxID: hashHex(a), Vout: 1, ValueSats: 31_000, Address: addr, Confirmed: true},
+		"vout":    {TxID: hashHex(a), Vout: 2, ValueSats: 30_000, Address: addr, Confirmed: true},
+		"address": {TxID: hashHex(a), Vout: 1, ValueSats: 30_000, Address: elsewhere, Confirmed: true},
+		"height":  {TxID: hashHex(a), Vout: 1, ValueSats: 30_000, Address: addr, Confirmed: true, BlockHeight: 8},
+	} {
+		if err := s.Index(u); err == nil || !strings.Contains(err.Error(), "proven") {
+			t.Fatalf("%s: expected a UTXO that differs from the proven output to be rejected, got %v", name, err)
+		}
+	}
+	if err := s.Index(UTXO{TxID: hashHex(a), Vout: 1, ValueSats: 30_000, Address: addr, Confirmed: true}); err != nil {
+		t.Fatalf("second proven output rejected: %v", err)
+	}
+
+	if err := s.Index(UTXO{TxID: other, ValueSats: 50_000, Address: addr}); err != nil {
+		t.Fatalf("unconfirmed UTXOs need no proof: %v", err)
+	}
+	if len(s.indexedUTXOs) != 3 {
+		t.Fatalf("indexed %d UTXOs, want 3", len(s.indexedUTXOs))
+	}
+}
@@ -0,0 +1,120 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains persistent fee-savings metrics and Prometheus output.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// feeMetricsKey is where cumulative FeeMetrics are stored.
+const feeMetricsKey = "metrics:fees"
+
+// FeeMetrics accumulate, over every broadcast plan, the fees paid against an
+// estimate of paying each recipient with its own transaction. The estimate
+// charges every payout after the first the transaction overhead and a change
+// output, plus a change input once payouts outnumber the plan's inputs (each
+// payment spending the previous one's change); inputs cost the same either
+// way. Savings therefore come from batching payouts, not from consolidation
+// itself, whose value is in spending fewer inputs later.
+type FeeMetrics struct {
+	Plans         int   `json:"plans"`           // Broadcast plans counted
+	Payouts       int   `json:"payouts"`         // Recipient (non-change) outputs
+	Inputs        int   `json:"inputs"`          // Coins spent
+	FeesPaidSats  int64 `json:"fees_paid_sats"`  // Fees of the broadcast plans
+	NaiveFeesSats int64 `json:"naive_fees_sats"` // Estimated fees of one transaction per payout
+}
+
+// SavedSats returns the estimated fees saved by batching.
+func (m FeeMetrics) SavedSats() int64 {
+	return m.NaiveFeesSats - m.FeesPaidSats
+}
+
+// FeeMetrics returns the cumulative fee metrics from storage.
+func (s *Sweeper) FeeMetrics() (FeeMetrics, error) {
+	var m FeeMetrics
+	b, err := s.kv.Get([]byte(feeMetricsKey))
+	if err != nil {
+		return m, nil // Nothing broadcast yet
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("corrupt fee metrics: %w", err)
+	}
+	return m, nil
+}
+
+// Add a newly broadcast plan to the fee metrics
+func (s *Sweeper) recordFeeMetrics(p *TransactionPlan) error {
+	m, err := s.FeeMetrics()
+	if err != nil {
+		return err
+	}
+	m.Plans++
+	m.Inputs += len(p.Inputs)
+	payouts := len(p.Outputs) - len(p.ChangeIdxs)
+	m.Payouts += payouts
+	m.FeesPaidSats += p.FeeSats
+	m.NaiveFeesSats += p.FeeSats + s.unbatchedExtraFee(p, payouts)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put([]byte(feeMetricsKey), b)
+}
+
+// Extra fee of paying each of payouts with its own transaction (see FeeMetrics)
+func (s *Sweeper) unbatchedExtraFee(p *TransactionPlan, payouts int) int64 {
+	if payouts <= 1 {
+		return 0
+	}
+	changeAddr := ""
+	if len(p.ChangeIdxs) > 0 {
+		changeAddr = p.Outputs[p.ChangeIdxs[0]].Address
+	} else if a, err := s.getChangeAddress(); err == nil {
+		changeAddr = a
+	}
+	base := estimateTxVBytesDetailed(s, nil, nil)
+	changeOut := estimateTxVBytesDetailed(s, nil, []TxOutput{{Address: changeAddr}}) - base
+	extra := int64(payouts-1) * (base + changeOut)
+	if chained := payouts - len(p.Inputs); chained > 0 {
+		extra += int64(chained) * inputVBytes(s, UTXO{Address: changeAddr})
+	}
+	return p.Settings.feeRateKVB().Fee(extra)
+}
+
+// WritePrometheusMetrics writes Stats and FeeMetrics in the Prometheus text
+// exposition format, for a /metrics handler or the node exporter's textfile
+// collector.
+func (s *Sweeper) WritePrometheusMetrics(w io.Writer) error {
+	st := s.Stats()
+	fm, err := s.FeeMetrics()
+	if err != nil {
+		return err
+	}
+	metrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"utxos", "gauge", "Indexed UTXOs.", float64(st.UTXOs)},
+		{"utxo_sats", "gauge", "Value of indexed UTXOs in satoshis.", float64(st.UTXOSats)},
+		{"unconfirmed_utxos", "gauge", "Indexed UTXOs not yet confirmed.", float64(st.UnconfirmedUTXOs)},
+		{"plans", "gauge", "Tracked plans.", float64(st.Plans)},
+		{"unconfirmed_plans", "gauge", "Tracked plans not yet confirmed.", float64(st.UnconfirmedPlans)},
+		{"unconfirmed_exposure_sats", "gauge", "Unconfirmed input value across pending plans.", float64(st.UnconfirmedExposure)},
+		{"fee_rate", "gauge", "Current fee rate in sat/vB.", st.FeeRate},
+		{"broadcast_plans_total", "counter", "Plans broadcast.", float64(fm.Plans)},
+		{"payouts_total", "counter", "Recipient outputs of broadcast plans.", float64(fm.Payouts)},
+		{"fees_paid_sats_total", "counter", "Fees paid by broadcast plans.", float64(fm.FeesPaidSats)},
+		{"naive_fees_sats_total", "counter", "Estimated fees of one transaction per payout.", float64(fm.NaiveFeesSats)},
+		{"fee_savings_sats_total", "counter", "Estimated fees saved by batching.", float64(fm.SavedSats())},
+	}
+	for _, m := range metrics {
+		name := "utxo_sweeper_" + m.name
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, m.help, name, m.kind, name, strconv.FormatFloat(m.value, 'f', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
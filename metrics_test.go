@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeeMetricsPersistAcrossRestarts(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("a"), ValueSats: 50_000}, {Address: testAddr("b"), ValueSats: 60_000}, {Address: testAddr("c"), ValueSats: 70_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if m, _ := s.FeeMetrics(); m.Plans != 0 {
+		t.Fatalf("unbroadcast plan counted: %+v", m)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.MarkBroadcast(plan.ID, time.Now()); err != nil {
+			t.Fatalf("MarkBroadcast: %v", err)
+		}
+	}
+
+	// Two more transactions of overhead and change, two of them spending change
+	wantExtra := (2*(10+31) + 2*68) * plan.Settings.FeeRate
+	s2 := newTestSweeper(t, WithKV(kv))
+	m, err := s2.FeeMetrics()
+	if err != nil {
+		t.Fatalf("FeeMetrics: %v", err)
+	}
+	if m.Plans != 1 || m.Payouts != 3 || m.Inputs != 1 || m.FeesPaidSats != plan.FeeSats || m.SavedSats() != wantExtra {
+		t.Fatalf("metrics %+v, want fee %d and savings %d", m, plan.FeeSats, wantExtra)
+	}
+	if st := s2.Stats(); st.FeesPaidSats != plan.FeeSats || st.FeeSavingsSats != wantExtra {
+		t.Fatalf("stats %+v", st)
+	}
+
+	var buf bytes.Buffer
+	if err := s2.WritePrometheusMetrics(&buf); err != nil {
+		t.Fatalf("WritePrometheusMetrics: %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE utxo_sweeper_fee_savings_sats_total counter\n",
+		"utxo_sweeper_payouts_total 3\n",
+		fmt.Sprintf("utxo_sweeper_fee_savings_sats_total %d\n", wantExtra),
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("metrics output lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
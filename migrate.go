@@ -0,0 +1,286 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains KV schema versioning and migrations.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// KV keys of the schema version, the in-progress migration journal and the
+// backups of applied migrations ("schema:backup:<version>")
+const (
+	schemaVersionKey = "schema:version"
+	schemaJournalKey = "schema:journal"
+	schemaBackupKey  = "schema:backup:"
+)
+
+// Migration upgrades stored state from Version-1 to Version. Up reads and
+// writes through the KV it is given, which records the previous value of
+// every key it changes so a failed or unwanted migration can be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(kv KV) error
+}
+
+// schemaMigrations upgrade older stores to CurrentSchemaVersion, in order.
+var schemaMigrations = []Migration{
+	{Version: 1, Name: "record plan lifecycle states", Up: migratePlanStates},
+}
+
+// CurrentSchemaVersion is the layout this release reads and writes: the
+// version of the last schema migration.
+const CurrentSchemaVersion = 1
+
+// migrationJournal holds the values keys had before a migration changed
+// them; a nil value means the key did not exist.
+type migrationJournal struct {
+	Version int               `json:"version"`
+	Name    string            `json:"name"`
+	Before  map[string][]byte `json:"before"`
+}
+
+// journalKV records before-images in a migration journal, persisting the
+// journal ahead of each first write so a crash can be rolled back.
+type journalKV struct {
+	kv KV
+	j  *migrationJournal
+}
+
+// Get reads through to the store.
+func (k *journalKV) Get(key []byte) ([]byte, error) {
+	return k.kv.Get(key)
+}
+
+// Put records the key's previous value, then writes it.
+func (k *journalKV) Put(key, v []byte) error {
+	if err := k.remember(string(key)); err != nil {
+		return err
+	}
+	return k.kv.Put(key, v)
+}
+
+// Delete records the key's previous value, then removes it.
+func (k *journalKV) Delete(key []byte) error {
+	d, ok := k.kv.(KVDeleter)
+	if !ok {
+		return errors.New("KV store cannot delete keys")
+	}
+	if err := k.remember(string(key)); err != nil {
+		return err
+	}
+	return d.Delete(key)
+}
+
+// Save the key's current value in the journal on its first change
+func (k *journalKV) remember(key string) error {
+	if _, ok := k.j.Before[key]; ok {
+		return nil
+	}
+	var prev []byte
+	if v, err := k.kv.Get([]byte(key)); err == nil {
+		prev = append([]byte{}, v...)
+	}
+	k.j.Before[key] = prev
+	return putJSON(k.kv, schemaJournalKey, k.j)
+}
+
+// Marshal v and store it under key
+func putJSON(kv KV, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return kv.Put([]byte(key), b)
+}
+
+// SchemaVersion returns the stored schema version; stores written before
+// versioning report 0.
+func (s *Sweeper) SchemaVersion() (int, error) {
+	b, err := s.kv.Get([]byte(schemaVersionKey))
+	if err != nil {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, fmt.Errorf("corrupt schema version %q: %w", b, err)
+	}
+	return v, nil
+}
+
+// Migrate brings the KV store to CurrentSchemaVersion and returns the names
+// of the migrations it applied. Call it after SetKV and before LoadPlans. A
+// migration interrupted by a crash is rolled back before migrating again; one
+// that fails is rolled back and its error returned, leaving the store at the
+// previous version. Each applied migration's before-images are kept for
+// RollbackMigration. Stores written by a newer release are refused.
+func (s *Sweeper) Migrate() ([]string, error) {
+	return s.migrate(schemaMigrations)
+}
+
+// Apply the pending migrations of list, in version order
+func (s *Sweeper) migrate(list []Migration) ([]string, error) {
+	if err := s.recoverMigration(); err != nil {
+		return nil, err
+	}
+	cur, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	if latest := list[len(list)-1].Version; cur > latest {
+		return nil, fmt.Errorf("KV store has schema version %d, newer than this release's %d - upgrade the sweeper", cur, latest)
+	}
+	var applied []string
+	for _, m := range list {
+		if m.Version <= cur {
+			continue
+		}
+		if m.Version != cur+1 {
+			return applied, fmt.Errorf("no migration to schema version %d", cur+1)
+		}
+		if err := s.applyMigration(m); err != nil {
+			return applied, err
+		}
+		s.logger.Printf("migrated KV store to schema version %d: %s", m.Version, m.Name)
+		applied = append(applied, m.Name)
+		cur = m.Version
+	}
+	return applied, nil
+}
+
+// Run one migration under a journal; roll it back if it fails
+func (s *Sweeper) applyMigration(m Migration) error {
+	j := &migrationJournal{Version: m.Version, Name: m.Name, Before: map[string][]byte{}}
+	if err := putJSON(s.kv, schemaJournalKey, j); err != nil {
+		return err
+	}
+	jkv := &journalKV{kv: s.kv, j: j}
+	if err := m.Up(jkv); err != nil {
+		if rerr := s.restore(j.Before); rerr != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v; rollback also failed: %w", m.Version, m.Name, err, rerr)
+		}
+		_ = s.clearJournal()
+		return fmt.Errorf("migration %d (%s) failed and was rolled back: %w", m.Version, m.Name, err)
+	}
+	// Record the version through the journal so a rollback restores it too
+	if err := jkv.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(m.Version))); err != nil {
+		return err
+	}
+	if err := putJSON(s.kv, schemaBackupKey+strconv.Itoa(m.Version), j); err != nil {
+		return err
+	}
+	return s.clearJournal()
+}
+
+// Roll back a migration a crash left unfinished
+func (s *Sweeper) recoverMigration() error {
+	b, err := s.kv.Get([]byte(schemaJournalKey))
+	if err != nil {
+		return nil
+	}
+	var j *migrationJournal
+	if err := json.Unmarshal(b, &j); err != nil {
+		return fmt.Errorf("corrupt migration journal: %w", err)
+	}
+	if j == nil {
+		return nil
+	}
+	if err := s.restore(j.Before); err != nil {
+		return fmt.Errorf("rolling back interrupted migration %d: %w", j.Version, err)
+	}
+	s.logger.Printf("rolled back interrupted migration %d (%s)", j.Version, j.Name)
+	return s.clearJournal()
+}
+
+// Remove the migration journal; stores that cannot delete keep a null one
+func (s *Sweeper) clearJournal() error {
+	if _, ok := s.kv.(KVDeleter); ok {
+		return s.kvDelete(schemaJournalKey)
+	}
+	return putJSON(s.kv, schemaJournalKey, nil)
+}
+
+// Put back before-images; keys that did not exist are deleted
+func (s *Sweeper) restore(before map[string][]byte) error {
+	for key, v := range before {
+		if v == nil {
+			d, ok := s.kv.(KVDeleter)
+			if !ok {
+				return fmt.Errorf("cannot remove key %s: the KV store cannot delete keys", key)
+			}
+			if err := d.Delete([]byte(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.kv.Put([]byte(key), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackMigration undoes the latest applied migration, which must be
+// version, from its backup, returning the store to version-1. Run it with the
+// release that wrote the older schema about to take over again.
+func (s *Sweeper) RollbackMigration(version int) error {
+	cur, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != cur || cur == 0 {
+		return fmt.Errorf("only the latest migration (%d) can be rolled back, not %d", cur, version)
+	}
+	b, err := s.kv.Get([]byte(schemaBackupKey + strconv.Itoa(version)))
+	if err != nil {
+		return fmt.Errorf("no backup of migration %d: %w", version, err)
+	}
+	var j migrationJournal
+	if err := json.Unmarshal(b, &j); err != nil {
+		return fmt.Errorf("corrupt backup of migration %d: %w", version, err)
+	}
+	if err := s.restore(j.Before); err != nil {
+		return err
+	}
+	s.logger.Printf("rolled back migration %d (%s)", version, j.Name)
+	return s.kvDelete(schemaBackupKey + strconv.Itoa(version))
+}
+
+// Migration 1: give plans saved before lifecycle states their derived state
+func migratePlanStates(kv KV) error {
+	b, err := kv.Get([]byte("plans:index"))
+	if err != nil {
+		return nil // No plans
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return fmt.Errorf("plan index: %w", err)
+	}
+	for _, id := range ids {
+		raw, err := kv.Get([]byte("plan:" + id))
+		if err != nil {
+			continue // Reported by LoadPlans
+		}
+		var rec planRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return fmt.Errorf("plan %s: %w", id, err)
+		}
+		if rec.Status != "" {
+			continue
+		}
+		p := &TransactionPlan{CreatedAt: rec.CreatedAt, BroadcastAt: rec.BroadcastAt, ConfirmedAt: rec.ConfirmedAt}
+		if rec.SignedTx != "" {
+			p.SignedTx = &MsgTx{}
+		}
+		rec.Status, rec.History = legacyPlanState(p)
+		if err := putJSON(kv, "plan:"+id, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchemaMigrations(t *testing.T) {
+	if last := schemaMigrations[len(schemaMigrations)-1].Version; last != CurrentSchemaVersion {
+		t.Fatalf("CurrentSchemaVersion %d, last migration %d", CurrentSchemaVersion, last)
+	}
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	p := lifecyclePlan(t, s, "a")
+
+	// Strip the lifecycle fields, as a release before them stored plans
+	var rec map[string]any
+	b, _ := kv.Get([]byte("plan:" + p.ID))
+	_ = json.Unmarshal(b, &rec)
+	delete(rec, "status")
+	delete(rec, "history")
+	legacy, _ := json.Marshal(rec)
+	_ = kv.Put([]byte("plan:"+p.ID), legacy)
+
+	applied, err := s.Migrate()
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("Migrate = %v, %v", applied, err)
+	}
+	var got planRecord
+	b, _ = kv.Get([]byte("plan:" + p.ID))
+	_ = json.Unmarshal(b, &got)
+	if v, _ := s.SchemaVersion(); v != 1 || got.Status != PlanDraft || len(got.History) != 1 {
+		t.Fatalf("version %d, migrated plan %s %+v", v, got.Status, got.History)
+	}
+	if applied, err := s.Migrate(); err != nil || len(applied) != 0 {
+		t.Fatalf("second Migrate = %v, %v", applied, err)
+	}
+
+	// A failing migration leaves no trace
+	broken := append(append([]Migration{}, schemaMigrations...), Migration{Version: 2, Name: "broken", Up: func(kv KV) error {
+		_ = kv.Put([]byte("new:key"), []byte("x"))
+		_ = kv.Put([]byte("plan:"+p.ID), []byte("garbage"))
+		return errors.New("disk full")
+	}})
+	if _, err := s.migrate(broken); err == nil {
+		t.Fatalf("expected the failing migration's error")
+	}
+	if _, err := kv.Get([]byte("new:key")); err == nil {
+		t.Fatalf("rolled back migration left a key behind")
+	}
+	if b, _ := kv.Get([]byte("plan:" + p.ID)); string(b) == "garbage" {
+		t.Fatalf("rolled back migration left a changed value")
+	}
+	if v, _ := s.SchemaVersion(); v != 1 {
+		t.Fatalf("version %d after a failed migration", v)
+	}
+
+	// A journal left by a crash is rolled back before migrating
+	_ = kv.Put([]byte("k"), []byte("new"))
+	_ = putJSON(kv, schemaJournalKey, migrationJournal{Version: 2, Before: map[string][]byte{"k": []byte("old"), "made": nil}})
+	_ = kv.Put([]byte("made"), []byte("1"))
+	if _, err := s.Migrate(); err != nil {
+		t.Fatalf("Migrate after crash: %v", err)
+	}
+	if b, _ := kv.Get([]byte("k")); string(b) != "old" {
+		t.Fatalf("interrupted migration not rolled back: k = %s", b)
+	}
+	if _, err := kv.Get([]byte("made")); err == nil {
+		t.Fatalf("interrupted migration's new key survived")
+	}
+
+	// Rolling back migration 1 restores the legacy record and version
+	if err := s.RollbackMigration(2); err == nil {
+		t.Fatalf("expected rolling back an unapplied migration to fail")
+	}
+	if err := s.RollbackMigration(1); err != nil {
+		t.Fatalf("RollbackMigration: %v", err)
+	}
+	if b, _ := kv.Get([]byte("plan:" + p.ID)); string(b) != string(legacy) {
+		t.Fatalf("plan record not restored")
+	}
+	if v, _ := s.SchemaVersion(); v != 0 {
+		t.Fatalf("version %d after rollback", v)
+	}
+
+	_ = kv.Put([]byte(schemaVersionKey), []byte("99"))
+	if _, err := s.Migrate(); err == nil {
+		t.Fatalf("expected a store from a newer release to be refused")
+	}
+}
@@ -0,0 +1,442 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains wsh(sortedmulti(...)) threshold multisig accounts.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultMultisigLookahead is how many receive and change addresses are
+// derived up front so their UTXOs can be recognized.
+const defaultMultisigLookahead = 20
+
+// MultisigKey is one cosigner's account-level extended public key with the
+// key origin (master fingerprint and path) signers need to find their key.
+type MultisigKey struct {
+	XPub        *ExtendedPubKey
+	Fingerprint [4]byte  // Master key fingerprint
+	Path        []uint32 // Origin path from the master key to XPub
+}
+
+// MultisigAccount is a k-of-n wsh(sortedmulti) account. Receive addresses
+// use child path 0/i and change addresses 1/i below every cosigner's xpub.
+type MultisigAccount struct {
+	Threshold int
+	Keys      []MultisigKey
+	Network   Network
+}
+
+// multisigScript is one derived multisig address with its signing metadata.
+type multisigScript struct {
+	Address       string
+	WitnessScript []byte
+	Derivations   map[string]*Bip32Derivation // By compressed pubkey
+	Threshold     int
+	Keys          int
+	Change        bool
+	Index         uint32
+}
+
+// ParseMultisigDescriptor parses an output descriptor of the form
+// wsh(sortedmulti(k,[fingerprint/origin/path]xpub/<0;1>/*,...)), with an
+// optional #checksum. The origin and the /<0;1>/* suffix are optional; keys
+// without an origin use their own fingerprint and an empty path.
+func ParseMultisigDescriptor(desc string, network Network) (*MultisigAccount, error) {
+	desc = strings.TrimSpace(desc)
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		want, err := descriptorChecksum(desc[:i])
+		if err != nil {
+			return nil, err
+		}
+		if desc[i+1:] != want {
+			return nil, fmt.Errorf("descriptor checksum %q does not match (expected %q) - copy the descriptor again", desc[i+1:], want)
+		}
+		desc = desc[:i]
+	}
+	const prefix, suffix = "wsh(sortedmulti(", "))"
+	if !strings.HasPrefix(desc, prefix) || !strings.HasSuffix(desc, suffix) {
+		return nil, errors.New("only wsh(sortedmulti(k,key,...)) descriptors are supported")
+	}
+	parts := strings.Split(desc[len(prefix):len(desc)-len(suffix)], ",")
+	if len(parts) < 2 {
+		return nil, errors.New("sortedmulti needs a threshold and at least one key")
+	}
+	k, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multisig threshold %q", parts[0])
+	}
+	a := &MultisigAccount{Threshold: k, Network: network}
+	for _, p := range parts[1:] {
+		key, err := parseMultisigKey(p)
+		if err != nil {
+			return nil, err
+		}
+		a.Keys = append(a.Keys, key)
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Parse "[fp/path]xpub/<0;1>/*" into a MultisigKey
+func parseMultisigKey(s string) (MultisigKey, error) {
+	var key MultisigKey
+	hasOrigin := strings.HasPrefix(s, "[")
+	if hasOrigin {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return key, fmt.Errorf("unterminated key origin in %q", s)
+		}
+		origin := strings.Split(s[1:end], "/")
+		fp, err := hex.DecodeString(origin[0])
+		if err != nil || len(fp) != 4 {
+			return key, fmt.Errorf("key origin fingerprint %q must be 8 hex characters", origin[0])
+		}
+		copy(key.Fingerprint[:], fp)
+		for _, step := range origin[1:] {
+			i, err := parsePathStep(step)
+			if err != nil {
+				return key, err
+			}
+			key.Path = append(key.Path, i)
+		}
+		s = s[end+1:]
+	}
+	for _, sfx := range []string{"/<0;1>/*", "/0/*"} {
+		s = strings.TrimSuffix(s, sfx)
+	}
+	if strings.Contains(s, "/") {
+		return key, fmt.Errorf("unsupported key path in %q - give the account xpub with an optional /<0;1>/* suffix", s)
+	}
+	xpub, err := ParseExtendedPubKey(s)
+	if err != nil {
+		return key, err
+	}
+	key.XPub = xpub
+	if !hasOrigin {
+		key.Fingerprint = xpub.Fingerprint()
+	}
+	return key, nil
+}
+
+// Parse a path step such as 48h, 48' or 0
+func parsePathStep(step string) (uint32, error) {
+	hard := strings.HasSuffix(step, "h") || strings.HasSuffix(step, "'")
+	if hard {
+		step = step[:len(step)-1]
+	}
+	n, err := strconv.ParseUint(step, 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("invalid derivation step %q", step)
+	}
+	if hard {
+		n += hardenedOffset
+	}
+	return uint32(n), nil
+}
+
+// validate checks the threshold and rejects duplicate cosigners
+func (a *MultisigAccount) validate() error {
+	n := len(a.Keys)
+	if n < 1 || n > 20 {
+		return fmt.Errorf("sortedmulti supports 1 to 20 keys (got %d)", n)
+	}
+	if a.Threshold < 1 || a.Threshold > n {
+		return fmt.Errorf("multisig threshold %d must be between 1 and %d", a.Threshold, n)
+	}
+	seen := map[string]bool{}
+	for _, k := range a.Keys {
+		if k.XPub == nil {
+			return errors.New("multisig key has no xpub")
+		}
+		id := string(k.XPub.PubKey[:])
+		if seen[id] {
+			return errors.New("duplicate cosigner xpub in multisig account")
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// String describes the policy, e.g. "2-of-3 sortedmulti".
+func (a *MultisigAccount) String() string {
+	return fmt.Sprintf("%d-of-%d sortedmulti", a.Threshold, len(a.Keys))
+}
+
+// Address returns the receive (or change) address at index.
+func (a *MultisigAccount) Address(change bool, index uint32) (string, error) {
+	ms, err := a.derive(change, index)
+	if err != nil {
+		return "", err
+	}
+	return ms.Address, nil
+}
+
+// Derive the witness script, address and cosigner derivations for one index
+func (a *MultisigAccount) derive(change bool, index uint32) (*multisigScript, error) {
+	branch := uint32(0)
+	if change {
+		branch = 1
+	}
+	ms := &multisigScript{Derivations: map[string]*Bip32Derivation{}, Threshold: a.Threshold, Keys: len(a.Keys), Change: change, Index: index}
+	var pubs [][]byte
+	for _, k := range a.Keys {
+		child, err := k.XPub.Derive(branch, index)
+		if err != nil {
+			return nil, err
+		}
+		pub := append([]byte{}, child.PubKey[:]...)
+		pubs = append(pubs, pub)
+		path := append(append([]uint32{}, k.Path...), branch, index)
+		ms.Derivations[string(pub)] = &Bip32Derivation{MasterFingerprint: k.Fingerprint, Path: path}
+	}
+	ms.WitnessScript = sortedMultiScript(a.Threshold, pubs)
+	addr, err := CreateP2WSH(ms.WitnessScript, a.Network)
+	if err != nil {
+		return nil, err
+	}
+	ms.Address = addr
+	return ms, nil
+}
+
+// Build k <sorted pubkeys> n OP_CHECKMULTISIG
+func sortedMultiScript(k int, pubs [][]byte) []byte {
+	sorted := append([][]byte{}, pubs...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	script := scriptNum(k)
+	for _, p := range sorted {
+		script = append(script, byte(len(p)))
+		script = append(script, p...)
+	}
+	return append(append(script, scriptNum(len(pubs))...), 0xae)
+}
+
+// Minimal push of a key count of 1 to 20: OP_1 to OP_16, then a one-byte push
+func scriptNum(n int) []byte {
+	if n >= 1 && n <= 16 {
+		return []byte{byte(0x50 + n)}
+	}
+	return []byte{0x01, byte(n)}
+}
+
+// Read a minimally pushed key count of 1 to 20 from the start of script,
+// returning it and the bytes it took
+func readScriptNum(script []byte) (int, int, error) {
+	switch {
+	case len(script) >= 1 && script[0] >= 0x51 && script[0] <= 0x60:
+		return int(script[0]) - 0x50, 1, nil
+	case len(script) >= 2 && script[0] == 0x01 && script[1] > 16 && script[1] <= 20:
+		return int(script[1]), 2, nil
+	}
+	return 0, 0, errors.New("malformed multisig script")
+}
+
+// Parse a bare multisig script into its threshold and public keys
+func parseMultisigScript(script []byte) (int, [][]byte, error) {
+	if len(script) < 3 || script[len(script)-1] != 0xae {
+		return 0, nil, errors.New("not a multisig script")
+	}
+	k, i, err := readScriptNum(script)
+	if err != nil {
+		return 0, nil, err
+	}
+	var pubs [][]byte
+	for i < len(script)-1 && script[i] == 33 {
+		if i+34 > len(script)-1 {
+			return 0, nil, errors.New("malformed multisig script")
+		}
+		pubs = append(pubs, script[i+1:i+34])
+		i += 34
+	}
+	n, used, err := readScriptNum(script[i : len(script)-1])
+	if err != nil {
+		return 0, nil, err
+	}
+	if i+used != len(script)-1 || k > len(pubs) || n != len(pubs) {
+		return 0, nil, errors.New("malformed multisig script")
+	}
+	return k, pubs, nil
+}
+
+// Virtual size of spending this script with k signatures: outpoint, empty
+// scriptSig and sequence, plus the witness (item count, empty dummy, k
+// 72-byte signatures with their length, and the witness script).
+func (ms *multisigScript) inputVBytes() int64 {
+	scriptLen := int64(len(ms.WitnessScript))
+	lenPrefix := int64(1)
+	if scriptLen >= 0xfd {
+		lenPrefix = 3
+	}
+	witness := 1 + 1 + int64(ms.Threshold)*(1+72) + lenPrefix + scriptLen
+	return 41 + (witness+3)/4
+}
+
+// SetMultisigAccount makes a wsh(sortedmulti) account the sweeper's wallet:
+// its first lookahead receive and change addresses (0 = 20) are recognized,
+// plans spending them carry witness scripts and every cosigner's BIP-32
+// derivation, and change goes to the next unused change address.
+func (s *Sweeper) SetMultisigAccount(a *MultisigAccount, lookahead int) error {
+	if a == nil {
+		s.multisig, s.multisigScripts = nil, nil
+		return nil
+	}
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if a.Network != s.network {
+		return errors.New("multisig account network does not match the sweeper network")
+	}
+	if s.account != nil {
+		return errors.New("an xpub account is already configured - use either xpub or multisig_descriptor")
+	}
+	if lookahead < 0 {
+		return fmt.Errorf("multisig lookahead must be non-negative (got %d)", lookahead)
+	}
+	if lookahead == 0 {
+		lookahead = defaultMultisigLookahead
+	}
+	scripts := map[string]*multisigScript{}
+	for _, change := range []bool{false, true} {
+		for i := 0; i < lookahead; i++ {
+			ms, err := a.derive(change, uint32(i))
+			if err != nil {
+				return err
+			}
+			scripts[ms.Address] = ms
+		}
+	}
+	s.multisig, s.multisigScripts = a, scripts
+	if err := s.deriveToCounters(lookahead, s.multisigAddress); err != nil {
+		s.multisig, s.multisigScripts = nil, nil
+		return err
+	}
+	return nil
+}
+
+// Signing metadata for one of our multisig addresses, or nil
+func (s *Sweeper) multisigScriptFor(addr string) *multisigScript {
+	if s.multisigScripts == nil {
+		return nil
+	}
+	return s.multisigScripts[addr]
+}
+
+// Next change address from the persisted change counter, skipping addresses
+// that have received funds or are the change of a pending plan. It is
+// reserved only when a plan paying it is tracked.
+func (s *Sweeper) nextMultisigChange() (string, error) {
+	_, addr, err := s.peekIndex(true, func(i uint32) (string, error) {
+		return s.multisigAddress(true, i)
+	})
+	return addr, err
+}
+
+// Derive a multisig address and register it, which extends the lookahead
+func (s *Sweeper) multisigAddress(change bool, i uint32) (string, error) {
+	ms, err := s.multisig.derive(change, i)
+	if err != nil {
+		return "", err
+	}
+	s.multisigScripts[ms.Address] = ms
+	return ms.Address, nil
+}
+
+// Addresses that have received funds or are the change of a pending plan
+func (s *Sweeper) usedAddresses() map[string]bool {
+	used := map[string]bool{}
+	for _, a := range s.AddressStats() {
+		if a.Received > 0 {
+			used[a.Address] = true
+		}
+	}
+	for _, p := range s.plans {
+		for _, c := range p.Change {
+			used[c.Address] = true
+		}
+	}
+	return used
+}
+
+// Add witness scripts and cosigner derivations for multisig inputs and outputs
+func (s *Sweeper) decoratePSBT(psbt *PSBT, inputs []UTXO, outputs []TxOutput) {
+	s.decorateMuSig2(psbt, inputs, outputs)
+	s.decorateAccount(psbt, inputs, outputs)
+	if s.multisigScripts == nil {
+		return
+	}
+	for i, in := range inputs {
+		if ms := s.multisigScriptFor(in.Address); ms != nil {
+			psbt.Inputs[i].WitnessScript = ms.WitnessScript
+			for pk, d := range ms.Derivations {
+				psbt.Inputs[i].Bip32Derivation[pk] = d
+			}
+		}
+	}
+	for i, out := range outputs {
+		if ms := s.multisigScriptFor(out.Address); ms != nil {
+			psbt.Outputs[i].WitnessScript = ms.WitnessScript
+			for pk, d := range ms.Derivations {
+				psbt.Outputs[i].Bip32Derivation[pk] = d
+			}
+		}
+	}
+}
+
+// Output descriptor checksum (BIP-380)
+func descriptorChecksum(desc string) (string, error) {
+	const inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	const checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	polymod := func(c uint64, val int) uint64 {
+		c0 := c >> 35
+		c = ((c & 0x7ffffffff) << 5) ^ uint64(val)
+		for i, g := range []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd} {
+			if c0>>uint(i)&1 == 1 {
+				c ^= g
+			}
+		}
+		return c
+	}
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(inputCharset, ch)
+		if pos < 0 {
+			return "", fmt.Errorf("invalid character %q in descriptor", ch)
+		}
+		c = polymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		if clsCount++; clsCount == 3 {
+			c = polymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = polymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = polymod(c, 0)
+	}
+	c ^= 1
+	out := make([]byte, 8)
+	for j := range out {
+		out[j] = checksumCharset[(c>>(5*(7-uint(j))))&31]
+	}
+	return string(out), nil
+}
+
+// Describe the multisig policy for settings snapshots
+func (s *Sweeper) multisigPolicy() string {
+	if s.multisig == nil {
+		return ""
+	}
+	return s.multisig.String()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+// BIP-32 test vector 1: m, m/0H and m/0H/1
+const (
+	tvXpubM      = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	tvXpubM0H    = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	tvXpubM0H1   = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+	tvXprvMaster = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+)
+
+func TestExtendedPubKeyDerivation(t *testing.T) {
+	k, err := ParseExtendedPubKey(tvXpubM0H)
+	if err != nil {
+		t.Fatalf("ParseExtendedPubKey: %v", err)
+	}
+	if k.String() != tvXpubM0H {
+		t.Fatalf("round trip mismatch")
+	}
+	c, err := k.Child(1)
+	if err != nil {
+		t.Fatalf("Child: %v", err)
+	}
+	if c.String() != tvXpubM0H1 {
+		t.Fatalf("m/0H/1 = %s, want %s", c, tvXpubM0H1)
+	}
+	if _, err := k.Child(hardenedOffset); err == nil {
+		t.Fatalf("expected hardened public derivation to fail")
+	}
+	if _, err := ParseExtendedPubKey(tvXprvMaster); err == nil {
+		t.Fatalf("expected a private extended key to be rejected")
+	}
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	// BIP-380 example
+	if got, _ := descriptorChecksum("raw(deadbeef)"); got != "89f8spxm" {
+		t.Fatalf("checksum = %s, want 89f8spxm", got)
+	}
+}
+
+func TestSortedMultiAccountPlansWithCosignerData(t *testing.T) {
+	desc := "wsh(sortedmulti(2,[deadbeef/48h/0h/0h/2h]" + tvXpubM + "/<0;1>/*," + tvXpubM0H + "," + tvXpubM0H1 + "))"
+	sum, _ := descriptorChecksum(desc)
+	acct, err := ParseMultisigDescriptor(desc+"#"+sum, BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("ParseMultisigDescriptor: %v", err)
+	}
+	if _, err := ParseMultisigDescriptor(desc+"#qqqqqqqq", BitcoinMainnet); err == nil {
+		t.Fatalf("expected a bad checksum to be rejected")
+	}
+	if acct.String() != "2-of-3 sortedmulti" || acct.Keys[0].Fingerprint != [4]byte{0xde, 0xad, 0xbe, 0xef} {
+		t.Fatalf("unexpected account %v", acct)
+	}
+
+	recv, _ := acct.derive(false, 0)
+	if dec, err := DecodeAddress(recv.Address); err != nil || dec.Type != P2WSH || !bytes.Equal(dec.Data, SHA256(recv.WitnessScript)) {
+		t.Fatalf("receive address is not the P2WSH of its witness script: %v", err)
+	}
+	k, pubs, err := parseMultisigScript(recv.WitnessScript)
+	if err != nil || k != 2 || len(pubs) != 3 || bytes.Compare(pubs[0], pubs[1]) > 0 || bytes.Compare(pubs[1], pubs[2]) > 0 {
+		t.Fatalf("witness script is not a sorted 2-of-3: %v", err)
+	}
+	if vb := recv.inputVBytes(); vb != 105 {
+		t.Fatalf("2-of-3 input = %d vB, want 105", vb)
+	}
+
+	pub := make([]byte, 33)
+	copy(pub, acct.Keys[0].XPub.PubKey[:])
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	if err := s.SetMultisigAccount(acct, 5); err != nil {
+		t.Fatalf("SetMultisigAccount: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: recv.Address, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	dest, _ := acct.Address(false, 1)
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	change, _ := acct.Address(true, 0)
+	if len(plan.Change) != 1 || plan.Change[0].Address != change {
+		t.Fatalf("expected change to the first multisig change address, got %+v", plan.Change)
+	}
+
+	// The PSBT survives a round trip with the witness script and all cosigner paths
+	parsed, err := ParsePSBT(plan.PSBT.Serialize())
+	if err != nil {
+		t.Fatalf("ParsePSBT: %v", err)
+	}
+	in := parsed.Inputs[0]
+	if !bytes.Equal(in.WitnessScript, recv.WitnessScript) || len(in.Bip32Derivation) != 3 {
+		t.Fatalf("input lacks witness script or cosigner derivations")
+	}
+	for pk, d := range in.Bip32Derivation {
+		if want := recv.Derivations[pk]; want == nil || len(d.Path) != len(want.Path) || d.MasterFingerprint != want.MasterFingerprint {
+			t.Fatalf("derivation mismatch for %x", pk)
+		}
+	}
+	if len(parsed.Outputs[plan.ChangeIdxs[0]].Bip32Derivation) != 3 {
+		t.Fatalf("change output lacks cosigner derivations")
+	}
+
+	// Two of three signatures finalize the input in script key order, each
+	// only once it verifies
+	keys := []testECDSAKey{{d: big.NewInt(11)}, {d: big.NewInt(22)}, {d: big.NewInt(33)}}
+	script := sortedMultiScript(2, [][]byte{keys[0].pub(), keys[1].pub(), keys[2].pub()})
+	_, pubs, _ = parseMultisigScript(script)
+	tx := NewMsgTx(2)
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{1}}, Sequence: 0xfffffffd})
+	tx.AddTxOut(TxOut{Value: 40_000, PkScript: []byte{0x00, 0x14, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}})
+	ps := NewPSBTFromUnsignedTx(tx)
+	ps.Inputs[0].WitnessUtxo = &TxOut{Value: 50_000, PkScript: append([]byte{0x00, 0x20}, SHA256(script)...)}
+	ps.Inputs[0].WitnessScript = script
+	keys[2].signPSBT(t, ps)
+	keys[0].signPSBT(t, ps)
+	h := &sigHasher{tx: tx, prevs: []*TxOut{ps.Inputs[0].WitnessUtxo}}
+	_, wit, err := finalizeInput(h, 0, &ps.Inputs[0])
+	if err != nil {
+		t.Fatalf("finalizeInput: %v", err)
+	}
+	var order [][]byte
+	for _, pk := range pubs {
+		if sig := ps.Inputs[0].PartialSigs[string(pk)]; sig != nil {
+			order = append(order, sig)
+		}
+	}
+	if len(wit) != 4 || len(wit[0]) != 0 || !bytes.Equal(wit[1], order[0]) || !bytes.Equal(wit[2], order[1]) {
+		t.Fatalf("unexpected multisig witness %x", wit)
+	}
+	ps.Inputs[0].PartialSigs[string(keys[0].pub())] = ps.Inputs[0].PartialSigs[string(keys[2].pub())]
+	if _, _, err := finalizeInput(h, 0, &ps.Inputs[0]); err == nil {
+		t.Fatalf("expected a cosigner's signature under another key to be refused")
+	}
+}
+
+func TestMultisigScriptKeyCounts(t *testing.T) {
+	for _, n := range []int{1, 16, 17, 20} {
+		var pubs [][]byte
+		for i := 0; i < n; i++ {
+			pubs = append(pubs, append([]byte{0x02}, bytes.Repeat([]byte{byte(i + 1)}, 32)...))
+		}
+		script := sortedMultiScript(n, pubs)
+		if n > 16 && (script[0] != 0x01 || int(script[1]) != n) {
+			t.Fatalf("%d keys: expected a one-byte push of the threshold, got %x", n, script[:2])
+		}
+		k, got, err := parseMultisigScript(script)
+		if err != nil || k != n || len(got) != n {
+			t.Fatalf("%d keys: parsed %d-of-%d, %v", n, k, len(got), err)
+		}
+	}
+
+	// Counts above 16 as opcodes, or pushed non-minimally, are not multisig
+	pub := append([]byte{0x02}, bytes.Repeat([]byte{1}, 32)...)
+	for _, bad := range [][]byte{
+		append(append([]byte{0x01, 0x01, 0x21}, pub...), 0x51, 0xae),
+		append(append([]byte{0x51, 0x21}, pub...), 0x01, 0x01, 0xae),
+		append(append([]byte{0x51, 0x21}, pub...), 0x61, 0xae),
+		append(append([]byte{0x52, 0x21}, pub...), 0x51, 0xae),
+	} {
+		if _, _, err := parseMultisigScript(bad); err == nil {
+			t.Fatalf("expected %x to be refused", bad)
+		}
+	}
+}
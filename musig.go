@@ -0,0 +1,204 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains MuSig2 (BIP-327) key aggregation for taproot change keys.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// MuSig2Key is an n-of-n MuSig2 aggregate used as a taproot key-path output.
+// The internal key is the x-only aggregate; the output key commits to it with
+// an unspendable script path (BIP-86 style tweak), so only the cosigners
+// together can spend.
+type MuSig2Key struct {
+	Participants [][]byte // 33-byte compressed keys in aggregation (KeySort) order
+	AggregateKey []byte   // 33-byte plain aggregate key, the BIP-373 PSBT key
+	InternalKey  []byte   // 32-byte x-only taproot internal key
+	OutputKey    []byte   // 32-byte x-only tweaked output key in the P2TR script
+}
+
+// AggregateMuSig2Keys sorts the participants' compressed public keys (BIP-327
+// KeySort) and aggregates them with KeyAgg, then applies the taproot tweak.
+// Sorting makes the result independent of the order keys were listed in.
+func AggregateMuSig2Keys(pubKeys [][]byte) (*MuSig2Key, error) {
+	if len(pubKeys) < 2 {
+		return nil, fmt.Errorf("MuSig2 needs at least 2 participant keys (got %d)", len(pubKeys))
+	}
+	sorted := make([][]byte, len(pubKeys))
+	for i, pk := range pubKeys {
+		if len(pk) != 33 {
+			return nil, fmt.Errorf("participant key %d must be a 33-byte compressed public key (got %d bytes)", i, len(pk))
+		}
+		sorted[i] = append([]byte(nil), pk...)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	q, err := keyAgg(sorted)
+	if err != nil {
+		return nil, err
+	}
+	internal := q.x.FillBytes(make([]byte, 32))
+	out, _, err := TaprootOutputKey(internal)
+	if err != nil {
+		return nil, err
+	}
+	return &MuSig2Key{
+		Participants: sorted,
+		AggregateKey: compressPubKey(q),
+		InternalKey:  internal,
+		OutputKey:    out,
+	}, nil
+}
+
+// ParseMuSig2Participants decodes hex compressed public keys and aggregates them.
+func ParseMuSig2Participants(hexKeys []string) (*MuSig2Key, error) {
+	keys := make([][]byte, len(hexKeys))
+	for i, h := range hexKeys {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("participant key %d is not hex: %w", i, err)
+		}
+		keys[i] = b
+	}
+	return AggregateMuSig2Keys(keys)
+}
+
+// BIP-327 KeyAgg over keys in the given order
+func keyAgg(pubKeys [][]byte) (*ecPoint, error) {
+	var all []byte
+	for _, pk := range pubKeys {
+		all = append(all, pk...)
+	}
+	l := taggedHash("KeyAgg list", all)
+	second := make([]byte, 33)
+	for _, pk := range pubKeys[1:] {
+		if !bytes.Equal(pk, pubKeys[0]) {
+			second = pk
+			break
+		}
+	}
+	var q *ecPoint
+	for i, pk := range pubKeys {
+		p, err := decompressPubKey(pk)
+		if err != nil {
+			return nil, fmt.Errorf("participant key %d: %w", i, err)
+		}
+		a := big.NewInt(1)
+		if !bytes.Equal(pk, second) {
+			h := taggedHash("KeyAgg coefficient", l[:], pk)
+			a.SetBytes(h[:]).Mod(a, secpN)
+		}
+		q = ecAdd(q, ecMul(p, a))
+	}
+	if q == nil {
+		return nil, errors.New("MuSig2 aggregate key is the point at infinity")
+	}
+	return q, nil
+}
+
+// SetMuSig2ChangeKey aggregates the cosigners' keys and uses the tweaked
+// result as the taproot change key. Plans paying to or spending from that
+// address carry the internal key and participant list in their PSBTs so the
+// cosigner service can run the two MuSig2 signing rounds.
+func (s *Sweeper) SetMuSig2ChangeKey(pubKeys [][]byte) error {
+	if s.multisig != nil || s.account != nil {
+		return errors.New("a multisig or xpub account already provides change addresses - remove it to use a MuSig2 change key")
+	}
+	k, err := AggregateMuSig2Keys(pubKeys)
+	if err != nil {
+		return err
+	}
+	if err := s.SetTaprootChangeKey(k.OutputKey); err != nil {
+		return err
+	}
+	s.musig2 = k
+	return nil
+}
+
+// MuSig2ChangeKey returns the configured MuSig2 change key, or nil.
+func (s *Sweeper) MuSig2ChangeKey() *MuSig2Key {
+	return s.musig2
+}
+
+// Add taproot internal key and MuSig2 participants to PSBT inputs and
+// outputs at the MuSig2 change address
+func (s *Sweeper) decorateMuSig2(psbt *PSBT, inputs []UTXO, outputs []TxOutput) {
+	if s.musig2 == nil {
+		return
+	}
+	addr, err := CreateP2TR(s.musig2.OutputKey, s.network)
+	if err != nil {
+		return
+	}
+	for i, in := range inputs {
+		if in.Address == addr {
+			psbt.Inputs[i].TapInternalKey = s.musig2.InternalKey
+			psbt.Inputs[i].MuSig2Participants[string(s.musig2.AggregateKey)] = s.musig2.Participants
+		}
+	}
+	for i, out := range outputs {
+		if out.Address == addr {
+			psbt.Outputs[i].TapInternalKey = s.musig2.InternalKey
+			psbt.Outputs[i].MuSig2Participants[string(s.musig2.AggregateKey)] = s.musig2.Participants
+		}
+	}
+}
+
+// MuSig2InputStatus reports how far the two-round MuSig2 signing flow has got
+// for one PSBT input: round 1 collects every participant's public nonce,
+// round 2 their partial signatures, and round 0 means the aggregate signature
+// is in place.
+type MuSig2InputStatus struct {
+	Input              int      `json:"input"`
+	AggregateKey       string   `json:"aggregate_key"`
+	Round              int      `json:"round"`
+	MissingNonces      []string `json:"missing_nonces,omitempty"`       // Participants yet to send a public nonce
+	MissingPartialSigs []string `json:"missing_partial_sigs,omitempty"` // Participants yet to send a partial signature
+}
+
+// MuSig2Status lists the signing progress of every MuSig2 key-path input.
+func (psbt *PSBT) MuSig2Status() []MuSig2InputStatus {
+	var st []MuSig2InputStatus
+	for i, in := range psbt.Inputs {
+		aggs := make([]string, 0, len(in.MuSig2Participants))
+		for agg := range in.MuSig2Participants {
+			aggs = append(aggs, agg)
+		}
+		sort.Strings(aggs)
+		for _, agg := range aggs {
+			s := MuSig2InputStatus{Input: i, AggregateKey: hex.EncodeToString([]byte(agg))}
+			for _, pk := range in.MuSig2Participants[agg] {
+				k := string(pk) + agg
+				if _, ok := in.MuSig2PubNonces[k]; !ok {
+					s.MissingNonces = append(s.MissingNonces, hex.EncodeToString(pk))
+				}
+				if _, ok := in.MuSig2PartialSigs[k]; !ok {
+					s.MissingPartialSigs = append(s.MissingPartialSigs, hex.EncodeToString(pk))
+				}
+			}
+			switch {
+			case len(in.TapKeySig) > 0 || len(in.FinalScriptWitness) > 0:
+				s.Round, s.MissingNonces, s.MissingPartialSigs = 0, nil, nil
+			case len(s.MissingNonces) > 0:
+				s.Round = 1
+			default:
+				s.Round = 2
+			}
+			st = append(st, s)
+		}
+	}
+	return st
+}
+
+// Number of MuSig2 cosigners for settings snapshots
+func (s *Sweeper) musig2Participants() int {
+	if s.musig2 == nil {
+		return 0
+	}
+	return len(s.musig2.Participants)
+}
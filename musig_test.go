@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// BIP-327 key_agg_vectors.json public keys
+var musigTestKeys = []string{
+	"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+	"03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+	"023590A94E768F8E1815C2F24B4D80A8E3149316C3518CE7B7AD338368D038CA66",
+}
+
+func musigKeys(t *testing.T, idx ...int) [][]byte {
+	t.Helper()
+	var out [][]byte
+	for _, i := range idx {
+		b, err := hex.DecodeString(musigTestKeys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func TestKeyAggVectors(t *testing.T) {
+	cases := []struct {
+		idx  []int
+		want string
+	}{
+		{[]int{0, 1, 2}, "90539EEDE565F5D054F32CC0C220126889ED1E5D193BAF15AEF344FE59D4610C"},
+		{[]int{2, 1, 0}, "6204DE8B083426DC6EAF9502D27024D53FC826BF7D2012148A0575435DF54B2B"},
+		{[]int{0, 0, 0}, "B436E3BAD62B8CD409969A224731C193D051162D8C5AE8B109306127DA3AA935"},
+		{[]int{0, 0, 1, 1}, "69BC22BFA5D106306E48A20679DE1D7389386124D07571D0D872686028C26A3E"},
+	}
+	for _, c := range cases {
+		q, err := keyAgg(musigKeys(t, c.idx...))
+		if err != nil {
+			t.Fatalf("keyAgg(%v): %v", c.idx, err)
+		}
+		if got := strings.ToUpper(hex.EncodeToString(q.x.FillBytes(make([]byte, 32)))); got != c.want {
+			t.Fatalf("keyAgg(%v) = %s, want %s", c.idx, got, c.want)
+		}
+	}
+}
+
+func TestAggregateMuSig2KeysSortsAndTweaks(t *testing.T) {
+	a, err := AggregateMuSig2Keys(musigKeys(t, 0, 1, 2))
+	if err != nil {
+		t.Fatalf("AggregateMuSig2Keys: %v", err)
+	}
+	b, _ := AggregateMuSig2Keys(musigKeys(t, 2, 0, 1))
+	if !bytes.Equal(a.OutputKey, b.OutputKey) || !bytes.Equal(a.AggregateKey, b.AggregateKey) {
+		t.Fatalf("aggregate depends on participant order")
+	}
+	if hex.EncodeToString(a.InternalKey) != "789d937bade6673538f3e28d8368dda4d0512f94da44cf477a505716d26a1575" {
+		t.Fatalf("unexpected internal key %x", a.InternalKey)
+	}
+	if hex.EncodeToString(a.OutputKey) != "79e6c3e628c9bfbce91de6b7fb28e2aec7713d377cf260ab599dcbc40e542312" {
+		t.Fatalf("unexpected output key %x", a.OutputKey)
+	}
+	if _, err := AggregateMuSig2Keys(musigKeys(t, 0)); err == nil {
+		t.Fatalf("expected a single participant to be rejected")
+	}
+	if _, err := ParseMuSig2Participants([]string{musigTestKeys[0], "02" + strings.Repeat("00", 32)}); err == nil {
+		t.Fatalf("expected an invalid point to be rejected")
+	}
+}
+
+func TestMuSig2ChangeKeyPSBTFlow(t *testing.T) {
+	keys := musigKeys(t, 0, 1, 2)
+	s := mustNewSweeper(t, keys[0], BitcoinMainnet)
+	if err := s.SetMuSig2ChangeKey(keys); err != nil {
+		t.Fatalf("SetMuSig2ChangeKey: %v", err)
+	}
+	k := s.MuSig2ChangeKey()
+	addr, _ := CreateP2TR(k.OutputKey, BitcoinMainnet)
+	if err := s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 200_000, Address: addr, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	dest, _ := CreateP2TR(musigKeys(t, 2)[0][1:], BitcoinMainnet)
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Change) != 1 || plan.Change[0].Address != addr {
+		t.Fatalf("expected change to the MuSig2 address, got %+v", plan.Change)
+	}
+	if plan.Settings.MuSig2Participants != 3 {
+		t.Fatalf("settings record %d participants, want 3", plan.Settings.MuSig2Participants)
+	}
+
+	parsed, err := ParsePSBT(plan.PSBT.Serialize())
+	if err != nil {
+		t.Fatalf("ParsePSBT: %v", err)
+	}
+	in := &parsed.Inputs[0]
+	if !bytes.Equal(in.TapInternalKey, k.InternalKey) || len(in.MuSig2Participants[string(k.AggregateKey)]) != 3 {
+		t.Fatalf("input lacks internal key or participants")
+	}
+	out := parsed.Outputs[plan.ChangeIdxs[0]]
+	if !bytes.Equal(out.TapInternalKey, k.InternalKey) || len(out.MuSig2Participants[string(k.AggregateKey)]) != 3 {
+		t.Fatalf("change output lacks internal key or participants")
+	}
+
+	// Round 1: nonces; round 2: partial signatures; then done
+	st := parsed.MuSig2Status()
+	if len(st) != 1 || st[0].Round != 1 || len(st[0].MissingNonces) != 3 {
+		t.Fatalf("unexpected initial status %+v", st)
+	}
+	for _, pk := range k.Participants {
+		in.MuSig2PubNonces[string(pk)+string(k.AggregateKey)] = make([]byte, 66)
+	}
+	parsed, _ = ParsePSBT(parsed.Serialize())
+	in = &parsed.Inputs[0]
+	if st := parsed.MuSig2Status(); st[0].Round != 2 || len(st[0].MissingPartialSigs) != 3 {
+		t.Fatalf("expected round 2 after nonces, got %+v", st)
+	}
+	for _, pk := range k.Participants[:2] {
+		in.MuSig2PartialSigs[string(pk)+string(k.AggregateKey)] = make([]byte, 32)
+	}
+	if st := parsed.MuSig2Status(); st[0].Round != 2 || len(st[0].MissingPartialSigs) != 1 {
+		t.Fatalf("expected one missing partial signature, got %+v", st)
+	}
+	in.TapKeySig = make([]byte, 64)
+	if st := parsed.MuSig2Status(); st[0].Round != 0 {
+		t.Fatalf("expected signing complete, got %+v", st)
+	}
+
+	// A plain taproot key replaces the MuSig2 aggregate
+	if err := s.SetTaprootChangeKey(k.InternalKey); err != nil || s.MuSig2ChangeKey() != nil {
+		t.Fatalf("SetTaprootChangeKey should clear the MuSig2 key: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains address network detection and mismatch hints.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNetworkMismatch is wrapped by errors for addresses of another network.
+var ErrNetworkMismatch = errors.New("address network mismatch")
+
+// NetworkOf returns the network addr belongs to. Legacy addresses whose
+// version byte several networks share (m/n... on the test networks) report
+// the sweeper's own network when it is one of them.
+func (s *Sweeper) NetworkOf(addr string) (Network, error) {
+	if dec, err := s.decodeAddress(addr); err == nil {
+		if dec.OnNetwork(s.network) {
+			return s.network, nil
+		}
+		return dec.Network, nil
+	}
+	if isSilentPaymentAddress(addr) {
+		sp, err := DecodeSilentPaymentAddress(addr)
+		if err != nil {
+			return 0, err
+		}
+		return sp.Network, nil
+	}
+	return 0, fmt.Errorf("cannot tell the network of %q - not a bech32, bech32m, base58 or silent payment address", addr)
+}
+
+// Check that an address decoded as dec (nil for scripts the sweeper cannot
+// place, such as custom templates) is on the sweeper's network
+func (s *Sweeper) checkAddressNetwork(addr string, dec *Address) error {
+	if dec == nil || dec.OnNetwork(s.network) {
+		return nil
+	}
+	return s.networkMismatch(addr, dec.Network)
+}
+
+// Mismatch error naming the network addr belongs to and how to fix the config
+func (s *Sweeper) networkMismatch(addr string, actual Network) error {
+	hint := fmt.Sprintf("set \"network\": %q in the config if that is intended, or use a %s address", actual.String(), s.network)
+	if dec, err := DecodeAddress(addr); err == nil && dec.Type == P2PKH {
+		var shared []string
+		for _, n := range []Network{BitcoinMainnet, BitcoinTestnet, LitecoinMainnet, LitecoinTestnet, BitcoinRegtest} {
+			if dec.OnNetwork(n) {
+				shared = append(shared, n.String())
+			}
+		}
+		if len(shared) > 1 {
+			hint += " (legacy addresses with this prefix are valid on " + strings.Join(shared, ", ") + ")"
+		}
+	} else if actual == BitcoinTestnet {
+		hint += " (signet and testnet4 share testnet's tb1 addresses: use bitcoin_testnet for them too)"
+	}
+	return fmt.Errorf("%w: %s is a %s address but the sweeper is on %s - %s", ErrNetworkMismatch, addr, actual, s.network, hint)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNetworkMismatchNamesTheAddressNetwork(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	h := Hash160(pub)
+	tb, _ := CreateP2WPKH(h, BitcoinTestnet)
+	ltc, _ := CreateP2TR(make([]byte, 32), LitecoinMainnet)
+	legacy, _ := CreateP2PKH(h, BitcoinTestnet)
+	mainnet, _ := CreateP2WPKH(h, BitcoinMainnet)
+
+	cases := []struct {
+		addr string
+		want Network
+	}{
+		{tb, BitcoinTestnet},
+		{ltc, LitecoinMainnet},
+		{legacy, BitcoinTestnet},
+		{mainnet, BitcoinMainnet},
+	}
+	for _, c := range cases {
+		if n, err := s.NetworkOf(c.addr); err != nil || n != c.want {
+			t.Fatalf("NetworkOf(%s) = %s, %v; want %s", c.addr, n, err, c.want)
+		}
+	}
+	if _, err := s.NetworkOf("not-an-address"); err == nil {
+		t.Fatalf("expected an undecodable address to be refused")
+	}
+	// Legacy test addresses report the sweeper's network when they fit it
+	r := mustNewSweeper(t, pub, BitcoinRegtest)
+	if n, _ := r.NetworkOf(legacy); n != BitcoinRegtest {
+		t.Fatalf("NetworkOf(legacy) on regtest = %s", n)
+	}
+
+	_, err := s.Spend([]TxOutput{{Address: tb, ValueSats: 10_000}})
+	if !errors.Is(err, ErrNetworkMismatch) || !strings.Contains(err.Error(), `"bitcoin_testnet"`) || !strings.Contains(err.Error(), "signet") {
+		t.Fatalf("Spend to a testnet address: %v", err)
+	}
+	_, err = s.ConsolidateAll(legacy)
+	if !errors.Is(err, ErrNetworkMismatch) || !strings.Contains(err.Error(), "bitcoin_regtest") {
+		t.Fatalf("ConsolidateAll to a legacy testnet address: %v", err)
+	}
+	if err := s.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: 0, ValueSats: 50_000, Address: tb, Confirmed: true}); !errors.Is(err, ErrNetworkMismatch) {
+		t.Fatalf("Index of a testnet coin: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains offline planning from coins supplied with their raw
+// previous transactions.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// RawUTXO is a coin given as its full previous transaction and output index,
+// for planning on an air-gapped machine with no backend to ask. Value and
+// address are read from the transaction itself.
+type RawUTXO struct {
+	RawTx         string `json:"raw_tx"` // Previous transaction, hex
+	Vout          uint32 `json:"vout"`
+	Confirmations int    `json:"confirmations,omitempty"` // 0 = unconfirmed
+	BlockHeight   int64  `json:"block_height,omitempty"`
+}
+
+// SetOfflineMode makes the sweeper trust only coins whose previous
+// transactions it holds: Index refuses any UTXO not supplied with IndexRaw, or
+// whose value or address disagrees with its transaction. Offline mode cannot
+// be turned on while a chain tip, mempool, previous transaction, merkle proof
+// or fee rate source is set, so planning never reaches for the network.
+func (s *Sweeper) SetOfflineMode(enabled bool) error {
+	if enabled {
+		var sources []string
+		if s.chain != nil {
+			sources = append(sources, "chain info (SetChainInfo)")
+		}
+		if s.mempool != nil {
+			sources = append(sources, "mempool (SetMempoolSource)")
+		}
+		if s.prevTxSource != nil {
+			sources = append(sources, "previous transactions (SetPrevTxSource)")
+		}
+		if s.feeProvider != nil {
+			sources = append(sources, "fee rates (SetFeeRateProvider)")
+		}
+		if s.merkleProofs != nil {
+			sources = append(sources, "merkle proofs (SetMerkleVerification)")
+		}
+		if len(sources) > 0 {
+			return fmt.Errorf("offline mode needs every backend source removed, still set: %s", strings.Join(sources, ", "))
+		}
+	}
+	s.offline = enabled
+	return nil
+}
+
+// IndexRaw parses a coin's previous transaction, derives the UTXO from the
+// output at Vout and indexes it. The transaction is kept for the PSBT, so
+// legacy inputs need no PrevTxSource and SegWit v0 inputs carry it for
+// signers that check amounts against it.
+func (s *Sweeper) IndexRaw(r RawUTXO) (UTXO, error) {
+	b, err := hex.DecodeString(r.RawTx)
+	if err != nil {
+		return UTXO{}, fmt.Errorf("raw transaction is not hex: %w", err)
+	}
+	tx, err := DeserializeMsgTx(b)
+	if err != nil {
+		return UTXO{}, fmt.Errorf("raw transaction: %w", err)
+	}
+	txid := tx.TxID()
+	if int(r.Vout) >= len(tx.TxOut) {
+		return UTXO{}, fmt.Errorf("transaction %s has no output %d", txid, r.Vout)
+	}
+	out := tx.TxOut[r.Vout]
+	addr, ok := scriptAddress(out.PkScript, s.network)
+	if !ok {
+		return UTXO{}, fmt.Errorf("output %s:%d pays a script with no %s address", txid, r.Vout, s.network)
+	}
+	u := UTXO{
+		TxID:          txid,
+		Vout:          r.Vout,
+		ValueSats:     out.Value,
+		Address:       addr,
+		Confirmed:     r.Confirmations > 0,
+		Confirmations: r.Confirmations,
+		BlockHeight:   r.BlockHeight,
+	}
+	if s.prevTxs == nil {
+		s.prevTxs = map[string]*MsgTx{}
+	}
+	s.prevTxs[txid] = tx
+	if err := s.Index(u); err != nil {
+		return UTXO{}, err
+	}
+	return u, nil
+}
+
+// In offline mode, check a UTXO against the previous transaction it was
+// supplied with
+func (s *Sweeper) verifyOffline(u UTXO) error {
+	if !s.offline {
+		return nil
+	}
+	tx, ok := s.prevTxs[u.TxID]
+	if !ok {
+		return fmt.Errorf("offline mode: %s was not supplied with its raw transaction - use IndexRaw", outpointKey(u))
+	}
+	if err := s.matchPrevOut(u, tx); err != nil {
+		return fmt.Errorf("offline mode: %w of its raw transaction", err)
+	}
+	return nil
+}
+
+// Check that tx has the UTXO's output, paying its value to its address
+func (s *Sweeper) matchPrevOut(u UTXO, tx *MsgTx) error {
+	if int(u.Vout) >= len(tx.TxOut) {
+		return fmt.Errorf("%s has no output %d", outpointKey(u), u.Vout)
+	}
+	script, err := s.buildOutputScript(u.Address)
+	if err != nil {
+		return err
+	}
+	out := tx.TxOut[u.Vout]
+	if out.Value != u.ValueSats || !bytes.Equal(out.PkScript, script) {
+		return fmt.Errorf("%s does not match output %d", outpointKey(u), u.Vout)
+	}
+	return nil
+}
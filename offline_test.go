@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestOfflineSweepFromRawTransactions(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	wpkh, _ := CreateP2WPKH(Hash160(pub), BitcoinMainnet)
+
+	prev := NewMsgTx(2)
+	prev.AddTxIn(TxIn{Sequence: 0xffffffff})
+	prev.AddTxOut(TxOut{Value: 120_000, PkScript: BuildP2WPKHScript(Hash160(pub))})
+	prev.AddTxOut(TxOut{Value: 80_000, PkScript: BuildP2PKHScript(Hash160(pub))})
+	prev.AddTxOut(TxOut{Value: 50_000, PkScript: []byte{0x6a, 0x01, 0x00}})
+	raw := hex.EncodeToString(prev.Serialize(true))
+	txid := prev.TxID()
+
+	s.SetChainInfo(&fixedTip{height: 800_000})
+	if err := s.SetOfflineMode(true); err == nil || !strings.Contains(err.Error(), "SetChainInfo") {
+		t.Fatalf("expected the chain source to block offline mode, got %v", err)
+	}
+	s.SetChainInfo(nil)
+	if err := s.SetOfflineMode(true); err != nil {
+		t.Fatalf("SetOfflineMode: %v", err)
+	}
+
+	// Reported coins are refused; only supplied transactions count
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), ValueSats: 50_000, Address: wpkh, Confirmed: true}); err == nil {
+		t.Fatalf("expected a coin without its raw transaction to be refused")
+	}
+	if _, err := s.IndexRaw(RawUTXO{RawTx: raw, Vout: 2, Confirmations: 3}); err == nil {
+		t.Fatalf("expected a null-data output to be refused")
+	}
+	for vout := uint32(0); vout < 2; vout++ {
+		if _, err := s.IndexRaw(RawUTXO{RawTx: raw, Vout: vout, Confirmations: 3}); err != nil {
+			t.Fatalf("IndexRaw %d: %v", vout, err)
+		}
+	}
+	if err := s.Index(UTXO{TxID: txid, Vout: 0, ValueSats: 900_000, Address: wpkh, Confirmed: true}); err == nil {
+		t.Fatalf("expected a value that disagrees with the transaction to be refused")
+	}
+	got := s.GetIndexedUTXOs()
+	if len(got) != 2 || got[0].ValueSats != 120_000 || got[0].Address != wpkh || got[1].Address != legacyTestAddr {
+		t.Fatalf("unexpected index %+v", got)
+	}
+
+	plan, err := s.ConsolidateAll(wpkh)
+	if err != nil {
+		t.Fatalf("ConsolidateAll: %v", err)
+	}
+	for i, in := range plan.PSBT.Inputs {
+		if in.NonWitnessUtxo == nil || in.NonWitnessUtxo.TxID() != txid {
+			t.Fatalf("input %d lacks its previous transaction", i)
+		}
+		// SegWit inputs keep their witness UTXO; legacy ones carry only the transaction
+		if legacy := plan.Inputs[i].Address == legacyTestAddr; legacy != (in.WitnessUtxo == nil) {
+			t.Fatalf("input %d: witness UTXO %+v", i, in.WitnessUtxo)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains opportunistic consolidation during low-fee spends.
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SetOpportunisticConsolidation makes automatically selected spends planned
+// at or below maxFeeRate sat/vB also sweep in up to maxExtraInputs of the
+// smallest confirmed UTXOs the payment does not need, folding them into the
+// change: the UTXO set shrinks while inputs are cheap instead of in a later
+// consolidation at whatever the fee is then. Coins worth less than their
+// spending cost are never added, and coin control (SpendFrom) and changeless
+// branch-and-bound matches are left alone. A zero count disables it (the
+// default); a zero rate uses the long-term fee rate (SetLongTermFeeRate) and
+// disables it when that is unset. SetOpportunisticConsolidationKVB takes
+// fractional rates.
+func (s *Sweeper) SetOpportunisticConsolidation(maxFeeRate int64, maxExtraInputs int) error {
+	if maxFeeRate < 0 || maxExtraInputs < 0 {
+		return fmt.Errorf("opportunistic consolidation needs a non-negative fee rate and input count (got %d sat/vB, %d inputs)", maxFeeRate, maxExtraInputs)
+	}
+	return s.SetOpportunisticConsolidationKVB(SatPerVByte(maxFeeRate), maxExtraInputs)
+}
+
+// SetOpportunisticConsolidationKVB is SetOpportunisticConsolidation with the
+// threshold in sat/kvB, e.g. 1500 for 1.5 sat/vB.
+func (s *Sweeper) SetOpportunisticConsolidationKVB(maxFeeRate FeeRate, maxExtraInputs int) error {
+	if maxFeeRate < 0 || maxExtraInputs < 0 {
+		return fmt.Errorf("opportunistic consolidation needs a non-negative fee rate and input count (got %d sat/kvB, %d inputs)", maxFeeRate, maxExtraInputs)
+	}
+	s.consolidateFeeRate, s.consolidateMaxExtra = maxFeeRate, maxExtraInputs
+	return nil
+}
+
+// Add spare small confirmed candidates to a selection when fees are low;
+// returns the new selection, its value and the fee with one change output
+func (s *Sweeper) addConsolidationInputs(selected []UTXO, totalIn int64, utxos []UTXO, nFixedOutputs int, p spendParams) ([]UTXO, int64, int64) {
+	fee := p.feeRate.Fee(s.selectionVBytes(selected, nFixedOutputs+1))
+	threshold := s.consolidateFeeRate
+	if threshold == 0 {
+		threshold = s.longTermFeeRate
+	}
+	if s.consolidateMaxExtra <= 0 || threshold <= 0 || p.feeRate > threshold {
+		return selected, totalIn, fee
+	}
+	taken := make(map[string]bool, len(selected))
+	for _, u := range selected {
+		taken[outpointKey(u)] = true
+	}
+	var spare []UTXO
+	for _, u := range s.candidates(utxos, p) {
+		if u.Confirmed && !taken[outpointKey(u)] && !s.uneconomical(u, p.feeRate) {
+			spare = append(spare, u)
+		}
+	}
+	sort.SliceStable(spare, func(i, j int) bool { return spare[i].ValueSats < spare[j].ValueSats })
+	limit := s.consolidateMaxExtra
+	if s.maxInputs > 0 && s.maxInputs-len(selected) < limit {
+		limit = s.maxInputs - len(selected)
+	}
+	if len(spare) > limit {
+		spare = spare[:limit]
+	}
+	if len(spare) == 0 {
+		return selected, totalIn, fee
+	}
+	out := append(append([]UTXO{}, selected...), spare...)
+	for _, u := range spare {
+		totalIn += u.ValueSats
+	}
+	s.logger.Printf("low fee rate %s: consolidating %d extra inputs", p.feeRate, len(spare))
+	return out, totalIn, p.feeRate.Fee(s.selectionVBytes(out, nFixedOutputs+1))
+}
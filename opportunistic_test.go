@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestOpportunisticConsolidationAtLowFees(t *testing.T) {
+	s := newTestSweeper(t, WithOpportunisticConsolidation(5, 2))
+	for i, v := range []int64{7_000, 5_000, 200_000, 6_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: uint32(i), ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}}
+	largest := SpendOptions{Selection: SelectLargestFirst}
+
+	plan, err := s.Spend(out, largest)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 3 || plan.Inputs[1].ValueSats != 5_000 || plan.Inputs[2].ValueSats != 6_000 {
+		t.Fatalf("expected the two smallest spare coins swept in, got %+v", plan.Inputs)
+	}
+	want := 211_000 - 150_000 - plan.FeeSats
+	if ch := plan.Outputs[plan.ChangeIdxs[0]].ValueSats; ch != want || plan.Settings.ConsolidateMaxExtra != 2 {
+		t.Fatalf("change %d, want %d", ch, want)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	// Above the threshold the payment spends only what it needs
+	plan, err = s.Spend(out, largest, SpendOptions{FeeRate: 6})
+	if err != nil || len(plan.Inputs) != 1 {
+		t.Fatalf("Spend at 6 sat/vB: %+v, %v", plan, err)
+	}
+	if err := s.SetOpportunisticConsolidation(-1, 2); err == nil {
+		t.Fatalf("expected a negative fee rate to be refused")
+	}
+}
+
+func TestOpportunisticConsolidationKVB(t *testing.T) {
+	s := newTestSweeper(t, WithOpportunisticConsolidationKVB(FeeRateFromSatPerVB(1.5), 1))
+	for i, v := range []int64{5_000, 200_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat("cd", 32), Vout: uint32(i), ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}}
+	plan, err := s.Spend(out, SpendOptions{FeeRateKVB: 1500, Selection: SelectLargestFirst})
+	if err != nil || len(plan.Inputs) != 2 {
+		t.Fatalf("Spend at 1.5 sat/vB: %+v, %v", plan, err)
+	}
+	if plan.Settings.ConsolidateRateKVB != 1500 || plan.Settings.ConsolidateFeeRate != 2 {
+		t.Fatalf("threshold recorded as %d sat/kvB, %d sat/vB", plan.Settings.ConsolidateRateKVB, plan.Settings.ConsolidateFeeRate)
+	}
+	_ = s.DiscardPlan(plan.ID)
+	if plan, err = s.Spend(out, SpendOptions{FeeRateKVB: 1501, Selection: SelectLargestFirst}); err != nil || len(plan.Inputs) != 1 {
+		t.Fatalf("Spend above 1.5 sat/vB: %+v, %v", plan, err)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	// The config keeps fractional thresholds
+	c := DefaultConfig()
+	c.ConsolidateBelowFeeRate, c.ConsolidateMaxExtraInputs = 1.5, 1
+	s2 := newTestSweeper(t)
+	if err := c.ApplyToSweeper(s2); err != nil || s2.consolidateFeeRate != 1500 {
+		t.Fatalf("ApplyToSweeper: %d sat/kvB, %v", s2.consolidateFeeRate, err)
+	}
+	if err := s.SetOpportunisticConsolidationKVB(-1, 1); err == nil {
+		t.Fatalf("expected a negative fee rate to be refused")
+	}
+}
@@ -0,0 +1,292 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains functional options for Sweeper construction and validation.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Logger receives diagnostic messages from the Sweeper. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// nopLogger discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...any) {}
+
+// Option configures a Sweeper in NewSweeper. Options are applied in order and
+// the complete configuration is validated once afterwards.
+type Option func(*Sweeper)
+
+// WithFeeRate sets the default fee rate in whole sat/vB.
+func WithFeeRate(satsPerVB int64) Option {
+	return func(s *Sweeper) { s.feeRate = SatPerVByte(satsPerVB) }
+}
+
+// WithFeeRateKVB sets the default fee rate in sat/kvB, e.g. 1500 for 1.5 sat/vB.
+func WithFeeRateKVB(rate FeeRate) Option {
+	return func(s *Sweeper) { s.feeRate = rate }
+}
+
+// WithFeeGuard sets the outlier check applied by UpdateFeeRate.
+func WithFeeGuard(g *FeeGuard) Option {
+	return func(s *Sweeper) { s.feeGuard = g }
+}
+
+// WithKV sets the store used for persisted state.
+func WithKV(kv KV) Option {
+	return func(s *Sweeper) { s.kv = kv }
+}
+
+// WithDustPolicy sets the policy deciding the dust threshold per script type.
+func WithDustPolicy(p DustPolicy) Option {
+	return func(s *Sweeper) { s.dustPolicy = p }
+}
+
+// WithUnconfirmedPolicy sets whether unconfirmed UTXOs may be spent, how many
+// per transaction, and the maximum unconfirmed chain depth.
+func WithUnconfirmedPolicy(allow bool, maxInputs, maxDepth int) Option {
+	return func(s *Sweeper) {
+		s.allowUnconfirmed = allow
+		s.maxUnconfInputs = maxInputs
+		s.maxChainDepth = maxDepth
+	}
+}
+
+// WithChangeSplit splits change into parts of about targetChunkSats, each at least minChunkSats.
+func WithChangeSplit(parts int, targetChunkSats, minChunkSats int64) Option {
+	return func(s *Sweeper) {
+		s.changeSplitParts = parts
+		s.targetChunkSats = targetChunkSats
+		s.minChunkSats = minChunkSats
+	}
+}
+
+// WithUTXOFilter adds a named hook that can veto coins during selection.
+func WithUTXOFilter(name string, f UTXOFilterFunc) Option {
+	return func(s *Sweeper) { s.utxoFilters = append(s.utxoFilters, namedFilter{name: name, fn: f}) }
+}
+
+// WithMaxOutputsPerTx caps recipient plus change outputs per transaction (0 = unlimited).
+func WithMaxOutputsPerTx(n int) Option {
+	return func(s *Sweeper) { s.maxOutputsPerTx = n }
+}
+
+// WithChangelessTolerance sets the excess given to the fee instead of making
+// change (see SetChangelessTolerance).
+func WithChangelessTolerance(sats int64) Option {
+	return func(s *Sweeper) { s.changelessTolerance = sats }
+}
+
+// WithOpportunisticConsolidation sweeps spare small coins into spends at low
+// fee rates (see SetOpportunisticConsolidation).
+func WithOpportunisticConsolidation(maxFeeRate int64, maxExtraInputs int) Option {
+	return func(s *Sweeper) {
+		s.consolidateFeeRate, s.consolidateMaxExtra = SatPerVByte(maxFeeRate), maxExtraInputs
+	}
+}
+
+// WithOpportunisticConsolidationKVB is WithOpportunisticConsolidation with the
+// threshold in sat/kvB, e.g. 1500 for 1.5 sat/vB.
+func WithOpportunisticConsolidationKVB(maxFeeRate FeeRate, maxExtraInputs int) Option {
+	return func(s *Sweeper) { s.consolidateFeeRate, s.consolidateMaxExtra = maxFeeRate, maxExtraInputs }
+}
+
+// WithFeeCaps caps the absolute fee and fee rate of every plan (see
+// SetFeeLimits and SetMaxFeeRate; 0 = unlimited).
+func WithFeeCaps(maxFeeSats int64, maxFeeRate FeeRate) Option {
+	return func(s *Sweeper) { s.maxFeeSats, s.maxFeeRate = maxFeeSats, maxFeeRate }
+}
+
+// WithInputCountLimits bounds the inputs per transaction (see SetInputCountLimits).
+func WithInputCountLimits(minInputs, maxInputs int) Option {
+	return func(s *Sweeper) { s.minInputs, s.maxInputs = minInputs, maxInputs }
+}
+
+// WithMaturityPolicy holds back freshly received confirmed coins by value
+// tier (see SetMaturityPolicy).
+func WithMaturityPolicy(tiers []MaturityTier) Option {
+	return func(s *Sweeper) { s.maturityTiers = tiers }
+}
+
+// WithConfirmedFirst orders confirmed candidates before unconfirmed ones (see SetConfirmedFirst).
+func WithConfirmedFirst(on bool) Option {
+	return func(s *Sweeper) { s.confirmedFirst = on }
+}
+
+// WithTxVersion sets the nVersion of planned transactions (1, 2 or 3 for TRUC).
+func WithTxVersion(v int32) Option {
+	return func(s *Sweeper) { s.txVersion = v }
+}
+
+// WithSelection sets the default coin selection order (see SetSelectionStrategy).
+func WithSelection(st SelectionStrategy) Option {
+	return func(s *Sweeper) { s.selection = st }
+}
+
+// WithTestMode enables test mode (see SetTestMode).
+//
+// Deprecated: use BitcoinRegtest, MockBackend and WithOwnershipValidator.
+func WithTestMode(enabled bool) Option {
+	return func(s *Sweeper) { s.testMode = enabled }
+}
+
+// WithPubKeyCheck enables or disables checking UTXO addresses against the public key.
+func WithPubKeyCheck(enabled bool) Option {
+	return func(s *Sweeper) { s.enforcePubKey = enabled }
+}
+
+// WithOwnershipValidator replaces the public key check on indexed UTXOs (see
+// SetOwnershipValidator).
+func WithOwnershipValidator(v OwnershipValidator) Option {
+	return func(s *Sweeper) { s.ownershipCheck = v }
+}
+
+// WithLogger sets where diagnostic messages go (default: discarded).
+func WithLogger(l Logger) Option {
+	return func(s *Sweeper) { s.logger = l }
+}
+
+// WithOpts applies every setting of o that is not zero, and AllowUnconfirmed
+// as given. Dust fields left zero keep those of a FixedDustPolicy already set.
+//
+// Unconfirmed spending is on by default, so a false AllowUnconfirmed is a real
+// setting: it turns off unconfirmed spending enabled by an earlier option such
+// as WithUnconfirmedPolicy. Pass WithOpts first to let later options refine it.
+func WithOpts(o Opts) Option {
+	return func(s *Sweeper) {
+		if o.FeeRateKVB != 0 {
+			s.feeRate = o.FeeRateKVB
+		} else if o.FeeRateSatsVB != 0 {
+			s.feeRate = SatPerVByte(o.FeeRateSatsVB)
+		}
+		if o.MinDustSats != 0 || o.MinUSD != 0 || o.PriceUSDPerBTC != 0 {
+			dust, _ := s.dustPolicy.(FixedDustPolicy)
+			if o.MinDustSats != 0 {
+				dust.MinSats = o.MinDustSats
+			}
+			if o.MinUSD != 0 {
+				dust.MinUSD = o.MinUSD
+			}
+			if o.PriceUSDPerBTC != 0 {
+				dust.PriceUSDPerBTC = o.PriceUSDPerBTC
+			}
+			s.dustPolicy = dust
+		}
+		s.allowUnconfirmed = o.AllowUnconfirmed
+		if o.MaxUnconfInputs != 0 {
+			s.maxUnconfInputs = o.MaxUnconfInputs
+		}
+		if o.MaxChainChildren != 0 {
+			s.maxChainDepth = o.MaxChainChildren
+		}
+		if o.ChangeSplitParts != 0 {
+			s.changeSplitParts = o.ChangeSplitParts
+		}
+		if o.TargetChunkSats != 0 {
+			s.targetChunkSats = o.TargetChunkSats
+		}
+		if o.MinChunkSats != 0 {
+			s.minChunkSats = o.MinChunkSats
+		}
+		if len(o.AllocationByWeights) > 0 {
+			s.allocationByWeights = append([]WeightedAddr(nil), o.AllocationByWeights...)
+		}
+		if o.MaxOutputsPerTx != 0 {
+			s.maxOutputsPerTx = o.MaxOutputsPerTx
+		}
+		if o.ChangelessToleranceSats != 0 {
+			s.changelessTolerance = o.ChangelessToleranceSats
+		}
+		if o.MinInputs != 0 {
+			s.minInputs = o.MinInputs
+		}
+		if o.MaxInputs != 0 {
+			s.maxInputs = o.MaxInputs
+		}
+		if o.MaxFeeSats != 0 || o.MaxFeeRate != 0 {
+			maxFeeSats, maxFeeRate := s.maxFeeSats, s.maxFeeRate
+			if o.MaxFeeSats != 0 {
+				maxFeeSats = o.MaxFeeSats
+			}
+			if o.MaxFeeRate != 0 {
+				maxFeeRate = o.MaxFeeRate
+			}
+			WithFeeCaps(maxFeeSats, maxFeeRate)(s)
+		}
+	}
+}
+
+// validate checks the complete configuration, reporting every problem found.
+func (s *Sweeper) validate() error {
+	var errs []error
+	if _, ok := networkConfigs[s.network]; !ok {
+		errs = append(errs, fmt.Errorf("unknown network %d", s.network))
+	}
+	if len(s.pubKey) != 0 && len(s.pubKey) != 33 {
+		errs = append(errs, fmt.Errorf("public key must be 33 bytes compressed (got %d)", len(s.pubKey)))
+	}
+	if s.feeRate <= 0 {
+		errs = append(errs, fmt.Errorf("fee rate must be positive (got %s)", s.feeRate))
+	}
+	if s.feeGuard != nil {
+		if err := s.feeGuard.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f, ok := s.dustPolicy.(FixedDustPolicy); ok {
+		if err := f.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	} else if s.dustPolicy == nil {
+		errs = append(errs, errors.New("dust policy must not be nil"))
+	}
+	if s.maxUnconfInputs < 0 || s.maxChainDepth < 0 {
+		errs = append(errs, errors.New("unconfirmed input and chain depth limits must be non-negative"))
+	}
+	if s.changeSplitParts < 0 || s.targetChunkSats < 0 || s.minChunkSats < 0 {
+		errs = append(errs, errors.New("change split settings must be non-negative"))
+	}
+	for _, f := range s.utxoFilters {
+		if f.name == "" || f.fn == nil {
+			errs = append(errs, errors.New("a UTXO filter needs a name and a function"))
+			break
+		}
+	}
+	if s.consolidateFeeRate < 0 || s.consolidateMaxExtra < 0 {
+		errs = append(errs, fmt.Errorf("opportunistic consolidation needs a non-negative fee rate and input count (got %d sat/kvB, %d inputs)", s.consolidateFeeRate, s.consolidateMaxExtra))
+	}
+	if s.maxFeeSats < 0 || s.maxFeeRate < 0 {
+		errs = append(errs, fmt.Errorf("fee caps must be non-negative (got %d sats, %d sat/kvB)", s.maxFeeSats, s.maxFeeRate))
+	}
+	if s.changelessTolerance < 0 {
+		errs = append(errs, fmt.Errorf("changeless tolerance must be non-negative (got %d)", s.changelessTolerance))
+	}
+	if s.maxOutputsPerTx < 0 || s.maxOutputsPerTx == 1 {
+		errs = append(errs, fmt.Errorf("max outputs per transaction must be 0 (unlimited) or at least 2 (got %d)", s.maxOutputsPerTx))
+	}
+	if err := validateInputCountLimits(s.minInputs, s.maxInputs); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.SetMaturityPolicy(s.maturityTiers); err != nil { // Also sorts the tiers
+		errs = append(errs, err)
+	}
+	if s.selection != "" {
+		if err := s.selection.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateTxVersion(s.txVersion); err != nil {
+		errs = append(errs, err)
+	}
+	if s.kv == nil {
+		errs = append(errs, errors.New("a KV store is required"))
+	}
+	if s.logger == nil {
+		errs = append(errs, errors.New("logger must not be nil"))
+	}
+	return errors.Join(errs...)
+}
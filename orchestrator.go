@@ -0,0 +1,290 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains consolidation of several wallets into one destination
+// under a shared fee budget, with paced broadcasts.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// defaultBroadcastSpacing separates orchestrated broadcasts: about one block,
+// so each consolidation has a chance to confirm before the next competes with
+// it for block space at the same fee rate.
+const defaultBroadcastSpacing = 10 * time.Minute
+
+// ConsolidationAccount is one wallet taking part in an orchestrated
+// consolidation. Each account keeps its own Sweeper, keys and KV store.
+type ConsolidationAccount struct {
+	Name    string
+	Sweeper *Sweeper
+}
+
+// ConsolidationOrchestrator consolidates several accounts into one shared
+// (usually cold) destination. Plan builds one consolidation per account and
+// keeps those that fit the fee budget and weight cap, preferring the ones that
+// move the most value per sat of fee; the others are discarded. Broadcasts are
+// then paced Spacing apart so the consolidations do not compete with each
+// other in the mempool.
+type ConsolidationOrchestrator struct {
+	Accounts      []ConsolidationAccount
+	Destination   string
+	FeeRate       int64         // sat/vB for every plan (0 = each account's own rate)
+	FeeRateKVB    FeeRate       // sat/kvB for every plan, e.g. 1500 for 1.5 sat/vB; wins over FeeRate
+	FeeBudgetSats int64         // Total fee across all plans (0 = unlimited)
+	MaxWeight     int64         // Total weight units across all plans (0 = unlimited)
+	Spacing       time.Duration // Time between broadcasts (0 = 10 minutes)
+}
+
+// OrchestratedPlan is an account's consolidation and its broadcast slot.
+type OrchestratedPlan struct {
+	Account        string           `json:"account"`
+	Plan           *TransactionPlan `json:"plan"`
+	Weight         int64            `json:"weight"`
+	BroadcastAfter time.Time        `json:"broadcast_after"`
+	BroadcastTxID  string           `json:"broadcast_txid,omitempty"` // Set once BroadcastDue sent it
+	BroadcastAt    *time.Time       `json:"broadcast_at,omitempty"`
+}
+
+// SkippedAccount is an account the orchestration left out, with the reason.
+type SkippedAccount struct {
+	Account string `json:"account"`
+	Reason  string `json:"reason"`
+}
+
+// Orchestration is the outcome of ConsolidationOrchestrator.Plan, in
+// broadcast order.
+type Orchestration struct {
+	Plans   []*OrchestratedPlan `json:"plans"`
+	Skipped []SkippedAccount    `json:"skipped,omitempty"`
+	FeeSats int64               `json:"fee_sats"`
+	Weight  int64               `json:"weight"`
+}
+
+// OrchestrationConfig is the config file's orchestration section, run by the
+// orchestrate command. Each account is planned with the top-level settings
+// and its own key, coins and store.
+type OrchestrationConfig struct {
+	Accounts      []OrchestrationAccountConfig `json:"accounts"`
+	Destination   string                       `json:"destination"`               // Shared (usually cold) destination
+	FeeRate       float64                      `json:"fee_rate,omitempty"`        // sat/vB for every plan, e.g. 1.5 (0 = fee_rate)
+	FeeBudgetSats int64                        `json:"fee_budget_sats,omitempty"` // Total fee across all plans (0 = unlimited)
+	MaxWeight     int64                        `json:"max_weight,omitempty"`      // Total weight units across all plans (0 = unlimited)
+	Spacing       string                       `json:"spacing,omitempty"`         // Time between broadcasts (Go duration, empty = 10m)
+}
+
+// OrchestrationAccountConfig is one wallet in the orchestration section.
+type OrchestrationAccountConfig struct {
+	Name      string `json:"name"`
+	PubKeyHex string `json:"pubkey_hex,omitempty"` // 33-byte compressed key the coins pay to
+	XPub      string `json:"xpub,omitempty"`       // Single-signature account xpub, with the top-level xpub_* settings
+	UTXOFile  string `json:"utxo_file"`            // UTXOs in the utxos.json format
+	KVPath    string `json:"kv_path,omitempty"`    // The account's own store (empty = in-memory)
+}
+
+// Validate checks that the section names its accounts and destination and
+// that its limits make sense.
+func (c *OrchestrationConfig) Validate() error {
+	if len(c.Accounts) == 0 {
+		return errors.New("no accounts to consolidate")
+	}
+	if c.Destination == "" {
+		return errors.New("no consolidation destination")
+	}
+	if FeeRateFromSatPerVB(c.FeeRate) < 0 || c.FeeBudgetSats < 0 || c.MaxWeight < 0 {
+		return fmt.Errorf("fee_rate, fee_budget_sats and max_weight must be non-negative (got %g, %d, %d)", c.FeeRate, c.FeeBudgetSats, c.MaxWeight)
+	}
+	if _, err := c.spacing(); err != nil {
+		return err
+	}
+	names, stores := map[string]bool{}, map[string]bool{}
+	for i, a := range c.Accounts {
+		switch {
+		case a.Name == "":
+			return fmt.Errorf("account %d has no name", i)
+		case names[a.Name]:
+			return fmt.Errorf("duplicate account name %q", a.Name)
+		case a.UTXOFile == "":
+			return fmt.Errorf("account %q has no utxo_file", a.Name)
+		case a.PubKeyHex == "" && a.XPub == "":
+			return fmt.Errorf("account %q needs pubkey_hex or xpub", a.Name)
+		case a.KVPath != "" && stores[a.KVPath]:
+			return fmt.Errorf("accounts share kv_path %q - each account needs its own store", a.KVPath)
+		}
+		if _, err := a.pubKey(); err != nil {
+			return fmt.Errorf("account %q: %w", a.Name, err)
+		}
+		names[a.Name], stores[a.KVPath] = true, true
+	}
+	return nil
+}
+
+// Parsed spacing (0 = the default)
+func (c *OrchestrationConfig) spacing() (time.Duration, error) {
+	if c.Spacing == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.Spacing)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("spacing must be a positive duration like \"10m\" (got %q)", c.Spacing)
+	}
+	return d, nil
+}
+
+// Decoded pubkey_hex, or nil when unset
+func (a *OrchestrationAccountConfig) pubKey() ([]byte, error) {
+	if a.PubKeyHex == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(a.PubKeyHex)
+	if err != nil || len(b) != 33 {
+		return nil, errors.New("pubkey_hex must be a 33-byte compressed public key in hex")
+	}
+	return b, nil
+}
+
+// validate rejects missing accounts and nonsensical limits
+func (o *ConsolidationOrchestrator) validate() error {
+	if len(o.Accounts) == 0 {
+		return errors.New("no accounts to consolidate")
+	}
+	if o.Destination == "" {
+		return errors.New("no consolidation destination")
+	}
+	if o.FeeRate < 0 || o.FeeRateKVB < 0 || o.FeeBudgetSats < 0 || o.MaxWeight < 0 || o.Spacing < 0 {
+		return errors.New("fee rate, fee budget, weight cap and spacing must be non-negative")
+	}
+	seen := map[string]bool{}
+	for i, a := range o.Accounts {
+		if a.Name == "" || a.Sweeper == nil {
+			return fmt.Errorf("account %d needs a name and a sweeper", i)
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("duplicate account name %q", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return nil
+}
+
+// Time between broadcasts
+func (o *ConsolidationOrchestrator) spacing() time.Duration {
+	if o.Spacing == 0 {
+		return defaultBroadcastSpacing
+	}
+	return o.Spacing
+}
+
+// Plan builds the consolidations, starting the broadcast schedule at start.
+// Accounts with nothing to consolidate, or whose plan does not fit the
+// remaining budget, are reported in Skipped.
+func (o *ConsolidationOrchestrator) Plan(start time.Time) (*Orchestration, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	res := &Orchestration{}
+	var built []*OrchestratedPlan
+	sweepers := map[string]*Sweeper{}
+	for _, a := range o.Accounts {
+		sweepers[a.Name] = a.Sweeper
+		plan, err := a.Sweeper.ConsolidateAll(o.Destination, SpendOptions{FeeRate: o.FeeRate, FeeRateKVB: o.FeeRateKVB})
+		if err != nil {
+			res.Skipped = append(res.Skipped, SkippedAccount{Account: a.Name, Reason: err.Error()})
+			continue
+		}
+		w := estimateTxVBytesDetailed(a.Sweeper, plan.Inputs, plan.Outputs) * 4
+		built = append(built, &OrchestratedPlan{Account: a.Name, Plan: plan, Weight: w})
+	}
+
+	// Most value moved per sat of fee first
+	sort.SliceStable(built, func(i, j int) bool {
+		pi, pj := built[i].Plan, built[j].Plan
+		return movesMorePerFee(sumOutputs(pi.Outputs), pi.FeeSats, sumOutputs(pj.Outputs), pj.FeeSats)
+	})
+	spacing := o.spacing()
+	for _, op := range built {
+		reason := ""
+		switch {
+		case o.FeeBudgetSats > 0 && res.FeeSats+op.Plan.FeeSats > o.FeeBudgetSats:
+			reason = fmt.Sprintf("fee of %d sats exceeds the remaining budget of %d sats", op.Plan.FeeSats, o.FeeBudgetSats-res.FeeSats)
+		case o.MaxWeight > 0 && res.Weight+op.Weight > o.MaxWeight:
+			reason = fmt.Sprintf("weight of %d WU exceeds the remaining cap of %d WU", op.Weight, o.MaxWeight-res.Weight)
+		}
+		if reason != "" {
+			if err := sweepers[op.Account].DiscardPlan(op.Plan.ID); err != nil {
+				return nil, discardOrchestrated(sweepers, built, fmt.Errorf("account %s: %w", op.Account, err))
+			}
+			res.Skipped = append(res.Skipped, SkippedAccount{Account: op.Account, Reason: reason})
+			continue
+		}
+		op.BroadcastAfter = start.Add(time.Duration(len(res.Plans)) * spacing).UTC()
+		res.Plans = append(res.Plans, op)
+		res.FeeSats += op.Plan.FeeSats
+		res.Weight += op.Weight
+	}
+	return res, nil
+}
+
+// Whether moving valueA for feeA beats valueB for feeB, compared as
+// valueA*feeB > valueB*feeA in 128 bits so large amounts cannot overflow
+func movesMorePerFee(valueA, feeA, valueB, feeB int64) bool {
+	hiA, loA := bits.Mul64(uint64(valueA), uint64(feeB))
+	hiB, loB := bits.Mul64(uint64(valueB), uint64(feeA))
+	return hiA > hiB || (hiA == hiB && loA > loB)
+}
+
+// Discard every plan still tracked after a failed orchestration, leaving the
+// accounts as Plan found them, and return cause with any further errors
+func discardOrchestrated(sweepers map[string]*Sweeper, built []*OrchestratedPlan, cause error) error {
+	errs := []error{cause}
+	for _, op := range built {
+		s := sweepers[op.Account]
+		if _, ok := s.GetPlan(op.Plan.ID); !ok {
+			continue
+		}
+		if err := s.DiscardPlan(op.Plan.ID); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", op.Account, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BroadcastDue broadcasts, through b, the signed plans whose slot has come at
+// now, in schedule order. A plan also waits Spacing after the previous one was
+// actually sent, so a late or resumed run does not release a backlog at once.
+// It stops at the first due plan that is unsigned or fails, keeping the plans
+// behind it in place, and returns how many it sent.
+func (o *ConsolidationOrchestrator) BroadcastDue(res *Orchestration, now time.Time, b Broadcaster) (int, error) {
+	sweepers := map[string]*Sweeper{}
+	for _, a := range o.Accounts {
+		sweepers[a.Name] = a.Sweeper
+	}
+	spacing := o.spacing()
+	sent := 0
+	var last *time.Time
+	for _, op := range res.Plans {
+		if op.BroadcastAt != nil {
+			last = op.BroadcastAt
+			continue
+		}
+		if now.Before(op.BroadcastAfter) || (last != nil && now.Before(last.Add(spacing))) {
+			break
+		}
+		s, ok := sweepers[op.Account]
+		if !ok {
+			return sent, fmt.Errorf("unknown account %q", op.Account)
+		}
+		txid, err := s.BroadcastPlan(op.Plan.ID, b)
+		if err != nil {
+			return sent, fmt.Errorf("account %s: %w", op.Account, err)
+		}
+		at := now.UTC()
+		op.BroadcastTxID, op.BroadcastAt, last = txid, &at, &at
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsolidationOrchestrator(t *testing.T) {
+	fund := func(values ...int64) *Sweeper {
+		s := newTestSweeper(t)
+		_ = s.SetFeeRate(5)
+		for i, v := range values {
+			_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 0, ValueSats: v, Address: testAddr("in"), Confirmed: true})
+		}
+		return s
+	}
+	hot, ops, small, empty := fund(400_000, 300_000), fund(50_000, 50_000, 50_000), fund(20_000), newTestSweeper(t)
+	o := &ConsolidationOrchestrator{
+		Accounts: []ConsolidationAccount{
+			{Name: "ops", Sweeper: ops}, {Name: "hot", Sweeper: hot},
+			{Name: "small", Sweeper: small}, {Name: "empty", Sweeper: empty},
+		},
+		Destination:   testAddr("cold"),
+		FeeBudgetSats: 1_500,
+		Spacing:       time.Hour,
+	}
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	res, err := o.Plan(start)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	// hot moves the most per fee sat; small fits the rest of the budget, ops does not
+	if len(res.Plans) != 2 || res.Plans[0].Account != "hot" || res.Plans[1].Account != "small" {
+		t.Fatalf("unexpected order %+v", res.Plans)
+	}
+	if !res.Plans[1].BroadcastAfter.Equal(start.Add(time.Hour)) || res.FeeSats > o.FeeBudgetSats {
+		t.Fatalf("slot %s, fees %d", res.Plans[1].BroadcastAfter, res.FeeSats)
+	}
+	if len(res.Skipped) != 2 || res.Skipped[0].Account != "empty" || !strings.Contains(res.Skipped[1].Reason, "budget") {
+		t.Fatalf("unexpected skips %+v", res.Skipped)
+	}
+	if len(ops.PendingPlans()) != 0 || len(hot.PendingPlans()) != 1 {
+		t.Fatalf("over-budget plans must be discarded")
+	}
+
+	// Broadcasts go out one slot at a time
+	for _, op := range res.Plans {
+		op.Plan.SignedTx = op.Plan.RawTx
+	}
+	b := &recordingBroadcaster{}
+	if n, err := o.BroadcastDue(res, start.Add(3*time.Hour), b); err != nil || n != 1 {
+		t.Fatalf("BroadcastDue = %d, %v", n, err)
+	}
+	if n, _ := o.BroadcastDue(res, start.Add(3*time.Hour+time.Minute), b); n != 0 {
+		t.Fatalf("expected the second plan to wait its spacing, sent %d", n)
+	}
+	if n, err := o.BroadcastDue(res, start.Add(4*time.Hour), b); err != nil || n != 1 || b.sent != 2 {
+		t.Fatalf("BroadcastDue = %d, %v", n, err)
+	}
+
+	// The weight cap leaves out plans that would exceed it
+	capped := &ConsolidationOrchestrator{Accounts: []ConsolidationAccount{{Name: "ops", Sweeper: ops}}, Destination: testAddr("cold"), MaxWeight: 400}
+	if res, err := capped.Plan(start); err != nil || len(res.Plans) != 0 || !strings.Contains(res.Skipped[0].Reason, "WU") {
+		t.Fatalf("expected the weight cap to apply, got %+v, %v", res, err)
+	}
+
+	// A fractional rate applies to every account's plan
+	frac := &ConsolidationOrchestrator{Accounts: []ConsolidationAccount{{Name: "ops", Sweeper: ops}}, Destination: testAddr("cold"), FeeRateKVB: FeeRateFromSatPerVB(1.5)}
+	if res, err := frac.Plan(start); err != nil || len(res.Plans) != 1 || res.Plans[0].Plan.Settings.FeeRateKVB != 1500 {
+		t.Fatalf("expected a plan at 1.5 sat/vB, got %+v, %v", res, err)
+	}
+}
+
+// KV whose deletes fail
+type failingDeleteKV struct{ KV }
+
+func (failingDeleteKV) Delete([]byte) error { return errors.New("disk error") }
+
+func TestConsolidationOrchestratorRollsBack(t *testing.T) {
+	fund := func(kv KV, values ...int64) *Sweeper {
+		s := newTestSweeper(t, WithKV(kv))
+		_ = s.SetFeeRate(5)
+		for i, v := range values {
+			_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 0, ValueSats: v, Address: testAddr("in"), Confirmed: true})
+		}
+		return s
+	}
+	// 20M and 10M BTC at 5000 sats: the first product overflows int64
+	if !movesMorePerFee(2_000_000_000_000_000, 5_000, 1_000_000_000_000_000, 5_000) || movesMorePerFee(1_000_000_000_000_000, 5_000, 2_000_000_000_000_000, 5_000) {
+		t.Fatalf("value per fee comparison overflows")
+	}
+
+	hot, ops := fund(NewMemKV(), 400_000, 300_000), fund(failingDeleteKV{NewMemKV()}, 50_000, 50_000, 50_000)
+	o := &ConsolidationOrchestrator{
+		Accounts:      []ConsolidationAccount{{Name: "hot", Sweeper: hot}, {Name: "ops", Sweeper: ops}},
+		Destination:   testAddr("cold"),
+		FeeBudgetSats: 1_500,
+	}
+	if _, err := o.Plan(time.Now()); err == nil || !strings.Contains(err.Error(), "account ops: disk error") {
+		t.Fatalf("expected the failed discard to be reported, got %v", err)
+	}
+	if len(hot.PendingPlans()) != 0 || len(ops.PendingPlans()) != 0 {
+		t.Fatalf("a failed orchestration must discard every plan it built")
+	}
+}
+
+func TestConfigOrchestrator(t *testing.T) {
+	keys := []testECDSAKey{{d: big.NewInt(101)}, {d: big.NewInt(202)}}
+	cfg := DefaultConfig()
+	cfg.Network, cfg.TestMode, cfg.EnforcePubKey, cfg.KVPath = "bitcoin_regtest", false, true, t.TempDir()+"/main.kv"
+	cfg.Orchestration = &OrchestrationConfig{
+		Accounts: []OrchestrationAccountConfig{
+			{Name: "hot", PubKeyHex: hex.EncodeToString(keys[0].pub()), UTXOFile: "hot.json"},
+			{Name: "ops", PubKeyHex: hex.EncodeToString(keys[1].pub()), UTXOFile: "ops.json", KVPath: t.TempDir() + "/ops.kv"},
+		},
+		Destination: testAddr("cold"),
+		FeeRate:     1.5,
+		Spacing:     "1h",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for name, breakIt := range map[string]func(o *OrchestrationConfig){
+		"no destination":  func(o *OrchestrationConfig) { o.Destination = "" },
+		"duplicate name":  func(o *OrchestrationConfig) { o.Accounts[1].Name = "hot" },
+		"no key":          func(o *OrchestrationConfig) { o.Accounts[0].PubKeyHex = "" },
+		"bad key":         func(o *OrchestrationConfig) { o.Accounts[0].PubKeyHex = "02ab" },
+		"no utxo file":    func(o *OrchestrationConfig) { o.Accounts[0].UTXOFile = "" },
+		"shared store":    func(o *OrchestrationConfig) { o.Accounts[0].KVPath = o.Accounts[1].KVPath },
+		"main store":      func(o *OrchestrationConfig) { o.Accounts[1].KVPath = cfg.KVPath },
+		"bad spacing":     func(o *OrchestrationConfig) { o.Spacing = "soon" },
+		"negative budget": func(o *OrchestrationConfig) { o.FeeBudgetSats = -1 },
+	} {
+		bad := *cfg
+		o := *cfg.Orchestration
+		o.Accounts = append([]OrchestrationAccountConfig(nil), o.Accounts...)
+		breakIt(&o)
+		bad.Orchestration = &o
+		if err := bad.Validate(); err == nil || !strings.Contains(err.Error(), "orchestration") {
+			t.Fatalf("%s: expected an orchestration error, got %v", name, err)
+		}
+	}
+
+	orch, err := cfg.Orchestrator()
+	if err != nil {
+		t.Fatalf("Orchestrator: %v", err)
+	}
+	if len(orch.Accounts) != 2 || orch.Spacing != time.Hour || orch.FeeRateKVB != 1500 {
+		t.Fatalf("orchestrator not built from the config: %+v", orch)
+	}
+	// Each account sweeps coins paying its own key, and only those
+	for i, a := range orch.Accounts {
+		own, _ := CreateP2WPKH(Hash160(keys[i].pub()), BitcoinRegtest)
+		other, _ := CreateP2WPKH(Hash160(keys[1-i].pub()), BitcoinRegtest)
+		if err := a.Sweeper.Index(UTXO{TxID: stringsRepeat("a", 64), ValueSats: 100_000, Address: own, Confirmed: true}); err != nil {
+			t.Fatalf("%s: Index: %v", a.Name, err)
+		}
+		if err := a.Sweeper.Index(UTXO{TxID: stringsRepeat("b", 64), ValueSats: 100_000, Address: other, Confirmed: true}); err == nil {
+			t.Fatalf("%s: expected another account's coin to be rejected", a.Name)
+		}
+	}
+	res, err := orch.Plan(time.Now())
+	if err != nil || len(res.Plans) != 2 || res.Plans[0].Plan.Settings.FeeRateKVB != 1500 {
+		t.Fatalf("expected a plan per account at 1.5 sat/vB, got %+v, %v", res, err)
+	}
+	for _, a := range orch.Accounts {
+		if err := a.Sweeper.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	if _, err := (&Config{}).Orchestrator(); err == nil {
+		t.Fatalf("expected a config without an orchestration section to be refused")
+	}
+}
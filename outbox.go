@@ -0,0 +1,265 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the durable outbox behind plan events and webhooks.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OutboxEvent is a plan event recorded in the KV outbox. Events are numbered
+// in the order they happened; Acked is set once the webhook accepted the event
+// or a consumer acknowledged it with AckEvent.
+type OutboxEvent struct {
+	Seq       uint64         `json:"seq"`
+	Payload   WebhookPayload `json:"payload"`
+	CreatedAt time.Time      `json:"created_at"`
+	Acked     bool           `json:"acked"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"last_error,omitempty"`
+	// Payload annotation encrypted with the annotation key; replayed events
+	// carry it only when this Sweeper does not hold the key
+	SealedAnnotation string `json:"sealed_annotation,omitempty"`
+}
+
+// Persisted outbox bounds: events First..Next-1 are stored
+type outboxState struct {
+	First uint64 `json:"first"`
+	Next  uint64 `json:"next"`
+}
+
+func outboxKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("outbox:%020d", seq))
+}
+
+// Outbox bounds; an outbox that was never written is empty
+func (s *Sweeper) outboxState() (outboxState, error) {
+	st := outboxState{First: 1, Next: 1}
+	b, err := s.kv.Get([]byte("outbox:state"))
+	if errors.Is(err, ErrKeyNotFound) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("could not read the outbox state: %w", err)
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("corrupt outbox state: %w", err)
+	}
+	return st, nil
+}
+
+// Count retained events not yet acknowledged
+func (s *Sweeper) outboxPending() (int, error) {
+	st, err := s.outboxState()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for seq := st.First; seq < st.Next; seq++ {
+		ev, err := s.getOutboxEvent(seq)
+		if err != nil {
+			return pending, err
+		}
+		if !ev.Acked {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+func (s *Sweeper) putOutboxState(st outboxState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put([]byte("outbox:state"), b)
+}
+
+func (s *Sweeper) getOutboxEvent(seq uint64) (*OutboxEvent, error) {
+	b, err := s.kv.Get(outboxKey(seq))
+	if err != nil {
+		return nil, fmt.Errorf("outbox event %d is missing: %w", seq, err)
+	}
+	var ev OutboxEvent
+	if err := json.Unmarshal(b, &ev); err != nil {
+		return nil, fmt.Errorf("outbox event %d: %w", seq, err)
+	}
+	if ev.SealedAnnotation != "" && s.annotationKey != nil {
+		if ev.Payload.Annotation, err = s.openAnnotation(ev.SealedAnnotation); err != nil {
+			return nil, fmt.Errorf("outbox event %d: %w", seq, err)
+		}
+		ev.SealedAnnotation = ""
+	}
+	return &ev, nil
+}
+
+// Store an event, its annotation encrypted when an annotation key is set
+func (s *Sweeper) putOutboxEvent(ev *OutboxEvent) error {
+	rec := *ev
+	if a := rec.Payload.Annotation; a != nil && s.annotationKey != nil {
+		sealed, err := s.sealAnnotation(a)
+		if err != nil {
+			return err
+		}
+		rec.Payload.Annotation, rec.SealedAnnotation = nil, sealed
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(outboxKey(ev.Seq), b)
+}
+
+// Append an event to the outbox; the event is written before the state so a
+// crash in between loses the event rather than leaving a gap, and both under
+// the outbox lock so instances sharing the store never reuse a seq
+func (s *Sweeper) recordEvent(payload *WebhookPayload) (*OutboxEvent, error) {
+	var ev *OutboxEvent
+	err := s.withKVLock("outbox", func() error {
+		st, err := s.outboxState()
+		if err != nil {
+			return err
+		}
+		payload.Seq = st.Next
+		ev = &OutboxEvent{Seq: st.Next, Payload: *payload, CreatedAt: time.Now().UTC()}
+		if err := s.putOutboxEvent(ev); err != nil {
+			return err
+		}
+		st.Next++
+		return s.putOutboxState(st)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// Post one outbox event to the webhook and record the outcome
+func (s *Sweeper) deliverEvent(ev *OutboxEvent) error {
+	payload := ev.Payload
+	payload.SentAt = time.Now().UTC()
+	ev.Attempts++
+	err := s.webhook.Send(&payload)
+	if err != nil {
+		ev.LastError = err.Error()
+	} else {
+		ev.Acked, ev.LastError = true, ""
+	}
+	if perr := s.putOutboxEvent(ev); perr != nil {
+		return fmt.Errorf("failed to update outbox event %d: %w", ev.Seq, perr)
+	}
+	return err
+}
+
+// DeliverOutbox retries unacknowledged events in order, stopping at the first
+// failure so the webhook never sees events out of order. It returns how many
+// were delivered. Call it periodically, or after the receiver comes back up;
+// receivers must tolerate duplicates (delivery is at-least-once) and can
+// recognise them by the payload's seq.
+func (s *Sweeper) DeliverOutbox() (int, error) {
+	if s.webhook == nil {
+		return 0, fmt.Errorf("no webhook to deliver to - call SetWebhook")
+	}
+	st, err := s.outboxState()
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for seq := st.First; seq < st.Next; seq++ {
+		ev, err := s.getOutboxEvent(seq)
+		if err != nil {
+			return delivered, err
+		}
+		if ev.Acked {
+			continue
+		}
+		if err := s.deliverEvent(ev); err != nil {
+			return delivered, fmt.Errorf("event %d: %w", seq, err)
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// ReplayEvents returns the outbox events with a sequence number above since,
+// acknowledged or not, so a consumer that was down can catch up from the last
+// seq it processed (0 = everything still retained).
+func (s *Sweeper) ReplayEvents(since uint64) ([]OutboxEvent, error) {
+	st, err := s.outboxState()
+	if err != nil {
+		return nil, err
+	}
+	start := st.First
+	if since >= start {
+		start = since + 1
+	}
+	var out []OutboxEvent
+	for seq := start; seq < st.Next; seq++ {
+		ev, err := s.getOutboxEvent(seq)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, *ev)
+	}
+	return out, nil
+}
+
+// AckEvent marks events up to and including seq as acknowledged, for
+// consumers that pull with ReplayEvents instead of receiving webhooks.
+func (s *Sweeper) AckEvent(seq uint64) error {
+	st, err := s.outboxState()
+	if err != nil {
+		return err
+	}
+	if seq >= st.Next {
+		return fmt.Errorf("outbox has no event %d (last is %d)", seq, st.Next-1)
+	}
+	for i := st.First; i <= seq; i++ {
+		ev, err := s.getOutboxEvent(i)
+		if err != nil {
+			return err
+		}
+		if ev.Acked {
+			continue
+		}
+		ev.Acked = true
+		if err := s.putOutboxEvent(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneOutbox deletes acknowledged events recorded before cutoff, oldest
+// first, stopping at the first event that must be kept. It returns how many
+// were removed; stores without KVDeleter only stop listing them.
+func (s *Sweeper) PruneOutbox(cutoff time.Time) (int, error) {
+	pruned := 0
+	err := s.withKVLock("outbox", func() error {
+		st, err := s.outboxState()
+		if err != nil {
+			return err
+		}
+		for st.First < st.Next {
+			ev, err := s.getOutboxEvent(st.First)
+			if err != nil {
+				return err
+			}
+			if !ev.Acked || !ev.CreatedAt.Before(cutoff) {
+				break
+			}
+			if err := s.kvDelete(string(outboxKey(st.First))); err != nil {
+				return err
+			}
+			st.First++
+			pruned++
+		}
+		if pruned == 0 {
+			return nil
+		}
+		return s.putOutboxState(st)
+	})
+	return pruned, err
+}
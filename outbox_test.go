@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxDeliveryAndReplay(t *testing.T) {
+	var mu sync.Mutex
+	up := false
+	var got []uint64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p WebhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		got = append(got, p.Seq)
+	}))
+	defer srv.Close()
+
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	if _, err := s.DeliverOutbox(); err == nil {
+		t.Fatalf("expected DeliverOutbox without a webhook to fail")
+	}
+	_ = s.SetWebhook(&Webhook{URL: srv.URL})
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.MarkBroadcast(plan.ID, time.Now())
+	s.WaitWebhooks()
+
+	// The receiver was down: both events wait in the outbox, and the second
+	// was never sent ahead of the first
+	evs, err := s.ReplayEvents(0)
+	if err != nil || len(evs) != 2 || evs[0].Payload.Event != EventPlanned || evs[1].Seq != 2 || evs[0].Acked || evs[0].Attempts != 2 || evs[1].Attempts != 0 {
+		t.Fatalf("unexpected outbox %+v (%v)", evs, err)
+	}
+	if evs, _ := s.ReplayEvents(1); len(evs) != 1 || evs[0].Payload.Event != EventBroadcast {
+		t.Fatalf("unexpected replay after 1: %+v", evs)
+	}
+
+	// A new sweeper over the same store delivers them in order
+	s2 := newTestSweeper(t, WithKV(kv))
+	_ = s2.SetWebhook(&Webhook{URL: srv.URL})
+	mu.Lock()
+	up = true
+	mu.Unlock()
+	if n, err := s2.DeliverOutbox(); err != nil || n != 2 {
+		t.Fatalf("DeliverOutbox = %d, %v", n, err)
+	}
+	if n, _ := s2.DeliverOutbox(); n != 0 {
+		t.Fatalf("acknowledged events were delivered again")
+	}
+	mu.Lock()
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("delivered %v, want [1 2]", got)
+	}
+	mu.Unlock()
+
+	if n, err := s2.PruneOutbox(time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Fatalf("PruneOutbox = %d, %v", n, err)
+	}
+	if evs, _ := s2.ReplayEvents(0); len(evs) != 0 {
+		t.Fatalf("pruned events still replayed: %+v", evs)
+	}
+}
+
+func TestOutboxAckWithoutWebhook(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	// Nothing consumes events until a webhook or the outbox is enabled
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}); err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if evs, err := s.ReplayEvents(0); err != nil || len(evs) != 0 {
+		t.Fatalf("expected no events without a sink, got %d, %v", len(evs), err)
+	}
+
+	s.SetEventOutbox(true)
+	plan, _ := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	_ = s.MarkBroadcast(plan.ID, time.Now())
+	if err := s.AckEvent(3); err == nil {
+		t.Fatalf("expected acknowledging a future event to fail")
+	}
+	if err := s.AckEvent(1); err != nil {
+		t.Fatalf("AckEvent: %v", err)
+	}
+	// Pruning stops at the first unacknowledged event
+	if n, _ := s.PruneOutbox(time.Now().Add(time.Minute)); n != 1 {
+		t.Fatalf("pruned %d events, want 1", n)
+	}
+	if evs, _ := s.ReplayEvents(0); len(evs) != 1 || evs[0].Seq != 2 {
+		t.Fatalf("unexpected outbox %+v", evs)
+	}
+}
+
+func TestOutboxStateErrors(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	s.SetEventOutbox(true)
+	_ = kv.Put([]byte("outbox:state"), []byte("{not json"))
+	if _, err := s.ReplayEvents(0); err == nil || !strings.Contains(err.Error(), "corrupt outbox state") {
+		t.Fatalf("expected a corrupt outbox state to be reported, got %v", err)
+	}
+	if _, err := s.recordEvent(&WebhookPayload{}); err == nil {
+		t.Fatalf("expected recording over a corrupt state to fail rather than reuse seq 1")
+	}
+
+	// A failed read is not an empty outbox
+	s2 := newTestSweeper(t, WithKV(failingGetKV{NewMemKV()}))
+	if _, err := s2.outboxPending(); err == nil {
+		t.Fatalf("expected a read failure to be reported")
+	}
+}
@@ -0,0 +1,124 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the registry of integrator-defined output script builders.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OutputScriptBuilder turns a custom destination (an address with a
+// proprietary prefix or scheme) into its output script, returning an error
+// if the destination is malformed.
+type OutputScriptBuilder func(addr string, network Network) ([]byte, error)
+
+// scriptTemplate is a registered builder and the prefix it handles.
+type scriptTemplate struct {
+	prefix string
+	build  OutputScriptBuilder
+}
+
+// RegisterOutputScript lets destinations starting with prefix (e.g. "sp1" or
+// "voucher:") be paid by scripts from build. Standard addresses always decode
+// first, so a template cannot redirect them; among templates the longest
+// matching prefix wins. Registering a prefix again replaces its builder.
+func (s *Sweeper) RegisterOutputScript(prefix string, build OutputScriptBuilder) error {
+	if prefix == "" || build == nil {
+		return errors.New("an output script template needs a prefix and a builder")
+	}
+	for i, t := range s.scriptTemplates {
+		if t.prefix == prefix {
+			s.scriptTemplates[i].build = build
+			return nil
+		}
+	}
+	s.scriptTemplates = append(s.scriptTemplates, scriptTemplate{prefix: prefix, build: build})
+	return nil
+}
+
+// UnregisterOutputScript removes the template for prefix, if any.
+func (s *Sweeper) UnregisterOutputScript(prefix string) {
+	for i, t := range s.scriptTemplates {
+		if t.prefix == prefix {
+			s.scriptTemplates = append(s.scriptTemplates[:i], s.scriptTemplates[i+1:]...)
+			return
+		}
+	}
+}
+
+// Script from the longest-prefix template matching addr; ok is false when no
+// template matches
+func (s *Sweeper) customOutputScript(addr string) (script []byte, ok bool, err error) {
+	var best *scriptTemplate
+	for i, t := range s.scriptTemplates {
+		if strings.HasPrefix(addr, t.prefix) && (best == nil || len(t.prefix) > len(best.prefix)) {
+			best = &s.scriptTemplates[i]
+		}
+	}
+	if best == nil {
+		return nil, false, nil
+	}
+	if cached, ok := s.templateScripts[addr]; ok {
+		return cached, true, nil
+	}
+	script, err = best.build(addr, s.network)
+	if err != nil {
+		return nil, true, fmt.Errorf("output script template %q: %w", best.prefix, err)
+	}
+	if len(script) == 0 || len(script) > 10_000 {
+		return nil, true, fmt.Errorf("output script template %q returned a %d-byte script", best.prefix, len(script))
+	}
+	if s.templateScripts != nil {
+		s.templateScripts[addr] = script
+	}
+	return script, true, nil
+}
+
+// Template script of a destination that is not a standard address; ok is
+// false for standard addresses, unmatched and failing templates
+func (s *Sweeper) templateScript(addr string) ([]byte, bool) {
+	if s.testMode {
+		return nil, false
+	}
+	if _, err := s.decodeAddress(addr); err == nil {
+		return nil, false
+	}
+	script, ok, err := s.customOutputScript(addr)
+	return script, ok && err == nil
+}
+
+// Cache template scripts until the returned function is called, so a plan is
+// estimated, checked and paid with the same script even when a builder is
+// not deterministic. Nested scopes share the outermost cache.
+func (s *Sweeper) templateScope() func() {
+	if s.templateScripts != nil {
+		return func() {}
+	}
+	s.templateScripts = map[string][]byte{}
+	return func() { s.templateScripts = nil }
+}
+
+// Whether addr is a template destination paying an OP_RETURN (null data)
+// script, the only kind of output that may carry zero value
+func (s *Sweeper) isNullData(addr string) bool {
+	script, ok, err := s.customOutputScript(addr)
+	return ok && err == nil && script[0] == 0x6a
+}
+
+// Decode a destination: a standard address, or nil for a silent payment
+// address or one a template accepts
+func (s *Sweeper) decodeDestination(addr string) (*Address, error) {
+	dec, err := s.decodeAddress(addr)
+	if err == nil {
+		return dec, nil
+	}
+	if isSilentPaymentAddress(addr) {
+		_, err := s.decodeSilentPayment(addr)
+		return nil, err
+	}
+	if _, ok, terr := s.customOutputScript(addr); ok {
+		return nil, terr
+	}
+	return nil, err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// "voucher:<40 hex>" pays a P2SH-style script to the given hash
+func voucherScript(addr string, _ Network) ([]byte, error) {
+	h, err := hex.DecodeString(strings.TrimPrefix(addr, "voucher:"))
+	if err != nil || len(h) != 20 {
+		return nil, errors.New("voucher needs a 20-byte hex hash")
+	}
+	return append(append([]byte{0xa9, 0x14}, h...), 0x87), nil
+}
+
+func TestOutputScriptTemplates(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinMainnet)
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: own, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	dest := "voucher:" + strings.Repeat("ab", 20)
+	if _, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 50_000}}); err == nil {
+		t.Fatalf("expected an unregistered scheme to be rejected")
+	}
+
+	if err := s.RegisterOutputScript("", voucherScript); err == nil {
+		t.Fatalf("expected an empty prefix to be rejected")
+	}
+	if err := s.RegisterOutputScript("voucher:", voucherScript); err != nil {
+		t.Fatalf("RegisterOutputScript: %v", err)
+	}
+	// A template for a standard prefix never redirects standard addresses
+	if err := s.RegisterOutputScript("bc1", func(string, Network) ([]byte, error) { return []byte{0x6a}, nil }); err != nil {
+		t.Fatalf("RegisterOutputScript: %v", err)
+	}
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	want, _ := voucherScript(dest, BitcoinMainnet)
+	if !bytes.Equal(plan.RawTx.TxOut[0].PkScript, want) {
+		t.Fatalf("output script %x, want %x", plan.RawTx.TxOut[0].PkScript, want)
+	}
+	change, _ := s.buildOutputScript(own)
+	if !bytes.Equal(plan.RawTx.TxOut[plan.ChangeIdxs[0]].PkScript, change) {
+		t.Fatalf("standard change address was redirected by a template")
+	}
+	if vb := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs); vb != 10+68+32+31 {
+		t.Fatalf("estimated %d vB, want %d", vb, 10+68+32+31)
+	}
+
+	if _, err := s.Spend([]TxOutput{{Address: "voucher:zz", ValueSats: 50_000}}); err == nil || !strings.Contains(err.Error(), "voucher:") {
+		t.Fatalf("expected the builder error to surface, got %v", err)
+	}
+	// The longest matching prefix wins
+	if err := s.RegisterOutputScript("voucher:ab", func(string, Network) ([]byte, error) { return []byte{0x51}, nil }); err != nil {
+		t.Fatalf("RegisterOutputScript: %v", err)
+	}
+	if script, _ := s.buildOutputScript(dest); !bytes.Equal(script, []byte{0x51}) {
+		t.Fatalf("longest prefix not preferred: %x", script)
+	}
+	s.UnregisterOutputScript("voucher:ab")
+	s.UnregisterOutputScript("voucher:")
+	if _, err := s.buildOutputScript(dest); err == nil {
+		t.Fatalf("expected the unregistered scheme to be rejected")
+	}
+}
+
+func TestOutputScriptTemplateSizeDustAndCache(t *testing.T) {
+	pub, _ := hex.DecodeString(legacyTestPub)
+	s := mustNewSweeper(t, pub, BitcoinMainnet, WithDustPolicy(RelayDustPolicy{}))
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinMainnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: own, Confirmed: true})
+	_ = s.RegisterOutputScript("voucher:", voucherScript)
+	_ = s.RegisterOutputScript("wpkh:", func(string, Network) ([]byte, error) {
+		return append([]byte{0x00, 0x14}, make([]byte, 20)...), nil
+	})
+	_ = s.RegisterOutputScript("memo:", func(string, Network) ([]byte, error) { return []byte{0x6a, 0x01, 0x00}, nil })
+
+	// Core's thresholds for the built script, not a P2WPKH default
+	p := s.defaultSpendParams()
+	for addr, want := range map[string]int64{"voucher:" + strings.Repeat("ab", 20): 540, "wpkh:x": 294, "memo:x": 0} {
+		if got := s.dustFor(addr, p); got != want {
+			t.Fatalf("dust for %s = %d, want %d", addr, got, want)
+		}
+	}
+
+	// Scripts over 252 bytes take a 3-byte length prefix
+	_ = s.RegisterOutputScript("big:", func(string, Network) ([]byte, error) { return bytes.Repeat([]byte{0x51}, 300), nil })
+	base := estimateTxVBytesDetailed(s, nil, nil)
+	if got := estimateTxVBytesDetailed(s, nil, []TxOutput{{Address: "big:x"}}) - base; got != 8+3+300 {
+		t.Fatalf("300-byte script output estimated at %d vB, want %d", got, 8+3+300)
+	}
+
+	// Each plan builds the script once, so a builder returning a fresh script
+	// per call is estimated and paid consistently
+	calls := 0
+	_ = s.RegisterOutputScript("fresh:", func(string, Network) ([]byte, error) {
+		calls++
+		return append([]byte{0x00, 0x14}, bytes.Repeat([]byte{byte(calls)}, 20)...), nil
+	})
+	plan, err := s.Spend([]TxOutput{{Address: "fresh:x", ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if calls != 1 || plan.RawTx.TxOut[0].PkScript[2] != 1 {
+		t.Fatalf("builder called %d times for one plan", calls)
+	}
+	_ = s.DiscardPlan(plan.ID)
+	if _, err := s.Spend([]TxOutput{{Address: "fresh:x", ValueSats: 50_000}}); err != nil || calls != 2 {
+		t.Fatalf("expected the next plan to build the script again, got %d calls, %v", calls, err)
+	}
+}
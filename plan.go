@@ -0,0 +1,479 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains tracking of pending transaction plans.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExpectedTxID returns the txid the plan's transaction will have once signed.
+// The sweeper only spends segwit inputs, whose signatures live in the witness,
+// so the txid of the unsigned transaction is final and can be registered with
+// external systems before broadcast.
+func (p *TransactionPlan) ExpectedTxID() string {
+	return p.RawTx.TxID()
+}
+
+// planRecord is the persisted form of a tracked plan.
+type planRecord struct {
+	ID             string          `json:"id"`
+	Inputs         []UTXO          `json:"inputs"`
+	Outputs        []TxOutput      `json:"outputs"`
+	FeeSats        int64           `json:"fee_sats"`
+	ChangeIdxs     []int           `json:"change_idxs,omitempty"`
+	Change         []ChangeOutput  `json:"change,omitempty"`
+	RawTx          string          `json:"raw_tx"`              // Unsigned transaction hex
+	SignedTx       string          `json:"signed_tx,omitempty"` // Finalized transaction hex
+	PackageFeeSats int64           `json:"package_fee_sats"`
+	PackageVBytes  int64           `json:"package_vbytes"`
+	WasteSats      int64           `json:"waste_sats,omitempty"`
+	Settings       PlanSettings    `json:"settings"`
+	Annotation     *PlanAnnotation `json:"annotation,omitempty"`
+	// Annotation encrypted with the annotation key (see SetAnnotationKey)
+	SealedAnnotation string        `json:"sealed_annotation,omitempty"`
+	Warnings         []PlanWarning `json:"warnings,omitempty"`
+	DustChangeSats   int64         `json:"dust_change_sats,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+	BroadcastAt      *time.Time    `json:"broadcast_at,omitempty"`
+	ConfirmedAt      *time.Time    `json:"confirmed_at,omitempty"`
+
+	Status    PlanState          `json:"status,omitempty"`
+	History   []PlanTransition   `json:"history,omitempty"`
+	Preflight []PreflightVerdict `json:"preflight,omitempty"`
+	Replaces  string             `json:"replaces,omitempty"`
+
+	DescriptorDest *DescriptorDestination `json:"descriptor_dest,omitempty"`
+	FeeReport      *FeeReport             `json:"fee_report,omitempty"`
+}
+
+// Register a freshly built plan as pending, keyed by its expected txid
+func (s *Sweeper) trackPlan(plan *TransactionPlan) error {
+	plan.ID = plan.ExpectedTxID()
+	plan.CreatedAt = time.Now().UTC()
+	plan.Status = PlanDraft
+	plan.History = []PlanTransition{{State: PlanDraft, At: plan.CreatedAt}}
+	if err := s.claimChangeIndices(plan); err != nil {
+		return err
+	}
+	if err := s.claimPlanID(plan.ID); err != nil {
+		return err
+	}
+	if err := s.savePlan(plan); err != nil {
+		_ = s.updatePlanIndex(func(ids []string) []string { return removeString(ids, plan.ID) })
+		return fmt.Errorf("failed to persist plan %s: %w", plan.ID, err)
+	}
+	s.plans[plan.ID] = plan
+	s.logger.Printf("planned %s: %d inputs, %d outputs, fee %d sats", plan.ID, len(plan.Inputs), len(plan.Outputs), plan.FeeSats)
+	s.notify(EventPlanned, plan)
+	return nil
+}
+
+// Persist a plan under "plan:<txid>" and add it to the plan index
+func (s *Sweeper) savePlan(p *TransactionPlan) error {
+	rec := planRecord{
+		ID:             p.ID,
+		Inputs:         p.Inputs,
+		Outputs:        p.Outputs,
+		FeeSats:        p.FeeSats,
+		ChangeIdxs:     p.ChangeIdxs,
+		Change:         p.Change,
+		RawTx:          hex.EncodeToString(p.RawTx.Serialize(true)),
+		PackageFeeSats: p.PackageFeeSats,
+		PackageVBytes:  p.PackageVBytes,
+		WasteSats:      p.WasteSats,
+		Settings:       p.Settings,
+		Warnings:       p.Warnings,
+		DustChangeSats: p.DustChangeSats,
+		CreatedAt:      p.CreatedAt,
+		BroadcastAt:    p.BroadcastAt,
+		ConfirmedAt:    p.ConfirmedAt,
+		Status:         p.Status,
+		History:        p.History,
+		Preflight:      p.Preflight,
+		Replaces:       p.Replaces,
+		DescriptorDest: p.DescriptorDest,
+		FeeReport:      p.feeReport,
+	}
+	if p.SignedTx != nil {
+		rec.SignedTx = hex.EncodeToString(p.SignedTx.Serialize(true))
+	}
+	var err error
+	if rec.Annotation, rec.SealedAnnotation, err = s.storedAnnotation(p); err != nil {
+		return fmt.Errorf("failed to encrypt the annotation of plan %s: %w", p.ID, err)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Put([]byte("plan:"+p.ID), b); err != nil {
+		return err
+	}
+	return s.updatePlanIndex(func(ids []string) []string {
+		if containsString(ids, p.ID) {
+			return nil
+		}
+		return append(ids, p.ID)
+	})
+}
+
+// Add a new plan's ID to the index, refusing one another instance sharing
+// the KV store already tracks
+func (s *Sweeper) claimPlanID(id string) error {
+	if _, ok := s.plans[id]; ok {
+		return nil // Rebuilt by this instance
+	}
+	var taken bool
+	err := s.updatePlanIndex(func(ids []string) []string {
+		if taken = containsString(ids, id); taken {
+			return nil
+		}
+		return append(ids, id)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to persist plan %s: %w", id, err)
+	}
+	if taken {
+		return fmt.Errorf("plan %s is already tracked in the KV store, possibly by another sweeper instance - call LoadPlans to pick it up", id)
+	}
+	return nil
+}
+
+// Read the persisted plan index
+func (s *Sweeper) planIDs() []string {
+	b, err := s.kv.Get([]byte("plans:index"))
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	_ = json.Unmarshal(b, &ids)
+	return ids
+}
+
+// Apply fn to the plan index atomically; a nil result leaves it unchanged
+func (s *Sweeper) updatePlanIndex(fn func(ids []string) []string) error {
+	return s.updateKV("plans:index", func(cur []byte) ([]byte, error) {
+		var ids []string
+		if cur != nil {
+			if err := json.Unmarshal(cur, &ids); err != nil {
+				return nil, fmt.Errorf("corrupt plan index: %w", err)
+			}
+		}
+		next := fn(ids)
+		if next == nil {
+			return nil, nil
+		}
+		sort.Strings(next)
+		return json.Marshal(next)
+	})
+}
+
+// Whether ids holds id
+func containsString(ids []string, id string) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ids without id
+func removeString(ids []string, id string) []string {
+	out := make([]string, 0, len(ids))
+	for _, x := range ids {
+		if x != id {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// LoadPlans restores tracked plans from the KV store, rebuilding their PSBTs.
+func (s *Sweeper) LoadPlans() error {
+	for _, id := range s.planIDs() {
+		b, err := s.kv.Get([]byte("plan:" + id))
+		if err != nil {
+			return fmt.Errorf("plan %s listed in index but missing: %w", id, err)
+		}
+		var rec planRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("plan %s: %w", id, err)
+		}
+		p, err := s.planFromRecord(&rec)
+		if err != nil {
+			return fmt.Errorf("plan %s: %w", id, err)
+		}
+		s.plans[p.ID] = p
+	}
+	return s.archiveFinishedPlans()
+}
+
+// Rebuild a plan and its unsigned PSBT from a persisted record
+func (s *Sweeper) planFromRecord(rec *planRecord) (*TransactionPlan, error) {
+	raw, err := hex.DecodeString(rec.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		return nil, err
+	}
+	if tx.TxID() != rec.ID {
+		return nil, errors.New("stored transaction does not match plan id")
+	}
+	psbt := NewPSBTFromUnsignedTx(tx)
+	for i, in := range rec.Inputs {
+		if err := s.setInputUTXO(&psbt.Inputs[i], in); err != nil {
+			return nil, err
+		}
+	}
+	s.decoratePSBT(psbt, rec.Inputs, rec.Outputs)
+	p := &TransactionPlan{
+		ID:             rec.ID,
+		Inputs:         rec.Inputs,
+		Outputs:        rec.Outputs,
+		FeeSats:        rec.FeeSats,
+		RawTx:          tx,
+		PSBT:           psbt,
+		ChangeIdxs:     rec.ChangeIdxs,
+		Change:         rec.Change,
+		PackageFeeSats: rec.PackageFeeSats,
+		PackageVBytes:  rec.PackageVBytes,
+		WasteSats:      rec.WasteSats,
+		Settings:       rec.Settings,
+		Annotation:     rec.Annotation,
+		Warnings:       rec.Warnings,
+		DustChangeSats: rec.DustChangeSats,
+		CreatedAt:      rec.CreatedAt,
+		BroadcastAt:    rec.BroadcastAt,
+		ConfirmedAt:    rec.ConfirmedAt,
+		Status:         rec.Status,
+		History:        rec.History,
+		Preflight:      rec.Preflight,
+		Replaces:       rec.Replaces,
+		DescriptorDest: rec.DescriptorDest,
+		feeReport:      rec.FeeReport,
+	}
+	if dd := rec.DescriptorDest; dd != nil {
+		d, err := ParseDestinationDescriptor(dd.Descriptor, s.network)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.decorateOutputs(psbt, rec.Outputs, dd.Index); err != nil {
+			return nil, err
+		}
+	}
+	if rec.SealedAnnotation != "" {
+		if s.annotationKey == nil {
+			p.sealedAnnotation = rec.SealedAnnotation // Kept for a Sweeper holding the key
+		} else if p.Annotation, err = s.openAnnotation(rec.SealedAnnotation); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Change) == 0 {
+		// Plans saved before change was tracked by script
+		if err := s.recordChange(p); err != nil {
+			return nil, err
+		}
+	}
+	p.ChangeIdxs = p.ChangeIndices()
+	p.setPackageRates(estimateTxVBytesDetailed(s, p.Inputs, p.Outputs))
+	if p.feeReport == nil {
+		// Plans saved before fee reports, priced at their recorded settings
+		rate := p.Settings.FeeRateKVB
+		if rate == 0 {
+			rate = SatPerVByte(p.Settings.FeeRate)
+		}
+		p.feeReport = s.buildFeeReport(p, rate, s.reportDust(p, spendParams{dustOverride: p.Settings.DustSats}))
+	}
+	if rec.SignedTx != "" {
+		b, err := hex.DecodeString(rec.SignedTx)
+		if err != nil {
+			return nil, err
+		}
+		if p.SignedTx, err = DeserializeMsgTx(b); err != nil {
+			return nil, err
+		}
+	}
+	if p.Status == "" {
+		p.Status, p.History = legacyPlanState(p)
+	}
+	return p, nil
+}
+
+// MarkBroadcast records when a plan's transaction was broadcast, moving it
+// to the broadcast state unless it was already seen mined. Broadcasting a fee
+// bump marks the plan it replaces.
+func (s *Sweeper) MarkBroadcast(id string, at time.Time) error {
+	p, ok := s.plans[id]
+	if !ok {
+		return fmt.Errorf("unknown plan %q", id)
+	}
+	if p.Status != PlanConfirming && p.Status != PlanConfirmed {
+		if err := transitionPlan(p, PlanBroadcast, at, ""); err != nil {
+			return err
+		}
+	}
+	first := p.BroadcastAt == nil
+	at = at.UTC()
+	p.BroadcastAt = &at
+	if orig, ok := s.plans[p.Replaces]; ok && orig.Status == PlanBroadcast {
+		if err := s.MarkReplaced(orig.ID, p.ID, at); err != nil {
+			return err
+		}
+	}
+	// A fee bump's inputs and payouts were counted with the original
+	if first && p.Replaces == "" {
+		if err := s.recordSpent(p); err != nil {
+			return err
+		}
+		if err := s.recordFeeMetrics(p); err != nil {
+			return err
+		}
+	}
+	if err := s.savePlan(p); err != nil {
+		return err
+	}
+	if first {
+		s.notify(EventBroadcast, p)
+	}
+	return nil
+}
+
+// MarkConfirmed records when a plan's transaction was first mined, moving it
+// to confirming (confirmed with a finality depth of 1).
+func (s *Sweeper) MarkConfirmed(id string, at time.Time) error {
+	p, ok := s.plans[id]
+	if !ok {
+		return fmt.Errorf("unknown plan %q", id)
+	}
+	to := PlanConfirming
+	if s.finalityDepth <= 1 {
+		to = PlanConfirmed
+	}
+	if p.Status != PlanConfirmed {
+		if err := transitionPlan(p, to, at, ""); err != nil {
+			return err
+		}
+	}
+	at = at.UTC()
+	first := p.ConfirmedAt == nil
+	p.ConfirmedAt = &at
+	if err := s.savePlan(p); err != nil {
+		return err
+	}
+	if first {
+		s.notify(EventConfirmed, p)
+	}
+	return s.archiveFinishedPlans()
+}
+
+// DiscardPlan stops tracking a plan that will not be broadcast, releasing its
+// unconfirmed exposure.
+func (s *Sweeper) DiscardPlan(id string) error {
+	if _, ok := s.plans[id]; !ok {
+		return fmt.Errorf("unknown plan %q", id)
+	}
+	delete(s.plans, id)
+	err := s.updatePlanIndex(func(ids []string) []string {
+		if !containsString(ids, id) {
+			return nil
+		}
+		return removeString(ids, id)
+	})
+	if err != nil {
+		return err
+	}
+	return s.kvDelete("plan:" + id)
+}
+
+// GetPlan returns a pending plan by its ID.
+func (s *Sweeper) GetPlan(id string) (*TransactionPlan, bool) {
+	p, ok := s.plans[id]
+	return p, ok
+}
+
+// PendingPlans returns all tracked plans in creation order.
+func (s *Sweeper) PendingPlans() []*TransactionPlan {
+	out := make([]*TransactionPlan, 0, len(s.plans))
+	for _, p := range s.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// planDependencies returns the IDs of plans (within the given set) whose
+// transactions are spent by inputs of the plan.
+func planDependencies(plan *TransactionPlan, set []*TransactionPlan) []string {
+	var deps []string
+	for _, parent := range set {
+		if parent == plan || parent.RawTx == nil {
+			continue
+		}
+		h := parent.RawTx.TxHash()
+		for _, in := range plan.RawTx.TxIn {
+			if in.PreviousOutPoint.Hash == h {
+				deps = append(deps, parent.ID)
+				break
+			}
+		}
+	}
+	return deps
+}
+
+// SetMaxUnconfirmedExposure limits the total value of unconfirmed inputs that
+// tracked plans may spend before they confirm (0 disables the limit). Plans
+// stop counting once marked confirmed, discarded or abandoned.
+func (s *Sweeper) SetMaxUnconfirmedExposure(sats int64) error {
+	if sats < 0 {
+		return errors.New("maximum unconfirmed exposure must be non-negative")
+	}
+	s.maxUnconfExposure = sats
+	return nil
+}
+
+// UnconfirmedExposure returns the value of unconfirmed inputs spent by tracked
+// plans that have not confirmed yet.
+func (s *Sweeper) UnconfirmedExposure() int64 {
+	var total int64
+	for _, p := range s.plans {
+		if p.inFlight() {
+			total += unconfirmedValue(p.Inputs)
+		}
+	}
+	return total
+}
+
+// Reject a new plan that would push unconfirmed exposure over the limit
+func (s *Sweeper) checkUnconfirmedExposure(inputs []UTXO) error {
+	add := unconfirmedValue(inputs)
+	if s.maxUnconfExposure <= 0 || add == 0 {
+		return nil
+	}
+	if cur := s.UnconfirmedExposure(); cur+add > s.maxUnconfExposure {
+		return fmt.Errorf("unconfirmed exposure would reach %d sats (limit %d, in flight %d) - wait for pending plans to confirm or disallow unconfirmed inputs", cur+add, s.maxUnconfExposure, cur)
+	}
+	return nil
+}
+
+// Sum the value of unconfirmed inputs
+func unconfirmedValue(inputs []UTXO) int64 {
+	var v int64
+	for _, u := range inputs {
+		if !u.Confirmed {
+			v += u.ValueSats
+		}
+	}
+	return v
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnconfirmedExposureLimit(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(true, 5, 5)
+	if err := s.SetMaxUnconfirmedExposure(150_000); err != nil {
+		t.Fatalf("SetMaxUnconfirmedExposure: %v", err)
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}
+
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: false})
+	first, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("first Spend: %v", err)
+	}
+	if got := s.UnconfirmedExposure(); got != 100_000 {
+		t.Fatalf("exposure = %d, want 100000", got)
+	}
+
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: false})
+	if _, err := s.Spend(out); err == nil {
+		t.Fatalf("expected exposure limit to reject second plan")
+	}
+	if len(s.PendingPlans()) != 1 {
+		t.Fatalf("rejected plan must not be tracked")
+	}
+
+	if err := s.MarkConfirmed(first.ID, time.Now()); err != nil {
+		t.Fatalf("MarkConfirmed: %v", err)
+	}
+	if _, err := s.Spend(out); err != nil {
+		t.Fatalf("Spend after confirmation: %v", err)
+	}
+
+	// Confirmed inputs never count toward exposure
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.Spend(out); err != nil {
+		t.Fatalf("confirmed Spend: %v", err)
+	}
+}
+
+func TestPlansKeyedByExpectedTxIDSurviveRestart(t *testing.T) {
+	path := t.TempDir() + "/state.json"
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("OpenFileKV: %v", err)
+	}
+	s := newTestSweeper(t)
+	s.SetKV(kv)
+	_ = s.Index(UTXO{TxID: "00000000000000000000000000000000000000000000000000000000000000ff", Vout: 3, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	// Outpoints are serialized in internal (reversed) byte order
+	if plan.RawTx.TxIn[0].PreviousOutPoint.Hash[0] != 0xff {
+		t.Fatalf("outpoint hash not byte-reversed")
+	}
+	if plan.ID != plan.ExpectedTxID() || len(plan.ID) != 64 {
+		t.Fatalf("plan ID %q is not the expected txid", plan.ID)
+	}
+	if err := s.MarkBroadcast(plan.ID, time.Now()); err != nil {
+		t.Fatalf("MarkBroadcast: %v", err)
+	}
+
+	kv2, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s2 := newTestSweeper(t)
+	s2.SetKV(kv2)
+	if err := s2.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	got, ok := s2.GetPlan(plan.ID)
+	if !ok {
+		t.Fatalf("plan not restored")
+	}
+	if !reflect.DeepEqual(got.Settings, plan.Settings) || got.Settings.SoftwareVersion != Version {
+		t.Fatalf("settings snapshot not restored: %+v", got.Settings)
+	}
+	if got.BroadcastAt == nil || got.FeeSats != plan.FeeSats || got.RawTx.TxID() != plan.ID {
+		t.Fatalf("restored plan differs: %+v", got)
+	}
+	a, _ := got.PSBT.B64Encode()
+	b, _ := plan.PSBT.B64Encode()
+	if a != b {
+		t.Fatalf("restored PSBT differs")
+	}
+}
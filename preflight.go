@@ -0,0 +1,194 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the validators a signed plan must pass before broadcast.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PreflightFunc is a final check on a signed plan before broadcast; a non-nil
+// error refuses the broadcast and says why.
+type PreflightFunc func(p *TransactionPlan) error
+
+// namedPreflight is a registered validator; the name appears in verdicts.
+type namedPreflight struct {
+	name string
+	fn   PreflightFunc
+}
+
+// PreflightVerdict is one validator's outcome for one broadcast attempt.
+type PreflightVerdict struct {
+	Validator string    `json:"validator"`
+	Passed    bool      `json:"passed"`
+	Reason    string    `json:"reason,omitempty"` // Why it failed
+	At        time.Time `json:"at"`
+}
+
+// PreflightError reports the validators that refused a broadcast; test for
+// it with errors.As.
+type PreflightError struct {
+	PlanID string
+	Failed []PreflightVerdict
+}
+
+// Error implements error.
+func (e *PreflightError) Error() string {
+	var reasons []string
+	for _, v := range e.Failed {
+		reasons = append(reasons, v.Validator+": "+v.Reason)
+	}
+	return fmt.Sprintf("plan %s failed preflight (%s)", e.PlanID, strings.Join(reasons, "; "))
+}
+
+// AddPreflightValidator appends a check to the preflight pipeline. Validators
+// run in order after the built-in standard, fee, destinations and approval
+// checks, and every one runs so each verdict is recorded.
+func (s *Sweeper) AddPreflightValidator(name string, f PreflightFunc) error {
+	if name == "" || f == nil {
+		return errors.New("a preflight validator needs a name and a function")
+	}
+	for _, v := range s.preflightPipeline() {
+		if v.name == name {
+			return fmt.Errorf("preflight validator %q is already registered", name)
+		}
+	}
+	s.preflight = append(s.preflight, namedPreflight{name: name, fn: f})
+	return nil
+}
+
+// ClearPreflightValidators removes the validators added with
+// AddPreflightValidator; the built-in checks stay.
+func (s *Sweeper) ClearPreflightValidators() {
+	s.preflight = nil
+}
+
+// SetDestinationAllowlist limits the recipients of broadcast plans to addrs
+// (nil or empty = any). Change outputs are not checked.
+func (s *Sweeper) SetDestinationAllowlist(addrs []string) error {
+	if len(addrs) == 0 {
+		s.destAllowlist = nil
+		return nil
+	}
+	allow := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		if a == "" {
+			return errors.New("destination allowlist entries must not be empty")
+		}
+		allow[a] = true
+	}
+	s.destAllowlist = allow
+	return nil
+}
+
+// SetRequireApproval makes broadcast refuse plans never moved through
+// ApprovePlan.
+func (s *Sweeper) SetRequireApproval(required bool) {
+	s.requireApproval = required
+}
+
+// Built-in validators followed by the integrator's, in run order
+func (s *Sweeper) preflightPipeline() []namedPreflight {
+	return append([]namedPreflight{
+		{"standard", s.preflightStandard},
+		{"fee", s.preflightFee},
+		{"destinations", s.preflightDestinations},
+		{"approval", s.preflightApproval},
+	}, s.preflight...)
+}
+
+// Run every validator on p, append the verdicts to its audit trail and
+// persist it; a *PreflightError lists the failures
+func (s *Sweeper) runPreflight(p *TransactionPlan, at time.Time) error {
+	var failed []PreflightVerdict
+	for _, v := range s.preflightPipeline() {
+		verdict := PreflightVerdict{Validator: v.name, Passed: true, At: at.UTC()}
+		if err := v.fn(p); err != nil {
+			verdict.Passed, verdict.Reason = false, err.Error()
+			failed = append(failed, verdict)
+			s.logger.Printf("plan %s: preflight %s failed: %v", p.ID, v.name, err)
+		}
+		p.Preflight = append(p.Preflight, verdict)
+	}
+	if err := s.savePlan(p); err != nil {
+		return fmt.Errorf("failed to record preflight of plan %s: %w", p.ID, err)
+	}
+	if len(failed) > 0 {
+		return &PreflightError{PlanID: p.ID, Failed: failed}
+	}
+	return nil
+}
+
+// Relay policy: standard size and no dust outputs
+func (s *Sweeper) preflightStandard(p *TransactionPlan) error {
+	if vs := txVSize(p.SignedTx); vs > maxStandardTxVBytes {
+		return fmt.Errorf("transaction is %d vB, over the %d vB standard limit", vs, maxStandardTxVBytes)
+	}
+	for i, o := range p.SignedTx.TxOut {
+		addr, ok := scriptAddress(o.PkScript, s.network)
+		if !ok {
+			continue // Integrator scripts and test-mode outputs
+		}
+		dec, err := s.decodeAddress(addr)
+		if err != nil {
+			continue
+		}
+		if min := (RelayDustPolicy{}).MinForScript(dec.Type); o.Value < min {
+			return fmt.Errorf("output %d pays %d sats, below the %d sat relay dust limit", i, o.Value, min)
+		}
+	}
+	return nil
+}
+
+// The signed transaction pays the planned fee (the signer altered no amounts)
+// and the fee is within the limits at its actual size
+func (s *Sweeper) preflightFee(p *TransactionPlan) error {
+	fee := int64(0)
+	for _, u := range p.Inputs {
+		fee += u.ValueSats
+	}
+	for _, o := range p.SignedTx.TxOut {
+		fee -= o.Value
+	}
+	switch {
+	case fee <= 0:
+		return fmt.Errorf("transaction pays no fee (inputs minus outputs is %d sats)", fee)
+	case fee != p.FeeSats:
+		return fmt.Errorf("transaction pays %d sats of fee, but the plan has %d", fee, p.FeeSats)
+	}
+	maxSats, maxRate := s.planFeeCaps(p.Settings)
+	return s.checkFeeLimits(fee, txVSize(p.SignedTx), p.Outputs, p.ChangeIdxs, maxSats, maxRate)
+}
+
+// Recipients are on the allowlist, if one is set
+func (s *Sweeper) preflightDestinations(p *TransactionPlan) error {
+	if s.destAllowlist == nil {
+		return nil
+	}
+	for i, o := range p.Outputs {
+		if !p.IsChange(i) && !s.destAllowlist[o.Address] {
+			return fmt.Errorf("destination %s is not on the allowlist", o.Address)
+		}
+	}
+	return nil
+}
+
+// The plan was approved, if approval is required
+func (s *Sweeper) preflightApproval(p *TransactionPlan) error {
+	if !s.requireApproval {
+		return nil
+	}
+	for _, h := range p.History {
+		if h.State == PlanApproved {
+			return nil
+		}
+	}
+	return errors.New("plan was never approved - call ApprovePlan first")
+}
+
+// Virtual size of a transaction as serialized
+func txVSize(tx *MsgTx) int64 {
+	return int64((len(tx.Serialize(false))*3 + len(tx.Serialize(true)) + 3) / 4)
+}
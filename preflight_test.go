@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPreflightPipeline(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	plan.SignedTx = plan.RawTx
+
+	_ = s.SetDestinationAllowlist([]string{testAddr("other")})
+	s.SetRequireApproval(true)
+	var custom []string
+	_ = s.AddPreflightValidator("policy-engine", func(p *TransactionPlan) error {
+		custom = append(custom, p.ID)
+		return nil
+	})
+	if err := s.AddPreflightValidator("fee", func(*TransactionPlan) error { return nil }); err == nil {
+		t.Fatalf("expected a duplicate validator name to be refused")
+	}
+	b := &recordingBroadcaster{}
+	_, err = s.BroadcastPlan(plan.ID, b)
+	var pe *PreflightError
+	if !errors.As(err, &pe) || len(pe.Failed) != 2 || pe.Failed[0].Validator != "destinations" || pe.Failed[1].Validator != "approval" {
+		t.Fatalf("expected destinations and approval failures, got %v", err)
+	}
+	if b.sent != 0 || len(custom) != 1 {
+		t.Fatalf("sent %d, custom validator ran %d times", b.sent, len(custom))
+	}
+	if len(plan.Preflight) != 5 || !plan.Preflight[0].Passed || plan.Preflight[2].Passed || plan.Preflight[2].Reason == "" {
+		t.Fatalf("unexpected verdicts %+v", plan.Preflight)
+	}
+
+	// A signer that moved value into the fee is caught
+	tampered, _ := DeserializeMsgTx(plan.RawTx.Serialize(true))
+	tampered.TxOut[0].Value -= 1_000
+	plan.SignedTx = tampered
+	_ = s.SetDestinationAllowlist(nil)
+	_ = s.ApprovePlan(plan.ID, time.Now())
+	if _, err := s.BroadcastPlan(plan.ID, b); !errors.As(err, &pe) || len(pe.Failed) != 1 || pe.Failed[0].Validator != "fee" {
+		t.Fatalf("expected a fee failure, got %v", err)
+	}
+
+	plan.SignedTx = plan.RawTx
+	if _, err := s.BroadcastPlan(plan.ID, b); err != nil || b.sent != 1 {
+		t.Fatalf("BroadcastPlan: %v", err)
+	}
+
+	// Verdicts of every attempt persist with the plan
+	reloaded := newTestSweeper(t, WithKV(s.kv))
+	if err := reloaded.LoadPlans(); err != nil {
+		t.Fatalf("LoadPlans: %v", err)
+	}
+	if got := reloaded.plans[plan.ID].Preflight; len(got) != 15 || !got[14].Passed {
+		t.Fatalf("expected 15 recorded verdicts, got %+v", got)
+	}
+}
@@ -0,0 +1,162 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains price sources used for fiat valuation.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PriceProvider supplies the BTC price in USD at a point in time.
+// Implementations may serve historical prices or ignore the time and return spot.
+type PriceProvider interface {
+	PriceUSD(at time.Time) (float64, error)
+}
+
+// FiatPriceProvider is a PriceProvider that also quotes BTC in other fiat
+// currencies, identified by ISO 4217 code ("EUR", "JPY", "GBP", ...).
+type FiatPriceProvider interface {
+	PriceProvider
+	PriceIn(currency string, at time.Time) (float64, error)
+}
+
+// StaticPrice is a PriceProvider that always returns the same price.
+type StaticPrice float64
+
+// PriceUSD returns the fixed price.
+func (p StaticPrice) PriceUSD(at time.Time) (float64, error) {
+	if p <= 0 {
+		return 0, errors.New("static price must be positive")
+	}
+	return float64(p), nil
+}
+
+// StaticPrices is a FiatPriceProvider with a fixed BTC price per currency code.
+type StaticPrices map[string]float64
+
+// PriceUSD returns the fixed USD price.
+func (p StaticPrices) PriceUSD(at time.Time) (float64, error) {
+	return p.PriceIn("USD", at)
+}
+
+// PriceIn returns the fixed price in currency.
+func (p StaticPrices) PriceIn(currency string, at time.Time) (float64, error) {
+	v, ok := p[strings.ToUpper(currency)]
+	if !ok {
+		return 0, fmt.Errorf("no static %s price configured", currency)
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("static %s price must be positive", currency)
+	}
+	return v, nil
+}
+
+// MempoolPriceProvider is a FiatPriceProvider reading mempool.space's GET
+// {BaseURL}/v1/prices, which quotes the current BTC price in USD, EUR, GBP,
+// CAD, CHF, AUD and JPY. It ignores the time asked for, so it suits live dust
+// thresholds, not historical valuation.
+type MempoolPriceProvider struct {
+	BaseURL string        // e.g. MempoolSpaceAPI
+	Timeout time.Duration // Per request (0 = 10s)
+	Client  *http.Client  // nil = http.DefaultClient
+}
+
+// NewMempoolPriceProvider checks the base URL. It must be https; plain http
+// is accepted only for loopback addresses.
+func NewMempoolPriceProvider(baseURL string) (*MempoolPriceProvider, error) {
+	if err := checkAPIURL("price provider", baseURL); err != nil {
+		return nil, err
+	}
+	return &MempoolPriceProvider{BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// PriceUSD returns the current USD price.
+func (p *MempoolPriceProvider) PriceUSD(at time.Time) (float64, error) {
+	return p.PriceIn("USD", at)
+}
+
+// PriceIn returns the current price in currency.
+func (p *MempoolPriceProvider) PriceIn(currency string, at time.Time) (float64, error) {
+	cur, err := normalizeCurrency(currency)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := httpGet(p.Client, p.Timeout, p.BaseURL+"/v1/prices")
+	if err != nil {
+		return 0, err
+	}
+	var prices map[string]float64
+	if err := json.Unmarshal(raw, &prices); err != nil {
+		return 0, fmt.Errorf("prices: invalid response: %w", err)
+	}
+	v, ok := prices[cur]
+	if !ok || v <= 0 {
+		return 0, fmt.Errorf("price provider has no %s price", cur)
+	}
+	return v, nil
+}
+
+// Price of BTC in currency at a time; non-USD quotes need a FiatPriceProvider
+func priceIn(p PriceProvider, currency string, at time.Time) (float64, error) {
+	if fp, ok := p.(FiatPriceProvider); ok {
+		return fp.PriceIn(currency, at)
+	}
+	if currency != "USD" {
+		return 0, fmt.Errorf("price provider %T only quotes USD - use a FiatPriceProvider for %s", p, currency)
+	}
+	return p.PriceUSD(at)
+}
+
+// normalizeCurrency upper-cases an ISO 4217 code; empty means USD
+func normalizeCurrency(c string) (string, error) {
+	if c == "" {
+		return "USD", nil
+	}
+	c = strings.ToUpper(c)
+	if len(c) != 3 || strings.Trim(c, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid fiat currency %q - use an ISO 4217 code such as USD, EUR, JPY or GBP", c)
+	}
+	return c, nil
+}
+
+// Minor units of a currency for display (JPY and KRW have none)
+func fiatDecimals(currency string) int {
+	switch currency {
+	case "JPY", "KRW":
+		return 0
+	}
+	return 2
+}
+
+// satsToFiat converts satoshis to fiat at the given BTC price
+func satsToFiat(sats int64, price float64) float64 {
+	return float64(sats) / 1e8 * price
+}
+
+func formatFiat(v float64, currency string) string {
+	return strconv.FormatFloat(v, 'f', fiatDecimals(currency), 64)
+}
+
+// SetFiatCurrency sets the currency used for fiat valuations in reports and
+// accounting exports (default USD).
+func (s *Sweeper) SetFiatCurrency(currency string) error {
+	c, err := normalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	s.fiatCurrency = c
+	return nil
+}
+
+// FiatCurrency returns the currency used for fiat valuations.
+func (s *Sweeper) FiatCurrency() string {
+	if s.fiatCurrency == "" {
+		return "USD"
+	}
+	return s.fiatCurrency
+}
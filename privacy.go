@@ -0,0 +1,155 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains address clusters and cluster-aware coin selection.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetAddressClusters declares groups of addresses already known to belong
+// together, such as addresses published on one invoice or co-spent by
+// another wallet; SelectPrivacy treats each group as one cluster. Addresses
+// co-spent by the sweeper's own broadcast plans are linked automatically.
+// Passing nil clears the declared groups.
+func (s *Sweeper) SetAddressClusters(clusters [][]string) error {
+	linked := map[string]string{}
+	for i, c := range clusters {
+		if len(c) == 0 {
+			return fmt.Errorf("address cluster %d is empty", i)
+		}
+		for _, a := range c {
+			if prev, ok := linked[a]; ok && prev != c[0] {
+				return fmt.Errorf("address %s is in more than one cluster - merge them into one", a)
+			}
+			linked[a] = c[0]
+		}
+	}
+	s.addressClusters = linked
+	return nil
+}
+
+// Map each address to its cluster's representative: declared clusters joined
+// with the input sets of broadcast plans, as chain analysis would join them
+func (s *Sweeper) addressClusterMap() map[string]string {
+	parent := map[string]string{}
+	var find func(a string) string
+	find = func(a string) string {
+		p, ok := parent[a]
+		if !ok || p == a {
+			parent[a] = a
+			return a
+		}
+		root := find(p)
+		parent[a] = root
+		return root
+	}
+	union := func(a, b string) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+	for a, rep := range s.addressClusters {
+		union(rep, a)
+	}
+	for _, p := range s.plans {
+		if p.BroadcastAt == nil || len(p.Inputs) == 0 {
+			continue
+		}
+		for _, in := range p.Inputs[1:] {
+			union(p.Inputs[0].Address, in.Address)
+		}
+	}
+	out := make(map[string]string, len(parent))
+	for a := range parent {
+		out[a] = find(a)
+	}
+	return out
+}
+
+// clusterSelector picks inputs for SelectPrivacy: the cheapest single cluster
+// that covers the target, else whole clusters, largest first, until covered.
+type clusterSelector struct {
+	clusterOf map[string]string
+}
+
+// Cluster of an address; unclustered addresses are their own cluster
+func (c clusterSelector) cluster(addr string) string {
+	if rep, ok := c.clusterOf[addr]; ok {
+		return rep
+	}
+	return addr
+}
+
+// Select implements CoinSelector.
+func (c clusterSelector) Select(candidates []UTXO, target int64, feeRate FeeRate) ([]UTXO, error) {
+	return c.SelectWeighted(candidates, target, feeRate, flatInputVBytes)
+}
+
+// SelectWeighted implements WeightedCoinSelector.
+func (c clusterSelector) SelectWeighted(candidates []UTXO, target int64, feeRate FeeRate, inputVBytes func(UTXO) int64) ([]UTXO, error) {
+	var order []string
+	groups := map[string][]UTXO{}
+	totals := map[string]int64{}
+	for _, u := range candidates {
+		k := c.cluster(u.Address)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], u)
+		totals[k] += u.ValueSats
+	}
+
+	// One cluster suffices: fewest inputs, then least value tied up
+	var best []UTXO
+	var bestIn int64
+	for _, k := range order {
+		picked, err := GreedySelector{}.SelectWeighted(groups[k], target, feeRate, inputVBytes)
+		if err != nil {
+			continue
+		}
+		var in int64
+		for _, u := range picked {
+			in += u.ValueSats
+		}
+		if best == nil || len(picked) < len(best) || (len(picked) == len(best) && in < bestIn) {
+			best, bestIn = picked, in
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+
+	// Cross as few clusters as possible: the largest hold the most per link
+	sort.SliceStable(order, func(i, j int) bool { return totals[order[i]] > totals[order[j]] })
+	var merged []UTXO
+	for _, k := range order {
+		merged = append(merged, groups[k]...)
+	}
+	picked, err := GreedySelector{}.SelectWeighted(merged, target, feeRate, inputVBytes)
+	if err != nil {
+		return nil, errors.New("balance is not enough for outputs + fee, even across every address cluster")
+	}
+	return picked, nil
+}
+
+// LinkedAddresses returns how many distinct addresses the plan's inputs tie
+// together on chain.
+func (p *TransactionPlan) LinkedAddresses() int {
+	seen := map[string]bool{}
+	for _, in := range p.Inputs {
+		seen[in.Address] = true
+	}
+	return len(seen)
+}
+
+// Number of clusters a set of inputs spans
+func (s *Sweeper) linkedClusters(inputs []UTXO) int {
+	c := clusterSelector{clusterOf: s.addressClusterMap()}
+	seen := map[string]bool{}
+	for _, in := range inputs {
+		seen[c.cluster(in.Address)] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrivacySelectionKeepsClustersApart(t *testing.T) {
+	s := newTestSweeper(t)
+	coins := []UTXO{
+		{Vout: 0, ValueSats: 30_000, Address: testAddr("a")},
+		{Vout: 1, ValueSats: 30_000, Address: testAddr("a")},
+		{Vout: 2, ValueSats: 30_000, Address: testAddr("a")},
+		{Vout: 3, ValueSats: 60_000, Address: testAddr("b")},
+		{Vout: 4, ValueSats: 120_000, Address: testAddr("d")},
+	}
+	for _, u := range coins {
+		u.TxID, u.Confirmed = stringsRepeat("ab", 32), true
+		_ = s.Index(u)
+	}
+	privacy := SpendOptions{Selection: SelectPrivacy}
+	spend := func(v int64, opts ...SpendOptions) *TransactionPlan {
+		t.Helper()
+		p, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: v}}, opts...)
+		if err != nil {
+			t.Fatalf("Spend(%d): %v", v, err)
+		}
+		_ = s.DiscardPlan(p.ID)
+		return p
+	}
+
+	// Smallest-first co-spends two addresses; one address covers it alone
+	if p := spend(100_000); p.LinkedAddresses() != 2 {
+		t.Fatalf("smallest-first linked %d addresses", p.LinkedAddresses())
+	}
+	if p := spend(100_000, privacy); p.LinkedAddresses() != 1 || p.Inputs[0].Address != testAddr("d") || hasWarning(p, WarnLinkedClusters) {
+		t.Fatalf("privacy selection spent %+v", p.Inputs)
+	}
+
+	// No address covers 140k: cross the fewest clusters, and say so
+	p := spend(140_000, privacy)
+	if p.LinkedAddresses() != 2 || p.Inputs[0].Address != testAddr("d") || !hasWarning(p, WarnLinkedClusters) {
+		t.Fatalf("crossing spent %+v, warnings %+v", p.Inputs, p.Warnings)
+	}
+
+	// Addresses declared as one cluster cover it without a new link
+	if err := s.SetAddressClusters([][]string{{testAddr("a"), testAddr("b")}}); err != nil {
+		t.Fatalf("SetAddressClusters: %v", err)
+	}
+	p = spend(140_000, privacy)
+	if len(p.Inputs) != 4 || p.LinkedAddresses() != 2 || hasWarning(p, WarnLinkedClusters) {
+		t.Fatalf("declared cluster spent %+v, warnings %+v", p.Inputs, p.Warnings)
+	}
+	if err := s.SetAddressClusters([][]string{{testAddr("a")}, {testAddr("b"), testAddr("a")}}); err == nil {
+		t.Fatalf("expected an address in two clusters to be refused")
+	}
+
+	// Broadcasting a plan links its inputs from then on
+	_ = s.SetAddressClusters(nil)
+	p, _ = s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}})
+	_ = s.MarkBroadcast(p.ID, time.Now())
+	if n := s.linkedClusters(coins); n != 2 {
+		t.Fatalf("%d clusters after co-spending tb1a and tb1b, want 2", n)
+	}
+}
@@ -0,0 +1,136 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains signed receipts for finalized plans.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReceiptVersion is the version of the receipt format.
+const ReceiptVersion = 1
+
+// ReceiptInput is a coin spent by the receipted transaction.
+type ReceiptInput struct {
+	TxID      string `json:"txid"`
+	Vout      uint32 `json:"vout"`
+	ValueSats int64  `json:"value_sats"`
+	Address   string `json:"address"`
+}
+
+// ReceiptOutput is an output created by the receipted transaction.
+type ReceiptOutput struct {
+	Address   string `json:"address"`
+	ValueSats int64  `json:"value_sats"`
+	Change    bool   `json:"change,omitempty"`
+}
+
+// PlanReceipt is an operator-signed statement of what a finalized plan swept
+// and where, for auditors or customers. The signature is a BIP-340 Schnorr
+// signature by OperatorKey over ReceiptDigest, so anyone can check it with
+// VerifyReceipt and the operator's public key.
+type PlanReceipt struct {
+	Version     int             `json:"version"`
+	TxID        string          `json:"txid"`
+	WTxID       string          `json:"wtxid"`
+	Inputs      []ReceiptInput  `json:"inputs"`
+	Outputs     []ReceiptOutput `json:"outputs"`
+	FeeSats     int64           `json:"fee_sats"`
+	CreatedAt   time.Time       `json:"created_at"`
+	BroadcastAt *time.Time      `json:"broadcast_at,omitempty"`
+	ConfirmedAt *time.Time      `json:"confirmed_at,omitempty"`
+	IssuedAt    time.Time       `json:"issued_at"`
+	OperatorKey string          `json:"operator_key"` // x-only public key, hex
+	Signature   string          `json:"signature"`    // BIP-340 signature, hex
+}
+
+// ReceiptDigest is the message a receipt's signature covers: a tagged hash
+// of the receipt's JSON encoding with an empty signature.
+func ReceiptDigest(r *PlanReceipt) ([32]byte, error) {
+	c := *r
+	c.Signature = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return taggedHash("utxo-sweeper/receipt", b), nil
+}
+
+// IssueReceipt builds the receipt of a finalized plan and has signer sign it
+// with the operator's x-only key. The plan must have its signed transaction
+// imported; the receipt describes that transaction, not the unsigned plan.
+func (s *Sweeper) IssueReceipt(planID string, signer TaprootSigner, operatorKey []byte, now time.Time) (*PlanReceipt, error) {
+	p, ok := s.GetPlan(planID)
+	if !ok {
+		return nil, fmt.Errorf("no tracked plan %s", planID)
+	}
+	if p.SignedTx == nil {
+		return nil, errors.New("plan is not finalized - import the signed PSBT before issuing a receipt")
+	}
+	if signer == nil || len(operatorKey) != 32 {
+		return nil, errors.New("a receipt needs a signer and a 32-byte x-only operator key")
+	}
+	tx := p.SignedTx
+	if tx.TxID() != p.ID || len(tx.TxOut) != len(p.Outputs) || len(tx.TxIn) != len(p.Inputs) {
+		return nil, errors.New("signed transaction does not match the plan - re-import the signed PSBT")
+	}
+	wtxid := tx.WTxHash()
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		wtxid[i], wtxid[j] = wtxid[j], wtxid[i]
+	}
+	r := &PlanReceipt{
+		Version:     ReceiptVersion,
+		TxID:        p.ID,
+		WTxID:       hex.EncodeToString(wtxid[:]),
+		FeeSats:     p.FeeSats,
+		CreatedAt:   p.CreatedAt,
+		BroadcastAt: p.BroadcastAt,
+		ConfirmedAt: p.ConfirmedAt,
+		IssuedAt:    now.UTC(),
+		OperatorKey: hex.EncodeToString(operatorKey),
+	}
+	for _, in := range p.Inputs {
+		r.Inputs = append(r.Inputs, ReceiptInput{TxID: in.TxID, Vout: in.Vout, ValueSats: in.ValueSats, Address: in.Address})
+	}
+	change := map[int]bool{}
+	for _, i := range p.ChangeIdxs {
+		change[i] = true
+	}
+	for i, out := range tx.TxOut {
+		r.Outputs = append(r.Outputs, ReceiptOutput{Address: p.Outputs[i].Address, ValueSats: out.Value, Change: change[i]})
+	}
+	digest, err := ReceiptDigest(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.SignSchnorr(operatorKey, digest)
+	if err != nil {
+		return nil, fmt.Errorf("signer could not sign the receipt: %w", err)
+	}
+	if err := VerifySchnorr(operatorKey, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("receipt signature does not verify (%v) - check the operator key matches the signer", err)
+	}
+	r.Signature = hex.EncodeToString(sig)
+	return r, nil
+}
+
+// VerifyReceipt checks a receipt's signature against its operator key. Callers
+// should also check OperatorKey is the key they expect from the operator.
+func VerifyReceipt(r *PlanReceipt) error {
+	key, err := hex.DecodeString(r.OperatorKey)
+	if err != nil {
+		return fmt.Errorf("invalid operator key: %w", err)
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	digest, err := ReceiptDigest(r)
+	if err != nil {
+		return err
+	}
+	return VerifySchnorr(key, digest[:], sig)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestPlanReceipt(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 1, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	op := testSigner{d: big.NewInt(0x0123)}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := s.IssueReceipt(plan.ID, op, op.xOnly(), now); err == nil {
+		t.Fatalf("expected an unsigned plan to be refused")
+	}
+	plan.SignedTx = plan.RawTx
+	if _, err := s.IssueReceipt(plan.ID, testSigner{d: big.NewInt(7)}, op.xOnly(), now); err == nil {
+		t.Fatalf("expected a signer without the operator key to be refused")
+	}
+	r, err := s.IssueReceipt(plan.ID, op, op.xOnly(), now)
+	if err != nil {
+		t.Fatalf("IssueReceipt: %v", err)
+	}
+	if r.TxID != plan.ID || r.FeeSats != plan.FeeSats || len(r.Inputs) != 1 || r.Inputs[0].Vout != 1 {
+		t.Fatalf("unexpected receipt %+v", r)
+	}
+	if len(r.Outputs) != 2 || r.Outputs[0].Address != testAddr("dest") || r.Outputs[0].ValueSats != 50_000 || !r.Outputs[plan.ChangeIdxs[0]].Change {
+		t.Fatalf("unexpected receipt outputs %+v", r.Outputs)
+	}
+
+	// The receipt survives a JSON round trip and any edit breaks it
+	b, _ := json.Marshal(r)
+	var got PlanReceipt
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := VerifyReceipt(&got); err != nil {
+		t.Fatalf("VerifyReceipt: %v", err)
+	}
+	got.Outputs[0].Address = testAddr("other")
+	if err := VerifyReceipt(&got); err == nil {
+		t.Fatalf("expected a tampered receipt to fail verification")
+	}
+}
@@ -0,0 +1,225 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the remote signing service client for hybrid custody.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Request signing headers: the key id, the unix time of the request and
+// hex(HMAC-SHA256(secret, timestamp + "\n" + body))
+const (
+	RemoteSignKeyHeader       = "X-Sweeper-Key-Id"
+	RemoteSignTimestampHeader = "X-Sweeper-Timestamp"
+	RemoteSignSignatureHeader = "X-Sweeper-Signature"
+)
+
+// ErrSignerRefused wraps a signing service's refusal, e.g. a destination
+// outside its allowlist. Refusals are final and never retried.
+var ErrSignerRefused = errors.New("remote signer refused")
+
+// RemoteSignRequest is the JSON body sent to the signing service. The
+// destination and change outputs repeat what the PSBT pays so the service can
+// enforce its destination allowlist without decoding the transaction.
+type RemoteSignRequest struct {
+	PlanID       string          `json:"plan_id"` // Expected txid; services can deduplicate retries on it
+	Network      Network         `json:"network"`
+	PSBT         string          `json:"psbt"`         // Unsigned PSBT, base64
+	Destinations []TxOutput      `json:"destinations"` // Non-change outputs
+	Change       []TxOutput      `json:"change,omitempty"`
+	FeeSats      int64           `json:"fee_sats"`
+	Annotation   *PlanAnnotation `json:"annotation,omitempty"`
+}
+
+// RemoteSignResponse is the service's reply: a signed PSBT, or the reason
+// it refused to sign.
+type RemoteSignResponse struct {
+	PSBT  string `json:"psbt,omitempty"` // Signed PSBT, base64
+	Error string `json:"error,omitempty"`
+}
+
+// RemoteSigner sends PSBTs to an HTTPS signing service (such as an HSM
+// front end) and receives them signed: the sweeper plans locally and never
+// holds keys. Requests are authenticated with an HMAC over the timestamp and
+// body; network errors, timeouts, 429 and 5xx responses are retried with
+// exponential backoff, other 4xx responses are refusals.
+type RemoteSigner struct {
+	URL      string
+	KeyID    string        // Tells the service which secret signed the request
+	Secret   []byte        // HMAC-SHA256 key shared with the service
+	Timeout  time.Duration // Per attempt (0 = 30s)
+	Attempts int           // Tries per request, the first included (0 = 3)
+	Backoff  time.Duration // Wait before the first retry, doubling after each (0 = 1s)
+	Client   *http.Client  // nil = http.DefaultClient; Timeout still bounds each attempt
+}
+
+// NewRemoteSigner checks the endpoint and credentials. The URL must be https;
+// plain http is accepted only for loopback addresses.
+func NewRemoteSigner(rawURL, keyID string, secret []byte) (*RemoteSigner, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("remote signer URL %q must be an absolute https URL", rawURL)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return nil, fmt.Errorf("remote signer URL %q must use https (http only for loopback)", rawURL)
+	}
+	if keyID == "" || len(secret) < 16 {
+		return nil, errors.New("remote signer needs a key id and a secret of at least 16 bytes")
+	}
+	return &RemoteSigner{URL: rawURL, KeyID: keyID, Secret: secret}, nil
+}
+
+// Whether host names the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// SignRequestBody returns the request signature for body sent at ts, for
+// services verifying requests and for tests.
+func SignRequestBody(secret, body []byte, ts time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10) + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign sends req and returns the signed PSBT.
+func (rs *RemoteSigner) Sign(req *RemoteSignRequest) (*PSBT, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	attempts, backoff := rs.Attempts, rs.Backoff
+	if attempts <= 0 {
+		attempts = 3
+	}
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		resp, retry, err := rs.post(body)
+		if err == nil {
+			return DecodePSBTB64(resp.PSBT)
+		}
+		if !retry {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("remote signer failed after %d attempts: %w", attempts, lastErr)
+}
+
+// One signed POST; reports whether a failure is worth retrying
+func (rs *RemoteSigner) post(body []byte) (*RemoteSignResponse, bool, error) {
+	timeout := rs.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rs.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RemoteSignKeyHeader, rs.KeyID)
+	req.Header.Set(RemoteSignTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(RemoteSignSignatureHeader, SignRequestBody(rs.Secret, body, now))
+	client := rs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, true, err
+	}
+	var out RemoteSignResponse
+	jsonErr := json.Unmarshal(raw, &out)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return nil, true, errors.New("remote signer returned " + resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		reason := out.Error
+		if reason == "" {
+			reason = resp.Status
+		}
+		return nil, false, fmt.Errorf("%w: %s", ErrSignerRefused, reason)
+	case jsonErr != nil:
+		return nil, false, fmt.Errorf("remote signer sent an invalid response: %w", jsonErr)
+	case out.Error != "":
+		return nil, false, fmt.Errorf("%w: %s", ErrSignerRefused, out.Error)
+	case out.PSBT == "":
+		return nil, false, errors.New("remote signer response has no PSBT")
+	}
+	return &out, false, nil
+}
+
+// SignRemote has rs sign plan id and records the finalized transaction, as
+// ImportSignedBatch does for file-based signing. The returned PSBT must sign
+// exactly the planned transaction.
+func (s *Sweeper) SignRemote(id string, rs *RemoteSigner) (*MsgTx, error) {
+	p, ok := s.plans[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown plan %q", id)
+	}
+	if rs == nil {
+		return nil, errors.New("no remote signer given - see NewRemoteSigner")
+	}
+	b64, err := p.PSBT.B64Encode()
+	if err != nil {
+		return nil, err
+	}
+	req := &RemoteSignRequest{PlanID: p.ID, Network: s.network, PSBT: b64, FeeSats: p.FeeSats, Annotation: p.Annotation}
+	for i, o := range p.Outputs {
+		if p.IsChange(i) {
+			req.Change = append(req.Change, o)
+		} else {
+			req.Destinations = append(req.Destinations, o)
+		}
+	}
+	signed, err := rs.Sign(req)
+	if err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	tx, err := finalizeSignedPSBT(p, signed)
+	if err != nil {
+		return nil, fmt.Errorf("plan %s: %w", id, err)
+	}
+	if err := transitionPlan(p, PlanSigned, time.Now(), "remote signer "+rs.KeyID); err != nil {
+		return nil, err
+	}
+	p.SignedTx = tx
+	if err := s.savePlan(p); err != nil {
+		return nil, err
+	}
+	s.logger.Printf("plan %s signed by remote signer %s", id, rs.KeyID)
+	return tx, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A signing service that checks request signatures, fails its first
+// `flaky` requests and refuses destinations outside allow
+func remoteSignService(t *testing.T, secret []byte, key testECDSAKey, flaky int32, allow string) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		sec, _ := strconv.ParseInt(r.Header.Get(RemoteSignTimestampHeader), 10, 64)
+		if r.Header.Get(RemoteSignKeyHeader) != "ops-1" || r.Header.Get(RemoteSignSignatureHeader) != SignRequestBody(secret, body, time.Unix(sec, 0)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if n <= flaky {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var req RemoteSignRequest
+		_ = json.Unmarshal(body, &req)
+		for _, d := range req.Destinations {
+			if d.Address != allow {
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(RemoteSignResponse{Error: "destination " + d.Address + " not allowlisted"})
+				return
+			}
+		}
+		ps, err := DecodePSBTB64(req.PSBT)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		key.signPSBT(t, ps)
+		b64, _ := ps.B64Encode()
+		_ = json.NewEncoder(w).Encode(RemoteSignResponse{PSBT: b64})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestSignRemote(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(1)}
+	pk := key.pub()
+	addr, _ := CreateP2WPKH(Hash160(pk), BitcoinTestnet)
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: addr, Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+
+	secret := []byte("0123456789abcdef")
+	srv, calls := remoteSignService(t, secret, key, 1, DEFAULT_DEST_ADDR)
+	rs, err := NewRemoteSigner(srv.URL, "ops-1", secret)
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	rs.Backoff = time.Millisecond
+	tx, err := s.SignRemote(plan.ID, rs)
+	if err != nil {
+		t.Fatalf("SignRemote: %v", err)
+	}
+	if *calls != 2 || tx.TxID() != plan.ID || plan.Status != PlanSigned || plan.SignedTx == nil {
+		t.Fatalf("calls %d, txid %s, status %s", *calls, tx.TxID(), plan.Status)
+	}
+
+	// A refusal is final; a wrong secret is refused too
+	srv2, calls2 := remoteSignService(t, secret, key, 0, testAddr("elsewhere"))
+	rs2, _ := NewRemoteSigner(srv2.URL, "ops-1", secret)
+	rs2.Backoff = time.Millisecond
+	if _, err := s.SignRemote(plan.ID, rs2); !errors.Is(err, ErrSignerRefused) || *calls2 != 1 {
+		t.Fatalf("expected a single refused call, got %v after %d calls", err, *calls2)
+	}
+	rs2.Secret = []byte("fedcba9876543210")
+	if _, err := s.SignRemote(plan.ID, rs2); !errors.Is(err, ErrSignerRefused) {
+		t.Fatalf("expected a badly signed request to be refused, got %v", err)
+	}
+
+	if _, err := NewRemoteSigner("http://signer.example.com/sign", "ops-1", secret); err == nil {
+		t.Fatalf("expected plain http to a remote host to be refused")
+	}
+	if _, err := NewRemoteSigner("https://signer.example.com/sign", "ops-1", []byte("short")); err == nil {
+		t.Fatalf("expected a short secret to be refused")
+	}
+}
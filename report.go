@@ -0,0 +1,97 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains dry-run reports that estimate costs without building plans.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConsolidationScenario is the estimated cost of consolidating at one fee rate.
+type ConsolidationScenario struct {
+	FeeRate          int64   `json:"fee_rate"`            // sat/vB
+	FeeSats          int64   `json:"fee_sats"`            // Total fee to consolidate now
+	FeePercent       float64 `json:"fee_percent"`         // Fee as a percentage of the consolidated value
+	NetSats          int64   `json:"net_sats"`            // Value left after the fee
+	BreakEvenFeeRate float64 `json:"break_even_fee_rate"` // Future sat/vB above which consolidating now is cheaper
+	Economical       bool    `json:"economical"`          // Whether the consolidated output would be above dust
+	// Whether consolidating now costs less than spending the inputs later at
+	// the long-term fee rate (only with SetLongTermFeeRate)
+	ConsolidateNow bool `json:"consolidate_now,omitempty"`
+}
+
+// ConsolidationReport estimates the cost of sweeping the current spendable set
+// into a single output at several fee rates.
+type ConsolidationReport struct {
+	UTXOCount       int                     `json:"utxo_count"`                   // Spendable UTXOs after filters
+	TotalSats       int64                   `json:"total_sats"`                   // Their combined value
+	VBytes          int64                   `json:"vbytes"`                       // Size of the consolidation transaction
+	InputVBytes     int64                   `json:"input_vbytes"`                 // Size attributable to the inputs
+	SavedVBytes     int64                   `json:"saved_vbytes"`                 // Input vbytes avoided on every future spend
+	DustSats        int64                   `json:"dust_sats"`                    // Dust threshold applied
+	Scenarios       []ConsolidationScenario `json:"scenarios"`                    // One entry per requested fee rate
+	LongTermFeeRate float64                 `json:"long_term_fee_rate,omitempty"` // sat/vB, from SetLongTermFeeRate
+	Note            string                  `json:"note,omitempty"`               // Caveats, e.g. nothing to gain
+}
+
+// ConsolidationCostReport estimates, without planning, the fee to consolidate
+// the current UTXO set at each fee rate, together with the break-even future
+// fee rate: the rate at which spending the inputs individually later would cost
+// as much as consolidating now plus spending the single consolidated output.
+// With a long-term fee rate set, scenarios whose break-even rate is below it
+// are marked ConsolidateNow.
+func (s *Sweeper) ConsolidationCostReport(feeRates []int64) (*ConsolidationReport, error) {
+	if len(feeRates) == 0 {
+		return nil, errors.New("no fee rates given - provide at least one sat/vB value")
+	}
+	for _, r := range feeRates {
+		if r <= 0 {
+			return nil, fmt.Errorf("fee rate must be positive (got %d sat/vB)", r)
+		}
+	}
+	if _, err := s.reloadUTXOLocks(); err != nil {
+		return nil, err
+	}
+	p := s.defaultSpendParams()
+	cands := s.filterUTXOs(s.indexedUTXOs, p)
+	if len(cands) == 0 {
+		return nil, errors.New("no spendable UTXOs to consolidate")
+	}
+	changeAddr, err := s.getChangeAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change address: %w", err)
+	}
+	dust := s.dustFor(changeAddr, p)
+
+	rep := &ConsolidationReport{UTXOCount: len(cands), DustSats: dust, LongTermFeeRate: s.longTermFeeRate.SatPerVB()}
+	for _, u := range cands {
+		rep.TotalSats += u.ValueSats
+	}
+	out := []TxOutput{{Address: changeAddr}}
+	rep.VBytes = estimateTxVBytesDetailed(s, cands, out)
+	base := estimateTxVBytesDetailed(s, nil, nil)
+	rep.InputVBytes = estimateTxVBytesDetailed(s, cands, nil) - base
+	// After consolidating, a future spend needs one input of the destination's type
+	consolidatedIn := estimateTxVBytesDetailed(s, []UTXO{{Address: changeAddr}}, nil) - base
+	rep.SavedVBytes = rep.InputVBytes - consolidatedIn
+	if rep.SavedVBytes <= 0 {
+		rep.Note = "a single UTXO gains nothing from consolidation"
+	}
+
+	for _, r := range feeRates {
+		fee := rep.VBytes * r
+		sc := ConsolidationScenario{
+			FeeRate:    r,
+			FeeSats:    fee,
+			FeePercent: 100 * float64(fee) / float64(rep.TotalSats),
+			NetSats:    rep.TotalSats - fee,
+			Economical: rep.TotalSats-fee >= dust,
+		}
+		if rep.SavedVBytes > 0 {
+			sc.BreakEvenFeeRate = float64(fee) / float64(rep.SavedVBytes)
+			sc.ConsolidateNow = s.longTermFeeRate > 0 && sc.Economical && sc.BreakEvenFeeRate < rep.LongTermFeeRate
+		}
+		rep.Scenarios = append(rep.Scenarios, sc)
+	}
+	return rep, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestConsolidationCostReportBreakEven(t *testing.T) {
+	s := newTestSweeper(t)
+	for i, c := range []string{"a", "b", "c"} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(c, 64), Vout: uint32(i), ValueSats: 50_000, Address: testAddr("in"), Confirmed: true})
+	}
+	rep, err := s.ConsolidationCostReport([]int64{2, 10})
+	if err != nil {
+		t.Fatalf("ConsolidationCostReport: %v", err)
+	}
+	if rep.UTXOCount != 3 || rep.TotalSats != 150_000 {
+		t.Fatalf("unexpected totals: %+v", rep)
+	}
+	// Test mode prices everything as P2WPKH: 3 inputs collapse into 1, saving 2*68 vB
+	if rep.SavedVBytes != 136 {
+		t.Fatalf("expected 136 saved vbytes, got %d", rep.SavedVBytes)
+	}
+	sc := rep.Scenarios[1]
+	if sc.FeeSats != rep.VBytes*10 {
+		t.Fatalf("fee mismatch")
+	}
+	if want := float64(sc.FeeSats) / 136; sc.BreakEvenFeeRate != want {
+		t.Fatalf("break-even %f, want %f", sc.BreakEvenFeeRate, want)
+	}
+	if len(s.PendingPlans()) != 0 {
+		t.Fatalf("report must not create plans")
+	}
+}
@@ -0,0 +1,179 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains rebuilding a plan around inputs a signer refused.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Signature hash flags relevant to carrying signatures into a rebuilt transaction
+const (
+	sighashAll          = 0x01
+	sighashNone         = 0x02
+	sighashSingle       = 0x03
+	sighashAnyoneCanPay = 0x80
+)
+
+// ResumeResult is a plan rebuilt without the inputs a signer refused.
+type ResumeResult struct {
+	Plan        *TransactionPlan `json:"plan"`
+	Excluded    []UTXO           `json:"excluded"`     // Inputs left out
+	CarriedSigs int              `json:"carried_sigs"` // Signatures copied into the new PSBT
+	DroppedSigs int              `json:"dropped_sigs"` // Signatures the changed transaction invalidates
+}
+
+// ResumePlan rebuilds pending plan id without the inputs at the given
+// outpoints ("txid:vout"), e.g. after an HSM refused to sign one of them. The
+// recipients and the plan's recorded settings (fee rate, RBF, selection and so
+// on) are kept; the remaining inputs are reused when they still cover the
+// recipients, otherwise selection falls back to the whole index. The old plan
+// is discarded and the new one tracked in its place.
+//
+// Signatures from signed (the partially signed PSBT, may be nil) carry over
+// only where they stay valid. SIGHASH_ALL signatures, the usual kind, commit to
+// every input and output, so they are dropped and those inputs must be signed
+// again; ANYONECANPAY signatures carry over when the outputs they commit to are
+// unchanged.
+func (s *Sweeper) ResumePlan(id string, signed *PSBT, exclude ...string) (*ResumeResult, error) {
+	defer s.templateScope()()
+	old, ok := s.plans[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown plan %q", id)
+	}
+	if len(exclude) == 0 {
+		return nil, errors.New("no inputs to exclude - pass the outpoints the signer refused")
+	}
+	if signed != nil && len(signed.Inputs) != len(old.Inputs) {
+		return nil, fmt.Errorf("signed PSBT has %d inputs but plan %s has %d", len(signed.Inputs), id, len(old.Inputs))
+	}
+
+	p := paramsFromSettings(old.Settings)
+	p.exclude = map[string]bool{}
+	for _, op := range exclude {
+		p.exclude[op] = true
+	}
+	res := &ResumeResult{}
+	var keep []UTXO
+	for _, in := range old.Inputs {
+		if p.exclude[outpointKey(in)] {
+			res.Excluded = append(res.Excluded, in)
+		} else {
+			keep = append(keep, in)
+		}
+	}
+	if len(res.Excluded) != len(exclude) {
+		return nil, fmt.Errorf("plan %s spends %d of the %d excluded outpoints - pass only its own inputs", id, len(res.Excluded), len(exclude))
+	}
+	var recipients []TxOutput
+	for i, o := range old.Outputs {
+		if !old.IsChange(i) {
+			recipients = append(recipients, o)
+		}
+	}
+	changeAddr, err := s.getChangeAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change address: %w", err)
+	}
+
+	// Release the old plan's inputs while rebuilding; restore it on failure
+	delete(s.plans, id)
+	plan, err := s.buildTransaction(keep, recipients, changeAddr, p)
+	if err != nil {
+		plan, err = s.buildTransaction(s.indexedUTXOs, recipients, changeAddr, p)
+	}
+	s.plans[id] = old
+	if err != nil {
+		return nil, fmt.Errorf("cannot rebuild plan %s without the excluded inputs: %w", id, err)
+	}
+	if err := s.DiscardPlan(id); err != nil {
+		return nil, err
+	}
+	res.Plan = plan
+
+	if signed != nil {
+		sameOutputs := outputsEqual(old.RawTx, plan.RawTx)
+		for j, in := range old.Inputs {
+			sigs := signed.Inputs[j].PartialSigs
+			i := inputIndex(plan.Inputs, in)
+			for pk, sig := range sigs {
+				if i >= 0 && sigSurvives(sig, sameOutputs) {
+					plan.PSBT.Inputs[i].PartialSigs[pk] = sig
+					res.CarriedSigs++
+				} else if i >= 0 {
+					res.DroppedSigs++
+				}
+			}
+		}
+		if res.CarriedSigs > 0 {
+			if err := s.savePlan(plan); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.logger.Printf("resumed %s as %s: excluded %d input(s), carried %d signature(s), dropped %d", id, plan.ID, len(res.Excluded), res.CarriedSigs, res.DroppedSigs)
+	return res, nil
+}
+
+// Spend parameters that reproduce a plan's recorded settings
+func paramsFromSettings(st PlanSettings) spendParams {
+	return spendParams{
+		feeRate:      st.feeRateKVB(),
+		dustOverride: st.DustSats,
+		rbf:          st.RBF,
+		selection:    st.Selection,
+		minConf:      st.MinConfirmations,
+		change:       st.ChangePolicy,
+		tieBreak:     st.TieBreak,
+		tieSeed:      st.TieBreakSeed,
+		lockTime:     st.LockTime,
+
+		overrideDestLimit: st.DestLimitOverride,
+	}
+}
+
+// Whether a signature stays valid after the transaction was rebuilt. Only
+// ANYONECANPAY signatures ignore the other inputs; of those, SIGHASH_NONE ignores
+// the outputs too and SIGHASH_ALL needs them unchanged. 64-byte Schnorr
+// signatures use SIGHASH_DEFAULT, which behaves like SIGHASH_ALL.
+func sigSurvives(sig []byte, sameOutputs bool) bool {
+	if len(sig) == 0 || len(sig) == 64 {
+		return false
+	}
+	ht := sig[len(sig)-1]
+	if ht&sighashAnyoneCanPay == 0 {
+		return false
+	}
+	switch ht &^ sighashAnyoneCanPay {
+	case sighashNone:
+		return true
+	case sighashAll:
+		return sameOutputs
+	default:
+		return false
+	}
+}
+
+// Position of u's outpoint among inputs, or -1
+func inputIndex(inputs []UTXO, u UTXO) int {
+	for i, in := range inputs {
+		if outpointKey(in) == outpointKey(u) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Whether two transactions have byte-identical outputs
+func outputsEqual(a, b *MsgTx) bool {
+	if len(a.TxOut) != len(b.TxOut) {
+		return false
+	}
+	for i := range a.TxOut {
+		if a.TxOut[i].Value != b.TxOut[i].Value || !bytes.Equal(a.TxOut[i].PkScript, b.TxOut[i].PkScript) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestResumePlanExcludesRefusedInput(t *testing.T) {
+	s := newTestSweeper(t)
+	a := UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 40_000, Address: testAddr("in"), Confirmed: true}
+	b := UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 50_000, Address: testAddr("in"), Confirmed: true}
+	c := UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 60_000, Address: testAddr("in"), Confirmed: true}
+	for _, u := range []UTXO{a, b, c} {
+		_ = s.Index(u)
+	}
+	old, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 70_000}}, SpendOptions{FeeRate: 3})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(old.Inputs) != 2 {
+		t.Fatalf("expected a and b to be selected, got %d inputs", len(old.Inputs))
+	}
+
+	// The signer returns a signed with ANYONECANPAY|NONE and b with ALL, then
+	// rejects b on a second pass
+	signed := old.PSBT
+	signed.Inputs[0].PartialSigs["pk"] = []byte{0x30, 0x01, sighashAnyoneCanPay | sighashNone}
+	signed.Inputs[1].PartialSigs["pk"] = []byte{0x30, 0x01, sighashAll}
+	res, err := s.ResumePlan(old.ID, signed, outpointKey(b))
+	if err != nil {
+		t.Fatalf("ResumePlan: %v", err)
+	}
+	if _, ok := s.GetPlan(old.ID); ok {
+		t.Fatalf("old plan should be discarded")
+	}
+	for _, in := range res.Plan.Inputs {
+		if in.TxID == b.TxID {
+			t.Fatalf("excluded input was selected again")
+		}
+	}
+	if res.Plan.Outputs[0].Address != testAddr("dest") || res.Plan.Outputs[0].ValueSats != 70_000 || res.Plan.Settings.FeeRate != 3 {
+		t.Fatalf("recipients or fee target not preserved: %+v", res.Plan.Outputs)
+	}
+	if res.CarriedSigs != 1 || res.Plan.PSBT.Inputs[inputIndex(res.Plan.Inputs, a)].PartialSigs["pk"] == nil {
+		t.Fatalf("expected the ANYONECANPAY|NONE signature to carry over, got %+v", res)
+	}
+
+	if _, err := s.ResumePlan(res.Plan.ID, nil, outpointKey(b)); err == nil {
+		t.Fatalf("expected an error for an outpoint the plan does not spend")
+	}
+}
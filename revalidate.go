@@ -0,0 +1,125 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains periodic re-validation of indexed UTXOs against a backend.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RevalidationResult describes one re-validation pass.
+type RevalidationResult struct {
+	Addresses []string `json:"addresses"` // Addresses checked in this pass
+	Checked   int      `json:"checked"`   // Indexed UTXOs held by those addresses
+	Evicted   []UTXO   `json:"evicted"`   // No longer unspent at the backend
+	Updated   []UTXO   `json:"updated"`   // Confirmation status refreshed
+}
+
+// RevalidateIndex re-checks indexed UTXOs against src and evicts those the
+// backend no longer reports as unspent (e.g. spent by another wallet instance),
+// refreshing confirmation status for the rest. To keep backend load bounded,
+// each call covers at most maxAddresses addresses (0 = all), continuing
+// round-robin from where the previous call stopped.
+func (s *Sweeper) RevalidateIndex(src UTXOSource, maxAddresses int) (*RevalidationResult, error) {
+	if src == nil {
+		return nil, errors.New("no UTXO source given")
+	}
+	if maxAddresses < 0 {
+		return nil, fmt.Errorf("maxAddresses must be non-negative (got %d)", maxAddresses)
+	}
+	batch := s.nextRevalidationBatch(maxAddresses)
+	res := &RevalidationResult{Addresses: batch}
+	if len(batch) == 0 {
+		return res, nil
+	}
+	remote, err := src.ListUnspent(batch)
+	if err != nil {
+		return nil, fmt.Errorf("backend ListUnspent failed: %w", err)
+	}
+	unspent := map[string]UTXO{}
+	for _, r := range remote {
+		unspent[outpointKey(r)] = r
+	}
+	inBatch := map[string]bool{}
+	for _, a := range batch {
+		inBatch[a] = true
+	}
+
+	// Build a new slice: callers may still hold the old one
+	indexed := s.indexedUTXOs
+	kept := make([]UTXO, 0, len(indexed))
+	for _, u := range indexed {
+		if !inBatch[u.Address] {
+			kept = append(kept, u)
+			continue
+		}
+		res.Checked++
+		r, ok := unspent[outpointKey(u)]
+		if !ok {
+			res.Evicted = append(res.Evicted, u)
+			if id := s.pendingPlanSpending(u); id != "" {
+				s.logger.Printf("evicted %s:%d is an input of pending plan %s - it will not broadcast", u.TxID, u.Vout, id)
+			}
+			continue
+		}
+		if r.Confirmed != u.Confirmed || r.Confirmations != u.Confirmations || r.BlockHeight != u.BlockHeight {
+			u.Confirmed, u.Confirmations, u.BlockHeight = r.Confirmed, r.Confirmations, r.BlockHeight
+			res.Updated = append(res.Updated, u)
+		}
+		kept = append(kept, u)
+	}
+	s.indexedUTXOs = kept
+	for _, u := range res.Evicted {
+		if err := s.kvDelete("utxo:" + outpointKey(u)); err != nil {
+			return res, fmt.Errorf("failed to delete %s from storage: %w", outpointKey(u), err)
+		}
+	}
+	if len(res.Evicted) > 0 {
+		s.logger.Printf("revalidation evicted %d spent UTXO(s)", len(res.Evicted))
+	}
+	return res, nil
+}
+
+// Pick the next round-robin batch of indexed addresses and advance the cursor
+func (s *Sweeper) nextRevalidationBatch(max int) []string {
+	set := map[string]bool{}
+	for _, u := range s.indexedUTXOs {
+		set[u.Address] = true
+	}
+	addrs := make([]string, 0, len(set))
+	for a := range set {
+		addrs = append(addrs, a)
+	}
+	sort.Strings(addrs)
+	if max == 0 || max >= len(addrs) {
+		s.revalidateAfter = ""
+		return addrs
+	}
+	// Resume after the last address checked, even if addresses came or went since
+	start := sort.SearchStrings(addrs, s.revalidateAfter)
+	if start < len(addrs) && addrs[start] == s.revalidateAfter {
+		start++
+	}
+	batch := make([]string, 0, max)
+	for i := 0; i < max; i++ {
+		batch = append(batch, addrs[(start+i)%len(addrs)])
+	}
+	s.revalidateAfter = batch[len(batch)-1]
+	return batch
+}
+
+// ID of the unconfirmed plan that spends u, if any
+func (s *Sweeper) pendingPlanSpending(u UTXO) string {
+	for id, p := range s.plans {
+		if !p.inFlight() {
+			continue
+		}
+		for _, in := range p.Inputs {
+			if outpointKey(in) == outpointKey(u) {
+				return id
+			}
+		}
+	}
+	return ""
+}
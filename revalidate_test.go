@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevalidateIndexEvictsSpentInBatches(t *testing.T) {
+	s := newTestSweeper(t)
+	// The addresses sort in-a, in-b, in-c: the round-robin order
+	a := UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in-a"), Confirmed: false}
+	b := UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in-b"), Confirmed: true}
+	c := UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in-c"), Confirmed: true}
+	for _, u := range []UTXO{a, b, c} {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	confirmedA := a
+	confirmedA.Confirmed, confirmedA.Confirmations = true, 1
+	src := fakeSource{confirmedA, c} // b was spent elsewhere
+	held := s.indexedUTXOs
+
+	res, err := s.RevalidateIndex(src, 2)
+	if err != nil {
+		t.Fatalf("RevalidateIndex: %v", err)
+	}
+	if len(held) != 3 || held[1].TxID != b.TxID || held[0].Confirmed {
+		t.Fatalf("revalidation rewrote a slice a caller still holds: %+v", held)
+	}
+	if len(res.Addresses) != 2 || len(res.Evicted) != 1 || res.Evicted[0].TxID != b.TxID {
+		t.Fatalf("first pass = %+v", res)
+	}
+	if len(res.Updated) != 1 || !s.GetIndexedUTXOs()[0].Confirmed {
+		t.Fatalf("expected a's confirmation to be refreshed")
+	}
+	res, err = s.RevalidateIndex(src, 1)
+	if err != nil {
+		t.Fatalf("RevalidateIndex: %v", err)
+	}
+	if len(res.Addresses) != 1 || res.Addresses[0] != testAddr("in-c") || len(res.Evicted) != 0 {
+		t.Fatalf("second pass should continue round-robin, got %+v", res)
+	}
+	if len(s.GetIndexedUTXOs()) != 2 {
+		t.Fatalf("expected two UTXOs left, got %d", len(s.GetIndexedUTXOs()))
+	}
+}
+
+func TestSchedulerRunsRevalidationAtInterval(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in-a"), Confirmed: true})
+	sc, err := NewScheduler(s, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	passes := 0
+	sc.OnRevalidate = func(res *RevalidationResult, err error) { passes++ }
+	if err := sc.SetRevalidation(fakeSource{}, time.Hour, 0); err != nil {
+		t.Fatalf("SetRevalidation: %v", err)
+	}
+	now := time.Now()
+	sc.Tick(now, 0)
+	sc.Wait()
+	sc.Tick(now.Add(time.Minute), 0)
+	sc.Wait()
+	if passes != 1 || len(s.GetIndexedUTXOs()) != 0 {
+		t.Fatalf("expected one pass evicting the UTXO, got %d passes", passes)
+	}
+}
@@ -1,8 +1,8 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the pure-Go RIPEMD-160 compression function behind
+// NewRIPEMD160 and Hash160.
 package main
 
-// Pure-Go RIPEMD-160 implementation (public domain-inspired minimal version)
-// Implements the standard RIPEMD-160 hash.Hash interface subset used here.
-
 type ripemd160State struct {
 	h0, h1, h2, h3, h4 uint32
 	x                  [16]uint32
@@ -12,22 +12,20 @@ type ripemd160State struct {
 
 type ripemd160Hash struct{ s ripemd160State }
 
-func NewRIPEMD160() *ripemd160Hash {
-	var h ripemd160Hash
-	h.Reset()
-	return &h
-}
-
 func (h *ripemd160Hash) Reset() {
 	h.s.h0 = 0x67452301
 	h.s.h1 = 0xefcdab89
 	h.s.h2 = 0x98badcfe
 	h.s.h3 = 0x10325476
 	h.s.h4 = 0xc3d2e1f0
+	h.s.x = [16]uint32{}
 	h.s.nx = 0
 	h.s.len = 0
 }
 
+func (h *ripemd160Hash) Size() int      { return 20 }
+func (h *ripemd160Hash) BlockSize() int { return 64 }
+
 func (h *ripemd160Hash) Write(p []byte) (int, error) {
 	n := len(p)
 	h.s.len += uint64(n)
@@ -90,299 +88,67 @@ func putu32le(b []byte, v uint32) {
 	b[3] = byte(v >> 24)
 }
 
+// Message word order, rotation amounts and constants for the left and right lines
+var (
+	rmdRL = [80]uint{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		7, 4, 13, 1, 10, 6, 15, 3, 12, 0, 9, 5, 2, 14, 11, 8,
+		3, 10, 14, 4, 9, 15, 8, 1, 2, 7, 0, 6, 13, 11, 5, 12,
+		1, 9, 11, 10, 0, 8, 12, 4, 13, 3, 7, 15, 14, 5, 6, 2,
+		4, 0, 5, 9, 7, 12, 2, 10, 14, 1, 3, 8, 11, 6, 15, 13,
+	}
+	rmdRR = [80]uint{
+		5, 14, 7, 0, 9, 2, 11, 4, 13, 6, 15, 8, 1, 10, 3, 12,
+		6, 11, 3, 7, 0, 13, 5, 10, 14, 15, 8, 12, 4, 9, 1, 2,
+		15, 5, 1, 3, 7, 14, 6, 9, 11, 8, 12, 2, 10, 0, 4, 13,
+		8, 6, 4, 1, 3, 11, 15, 0, 5, 12, 2, 13, 9, 7, 10, 14,
+		12, 15, 10, 4, 1, 5, 8, 7, 6, 2, 13, 14, 0, 3, 9, 11,
+	}
+	rmdSL = [80]uint{
+		11, 14, 15, 12, 5, 8, 7, 9, 11, 13, 14, 15, 6, 7, 9, 8,
+		7, 6, 8, 13, 11, 9, 7, 15, 7, 12, 15, 9, 11, 7, 13, 12,
+		11, 13, 6, 7, 14, 9, 13, 15, 14, 8, 13, 6, 5, 12, 7, 5,
+		11, 12, 14, 15, 14, 15, 9, 8, 9, 14, 5, 6, 8, 6, 5, 12,
+		9, 15, 5, 11, 6, 8, 13, 12, 5, 12, 13, 14, 11, 8, 5, 6,
+	}
+	rmdSR = [80]uint{
+		8, 9, 9, 11, 13, 15, 15, 5, 7, 7, 8, 11, 14, 14, 12, 6,
+		9, 13, 15, 7, 12, 8, 9, 11, 7, 7, 12, 7, 6, 15, 13, 11,
+		9, 7, 15, 11, 8, 6, 6, 14, 12, 13, 5, 14, 13, 13, 7, 5,
+		15, 5, 8, 11, 14, 14, 6, 14, 6, 9, 12, 9, 12, 5, 15, 8,
+		8, 5, 12, 9, 12, 5, 14, 6, 8, 13, 6, 5, 15, 13, 11, 11,
+	}
+	rmdKL = [5]uint32{0x00000000, 0x5a827999, 0x6ed9eba1, 0x8f1bbcdc, 0xa953fd4e}
+	rmdKR = [5]uint32{0x50a28be6, 0x5c4dd124, 0x6d703ef3, 0x7a6d76e9, 0x00000000}
+)
+
+// Boolean function of round j (0-79)
+func rmdF(j int, x, y, z uint32) uint32 {
+	switch j / 16 {
+	case 0:
+		return x ^ y ^ z
+	case 1:
+		return (x & y) | (^x & z)
+	case 2:
+		return (x | ^y) ^ z
+	case 3:
+		return (x & z) | (y & ^z)
+	default:
+		return x ^ (y | ^z)
+	}
+}
+
 // RIPEMD-160 compression function
 func block(s *ripemd160State) {
-	// Constants and functions per spec
-	f := func(x, y, z uint32) uint32 { return x ^ y ^ z }
-	g := func(x, y, z uint32) uint32 { return (x & y) | (^x & z) }
-	h := func(x, y, z uint32) uint32 { return (x | ^y) ^ z }
-	i := func(x, y, z uint32) uint32 { return (x & z) | (y & ^z) }
-	j := func(x, y, z uint32) uint32 { return x ^ (y | ^z) }
-
-	rl := func(x uint32, n uint) uint32 { return (x<<n | x>>(32-n)) }
-
-	var (
-		a, b, c, d, e = s.h0, s.h1, s.h2, s.h3, s.h4
-		A, B, C, D, E = s.h0, s.h1, s.h2, s.h3, s.h4
-		X             = s.x
-	)
-
-	// Left line
-	a = rl(a+f(b, c, d)+X[0], 11) + e
-	c = rl(c, 10)
-	e = rl(e+f(a, b, c)+X[1], 14) + d
-	b = rl(b, 10)
-	d = rl(d+f(e, a, b)+X[2], 15) + c
-	a = rl(a, 10)
-	c = rl(c+f(d, e, a)+X[3], 12) + b
-	e = rl(e, 10)
-	b = rl(b+f(c, d, e)+X[4], 5) + a
-	d = rl(d, 10)
-	a = rl(a+f(b, c, d)+X[5], 8) + e
-	c = rl(c, 10)
-	e = rl(e+f(a, b, c)+X[6], 7) + d
-	b = rl(b, 10)
-	d = rl(d+f(e, a, b)+X[7], 9) + c
-	a = rl(a, 10)
-	c = rl(c+f(d, e, a)+X[8], 11) + b
-	e = rl(e, 10)
-	b = rl(b+f(c, d, e)+X[9], 13) + a
-	d = rl(d, 10)
-	a = rl(a+f(b, c, d)+X[10], 14) + e
-	c = rl(c, 10)
-	e = rl(e+f(a, b, c)+X[11], 15) + d
-	b = rl(b, 10)
-	d = rl(d+f(e, a, b)+X[12], 6) + c
-	a = rl(a, 10)
-	c = rl(c+f(d, e, a)+X[13], 7) + b
-	e = rl(e, 10)
-	b = rl(b+f(c, d, e)+X[14], 9) + a
-	d = rl(d, 10)
-	a = rl(a+f(b, c, d)+X[15], 8) + e
-	c = rl(c, 10)
-
-	// Round 2
-	const K1 = 0x5a827999
-	a = rl(a+g(b, c, d)+X[7]+K1, 7) + e
-	c = rl(c, 10)
-	e = rl(e+g(a, b, c)+X[4]+K1, 6) + d
-	b = rl(b, 10)
-	d = rl(d+g(e, a, b)+X[13]+K1, 8) + c
-	a = rl(a, 10)
-	c = rl(c+g(d, e, a)+X[1]+K1, 13) + b
-	e = rl(e, 10)
-	b = rl(b+g(c, d, e)+X[10]+K1, 11) + a
-	d = rl(d, 10)
-	a = rl(a+g(b, c, d)+X[6]+K1, 9) + e
-	c = rl(c, 10)
-	e = rl(e+g(a, b, c)+X[15]+K1, 7) + d
-	b = rl(b, 10)
-	d = rl(d+g(e, a, b)+X[3]+K1, 15) + c
-	a = rl(a, 10)
-	c = rl(c+g(d, e, a)+X[12]+K1, 7) + b
-	e = rl(e, 10)
-	b = rl(b+g(c, d, e)+X[0]+K1, 12) + a
-	d = rl(d, 10)
-	a = rl(a+g(b, c, d)+X[9]+K1, 15) + e
-	c = rl(c, 10)
-	e = rl(e+g(a, b, c)+X[5]+K1, 9) + d
-	b = rl(b, 10)
-	d = rl(d+g(e, a, b)+X[2]+K1, 11) + c
-	a = rl(a, 10)
-	c = rl(c+g(d, e, a)+X[14]+K1, 7) + b
-	e = rl(e, 10)
-	b = rl(b+g(c, d, e)+X[11]+K1, 13) + a
-	d = rl(d, 10)
-	a = rl(a+g(b, c, d)+X[8]+K1, 12) + e
-	c = rl(c, 10)
-
-	// Round 3
-	const K2 = 0x6ed9eba1
-	a = rl(a+h(b, c, d)+X[3]+K2, 11) + e
-	c = rl(c, 10)
-	e = rl(e+h(a, b, c)+X[10]+K2, 13) + d
-	b = rl(b, 10)
-	d = rl(d+h(e, a, b)+X[14]+K2, 6) + c
-	a = rl(a, 10)
-	c = rl(c+h(d, e, a)+X[4]+K2, 7) + b
-	e = rl(e, 10)
-	b = rl(b+h(c, d, e)+X[9]+K2, 14) + a
-	d = rl(d, 10)
-	a = rl(a+h(b, c, d)+X[15]+K2, 9) + e
-	c = rl(c, 10)
-	e = rl(e+h(a, b, c)+X[8]+K2, 13) + d
-	b = rl(b, 10)
-	d = rl(d+h(e, a, b)+X[1]+K2, 15) + c
-	a = rl(a, 10)
-	c = rl(c+h(d, e, a)+X[2]+K2, 14) + b
-	e = rl(e, 10)
-	b = rl(b+h(c, d, e)+X[7]+K2, 8) + a
-	d = rl(d, 10)
-	a = rl(a+h(b, c, d)+X[0]+K2, 13) + e
-	c = rl(c, 10)
-	e = rl(e+h(a, b, c)+X[6]+K2, 6) + d
-	b = rl(b, 10)
-	d = rl(d+h(e, a, b)+X[13]+K2, 5) + c
-	a = rl(a, 10)
-	c = rl(c+h(d, e, a)+X[11]+K2, 12) + b
-	e = rl(e, 10)
-	b = rl(b+h(c, d, e)+X[5]+K2, 7) + a
-	d = rl(d, 10)
-	a = rl(a+h(b, c, d)+X[12]+K2, 5) + e
-	c = rl(c, 10)
-
-	// Right line
-	const Kr0 = 0x50a28be6
-	A = rl(A+j(B, C, D)+X[5]+Kr0, 8) + E
-	C = rl(C, 10)
-	E = rl(E+j(A, B, C)+X[14]+Kr0, 9) + D
-	B = rl(B, 10)
-	D = rl(D+j(E, A, B)+X[7]+Kr0, 9) + C
-	A = rl(A, 10)
-	C = rl(C+j(D, E, A)+X[0]+Kr0, 11) + B
-	E = rl(E, 10)
-	B = rl(B+j(C, D, E)+X[9]+Kr0, 13) + A
-	D = rl(D, 10)
-	A = rl(A+j(B, C, D)+X[2]+Kr0, 15) + E
-	C = rl(C, 10)
-	E = rl(E+j(A, B, C)+X[11]+Kr0, 15) + D
-	B = rl(B, 10)
-	D = rl(D+j(E, A, B)+X[4]+Kr0, 5) + C
-	A = rl(A, 10)
-	C = rl(C+j(D, E, A)+X[13]+Kr0, 7) + B
-	E = rl(E, 10)
-	B = rl(B+j(C, D, E)+X[6]+Kr0, 7) + A
-	D = rl(D, 10)
-	A = rl(A+j(B, C, D)+X[15]+Kr0, 8) + E
-	C = rl(C, 10)
-	E = rl(E+j(A, B, C)+X[8]+Kr0, 11) + D
-	B = rl(B, 10)
-	D = rl(D+j(E, A, B)+X[1]+Kr0, 14) + C
-	A = rl(A, 10)
-	C = rl(C+j(D, E, A)+X[10]+Kr0, 14) + B
-	E = rl(E, 10)
-	B = rl(B+j(C, D, E)+X[3]+Kr0, 12) + A
-	D = rl(D, 10)
-	A = rl(A+j(B, C, D)+X[12]+Kr0, 6) + E
-	C = rl(C, 10)
-
-	const Kr1 = 0x5c4dd124
-	A = rl(A+i(B, C, D)+X[6]+Kr1, 9) + E
-	C = rl(C, 10)
-	E = rl(E+i(A, B, C)+X[11]+Kr1, 13) + D
-	B = rl(B, 10)
-	D = rl(D+i(E, A, B)+X[3]+Kr1, 15) + C
-	A = rl(A, 10)
-	C = rl(C+i(D, E, A)+X[7]+Kr1, 7) + B
-	E = rl(E, 10)
-	B = rl(B+i(C, D, E)+X[0]+Kr1, 12) + A
-	D = rl(D, 10)
-	A = rl(A+i(B, C, D)+X[13]+Kr1, 8) + E
-	C = rl(C, 10)
-	E = rl(E+i(A, B, C)+X[5]+Kr1, 9) + D
-	B = rl(B, 10)
-	D = rl(D+i(E, A, B)+X[10]+Kr1, 11) + C
-	A = rl(A, 10)
-	C = rl(C+i(D, E, A)+X[14]+Kr1, 7) + B
-	E = rl(E, 10)
-	B = rl(B+i(C, D, E)+X[15]+Kr1, 7) + A
-	D = rl(D, 10)
-	A = rl(A+i(B, C, D)+X[8]+Kr1, 12) + E
-	C = rl(C, 10)
-	E = rl(E+i(A, B, C)+X[12]+Kr1, 7) + D
-	B = rl(B, 10)
-	D = rl(D+i(E, A, B)+X[4]+Kr1, 6) + C
-	A = rl(A, 10)
-	C = rl(C+i(D, E, A)+X[9]+Kr1, 15) + B
-	E = rl(E, 10)
-	B = rl(B+i(C, D, E)+X[1]+Kr1, 13) + A
-	D = rl(D, 10)
-	A = rl(A+i(B, C, D)+X[2]+Kr1, 11) + E
-	C = rl(C, 10)
-
-	const Kr2 = 0x6d703ef3
-	A = rl(A+h(B, C, D)+X[15]+Kr2, 9) + E
-	C = rl(C, 10)
-	E = rl(E+h(A, B, C)+X[5]+Kr2, 7) + D
-	B = rl(B, 10)
-	D = rl(D+h(E, A, B)+X[1]+Kr2, 15) + C
-	A = rl(A, 10)
-	C = rl(C+h(D, E, A)+X[3]+Kr2, 11) + B
-	E = rl(E, 10)
-	B = rl(B+h(C, D, E)+X[7]+Kr2, 8) + A
-	D = rl(D, 10)
-	A = rl(A+h(B, C, D)+X[14]+Kr2, 6) + E
-	C = rl(C, 10)
-	E = rl(E+h(A, B, C)+X[6]+Kr2, 6) + D
-	B = rl(B, 10)
-	D = rl(D+h(E, A, B)+X[9]+Kr2, 14) + C
-	A = rl(A, 10)
-	C = rl(C+h(D, E, A)+X[11]+Kr2, 12) + B
-	E = rl(E, 10)
-	B = rl(B+h(C, D, E)+X[8]+Kr2, 13) + A
-	D = rl(D, 10)
-	A = rl(A+h(B, C, D)+X[12]+Kr2, 5) + E
-	C = rl(C, 10)
-	E = rl(E+h(A, B, C)+X[2]+Kr2, 14) + D
-	B = rl(B, 10)
-	D = rl(D+h(E, A, B)+X[10]+Kr2, 13) + C
-	A = rl(A, 10)
-	C = rl(C+h(D, E, A)+X[0]+Kr2, 13) + B
-	E = rl(E, 10)
-	B = rl(B+h(C, D, E)+X[4]+Kr2, 7) + A
-	D = rl(D, 10)
-	A = rl(A+h(B, C, D)+X[13]+Kr2, 5) + E
-	C = rl(C, 10)
-
-	const Kr3 = 0x7a6d76e9
-	A = rl(A+g(B, C, D)+X[8]+Kr3, 15) + E
-	C = rl(C, 10)
-	E = rl(E+g(A, B, C)+X[6]+Kr3, 5) + D
-	B = rl(B, 10)
-	D = rl(D+g(E, A, B)+X[4]+Kr3, 8) + C
-	A = rl(A, 10)
-	C = rl(C+g(D, E, A)+X[1]+Kr3, 11) + B
-	E = rl(E, 10)
-	B = rl(B+g(C, D, E)+X[3]+Kr3, 14) + A
-	D = rl(D, 10)
-	A = rl(A+g(B, C, D)+X[11]+Kr3, 14) + E
-	C = rl(C, 10)
-	E = rl(E+g(A, B, C)+X[15]+Kr3, 6) + D
-	B = rl(B, 10)
-	D = rl(D+g(E, A, B)+X[0]+Kr3, 14) + C
-	A = rl(A, 10)
-	C = rl(C+g(D, E, A)+X[5]+Kr3, 6) + B
-	E = rl(E, 10)
-	B = rl(B+g(C, D, E)+X[12]+Kr3, 9) + A
-	D = rl(D, 10)
-	A = rl(A+g(B, C, D)+X[2]+Kr3, 12) + E
-	C = rl(C, 10)
-	E = rl(E+g(A, B, C)+X[13]+Kr3, 9) + D
-	B = rl(B, 10)
-	D = rl(D+g(E, A, B)+X[9]+Kr3, 12) + C
-	A = rl(A, 10)
-	C = rl(C+g(D, E, A)+X[7]+Kr3, 5) + B
-	E = rl(E, 10)
-	B = rl(B+g(C, D, E)+X[10]+Kr3, 15) + A
-	D = rl(D, 10)
-	A = rl(A+g(B, C, D)+X[14]+Kr3, 8) + E
-	C = rl(C, 10)
-
-	const Kr4 = 0x00000000
-	A = rl(A+f(B, C, D)+X[12]+Kr4, 8) + E
-	C = rl(C, 10)
-	E = rl(E+f(A, B, C)+X[15]+Kr4, 5) + D
-	B = rl(B, 10)
-	D = rl(D+f(E, A, B)+X[10]+Kr4, 12) + C
-	A = rl(A, 10)
-	C = rl(C+f(D, E, A)+X[4]+Kr4, 9) + B
-	E = rl(E, 10)
-	B = rl(B+f(C, D, E)+X[1]+Kr4, 12) + A
-	D = rl(D, 10)
-	A = rl(A+f(B, C, D)+X[5]+Kr4, 5) + E
-	C = rl(C, 10)
-	E = rl(E+f(A, B, C)+X[8]+Kr4, 14) + D
-	B = rl(B, 10)
-	D = rl(D+f(E, A, B)+X[7]+Kr4, 6) + C
-	A = rl(A, 10)
-	C = rl(C+f(D, E, A)+X[6]+Kr4, 8) + B
-	E = rl(E, 10)
-	B = rl(B+f(C, D, E)+X[2]+Kr4, 13) + A
-	D = rl(D, 10)
-	A = rl(A+f(B, C, D)+X[13]+Kr4, 6) + E
-	C = rl(C, 10)
-	E = rl(E+f(A, B, C)+X[14]+Kr4, 5) + D
-	B = rl(B, 10)
-	D = rl(D+f(E, A, B)+X[0]+Kr4, 15) + C
-	A = rl(A, 10)
-	C = rl(C+f(D, E, A)+X[3]+Kr4, 13) + B
-	E = rl(E, 10)
-	B = rl(B+f(C, D, E)+X[9]+Kr4, 11) + A
-	D = rl(D, 10)
-	A = rl(A+f(B, C, D)+X[11]+Kr4, 11) + E
-	C = rl(C, 10)
-
-	// Combine results
+	rl := func(x uint32, n uint) uint32 { return x<<n | x>>(32-n) }
+	a, b, c, d, e := s.h0, s.h1, s.h2, s.h3, s.h4
+	A, B, C, D, E := s.h0, s.h1, s.h2, s.h3, s.h4
+	for j := 0; j < 80; j++ {
+		t := rl(a+rmdF(j, b, c, d)+s.x[rmdRL[j]]+rmdKL[j/16], rmdSL[j]) + e
+		a, e, d, c, b = e, d, rl(c, 10), b, t
+		t = rl(A+rmdF(79-j, B, C, D)+s.x[rmdRR[j]]+rmdKR[j/16], rmdSR[j]) + E
+		A, E, D, C, B = E, D, rl(C, 10), B, t
+	}
 	t := s.h1 + c + D
 	s.h1 = s.h2 + d + E
 	s.h2 = s.h3 + e + A
@@ -0,0 +1,248 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains gap-limit scanning of account addresses with parallel queries.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultGapLimit is the BIP-44 gap limit: stop after this many unused addresses.
+const defaultGapLimit = 20
+
+// AddressDeriver derives the receive (change=false) or change address at an
+// index; XPubAccount and MultisigAccount implement it.
+type AddressDeriver interface {
+	Address(change bool, index uint32) (string, error)
+}
+
+// AddressHistorySource reports whether an address appears in any
+// transaction, confirmed or not, even when it holds nothing now.
+type AddressHistorySource interface {
+	AddressUsed(address string) (bool, error)
+}
+
+// ScanSource is a backend a gap-limit scan can run against: it tells used
+// addresses by their transaction history, so a chain does not end at
+// addresses that were funded and swept, and lists the coins of used ones.
+type ScanSource interface {
+	UTXOSource
+	AddressHistorySource
+}
+
+// ScanOptions tunes a gap-limit scan.
+type ScanOptions struct {
+	GapLimit  int     // Unused addresses after the last used one before a chain ends (0 = 20)
+	Workers   int     // Addresses queried concurrently (0 = 1)
+	RateLimit float64 // Maximum backend calls per second across all workers (0 = unlimited)
+}
+
+// ScanResult is what a gap-limit scan found.
+type ScanResult struct {
+	UTXOs       []UTXO `json:"utxos"`        // Receive chain first, then change, each by index
+	ReceiveNext uint32 `json:"receive_next"` // First receive index after the last used one
+	ChangeNext  uint32 `json:"change_next"`  // First change index after the last used one
+	Queried     int    `json:"queried"`      // Addresses queried
+}
+
+// ScanAddresses walks the receive and change chains of d, asking src whether
+// each address was ever used and for the unspent outputs of used ones, until
+// GapLimit consecutive addresses have no transaction history. Addresses are queried Workers at a time, at most RateLimit calls
+// per second; results are aggregated in index order and the scan stops where a
+// one-at-a-time scan would, so the outcome does not depend on the worker count.
+func ScanAddresses(d AddressDeriver, src ScanSource, opts ScanOptions) (*ScanResult, error) {
+	if d == nil || src == nil {
+		return nil, errors.New("scan needs an address deriver and a UTXO source")
+	}
+	if opts.GapLimit < 0 || opts.Workers < 0 || opts.RateLimit < 0 {
+		return nil, fmt.Errorf("scan options must be non-negative (gap limit %d, workers %d, rate limit %v)", opts.GapLimit, opts.Workers, opts.RateLimit)
+	}
+	if opts.GapLimit == 0 {
+		opts.GapLimit = defaultGapLimit
+	}
+	if opts.Workers == 0 {
+		opts.Workers = 1
+	}
+	limit := newRateLimiter(opts.RateLimit)
+	res := &ScanResult{}
+	for _, change := range []bool{false, true} {
+		utxos, next, queried, err := scanChain(d, src, change, opts, limit)
+		res.Queried += queried
+		if err != nil {
+			return res, err
+		}
+		res.UTXOs = append(res.UTXOs, utxos...)
+		if change {
+			res.ChangeNext = next
+		} else {
+			res.ReceiveNext = next
+		}
+	}
+	return res, nil
+}
+
+// One address lookup of a scan window
+type scanSlot struct {
+	addr  string
+	used  bool
+	utxos []UTXO
+	err   error
+}
+
+// Scan one chain a window of GapLimit addresses at a time, returning its UTXOs
+// in index order and the index after the last used address
+func scanChain(d AddressDeriver, src ScanSource, change bool, opts ScanOptions, limit *rateLimiter) ([]UTXO, uint32, int, error) {
+	var out []UTXO
+	next, queried := uint32(0), 0
+	for start := uint32(0); ; start += uint32(opts.GapLimit) {
+		slots := make([]scanSlot, opts.GapLimit)
+		for i := range slots {
+			addr, err := d.Address(change, start+uint32(i))
+			if err != nil {
+				return out, next, queried, fmt.Errorf("derive address %d: %w", start+uint32(i), err)
+			}
+			slots[i].addr = addr
+		}
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < opts.Workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					slots[i].err = scanAddress(src, &slots[i], limit)
+				}
+			}()
+		}
+		for i := range slots {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		queried += len(slots)
+
+		// Replay the window in order, ending where a serial scan would
+		for i, slot := range slots {
+			idx := start + uint32(i)
+			if idx >= next+uint32(opts.GapLimit) {
+				return out, next, queried, nil
+			}
+			if slot.err != nil {
+				return out, next, queried, fmt.Errorf("backend lookup for %s failed: %w", slot.addr, slot.err)
+			}
+			if slot.used {
+				sort.SliceStable(slot.utxos, func(a, b int) bool { return outpointKey(slot.utxos[a]) < outpointKey(slot.utxos[b]) })
+				out = append(out, slot.utxos...)
+				next = idx + 1
+			}
+		}
+		if start >= next {
+			return out, next, queried, nil // The whole window was unused
+		}
+	}
+}
+
+// Look up whether one address was used and, if so, its coins
+func scanAddress(src ScanSource, slot *scanSlot, limit *rateLimiter) error {
+	limit.wait()
+	used, err := src.AddressUsed(slot.addr)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return nil
+	}
+	limit.wait()
+	utxos, err := src.ListUnspent([]string{slot.addr})
+	if err != nil {
+		return err
+	}
+	slot.used, slot.utxos = true, utxos
+	return nil
+}
+
+// rateLimiter spaces calls at least interval apart across goroutines.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// A limiter allowing perSecond calls per second (0 = unlimited)
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Block until the caller's slot comes up
+func (l *rateLimiter) wait() {
+	if l.interval == 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// ScanAccount runs ScanAddresses over the configured xpub or multisig account,
+// indexes the UTXOs found that are not indexed yet and advances the derivation
+// counters past the last used addresses. UTXOs the index refuses (dust,
+// unconfirmed) are logged and skipped.
+func (s *Sweeper) ScanAccount(src ScanSource, opts ScanOptions) (*ScanResult, error) {
+	var d AddressDeriver
+	var register func(change bool, i uint32) (string, error)
+	switch {
+	case s.multisig != nil:
+		d, register = s.multisig, s.multisigAddress
+	case s.account != nil:
+		d, register = s.account, s.accountAddress
+	default:
+		return nil, errors.New("no account to scan - call SetXPubAccount or SetMultisigAccount")
+	}
+	res, err := ScanAddresses(d, src, opts)
+	if err != nil {
+		return res, err
+	}
+	for _, chain := range []struct {
+		change bool
+		next   uint32
+	}{{false, res.ReceiveNext}, {true, res.ChangeNext}} {
+		// Addresses past the lookahead must be known before their coins index
+		for i := uint32(0); i < chain.next; i++ {
+			if _, err := register(chain.change, i); err != nil {
+				return res, err
+			}
+		}
+		c, err := s.DerivationCounter(chain.change)
+		if err != nil {
+			return res, err
+		}
+		if cur, err := c.Peek(); err != nil {
+			return res, err
+		} else if chain.next > cur {
+			if err := c.AdvanceTo(chain.next); err != nil {
+				return res, err
+			}
+		}
+	}
+	for _, u := range res.UTXOs {
+		if _, ok := s.GetUTXO(u.TxID, u.Vout); ok {
+			continue
+		}
+		if err := s.Index(u); err != nil {
+			s.logger.Printf("scan: skipped %s: %v", outpointKey(u), err)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Scan source over fixed address maps that records peak concurrency
+type scanSource struct {
+	coins map[string][]UTXO
+	used  map[string]bool // Addresses with history, funded or swept
+	fail  string
+	delay time.Duration
+
+	mu       sync.Mutex
+	inflight int
+	peak     int
+}
+
+func (f *scanSource) ListUnspent(addresses []string) ([]UTXO, error) {
+	f.mu.Lock()
+	f.inflight++
+	if f.inflight > f.peak {
+		f.peak = f.inflight
+	}
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	f.inflight--
+	f.mu.Unlock()
+	if addresses[0] == f.fail {
+		return nil, errors.New("503 service unavailable")
+	}
+	return f.coins[addresses[0]], nil
+}
+
+func (f *scanSource) AddressUsed(address string) (bool, error) {
+	if address == f.fail {
+		return false, errors.New("503 service unavailable")
+	}
+	return f.used[address], nil
+}
+
+// A BIP-84 account with coins at receive 0, 5, 24 and 46 (past the gap) and change 2
+func scanFixture(t *testing.T) (*XPubAccount, *scanSource) {
+	t.Helper()
+	a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount: %v", err)
+	}
+	src := &scanSource{coins: map[string][]UTXO{}, used: map[string]bool{}, delay: time.Millisecond}
+	fund := func(change bool, i uint32, c string) {
+		addr, _ := a.Address(change, i)
+		src.used[addr] = true
+		src.coins[addr] = append(src.coins[addr], UTXO{TxID: stringsRepeat(c, 64), Vout: i, ValueSats: 50_000, Address: addr, Confirmed: true, Confirmations: 3})
+	}
+	fund(false, 0, "a")
+	fund(false, 5, "b")
+	fund(false, 24, "c")
+	fund(false, 46, "d")
+	fund(true, 2, "e")
+	return a, src
+}
+
+func TestScanAddressesGapLimit(t *testing.T) {
+	a, src := scanFixture(t)
+	serial, err := ScanAddresses(a, src, ScanOptions{})
+	if err != nil {
+		t.Fatalf("ScanAddresses: %v", err)
+	}
+	if len(serial.UTXOs) != 4 || serial.ReceiveNext != 25 || serial.ChangeNext != 3 {
+		t.Fatalf("unexpected scan %+v", serial)
+	}
+	if serial.UTXOs[3].Vout != 2 || serial.UTXOs[2].Vout != 24 {
+		t.Fatalf("UTXOs not in chain/index order: %+v", serial.UTXOs)
+	}
+
+	src.peak = 0
+	parallel, err := ScanAddresses(a, src, ScanOptions{Workers: 8})
+	if err != nil {
+		t.Fatalf("parallel ScanAddresses: %v", err)
+	}
+	if !reflect.DeepEqual(serial.UTXOs, parallel.UTXOs) || serial.ReceiveNext != parallel.ReceiveNext || serial.ChangeNext != parallel.ChangeNext {
+		t.Fatalf("parallel scan differs:\n%+v\n%+v", serial, parallel)
+	}
+	if src.peak < 2 || src.peak > 8 {
+		t.Fatalf("peak concurrency %d, want 2..8", src.peak)
+	}
+
+	// An address that was funded and swept extends the chain like a funded one
+	swept, _ := a.Address(false, 40)
+	src.used[swept] = true
+	res, err := ScanAddresses(a, src, ScanOptions{Workers: 4})
+	if err != nil || len(res.UTXOs) != 5 || res.ReceiveNext != 47 {
+		t.Fatalf("swept address did not extend the scan: %+v, %v", res, err)
+	}
+	delete(src.used, swept)
+
+	// A backend error surfaces with the address instead of ending the chain early
+	src.fail, _ = a.Address(false, 7)
+	if _, err := ScanAddresses(a, src, ScanOptions{Workers: 4}); err == nil {
+		t.Fatalf("expected the backend error")
+	}
+	if _, err := ScanAddresses(a, src, ScanOptions{Workers: -1}); err == nil {
+		t.Fatalf("expected negative workers to be refused")
+	}
+}
+
+func TestScanAddressesRateLimit(t *testing.T) {
+	a, src := scanFixture(t)
+	src.delay = 0
+	start := time.Now()
+	res, err := ScanAddresses(a, src, ScanOptions{GapLimit: 5, Workers: 8, RateLimit: 500})
+	if err != nil {
+		t.Fatalf("ScanAddresses: %v", err)
+	}
+	if min := time.Duration(res.Queried-1) * 2 * time.Millisecond; time.Since(start) < min {
+		t.Fatalf("%d queries took %s, rate limit allows no less than %s", res.Queried, time.Since(start), min)
+	}
+}
+
+func TestSweeperScanAccount(t *testing.T) {
+	a, src := scanFixture(t)
+	recv, _ := a.derive(false, 0)
+	s := mustNewSweeper(t, recv.PubKey, BitcoinMainnet)
+	if _, err := s.ScanAccount(src, ScanOptions{}); err == nil {
+		t.Fatalf("expected an error without an account")
+	}
+	if err := s.SetXPubAccount(a, 5); err != nil {
+		t.Fatalf("SetXPubAccount: %v", err)
+	}
+	res, err := s.ScanAccount(src, ScanOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("ScanAccount: %v", err)
+	}
+	if got := len(s.indexedUTXOs); got != len(res.UTXOs) {
+		t.Fatalf("indexed %d of %d found UTXOs", got, len(res.UTXOs))
+	}
+	c, _ := s.DerivationCounter(false)
+	if next, _ := c.Peek(); next != 25 {
+		t.Fatalf("receive counter at %d, want 25", next)
+	}
+	// Rescanning indexes nothing twice
+	if _, err := s.ScanAccount(src, ScanOptions{Workers: 4}); err != nil || len(s.indexedUTXOs) != len(res.UTXOs) {
+		t.Fatalf("rescan: %d indexed, %v", len(s.indexedUTXOs), err)
+	}
+}
@@ -0,0 +1,514 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains time- and block-height-based scheduling of plan templates.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule decides when a template is due. Three forms are supported:
+//
+//	"every 144 blocks"  - block-height interval
+//	"every 6h"          - wall-clock interval (Go duration syntax)
+//	"0 3 * * 0#1"       - 5-field cron (minute hour day-of-month month day-of-week);
+//	                      "dow#n" selects the nth weekday of the month, so this is
+//	                      "03:00 on the first Sunday of the month"
+//
+// The cron descriptors @hourly, @daily, @weekly and @monthly are also accepted.
+// Cron fields are evaluated in UTC.
+type Schedule struct {
+	spec     string
+	blocks   int64         // > 0 for block-height schedules
+	interval time.Duration // > 0 for interval schedules
+	cron     *cronSpec     // non-nil for cron schedules
+}
+
+// RunMarker records the last time a scheduled template was started.
+type RunMarker struct {
+	StartedAt time.Time `json:"started_at"`           // Wall-clock time the run started
+	Height    int64     `json:"height,omitempty"`     // Chain height when the run started (0 = unknown)
+	PlanID    string    `json:"plan_id,omitempty"`    // Plan produced by the run, if any
+	Error     string    `json:"error,omitempty"`      // Error from the run, if any
+	Finished  bool      `json:"finished"`             // Whether the run completed
+	Duration  float64   `json:"duration_s,omitempty"` // Run duration in seconds
+}
+
+// ParseSchedule parses a schedule specification.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty schedule")
+	}
+	s := &Schedule{spec: spec}
+	if strings.HasPrefix(spec, "every ") {
+		rest := strings.Fields(strings.TrimPrefix(spec, "every "))
+		if len(rest) == 2 && (rest[1] == "blocks" || rest[1] == "block") {
+			n, err := strconv.ParseInt(rest[0], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid block interval in schedule '%s'", spec)
+			}
+			s.blocks = n
+			return s, nil
+		}
+		if len(rest) == 1 {
+			d, err := time.ParseDuration(rest[0])
+			if err != nil || d < time.Minute {
+				return nil, fmt.Errorf("invalid interval in schedule '%s' - use e.g. 'every 6h' (minimum 1m)", spec)
+			}
+			s.interval = d
+			return s, nil
+		}
+		return nil, fmt.Errorf("invalid schedule '%s' - use 'every N blocks' or 'every <duration>'", spec)
+	}
+	c, err := parseCron(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule '%s': %w", spec, err)
+	}
+	s.cron = c
+	return s, nil
+}
+
+// String returns the original specification.
+func (s *Schedule) String() string { return s.spec }
+
+// NeedsHeight reports whether the schedule is driven by block height.
+func (s *Schedule) NeedsHeight() bool { return s.blocks > 0 }
+
+// Due reports whether a run should start at (now, height) given the last run.
+// A nil marker means the template has never run. Height-based schedules are
+// never due while the height is unknown (0).
+func (s *Schedule) Due(last *RunMarker, now time.Time, height int64) bool {
+	switch {
+	case s.blocks > 0:
+		if height <= 0 {
+			return false
+		}
+		return last == nil || last.Height <= 0 || height-last.Height >= s.blocks
+	case s.interval > 0:
+		return last == nil || now.Sub(last.StartedAt) >= s.interval
+	default:
+		if last == nil {
+			// Never run: fire on the first matching minute
+			return s.cron.matches(now.UTC())
+		}
+		next, ok := s.cron.next(last.StartedAt.UTC())
+		return ok && !next.After(now.UTC())
+	}
+}
+
+// cronSpec holds the expanded cron fields
+type cronSpec struct {
+	minute, hour, dom, month, dow map[int]bool
+	nthDow                        map[int]int // weekday -> nth occurrence in month
+	domStar, dowStar              bool
+}
+
+// Parse a 5-field cron expression or @descriptor
+func parseCron(spec string) (*cronSpec, error) {
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	f := strings.Fields(spec)
+	if len(f) != 5 {
+		return nil, errors.New("cron needs 5 fields: minute hour day-of-month month day-of-week")
+	}
+	c := &cronSpec{nthDow: map[int]int{}, domStar: f[2] == "*", dowStar: f[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(f[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day-of-month: %w", err)
+	}
+	if c.month, err = parseCronField(f[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	// Day-of-week supports "d#n" (nth weekday of the month)
+	var plain []string
+	for _, part := range strings.Split(f[4], ",") {
+		if i := strings.IndexByte(part, '#'); i >= 0 {
+			d, err1 := strconv.Atoi(part[:i])
+			n, err2 := strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil || d < 0 || d > 7 || n < 1 || n > 5 {
+				return nil, fmt.Errorf("day-of-week: invalid nth weekday '%s'", part)
+			}
+			c.nthDow[d%7] = n
+			continue
+		}
+		plain = append(plain, part)
+	}
+	c.dow = map[int]bool{}
+	if len(plain) > 0 {
+		dow, err := parseCronField(strings.Join(plain, ","), 0, 7)
+		if err != nil {
+			return nil, fmt.Errorf("day-of-week: %w", err)
+		}
+		for d := range dow {
+			c.dow[d%7] = true // 7 is an alias for Sunday
+		}
+	}
+	return c, nil
+}
+
+// Parse one cron field supporting *, lists, ranges and steps
+func parseCronField(field string, lo, hi int) (map[int]bool, error) {
+	out := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in '%s'", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		from, to := lo, hi
+		if part != "*" {
+			if i := strings.IndexByte(part, '-'); i >= 0 {
+				a, err1 := strconv.Atoi(part[:i])
+				b, err2 := strconv.Atoi(part[i+1:])
+				if err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("invalid range '%s'", part)
+				}
+				from, to = a, b
+			} else {
+				v, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value '%s'", part)
+				}
+				from, to = v, v
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return nil, fmt.Errorf("value out of range %d-%d in '%s'", lo, hi, part)
+		}
+		for v := from; v <= to; v += step {
+			out[v] = true
+		}
+	}
+	return out, nil
+}
+
+// Report whether t (truncated to the minute) matches the expression
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	return c.dayMatches(t)
+}
+
+// Day matching follows cron semantics: when both day-of-month and day-of-week
+// are restricted, either may match.
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	wd := int(t.Weekday())
+	dowOK := c.dow[wd]
+	if n, ok := c.nthDow[wd]; ok && (t.Day()-1)/7+1 == n {
+		dowOK = true
+	}
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dowOK
+	case c.dowStar:
+		return c.dom[t.Day()]
+	default:
+		return c.dom[t.Day()] || dowOK
+	}
+}
+
+// Find the first matching minute strictly after t, searching up to ~5 years
+func (c *cronSpec) next(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] || !c.dayMatches(t) {
+			// Skip to the start of the next day
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute[t.Minute()] {
+			return t, true
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+// Scheduler runs plan templates when their schedules are due. Last-run markers
+// are persisted in the Sweeper's KV store so restarts don't re-fire runs, and a
+// template that is still running is never started again (overlap protection).
+type Scheduler struct {
+	sweeper   *Sweeper
+	templates []PlanTemplate
+	schedules map[string]*Schedule
+
+	// OnResult, if set, is called after each run completes.
+	OnResult func(name string, plan *TransactionPlan, err error)
+	// OnRevalidate, if set, is called after each index re-validation pass.
+	OnRevalidate func(res *RevalidationResult, err error)
+
+	revalSource  UTXOSource    // Backend for index re-validation (nil = off)
+	revalEvery   time.Duration // Minimum time between passes
+	revalBatch   int           // Addresses per pass (0 = all)
+	revalLast    time.Time     // Start of the last pass
+	revalRunning bool          // A pass is in flight (guarded by mu)
+	priceRunning bool          // A dust price sample is in flight (guarded by mu)
+
+	mu      sync.Mutex      // guards running, stopped and the revalidation state
+	running map[string]bool // templates with a run in flight
+	stopped bool            // set by Shutdown; no new runs start
+	runMu   sync.Mutex      // serializes access to the sweeper
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for all templates that have a schedule.
+func NewScheduler(s *Sweeper, templates []PlanTemplate) (*Scheduler, error) {
+	sc := &Scheduler{sweeper: s, schedules: map[string]*Schedule{}, running: map[string]bool{}}
+	for _, t := range templates {
+		if t.Schedule == "" {
+			continue
+		}
+		sched, err := ParseSchedule(t.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("template '%s': %w", t.Name, err)
+		}
+		sc.templates = append(sc.templates, t)
+		sc.schedules[t.Name] = sched
+	}
+	sort.Slice(sc.templates, func(i, j int) bool { return sc.templates[i].Name < sc.templates[j].Name })
+	return sc, nil
+}
+
+// Templates returns the scheduled templates in name order.
+func (sc *Scheduler) Templates() []PlanTemplate {
+	return append([]PlanTemplate(nil), sc.templates...)
+}
+
+// NeedsHeight reports whether any scheduled template uses block-height triggers.
+func (sc *Scheduler) NeedsHeight() bool {
+	for _, s := range sc.schedules {
+		if s.NeedsHeight() {
+			return true
+		}
+	}
+	return false
+}
+
+// LastRun returns the persisted marker for a template (nil if it never ran).
+func (sc *Scheduler) LastRun(name string) *RunMarker {
+	b, err := sc.sweeper.kv.Get([]byte("schedule:last:" + name))
+	if err != nil {
+		return nil
+	}
+	var m RunMarker
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return &m
+}
+
+// Persist a run marker for a template
+func (sc *Scheduler) saveMarker(name string, m *RunMarker) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return sc.sweeper.kv.Put([]byte("schedule:last:"+name), b)
+}
+
+// SetRevalidation re-checks indexed UTXOs against src at most once per every,
+// covering up to maxAddresses addresses per pass (0 = all). Passes run from
+// Tick, share the sweeper lock with template runs, and are drained by Shutdown.
+func (sc *Scheduler) SetRevalidation(src UTXOSource, every time.Duration, maxAddresses int) error {
+	if src != nil && every <= 0 {
+		return fmt.Errorf("revalidation interval must be positive (got %s)", every)
+	}
+	if maxAddresses < 0 {
+		return fmt.Errorf("revalidation batch size must be non-negative (got %d)", maxAddresses)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.revalSource, sc.revalEvery, sc.revalBatch = src, every, maxAddresses
+	return nil
+}
+
+// Start a re-validation pass if one is due and none is running
+func (sc *Scheduler) maybeRevalidate(now time.Time) {
+	sc.mu.Lock()
+	if sc.stopped || sc.revalSource == nil || sc.revalRunning || now.Sub(sc.revalLast) < sc.revalEvery {
+		sc.mu.Unlock()
+		return
+	}
+	sc.revalRunning = true
+	sc.revalLast = now
+	src, batch := sc.revalSource, sc.revalBatch
+	sc.wg.Add(1)
+	sc.mu.Unlock()
+
+	go func() {
+		defer sc.wg.Done()
+		sc.runMu.Lock()
+		res, err := sc.sweeper.RevalidateIndex(src, batch)
+		sc.runMu.Unlock()
+
+		sc.mu.Lock()
+		sc.revalRunning = false
+		sc.mu.Unlock()
+		if sc.OnRevalidate != nil {
+			sc.OnRevalidate(res, err)
+		}
+	}()
+}
+
+// Sample the sweeper's dust price provider in the background, so the
+// smoothing window fills between runs; the sweeper decides whether a sample
+// is due
+func (sc *Scheduler) maybeRefreshDustPrice(now time.Time) {
+	sc.mu.Lock()
+	if sc.stopped || sc.priceRunning {
+		sc.mu.Unlock()
+		return
+	}
+	sc.priceRunning = true
+	sc.wg.Add(1)
+	sc.mu.Unlock()
+
+	go func() {
+		defer sc.wg.Done()
+		sc.runMu.Lock()
+		sc.sweeper.refreshDustPrice(now)
+		sc.runMu.Unlock()
+		sc.mu.Lock()
+		sc.priceRunning = false
+		sc.mu.Unlock()
+	}()
+}
+
+// Tick starts every due template that is not already running and returns
+// their names. Pass height 0 when the chain height is unknown. Runs execute in
+// the background; use Wait to block until they finish.
+func (sc *Scheduler) Tick(now time.Time, height int64) []string {
+	sc.maybeRevalidate(now)
+	sc.maybeRefreshDustPrice(now)
+	var started []string
+	for _, t := range sc.templates {
+		sc.mu.Lock()
+		busy, stopped := sc.running[t.Name], sc.stopped
+		sc.mu.Unlock()
+		if stopped {
+			break
+		}
+		if busy || !sc.schedules[t.Name].Due(sc.LastRun(t.Name), now, height) {
+			continue
+		}
+
+		// Claim the run, unless Shutdown began since the check above
+		sc.mu.Lock()
+		if sc.stopped {
+			sc.mu.Unlock()
+			break
+		}
+		sc.running[t.Name] = true
+		sc.wg.Add(1)
+		sc.mu.Unlock()
+
+		// Record the start before running so a crash mid-run cannot double-fire
+		marker := &RunMarker{StartedAt: now, Height: height}
+		if err := sc.saveMarker(t.Name, marker); err != nil {
+			sc.mu.Lock()
+			delete(sc.running, t.Name)
+			sc.mu.Unlock()
+			sc.wg.Done()
+			if sc.OnResult != nil {
+				sc.OnResult(t.Name, nil, fmt.Errorf("failed to persist run marker: %w", err))
+			}
+			continue
+		}
+		started = append(started, t.Name)
+
+		go sc.run(t, marker)
+	}
+	return started
+}
+
+// Execute one template run and record its outcome
+func (sc *Scheduler) run(t PlanTemplate, marker *RunMarker) {
+	defer sc.wg.Done()
+	begin := time.Now()
+
+	sc.runMu.Lock()
+	plan, err := sc.sweeper.RunTemplate(t)
+	if plan != nil {
+		marker.PlanID = plan.ID
+	}
+	if err != nil {
+		marker.Error = err.Error()
+	}
+	marker.Finished = true
+	marker.Duration = time.Since(begin).Seconds()
+	_ = sc.saveMarker(t.Name, marker)
+	sc.runMu.Unlock()
+
+	sc.mu.Lock()
+	delete(sc.running, t.Name)
+	sc.mu.Unlock()
+	if sc.OnResult != nil {
+		sc.OnResult(t.Name, plan, err)
+	}
+}
+
+// Wait blocks until all in-flight runs have finished.
+func (sc *Scheduler) Wait() { sc.wg.Wait() }
+
+// Shutdown stops starting new runs and waits for in-flight runs to finish
+// until ctx is done. Runs still going at the deadline keep their unfinished
+// marker in the KV store, so they are visible (and not re-fired early) after a
+// restart.
+func (sc *Scheduler) Shutdown(ctx context.Context) error {
+	sc.mu.Lock()
+	sc.stopped = true
+	sc.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		sc.mu.Lock()
+		var names []string
+		for n := range sc.running {
+			names = append(names, n)
+		}
+		sc.mu.Unlock()
+		sort.Strings(names)
+		return fmt.Errorf("shutdown deadline reached with run(s) still in flight: %s", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronFirstSundayOfMonth(t *testing.T) {
+	s, err := ParseSchedule("0 3 * * 0#1")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	// 2024-03-03 is the first Sunday of March 2024
+	from := time.Date(2024, 2, 20, 12, 0, 0, 0, time.UTC)
+	next, ok := s.cron.next(from)
+	if !ok || !next.Equal(time.Date(2024, 3, 3, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next run %v", next)
+	}
+	last := &RunMarker{StartedAt: next}
+	if s.Due(last, next.Add(7*24*time.Hour), 0) {
+		t.Fatalf("second Sunday must not be due")
+	}
+}
+
+func TestBlockAndIntervalSchedules(t *testing.T) {
+	blocks, err := ParseSchedule("every 144 blocks")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	last := &RunMarker{Height: 800_000}
+	if blocks.Due(last, time.Now(), 800_143) || !blocks.Due(last, time.Now(), 800_144) {
+		t.Fatalf("block schedule boundary wrong")
+	}
+	if blocks.Due(nil, time.Now(), 0) {
+		t.Fatalf("block schedule must not fire without a height")
+	}
+	every, err := ParseSchedule("every 6h")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	now := time.Now()
+	if every.Due(&RunMarker{StartedAt: now.Add(-5 * time.Hour)}, now, 0) {
+		t.Fatalf("interval fired early")
+	}
+	if _, err := ParseSchedule("0 25 * * *"); err == nil {
+		t.Fatalf("expected out-of-range hour to be rejected")
+	}
+}
+
+func TestSchedulerOverlapAndPersistedMarker(t *testing.T) {
+	kv, err := OpenFileKV(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("OpenFileKV: %v", err)
+	}
+	s := newTestSweeper(t)
+	s.SetKV(kv)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in1"), Confirmed: true})
+	tmpl := PlanTemplate{Name: "sweep", Kind: TemplateConsolidate, Destinations: []TemplateDestination{{Address: testAddr("cold")}}, Schedule: "every 1h"}
+	sc, err := NewScheduler(s, []PlanTemplate{tmpl})
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	// Hold the sweeper so the first run stays in flight
+	sc.runMu.Lock()
+	now := time.Now()
+	if got := sc.Tick(now, 0); len(got) != 1 {
+		t.Fatalf("expected template to start, got %v", got)
+	}
+	if got := sc.Tick(now.Add(2*time.Hour), 0); len(got) != 0 {
+		t.Fatalf("running template must not fire again, got %v", got)
+	}
+	sc.runMu.Unlock()
+	sc.Wait()
+
+	// A fresh scheduler over the same store sees the marker
+	reopened, err := OpenFileKV(kv.path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s.SetKV(reopened)
+	m := sc.LastRun("sweep")
+	if m == nil || !m.Finished || m.PlanID == "" {
+		t.Fatalf("expected finished marker with plan ID, got %+v", m)
+	}
+	if got := sc.Tick(now.Add(30*time.Minute), 0); len(got) != 0 {
+		t.Fatalf("template fired before its interval elapsed")
+	}
+}
+
+func TestSchedulerShutdownDrainsAndStopsNewRuns(t *testing.T) {
+	kv, err := OpenFileKV(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("OpenFileKV: %v", err)
+	}
+	s := newTestSweeper(t)
+	s.SetKV(kv)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in1"), Confirmed: true})
+	tmpl := PlanTemplate{Name: "sweep", Kind: TemplateConsolidate, Destinations: []TemplateDestination{{Address: testAddr("cold")}}, Schedule: "every 1h"}
+	sc, err := NewScheduler(s, []PlanTemplate{tmpl})
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	sc.runMu.Lock()
+	now := time.Now()
+	sc.Tick(now, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sc.Shutdown(ctx); err == nil || !strings.Contains(err.Error(), "sweep") {
+		t.Fatalf("expected deadline error naming the in-flight run, got %v", err)
+	}
+	if m := sc.LastRun("sweep"); m == nil || m.Finished {
+		t.Fatalf("in-flight run must leave an unfinished marker, got %+v", m)
+	}
+	sc.runMu.Unlock()
+	if err := sc.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown after drain: %v", err)
+	}
+	if got := sc.Tick(now.Add(2*time.Hour), 0); len(got) != 0 {
+		t.Fatalf("stopped scheduler started %v", got)
+	}
+	if m := sc.LastRun("sweep"); m == nil || !m.Finished || !m.StartedAt.Equal(now) {
+		t.Fatalf("a run refused after Shutdown must not overwrite the marker, got %+v", m)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := kv.Put([]byte("k"), []byte("v")); err == nil {
+		t.Fatalf("expected Put after Close to fail")
+	}
+}
@@ -0,0 +1,145 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains a bloom filter pre-check for matching our output scripts.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ScriptFilter is a bloom filter over output scripts: MayContain never
+// misses an added script and wrongly matches others at about the false
+// positive rate it was sized for. It is not safe for concurrent Add.
+type ScriptFilter struct {
+	bits []uint64
+	m    uint64 // Number of bits
+	k    int    // Hash functions per script
+}
+
+// NewScriptFilter sizes a filter for n scripts at false positive rate fp
+// (e.g. 0.001).
+func NewScriptFilter(n int, fp float64) (*ScriptFilter, error) {
+	if n < 0 || fp <= 0 || fp >= 1 {
+		return nil, fmt.Errorf("script filter needs n >= 0 and 0 < fp < 1 (got %d, %v)", n, fp)
+	}
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &ScriptFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}, nil
+}
+
+// Two independent 64-bit FNV-1a hashes; bit i is h1 + i*h2 (Kirsch-Mitzenmacher)
+func scriptHashes(script []byte) (uint64, uint64) {
+	const prime = 1099511628211
+	h1, h2 := uint64(14695981039346656037), uint64(0x9e3779b97f4a7c15)
+	for _, b := range script {
+		h1 = (h1 ^ uint64(b)) * prime
+		h2 = (h2 ^ uint64(b)) * prime
+	}
+	return h1, h2 | 1
+}
+
+// Add inserts a script.
+func (f *ScriptFilter) Add(script []byte) {
+	h1, h2 := scriptHashes(script)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain reports whether script may have been added; false is definite.
+func (f *ScriptFilter) MayContain(script []byte) bool {
+	h1, h2 := scriptHashes(script)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ScriptIndex answers "is this script mine" for transactions seen on the
+// wire or in blocks: a ScriptFilter rejects almost every foreign output
+// cheaply, and only the rest are looked up exactly.
+type ScriptIndex struct {
+	filter  *ScriptFilter
+	scripts map[string]string // Raw script -> address
+}
+
+// scriptFilterFPRate is the false positive rate OwnScripts sizes its filter for.
+const scriptFilterFPRate = 0.001
+
+// OwnScripts builds a ScriptIndex over the sweeper's addresses: those of
+// indexed UTXOs and address history, the change address and every derived
+// account or multisig address. Rebuild it after deriving new addresses.
+func (s *Sweeper) OwnScripts() (*ScriptIndex, error) {
+	set := map[string]bool{}
+	for _, a := range s.ownAddresses() {
+		set[a] = true
+	}
+	for a := range s.accountKeys {
+		set[a] = true
+	}
+	for a := range s.multisigScripts {
+		set[a] = true
+	}
+	f, err := NewScriptFilter(len(set), scriptFilterFPRate)
+	if err != nil {
+		return nil, err
+	}
+	x := &ScriptIndex{filter: f, scripts: make(map[string]string, len(set))}
+	for a := range set {
+		script, err := s.buildOutputScript(a)
+		if err != nil {
+			return nil, fmt.Errorf("output script for %s: %w", a, err)
+		}
+		x.Add(script, a)
+	}
+	return x, nil
+}
+
+// Add registers a script and the address it pays.
+func (x *ScriptIndex) Add(script []byte, addr string) {
+	x.filter.Add(script)
+	x.scripts[string(script)] = addr
+}
+
+// Lookup returns the address of script if it is ours.
+func (x *ScriptIndex) Lookup(script []byte) (string, bool) {
+	if !x.filter.MayContain(script) {
+		return "", false
+	}
+	addr, ok := x.scripts[string(script)]
+	return addr, ok
+}
+
+// MatchTx returns the outputs of tx paying our scripts, as unconfirmed UTXOs.
+func (x *ScriptIndex) MatchTx(tx *MsgTx) ([]UTXO, error) {
+	if tx == nil {
+		return nil, errors.New("no transaction given")
+	}
+	var out []UTXO
+	var txid string
+	for i, o := range tx.TxOut {
+		addr, ok := x.Lookup(o.PkScript)
+		if !ok {
+			continue
+		}
+		if txid == "" {
+			txid = tx.TxID()
+		}
+		out = append(out, UTXO{TxID: txid, Vout: uint32(i), ValueSats: o.Value, Address: addr})
+	}
+	return out, nil
+}
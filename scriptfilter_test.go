@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestScriptFilterFalsePositives(t *testing.T) {
+	const n = 10_000
+	f, err := NewScriptFilter(n, 0.001)
+	if err != nil {
+		t.Fatalf("NewScriptFilter: %v", err)
+	}
+	script := func(i int) []byte {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		return BuildP2WPKHScript(Hash160(b[:]))
+	}
+	for i := 0; i < n; i++ {
+		f.Add(script(i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.MayContain(script(i)) {
+			t.Fatalf("added script %d missed", i)
+		}
+	}
+	fp := 0
+	for i := n; i < 11*n; i++ {
+		if f.MayContain(script(i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / (10 * n); rate > 0.003 {
+		t.Fatalf("false positive rate %.4f, sized for 0.001", rate)
+	}
+	if _, err := NewScriptFilter(10, 1); err == nil {
+		t.Fatalf("expected an invalid rate to be refused")
+	}
+}
+
+func TestOwnScriptsMatchTx(t *testing.T) {
+	a, err := NewXPubAccount(tvZpubBIP84, "", tvMasterFP, "", BitcoinMainnet)
+	if err != nil {
+		t.Fatalf("NewXPubAccount: %v", err)
+	}
+	recv, _ := a.derive(false, 0)
+	s := mustNewSweeper(t, recv.PubKey, BitcoinMainnet)
+	if err := s.SetXPubAccount(a, 5); err != nil {
+		t.Fatalf("SetXPubAccount: %v", err)
+	}
+	x, err := s.OwnScripts()
+	if err != nil {
+		t.Fatalf("OwnScripts: %v", err)
+	}
+	ours, _ := a.Address(true, 3)
+	foreign, _ := CreateP2WPKH(make([]byte, 20), BitcoinMainnet)
+	tx := &MsgTx{Version: 2, TxIn: []TxIn{{Sequence: 0xffffffff}}}
+	for _, addr := range []string{foreign, ours} {
+		script, _ := s.buildOutputScript(addr)
+		tx.TxOut = append(tx.TxOut, TxOut{Value: 42_000, PkScript: script})
+	}
+	got, err := x.MatchTx(tx)
+	if err != nil || len(got) != 1 || got[0].Address != ours || got[0].Vout != 1 || got[0].TxID != tx.TxID() {
+		t.Fatalf("MatchTx = %+v, %v", got, err)
+	}
+	if _, ok := x.Lookup(tx.TxOut[0].PkScript); ok {
+		t.Fatalf("foreign script reported as ours")
+	}
+}
@@ -0,0 +1,120 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the configuration snapshot recorded with each plan.
+package main
+
+// Version is the software version recorded in every plan's settings.
+const Version = "1.0.0"
+
+// PlanSettings is the effective configuration that produced a plan: Sweeper
+// defaults merged with any per-call SpendOptions. It is captured when the plan
+// is built and persisted with it, so later analysis can see exactly which knobs
+// were in force.
+type PlanSettings struct {
+	SoftwareVersion      string            `json:"software_version"`
+	Network              Network           `json:"network"`
+	FeeRate              int64             `json:"fee_rate"`               // sat/vB, rounded up
+	FeeRateKVB           FeeRate           `json:"fee_rate_kvb,omitempty"` // Exact rate in sat/kvB
+	DustSats             int64             `json:"dust_sats"`              // Per-call override (0 = policy)
+	DustPolicy           string            `json:"dust_policy"`
+	RBF                  bool              `json:"rbf"`
+	TxVersion            int32             `json:"tx_version"`
+	LockTime             uint32            `json:"lock_time,omitempty"`
+	AntiFeeSniping       bool              `json:"anti_fee_sniping,omitempty"`
+	Selection            SelectionStrategy `json:"selection"`
+	CoinSelector         string            `json:"coin_selector,omitempty"` // Type of a custom CoinSelector
+	TieBreak             TieBreak          `json:"tie_break,omitempty"`
+	TieBreakSeed         int64             `json:"tie_break_seed,omitempty"`
+	ConfirmedFirst       bool              `json:"confirmed_first,omitempty"`
+	MinConfirmations     int               `json:"min_confirmations"`
+	ChangePolicy         ChangePolicy      `json:"change_policy"`
+	AllowUnconfirmed     bool              `json:"allow_unconfirmed"`
+	MaxUnconfInputs      int               `json:"max_unconfirmed_inputs"`
+	MaxChainDepth        int               `json:"max_chain_depth"`
+	MinZeroConfScore     int               `json:"min_zero_conf_score"`
+	MaxUnconfExposure    int64             `json:"max_unconfirmed_exposure_sats"`
+	MaxDestExposure      int64             `json:"max_destination_exposure_sats,omitempty"`
+	DestLimitOverride    bool              `json:"destination_limit_override,omitempty"` // Planned with OverrideDestLimit
+	ChangeSplitParts     int               `json:"change_split_parts"`
+	MaxOutputsPerTx      int               `json:"max_outputs_per_tx,omitempty"`
+	ChangelessTolerance  int64             `json:"changeless_tolerance_sats,omitempty"`
+	ConsolidateFeeRate   int64             `json:"consolidate_below_fee_rate,omitempty"`     // Whole sat/vB, rounded up
+	ConsolidateRateKVB   FeeRate           `json:"consolidate_below_fee_rate_kvb,omitempty"` // Exact threshold in sat/kvB
+	ConsolidateMaxExtra  int               `json:"consolidate_max_extra_inputs,omitempty"`
+	LongTermFeeRate      FeeRate           `json:"long_term_fee_rate_kvb,omitempty"`
+	MaxFeeSats           int64             `json:"max_fee_sats,omitempty"`
+	MaxFeeRate           FeeRate           `json:"max_fee_rate_kvb,omitempty"`
+	MinInputs            int               `json:"min_inputs,omitempty"`
+	MaxInputs            int               `json:"max_inputs,omitempty"`
+	TargetChunkSats      int64             `json:"target_chunk_sats"`
+	MinChunkSats         int64             `json:"min_chunk_sats"`
+	AllocationWeights    []WeightedAddr    `json:"allocation_weights,omitempty"`
+	TaprootChange        bool              `json:"taproot_change"`
+	TaprootChangeProven  bool              `json:"taproot_change_verified"`
+	Multisig             string            `json:"multisig,omitempty"`            // e.g. "2-of-3 sortedmulti"
+	MuSig2Participants   int               `json:"musig2_participants,omitempty"` // Cosigners behind a MuSig2 change key
+	Account              string            `json:"account,omitempty"`             // e.g. "p2wpkh [d34db33f/84h/0h/0h]"
+	MempoolSourceEnabled bool              `json:"mempool_source"`
+	UTXOFilters          []string          `json:"utxo_filters,omitempty"` // Names of active filter hooks
+	FeeGuardMode         FeeGuardMode      `json:"fee_guard_mode,omitempty"`
+}
+
+// Capture the effective settings for a plan built with p
+func (s *Sweeper) snapshotSettings(p spendParams) PlanSettings {
+	return PlanSettings{
+		SoftwareVersion:      Version,
+		Network:              s.network,
+		FeeRate:              p.feeRate.CeilSatPerVB(),
+		FeeRateKVB:           p.feeRate,
+		DustSats:             p.dustOverride,
+		DustPolicy:           describeDustPolicy(s.dustPolicy),
+		RBF:                  p.rbf,
+		TxVersion:            s.txVersion,
+		LockTime:             p.lockTime,
+		AntiFeeSniping:       s.antiFeeSniping,
+		Selection:            p.selection,
+		CoinSelector:         s.coinSelectorName(),
+		TieBreak:             p.tieBreak,
+		TieBreakSeed:         p.tieSeed,
+		ConfirmedFirst:       p.confirmedFirst,
+		MinConfirmations:     p.minConf,
+		ChangePolicy:         p.change,
+		AllowUnconfirmed:     s.allowUnconfirmed,
+		MaxUnconfInputs:      s.maxUnconfInputs,
+		MaxChainDepth:        s.maxChainDepth,
+		MinZeroConfScore:     s.minZeroConfScore,
+		MaxUnconfExposure:    s.maxUnconfExposure,
+		MaxDestExposure:      s.maxDestExposure,
+		DestLimitOverride:    p.overrideDestLimit,
+		ChangeSplitParts:     s.changeSplitParts,
+		MaxOutputsPerTx:      s.maxOutputsPerTx,
+		ChangelessTolerance:  s.changelessTolerance,
+		ConsolidateFeeRate:   s.consolidateFeeRate.CeilSatPerVB(),
+		ConsolidateRateKVB:   s.consolidateFeeRate,
+		ConsolidateMaxExtra:  s.consolidateMaxExtra,
+		LongTermFeeRate:      s.longTermFeeRate,
+		MaxFeeSats:           p.maxFeeSats,
+		MaxFeeRate:           p.maxFeeRate,
+		MinInputs:            s.minInputs,
+		MaxInputs:            s.maxInputs,
+		TargetChunkSats:      s.targetChunkSats,
+		MinChunkSats:         s.minChunkSats,
+		AllocationWeights:    append([]WeightedAddr(nil), s.allocationByWeights...),
+		TaprootChange:        len(s.taprootChangeKey) == 32,
+		TaprootChangeProven:  s.changeKeyVerified,
+		Multisig:             s.multisigPolicy(),
+		MuSig2Participants:   s.musig2Participants(),
+		Account:              s.accountPolicy(),
+		MempoolSourceEnabled: s.mempool != nil,
+		UTXOFilters:          s.utxoFilterNames(),
+		FeeGuardMode:         s.feeGuardMode(),
+	}
+}
+
+// Exact fee rate the plan was built at; plans recorded before FeeRateKVB
+// carry only the whole sat/vB rate
+func (st PlanSettings) feeRateKVB() FeeRate {
+	if st.FeeRateKVB > 0 {
+		return st.FeeRateKVB
+	}
+	return SatPerVByte(st.FeeRate)
+}
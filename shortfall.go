@@ -0,0 +1,84 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the shortfall report returned when a spend is underfunded.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShortfallError reports a spend the spendable balance cannot cover, with the
+// value each policy kept out of selection, so it is clear which one to relax.
+// Test for it with errors.As.
+type ShortfallError struct {
+	TargetSats    int64 `json:"target_sats"`    // Outputs to pay
+	FeeSats       int64 `json:"fee_sats"`       // Fee of spending every available coin with change
+	AvailableSats int64 `json:"available_sats"` // Spendable after every filter
+	// Additional spendable sats needed: TargetSats + FeeSats - AvailableSats,
+	// before the fee of the inputs that bring them
+	NeededSats int64 `json:"needed_sats"`
+
+	DustSats          int64 `json:"dust_sats"`          // Below dust, or costing more to spend than they hold
+	UnconfirmedSats   int64 `json:"unconfirmed_sats"`   // Unconfirmed policy: not allowed, input limit or zero-conf score
+	ConfirmationsSats int64 `json:"confirmations_sats"` // Too few confirmations, or not yet mature
+	LockedSats        int64 `json:"locked_sats"`        // Locked, or excluded by the caller
+	FilteredSats      int64 `json:"filtered_sats"`      // Vetoed by UTXO filter hooks
+}
+
+// Error implements error. It keeps the "balance is not enough" wording of the
+// plain error it replaces.
+func (e *ShortfallError) Error() string {
+	msg := fmt.Sprintf("balance is not enough for outputs + fee: need %d more sats (%d spendable for %d of outputs and a %d-sat fee)", e.NeededSats, e.AvailableSats, e.TargetSats, e.FeeSats)
+	var excluded []string
+	for _, x := range []struct {
+		sats int64
+		what string
+	}{
+		{e.DustSats, "dust or uneconomical"},
+		{e.UnconfirmedSats, "unconfirmed policy"},
+		{e.ConfirmationsSats, "confirmations or maturity"},
+		{e.LockedSats, "locked or excluded"},
+		{e.FilteredSats, "UTXO filters"},
+	} {
+		if x.sats > 0 {
+			excluded = append(excluded, fmt.Sprintf("%d sats by %s", x.sats, x.what))
+		}
+	}
+	if len(excluded) == 0 {
+		return msg + " - index more UTXOs or reduce outputs"
+	}
+	return msg + "; excluded " + strings.Join(excluded, ", ") + " - relax those policies, index more UTXOs or reduce outputs"
+}
+
+// Build the shortfall report of a spend of targetOutSats to nFixedOutputs
+// outputs (plus change) from utxos
+func (s *Sweeper) shortfall(utxos []UTXO, targetOutSats int64, nFixedOutputs int, p spendParams) *ShortfallError {
+	e := &ShortfallError{TargetSats: targetOutSats}
+	var spendable []UTXO
+	for _, u := range s.filterUTXOs(utxos, p) {
+		if s.uneconomical(u, p.feeRate) {
+			e.DustSats += u.ValueSats
+			continue
+		}
+		spendable = append(spendable, u)
+		e.AvailableSats += u.ValueSats
+	}
+	_, rejected := s.screenUTXOs(utxos, p)
+	for _, r := range rejected {
+		switch r.Kind {
+		case RejectDust:
+			e.DustSats += r.UTXO.ValueSats
+		case RejectUnconfirmed:
+			e.UnconfirmedSats += r.UTXO.ValueSats
+		case RejectConfirmations:
+			e.ConfirmationsSats += r.UTXO.ValueSats
+		case RejectLocked:
+			e.LockedSats += r.UTXO.ValueSats
+		case RejectFiltered:
+			e.FilteredSats += r.UTXO.ValueSats
+		}
+	}
+	e.FeeSats = p.feeRate.Fee(s.selectionVBytes(spendable, nFixedOutputs+1))
+	e.NeededSats = e.TargetSats + e.FeeSats - e.AvailableSats
+	return e
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestShortfallReport(t *testing.T) {
+	s := newTestSweeper(t, WithUnconfirmedPolicy(false, 0, 0))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 40_000, Address: testAddr("in"), Confirmed: true})
+	if err := s.LockUTXO(stringsRepeat("b", 64), 0); err != nil {
+		t.Fatalf("LockUTXO: %v", err)
+	}
+	_ = s.AddUTXOFilter("kyc", func(u UTXO) error {
+		if u.ValueSats == 40_000 {
+			return errors.New("pending review")
+		}
+		return nil
+	})
+
+	_, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}})
+	var short *ShortfallError
+	if !errors.As(err, &short) {
+		t.Fatalf("expected a *ShortfallError, got %v", err)
+	}
+	if short.TargetSats != 150_000 || short.AvailableSats != 100_000 || short.LockedSats != 80_000 || short.FilteredSats != 40_000 {
+		t.Fatalf("report %+v", short)
+	}
+	if short.NeededSats != 50_000+short.FeeSats || short.FeeSats <= 0 {
+		t.Fatalf("needed %d with fee %d", short.NeededSats, short.FeeSats)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "balance is not enough") || !strings.Contains(msg, "80000 sats by locked") {
+		t.Fatalf("message %q", msg)
+	}
+
+	rep, _ := s.ExplainSelection()
+	for _, r := range rep.Rejected {
+		if r.Kind != RejectLocked && r.Kind != RejectFiltered {
+			t.Fatalf("rejection %+v has the wrong kind", r)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains signature hashes and checks of signatures returned by signers.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// sigHasher computes the signature hashes of one transaction's inputs
+type sigHasher struct {
+	tx    *MsgTx
+	prevs []*TxOut // Output spent by each input; nil where unknown
+}
+
+// Double SHA-256 of the parts of tx BIP-143 commits to unless hashType opts out
+func (h *sigHasher) witnessV0Hashes(idx int, hashType uint32) (prevouts, sequences, outputs [32]byte) {
+	base := hashType & 0x1f
+	acp := hashType&sighashAnyoneCanPay != 0
+	var pb, sb, ob bytes.Buffer
+	for _, in := range h.tx.TxIn {
+		pb.Write(in.PreviousOutPoint.Hash[:])
+		_ = binary.Write(&pb, binary.LittleEndian, in.PreviousOutPoint.Index)
+		_ = binary.Write(&sb, binary.LittleEndian, in.Sequence)
+	}
+	if !acp {
+		prevouts = sha256Double(pb.Bytes())
+		if base != sighashNone && base != sighashSingle {
+			sequences = sha256Double(sb.Bytes())
+		}
+	}
+	switch {
+	case base != sighashNone && base != sighashSingle:
+		for i := range h.tx.TxOut {
+			ob.Write(serializeTxOut(&h.tx.TxOut[i]))
+		}
+		outputs = sha256Double(ob.Bytes())
+	case base == sighashSingle && idx < len(h.tx.TxOut):
+		outputs = sha256Double(serializeTxOut(&h.tx.TxOut[idx]))
+	}
+	return prevouts, sequences, outputs
+}
+
+// BIP-143 signature hash of input idx spending amount with scriptCode
+func (h *sigHasher) witnessV0(idx int, scriptCode []byte, amount int64, hashType uint32) [32]byte {
+	prevouts, sequences, outputs := h.witnessV0Hashes(idx, hashType)
+	in := h.tx.TxIn[idx]
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, h.tx.Version)
+	b.Write(prevouts[:])
+	b.Write(sequences[:])
+	b.Write(in.PreviousOutPoint.Hash[:])
+	_ = binary.Write(&b, binary.LittleEndian, in.PreviousOutPoint.Index)
+	writeVarInt(&b, uint64(len(scriptCode)))
+	b.Write(scriptCode)
+	_ = binary.Write(&b, binary.LittleEndian, amount)
+	_ = binary.Write(&b, binary.LittleEndian, in.Sequence)
+	b.Write(outputs[:])
+	_ = binary.Write(&b, binary.LittleEndian, h.tx.LockTime)
+	_ = binary.Write(&b, binary.LittleEndian, hashType)
+	return sha256Double(b.Bytes())
+}
+
+// BIP-341 key-path signature hash of input idx (no annex)
+func (h *sigHasher) taprootKeyPath(idx int, hashType byte) ([32]byte, error) {
+	switch hashType {
+	case 0x00, 0x01, 0x02, 0x03, 0x81, 0x82, 0x83:
+	default:
+		return [32]byte{}, fmt.Errorf("invalid taproot sighash type %#x", hashType)
+	}
+	base := hashType & 0x03
+	acp := hashType&sighashAnyoneCanPay != 0
+	var b bytes.Buffer
+	b.WriteByte(0x00) // Epoch
+	b.WriteByte(hashType)
+	_ = binary.Write(&b, binary.LittleEndian, h.tx.Version)
+	_ = binary.Write(&b, binary.LittleEndian, h.tx.LockTime)
+	if !acp {
+		var pb, ab, sb, qb bytes.Buffer
+		for i, in := range h.tx.TxIn {
+			prev := h.prevs[i]
+			if prev == nil {
+				return [32]byte{}, fmt.Errorf("taproot signature hash needs the output spent by input %d", i)
+			}
+			pb.Write(in.PreviousOutPoint.Hash[:])
+			_ = binary.Write(&pb, binary.LittleEndian, in.PreviousOutPoint.Index)
+			_ = binary.Write(&ab, binary.LittleEndian, prev.Value)
+			writeVarInt(&sb, uint64(len(prev.PkScript)))
+			sb.Write(prev.PkScript)
+			_ = binary.Write(&qb, binary.LittleEndian, in.Sequence)
+		}
+		for _, part := range []*bytes.Buffer{&pb, &ab, &sb, &qb} {
+			b.Write(SHA256(part.Bytes()))
+		}
+	}
+	if base != sighashNone && base != sighashSingle {
+		var ob bytes.Buffer
+		for i := range h.tx.TxOut {
+			ob.Write(serializeTxOut(&h.tx.TxOut[i]))
+		}
+		b.Write(SHA256(ob.Bytes()))
+	}
+	b.WriteByte(0x00) // Key path spend without annex
+	if acp {
+		in, prev := h.tx.TxIn[idx], h.prevs[idx]
+		b.Write(in.PreviousOutPoint.Hash[:])
+		_ = binary.Write(&b, binary.LittleEndian, in.PreviousOutPoint.Index)
+		_ = binary.Write(&b, binary.LittleEndian, prev.Value)
+		writeVarInt(&b, uint64(len(prev.PkScript)))
+		b.Write(prev.PkScript)
+		_ = binary.Write(&b, binary.LittleEndian, in.Sequence)
+	} else {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(idx))
+	}
+	if base == sighashSingle {
+		if idx >= len(h.tx.TxOut) {
+			return [32]byte{}, errors.New("SIGHASH_SINGLE taproot signature without a matching output")
+		}
+		b.Write(SHA256(serializeTxOut(&h.tx.TxOut[idx])))
+	}
+	return taggedHash("TapSighash", b.Bytes()), nil
+}
+
+// Check a DER signature with its trailing sighash byte by pub over the
+// digest hash returns for that sighash type
+func checkECDSASig(pub, sig []byte, hash func(hashType uint32) ([32]byte, error)) error {
+	if len(sig) < 2 {
+		return errors.New("signature too short")
+	}
+	digest, err := hash(uint32(sig[len(sig)-1]))
+	if err != nil {
+		return err
+	}
+	return VerifyECDSA(pub, digest[:], sig[:len(sig)-1])
+}
+
+// Check a 64- or 65-byte taproot key-path signature of input idx by the
+// output key of its script
+func (h *sigHasher) checkTaprootSig(idx int, script, sig []byte) error {
+	var hashType byte
+	switch len(sig) {
+	case 64:
+	case 65:
+		if hashType = sig[64]; hashType == 0x00 {
+			return errors.New("65-byte taproot signature with the default sighash type")
+		}
+	default:
+		return errors.New("taproot signature must be 64 or 65 bytes")
+	}
+	digest, err := h.taprootKeyPath(idx, hashType)
+	if err != nil {
+		return err
+	}
+	return VerifySchnorr(script[2:34], digest[:], sig[:64])
+}
+
+// VerifyECDSA checks a strict-DER, low-S ECDSA signature of a 32-byte digest
+// by a compressed secp256k1 public key.
+func VerifyECDSA(pub, digest, der []byte) error {
+	if len(digest) != 32 {
+		return errors.New("digest must be 32 bytes")
+	}
+	Q, err := decompressPubKey(pub)
+	if err != nil {
+		return err
+	}
+	r, s, err := parseDERSignature(der)
+	if err != nil {
+		return err
+	}
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(secpN) >= 0 || s.Cmp(secpN) >= 0 {
+		return errors.New("signature out of range")
+	}
+	if s.Cmp(new(big.Int).Rsh(secpN, 1)) > 0 {
+		return errors.New("non-canonical high-S signature")
+	}
+	w := new(big.Int).ModInverse(s, secpN)
+	u1 := new(big.Int).SetBytes(digest)
+	u1.Mul(u1, w).Mod(u1, secpN)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, secpN)
+	R := ecAdd(ecMul(&ecPoint{secpGx, secpGy}, u1), ecMul(Q, u2))
+	if R == nil || new(big.Int).Mod(R.x, secpN).Cmp(r) != 0 {
+		return errors.New("invalid ECDSA signature")
+	}
+	return nil
+}
+
+// Parse a strictly DER-encoded (BIP-66) signature into r and s
+func parseDERSignature(der []byte) (*big.Int, *big.Int, error) {
+	bad := errors.New("signature is not strict DER")
+	if len(der) < 8 || len(der) > 72 || der[0] != 0x30 || int(der[1]) != len(der)-2 {
+		return nil, nil, bad
+	}
+	rest := der[2:]
+	var ints [2]*big.Int
+	for i := range ints {
+		if len(rest) < 2 || rest[0] != 0x02 {
+			return nil, nil, bad
+		}
+		l := int(rest[1])
+		if l == 0 || 2+l > len(rest) {
+			return nil, nil, bad
+		}
+		v := rest[2 : 2+l]
+		// Positive and minimally encoded
+		if v[0]&0x80 != 0 || (l > 1 && v[0] == 0 && v[1]&0x80 == 0) {
+			return nil, nil, bad
+		}
+		ints[i] = new(big.Int).SetBytes(v)
+		rest = rest[2+l:]
+	}
+	if len(rest) != 0 {
+		return nil, nil, bad
+	}
+	return ints[0], ints[1], nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// testECDSAKey holds one secret key and signs ECDSA with a deterministic nonce
+type testECDSAKey struct{ d *big.Int }
+
+func (k testECDSAKey) pub() []byte {
+	return compressPubKey(ecMul(&ecPoint{secpGx, secpGy}, k.d))
+}
+
+// DER signature of digest with low S, followed by the sighash byte
+func (k testECDSAKey) sign(digest [32]byte, hashType byte) []byte {
+	nh := sha256.Sum256(append(k.d.FillBytes(make([]byte, 32)), digest[:]...))
+	nonce := new(big.Int).Mod(new(big.Int).SetBytes(nh[:]), secpN)
+	r := new(big.Int).Mod(ecMul(&ecPoint{secpGx, secpGy}, nonce).x, secpN)
+	s := new(big.Int).Mul(r, k.d)
+	s.Add(s, new(big.Int).SetBytes(digest[:])).Mul(s, new(big.Int).ModInverse(nonce, secpN)).Mod(s, secpN)
+	if s.Cmp(new(big.Int).Rsh(secpN, 1)) > 0 {
+		s.Sub(secpN, s)
+	}
+	return append(k.derFor(r, s), hashType)
+}
+
+// Add the key's SIGHASH_ALL signature to every P2WPKH, P2PKH and P2WSH
+// multisig input of ps it can sign
+func (k testECDSAKey) signPSBT(t *testing.T, ps *PSBT) {
+	t.Helper()
+	pub := k.pub()
+	h := &sigHasher{tx: ps.UnsignedTx, prevs: make([]*TxOut, len(ps.Inputs))}
+	for i := range ps.Inputs {
+		h.prevs[i] = spentOutput(&ps.Inputs[i], ps.UnsignedTx.TxIn[i].PreviousOutPoint)
+	}
+	for i := range ps.Inputs {
+		in, prev := &ps.Inputs[i], h.prevs[i]
+		if prev == nil {
+			t.Fatalf("input %d has no spent output to sign", i)
+		}
+		var digest [32]byte
+		switch {
+		case isP2WPKHScript(prev.PkScript) && bytesEqual(Hash160(pub), prev.PkScript[2:]):
+			digest = h.witnessV0(i, BuildP2PKHScript(prev.PkScript[2:]), prev.Value, sighashAll)
+		case isP2PKHScript(prev.PkScript) && bytesEqual(Hash160(pub), prev.PkScript[3:23]):
+			digest, _ = LegacySigHash(ps.UnsignedTx, i, prev.PkScript, sighashAll)
+		case len(in.WitnessScript) > 0:
+			digest = h.witnessV0(i, in.WitnessScript, prev.Value, sighashAll)
+		default:
+			continue
+		}
+		if in.PartialSigs == nil {
+			in.PartialSigs = map[string][]byte{}
+		}
+		in.PartialSigs[string(pub)] = k.sign(digest, sighashAll)
+	}
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	k := testECDSAKey{d: big.NewInt(0x5eed)}
+	digest := sha256.Sum256([]byte("sweep"))
+	sig := k.sign(digest, sighashAll)
+	der := sig[:len(sig)-1]
+	if err := VerifyECDSA(k.pub(), digest[:], der); err != nil {
+		t.Fatalf("VerifyECDSA: %v", err)
+	}
+	other := sha256.Sum256([]byte("other"))
+	if err := VerifyECDSA(k.pub(), other[:], der); err == nil {
+		t.Fatalf("expected a signature of another digest to fail")
+	}
+	if err := VerifyECDSA(testECDSAKey{d: big.NewInt(7)}.pub(), digest[:], der); err == nil {
+		t.Fatalf("expected another key to fail")
+	}
+
+	// The high-S twin of a valid signature is non-standard
+	r, s, _ := parseDERSignature(der)
+	high := testECDSAKey{}.derFor(r, new(big.Int).Sub(secpN, s))
+	if err := VerifyECDSA(k.pub(), digest[:], high); err == nil || !strings.Contains(err.Error(), "high-S") {
+		t.Fatalf("expected high S to be refused, got %v", err)
+	}
+	for _, bad := range [][]byte{{0x30, 0x44, 0x01}, append([]byte{0x30, byte(len(der) - 1)}, der[2:]...), append(append([]byte{}, der...), 0)} {
+		if err := VerifyECDSA(k.pub(), digest[:], bad); err == nil {
+			t.Fatalf("expected %x to be refused as DER", bad)
+		}
+	}
+}
+
+// DER encoding of r and s without normalization
+func (testECDSAKey) derFor(r, s *big.Int) []byte {
+	enc := func(v *big.Int) []byte {
+		b := v.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+	body := append(enc(r), enc(s)...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+func TestWitnessV0SigHashBIP143(t *testing.T) {
+	// BIP-143 native P2WPKH example, second input
+	raw, _ := hex.DecodeString("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		t.Fatalf("DeserializeMsgTx: %v", err)
+	}
+	keyHash, _ := hex.DecodeString("1d0f172a0ecb48aee1be1f2687d2963ae33f71a1")
+	h := &sigHasher{tx: tx, prevs: make([]*TxOut, 2)}
+	got := h.witnessV0(1, BuildP2PKHScript(keyHash), 600_000_000, sighashAll)
+	if want := "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670"; hex.EncodeToString(got[:]) != want {
+		t.Fatalf("sighash = %x, want %s", got, want)
+	}
+}
+
+func TestFinalizeVerifiesSignatures(t *testing.T) {
+	key := testECDSAKey{d: big.NewInt(0xc0ffee)}
+	addr, _ := CreateP2WPKH(Hash160(key.pub()), BitcoinTestnet)
+	s := mustNewSweeper(t, key.pub(), BitcoinTestnet)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: addr, Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: DEFAULT_DEST_ADDR, ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+
+	// A signature by another key filed under ours is refused
+	forged, _ := ParsePSBT(plan.PSBT.Serialize())
+	prev := forged.Inputs[0].WitnessUtxo
+	h := &sigHasher{tx: forged.UnsignedTx, prevs: []*TxOut{prev}}
+	digest := h.witnessV0(0, BuildP2PKHScript(prev.PkScript[2:]), prev.Value, sighashAll)
+	forged.Inputs[0].PartialSigs[string(key.pub())] = testECDSAKey{d: big.NewInt(0xbad)}.sign(digest, sighashAll)
+	if _, err := finalizeSignedPSBT(plan, forged); err == nil || !strings.Contains(err.Error(), "invalid ECDSA signature") {
+		t.Fatalf("expected a forged partial signature to be refused, got %v", err)
+	}
+	forged.Inputs[0].PartialSigs[string(key.pub())] = []byte{0x30, 0x44, 0x01}
+	if _, err := finalizeSignedPSBT(plan, forged); err == nil {
+		t.Fatalf("expected a malformed partial signature to be refused")
+	}
+
+	signed, _ := ParsePSBT(plan.PSBT.Serialize())
+	key.signPSBT(t, signed)
+	tx, err := finalizeSignedPSBT(plan, signed)
+	if err != nil {
+		t.Fatalf("finalizeSignedPSBT: %v", err)
+	}
+
+	// A finalized witness is checked too
+	signed.Inputs[0].PartialSigs = nil
+	signed.Inputs[0].FinalScriptWitness = tx.TxIn[0].Witness
+	if _, err := finalizeSignedPSBT(plan, signed); err != nil {
+		t.Fatalf("finalized input refused: %v", err)
+	}
+	bad := append([]byte{}, tx.TxIn[0].Witness[0]...)
+	bad[len(bad)-1] = sighashNone
+	signed.Inputs[0].FinalScriptWitness = [][]byte{bad, key.pub()}
+	if _, err := finalizeSignedPSBT(plan, signed); err == nil {
+		t.Fatalf("expected a finalized witness with a wrong signature to be refused")
+	}
+}
+
+func TestFinalizeTaprootKeyPath(t *testing.T) {
+	signer := testSigner{d: big.NewInt(0x7a9)}
+	script := append([]byte{0x51, 0x20}, signer.xOnly()...)
+	tx := NewMsgTx(2)
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{1}}, Sequence: 0xfffffffd})
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{2}, Index: 1}, Sequence: 0xfffffffd})
+	tx.AddTxOut(TxOut{Value: 90_000, PkScript: script})
+	h := &sigHasher{tx: tx, prevs: []*TxOut{{Value: 50_000, PkScript: script}, {Value: 50_000, PkScript: script}}}
+
+	digest, err := h.taprootKeyPath(1, 0x00)
+	if err != nil {
+		t.Fatalf("taprootKeyPath: %v", err)
+	}
+	sig, _ := signer.SignSchnorr(nil, digest)
+	if _, wit, err := finalizeInput(h, 1, &PSBTInput{TapKeySig: sig}); err != nil || len(wit) != 1 {
+		t.Fatalf("finalizeInput: %v", err)
+	}
+	// The signature commits to the input index, every spent amount and the
+	// sighash type
+	if _, _, err := finalizeInput(h, 0, &PSBTInput{TapKeySig: sig}); err == nil {
+		t.Fatalf("expected a signature for another input to be refused")
+	}
+	h.prevs[0] = &TxOut{Value: 50_001, PkScript: script}
+	if _, _, err := finalizeInput(h, 1, &PSBTInput{TapKeySig: sig}); err == nil {
+		t.Fatalf("expected a changed spent amount to invalidate the signature")
+	}
+	if _, _, err := finalizeInput(h, 1, &PSBTInput{TapKeySig: append(sig, sighashAll)}); err == nil {
+		t.Fatalf("expected an explicit sighash byte to change the digest")
+	}
+	h.prevs[0] = nil
+	if _, _, err := finalizeInput(h, 1, &PSBTInput{TapKeySig: sig}); err == nil {
+		t.Fatalf("expected a missing spent output to be reported")
+	}
+}
@@ -0,0 +1,245 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains BIP-352 silent payment sending.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Silent payment address HRPs per network (BIP-352)
+var silentPaymentHRPs = map[Network]string{
+	BitcoinMainnet: "sp",
+	BitcoinTestnet: "tsp",
+	BitcoinRegtest: "sprt",
+}
+
+// SilentPaymentAddress is a decoded sp1… address: the recipient's scan and
+// spend public keys.
+type SilentPaymentAddress struct {
+	ScanKey  []byte // 33-byte compressed B_scan
+	SpendKey []byte // 33-byte compressed B_spend (possibly labeled)
+	Network  Network
+}
+
+// DecodeSilentPaymentAddress parses a BIP-352 silent payment address. Version
+// 0 carries exactly the two keys; later versions (up to 30) may append data,
+// which is ignored as the BIP requires.
+func DecodeSilentPaymentAddress(addr string) (*SilentPaymentAddress, error) {
+	hrp, data, err := bech32Parse(addr, 1023)
+	if err != nil {
+		return nil, err
+	}
+	if !bech32VerifyChecksum(hrp, data, 0x2bc830a3) {
+		return nil, errors.New("invalid silent payment address checksum")
+	}
+	var network Network
+	found := false
+	for net, h := range silentPaymentHRPs {
+		if h == hrp {
+			network, found = net, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown silent payment HRP %q", hrp)
+	}
+	version := data[0]
+	if version == 31 {
+		return nil, errors.New("silent payment address version 31 is reserved")
+	}
+	payload, err := convertBits(data[1:len(data)-6], 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 66 || (version == 0 && len(payload) != 66) {
+		return nil, fmt.Errorf("silent payment address carries %d bytes, want 66", len(payload))
+	}
+	a := &SilentPaymentAddress{ScanKey: payload[:33], SpendKey: payload[33:66], Network: network}
+	for _, k := range [][]byte{a.ScanKey, a.SpendKey} {
+		if _, err := decompressPubKey(k); err != nil {
+			return nil, fmt.Errorf("silent payment address key: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// String encodes the address as version 0.
+func (a *SilentPaymentAddress) String() string {
+	prog, _ := convert8to5(append(append([]byte{}, a.ScanKey...), a.SpendKey...))
+	return bech32Encode(silentPaymentHRPs[a.Network], append([]int{0}, prog...), 0x2bc830a3)
+}
+
+// Cheap check used to route destinations before full decoding
+func isSilentPaymentAddress(addr string) bool {
+	lower := strings.ToLower(addr)
+	for _, h := range silentPaymentHRPs {
+		if strings.HasPrefix(lower, h+"1") {
+			return true
+		}
+	}
+	return false
+}
+
+// SilentPaymentSigner holds the input private keys and computes the ECDH
+// share a·B_scan for a recipient scan key, where a is the sum of the private
+// keys of the given inputs, each negated first if it is a taproot key whose
+// output key has an odd y coordinate. The result is a 33-byte compressed point.
+//
+// The signer must compute the share over exactly the inputs it is given, and
+// the transaction it later signs must spend exactly the plan's inputs: the
+// silent payment output commits to them, so adding, removing or replacing an
+// input after planning sends the payment to a key the recipient cannot find.
+// Re-plan instead of editing the PSBT, and sign with SIGHASH_ALL or DEFAULT.
+type SilentPaymentSigner interface {
+	SilentPaymentECDH(inputs []UTXO, scanKey []byte) ([]byte, error)
+}
+
+// SetSilentPaymentSigner enables paying sp1… addresses. The signer supplies
+// the ECDH shares the output keys are derived from, since the watch-only
+// sweeper never sees private keys.
+func (s *Sweeper) SetSilentPaymentSigner(signer SilentPaymentSigner) {
+	s.spSigner = signer
+}
+
+// Decode a silent payment destination for this sweeper
+func (s *Sweeper) decodeSilentPayment(addr string) (*SilentPaymentAddress, error) {
+	sp, err := DecodeSilentPaymentAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if sp.Network != s.network {
+		return nil, s.networkMismatch(addr, sp.Network)
+	}
+	if s.spSigner == nil {
+		return nil, errors.New("paying a silent payment address needs a signer for the ECDH share - call SetSilentPaymentSigner")
+	}
+	return sp, nil
+}
+
+// Public key an input's signature will be checked against, if the input is
+// eligible for silent payments (P2WPKH, P2PKH with a compressed key, P2TR key
+// path); taproot keys are returned with even y as BIP-352 requires. A P2WPKH
+// or P2PKH input whose key is unknown is an error: the receiver reads the key
+// from the spend and would count it, so leaving it out would pay an output
+// the receiver never finds.
+func (s *Sweeper) silentPaymentInputKey(u UTXO) ([]byte, bool, error) {
+	dec, err := s.decodeAddress(u.Address)
+	if err != nil {
+		return nil, false, nil
+	}
+	switch dec.Type {
+	case P2TR:
+		return append([]byte{0x02}, dec.Data...), true, nil
+	case P2WPKH, P2PKH:
+		if k := s.accountKeys[u.Address]; k != nil {
+			return k.PubKey, true, nil
+		}
+		if len(s.pubKey) == 33 && bytes.Equal(Hash160(s.pubKey), dec.Data) {
+			return s.pubKey, true, nil
+		}
+		return nil, false, fmt.Errorf("cannot pay a silent payment address: the public key of input %s is unknown", outpointKey(u))
+	}
+	return nil, false, nil
+}
+
+// Output scripts for the silent payment outputs among outputs, by index
+func (s *Sweeper) silentPaymentScripts(inputs []UTXO, outputs []TxOutput) (map[int][]byte, error) {
+	type recipient struct {
+		idx int
+		sp  *SilentPaymentAddress
+	}
+	var groups [][]recipient // By scan key, in order of first appearance
+	for i, out := range outputs {
+		if !isSilentPaymentAddress(out.Address) {
+			continue
+		}
+		sp, err := s.decodeSilentPayment(out.Address)
+		if err != nil {
+			return nil, err
+		}
+		placed := false
+		for g := range groups {
+			if bytes.Equal(groups[g][0].sp.ScanKey, sp.ScanKey) {
+				groups[g] = append(groups[g], recipient{i, sp})
+				placed = true
+			}
+		}
+		if !placed {
+			groups = append(groups, []recipient{{i, sp}})
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	// A = sum of eligible input keys; input_hash commits to it and the
+	// smallest outpoint of the transaction
+	var eligible []UTXO
+	var sum *ecPoint
+	var smallest []byte
+	for _, in := range inputs {
+		op, err := NewOutPointFromStr(in.TxID, in.Vout)
+		if err != nil {
+			return nil, err
+		}
+		ser := binary.LittleEndian.AppendUint32(append([]byte{}, op.Hash[:]...), op.Index)
+		if smallest == nil || bytes.Compare(ser, smallest) < 0 {
+			smallest = ser
+		}
+		key, ok, err := s.silentPaymentInputKey(in)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		pt, err := decompressPubKey(key)
+		if err != nil {
+			return nil, err
+		}
+		sum = ecAdd(sum, pt)
+		eligible = append(eligible, in)
+	}
+	if len(eligible) == 0 {
+		return nil, errors.New("silent payments need at least one P2WPKH, P2PKH or P2TR input - multisig inputs cannot be used")
+	}
+	if sum == nil {
+		return nil, errors.New("silent payment input keys sum to infinity - add or change an input")
+	}
+	ih := taggedHash("BIP0352/Inputs", smallest, compressPubKey(sum))
+	inputHash := new(big.Int).SetBytes(ih[:])
+	if inputHash.Sign() == 0 || inputHash.Cmp(secpN) >= 0 {
+		return nil, errors.New("silent payment input hash is not a valid scalar - change the input set")
+	}
+
+	scripts := map[int][]byte{}
+	for _, g := range groups {
+		share, err := s.spSigner.SilentPaymentECDH(eligible, g[0].sp.ScanKey)
+		if err != nil {
+			return nil, fmt.Errorf("silent payment signer: %w", err)
+		}
+		pt, err := decompressPubKey(share)
+		if err != nil {
+			return nil, fmt.Errorf("silent payment signer returned an invalid ECDH share: %w", err)
+		}
+		shared := compressPubKey(ecMul(pt, inputHash))
+		for k, r := range g {
+			th := taggedHash("BIP0352/SharedSecret", shared, binary.BigEndian.AppendUint32(nil, uint32(k)))
+			t := new(big.Int).SetBytes(th[:])
+			if t.Sign() == 0 || t.Cmp(secpN) >= 0 {
+				return nil, errors.New("silent payment tweak is not a valid scalar - change the input set")
+			}
+			spend, _ := decompressPubKey(r.sp.SpendKey)
+			p := ecAdd(spend, ecMul(&ecPoint{secpGx, secpGy}, t))
+			if p == nil {
+				return nil, errors.New("silent payment output key is the point at infinity")
+			}
+			scripts[r.idx] = BuildP2TRScript(p.x.FillBytes(make([]byte, 32)))
+		}
+	}
+	return scripts, nil
+}
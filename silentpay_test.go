@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Signs for inputs that all belong to one private key
+type fakeSPSigner struct{ priv *big.Int }
+
+func (f fakeSPSigner) SilentPaymentECDH(inputs []UTXO, scanKey []byte) ([]byte, error) {
+	a := new(big.Int).Mul(f.priv, big.NewInt(int64(len(inputs))))
+	b, err := decompressPubKey(scanKey)
+	if err != nil {
+		return nil, err
+	}
+	return compressPubKey(ecMul(b, a.Mod(a, secpN))), nil
+}
+
+func pubFromPriv(k int64) []byte {
+	return compressPubKey(ecMul(&ecPoint{secpGx, secpGy}, big.NewInt(k)))
+}
+
+func TestSilentPaymentAddress(t *testing.T) {
+	sp := &SilentPaymentAddress{ScanKey: pubFromPriv(11), SpendKey: pubFromPriv(13), Network: BitcoinMainnet}
+	addr := sp.String()
+	if !strings.HasPrefix(addr, "sp1q") || len(addr) <= 90 {
+		t.Fatalf("unexpected address %s", addr)
+	}
+	dec, err := DecodeSilentPaymentAddress(addr)
+	if err != nil || !bytes.Equal(dec.ScanKey, sp.ScanKey) || !bytes.Equal(dec.SpendKey, sp.SpendKey) || dec.Network != BitcoinMainnet {
+		t.Fatalf("round trip failed: %+v %v", dec, err)
+	}
+	if _, err := DecodeSilentPaymentAddress(addr[:len(addr)-1] + "q"); err == nil {
+		t.Fatalf("expected a checksum error")
+	}
+	tsp := &SilentPaymentAddress{ScanKey: sp.ScanKey, SpendKey: sp.SpendKey, Network: BitcoinTestnet}
+	if !strings.HasPrefix(tsp.String(), "tsp1q") {
+		t.Fatalf("unexpected testnet address %s", tsp)
+	}
+}
+
+func TestSilentPaymentSend(t *testing.T) {
+	const priv, scanPriv = 7, 11
+	pub := pubFromPriv(priv)
+	s := mustNewSweeper(t, pub, BitcoinMainnet)
+	own, _ := CreateP2WPKH(Hash160(pub), BitcoinMainnet)
+	for _, c := range []string{"b", "a"} {
+		if err := s.Index(UTXO{TxID: stringsRepeat(c, 64), Vout: 1, ValueSats: 100_000, Address: own, Confirmed: true}); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	sp := &SilentPaymentAddress{ScanKey: pubFromPriv(scanPriv), SpendKey: pubFromPriv(13), Network: BitcoinMainnet}
+	outs := []TxOutput{{Address: sp.String(), ValueSats: 60_000}, {Address: sp.String(), ValueSats: 70_000}}
+	if _, err := s.Spend(outs); err == nil || !strings.Contains(err.Error(), "SetSilentPaymentSigner") {
+		t.Fatalf("expected a missing signer error, got %v", err)
+	}
+
+	s.SetSilentPaymentSigner(fakeSPSigner{big.NewInt(priv)})
+	plan, err := s.Spend(outs)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 2 {
+		t.Fatalf("expected both inputs, got %d", len(plan.Inputs))
+	}
+	if vb := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs); vb != 10+2*68+2*43+31 {
+		t.Fatalf("estimated %d vB, want %d", vb, 10+2*68+2*43+31)
+	}
+
+	// Receiver side: S = input_hash·b_scan·A with A the sum of input keys
+	var smallest []byte
+	A := (*ecPoint)(nil)
+	for _, in := range plan.Inputs {
+		op, _ := NewOutPointFromStr(in.TxID, in.Vout)
+		ser := binary.LittleEndian.AppendUint32(append([]byte{}, op.Hash[:]...), op.Index)
+		if smallest == nil || bytes.Compare(ser, smallest) < 0 {
+			smallest = ser
+		}
+		pt, _ := decompressPubKey(pub)
+		A = ecAdd(A, pt)
+	}
+	ih := taggedHash("BIP0352/Inputs", smallest, compressPubKey(A))
+	k := new(big.Int).Mul(new(big.Int).SetBytes(ih[:]), big.NewInt(scanPriv))
+	shared := compressPubKey(ecMul(A, k.Mod(k, secpN)))
+	spend, _ := decompressPubKey(sp.SpendKey)
+	for i := 0; i < 2; i++ {
+		th := taggedHash("BIP0352/SharedSecret", shared, binary.BigEndian.AppendUint32(nil, uint32(i)))
+		p := ecAdd(spend, ecMul(&ecPoint{secpGx, secpGy}, new(big.Int).SetBytes(th[:])))
+		want := BuildP2TRScript(p.x.FillBytes(make([]byte, 32)))
+		if !bytes.Equal(plan.RawTx.TxOut[i].PkScript, want) {
+			t.Fatalf("output %d script %x, want %x", i, plan.RawTx.TxOut[i].PkScript, want)
+		}
+	}
+
+	// A P2WPKH input with an unknown key would be counted by the receiver but
+	// not by us
+	s.SetPubKeyCheck(false)
+	foreign, _ := CreateP2WPKH(Hash160(pubFromPriv(17)), BitcoinMainnet)
+	if err := s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 100_000, Address: foreign, Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	op, _ := NewOutPointFromStr(stringsRepeat("c", 64), 0)
+	if _, err := s.SpendFrom([]OutPoint{op}, outs[:1]); err == nil || !strings.Contains(err.Error(), "public key of input") {
+		t.Fatalf("expected an input with an unknown key to be refused, got %v", err)
+	}
+
+	tsp := &SilentPaymentAddress{ScanKey: sp.ScanKey, SpendKey: sp.SpendKey, Network: BitcoinTestnet}
+	if _, err := s.Spend([]TxOutput{{Address: tsp.String(), ValueSats: 60_000}}); err == nil {
+		t.Fatalf("expected a network mismatch error")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIndexSnapshots(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 1, ValueSats: 80_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.SnapshotIndex("drill-2026q3"); err != nil {
+		t.Fatalf("SnapshotIndex: %v", err)
+	}
+	if _, err := s.SnapshotIndex("drill-2026q3"); err == nil {
+		t.Fatalf("expected an existing snapshot to be immutable")
+	}
+
+	// Production moves on; the drill restores the frozen state
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 5_000_000, Address: testAddr("in"), Confirmed: true})
+	drill := newTestSweeper(t, WithKV(kv))
+	if err := drill.RestoreIndexSnapshot("drill-2026q3"); err != nil {
+		t.Fatalf("RestoreIndexSnapshot: %v", err)
+	}
+	if len(drill.indexedUTXOs) != 2 || drill.indexedUTXOs[1].Vout != 1 {
+		t.Fatalf("restored %+v", drill.indexedUTXOs)
+	}
+	plan, err := drill.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}})
+	if err != nil || len(plan.Inputs) != 2 {
+		t.Fatalf("drill plan: %+v, %v", plan, err)
+	}
+	if got := s.IndexSnapshots(); len(got) != 1 || got[0] != "drill-2026q3" {
+		t.Fatalf("IndexSnapshots = %v", got)
+	}
+
+	// A snapshot edited in storage is refused
+	b, _ := kv.Get([]byte("snapshot:drill-2026q3"))
+	_ = kv.Put([]byte("snapshot:drill-2026q3"), bytes.Replace(b, []byte("80000"), []byte("90000"), 1))
+	if err := drill.RestoreIndexSnapshot("drill-2026q3"); err == nil {
+		t.Fatalf("expected a tampered snapshot to be refused")
+	}
+	if _, err := s.SnapshotIndex("bad:name"); err == nil {
+		t.Fatalf("expected a name with a colon to be refused")
+	}
+	if err := s.RestoreIndexSnapshot("missing"); err == nil {
+		t.Fatalf("expected an unknown snapshot to be refused")
+	}
+}
@@ -0,0 +1,350 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains per-call spend options that override Sweeper defaults.
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// SelectionStrategy controls the order in which candidate UTXOs are picked.
+type SelectionStrategy string
+
+const (
+	SelectSmallestFirst SelectionStrategy = "smallest-first" // Default: spend small coins first
+	SelectLargestFirst  SelectionStrategy = "largest-first"  // Fewest inputs
+	SelectOldestFirst   SelectionStrategy = "oldest-first"   // Lowest block height (else most confirmations) first
+	// Search for an input set that needs no change, else smallest-first
+	SelectBranchAndBound SelectionStrategy = "branch-and-bound"
+	// Candidates in random order, drawn until the outputs and fee are covered
+	SelectSingleRandomDraw SelectionStrategy = "single-random-draw"
+	// Inputs from one address cluster when possible, crossing as few as needed
+	SelectPrivacy SelectionStrategy = "privacy"
+)
+
+// TieBreak orders UTXOs the selection strategy considers equal, e.g. many
+// deposits of the same fixed amount, so selection is reproducible.
+type TieBreak string
+
+const (
+	TieBreakFIFO   TieBreak = "fifo"         // Default: the order UTXOs were indexed
+	TieBreakOldest TieBreak = "oldest-first" // Oldest coins first (see SelectOldestFirst), then FIFO
+	TieBreakRandom TieBreak = "random"       // Shuffled with a seed; same seed and index give the same order
+)
+
+// ChangePolicy controls how change is laid out.
+type ChangePolicy string
+
+const (
+	ChangeDefault ChangePolicy = ""       // Use the Sweeper's split/allocation settings
+	ChangeSingle  ChangePolicy = "single" // One change output to the change address
+)
+
+// SpendOptions overrides Sweeper defaults for a single call. Zero values keep
+// the Sweeper's setting. When several are passed, later non-zero fields win.
+type SpendOptions struct {
+	FeeRate          int64             // Fee rate in whole sat/vB
+	FeeRateKVB       FeeRate           // Fee rate in sat/kvB, e.g. 1500 for 1.5 sat/vB; wins over FeeRate
+	DustSats         int64             // Dust threshold in satoshis, overriding the dust policy
+	RBF              bool              // Signal BIP-125 replaceability on every input
+	Selection        SelectionStrategy // Coin selection order
+	MinConfirmations int               // Only spend UTXOs with at least this many confirmations
+	Change           ChangePolicy      // Change output layout
+	TieBreak         TieBreak          // Order among equally ranked UTXOs
+	TieBreakSeed     int64             // Seed for TieBreakRandom
+	LockTime         uint32            // nLockTime: block height, or unix time if >= 500,000,000
+	// Exceed SetMaxDestinationExposure for this plan; the override is logged
+	OverrideDestLimit bool
+	// Order confirmed candidates before unconfirmed ones, whatever the strategy
+	ConfirmedFirst bool
+	// Fee caps for this plan, in sats and sat/kvB; they only tighten the
+	// Sweeper's (SetFeeLimits, SetMaxFeeRate), never lift them
+	MaxFeeSats int64
+	MaxFeeRate FeeRate
+	// Off-chain metadata attached before the plan.created event is sent
+	Annotation *PlanAnnotation
+}
+
+// spendParams are the effective settings for one planning call.
+type spendParams struct {
+	feeRate      FeeRate
+	dustOverride int64 // 0 = use the Sweeper's dust policy
+	rbf          bool
+	selection    SelectionStrategy
+	minConf      int
+	change       ChangePolicy
+	tieBreak     TieBreak
+	tieSeed      int64
+	exclude      map[string]bool // Outpoints never to select (see ResumePlan)
+	inputs       []UTXO          // Spend exactly these instead of selecting (see SpendFrom)
+	lockTime     uint32
+	// Exceed the per-destination limit (SpendOptions.OverrideDestLimit)
+	overrideDestLimit bool
+	confirmedFirst    bool            // Confirmed candidates before unconfirmed ones
+	maxFeeSats        int64           // Fee cap (0 = unlimited)
+	maxFeeRate        FeeRate         // Fee rate cap (0 = unlimited)
+	dustChange        int64           // Sub-dust change buildTransaction gave to the fee
+	changeDust        int64           // Dust threshold change was settled against (0 = policy)
+	annotation        *PlanAnnotation // Attached to the plan (SpendOptions.Annotation)
+	pool              []UTXO          // UTXOs buildTransaction selected from
+	replacement       bool            // Rebuilds a plan whose inputs already count toward chain depth (BumpFee)
+}
+
+// Sweeper defaults as spend parameters
+func (s *Sweeper) defaultSpendParams() spendParams {
+	sel := s.selection
+	if sel == "" {
+		sel = SelectSmallestFirst
+	}
+	return spendParams{feeRate: s.feeRate, selection: sel, tieBreak: s.tieBreak, tieSeed: s.tieSeed, confirmedFirst: s.confirmedFirst,
+		maxFeeSats: s.maxFeeSats, maxFeeRate: s.maxFeeRate}
+}
+
+// Merge per-call options over the Sweeper defaults and validate the result;
+// planning is refused while the UTXO locks cannot be read
+func (s *Sweeper) resolveSpendOptions(opts []SpendOptions) (spendParams, error) {
+	if _, err := s.reloadUTXOLocks(); err != nil {
+		return spendParams{}, err
+	}
+	explicitRate := false
+	for _, o := range opts {
+		explicitRate = explicitRate || o.FeeRate > 0 || o.FeeRateKVB > 0
+	}
+	if !explicitRate {
+		s.refreshFeeRate()
+	}
+	s.refreshDustPrice(time.Now())
+	p := s.defaultSpendParams()
+	for _, o := range opts {
+		if o.FeeRate < 0 || o.FeeRateKVB < 0 || o.DustSats < 0 || o.MinConfirmations < 0 || o.MaxFeeSats < 0 || o.MaxFeeRate < 0 {
+			return p, fmt.Errorf("spend options must be non-negative (fee rate %d sat/vB, %d sat/kvB, dust %d, min confirmations %d, max fee %d sats, %d sat/kvB)", o.FeeRate, o.FeeRateKVB, o.DustSats, o.MinConfirmations, o.MaxFeeSats, o.MaxFeeRate)
+		}
+		p.maxFeeSats = lowerCap(p.maxFeeSats, o.MaxFeeSats)
+		p.maxFeeRate = FeeRate(lowerCap(int64(p.maxFeeRate), int64(o.MaxFeeRate)))
+		if o.FeeRateKVB > 0 {
+			p.feeRate = o.FeeRateKVB
+		} else if o.FeeRate > 0 {
+			p.feeRate = SatPerVByte(o.FeeRate)
+		}
+		if o.DustSats > 0 {
+			p.dustOverride = o.DustSats
+		}
+		if o.RBF {
+			p.rbf = true
+		}
+		if o.Selection != "" {
+			p.selection = o.Selection
+		}
+		if o.MinConfirmations > 0 {
+			p.minConf = o.MinConfirmations
+		}
+		if o.Change != ChangeDefault {
+			p.change = o.Change
+		}
+		if o.TieBreak != "" {
+			p.tieBreak = o.TieBreak
+		}
+		if o.TieBreakSeed != 0 {
+			p.tieSeed = o.TieBreakSeed
+		}
+		if o.LockTime != 0 {
+			p.lockTime = o.LockTime
+		}
+		if o.OverrideDestLimit {
+			p.overrideDestLimit = true
+		}
+		if o.ConfirmedFirst {
+			p.confirmedFirst = true
+		}
+		if o.Annotation != nil {
+			p.annotation = o.Annotation
+		}
+	}
+	if p.annotation != nil {
+		if err := s.checkAnnotation(p.annotation); err != nil {
+			return p, fmt.Errorf("invalid annotation: %w", err)
+		}
+	}
+	if err := p.selection.validate(); err != nil {
+		return p, err
+	}
+	if err := p.tieBreak.validate(); err != nil {
+		return p, err
+	}
+	switch p.change {
+	case ChangeDefault, ChangeSingle:
+	default:
+		return p, fmt.Errorf("unknown change policy '%s' - must be '' or 'single'", p.change)
+	}
+	return p, nil
+}
+
+func (st SelectionStrategy) validate() error {
+	switch st {
+	case SelectSmallestFirst, SelectLargestFirst, SelectOldestFirst, SelectBranchAndBound, SelectSingleRandomDraw, SelectPrivacy:
+		return nil
+	default:
+		return fmt.Errorf("unknown selection strategy '%s' - must be smallest-first, largest-first, oldest-first, branch-and-bound, single-random-draw or privacy", st)
+	}
+}
+
+func (tb TieBreak) validate() error {
+	switch tb {
+	case "", TieBreakFIFO, TieBreakOldest, TieBreakRandom:
+		return nil
+	default:
+		return fmt.Errorf("unknown tie-break '%s' - must be fifo, oldest-first or random", tb)
+	}
+}
+
+// SetSelectionStrategy sets the default coin selection order for plans that
+// do not pass SpendOptions.Selection, e.g. SelectLargestFirst to spend the
+// fewest inputs (and pay the least fee now) in a wallet of many small coins.
+func (s *Sweeper) SetSelectionStrategy(st SelectionStrategy) error {
+	if err := st.validate(); err != nil {
+		return err
+	}
+	s.selection = st
+	return nil
+}
+
+// SetConfirmedFirst makes plans that do not pass SpendOptions.ConfirmedFirst
+// order confirmed candidates before unconfirmed ones, applying the selection
+// strategy within each group, so unconfirmed coins are only spent when the
+// confirmed ones do not cover the outputs.
+func (s *Sweeper) SetConfirmedFirst(on bool) {
+	s.confirmedFirst = on
+}
+
+// SetSelectionRand sets the source SelectSingleRandomDraw shuffles candidates
+// with, e.g. a fixed seed for reproducible tests (nil restores the default,
+// seeded from crypto/rand). Deterministic value orders let chain observers
+// infer which coins a wallet holds; a random draw does not.
+func (s *Sweeper) SetSelectionRand(src rand.Source) {
+	if src == nil {
+		s.selectionRand = nil
+		return
+	}
+	s.selectionRand = rand.New(src)
+}
+
+// Random source for SelectSingleRandomDraw, seeding one on first use
+func (s *Sweeper) drawRand() *rand.Rand {
+	if s.selectionRand == nil {
+		var seed [8]byte
+		_, _ = crand.Read(seed[:]) // On failure the zero seed still yields a valid order
+		s.selectionRand = rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+	}
+	return s.selectionRand
+}
+
+// SetTieBreak sets how equally ranked UTXOs are ordered; seed is used by TieBreakRandom.
+func (s *Sweeper) SetTieBreak(tb TieBreak, seed int64) error {
+	if err := tb.validate(); err != nil {
+		return err
+	}
+	s.tieBreak, s.tieSeed = tb, seed
+	return nil
+}
+
+// Rank each UTXO (by outpoint) for tie-breaking, from the index order of utxos
+func tieRanks(utxos []UTXO, p spendParams) map[string]int {
+	order := make([]int, len(utxos))
+	for i := range order {
+		order[i] = i
+	}
+	switch p.tieBreak {
+	case TieBreakOldest:
+		sort.SliceStable(order, func(i, j int) bool {
+			older, differ := olderCoin(utxos[order[i]], utxos[order[j]])
+			return differ && older
+		})
+	case TieBreakRandom:
+		order = rand.New(rand.NewSource(p.tieSeed)).Perm(len(utxos))
+	}
+	rank := make(map[string]int, len(utxos))
+	for r, i := range order {
+		rank[outpointKey(utxos[i])] = r
+	}
+	return rank
+}
+
+// Input sequence for the plan's RBF setting
+func (p spendParams) sequence() uint32 {
+	if p.rbf {
+		return 0xfffffffd
+	}
+	if p.lockTime > 0 {
+		return 0xfffffffe // Non-final, so the locktime is enforced
+	}
+	return 0xffffffff
+}
+
+// Order UTXOs for selection: by the strategy, then by tie-break rank
+func orderUTXOs(utxos []UTXO, p spendParams) []UTXO {
+	out := append([]UTXO(nil), utxos...)
+	rank := tieRanks(utxos, p)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if p.confirmedFirst && a.Confirmed != b.Confirmed {
+			return a.Confirmed
+		}
+		switch p.selection {
+		case SelectLargestFirst:
+			if a.ValueSats != b.ValueSats {
+				return a.ValueSats > b.ValueSats
+			}
+		case SelectOldestFirst:
+			if older, differ := olderCoin(a, b); differ {
+				return older
+			}
+		default:
+			if a.ValueSats != b.ValueSats {
+				return a.ValueSats < b.ValueSats
+			}
+		}
+		return rank[outpointKey(a)] < rank[outpointKey(b)]
+	})
+	return out
+}
+
+// Order UTXOs for selection, then filter them by policy and confirmations;
+// filtering in selection order makes the unconfirmed input cap keep the
+// coins selection reaches first
+func (s *Sweeper) candidates(utxos []UTXO, p spendParams) []UTXO {
+	ordered := orderUTXOs(utxos, p)
+	if p.selection == SelectSingleRandomDraw {
+		r := s.drawRand()
+		r.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+		if p.confirmedFirst {
+			sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Confirmed && !ordered[j].Confirmed })
+		}
+	}
+	cands, _ := s.screenOrdered(ordered, p)
+	return cands
+}
+
+// Whether a was received before b, and whether their ages differ at all:
+// block heights when both are known, else confirmation counts
+func olderCoin(a, b UTXO) (older, differ bool) {
+	if a.Confirmed && b.Confirmed && a.BlockHeight > 0 && b.BlockHeight > 0 {
+		return a.BlockHeight < b.BlockHeight, a.BlockHeight != b.BlockHeight
+	}
+	ca, cb := confirmations(a), confirmations(b)
+	return ca > cb, ca != cb
+}
+
+// Confirmation count of a UTXO; confirmed UTXOs without a count have at least one
+func confirmations(u UTXO) int {
+	if !u.Confirmed {
+		return 0
+	}
+	if u.Confirmations < 1 {
+		return 1
+	}
+	return u.Confirmations
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSpendOptionsOverrideForOneCall(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetChangeSplit(3, 60_000, 20_000)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in"), Confirmed: true, Confirmations: 1})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 90_000, Address: testAddr("in"), Confirmed: true, Confirmations: 12})
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 400_000, Address: testAddr("in"), Confirmed: true, Confirmations: 3})
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}
+
+	plan, err := s.Spend(out, SpendOptions{FeeRate: 20, RBF: true, Selection: SelectLargestFirst, Change: ChangeSingle})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 1 || plan.Inputs[0].ValueSats != 400_000 {
+		t.Fatalf("largest-first should pick the 400k coin, got %+v", plan.Inputs)
+	}
+	if vb := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs); plan.FeeSats != vb*20 {
+		t.Fatalf("fee %d not at overridden rate (vb %d)", plan.FeeSats, vb)
+	}
+	if len(plan.ChangeIdxs) != 1 {
+		t.Fatalf("single change policy ignored: %d change outputs", len(plan.ChangeIdxs))
+	}
+	if plan.RawTx.TxIn[0].Sequence != 0xfffffffd {
+		t.Fatalf("RBF not signaled")
+	}
+	if s.feeRate != SatPerVByte(5) {
+		t.Fatalf("override leaked into sweeper defaults")
+	}
+	want := PlanSettings{FeeRate: 20, RBF: true, Selection: SelectLargestFirst, ChangePolicy: ChangeSingle, ChangeSplitParts: 3}
+	got := plan.Settings
+	if got.FeeRate != want.FeeRate || got.RBF != want.RBF || got.Selection != want.Selection || got.ChangePolicy != want.ChangePolicy || got.ChangeSplitParts != want.ChangeSplitParts {
+		t.Fatalf("settings snapshot %+v does not reflect the call", got)
+	}
+	_ = s.SetFeeRate(40)
+	if plan.Settings.FeeRate != 20 {
+		t.Fatalf("snapshot must not follow later sweeper changes")
+	}
+	_ = s.SetFeeRate(5)
+
+	plan, err = s.Spend(out, SpendOptions{MinConfirmations: 6})
+	if err != nil {
+		t.Fatalf("Spend with min confirmations: %v", err)
+	}
+	if len(plan.Inputs) != 1 || plan.Inputs[0].Confirmations != 12 {
+		t.Fatalf("expected only the 12-conf coin, got %+v", plan.Inputs)
+	}
+	if plan.RawTx.TxIn[0].Sequence != 0xffffffff {
+		t.Fatalf("RBF must stay off by default")
+	}
+
+	if _, err := s.Spend(out, SpendOptions{Selection: "random"}); err == nil {
+		t.Fatalf("expected unknown selection strategy to be rejected")
+	}
+	if _, err := s.ConsolidateAll(testAddr("cold"), SpendOptions{MinConfirmations: 100}); err == nil {
+		t.Fatalf("expected no candidates with 100 confirmations")
+	}
+}
+
+func TestTieBreakOrdersEqualValueUTXOs(t *testing.T) {
+	s := newTestSweeper(t)
+	ids := []string{"c", "a", "d", "b"}
+	for i, c := range ids {
+		_ = s.Index(UTXO{TxID: stringsRepeat(c, 64), Vout: 0, ValueSats: 50_000, Address: testAddr("in"), Confirmed: true, Confirmations: i + 1})
+	}
+	order := func(opts SpendOptions) string {
+		p, err := s.resolveSpendOptions([]SpendOptions{opts})
+		if err != nil {
+			t.Fatalf("resolveSpendOptions: %v", err)
+		}
+		var out string
+		for _, u := range s.candidates(s.indexedUTXOs, p) {
+			out += u.TxID[:1]
+		}
+		return out
+	}
+	if got := order(SpendOptions{}); got != "cadb" {
+		t.Fatalf("fifo order = %s, want cadb", got)
+	}
+	if got := order(SpendOptions{TieBreak: TieBreakOldest}); got != "bdac" {
+		t.Fatalf("oldest-first order = %s, want bdac", got)
+	}
+	r1, r2 := order(SpendOptions{TieBreak: TieBreakRandom, TieBreakSeed: 7}), order(SpendOptions{TieBreak: TieBreakRandom, TieBreakSeed: 7})
+	if r1 != r2 || len(r1) != 4 {
+		t.Fatalf("seeded random order not reproducible: %s vs %s", r1, r2)
+	}
+	if _, err := s.resolveSpendOptions([]SpendOptions{{TieBreak: "coin-flip"}}); err == nil {
+		t.Fatalf("expected unknown tie-break to be rejected")
+	}
+}
+
+func TestDefaultSelectionStrategy(t *testing.T) {
+	s := newTestSweeper(t, WithSelection(SelectLargestFirst))
+	for i, v := range []int64{20_000, 30_000, 40_000, 300_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), Vout: 0, ValueSats: v, Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 60_000}}
+	plan, err := s.Spend(out)
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 1 || plan.Inputs[0].ValueSats != 300_000 || plan.Settings.Selection != SelectLargestFirst {
+		t.Fatalf("largest-first default not applied: %+v", plan.Inputs)
+	}
+	_ = s.DiscardPlan(plan.ID)
+
+	// A per-call strategy still wins
+	plan, err = s.Spend(out, SpendOptions{Selection: SelectSmallestFirst})
+	if err != nil || len(plan.Inputs) != 3 {
+		t.Fatalf("per-call smallest-first ignored: %+v, %v", plan.Inputs, err)
+	}
+	if err := s.SetSelectionStrategy("biggest"); err == nil {
+		t.Fatalf("expected an unknown strategy to be refused")
+	}
+	if _, err := NewSweeper([]byte("test_pubkey__________33bytes________")[:33], BitcoinTestnet, WithSelection("biggest")); err == nil {
+		t.Fatalf("expected NewSweeper to reject an unknown strategy")
+	}
+}
+
+func TestSingleRandomDraw(t *testing.T) {
+	s := newTestSweeper(t)
+	for i := 0; i < 12; i++ {
+		_ = s.Index(UTXO{TxID: stringsRepeat("ab", 32), Vout: uint32(i), ValueSats: int64(20_000 + i*10_000), Address: testAddr("in"), Confirmed: true})
+	}
+	out := []TxOutput{{Address: testAddr("dest"), ValueSats: 60_000}}
+	draw := func(seed int64) []UTXO {
+		s.SetSelectionRand(rand.NewSource(seed))
+		plan, err := s.Spend(out, SpendOptions{Selection: SelectSingleRandomDraw})
+		if err != nil {
+			t.Fatalf("Spend: %v", err)
+		}
+		_ = s.DiscardPlan(plan.ID)
+		return plan.Inputs
+	}
+
+	first := draw(7)
+	if again := draw(7); len(again) != len(first) || again[0] != first[0] {
+		t.Fatalf("same seed drew %v then %v", first, again)
+	}
+	// Over several seeds the draw must not collapse to the smallest-first pick
+	smallest := map[string]bool{}
+	for _, u := range s.candidates(s.indexedUTXOs, spendParams{selection: SelectSmallestFirst})[:3] {
+		smallest[outpointKey(u)] = true
+	}
+	varied := false
+	for seed := int64(1); seed <= 10 && !varied; seed++ {
+		for _, u := range draw(seed) {
+			varied = varied || !smallest[outpointKey(u)]
+		}
+	}
+	if !varied {
+		t.Fatalf("random draw always picked the smallest coins")
+	}
+	var covered int64
+	for _, u := range first {
+		covered += u.ValueSats
+	}
+	if covered < 60_000 {
+		t.Fatalf("draw covers %d of 60000", covered)
+	}
+}
+
+func TestConfirmedFirstAndBlockHeightAge(t *testing.T) {
+	s := newTestSweeper(t, WithUnconfirmedPolicy(true, 5, 5))
+	coins := []UTXO{
+		{TxID: stringsRepeat("a", 64), ValueSats: 10_000, Address: testAddr("in")},
+		{TxID: stringsRepeat("b", 64), ValueSats: 50_000, Address: testAddr("in"), Confirmed: true, BlockHeight: 800_000},
+		{TxID: stringsRepeat("c", 64), ValueSats: 60_000, Address: testAddr("in"), Confirmed: true, BlockHeight: 700_000},
+	}
+	for _, u := range coins {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	values := func(opts ...SpendOptions) []int64 {
+		p, err := s.resolveSpendOptions(opts)
+		if err != nil {
+			t.Fatalf("resolveSpendOptions: %v", err)
+		}
+		var out []int64
+		for _, u := range s.candidates(s.indexedUTXOs, p) {
+			out = append(out, u.ValueSats)
+		}
+		return out
+	}
+
+	// Equal confirmation counts: the block height decides which is older
+	if got := values(SpendOptions{Selection: SelectOldestFirst}); got[0] != 60_000 || got[1] != 50_000 {
+		t.Fatalf("oldest-first order %v", got)
+	}
+	if got := values(); got[0] != 10_000 {
+		t.Fatalf("smallest-first order %v", got)
+	}
+	s.SetConfirmedFirst(true)
+	if got := values(); got[0] != 50_000 || got[1] != 60_000 || got[2] != 10_000 {
+		t.Fatalf("confirmed-first order %v", got)
+	}
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 20_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if !plan.Settings.ConfirmedFirst || plan.Inputs[0].ValueSats != 50_000 {
+		t.Fatalf("confirmed-first not applied or recorded: %+v", plan.Settings)
+	}
+}
+
+func TestUnconfirmedCapFollowsSelectionOrder(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(true, 2, 5)
+	for i, v := range []int64{10_000, 20_000, 30_000, 40_000} {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(rune('a'+i)), 64), ValueSats: v, Address: testAddr("in")})
+	}
+	p, err := s.resolveSpendOptions([]SpendOptions{{Selection: SelectLargestFirst}})
+	if err != nil {
+		t.Fatalf("resolveSpendOptions: %v", err)
+	}
+	// The cap keeps the two coins largest-first reaches, not the two smallest
+	cands := s.candidates(s.indexedUTXOs, p)
+	if len(cands) != 2 || cands[0].ValueSats != 40_000 || cands[1].ValueSats != 30_000 {
+		t.Fatalf("candidates %+v", cands)
+	}
+	_, rejected := s.screenUTXOs(s.indexedUTXOs, p)
+	if len(rejected) != 2 || rejected[0].UTXO.ValueSats != 20_000 || rejected[0].Kind != RejectUnconfirmed {
+		t.Fatalf("rejected %+v", rejected)
+	}
+}
@@ -0,0 +1,61 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains plan summaries with fiat valuations.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// PlanSummary totals a plan in satoshis and in the sweeper's fiat currency so
+// operators can sanity-check a sweep before signing it.
+type PlanSummary struct {
+	Currency      string  `json:"currency"`      // ISO 4217 code of the fiat fields
+	PricePerBTC   float64 `json:"price_per_btc"` // BTC price the fiat fields use
+	TotalInSats   int64   `json:"total_in_sats"`
+	TotalOutSats  int64   `json:"total_out_sats"` // Every output, change included
+	SentSats      int64   `json:"sent_sats"`      // Non-change outputs
+	FeeSats       int64   `json:"fee_sats"`
+	VBytes        int64   `json:"vbytes"`
+	FeeRateSatsVB float64 `json:"fee_rate_sats_vb"` // Effective rate of this transaction alone
+	FeePercent    float64 `json:"fee_percent"`      // Fee as a share of the amount sent
+	TotalInFiat   float64 `json:"total_in_fiat"`
+	TotalOutFiat  float64 `json:"total_out_fiat"`
+	SentFiat      float64 `json:"sent_fiat"`
+	FeeFiat       float64 `json:"fee_fiat"` // What this transaction costs in fiat
+}
+
+// SummarizePlan values plan at the BTC price prices quotes at time at, in
+// the currency set with SetFiatCurrency.
+func (s *Sweeper) SummarizePlan(plan *TransactionPlan, prices PriceProvider, at time.Time) (PlanSummary, error) {
+	sum := PlanSummary{Currency: s.FiatCurrency(), FeeSats: plan.FeeSats}
+	if prices == nil {
+		return sum, fmt.Errorf("no price provider given - pass StaticPrices{%q: price} or a live source", sum.Currency)
+	}
+	price, err := priceIn(prices, sum.Currency, at)
+	if err != nil {
+		return sum, err
+	}
+	sum.PricePerBTC = price
+	for _, in := range plan.Inputs {
+		sum.TotalInSats += in.ValueSats
+	}
+	for i, o := range plan.Outputs {
+		sum.TotalOutSats += o.ValueSats
+		if !plan.IsChange(i) {
+			sum.SentSats += o.ValueSats
+		}
+	}
+	sum.VBytes = estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	if sum.VBytes > 0 {
+		sum.FeeRateSatsVB = float64(plan.FeeSats) / float64(sum.VBytes)
+	}
+	if sum.SentSats > 0 {
+		sum.FeePercent = float64(plan.FeeSats) * 100 / float64(sum.SentSats)
+	}
+	sum.TotalInFiat = satsToFiat(sum.TotalInSats, price)
+	sum.TotalOutFiat = satsToFiat(sum.TotalOutSats, price)
+	sum.SentFiat = satsToFiat(sum.SentSats, price)
+	sum.FeeFiat = satsToFiat(sum.FeeSats, price)
+	return sum, nil
+}
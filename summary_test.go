@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummarizePlanInFiat(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 300_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	_ = s.SetFiatCurrency("EUR")
+	sum, err := s.SummarizePlan(plan, StaticPrices{"EUR": 50_000}, time.Now())
+	if err != nil {
+		t.Fatalf("SummarizePlan: %v", err)
+	}
+	if sum.Currency != "EUR" || sum.TotalInSats != 300_000 || sum.SentSats != 100_000 || sum.TotalOutSats != 300_000-plan.FeeSats {
+		t.Fatalf("summary %+v", sum)
+	}
+	if sum.TotalInFiat != 150 || math.Abs(sum.FeeFiat-float64(plan.FeeSats)/2000) > 1e-9 {
+		t.Fatalf("fiat values %+v", sum)
+	}
+	if sum.FeeRateSatsVB != 5 || math.Abs(sum.FeePercent-float64(plan.FeeSats)/1000) > 1e-9 {
+		t.Fatalf("rate %.2f, percent %.4f", sum.FeeRateSatsVB, sum.FeePercent)
+	}
+	if _, err := s.SummarizePlan(plan, StaticPrice(60_000), time.Now()); err == nil {
+		t.Fatalf("expected a USD-only provider to be refused for EUR")
+	}
+}
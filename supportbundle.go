@@ -0,0 +1,434 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains support bundles: redacted diagnostics for bug reports.
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces secrets and key material in support bundles.
+const redacted = "[redacted]"
+
+// SweeperStats summarizes the index and tracked plans.
+type SweeperStats struct {
+	UTXOs               int     `json:"utxos"`
+	UTXOSats            int64   `json:"utxo_sats"`
+	UnconfirmedUTXOs    int     `json:"unconfirmed_utxos"`
+	UnconfirmedSats     int64   `json:"unconfirmed_sats"`
+	Addresses           int     `json:"addresses"`
+	ReusedAddresses     int     `json:"reused_addresses"`
+	Plans               int     `json:"plans"`
+	UnconfirmedPlans    int     `json:"unconfirmed_plans"`
+	UnconfirmedExposure int64   `json:"unconfirmed_exposure_sats"`
+	FeeRate             float64 `json:"fee_rate"`         // sat/vB
+	FeesPaidSats        int64   `json:"fees_paid_sats"`   // Cumulative, see FeeMetrics
+	FeeSavingsSats      int64   `json:"fee_savings_sats"` // Estimated savings from batching
+}
+
+// Stats returns counts and totals for the index and tracked plans.
+func (s *Sweeper) Stats() SweeperStats {
+	st := SweeperStats{FeeRate: s.feeRate.SatPerVB(), Plans: len(s.plans), UnconfirmedExposure: s.UnconfirmedExposure()}
+	if fm, err := s.FeeMetrics(); err == nil {
+		st.FeesPaidSats, st.FeeSavingsSats = fm.FeesPaidSats, fm.SavedSats()
+	}
+	for _, u := range s.indexedUTXOs {
+		st.UTXOs++
+		st.UTXOSats += u.ValueSats
+		if !u.Confirmed {
+			st.UnconfirmedUTXOs++
+			st.UnconfirmedSats += u.ValueSats
+		}
+	}
+	for _, a := range s.AddressStats() {
+		st.Addresses++
+		if a.Reused(s.reuseThreshold) {
+			st.ReusedAddresses++
+		}
+	}
+	for _, p := range s.plans {
+		if p.inFlight() {
+			st.UnconfirmedPlans++
+		}
+	}
+	return st
+}
+
+// LogBuffer is a Logger that keeps the most recent lines in memory, and
+// forwards them to Next if set, so a support bundle can include them.
+type LogBuffer struct {
+	Next  Logger
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+// NewLogBuffer keeps the last max lines (0 = 1000).
+func NewLogBuffer(max int, next Logger) *LogBuffer {
+	if max <= 0 {
+		max = 1000
+	}
+	return &LogBuffer{Next: next, max: max}
+}
+
+// Printf records one line.
+func (b *LogBuffer) Printf(format string, v ...any) {
+	line := time.Now().UTC().Format(time.RFC3339) + " " + fmt.Sprintf(format, v...)
+	b.mu.Lock()
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.max {
+		b.lines = b.lines[len(b.lines)-b.max:]
+	}
+	b.mu.Unlock()
+	if b.Next != nil {
+		b.Next.Printf(format, v...)
+	}
+}
+
+// Lines returns the buffered lines, oldest first.
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.lines...)
+}
+
+// SupportBundleOptions selects what goes into a support bundle.
+type SupportBundleOptions struct {
+	Config        *Config  // Included with secrets and key material redacted (nil = omitted)
+	Logs          []string // Recent log lines, e.g. LogBuffer.Lines or a log file tail
+	HashAddresses bool     // Replace addresses with salted hashes, consistent within the bundle
+	Now           time.Time
+}
+
+// BundlePlan is a plan summary in a support bundle: enough to reproduce a
+// planner decision without keys, PSBTs or signatures.
+type BundlePlan struct {
+	ID          string        `json:"id"`
+	State       PlanState     `json:"state"`
+	Inputs      []BundleCoin  `json:"inputs"`
+	Outputs     []BundleCoin  `json:"outputs"`
+	FeeSats     int64         `json:"fee_sats"`
+	FeeRate     float64       `json:"fee_rate"`
+	Settings    PlanSettings  `json:"settings"`
+	Warnings    []PlanWarning `json:"warnings,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	BroadcastAt *time.Time    `json:"broadcast_at,omitempty"`
+	ConfirmedAt *time.Time    `json:"confirmed_at,omitempty"`
+}
+
+// BundleCoin is an input or output of a BundlePlan.
+type BundleCoin struct {
+	Address       string `json:"address"`
+	ValueSats     int64  `json:"value_sats"`
+	Confirmed     bool   `json:"confirmed,omitempty"`
+	Confirmations int    `json:"confirmations,omitempty"`
+	Change        bool   `json:"change,omitempty"`
+}
+
+// WriteSupportBundle writes a gzipped tar archive with version info, the
+// redacted config, Stats, plan summaries and logs. Only operational config
+// settings are copied; API URLs keep their host, and keys, descriptors and
+// paths are redacted. Transaction IDs are replaced with salted hashes,
+// consistent within the bundle, in the plans and logs; with HashAddresses
+// every known address is replaced too.
+func (s *Sweeper) WriteSupportBundle(w io.Writer, opts SupportBundleOptions) error {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hash := func(prefix, v string) string {
+		if v == "" {
+			return v
+		}
+		return prefix + hex.EncodeToString(SHA256(append(append([]byte{}, salt...), v...))[:8])
+	}
+	txid := func(id string) string { return hash("tx:", id) }
+	addr := func(a string) string { return a }
+	if opts.HashAddresses {
+		addr = func(a string) string { return hash("addr:", a) }
+	}
+
+	files := []struct {
+		name string
+		doc  any
+	}{
+		{"version.json", map[string]any{
+			"version":    Version,
+			"go":         runtime.Version(),
+			"os":         runtime.GOOS,
+			"arch":       runtime.GOARCH,
+			"network":    s.network,
+			"created_at": opts.Now.UTC(),
+		}},
+		{"stats.json", s.Stats()},
+		{"plans.json", s.bundlePlans(txid, addr)},
+	}
+	if opts.Config != nil {
+		files = append(files, struct {
+			name string
+			doc  any
+		}{"config.json", redactConfig(opts.Config, addr)})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	put := func(name string, b []byte) error {
+		hdr := &tar.Header{Name: "support-bundle/" + name, Mode: 0o600, Size: int64(len(b)), ModTime: opts.Now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	for _, f := range files {
+		b, err := json.MarshalIndent(f.doc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("support bundle %s: %w", f.name, err)
+		}
+		if err := put(f.name, b); err != nil {
+			return err
+		}
+	}
+	if err := put("logs.txt", []byte(s.redactLogs(opts.Logs, opts.HashAddresses, txid, addr))); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Summaries of tracked plans in creation order, with hashed IDs
+func (s *Sweeper) bundlePlans(txid, addr func(string) string) []BundlePlan {
+	out := []BundlePlan{}
+	for _, p := range s.PendingPlans() {
+		bp := BundlePlan{
+			ID:          txid(p.ID),
+			State:       PlanUnsigned,
+			FeeSats:     p.FeeSats,
+			FeeRate:     p.PackageFeeRate,
+			Settings:    p.Settings,
+			Warnings:    p.Warnings,
+			CreatedAt:   p.CreatedAt,
+			BroadcastAt: p.BroadcastAt,
+			ConfirmedAt: p.ConfirmedAt,
+		}
+		switch {
+		case p.ConfirmedAt != nil:
+			bp.State = PlanConfirmed
+		case p.BroadcastAt != nil:
+			bp.State = PlanPending
+		case p.SignedTx != nil:
+			bp.State = PlanSigned
+		}
+		bp.Settings.AllocationWeights = nil
+		for _, w := range p.Settings.AllocationWeights {
+			bp.Settings.AllocationWeights = append(bp.Settings.AllocationWeights, WeightedAddr{Address: addr(w.Address), WeightBP: w.WeightBP})
+		}
+		for _, in := range p.Inputs {
+			bp.Inputs = append(bp.Inputs, BundleCoin{Address: addr(in.Address), ValueSats: in.ValueSats, Confirmed: in.Confirmed, Confirmations: in.Confirmations})
+		}
+		for i, o := range p.Outputs {
+			bp.Outputs = append(bp.Outputs, BundleCoin{Address: addr(o.Address), ValueSats: o.ValueSats, Change: p.IsChange(i)})
+		}
+		out = append(out, bp)
+	}
+	return out
+}
+
+// Copy of the operational settings of the config. Fields are copied from an
+// allowlist, so a new setting stays out of bundles until it is added here;
+// URLs keep their host, addresses go through addr, and key material,
+// descriptors and local paths are only marked as set.
+func redactConfig(c *Config, addr func(string) string) *Config {
+	r := &Config{
+		Network:                    c.Network,
+		FeeRate:                    c.FeeRate,
+		FeeGuardMode:               c.FeeGuardMode,
+		FeeGuardMaxRatio:           c.FeeGuardMaxRatio,
+		FeeGuardWindow:             c.FeeGuardWindow,
+		MinRelayFeeRate:            c.MinRelayFeeRate,
+		MaxFeeSats:                 c.MaxFeeSats,
+		MaxFeePercent:              c.MaxFeePercent,
+		MaxFeeRate:                 c.MaxFeeRate,
+		LongTermFeeRate:            c.LongTermFeeRate,
+		MinPackageFeeRate:          c.MinPackageFeeRate,
+		FeeProviderURL:             redactURL(c.FeeProviderURL),
+		FeeConfTarget:              c.FeeConfTarget,
+		FeePercentile:              c.FeePercentile,
+		FeePercentileFloor:         c.FeePercentileFloor,
+		FeePercentileCeiling:       c.FeePercentileCeiling,
+		DustThresholdUSD:           c.DustThresholdUSD,
+		PriceUSDPerBTC:             c.PriceUSDPerBTC,
+		DustPolicy:                 c.DustPolicy,
+		DustRelayFeeRate:           c.DustRelayFeeRate,
+		FiatCurrency:               c.FiatCurrency,
+		DustThresholdFiat:          c.DustThresholdFiat,
+		PriceFiatPerBTC:            c.PriceFiatPerBTC,
+		PriceProviderURL:           redactURL(c.PriceProviderURL),
+		PriceRefreshInterval:       c.PriceRefreshInterval,
+		DustPriceWindow:            c.DustPriceWindow,
+		AllowUnconfirmed:           c.AllowUnconfirmed,
+		MaxUnconfirmed:             c.MaxUnconfirmed,
+		MaxChainDepth:              c.MaxChainDepth,
+		MaxUnconfirmedExposureSats: c.MaxUnconfirmedExposureSats,
+		MaxDestinationExposureSats: c.MaxDestinationExposureSats,
+		RequireApproval:            c.RequireApproval,
+		AddressReuseThreshold:      c.AddressReuseThreshold,
+		Selection:                  c.Selection,
+		TieBreak:                   c.TieBreak,
+		TieBreakSeed:               c.TieBreakSeed,
+		ConfirmedFirst:             c.ConfirmedFirst,
+		TxVersion:                  c.TxVersion,
+		ChangeSplitParts:           c.ChangeSplitParts,
+		TargetChunkSats:            c.TargetChunkSats,
+		MinChunkSats:               c.MinChunkSats,
+		MaxOutputsPerTx:            c.MaxOutputsPerTx,
+		ChangelessToleranceSats:    c.ChangelessToleranceSats,
+		ConsolidateBelowFeeRate:    c.ConsolidateBelowFeeRate,
+		ConsolidateMaxExtraInputs:  c.ConsolidateMaxExtraInputs,
+		MaturityTiers:              append([]MaturityTierConfig(nil), c.MaturityTiers...),
+		MinInputs:                  c.MinInputs,
+		MaxInputs:                  c.MaxInputs,
+		OutputFormat:               c.OutputFormat,
+		OutputCompat:               c.OutputCompat,
+		WebhookURL:                 redactURL(c.WebhookURL),
+		TestMode:                   c.TestMode,
+		EnforcePubKey:              c.EnforcePubKey,
+		RequireVerifiedChangeKey:   c.RequireVerifiedChangeKey,
+		MultisigLookahead:          c.MultisigLookahead,
+		XPubScriptType:             c.XPubScriptType,
+		XPubLookahead:              c.XPubLookahead,
+		BackendURL:                 redactURL(c.BackendURL),
+		RevalidateInterval:         c.RevalidateInterval,
+		RevalidateBatch:            c.RevalidateBatch,
+		VerifyInclusion:            c.VerifyInclusion,
+		HeadersURL:                 redactURL(c.HeadersURL),
+		ShutdownTimeout:            c.ShutdownTimeout,
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&r.XPub, &c.XPub}, {&r.XPubFingerprint, &c.XPubFingerprint}, {&r.XPubPath, &c.XPubPath},
+		{&r.MultisigDescriptor, &c.MultisigDescriptor}, {&r.ChangeKeyProof, &c.ChangeKeyProof}, {&r.KVPath, &c.KVPath},
+	} {
+		if *f.src != "" {
+			*f.dst = redacted
+		}
+	}
+	if len(c.MuSig2Participants) > 0 {
+		r.MuSig2Participants = []string{fmt.Sprintf("%s (%d keys)", redacted, len(c.MuSig2Participants))}
+	}
+	for _, a := range c.DestinationAllowlist {
+		r.DestinationAllowlist = append(r.DestinationAllowlist, addr(a))
+	}
+	if len(c.DestinationMinimums) > 0 {
+		r.DestinationMinimums = make(map[string]int64, len(c.DestinationMinimums))
+		for a, v := range c.DestinationMinimums {
+			r.DestinationMinimums[addr(a)] = v
+		}
+	}
+	for _, t := range c.Templates {
+		t.Destinations = append([]TemplateDestination(nil), t.Destinations...)
+		for i := range t.Destinations {
+			if d := &t.Destinations[i]; IsDescriptor(d.Address) {
+				// Descriptors carry xpubs
+				d.Address = redacted
+			} else {
+				d.Address = addr(d.Address)
+			}
+		}
+		r.Templates = append(r.Templates, t)
+	}
+	if o := c.Orchestration; o != nil {
+		ro := *o
+		ro.Destination = addr(o.Destination)
+		ro.Accounts = nil
+		for _, a := range o.Accounts {
+			ra := OrchestrationAccountConfig{Name: a.Name}
+			for _, f := range []struct{ dst, src *string }{
+				{&ra.PubKeyHex, &a.PubKeyHex}, {&ra.XPub, &a.XPub}, {&ra.UTXOFile, &a.UTXOFile}, {&ra.KVPath, &a.KVPath},
+			} {
+				if *f.src != "" {
+					*f.dst = redacted
+				}
+			}
+			ro.Accounts = append(ro.Accounts, ra)
+		}
+		r.Orchestration = &ro
+	}
+	return r
+}
+
+// Scheme and host of an API URL; paths, queries and credentials often carry
+// tokens, and the host is enough to debug
+func redactURL(u string) string {
+	if u == "" {
+		return u
+	}
+	i := strings.Index(u, "://")
+	if i < 0 {
+		return redacted
+	}
+	host := u[i+3:]
+	if j := strings.IndexAny(host, "/?#"); j >= 0 {
+		host = host[:j]
+	}
+	if j := strings.LastIndex(host, "@"); j >= 0 {
+		host = host[j+1:]
+	}
+	return u[:i+3] + host + "/" + redacted
+}
+
+// Logs joined into one text, with the IDs of known transactions replaced,
+// and known addresses too when hashing
+func (s *Sweeper) redactLogs(lines []string, hash bool, txid, addr func(string) string) string {
+	text := strings.Join(lines, "\n")
+	if text != "" {
+		text += "\n"
+	}
+	known := map[string]string{}
+	for _, u := range s.indexedUTXOs {
+		known[u.TxID] = txid(u.TxID)
+		if hash {
+			known[u.Address] = addr(u.Address)
+		}
+	}
+	for _, p := range s.plans {
+		known[p.ID] = txid(p.ID)
+		for _, in := range p.Inputs {
+			known[in.TxID] = txid(in.TxID)
+			if hash {
+				known[in.Address] = addr(in.Address)
+			}
+		}
+		if hash {
+			for _, o := range p.Outputs {
+				known[o.Address] = addr(o.Address)
+			}
+		}
+	}
+	// Longest first, so a value that contains another is replaced whole
+	var vals []string
+	for v := range known {
+		if v != "" {
+			vals = append(vals, v)
+		}
+	}
+	sort.Slice(vals, func(i, j int) bool { return len(vals[i]) > len(vals[j]) })
+	for _, v := range vals {
+		text = strings.ReplaceAll(text, v, known[v])
+	}
+	return text
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Read a support bundle into file name -> content
+func readBundle(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[strings.TrimPrefix(hdr.Name, "support-bundle/")] = string(data)
+	}
+}
+
+func TestSupportBundle(t *testing.T) {
+	logs := NewLogBuffer(2, nil)
+	s := newTestSweeper(t, WithLogger(logs))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("destination"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	logs.Printf("sent %s to %s", plan.ID, testAddr("destination"))
+	if lines := logs.Lines(); len(lines) != 2 || !strings.HasSuffix(lines[1], "to "+testAddr("destination")) {
+		t.Fatalf("unexpected buffered logs %q", lines)
+	}
+
+	cfg := DefaultConfig()
+	cfg.XPub = "tpubSecretish"
+	cfg.WebhookURL = "https://user:pw@hooks.example/token/abc?key=1"
+	cfg.Templates = []PlanTemplate{{Name: "nightly", Kind: "consolidate", Destinations: []TemplateDestination{{Address: testAddr("destination"), WeightBP: 10000}, {Address: "wpkh(tpubSecretish/0/*)", WeightBP: 1}}}}
+	cfg.DestinationAllowlist = []string{testAddr("allowed")}
+	cfg.DestinationMinimums = map[string]int64{testAddr("minimum"): 10_000}
+	cfg.FeeProviderURL = "https://fees.example/api/apikey"
+	cfg.KVPath = "/home/alice/sweeper.kv"
+	cfg.ChangeSplitParts = 3
+	cfg.Orchestration = &OrchestrationConfig{
+		Accounts:      []OrchestrationAccountConfig{{Name: "ops", XPub: "tpubSecretish", UTXOFile: "/home/alice/ops.json", KVPath: "/home/alice/ops.kv"}},
+		Destination:   testAddr("destination"),
+		FeeBudgetSats: 2_000,
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteSupportBundle(&buf, SupportBundleOptions{Config: cfg, Logs: logs.Lines(), HashAddresses: true}); err != nil {
+		t.Fatalf("WriteSupportBundle: %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+	for _, name := range []string{"version.json", "stats.json", "plans.json", "config.json", "logs.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("bundle lacks %s", name)
+		}
+	}
+	for name, content := range files {
+		for _, secret := range []string{testAddr("destination"), testAddr("in"), testAddr("allowed"), testAddr("minimum"), "tpubSecretish", "token", "pw@", "apikey", "alice", plan.ID, stringsRepeat("a", 64)} {
+			if strings.Contains(content, secret) {
+				t.Fatalf("%s leaks %q:\n%s", name, secret, content)
+			}
+		}
+	}
+	if cfg.XPub != "tpubSecretish" || cfg.Templates[0].Destinations[0].Address != testAddr("destination") {
+		t.Fatalf("redaction modified the caller's config")
+	}
+	var bundled Config
+	if err := json.Unmarshal([]byte(files["config.json"]), &bundled); err != nil {
+		t.Fatalf("config.json: %v", err)
+	}
+	if bundled.WebhookURL != "https://hooks.example/[redacted]" || bundled.FeeProviderURL != "https://fees.example/[redacted]" || bundled.KVPath != redacted {
+		t.Fatalf("URLs and paths not reduced:\n%s", files["config.json"])
+	}
+	if bundled.ChangeSplitParts != 3 || bundled.Network != cfg.Network || len(bundled.DestinationAllowlist) != 1 || len(bundled.DestinationMinimums) != 1 {
+		t.Fatalf("operational settings not kept:\n%s", files["config.json"])
+	}
+	if o := bundled.Orchestration; o == nil || o.FeeBudgetSats != 2_000 || len(o.Accounts) != 1 || o.Accounts[0].Name != "ops" || o.Accounts[0].KVPath != redacted {
+		t.Fatalf("orchestration not kept redacted:\n%s", files["config.json"])
+	}
+
+	var plans []BundlePlan
+	if err := json.Unmarshal([]byte(files["plans.json"]), &plans); err != nil || len(plans) != 1 {
+		t.Fatalf("plans.json: %v %s", err, files["plans.json"])
+	}
+	p := plans[0]
+	if !strings.HasPrefix(p.ID, "tx:") || p.State != PlanUnsigned || !strings.HasPrefix(p.Outputs[0].Address, "addr:") || !p.Outputs[plan.ChangeIdxs[0]].Change {
+		t.Fatalf("unexpected plan summary %+v", p)
+	}
+	// Hashes are consistent within the bundle
+	if !strings.Contains(files["logs.txt"], "sent "+p.ID+" to "+p.Outputs[0].Address) {
+		t.Fatalf("log address not hashed consistently:\n%s", files["logs.txt"])
+	}
+	var stats SweeperStats
+	_ = json.Unmarshal([]byte(files["stats.json"]), &stats)
+	if stats.UTXOs != 1 || stats.UTXOSats != 200_000 || stats.Plans != 1 || stats.UnconfirmedPlans != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
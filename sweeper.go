@@ -3,11 +3,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
-	"sort"
+	"math/rand"
+	"sync"
+	"time"
 )
 
 // UTXO represents an unspent transaction output.
@@ -18,6 +22,10 @@ type UTXO struct {
 	ValueSats int64  // Value in satoshis
 	Address   string // Bitcoin address that can spend this UTXO
 	Confirmed bool   // Whether the transaction is confirmed
+	// Number of confirmations (0 = unknown; confirmed UTXOs count as at least 1)
+	Confirmations int `json:",omitempty"`
+	// Height of the block that confirmed it (0 = unknown or unconfirmed)
+	BlockHeight int64 `json:",omitempty"`
 }
 
 // TxOutput represents a transaction output to be created.
@@ -37,18 +45,55 @@ type WeightedAddr struct {
 // TransactionPlan contains all the information needed to create a transaction.
 // It includes inputs, outputs, fees, and the raw transaction/PSBT.
 type TransactionPlan struct {
-	Inputs     []UTXO     // UTXOs to spend
-	Outputs    []TxOutput // Outputs to create
-	FeeSats    int64      // Total fee in satoshis
-	RawTx      *MsgTx     // Raw transaction
-	PSBT       *PSBT      // Partially Signed Bitcoin Transaction
-	ChangeIdxs []int      // Indices of change outputs
+	ID         string          // Expected txid, assigned when the plan is tracked
+	Inputs     []UTXO          // UTXOs to spend
+	Outputs    []TxOutput      // Outputs to create
+	FeeSats    int64           // Total fee in satoshis
+	RawTx      *MsgTx          // Raw transaction
+	PSBT       *PSBT           // Partially Signed Bitcoin Transaction
+	ChangeIdxs []int           // Indices of change outputs (derived from Change)
+	Change     []ChangeOutput  // Change outputs identified by script and value
+	SignedTx   *MsgTx          // Finalized transaction once signatures are imported
+	Settings   PlanSettings    // Effective configuration that produced the plan
+	Annotation *PlanAnnotation // Off-chain metadata such as travel-rule data (see AnnotatePlan)
+	// Annotation encrypted under a key this Sweeper does not hold
+	sealedAnnotation string
+	Warnings         []PlanWarning // Non-fatal findings from planning (high fee, absorbed change, ...)
+	// Change below the dust threshold added to FeeSats instead of an output
+	DustChangeSats int64
+
+	PackageFeeSats int64   // Fee of the plan plus its unconfirmed ancestors
+	PackageVBytes  int64   // Virtual size of the plan plus its unconfirmed ancestors
+	PackageFeeRate float64 // Effective sat/vB miners see for the package
+	// Fee cost of the selection against the long-term fee rate (see
+	// SetLongTermFeeRate; 0 when it is unset)
+	WasteSats int64
+	// Effective sat/vB of the unconfirmed ancestors alone (0 = none); below
+	// PackageFeeRate when the plan pays for them
+	AncestorFeeRate float64
+
+	CreatedAt   time.Time  // When the plan was built
+	BroadcastAt *time.Time // When the transaction was broadcast (nil if not yet)
+	ConfirmedAt *time.Time // When the transaction confirmed (nil if not yet)
+
+	Status  PlanState        // Lifecycle state (see lifecycle.go)
+	History []PlanTransition // Every state entered, oldest first
+	// Verdicts of every preflight check run before broadcast, oldest first
+	Preflight []PreflightVerdict
+	Replaces  string // ID of the plan this one fee-bumps (see BumpFee)
+	// Descriptor index the plan pays (see SweepToDescriptor; nil otherwise)
+	DescriptorDest *DescriptorDestination
+
+	feeReport *FeeReport // Fee breakdown from planning (see FeeReport)
 }
 
-// Opts contains configuration options for the Sweeper.
-// These settings control fee calculation, dust filtering, and transaction behavior.
+// Opts contains configuration options for the Sweeper, applied in NewSweeper
+// with WithOpts. These settings control fee calculation, dust filtering, and
+// transaction behavior; zero values keep the defaults except AllowUnconfirmed,
+// which is always applied.
 type Opts struct {
 	FeeRateSatsVB       int64          // Fee rate in satoshis per virtual byte
+	FeeRateKVB          FeeRate        // Fee rate in sat/kvB, e.g. 1500 for 1.5 sat/vB; wins over FeeRateSatsVB
 	MinDustSats         int64          // Minimum dust threshold in satoshis
 	MinUSD              float64        // Minimum dust threshold in USD
 	PriceUSDPerBTC      float64        // BTC price in USD for dust calculation
@@ -59,6 +104,18 @@ type Opts struct {
 	MinChunkSats        int64          // Minimum size for change chunks
 	AllocationByWeights []WeightedAddr // Weighted addresses for fund allocation
 	MaxChainChildren    int            // Maximum depth for unconfirmed transaction chains
+	MaxOutputsPerTx     int            // Maximum recipient + change outputs per transaction (0 = unlimited)
+
+	// Skip change when inputs exceed outputs and the changeless fee by less than this
+	ChangelessToleranceSats int64
+
+	// Bounds on inputs per transaction (0 = no minimum / unlimited)
+	MinInputs int
+	MaxInputs int
+
+	// Caps on every plan's fee and fee rate in sat/kvB (see WithFeeCaps; 0 = unchanged)
+	MaxFeeSats int64
+	MaxFeeRate FeeRate
 }
 
 // KV defines a key-value storage interface for persisting UTXO data.
@@ -68,81 +125,227 @@ type KV interface {
 	Get(key []byte) ([]byte, error)
 }
 
+// ErrKeyNotFound is returned by KV.Get for a key that is not stored. Stores
+// should return it, or an error wrapping it, so a missing key can be told
+// apart from a failed read.
+var ErrKeyNotFound = errors.New("not found")
+
+// KVDeleter is an optional KV extension for removing keys. Stores without it
+// keep records that are no longer referenced, which is harmless but grows them.
+type KVDeleter interface {
+	Delete(key []byte) error
+}
+
+// KVCompareAndSwapper is an optional KV extension for atomic updates: the
+// value of key is replaced by new only if it currently equals old (nil old
+// means the key must be absent). Derivation counters require it so an index
+// is never handed out twice.
+type KVCompareAndSwapper interface {
+	CompareAndSwap(key, old, new []byte) (bool, error)
+}
+
+// KVLocker is an optional KV extension for advisory locks shared by every
+// sweeper instance using the store. Lock blocks until the named lock is held
+// and returns the function that releases it; a holder that dies loses the
+// lock after ttl. Stores without it get leases built on CompareAndSwap.
+type KVLocker interface {
+	Lock(name string, ttl time.Duration) (unlock func() error, err error)
+}
+
 // MemKV is an in-memory key-value store implementation.
 // It stores data in a Go map and is suitable for testing and small datasets.
-type MemKV struct{ m map[string][]byte }
+// It is safe for concurrent use.
+type MemKV struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
 
 // NewMemKV creates a new in-memory key-value store.
 func NewMemKV() *MemKV { return &MemKV{m: map[string][]byte{}} }
 
 // Put stores a key-value pair in the memory store.
-func (k *MemKV) Put(key, v []byte) error { k.m[string(key)] = v; return nil }
+func (k *MemKV) Put(key, v []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.m[string(key)] = v
+	return nil
+}
 
 // Get retrieves a value by key from the memory store.
 func (k *MemKV) Get(key []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	v, ok := k.m[string(key)]
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, ErrKeyNotFound
 	}
 	return v, nil
 }
 
+// Delete removes a key from the memory store. Missing keys are not an error.
+func (k *MemKV) Delete(key []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.m, string(key))
+	return nil
+}
+
+// CompareAndSwap stores new under key if the current value equals old.
+func (k *MemKV) CompareAndSwap(key, old, new []byte) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cur, had := k.m[string(key)]
+	if had != (old != nil) || !bytes.Equal(cur, old) {
+		return false, nil
+	}
+	k.m[string(key)] = append([]byte(nil), new...)
+	return true, nil
+}
+
 // Sweeper is the main instance for managing Bitcoin UTXOs and creating transactions.
 // It encapsulates all configuration, state, and transaction planning logic.
 type Sweeper struct {
 	// Configuration
-	pubKey           []byte  // Public key for address derivation
-	network          Network // Bitcoin network (mainnet/testnet)
-	asset            Asset   // Cryptocurrency asset (BTC/LTC)
-	feeRateSatsVB    int64   // Fee rate in satoshis per virtual byte
-	minDustSats      int64   // Minimum dust threshold in satoshis
-	minUSD           float64 // Minimum dust threshold in USD
-	priceUSDPerBTC   float64 // BTC price in USD for dust calculation
-	allowUnconfirmed bool    // Whether to allow unconfirmed UTXOs
-	maxUnconfInputs  int     // Maximum unconfirmed inputs per transaction
-	maxChainDepth    int     // Maximum depth for unconfirmed transaction chains
-	testMode         bool    // Skip strict address validation for testing
-	enforcePubKey    bool    // Enforce that addresses match configured public key
+	pubKey            []byte                     // Public key for address derivation
+	network           Network                    // Bitcoin network (mainnet/testnet)
+	asset             Asset                      // Cryptocurrency asset (BTC/LTC)
+	feeRate           FeeRate                    // Default fee rate in sat/kvB
+	dustPolicy        DustPolicy                 // Minimum economical value per script type
+	dustPriceWindow   time.Duration              // Time-weighted average window for dust prices (0 = spot)
+	priceProvider     PriceProvider              // Live dust price sampled while planning (nil = static price)
+	priceEvery        time.Duration              // Minimum time between priceProvider samples
+	priceSampled      time.Time                  // When priceProvider was last asked
+	feeGuard          *FeeGuard                  // Outlier check for provider fee rates (nil = off)
+	feeProvider       FeeRateProvider            // Live fee rate consulted by each plan (nil = static rate)
+	feeConfTarget     int                        // Confirmation target asked of feeProvider
+	tieBreak          TieBreak                   // Order among equally ranked UTXOs ("" = FIFO)
+	tieSeed           int64                      // Seed for TieBreakRandom
+	selection         SelectionStrategy          // Default coin selection order ("" = smallest-first)
+	selectionRand     *rand.Rand                 // Draw order for SelectSingleRandomDraw (nil = seeded from crypto/rand)
+	txVersion         int32                      // nVersion of planned transactions (3 = TRUC)
+	chain             ChainInfoProvider          // Chain tip source (nil = none)
+	antiFeeSniping    bool                       // Lock new plans to the tip height
+	webhook           *Webhook                   // Plan event receiver (nil = none)
+	eventOutbox       bool                       // Record plan events for ReplayEvents consumers without a webhook
+	webhookMu         sync.Mutex                 // Guards webhookBusy and webhookAgain
+	webhookBusy       bool                       // A background outbox delivery is running
+	webhookAgain      bool                       // Events were recorded during that delivery
+	webhookWG         sync.WaitGroup             // Background webhook deliveries
+	annotationKey     []byte                     // AES-256 key annotations are stored under (nil = plaintext)
+	fiatCurrency      string                     // ISO 4217 code for fiat valuations ("" = USD)
+	multisig          *MultisigAccount           // wsh(sortedmulti) wallet account (nil = single key)
+	multisigScripts   map[string]*multisigScript // Derived multisig addresses
+	account           *XPubAccount               // Single-signature xpub account (nil = single key)
+	accountKeys       map[string]*accountKey     // Derived account addresses
+	allowUnconfirmed  bool                       // Whether to allow unconfirmed UTXOs
+	maxUnconfInputs   int                        // Maximum unconfirmed inputs per transaction
+	maxChainDepth     int                        // Maximum depth for unconfirmed transaction chains
+	minZeroConfScore  int                        // Minimum zero-conf score for unconfirmed UTXOs (0 = off)
+	mempool           MempoolSource              // Source of mempool data for zero-conf scoring
+	merkleProofs      MerkleProofSource          // Inclusion proofs for confirmed UTXOs (nil = trust the backend)
+	headers           HeaderSource               // Trusted block headers the proofs are checked against
+	verifiedTxs       map[string]*provenTx       // Transactions whose inclusion proof has been verified
+	spSigner          SilentPaymentSigner        // ECDH shares for silent payment outputs (nil = cannot pay sp1…)
+	maxUnconfExposure int64                      // Maximum unconfirmed input value across pending plans (0 = unlimited)
+	maxDestExposure   int64                      // Maximum unconfirmed value per destination address (0 = unlimited)
+	destMinimums      map[string]int64           // Smallest output each destination accepts, e.g. exchange deposit minimums
+	broadcastRetry    BroadcastRetryPolicy       // Retry and dead-letter limits for failed broadcasts
+	coinSelector      CoinSelector               // Picks inputs from the candidates (nil = GreedySelector)
+	reuseThreshold    int                        // Received UTXOs at which an address counts as reused
+	finalityDepth     int                        // Confirmations at which a mined plan is final
+	planRetention     int                        // Finished plans kept tracked in memory
+	addrStats         map[string]*AddressStats   // Per-address usage, loaded lazily from KV
+	utxoLocks         map[string]UTXOLock        // Outpoints kept out of selection, loaded lazily from KV
+	instanceID        string                     // Owner of the KV locks this instance takes
+	addressClusters   map[string]string          // Declared address clusters: address -> representative
+	testMode          bool                       // Deprecated blanket validation bypass; see SetTestMode
+	enforcePubKey     bool                       // Enforce that addresses match configured public key
+	ownershipCheck    OwnershipValidator         // Replaces the public key check for indexed UTXOs (nil = pubkey)
+	offline           bool                       // Index only coins verified against supplied raw transactions
 
 	// Change/output allocation strategy
-	changeSplitParts    int            // Number of parts to split change into
-	targetChunkSats     int64          // Target size for change chunks
-	minChunkSats        int64          // Minimum size for change chunks
-	allocationByWeights []WeightedAddr // Weighted addresses for fund allocation
+	changeSplitParts    int               // Number of parts to split change into
+	targetChunkSats     int64             // Target size for change chunks
+	minChunkSats        int64             // Minimum size for change chunks
+	allocationByWeights []WeightedAddr    // Weighted addresses for fund allocation
+	utxoFilters         []namedFilter     // Integrator hooks that can veto coins
+	maxOutputsPerTx     int               // Recipient + change outputs per transaction (0 = unlimited)
+	changelessTolerance int64             // Excess over a changeless fee given up instead of making change
+	consolidateFeeRate  FeeRate           // Fee rate at or below which spends sweep in spare coins (0 = off)
+	consolidateMaxExtra int               // Spare coins a low-fee spend may add
+	minInputs           int               // Inputs every transaction must have (0 = none)
+	maxInputs           int               // Inputs a transaction may have (0 = unlimited)
+	maturityTiers       []MaturityTier    // Confirmed coins held back until mature, by value (ascending)
+	confirmedFirst      bool              // Order confirmed candidates before unconfirmed ones
+	scriptTemplates     []scriptTemplate  // Integrator output script builders by prefix
+	templateScripts     map[string][]byte // Scripts built for the plan in progress (nil outside planning)
+	preflight           []namedPreflight  // Integrator checks run before broadcast
+	destAllowlist       map[string]bool   // Recipients broadcast plans may pay (nil = any)
+	requireApproval     bool              // Refuse to broadcast unapproved plans
+	minRelayFeeRate     FeeRate           // Lowest fee rate a plan may pay (0 = 1 sat/vB)
+	maxFeeSats          int64             // Highest fee a plan may pay (0 = unlimited)
+	maxFeeRate          FeeRate           // Highest fee rate a plan may pay (0 = unlimited)
+	maxFeePercent       float64           // Highest fee as a percentage of the amount sent (0 = unlimited)
+	addrCache           *addressCache     // Decoded addresses and their output scripts (nil = off)
+	longTermFeeRate     FeeRate           // Expected average fee rate, for waste and consolidation choices (0 = unset)
+	minPackageFeeRate   FeeRate           // Lowest rate a plan and its unconfirmed ancestors may pay together (0 = target rate)
 
 	// State
-	kv           KV             // Key-value store for UTXO persistence
-	indexedUTXOs []UTXO         // Currently indexed UTXOs
-	chainDepth   map[string]int // Transaction ID to chain depth mapping
+	kv           KV                          // Key-value store for UTXO persistence
+	logger       Logger                      // Diagnostic output
+	indexedUTXOs []UTXO                      // Currently indexed UTXOs
+	chainDepth   map[string]int              // Transaction ID to chain depth mapping
+	plans        map[string]*TransactionPlan // Pending plans by ID (expected txid)
+	// Last address checked by RevalidateIndex (round-robin position)
+	revalidateAfter string
 	// Optional taproot change key (x-only 32 bytes). If set, change uses P2TR.
-	taprootChangeKey []byte
+	taprootChangeKey      []byte
+	changeKeyVerified     bool       // A signer proved it can spend taprootChangeKey
+	requireChangeKeyProof bool       // Refuse P2TR change until changeKeyVerified
+	musig2                *MuSig2Key // Cosigner aggregate behind taprootChangeKey, if any
+	// Previous transactions of P2PKH inputs and IndexRaw coins (NonWitnessUtxo), by txid
+	prevTxSource PrevTxSource
+	prevTxs      map[string]*MsgTx
 }
 
 // NewSweeper creates a new Sweeper instance with default configuration.
-// It initializes the sweeper with the provided public key and network.
-func NewSweeper(pubKey []byte, network Network) *Sweeper {
-	return &Sweeper{
+// It initializes the sweeper with the provided public key and network, applies
+// the options in order, and validates the resulting configuration.
+func NewSweeper(pubKey []byte, network Network, opts ...Option) (*Sweeper, error) {
+	s := &Sweeper{
 		pubKey:           pubKey,
 		network:          network,
 		asset:            getAssetFromNetwork(network),
-		feeRateSatsVB:    5, // default 5 sat/vB
-		minDustSats:      600,
-		minUSD:           0.50,
-		priceUSDPerBTC:   55000,
+		feeRate:          5000, // default 5 sat/vB
+		dustPolicy:       FixedDustPolicy{MinSats: 600, MinUSD: 0.50, PriceUSDPerBTC: 55000},
+		txVersion:        2,
 		allowUnconfirmed: true,
 		maxUnconfInputs:  2,
 		maxChainDepth:    2,
+		reuseThreshold:   defaultReuseThreshold,
+		finalityDepth:    defaultFinalityDepth,
+		planRetention:    defaultPlanRetention,
 		kv:               NewMemKV(),
+		logger:           nopLogger{},
 		indexedUTXOs:     make([]UTXO, 0),
 		chainDepth:       make(map[string]int),
+		plans:            make(map[string]*TransactionPlan),
 		enforcePubKey:    true,
+		addrCache:        newAddressCache(defaultAddressCacheSize),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid sweeper configuration: %w", err)
+	}
+	return s, nil
 }
 
 // Get asset from network
 func getAssetFromNetwork(network Network) Asset {
 	switch network {
-	case BitcoinMainnet, BitcoinTestnet:
+	case BitcoinMainnet, BitcoinTestnet, BitcoinRegtest:
 		return BTC
 	case LitecoinMainnet, LitecoinTestnet:
 		return LTC
@@ -151,20 +354,19 @@ func getAssetFromNetwork(network Network) Asset {
 	}
 }
 
-// SetFeeRate sets the fee rate in satoshis per vbyte
+// SetFeeRate sets the fee rate in whole satoshis per vbyte; SetFeeRateKVB
+// takes fractional rates
 func (s *Sweeper) SetFeeRate(rate int64) error {
 	if rate <= 0 {
 		return errors.New("fee rate must be positive (got " + fmt.Sprintf("%d", rate) + " sat/vB) - try values like 1-100")
 	}
-	s.feeRateSatsVB = rate
+	s.feeRate = SatPerVByte(rate)
 	return nil
 }
 
 // SetDustRate sets the dust threshold
 func (s *Sweeper) SetDustRate(sats int64, usd float64, priceUSDPerBTC float64) {
-	s.minDustSats = sats
-	s.minUSD = usd
-	s.priceUSDPerBTC = priceUSDPerBTC
+	s.dustPolicy = FixedDustPolicy{MinSats: sats, MinUSD: usd, PriceUSDPerBTC: priceUSDPerBTC}
 }
 
 // SetNetwork sets the network
@@ -185,19 +387,76 @@ func (s *Sweeper) SetTaprootChangeKey(xOnly []byte) error {
 		return errors.New("taproot change key must be 32-byte x-only public key")
 	}
 	s.taprootChangeKey = append([]byte(nil), xOnly...)
+	s.changeKeyVerified = false
+	s.musig2 = nil
 	return nil
 }
 
-// SetTestMode enables test mode (skips strict address validation)
+// SetTaprootChangeInternalKey sets the taproot change key from an untweaked
+// internal key (33-byte compressed or 32-byte x-only), applying the BIP-86
+// tweak for a key-path-only output.
+func (s *Sweeper) SetTaprootChangeInternalKey(internalKey []byte) error {
+	xOnly, err := internalXOnly(internalKey)
+	if err != nil {
+		return err
+	}
+	out, _, err := TaprootOutputKey(xOnly)
+	if err != nil {
+		return err
+	}
+	return s.SetTaprootChangeKey(out)
+}
+
+// SetTestMode enables test mode, which skips address validation everywhere,
+// counts every script as P2WPKH and builds placeholder output scripts.
+//
+// Deprecated: test mode never exercises the real encoding paths and is unsafe
+// to mix with real addresses. Run tests on BitcoinRegtest with real addresses,
+// fund them through MockBackend and use SetOwnershipValidator for coins that
+// do not belong to the configured key.
 func (s *Sweeper) SetTestMode(enabled bool) {
 	s.testMode = enabled
 }
 
+// SetKV replaces the key-value store used for persistence
+func (s *Sweeper) SetKV(kv KV) {
+	s.kv = kv
+	s.addrStats = nil
+	s.utxoLocks = nil
+}
+
+// Close waits for background webhook deliveries, then releases the KV store
+// and mempool source if they hold resources (implement io.Closer). The
+// sweeper must not be used afterwards.
+func (s *Sweeper) Close() error {
+	s.WaitWebhooks()
+	var errs []error
+	if c, ok := s.kv.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	if c, ok := s.mempool.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
 // SetPubKeyCheck enables/disables enforcing that addresses match the configured public key
 func (s *Sweeper) SetPubKeyCheck(enabled bool) {
 	s.enforcePubKey = enabled
 }
 
+// OwnershipValidator decides whether an indexed UTXO belongs to the sweeper.
+// It runs after the address has been decoded and checked against the network.
+type OwnershipValidator func(u UTXO) error
+
+// SetOwnershipValidator replaces the public key check on indexed UTXOs, such
+// as with a lookup in an external wallet or, in tests, a fixed address set.
+// Account and multisig addresses are always accepted; nil restores the
+// public key check.
+func (s *Sweeper) SetOwnershipValidator(v OwnershipValidator) {
+	s.ownershipCheck = v
+}
+
 // SetUnconfirmedPolicy sets unconfirmed transaction policy
 func (s *Sweeper) SetUnconfirmedPolicy(allow bool, maxInputs int, maxDepth int) {
 	s.allowUnconfirmed = allow
@@ -228,7 +487,7 @@ func (s *Sweeper) SetSpendingWallets(weights []WeightedAddr) error {
 			return fmt.Errorf("weight at index %d must be > 0 (got %d basis points) - weights are in basis points (1/100th of a percent)", i, weights[i].WeightBP)
 		}
 		if !s.testMode {
-			if _, err := DecodeAddress(weights[i].Address); err != nil {
+			if _, err := s.decodeDestination(weights[i].Address); err != nil {
 				return fmt.Errorf("invalid address at index %d '%s': %w - check address format or use test mode", i, weights[i].Address, err)
 			}
 		}
@@ -253,15 +512,15 @@ func (s *Sweeper) LoadSpendingWallets() error {
 }
 
 // SpendToWallets creates outputs to the configured wallets by weights
-func (s *Sweeper) SpendToWallets(totalSats int64, minChunk int64) (*TransactionPlan, error) {
+func (s *Sweeper) SpendToWallets(totalSats int64, minChunk int64, opts ...SpendOptions) (*TransactionPlan, error) {
 	if len(s.allocationByWeights) == 0 {
 		return nil, errors.New("no wallet weights configured")
 	}
-	outs := buildWeightedOutputs(totalSats, s.allocationByWeights, minChunk)
+	outs, _ := s.dropBelowDestinationMinimum(buildWeightedOutputs(totalSats, s.allocationByWeights, minChunk))
 	if len(outs) == 0 {
 		return nil, errors.New("no outputs after weighting - check that total amount is sufficient and minChunk is reasonable")
 	}
-	return s.Spend(outs)
+	return s.Spend(outs, opts...)
 }
 
 // Index adds a UTXO to the sweeper's index after validation.
@@ -282,6 +541,14 @@ func (s *Sweeper) Index(utxo UTXO) error {
 		return errors.New("unconfirmed UTXOs not allowed")
 	}
 
+	// Require an inclusion proof before trusting a confirmation
+	if err := s.verifyInclusion(utxo); err != nil {
+		return err
+	}
+	if err := s.verifyOffline(utxo); err != nil {
+		return err
+	}
+
 	// Check chain depth for unconfirmed UTXOs
 	if !utxo.Confirmed {
 		depth := s.getChainDepth(utxo.TxID)
@@ -293,10 +560,19 @@ func (s *Sweeper) Index(utxo UTXO) error {
 	// Add to index
 	s.indexedUTXOs = append(s.indexedUTXOs, utxo)
 
-	// Store in KV
+	// Store in KV, counting UTXOs not seen before toward address usage
 	key := fmt.Sprintf("utxo:%s:%d", utxo.TxID, utxo.Vout)
+	_, seenErr := s.kv.Get([]byte(key))
 	data, _ := json.Marshal(utxo)
 	s.kv.Put([]byte(key), data)
+	if seenErr != nil {
+		if err := s.recordReceived(utxo); err != nil {
+			return fmt.Errorf("failed to record address usage: %w", err)
+		}
+		if err := s.recordReceivedAt(utxo); err != nil {
+			return fmt.Errorf("failed to record receive time: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -309,17 +585,23 @@ func (s *Sweeper) validateUTXOAddress(utxo UTXO) error {
 	}
 
 	// Decode address
-	addr, err := DecodeAddress(utxo.Address)
+	addr, err := s.decodeAddress(utxo.Address)
 	if err != nil {
 		return err
 	}
 
 	// Check network match
-	if addr.Network != s.network {
-		return errors.New("address network mismatch")
+	if err := s.checkAddressNetwork(utxo.Address, addr); err != nil {
+		return err
 	}
 
-	// Validate against public key
+	// Validate against public key; derived account addresses are our own
+	if s.accountKeys[utxo.Address] != nil || s.multisigScripts[utxo.Address] != nil {
+		return nil
+	}
+	if s.ownershipCheck != nil {
+		return s.ownershipCheck(utxo)
+	}
 	if s.enforcePubKey {
 		return ValidateAddress(utxo.Address, s.pubKey, s.network)
 	}
@@ -328,12 +610,7 @@ func (s *Sweeper) validateUTXOAddress(utxo UTXO) error {
 
 // Check dust threshold
 func (s *Sweeper) checkDustThreshold(utxo UTXO) error {
-	dustUSD := dustFromUSD(s.minUSD, s.priceUSDPerBTC)
-	dust := s.minDustSats
-	if dustUSD > dust {
-		dust = dustUSD
-	}
-
+	dust := s.dustPolicy.MinForScript(s.scriptTypeOf(utxo.Address))
 	if utxo.ValueSats < dust {
 		return fmt.Errorf("UTXO value %d below dust threshold %d", utxo.ValueSats, dust)
 	}
@@ -356,7 +633,18 @@ func (s *Sweeper) setChainDepth(txid string, depth int) {
 
 // Spend creates a spending transaction from the indexed UTXOs.
 // It performs coin selection, fee calculation, and transaction building.
-func (s *Sweeper) Spend(outputs []TxOutput) (*TransactionPlan, error) {
+// Optional SpendOptions override the Sweeper's defaults for this call only.
+func (s *Sweeper) Spend(outputs []TxOutput, opts ...SpendOptions) (*TransactionPlan, error) {
+	p, err := s.resolveSpendOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.spend(outputs, p)
+}
+
+// Validate outputs and build a plan with resolved parameters
+func (s *Sweeper) spend(outputs []TxOutput, p spendParams) (*TransactionPlan, error) {
+	defer s.templateScope()()
 	if len(outputs) == 0 {
 		return nil, errors.New("no outputs specified - provide at least one destination address and amount")
 	}
@@ -364,18 +652,21 @@ func (s *Sweeper) Spend(outputs []TxOutput) (*TransactionPlan, error) {
 	// Validate outputs
 	for i, output := range outputs {
 		if !s.testMode {
-			dec, err := DecodeAddress(output.Address)
+			dec, err := s.decodeDestination(output.Address)
 			if err != nil {
 				return nil, fmt.Errorf("invalid output address at index %d: %w", i, err)
 			}
-			if dec.Network != s.network {
-				return nil, fmt.Errorf("output address network mismatch at index %d", i)
+			if err := s.checkAddressNetwork(output.Address, dec); err != nil {
+				return nil, fmt.Errorf("output address at index %d: %w", i, err)
 			}
 		}
-		if output.ValueSats <= 0 {
+		if output.ValueSats < 0 || (output.ValueSats == 0 && !s.isNullData(output.Address)) {
 			return nil, fmt.Errorf("invalid output value at index %d: %d", i, output.ValueSats)
 		}
 	}
+	if err := s.checkDestinationMinimums(outputs); err != nil {
+		return nil, err
+	}
 
 	// Get change address
 	changeAddr, err := s.getChangeAddress()
@@ -384,31 +675,35 @@ func (s *Sweeper) Spend(outputs []TxOutput) (*TransactionPlan, error) {
 	}
 
 	// Build transaction
-	return s.buildTransaction(s.indexedUTXOs, outputs, changeAddr)
+	return s.buildTransaction(s.indexedUTXOs, outputs, changeAddr, p)
 }
 
 // Get change address
 func (s *Sweeper) getChangeAddress() (string, error) {
-	if s.testMode {
-		return "tb1test_change_address", nil
+	if s.multisig != nil {
+		return s.nextMultisigChange()
+	}
+	if s.account != nil {
+		return s.nextAccountChange()
 	}
 	if len(s.taprootChangeKey) == 32 {
+		if err := s.checkChangeKeyProof(); err != nil {
+			return "", err
+		}
 		return CreateP2TR(s.taprootChangeKey, s.network)
 	}
 	return DeriveChangeAddress(s.pubKey, s.network)
 }
 
 // Build transaction (refactored from original)
-func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr string) (*TransactionPlan, error) {
-	// Calculate dust threshold
-	dustUSD := dustFromUSD(s.minUSD, s.priceUSDPerBTC)
-	dust := s.minDustSats
-	if dustUSD > dust {
-		dust = dustUSD
-	}
+func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr string, p spendParams) (*TransactionPlan, error) {
+	// Calculate dust threshold for change
+	dust := s.dustFor(changeAddr, p)
 	if dust <= 0 {
 		dust = 600
 	}
+	p.changeDust = dust
+	p.pool = utxos
 
 	// Calculate total output value
 	totalOut := int64(0)
@@ -418,15 +713,53 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 	if totalOut <= 0 {
 		return nil, errors.New("outputs total must be > 0")
 	}
+	if s.maxOutputsPerTx > 0 && len(outputs) > s.maxOutputsPerTx {
+		return nil, fmt.Errorf("%d outputs exceed the limit of %d per transaction - use SpendBatched to spread them over several transactions", len(outputs), s.maxOutputsPerTx)
+	}
 
-	// Select UTXOs
-	selected, totalIn, estFee, err := s.selectUTXOsFor(totalOut, utxos, dust, len(outputs))
-	if err != nil {
-		return nil, err
+	// Select UTXOs. With the recipients filling the output limit there is no
+	// room for change, so look for a changeless match first.
+	noChangeRoom := s.maxOutputsPerTx > 0 && len(outputs) == s.maxOutputsPerTx
+	var selected []UTXO
+	var totalIn, estFee int64
+	if p.inputs != nil {
+		var err error
+		selected, totalIn, estFee, err = s.fixedSelection(p.inputs, outputs, totalOut, p)
+		if err != nil {
+			return nil, err
+		}
+	} else if p.selection == SelectBranchAndBound || noChangeRoom {
+		selected, totalIn, estFee = s.selectBnB(utxos, outputs, changeAddr, dust, p)
+		if selected != nil && s.checkInputCount(len(selected)) != nil {
+			selected = nil // Out of bounds: fall back to selection with change
+		}
+		if selected != nil && s.longTermFeeRate > 0 && !noChangeRoom {
+			// Keep the changeless match only if it wastes no more than change
+			if alt, altIn, altFee, err := s.selectUTXOsFor(totalOut, utxos, p, len(outputs)); err == nil {
+				alt, altIn, altFee = s.addConsolidationInputs(alt, altIn, utxos, len(outputs), p)
+				changeless := s.selectionWaste(selected, false, totalIn-totalOut-estFee, changeAddr, p)
+				withChange := s.selectionWaste(alt, altIn-totalOut-altFee > dust, altIn-totalOut-altFee, changeAddr, p)
+				if withChange < changeless {
+					selected, totalIn, estFee = alt, altIn, altFee
+				}
+			}
+		}
+	}
+	if selected == nil {
+		var err error
+		selected, totalIn, estFee, err = s.selectUTXOsFor(totalOut, utxos, p, len(outputs))
+		if err != nil {
+			return nil, err
+		}
+		selected, totalIn, estFee = s.addConsolidationInputs(selected, totalIn, utxos, len(outputs), p)
 	}
 
 	// Calculate change
 	change := totalIn - totalOut - estFee
+	tolerated := change > 0 && s.withinChangelessTolerance(selected, outputs, totalIn-totalOut, p)
+	if tolerated {
+		change = 0 // Give the small excess to the fee rather than make change
+	}
 
 	// Build final outputs
 	finalOutputs := make([]TxOutput, 0, len(outputs)+8)
@@ -435,8 +768,14 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 	changeIdxs := []int{}
 	if change > dust {
 		// Weighted allocation of change across specified addresses
-		if len(s.allocationByWeights) > 0 {
-			ws := buildWeightedOutputs(change, s.allocationByWeights, max64(1, dust))
+		if p.change == ChangeSingle {
+			finalOutputs = append(finalOutputs, TxOutput{Address: changeAddr, ValueSats: change})
+			changeIdxs = append(changeIdxs, len(finalOutputs)-1)
+		} else if len(s.allocationByWeights) > 0 {
+			ws, shortfall := s.dropBelowDestinationMinimum(buildWeightedOutputs(change, s.allocationByWeights, max64(1, dust)))
+			if shortfall > 0 {
+				ws = append(ws, TxOutput{Address: changeAddr, ValueSats: shortfall})
+			}
 			for _, w := range ws {
 				finalOutputs = append(finalOutputs, w)
 				changeIdxs = append(changeIdxs, len(finalOutputs)-1)
@@ -467,9 +806,18 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 		}
 	}
 
+	// Respect the output limit by collapsing split change into one output
+	if s.maxOutputsPerTx > 0 && len(finalOutputs) > s.maxOutputsPerTx {
+		if noChangeRoom {
+			return nil, fmt.Errorf("%w: no changeless selection pays %d recipients within the limit of %d outputs - use SpendBatched or fewer recipients", ErrNoChangeRoom, len(outputs), s.maxOutputsPerTx)
+		}
+		finalOutputs = append(finalOutputs[:len(outputs)], TxOutput{Address: changeAddr, ValueSats: change})
+		changeIdxs = []int{len(outputs)}
+	}
+
 	// Recalculate fee with final outputs using address-aware estimator
 	vbytes := estimateTxVBytesDetailed(s, selected, finalOutputs)
-	finalFee := vbytes * s.feeRateSatsVB
+	finalFee := p.feeRate.Fee(vbytes)
 
 	// Adjust change for final fee
 	changeDelta := (totalIn - totalOut) - finalFee
@@ -477,15 +825,76 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 		return nil, errors.New("final fee overshoots; add UTXOs or reduce outputs")
 	}
 
-	if len(changeIdxs) == 1 {
-		// Final change should equal (totalIn - totalOut - finalFee)
-		finalOutputs[changeIdxs[0]].ValueSats = changeDelta
-	} else if len(changeIdxs) == 0 {
-		finalFee = totalIn - totalOut
+	// Settle the last change output against the final fee. Change that would
+	// fall below dust goes to the fee rather than into an unspendable output.
+	if n := len(changeIdxs); n > 0 {
+		last := changeIdxs[n-1]
+		rest := changeDelta
+		for _, i := range changeIdxs[:n-1] {
+			rest -= finalOutputs[i].ValueSats
+		}
+		if rest > dust {
+			finalOutputs[last].ValueSats = rest
+		} else {
+			finalOutputs = append(finalOutputs[:last], finalOutputs[last+1:]...)
+			changeIdxs = changeIdxs[:n-1]
+			vbytes = estimateTxVBytesDetailed(s, selected, finalOutputs)
+		}
+	}
+	changeSum := int64(0)
+	for _, i := range changeIdxs {
+		changeSum += finalOutputs[i].ValueSats
+	}
+	finalFee = totalIn - totalOut - changeSum
+	if finalFee < p.feeRate.Fee(vbytes) {
+		return nil, errors.New("final fee overshoots; add UTXOs or reduce outputs")
+	}
+	if extra := finalFee - p.feeRate.Fee(vbytes); extra > 0 && !tolerated {
+		p.dustChange = extra
+		s.logger.Printf("change of %d sats is below the %d-sat dust threshold: adding it to the fee", extra, dust)
+	}
+
+	// Pay for low-fee unconfirmed ancestors so the package meets the target rate
+	pkgFee, err := s.packageFee(selected, vbytes, finalFee, p.feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if extra := pkgFee - finalFee; extra > 0 {
+		if len(changeIdxs) == 0 {
+			return nil, errors.New("not enough value to pay for unconfirmed ancestors; add UTXOs or reduce outputs")
+		}
+		last := changeIdxs[len(changeIdxs)-1]
+		if finalOutputs[last].ValueSats-extra < dust {
+			return nil, errors.New("change too small to pay for unconfirmed ancestors; add UTXOs or reduce outputs")
+		}
+		finalOutputs[last].ValueSats -= extra
+		finalFee = pkgFee
+	}
+
+	return s.assemblePlan(selected, finalOutputs, finalFee, changeIdxs, p)
+}
+
+// assemblePlan builds the unsigned transaction and PSBT for the chosen inputs
+// and outputs, updates unconfirmed chain depth, and tracks the resulting plan.
+func (s *Sweeper) assemblePlan(selected []UTXO, finalOutputs []TxOutput, fee int64, changeIdxs []int, p spendParams) (*TransactionPlan, error) {
+	if err := s.checkUnconfirmedExposure(selected); err != nil {
+		return nil, err
+	}
+	if err := s.checkDestinationExposure(finalOutputs, changeIdxs, p); err != nil {
+		return nil, err
+	}
+	vbytes := estimateTxVBytesDetailed(s, selected, finalOutputs)
+	if err := s.checkTxVersionRules(selected, vbytes); err != nil {
+		return nil, err
+	}
+	if err := s.checkFeeLimits(fee, vbytes, finalOutputs, changeIdxs, p.maxFeeSats, p.maxFeeRate); err != nil {
+		return nil, err
 	}
 
 	// Build transaction
-	tx := NewMsgTx(2) // version 2
+	p.lockTime = s.planLockTime(p)
+	tx := NewMsgTx(s.txVersion)
+	tx.LockTime = p.lockTime
 
 	// Add inputs
 	for _, in := range selected {
@@ -497,16 +906,22 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 			PreviousOutPoint: outpoint,
 			SignatureScript:  nil,
 			Witness:          nil,
-			Sequence:         0xffffffff,
+			Sequence:         p.sequence(),
 		}
 		tx.AddTxIn(txin)
 	}
 
-	// Add outputs
-	for _, out := range finalOutputs {
-		script, err := s.buildOutputScript(out.Address)
-		if err != nil {
-			return nil, fmt.Errorf("bad output script %s (%w)", out.Address, err)
+	// Add outputs; silent payment outputs are derived from the inputs
+	spScripts, err := s.silentPaymentScripts(selected, finalOutputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, out := range finalOutputs {
+		script, ok := spScripts[i]
+		if !ok {
+			if script, err = s.buildOutputScript(out.Address); err != nil {
+				return nil, fmt.Errorf("bad output script %s (%w)", out.Address, err)
+			}
 		}
 		txout := TxOut{
 			Value:    out.ValueSats,
@@ -518,33 +933,50 @@ func (s *Sweeper) buildTransaction(utxos []UTXO, outputs []TxOutput, changeAddr
 	// Create PSBT
 	psbt := NewPSBTFromUnsignedTx(tx)
 
-	// Set witness UTXOs
+	// Set witness UTXOs, or previous transactions for legacy inputs
 	for i, in := range selected {
-		script, err := s.buildOutputScript(in.Address)
-		if err != nil {
+		if err := s.setInputUTXO(&psbt.Inputs[i], in); err != nil {
 			return nil, err
 		}
-		psbt.Inputs[i].WitnessUtxo = &TxOut{
-			Value:    in.ValueSats,
-			PkScript: script,
-		}
 	}
 
-	// Update chain depth for unconfirmed inputs
+	s.decoratePSBT(psbt, selected, finalOutputs)
+
+	// Update chain depth for unconfirmed inputs; a replacement spends the
+	// same inputs as the plan it replaces, which counted them already
 	for _, in := range selected {
-		if !in.Confirmed {
+		if !in.Confirmed && !p.replacement {
 			s.setChainDepth(in.TxID, s.getChainDepth(in.TxID)+1)
 		}
 	}
 
-	return &TransactionPlan{
+	plan := &TransactionPlan{
 		Inputs:     selected,
 		Outputs:    finalOutputs,
-		FeeSats:    finalFee,
+		FeeSats:    fee,
 		RawTx:      tx,
 		PSBT:       psbt,
 		ChangeIdxs: changeIdxs,
-	}, nil
+		Settings:   s.snapshotSettings(p),
+		Annotation: p.annotation,
+
+		DustChangeSats: p.dustChange,
+	}
+	if err := s.recordChange(plan); err != nil {
+		return nil, err
+	}
+	if err := s.setPackageFee(plan); err != nil {
+		return nil, err
+	}
+	if s.longTermFeeRate > 0 {
+		plan.WasteSats = s.planWaste(plan, p)
+	}
+	plan.feeReport = s.buildFeeReport(plan, p.feeRate, s.reportDust(plan, p))
+	plan.Warnings = s.planWarnings(plan, p)
+	if err := s.trackPlan(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
 }
 
 // Build output script for address
@@ -555,143 +987,209 @@ func (s *Sweeper) buildOutputScript(addr string) ([]byte, error) {
 		return []byte{0x00, 0x14, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13}, nil
 	}
 
-	decoded, err := DecodeAddress(addr)
+	decoded, err := s.decodeAddress(addr)
 	if err != nil {
+		if isSilentPaymentAddress(addr) {
+			return nil, errors.New("silent payment output scripts depend on the transaction inputs")
+		}
+		if script, ok, cerr := s.customOutputScript(addr); ok {
+			return script, cerr
+		}
 		return nil, err
 	}
-
-	switch decoded.Type {
-	case P2WPKH:
-		return BuildP2WPKHScript(decoded.Data), nil
-	case P2TR:
-		return BuildP2TRScript(decoded.Data), nil
-	default:
-		return nil, errors.New("unsupported address type")
-	}
+	return s.addressScript(addr, decoded)
 }
 
 // Select UTXOs for spending
-func (s *Sweeper) selectUTXOsFor(targetOutSats int64, utxos []UTXO, dust int64, nFixedOutputs int) ([]UTXO, int64, int64, error) {
-	// Filter UTXOs
-	cands := s.filterUTXOs(utxos, dust)
+func (s *Sweeper) selectUTXOsFor(targetOutSats int64, utxos []UTXO, p spendParams, nFixedOutputs int) ([]UTXO, int64, int64, error) {
+	// Filter and order UTXOs
+	cands := s.candidates(utxos, p)
 	if len(cands) == 0 {
 		return nil, 0, 0, errors.New("no spendable UTXOs after filters")
 	}
 
-	// Greedy selection
-	var selected []UTXO
-	totalIn := int64(0)
-
-	for i := 0; i < len(cands); i++ {
-		selected = append(selected, cands[i])
-		totalIn += cands[i].ValueSats
-		nIn := len(selected)
-		nOut := nFixedOutputs + 1
-		estVBytes := estimateTxVBytes(nIn, nOut)
-		fee := estVBytes * s.feeRateSatsVB
-
-		if totalIn >= targetOutSats+fee {
-			return selected, totalIn, fee, nil
+	// Fixed part of the fee: overhead, outputs and one change output
+	fixedFee := p.feeRate.Fee(estimateTxVBytes(0, nFixedOutputs+1))
+	sel := s.coinSelector
+	if sel == nil {
+		sel = GreedySelector{}
+		if p.selection == SelectPrivacy {
+			sel = clusterSelector{clusterOf: s.addressClusterMap()}
+		}
+	}
+	var picked []UTXO
+	var err error
+	if ws, ok := sel.(WeightedCoinSelector); ok {
+		picked, err = ws.SelectWeighted(cands, targetOutSats+fixedFee, p.feeRate, func(u UTXO) int64 { return inputVBytes(s, u) })
+	} else {
+		picked, err = sel.Select(cands, targetOutSats+fixedFee, p.feeRate)
+	}
+	if err != nil {
+		if short := s.shortfall(utxos, targetOutSats, nFixedOutputs, p); short.NeededSats > 0 {
+			return nil, 0, 0, short
 		}
+		return nil, 0, 0, err
 	}
+	selected, totalIn, err := checkSelection(cands, picked)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("coin selector %T: %w", sel, err)
+	}
+	capped := false
+	if s.maxInputs > 0 && len(selected) > s.maxInputs {
+		if _, greedy := sel.(GreedySelector); !greedy {
+			return nil, 0, 0, s.inputCountError(len(selected), fmt.Sprintf("coin selector %T picked %d inputs", sel, len(selected)))
+		}
+		// Fewest inputs: the largest coins
+		selected, totalIn = largestInputs(cands, s.maxInputs)
+		capped = true
+	}
+	fee := p.feeRate.Fee(s.selectionVBytes(selected, nFixedOutputs+1))
+	if totalIn < targetOutSats+fee {
+		if capped {
+			return nil, 0, 0, s.inputCountError(len(selected), fmt.Sprintf("the %d largest UTXOs do not cover outputs + fee", len(selected)))
+		}
+		if short := s.shortfall(utxos, targetOutSats, nFixedOutputs, p); short.NeededSats > 0 {
+			return nil, 0, 0, short
+		}
+		return nil, 0, 0, errors.New("balance is not enough for outputs + fee")
+	}
+	if len(selected) < s.minInputs {
+		if selected, totalIn, err = s.padToMinInputs(selected, totalIn, cands); err != nil {
+			return nil, 0, 0, err
+		}
+		fee = p.feeRate.Fee(s.selectionVBytes(selected, nFixedOutputs+1))
+	}
+	return selected, totalIn, fee, nil
+}
+
+// Filter UTXOs based on dust, confirmation and unconfirmed policy and filter hooks
+func (s *Sweeper) filterUTXOs(utxos []UTXO, p spendParams) []UTXO {
+	res, _ := s.screenUTXOs(utxos, p)
+	return res
+}
 
-	return nil, 0, 0, errors.New("balance is not enough for outputs + fee")
+// Split UTXOs into selectable ones (in selection order) and rejected ones with reasons
+func (s *Sweeper) screenUTXOs(utxos []UTXO, p spendParams) ([]UTXO, []RejectedUTXO) {
+	return s.screenOrdered(orderUTXOs(utxos, p), p)
 }
 
-// Filter UTXOs based on dust and unconfirmed policy
-func (s *Sweeper) filterUTXOs(utxos []UTXO, minValue int64) []UTXO {
+// Screen UTXOs already in selection order, so the unconfirmed input cap
+// admits the first ones selection would take
+func (s *Sweeper) screenOrdered(ordered []UTXO, p spendParams) ([]UTXO, []RejectedUTXO) {
 	var res []UTXO
+	var rejected []RejectedUTXO
+	reject := func(u UTXO, kind RejectKind, format string, a ...any) {
+		rejected = append(rejected, RejectedUTXO{UTXO: u, Kind: kind, Reason: fmt.Sprintf(format, a...)})
+	}
 	unconf := 0
 
-	// Sort by value (ascending)
-	cpy := make([]UTXO, len(utxos))
-	copy(cpy, utxos)
-	sort.Slice(cpy, func(i, j int) bool {
-		return cpy[i].ValueSats < cpy[j].ValueSats
-	})
-
-	for _, u := range cpy {
-		if u.ValueSats < minValue {
+	// Other instances sharing the KV store may have locked coins; an
+	// unreadable lock set locks everything
+	locks, lockErr := s.reloadUTXOLocks()
+	now := time.Now()
+	for _, u := range ordered {
+		if lockErr != nil {
+			reject(u, RejectLocked, "UTXO locks unavailable: %v", lockErr)
+			continue
+		}
+		if _, ok := locks[outpointKey(u)]; ok {
+			reject(u, RejectLocked, "locked - see UnlockUTXO")
+			continue
+		}
+		if p.exclude[outpointKey(u)] {
+			reject(u, RejectLocked, "excluded by caller")
+			continue
+		}
+		if dust := s.dustFor(u.Address, p); u.ValueSats < dust {
+			reject(u, RejectDust, "below dust threshold of %d sats", dust)
+			continue
+		}
+		if p.minConf > 0 && confirmations(u) < p.minConf {
+			reject(u, RejectConfirmations, "%d confirmations, %d required", confirmations(u), p.minConf)
+			continue
+		}
+		if why := s.immature(u, now); why != "" {
+			reject(u, RejectConfirmations, "%s", why)
 			continue
 		}
 		if !s.allowUnconfirmed && !u.Confirmed {
+			reject(u, RejectUnconfirmed, "unconfirmed UTXOs are not allowed")
 			continue
 		}
 		if s.allowUnconfirmed && !u.Confirmed {
 			if unconf >= s.maxUnconfInputs {
+				reject(u, RejectUnconfirmed, "unconfirmed input limit of %d reached", s.maxUnconfInputs)
+				continue
+			}
+			if !s.zeroConfAcceptable(u) {
+				reject(u, RejectUnconfirmed, "zero-conf score below %d", s.minZeroConfScore)
 				continue
 			}
+		}
+		if name, err := s.runUTXOFilters(u); err != nil {
+			reject(u, RejectFiltered, "filter %s: %v", name, err)
+			continue
+		}
+		if !u.Confirmed {
 			unconf++
 		}
 		res = append(res, u)
 	}
 
-	return res
+	return res, rejected
 }
 
 // ConsolidateAll sweeps all indexed UTXOs into a single destination address (no change)
-func (s *Sweeper) ConsolidateAll(destAddr string) (*TransactionPlan, error) {
+func (s *Sweeper) ConsolidateAll(destAddr string, opts ...SpendOptions) (*TransactionPlan, error) {
+	defer s.templateScope()()
 	if !s.testMode {
-		if _, err := DecodeAddress(destAddr); err != nil {
+		dec, err := s.decodeDestination(destAddr)
+		if err != nil {
 			return nil, fmt.Errorf("invalid destination address: %w", err)
 		}
+		if err := s.checkAddressNetwork(destAddr, dec); err != nil {
+			return nil, err
+		}
 	}
-	// Dust threshold
-	dustUSD := dustFromUSD(s.minUSD, s.priceUSDPerBTC)
-	dust := s.minDustSats
-	if dustUSD > dust {
-		dust = dustUSD
+	p, err := s.resolveSpendOptions(opts)
+	if err != nil {
+		return nil, err
 	}
-	cands := s.filterUTXOs(s.indexedUTXOs, dust)
+	dust := s.dustFor(destAddr, p)
+	p.changeDust = dust
+	cands := s.candidates(s.indexedUTXOs, p)
 	if len(cands) == 0 {
 		return nil, errors.New("no spendable UTXOs to consolidate")
 	}
+	if len(cands) < s.minInputs {
+		return nil, s.inputCountError(len(cands), fmt.Sprintf("only %d spendable UTXOs are available", len(cands)))
+	}
+	if s.maxInputs > 0 && len(cands) > s.maxInputs {
+		s.logger.Printf("consolidating %d of %d UTXOs (input limit)", s.maxInputs, len(cands))
+		cands = cands[:s.maxInputs]
+	}
 	// Sum inputs
 	totalIn := int64(0)
 	for _, u := range cands {
 		totalIn += u.ValueSats
 	}
-	// Estimate fee for nIn inputs and 1 output
-	vbytes := estimateTxVBytes(len(cands), 1)
-	fee := vbytes * s.feeRateSatsVB
+	// Estimate fee for the inputs and 1 output
+	vbytes := s.selectionVBytes(cands, 1)
+	fee, err := s.packageFee(cands, vbytes, p.feeRate.Fee(vbytes), p.feeRate)
+	if err != nil {
+		return nil, err
+	}
 	if totalIn <= fee || (totalIn-fee) < dust {
 		return nil, errors.New("balance too low after fees for consolidation")
 	}
 	// Build single-output plan
 	outputs := []TxOutput{{Address: destAddr, ValueSats: totalIn - fee}}
-	// Build raw tx and psbt
-	tx := NewMsgTx(2)
-	for _, in := range cands {
-		op, err := NewOutPointFromStr(in.TxID, in.Vout)
-		if err != nil {
-			return nil, fmt.Errorf("invalid txid: %w", err)
-		}
-		tx.AddTxIn(TxIn{PreviousOutPoint: op, Sequence: 0xffffffff})
-	}
-	script, err := s.buildOutputScript(destAddr)
-	if err != nil {
-		return nil, err
-	}
-	tx.AddTxOut(TxOut{Value: outputs[0].ValueSats, PkScript: script})
-	psbt := NewPSBTFromUnsignedTx(tx)
-	for i, in := range cands {
-		sc, err := s.buildOutputScript(in.Address)
-		if err != nil {
-			return nil, err
-		}
-		psbt.Inputs[i].WitnessUtxo = &TxOut{Value: in.ValueSats, PkScript: sc}
-	}
-	for _, in := range cands {
-		if !in.Confirmed {
-			s.setChainDepth(in.TxID, s.getChainDepth(in.TxID)+1)
-		}
-	}
-	return &TransactionPlan{Inputs: cands, Outputs: outputs, FeeSats: fee, RawTx: tx, PSBT: psbt, ChangeIdxs: nil}, nil
+	return s.assemblePlan(cands, outputs, fee, nil, p)
 }
 
 // SpendEven creates evenly distributed outputs across the provided addresses.
 // It splits the total amount equally among all destination addresses.
-func (s *Sweeper) SpendEven(destAddrs []string, totalSats int64, minChunk int64) (*TransactionPlan, error) {
+func (s *Sweeper) SpendEven(destAddrs []string, totalSats int64, minChunk int64, opts ...SpendOptions) (*TransactionPlan, error) {
 	if len(destAddrs) == 0 {
 		return nil, errors.New("no destination addresses")
 	}
@@ -708,17 +1206,17 @@ func (s *Sweeper) SpendEven(destAddrs []string, totalSats int64, minChunk int64)
 	for i := 0; i < limit; i++ {
 		outs = append(outs, TxOutput{Address: destAddrs[i], ValueSats: chunks[i]})
 	}
-	return s.Spend(outs)
+	return s.Spend(outs, opts...)
 }
 
 // SpendWeighted distributes funds across addresses according to their weights.
 // It creates outputs proportional to each address's weight in basis points.
-func (s *Sweeper) SpendWeighted(weights []WeightedAddr, totalSats int64, minChunk int64) (*TransactionPlan, error) {
-	outs := buildWeightedOutputs(totalSats, weights, minChunk)
+func (s *Sweeper) SpendWeighted(weights []WeightedAddr, totalSats int64, minChunk int64, opts ...SpendOptions) (*TransactionPlan, error) {
+	outs, _ := s.dropBelowDestinationMinimum(buildWeightedOutputs(totalSats, weights, minChunk))
 	if len(outs) == 0 {
 		return nil, errors.New("no outputs after weighting - check that total amount is sufficient and minChunk is reasonable")
 	}
-	return s.Spend(outs)
+	return s.Spend(outs, opts...)
 }
 
 // Get indexed UTXOs
@@ -755,6 +1253,16 @@ func estimateTxVBytes(nIn, nOut int) int64 {
 	return int64(baseOverheadVBytes + nIn*inVBytesTaproot + nOut*outVBytes)
 }
 
+// Size of a transaction spending inputs, each at its own script type's size,
+// with nOut outputs at the flat output size
+func (s *Sweeper) selectionVBytes(inputs []UTXO, nOut int) int64 {
+	vbytes := estimateTxVBytes(0, nOut)
+	for _, u := range inputs {
+		vbytes += inputVBytes(s, u)
+	}
+	return vbytes
+}
+
 // estimateTxVBytesDetailed estimates vbytes accounting for input/output script types.
 // This is an approximation suitable for fee planning without external libs.
 func estimateTxVBytesDetailed(s *Sweeper, inputs []UTXO, outputs []TxOutput) int64 {
@@ -763,42 +1271,66 @@ func estimateTxVBytesDetailed(s *Sweeper, inputs []UTXO, outputs []TxOutput) int
 	const (
 		inP2WPKH = 68
 		inP2TR   = 58
+		inP2PKH  = 148 // Non-witness: signature and pubkey in the scriptSig
 	)
 	// Approx per-output sizes (value+len+script)
 	const (
 		outP2WPKH = 31
 		outP2TR   = 43
+		outP2PKH  = 34
 	)
 	total := int64(baseOverheadVBytes)
 	// Inputs
 	for _, in := range inputs {
+		if ms := s.multisigScriptFor(in.Address); ms != nil {
+			total += ms.inputVBytes()
+			continue
+		}
 		t := "p2wpkh"
 		if !s.testMode {
-			if dec, err := DecodeAddress(in.Address); err == nil {
-				if dec.Type == P2TR {
+			if dec, err := s.decodeAddress(in.Address); err == nil {
+				switch dec.Type {
+				case P2TR:
 					t = "p2tr"
+				case P2PKH:
+					t = "p2pkh"
 				}
 			}
 		}
-		if t == "p2tr" {
+		switch t {
+		case "p2tr":
 			total += inP2TR
-		} else {
+		case "p2pkh":
+			total += inP2PKH
+		default:
 			total += inP2WPKH
 		}
 	}
 	// Outputs
 	for _, out := range outputs {
+		if script, ok := s.templateScript(out.Address); ok {
+			total += outputSize(script)
+			continue
+		}
 		t := "p2wpkh"
 		if !s.testMode {
-			if dec, err := DecodeAddress(out.Address); err == nil {
-				if dec.Type == P2TR {
-					t = "p2tr"
+			if isSilentPaymentAddress(out.Address) {
+				t = "p2tr"
+			} else if dec, err := s.decodeAddress(out.Address); err == nil {
+				switch dec.Type {
+				case P2TR, P2WSH:
+					t = "p2tr" // Same 32-byte witness program size
+				case P2PKH:
+					t = "p2pkh"
 				}
 			}
 		}
-		if t == "p2tr" {
+		switch t {
+		case "p2tr":
 			total += outP2TR
-		} else {
+		case "p2pkh":
+			total += outP2PKH
+		default:
 			total += outP2WPKH
 		}
 	}
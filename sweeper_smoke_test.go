@@ -2,6 +2,9 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -20,6 +23,42 @@ func TestBech32DecodeValidInvalid(t *testing.T) {
 	}
 }
 
+func TestEncodeSegWitAddress(t *testing.T) {
+	// BIP-173/350 vectors
+	p20, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+	for _, tc := range []struct {
+		version int
+		program []byte
+		want    string
+	}{
+		{0, p20, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{1, append(append([]byte{}, p20...), p20...), "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y"},
+		{16, p20[:2], "bc1sw50qgdz25j"},
+	} {
+		got, err := EncodeSegWitAddress("bc", tc.version, tc.program)
+		if err != nil || got != tc.want {
+			t.Fatalf("v%d: got %s (%v), want %s", tc.version, got, err, tc.want)
+		}
+	}
+	for name, tc := range map[string]struct {
+		hrp     string
+		version int
+		n       int
+	}{
+		"v0 length":  {"bc", 0, 16},
+		"too short":  {"bc", 1, 1},
+		"too long":   {"bc", 1, 41},
+		"version":    {"bc", 17, 32},
+		"upper hrp":  {"BC", 0, 20},
+		"empty hrp":  {"", 0, 20},
+		"over limit": {strings.Repeat("a", 40), 1, 40},
+	} {
+		if addr, err := EncodeSegWitAddress(tc.hrp, tc.version, make([]byte, tc.n)); err == nil {
+			t.Fatalf("%s: expected an error, got %s", name, addr)
+		}
+	}
+}
+
 func TestTxSerializationHashes(t *testing.T) {
 	tx := NewMsgTx(2)
 	// 1 dummy input
@@ -46,14 +85,13 @@ func TestPSBTSerializeMagic(t *testing.T) {
 }
 
 func TestCoinSelectionAndFees(t *testing.T) {
-	s := NewSweeper([]byte("test_pubkey__________33bytes________")[:33], BitcoinTestnet)
-	s.SetTestMode(true)
+	s := newTestSweeper(t)
 	// Index three UTXOs
-	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: "tb1in1", Confirmed: true})
-	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 90_000, Address: "tb1in2", Confirmed: true})
-	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 120_000, Address: "tb1in3", Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in1"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 90_000, Address: testAddr("in2"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 120_000, Address: testAddr("in3"), Confirmed: true})
 
-	outs := []TxOutput{{Address: "tb1dest", ValueSats: 150_000}}
+	outs := []TxOutput{{Address: testAddr("dest"), ValueSats: 150_000}}
 	plan, err := s.Spend(outs)
 	if err != nil {
 		t.Fatalf("Spend failed: %v", err)
@@ -74,16 +112,15 @@ func TestCoinSelectionAndFees(t *testing.T) {
 }
 
 func TestDustFiltering(t *testing.T) {
-	s := NewSweeper([]byte("test_pubkey__________33bytes________")[:33], BitcoinTestnet)
-	s.SetTestMode(true)
+	s := newTestSweeper(t)
 	s.SetDustRate(600, 0.50, 55_000)
-	if err := s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100, Address: "tb1in", Confirmed: true}); err == nil {
+	if err := s.Index(UTXO{TxID: stringsRepeat("d", 64), Vout: 0, ValueSats: 100, Address: testAddr("in"), Confirmed: true}); err == nil {
 		t.Fatalf("expected dust rejection")
 	}
 }
 
 func TestWeightedAllocationSplit(t *testing.T) {
-	outs := buildWeightedOutputs(100_000, []WeightedAddr{{Address: "tb1A", WeightBP: 7000}, {Address: "tb1B", WeightBP: 3000}}, 10)
+	outs := buildWeightedOutputs(100_000, []WeightedAddr{{Address: testAddr("A"), WeightBP: 7000}, {Address: testAddr("B"), WeightBP: 3000}}, 10)
 	var sum int64
 	for _, o := range outs {
 		sum += o.ValueSats
@@ -112,8 +149,7 @@ func TestFeeEstimatorTypes(t *testing.T) {
 		t.Fatalf("p2tr: %v", err)
 	}
 
-	s := NewSweeper(pk, BitcoinTestnet)
-	s.SetTestMode(false)
+	s := mustNewSweeper(t, pk, BitcoinTestnet)
 	// Use two inputs to amplify per-input differences
 	v1 := estimateTxVBytesDetailed(s, []UTXO{{Address: p2w, ValueSats: 10_000}, {Address: p2w, ValueSats: 10_000}}, []TxOutput{{Address: p2w, ValueSats: 1000}})
 	v2 := estimateTxVBytesDetailed(s, []UTXO{{Address: p2tr, ValueSats: 10_000}, {Address: p2tr, ValueSats: 10_000}}, []TxOutput{{Address: p2tr, ValueSats: 1000}})
@@ -122,6 +158,20 @@ func TestFeeEstimatorTypes(t *testing.T) {
 	}
 }
 
+func TestDeprecatedTestModeSkipsAddressValidation(t *testing.T) {
+	pk := testECDSAKey{d: big.NewInt(0x5eeded)}.pub()
+	if err := mustNewSweeper(t, pk, BitcoinTestnet).Index(UTXO{TxID: stringsRepeat("a", 64), ValueSats: 50_000, Address: "tb1in", Confirmed: true}); err == nil {
+		t.Fatalf("expected an undecodable address to be rejected outside test mode")
+	}
+	s := mustNewSweeper(t, pk, BitcoinTestnet, WithTestMode(true))
+	if err := s.Index(UTXO{TxID: stringsRepeat("a", 64), ValueSats: 50_000, Address: "tb1in", Confirmed: true}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if _, err := s.Spend([]TxOutput{{Address: "tb1dest", ValueSats: 20_000}}); err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+}
+
 // helper: build a dummy 64-char hex string
 func stringsRepeat(c string, n int) string {
 	var b bytes.Buffer
@@ -130,3 +180,104 @@ func stringsRepeat(c string, n int) string {
 	}
 	return b.String()
 }
+
+// helper: construct a sweeper or fail the test
+func mustNewSweeper(t *testing.T, pubKey []byte, network Network, opts ...Option) *Sweeper {
+	t.Helper()
+	s, err := NewSweeper(pubKey, network, opts...)
+	if err != nil {
+		t.Fatalf("NewSweeper: %v", err)
+	}
+	return s
+}
+
+// helper: regtest sweeper that owns every indexed coin, so tests can fund it
+// on testAddr addresses and plan with real output scripts
+func newTestSweeper(t *testing.T, opts ...Option) *Sweeper {
+	t.Helper()
+	owned := WithOwnershipValidator(func(UTXO) error { return nil })
+	return mustNewSweeper(t, testECDSAKey{d: big.NewInt(0x5eeded)}.pub(), BitcoinRegtest, append([]Option{owned}, opts...)...)
+}
+
+// helper: regtest P2WPKH address standing for name
+func testAddr(name string) string {
+	addr, err := CreateP2WPKH(Hash160([]byte(name)), BitcoinRegtest)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+func TestNewSweeperValidatesOptions(t *testing.T) {
+	var logged []string
+	s := newTestSweeper(t, WithFeeRate(12), WithUnconfirmedPolicy(false, 0, 0), WithLogger(logFunc(func(f string, v ...any) { logged = append(logged, f) })))
+	if s.feeRate != SatPerVByte(12) || s.allowUnconfirmed {
+		t.Fatalf("options not applied")
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}); err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(logged) == 0 {
+		t.Fatalf("expected the logger to receive messages")
+	}
+
+	_, err := NewSweeper([]byte{0x02}, BitcoinTestnet, WithFeeRate(0), WithDustPolicy(FixedDustPolicy{MinSats: -1, MinUSD: 0.5}), WithKV(nil))
+	if err == nil {
+		t.Fatalf("expected invalid configuration to be rejected")
+	}
+	for _, want := range []string{"public key", "fee rate", "non-negative", "BTC price", "KV store"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestNewSweeperAppliesOpts(t *testing.T) {
+	s := newTestSweeper(t, WithOpts(Opts{FeeRateSatsVB: 7, MinDustSats: 1_000, AllowUnconfirmed: true, MaxOutputsPerTx: 3, ChangelessToleranceSats: 500, MinInputs: 2, MaxInputs: 3}))
+	dust, _ := s.dustPolicy.(FixedDustPolicy)
+	if s.feeRate != SatPerVByte(7) || dust.MinSats != 1_000 || dust.MinUSD != 0.50 || !s.allowUnconfirmed || s.maxUnconfInputs != 2 {
+		t.Fatalf("opts not applied over the defaults: %s %+v", s.feeRate, dust)
+	}
+	if s.maxOutputsPerTx != 3 || s.changelessTolerance != 500 || s.minInputs != 2 || s.maxInputs != 3 {
+		t.Fatalf("opts not applied: %d %d %d %d", s.maxOutputsPerTx, s.changelessTolerance, s.minInputs, s.maxInputs)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}); err == nil {
+		t.Fatalf("expected MinInputs to refuse a one-input spend")
+	}
+	if _, err := NewSweeper(nil, BitcoinTestnet, WithOpts(Opts{MaxOutputsPerTx: 1, MinInputs: 3, MaxInputs: 2})); err == nil || !strings.Contains(err.Error(), "max outputs") {
+		t.Fatalf("expected invalid opts to be rejected, got %v", err)
+	}
+}
+
+func TestWithOptsFeeRateKVB(t *testing.T) {
+	s := newTestSweeper(t, WithOpts(Opts{FeeRateSatsVB: 7, FeeRateKVB: 1500}))
+	if s.feeRate != 1500 {
+		t.Fatalf("expected FeeRateKVB to win over FeeRateSatsVB, got %s", s.feeRate)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if vbytes := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs); plan.FeeSats != FeeRate(1500).Fee(vbytes) || plan.Settings.FeeRateKVB != 1500 {
+		t.Fatalf("plan pays %d sats for %d vB, want 1.5 sat/vB", plan.FeeSats, vbytes)
+	}
+	if _, err := NewSweeper(nil, BitcoinRegtest, WithOpts(Opts{FeeRateKVB: -1})); err == nil {
+		t.Fatalf("expected a negative fee rate to be rejected")
+	}
+}
+
+func TestWithOptsOverridesAllowUnconfirmed(t *testing.T) {
+	if s := newTestSweeper(t, WithUnconfirmedPolicy(true, 2, 2), WithOpts(Opts{FeeRateSatsVB: 5})); s.allowUnconfirmed {
+		t.Fatalf("expected a later WithOpts to turn unconfirmed spending off")
+	}
+	if s := newTestSweeper(t, WithOpts(Opts{FeeRateSatsVB: 5}), WithUnconfirmedPolicy(true, 2, 2)); !s.allowUnconfirmed || s.feeRate != SatPerVByte(5) {
+		t.Fatalf("expected a later WithUnconfirmedPolicy to refine WithOpts")
+	}
+}
+
+type logFunc func(format string, v ...any)
+
+func (f logFunc) Printf(format string, v ...any) { f(format, v...) }
@@ -0,0 +1,176 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains named plan templates for recurring sweeps.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Template kinds
+const (
+	TemplateConsolidate = "consolidate" // Sweep all spendable UTXOs to the destination(s)
+	TemplateSpend       = "spend"       // Send AmountSats split across destinations by weight
+)
+
+// TemplateDestination is a destination address with an allocation weight.
+type TemplateDestination struct {
+	Address  string `json:"address"`   // Destination address, or a wildcard descriptor (consolidate only)
+	WeightBP int    `json:"weight_bp"` // Weight in basis points (1/100th of a percent)
+}
+
+// PlanTemplate is a named, reusable sweep definition so routine operations
+// don't need their parameters re-specified on every run.
+type PlanTemplate struct {
+	Name         string                `json:"name"`                     // Unique template name
+	Kind         string                `json:"kind"`                     // "consolidate" or "spend"
+	Destinations []TemplateDestination `json:"destinations"`             // Where funds go
+	AmountSats   int64                 `json:"amount_sats,omitempty"`    // Total to send (spend only)
+	MinChunkSats int64                 `json:"min_chunk_sats,omitempty"` // Minimum per-destination output
+	FeeRate      float64               `json:"fee_rate,omitempty"`       // Fee rate override in sat/vB, e.g. 1.5 (0 = sweeper default)
+	Selection    string                `json:"selection,omitempty"`      // Coin selection strategy ("" = the sweeper default)
+	Schedule     string                `json:"schedule,omitempty"`       // When the template should run
+}
+
+// Validate checks that the template is complete and internally consistent.
+func (t *PlanTemplate) Validate() error {
+	if t.Name == "" {
+		return errors.New("template name is required")
+	}
+	if len(t.Destinations) == 0 {
+		return fmt.Errorf("template '%s' has no destinations", t.Name)
+	}
+	for i, d := range t.Destinations {
+		if d.Address == "" {
+			return fmt.Errorf("template '%s' destination %d has no address", t.Name, i)
+		}
+		if d.WeightBP < 0 {
+			return fmt.Errorf("template '%s' destination %d has negative weight", t.Name, i)
+		}
+		if IsDescriptor(d.Address) && t.Kind != TemplateConsolidate {
+			return fmt.Errorf("template '%s' destination %d is a descriptor, which only consolidate templates support", t.Name, i)
+		}
+	}
+	switch t.Kind {
+	case TemplateConsolidate:
+		if len(t.Destinations) != 1 {
+			return fmt.Errorf("consolidate template '%s' supports a single destination (got %d)", t.Name, len(t.Destinations))
+		}
+	case TemplateSpend:
+		if t.AmountSats <= 0 {
+			return fmt.Errorf("spend template '%s' needs amount_sats > 0", t.Name)
+		}
+	default:
+		return fmt.Errorf("template '%s' has invalid kind '%s' - must be 'consolidate' or 'spend'", t.Name, t.Kind)
+	}
+	if t.FeeRate < 0 {
+		return fmt.Errorf("template '%s' fee_rate must be non-negative (got %g)", t.Name, t.FeeRate)
+	}
+	if t.Selection != "" {
+		if err := SelectionStrategy(t.Selection).validate(); err != nil {
+			return fmt.Errorf("template '%s': %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// weights converts template destinations to allocation weights
+func (t *PlanTemplate) weights() []WeightedAddr {
+	ws := make([]WeightedAddr, 0, len(t.Destinations))
+	for _, d := range t.Destinations {
+		w := d.WeightBP
+		if w == 0 {
+			w = 1 // unweighted destinations share equally
+		}
+		ws = append(ws, WeightedAddr{Address: d.Address, WeightBP: w})
+	}
+	return ws
+}
+
+// SaveTemplate validates and persists a template in the KV store.
+func (s *Sweeper) SaveTemplate(t PlanTemplate) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Put([]byte("template:"+t.Name), b); err != nil {
+		return err
+	}
+	names, _ := s.templateNames()
+	for _, n := range names {
+		if n == t.Name {
+			return nil
+		}
+	}
+	names = append(names, t.Name)
+	sort.Strings(names)
+	idx, _ := json.Marshal(names)
+	return s.kv.Put([]byte("templates:index"), idx)
+}
+
+// LoadTemplate loads a persisted template by name.
+func (s *Sweeper) LoadTemplate(name string) (*PlanTemplate, error) {
+	b, err := s.kv.Get([]byte("template:" + name))
+	if err != nil {
+		return nil, fmt.Errorf("template '%s' not found", name)
+	}
+	var t PlanTemplate
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTemplates returns the names of all persisted templates.
+func (s *Sweeper) ListTemplates() []string {
+	names, _ := s.templateNames()
+	return names
+}
+
+// Read the template name index from KV
+func (s *Sweeper) templateNames() ([]string, error) {
+	b, err := s.kv.Get([]byte("templates:index"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// RunTemplate plans a sweep as described by the template against the current index.
+func (s *Sweeper) RunTemplate(t PlanTemplate) (*TransactionPlan, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	opts := SpendOptions{FeeRateKVB: FeeRateFromSatPerVB(t.FeeRate), Selection: SelectionStrategy(t.Selection)}
+	switch t.Kind {
+	case TemplateConsolidate:
+		if dest := t.Destinations[0].Address; IsDescriptor(dest) {
+			d, err := ParseDestinationDescriptor(dest, s.network)
+			if err != nil {
+				return nil, fmt.Errorf("template '%s': %w", t.Name, err)
+			}
+			return s.SweepToDescriptor(d, opts)
+		}
+		return s.ConsolidateAll(t.Destinations[0].Address, opts)
+	default:
+		return s.SpendWeighted(t.weights(), t.AmountSats, t.MinChunkSats, opts)
+	}
+}
+
+// RunTemplateByName loads a persisted template and runs it.
+func (s *Sweeper) RunTemplateByName(name string) (*TransactionPlan, error) {
+	t, err := s.LoadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.RunTemplate(*t)
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestRunTemplateByNameUsesFeeOverride(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 80_000, Address: testAddr("in1"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 90_000, Address: testAddr("in2"), Confirmed: true})
+
+	tmpl := PlanTemplate{
+		Name:         "nightly-cold-sweep",
+		Kind:         TemplateConsolidate,
+		Destinations: []TemplateDestination{{Address: testAddr("cold")}},
+		FeeRate:      2,
+	}
+	if err := s.SaveTemplate(tmpl); err != nil {
+		t.Fatalf("SaveTemplate: %v", err)
+	}
+	if names := s.ListTemplates(); len(names) != 1 || names[0] != tmpl.Name {
+		t.Fatalf("unexpected template list %v", names)
+	}
+	plan, err := s.RunTemplateByName(tmpl.Name)
+	if err != nil {
+		t.Fatalf("RunTemplateByName: %v", err)
+	}
+	if want := s.selectionVBytes(plan.Inputs, 1) * 2; plan.FeeSats != want {
+		t.Fatalf("expected fee %d at template rate, got %d", want, plan.FeeSats)
+	}
+	if s.feeRate != SatPerVByte(5) {
+		t.Fatalf("template fee override leaked into sweeper defaults")
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	bad := PlanTemplate{Name: "x", Kind: TemplateSpend, Destinations: []TemplateDestination{{Address: testAddr("a")}}}
+	if err := bad.Validate(); err == nil {
+		t.Fatalf("expected spend template without amount to be rejected")
+	}
+}
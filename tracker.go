@@ -0,0 +1,139 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the confirmation tracker for pending plans.
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// ConfirmationSource reports how many confirmations a transaction has: 0 when
+// unconfirmed (in the mempool or not) and a positive count once mined.
+type ConfirmationSource interface {
+	Confirmations(txid string) (int, error)
+}
+
+// PlanState is where a tracked plan is in its lifecycle.
+type PlanState string
+
+// Plan lifecycle states
+const (
+	PlanUnsigned  PlanState = "unsigned"  // Waiting for signatures
+	PlanSigned    PlanState = "signed"    // Signed but not broadcast
+	PlanPending   PlanState = "pending"   // Broadcast, not yet mined
+	PlanDropped   PlanState = "dropped"   // Broadcast but missing from the mempool
+	PlanConfirmed PlanState = "confirmed" // Mined
+)
+
+// PlanStatus is one row of the tracker's view of a plan.
+type PlanStatus struct {
+	ID             string        `json:"id"`
+	State          PlanState     `json:"state"`
+	Confirmations  int           `json:"confirmations"`
+	FeeRate        float64       `json:"fee_rate"`         // Package sat/vB the plan pays
+	MempoolFeeRate float64       `json:"mempool_fee_rate"` // Current target sat/vB
+	Age            time.Duration `json:"age"`              // Since broadcast, or since planning if not broadcast
+	Action         string        `json:"action,omitempty"` // Suggested next step
+}
+
+// ConfirmationTracker polls a backend for the confirmation status of tracked
+// plans and records confirmations on the sweeper. The mempool source is
+// optional; without it dropped transactions cannot be told from pending ones.
+type ConfirmationTracker struct {
+	sweeper *Sweeper
+	src     ConfirmationSource
+	mempool MempoolSource
+}
+
+// NewConfirmationTracker creates a tracker for s. src may be nil, in which case
+// only the locally recorded broadcast and confirmation times are used.
+func NewConfirmationTracker(s *Sweeper, src ConfirmationSource) *ConfirmationTracker {
+	return &ConfirmationTracker{sweeper: s, src: src, mempool: s.mempool}
+}
+
+// Poll refreshes every tracked plan, marking newly mined ones confirmed (and
+// final at the finality depth, or broadcast again if reorged out), and
+// returns their status in creation order with a suggested action: sign,
+// broadcast, bump (paying less than the current fee rate) or rebroadcast
+// (dropped from the mempool).
+func (t *ConfirmationTracker) Poll(now time.Time) ([]PlanStatus, error) {
+	s := t.sweeper
+	var out []PlanStatus
+	for _, p := range s.PendingPlans() {
+		st := PlanStatus{ID: p.ID, FeeRate: p.PackageFeeRate, MempoolFeeRate: s.feeRate.SatPerVB(), Age: now.Sub(p.CreatedAt)}
+		if p.BroadcastAt != nil {
+			st.Age = now.Sub(*p.BroadcastAt)
+		}
+		if p.Status.Terminal() && p.Status != PlanConfirmed {
+			st.State = p.Status // Abandoned, replaced or conflicted: nothing to do
+			out = append(out, st)
+			continue
+		}
+		if p.BroadcastAt != nil && (p.ConfirmedAt == nil || p.Status == PlanConfirming) && t.src != nil {
+			n, err := t.src.Confirmations(p.ID)
+			if err != nil {
+				return nil, fmt.Errorf("confirmation lookup for plan %s failed: %w", p.ID, err)
+			}
+			if n > 0 && p.ConfirmedAt == nil {
+				if err := s.MarkConfirmed(p.ID, now); err != nil {
+					return nil, err
+				}
+			}
+			if err := s.observeConfirmations(p, n, now); err != nil {
+				return nil, err
+			}
+			st.Confirmations = n
+		}
+		switch {
+		case p.ConfirmedAt != nil:
+			st.State = PlanConfirmed
+			if st.Confirmations == 0 {
+				st.Confirmations = 1
+			}
+		case p.BroadcastAt != nil:
+			st.State = PlanPending
+			if t.mempool != nil {
+				if _, err := t.mempool.MempoolTx(p.ID); err != nil {
+					st.State = PlanDropped
+				}
+			}
+			switch {
+			case st.State == PlanDropped:
+				st.Action = "rebroadcast"
+			case st.FeeRate > 0 && st.FeeRate < st.MempoolFeeRate:
+				st.Action = "bump"
+			}
+		case p.SignedTx != nil:
+			st.State, st.Action = PlanSigned, "broadcast"
+		default:
+			st.State, st.Action = PlanUnsigned, "sign"
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// WritePlanStatusTable renders statuses as an aligned text table.
+func WritePlanStatusTable(w io.Writer, statuses []PlanStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAN\tSTATE\tCONFS\tFEE RATE\tMEMPOOL\tAGE\tACTION")
+	for _, st := range statuses {
+		action := st.Action
+		if action == "" {
+			action = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%.1f\t%s\t%s\n",
+			shortID(st.ID), st.State, st.Confirmations, st.FeeRate, st.MempoolFeeRate, st.Age.Truncate(time.Second), action)
+	}
+	return tw.Flush()
+}
+
+// Abbreviate a txid for display
+func shortID(id string) string {
+	if len(id) <= 16 {
+		return id
+	}
+	return id[:8] + ".." + id[len(id)-6:]
+}
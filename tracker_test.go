@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type confMap map[string]int
+
+func (c confMap) Confirmations(txid string) (int, error) { return c[txid], nil }
+
+// mempoolSet reports only the listed transactions as in the mempool
+type mempoolSet map[string]bool
+
+func (m mempoolSet) MempoolTx(txid string) (*MempoolTxInfo, error) {
+	if !m[txid] {
+		return nil, errors.New("not in mempool")
+	}
+	return &MempoolTxInfo{}, nil
+}
+
+func TestConfirmationTrackerStatesAndActions(t *testing.T) {
+	s := newTestSweeper(t)
+	var plans []*TransactionPlan
+	for _, c := range "abcd" {
+		_ = s.Index(UTXO{TxID: stringsRepeat(string(c), 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+		p, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+		if err != nil {
+			t.Fatalf("Spend: %v", err)
+		}
+		s.ClearIndex()
+		plans = append(plans, p)
+	}
+	now := time.Now()
+	plans[1].SignedTx = plans[1].RawTx
+	_ = s.MarkBroadcast(plans[2].ID, now)
+	_ = s.MarkBroadcast(plans[3].ID, now)
+	s.SetMempoolSource(mempoolSet{plans[2].ID: true})
+	_ = s.SetFeeRate(50) // Current rate above what the plans pay
+
+	tr := NewConfirmationTracker(s, confMap{})
+	sts, err := tr.Poll(now)
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	want := map[string][2]string{
+		plans[0].ID: {"unsigned", "sign"},
+		plans[1].ID: {"signed", "broadcast"},
+		plans[2].ID: {"pending", "bump"},
+		plans[3].ID: {"dropped", "rebroadcast"},
+	}
+	for _, st := range sts {
+		if w := want[st.ID]; string(st.State) != w[0] || st.Action != w[1] {
+			t.Fatalf("plan %s: got %s/%s, want %v", st.ID, st.State, st.Action, w)
+		}
+	}
+
+	tr = NewConfirmationTracker(s, confMap{plans[2].ID: 3})
+	if sts, err = tr.Poll(now); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if p, _ := s.GetPlan(plans[2].ID); p.ConfirmedAt == nil {
+		t.Fatalf("expected the mined plan to be marked confirmed")
+	}
+	var buf bytes.Buffer
+	if err := WritePlanStatusTable(&buf, sts); err != nil {
+		t.Fatalf("WritePlanStatusTable: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "confirmed") || !strings.Contains(out, "ACTION") {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+}
@@ -4,10 +4,13 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"sort"
 )
 
 // OutPoint represents a reference to a previous transaction output.
@@ -22,7 +25,7 @@ type OutPoint struct {
 type TxIn struct {
 	PreviousOutPoint OutPoint // Reference to the previous output being spent
 	SignatureScript  []byte   // Legacy signature script (empty for SegWit)
-	Witness          [][]byte // Witness data for SegWit transactions
+	Witness          [][]byte // Witness stack, item for item (annex and unknown items included)
 	Sequence         uint32   // Sequence number for RBF and time locks
 }
 
@@ -137,6 +140,21 @@ func (tx *MsgTx) TxHash() [32]byte {
 	return sha256Double(serialized)
 }
 
+// TxID returns the txid in the usual display form (byte-reversed hex).
+func (tx *MsgTx) TxID() string {
+	h := tx.TxHash()
+	return hashToStr(h)
+}
+
+// Format a double-SHA256 hash as display hex (reversed byte order)
+func hashToStr(h [32]byte) string {
+	var r [32]byte
+	for i := range h {
+		r[31-i] = h[i]
+	}
+	return hex.EncodeToString(r[:])
+}
+
 // WTxHash returns the wtxid (double SHA256 of witness-inclusive serialization).
 // For transactions without witness data, wtxid equals txid.
 func (tx *MsgTx) WTxHash() [32]byte {
@@ -144,15 +162,6 @@ func (tx *MsgTx) WTxHash() [32]byte {
 	return sha256Double(serialized)
 }
 
-// Double SHA256
-func sha256Double(data []byte) [32]byte {
-	first := sha256.Sum256(data)
-	second := sha256.Sum256(first[:])
-	return second
-}
-
-// removed unused helper
-
 // Write variable length integer
 func writeVarInt(w *bytes.Buffer, val uint64) {
 	if val < 0xfd {
@@ -169,7 +178,182 @@ func writeVarInt(w *bytes.Buffer, val uint64) {
 	}
 }
 
-// readVarInt function removed - was unused
+// Serialized size of a variable length integer
+func varIntSize(val uint64) int64 {
+	switch {
+	case val < 0xfd:
+		return 1
+	case val <= 0xffff:
+		return 3
+	case val <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
+
+// Serialized size of an output paying script: value, script length and script
+func outputSize(script []byte) int64 {
+	return 8 + varIntSize(uint64(len(script))) + int64(len(script))
+}
+
+// Read variable length integer
+func readVarInt(r *bytes.Reader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch b {
+	case 0xfd:
+		var v uint16
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xfe:
+		var v uint32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xff:
+		var v uint64
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return v, err
+	default:
+		return uint64(b), nil
+	}
+}
+
+// Read a varint-prefixed byte string, bounded by the remaining input
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, errors.New("length prefix exceeds remaining data")
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DeserializeMsgTx parses a raw transaction in either legacy or SegWit encoding.
+// It is the inverse of Serialize and rejects trailing bytes.
+func DeserializeMsgTx(data []byte) (*MsgTx, error) {
+	r := bytes.NewReader(data)
+	tx, err := readMsgTx(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing bytes after transaction")
+	}
+	return tx, nil
+}
+
+// Read a transaction from the reader
+func readMsgTx(r *bytes.Reader) (*MsgTx, error) {
+	tx := NewMsgTx(0)
+	if err := binary.Read(r, binary.LittleEndian, &tx.Version); err != nil {
+		return nil, fmt.Errorf("read version: %w", err)
+	}
+
+	nIn, err := readVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("read input count: %w", err)
+	}
+	segwit := false
+	if nIn == 0 {
+		// SegWit marker (0x00) must be followed by flag 0x01
+		flag, err := r.ReadByte()
+		if err != nil || flag != 0x01 {
+			return nil, errors.New("invalid segwit marker/flag")
+		}
+		segwit = true
+		if nIn, err = readVarInt(r); err != nil {
+			return nil, fmt.Errorf("read input count: %w", err)
+		}
+	}
+	// Each input takes at least 41 bytes
+	if nIn > uint64(r.Len()/41) {
+		return nil, errors.New("input count exceeds remaining data")
+	}
+	for i := uint64(0); i < nIn; i++ {
+		var in TxIn
+		if _, err := io.ReadFull(r, in.PreviousOutPoint.Hash[:]); err != nil {
+			return nil, fmt.Errorf("read input %d outpoint: %w", i, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.PreviousOutPoint.Index); err != nil {
+			return nil, fmt.Errorf("read input %d index: %w", i, err)
+		}
+		if in.SignatureScript, err = readVarBytes(r); err != nil {
+			return nil, fmt.Errorf("read input %d scriptSig: %w", i, err)
+		}
+		if len(in.SignatureScript) == 0 {
+			in.SignatureScript = nil
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.Sequence); err != nil {
+			return nil, fmt.Errorf("read input %d sequence: %w", i, err)
+		}
+		tx.AddTxIn(in)
+	}
+
+	nOut, err := readVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("read output count: %w", err)
+	}
+	// Each output takes at least 9 bytes
+	if nOut > uint64(r.Len()/9) {
+		return nil, errors.New("output count exceeds remaining data")
+	}
+	for i := uint64(0); i < nOut; i++ {
+		var out TxOut
+		if err := binary.Read(r, binary.LittleEndian, &out.Value); err != nil {
+			return nil, fmt.Errorf("read output %d value: %w", i, err)
+		}
+		if out.PkScript, err = readVarBytes(r); err != nil {
+			return nil, fmt.Errorf("read output %d script: %w", i, err)
+		}
+		tx.AddTxOut(out)
+	}
+
+	if segwit {
+		for i := range tx.TxIn {
+			stack, err := readWitness(r)
+			if err != nil {
+				return nil, fmt.Errorf("read input %d witness: %w", i, err)
+			}
+			tx.TxIn[i].Witness = stack
+		}
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &tx.LockTime); err != nil {
+		return nil, fmt.Errorf("read locktime: %w", err)
+	}
+	return tx, nil
+}
+
+// Read a witness stack (item count followed by varint-prefixed items)
+func readWitness(r *bytes.Reader) ([][]byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, errors.New("witness item count exceeds remaining data")
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	stack := make([][]byte, 0, n)
+	for j := uint64(0); j < n; j++ {
+		item, err := readVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, item)
+	}
+	return stack, nil
+}
 
 // PSBTInput represents a Partially Signed Bitcoin Transaction input.
 // It contains all the data needed to sign a specific input.
@@ -177,20 +361,31 @@ type PSBTInput struct {
 	NonWitnessUtxo     *MsgTx                      // Full previous transaction (for legacy inputs)
 	WitnessUtxo        *TxOut                      // Previous output (for SegWit inputs)
 	PartialSigs        map[string][]byte           // Partial signatures by public key
-	SighashType        uint32                      // Signature hash type
+	SighashType        uint32                      // Signature hash type (0 = not set)
 	RedeemScript       []byte                      // P2SH redeem script
 	WitnessScript      []byte                      // SegWit witness script
 	Bip32Derivation    map[string]*Bip32Derivation // BIP32 derivation paths
 	FinalScriptSig     []byte                      // Final signature script
 	FinalScriptWitness [][]byte                    // Final witness data
+	TapKeySig          []byte                      // Taproot key-path Schnorr signature
+	TapInternalKey     []byte                      // Taproot x-only internal key
+	TapBip32Derivation map[string]*Bip32Derivation // Key-path BIP32 derivations by x-only key
+	MuSig2Participants map[string][][]byte         // Participant keys by 33-byte aggregate key (BIP-373)
+	MuSig2PubNonces    map[string][]byte           // Public nonces by participant key || aggregate key
+	MuSig2PartialSigs  map[string][]byte           // Partial signatures by participant key || aggregate key
+	Unknown            map[string][]byte           // Unrecognized pairs by full key, kept on re-serialization
 }
 
 // PSBTOutput represents a Partially Signed Bitcoin Transaction output.
 // It contains metadata about how to spend the output.
 type PSBTOutput struct {
-	RedeemScript    []byte                      // P2SH redeem script
-	WitnessScript   []byte                      // SegWit witness script
-	Bip32Derivation map[string]*Bip32Derivation // BIP32 derivation paths
+	RedeemScript       []byte                      // P2SH redeem script
+	WitnessScript      []byte                      // SegWit witness script
+	Bip32Derivation    map[string]*Bip32Derivation // BIP32 derivation paths
+	TapInternalKey     []byte                      // Taproot x-only internal key
+	TapBip32Derivation map[string]*Bip32Derivation // Key-path BIP32 derivations by x-only key
+	MuSig2Participants map[string][][]byte         // Participant keys by 33-byte aggregate key (BIP-373)
+	Unknown            map[string][]byte           // Unrecognized pairs by full key, kept on re-serialization
 }
 
 // Bip32Derivation contains BIP32 derivation path information.
@@ -206,6 +401,10 @@ type PSBT struct {
 	UnsignedTx *MsgTx       // The unsigned transaction
 	Inputs     []PSBTInput  // Input metadata for signing
 	Outputs    []PSBTOutput // Output metadata
+
+	// Unrecognized global pairs by full key (xpubs, proprietary fields, ...),
+	// kept so PSBTs from other software pass through unchanged
+	Unknown map[string][]byte
 }
 
 // NewPSBTFromUnsignedTx creates a new PSBT from an unsigned transaction.
@@ -215,20 +414,29 @@ func NewPSBTFromUnsignedTx(tx *MsgTx) *PSBT {
 		UnsignedTx: tx,
 		Inputs:     make([]PSBTInput, len(tx.TxIn)),
 		Outputs:    make([]PSBTOutput, len(tx.TxOut)),
+		Unknown:    make(map[string][]byte),
 	}
 
 	// Initialize inputs
 	for i := range psbt.Inputs {
 		psbt.Inputs[i] = PSBTInput{
-			PartialSigs:     make(map[string][]byte),
-			Bip32Derivation: make(map[string]*Bip32Derivation),
+			PartialSigs:        make(map[string][]byte),
+			Bip32Derivation:    make(map[string]*Bip32Derivation),
+			TapBip32Derivation: make(map[string]*Bip32Derivation),
+			MuSig2Participants: make(map[string][][]byte),
+			MuSig2PubNonces:    make(map[string][]byte),
+			MuSig2PartialSigs:  make(map[string][]byte),
+			Unknown:            make(map[string][]byte),
 		}
 	}
 
 	// Initialize outputs
 	for i := range psbt.Outputs {
 		psbt.Outputs[i] = PSBTOutput{
-			Bip32Derivation: make(map[string]*Bip32Derivation),
+			Bip32Derivation:    make(map[string]*Bip32Derivation),
+			TapBip32Derivation: make(map[string]*Bip32Derivation),
+			MuSig2Participants: make(map[string][][]byte),
+			Unknown:            make(map[string][]byte),
 		}
 	}
 
@@ -252,12 +460,23 @@ func (psbt *PSBT) Serialize() []byte {
 		buf.Write(key)
 		writeVarInt(&buf, uint64(len(val)))
 		buf.Write(val)
+		writeUnknownPairs(&buf, psbt.Unknown)
 		// Separator
 		buf.WriteByte(0x00)
 	}
 
 	// ---- Input maps ----
 	for _, input := range psbt.Inputs {
+		// non_witness_utxo (type 0x00), the full previous transaction
+		if input.NonWitnessUtxo != nil {
+			key := []byte{0x00}
+			val := input.NonWitnessUtxo.Serialize(true)
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
 		// witness_utxo (type 0x01)
 		if input.WitnessUtxo != nil {
 			key := []byte{0x01}
@@ -268,6 +487,55 @@ func (psbt *PSBT) Serialize() []byte {
 			buf.Write(val)
 		}
 
+		// partial_sig (type 0x02), keyed by the signing public key
+		pubKeys := make([]string, 0, len(input.PartialSigs))
+		for pk := range input.PartialSigs {
+			pubKeys = append(pubKeys, pk)
+		}
+		sort.Strings(pubKeys)
+		for _, pk := range pubKeys {
+			key := append([]byte{0x02}, pk...)
+			val := input.PartialSigs[pk]
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// sighash_type (type 0x03), a 32-bit little-endian value
+		if input.SighashType != 0 {
+			key := []byte{0x03}
+			val := make([]byte, 4)
+			binary.LittleEndian.PutUint32(val, input.SighashType)
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// redeem_script (type 0x04)
+		if input.RedeemScript != nil {
+			key := []byte{0x04}
+			val := input.RedeemScript
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// witness_script (type 0x05)
+		if input.WitnessScript != nil {
+			key := []byte{0x05}
+			val := input.WitnessScript
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// bip32_derivation (type 0x06), keyed by public key
+		writeBip32Derivations(&buf, 0x06, input.Bip32Derivation)
+
 		// final_script_sig (type 0x07)
 		if input.FinalScriptSig != nil {
 			key := []byte{0x07}
@@ -288,6 +556,35 @@ func (psbt *PSBT) Serialize() []byte {
 			buf.Write(val)
 		}
 
+		// tap_key_sig (type 0x13)
+		if len(input.TapKeySig) > 0 {
+			key := []byte{0x13}
+			val := input.TapKeySig
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// tap_bip32_derivation (type 0x16), keyed by x-only key
+		writeTapBip32Derivations(&buf, 0x16, input.TapBip32Derivation)
+
+		// tap_internal_key (type 0x17)
+		if len(input.TapInternalKey) > 0 {
+			key := []byte{0x17}
+			val := input.TapInternalKey
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// musig2_participant_pubkeys (0x1a), pub_nonce (0x1b), partial_sig (0x1c)
+		writeMuSig2Participants(&buf, 0x1a, input.MuSig2Participants)
+		writeKeyedValues(&buf, 0x1b, input.MuSig2PubNonces)
+		writeKeyedValues(&buf, 0x1c, input.MuSig2PartialSigs)
+		writeUnknownPairs(&buf, input.Unknown)
+
 		// Separator for input map
 		buf.WriteByte(0x00)
 	}
@@ -314,6 +611,26 @@ func (psbt *PSBT) Serialize() []byte {
 			buf.Write(val)
 		}
 
+		// bip32_derivation (type 0x02), keyed by public key
+		writeBip32Derivations(&buf, 0x02, output.Bip32Derivation)
+
+		// tap_internal_key (type 0x05)
+		if len(output.TapInternalKey) > 0 {
+			key := []byte{0x05}
+			val := output.TapInternalKey
+			writeVarInt(&buf, uint64(len(key)))
+			buf.Write(key)
+			writeVarInt(&buf, uint64(len(val)))
+			buf.Write(val)
+		}
+
+		// tap_bip32_derivation (type 0x07), keyed by x-only key
+		writeTapBip32Derivations(&buf, 0x07, output.TapBip32Derivation)
+
+		// musig2_participant_pubkeys (type 0x08)
+		writeMuSig2Participants(&buf, 0x08, output.MuSig2Participants)
+		writeUnknownPairs(&buf, output.Unknown)
+
 		// Separator for output map
 		buf.WriteByte(0x00)
 	}
@@ -321,6 +638,117 @@ func (psbt *PSBT) Serialize() []byte {
 	return buf.Bytes()
 }
 
+// Write BIP-32 derivation pairs sorted by public key: the value is the master
+// fingerprint followed by the little-endian path indices
+func writeBip32Derivations(buf *bytes.Buffer, keyType byte, derivs map[string]*Bip32Derivation) {
+	pubKeys := make([]string, 0, len(derivs))
+	for pk := range derivs {
+		pubKeys = append(pubKeys, pk)
+	}
+	sort.Strings(pubKeys)
+	for _, pk := range pubKeys {
+		d := derivs[pk]
+		key := append([]byte{keyType}, pk...)
+		val := append([]byte{}, d.MasterFingerprint[:]...)
+		for _, i := range d.Path {
+			val = binary.LittleEndian.AppendUint32(val, i)
+		}
+		writeVarInt(buf, uint64(len(key)))
+		buf.Write(key)
+		writeVarInt(buf, uint64(len(val)))
+		buf.Write(val)
+	}
+}
+
+// Write key-path taproot derivations: no leaf hashes, then the BIP-32 derivation
+func writeTapBip32Derivations(buf *bytes.Buffer, keyType byte, derivs map[string]*Bip32Derivation) {
+	vals := make(map[string][]byte, len(derivs))
+	for pk, d := range derivs {
+		val := append([]byte{0x00}, d.MasterFingerprint[:]...)
+		for _, i := range d.Path {
+			val = binary.LittleEndian.AppendUint32(val, i)
+		}
+		vals[pk] = val
+	}
+	writeKeyedValues(buf, keyType, vals)
+}
+
+// Parse a tap_bip32_derivation value, skipping its leaf hashes
+func parseTapBip32Derivation(val []byte) (*Bip32Derivation, error) {
+	r := bytes.NewReader(val)
+	n, err := readVarInt(r)
+	if err != nil || n > uint64(r.Len())/32 {
+		return nil, errors.New("invalid tap bip32 derivation")
+	}
+	return parseBip32Derivation(val[len(val)-r.Len()+int(n)*32:])
+}
+
+// Write MuSig2 participant lists keyed by aggregate key; the value is the
+// concatenated 33-byte participant keys
+func writeMuSig2Participants(buf *bytes.Buffer, keyType byte, parts map[string][][]byte) {
+	vals := make(map[string][]byte, len(parts))
+	for agg, pks := range parts {
+		vals[agg] = bytes.Join(pks, nil)
+	}
+	writeKeyedValues(buf, keyType, vals)
+}
+
+// Write key-value pairs sorted by key data
+func writeKeyedValues(buf *bytes.Buffer, keyType byte, vals map[string][]byte) {
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := append([]byte{keyType}, k...)
+		writeVarInt(buf, uint64(len(key)))
+		buf.Write(key)
+		writeVarInt(buf, uint64(len(vals[k])))
+		buf.Write(vals[k])
+	}
+}
+
+// Write pairs this library does not interpret, sorted by full key
+func writeUnknownPairs(buf *bytes.Buffer, pairs map[string][]byte) {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeVarInt(buf, uint64(len(k)))
+		buf.WriteString(k)
+		writeVarInt(buf, uint64(len(pairs[k])))
+		buf.Write(pairs[k])
+	}
+}
+
+// Parse a MuSig2 participant list: 33-byte aggregate key, concatenated 33-byte participants
+func parseMuSig2Participants(keyData, val []byte) ([][]byte, error) {
+	if len(keyData) != 33 || len(val) == 0 || len(val)%33 != 0 {
+		return nil, errors.New("invalid musig2 participant pubkeys")
+	}
+	var pks [][]byte
+	for i := 0; i < len(val); i += 33 {
+		pks = append(pks, val[i:i+33])
+	}
+	return pks, nil
+}
+
+// Parse a BIP-32 derivation value
+func parseBip32Derivation(val []byte) (*Bip32Derivation, error) {
+	if len(val) < 4 || len(val)%4 != 0 {
+		return nil, errors.New("invalid bip32 derivation length")
+	}
+	d := &Bip32Derivation{}
+	copy(d.MasterFingerprint[:], val[:4])
+	for i := 4; i < len(val); i += 4 {
+		d.Path = append(d.Path, binary.LittleEndian.Uint32(val[i:]))
+	}
+	return d, nil
+}
+
 // Serialize transaction output
 func serializeTxOut(txout *TxOut) []byte {
 	var buf bytes.Buffer
@@ -354,22 +782,228 @@ func (psbt *PSBT) B64Encode() (string, error) {
 // Simple base64 encoding
 func base64Encode(data []byte) string { return base64.StdEncoding.EncodeToString(data) }
 
+// DecodePSBTB64 parses a base64-encoded PSBT as produced by B64Encode or an external signer.
+func DecodePSBTB64(s string) (*PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PSBT base64: %w", err)
+	}
+	return ParsePSBT(data)
+}
+
+// ParsePSBT parses a binary BIP-174 PSBT. Fields this library does not use
+// (taproot script-path data, xpubs, proprietary and future fields) land in the
+// Unknown maps and are written back by Serialize, so a PSBT from other
+// software survives a round trip through the sweeper.
+func ParsePSBT(data []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(data, []byte("psbt\xff")) {
+		return nil, errors.New("missing PSBT magic")
+	}
+	r := bytes.NewReader(data[5:])
+
+	// ---- Global map ----
+	var unsigned *MsgTx
+	globals := map[string][]byte{}
+	err := readPSBTMap(r, func(key, val []byte) error {
+		if len(key) != 1 || key[0] != 0x00 {
+			globals[string(key)] = val
+			return nil
+		}
+		tx, err := DeserializeMsgTx(val)
+		if err != nil {
+			return fmt.Errorf("unsigned tx: %w", err)
+		}
+		unsigned = tx
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("global map: %w", err)
+	}
+	if unsigned == nil {
+		return nil, errors.New("PSBT has no unsigned transaction")
+	}
+	psbt := NewPSBTFromUnsignedTx(unsigned)
+	psbt.Unknown = globals
+
+	// ---- Input maps ----
+	for i := range psbt.Inputs {
+		in := &psbt.Inputs[i]
+		err := readPSBTMap(r, func(key, val []byte) error {
+			switch key[0] {
+			case 0x00:
+				tx, err := DeserializeMsgTx(val)
+				if err != nil {
+					return fmt.Errorf("non_witness_utxo: %w", err)
+				}
+				in.NonWitnessUtxo = tx
+			case 0x01:
+				out, err := deserializeTxOut(val)
+				if err != nil {
+					return fmt.Errorf("witness_utxo: %w", err)
+				}
+				in.WitnessUtxo = out
+			case 0x02:
+				in.PartialSigs[string(key[1:])] = val
+			case 0x03:
+				if len(val) != 4 {
+					return errors.New("invalid sighash type length")
+				}
+				in.SighashType = binary.LittleEndian.Uint32(val)
+			case 0x04:
+				in.RedeemScript = val
+			case 0x05:
+				in.WitnessScript = val
+			case 0x06:
+				d, err := parseBip32Derivation(val)
+				if err != nil {
+					return err
+				}
+				in.Bip32Derivation[string(key[1:])] = d
+			case 0x07:
+				in.FinalScriptSig = val
+			case 0x08:
+				stack, err := readWitness(bytes.NewReader(val))
+				if err != nil {
+					return fmt.Errorf("final_script_witness: %w", err)
+				}
+				in.FinalScriptWitness = stack
+			case 0x13:
+				in.TapKeySig = val
+			case 0x16:
+				d, err := parseTapBip32Derivation(val)
+				if err != nil {
+					return err
+				}
+				in.TapBip32Derivation[string(key[1:])] = d
+			case 0x17:
+				in.TapInternalKey = val
+			case 0x1a:
+				pks, err := parseMuSig2Participants(key[1:], val)
+				if err != nil {
+					return err
+				}
+				in.MuSig2Participants[string(key[1:])] = pks
+			case 0x1b:
+				if (len(key) != 67 && len(key) != 99) || len(val) != 66 {
+					return errors.New("invalid musig2 public nonce")
+				}
+				if len(key) == 67 { // Key path only; script-path entries carry a leaf hash
+					in.MuSig2PubNonces[string(key[1:])] = val
+				} else {
+					in.Unknown[string(key)] = val
+				}
+			case 0x1c:
+				if (len(key) != 67 && len(key) != 99) || len(val) != 32 {
+					return errors.New("invalid musig2 partial signature")
+				}
+				if len(key) == 67 { // Key path only; script-path entries carry a leaf hash
+					in.MuSig2PartialSigs[string(key[1:])] = val
+				} else {
+					in.Unknown[string(key)] = val
+				}
+			default:
+				in.Unknown[string(key)] = val
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+
+	// ---- Output maps ----
+	for i := range psbt.Outputs {
+		out := &psbt.Outputs[i]
+		err := readPSBTMap(r, func(key, val []byte) error {
+			switch key[0] {
+			case 0x00:
+				out.RedeemScript = val
+			case 0x01:
+				out.WitnessScript = val
+			case 0x02:
+				d, err := parseBip32Derivation(val)
+				if err != nil {
+					return err
+				}
+				out.Bip32Derivation[string(key[1:])] = d
+			case 0x05:
+				out.TapInternalKey = val
+			case 0x07:
+				d, err := parseTapBip32Derivation(val)
+				if err != nil {
+					return err
+				}
+				out.TapBip32Derivation[string(key[1:])] = d
+			case 0x08:
+				pks, err := parseMuSig2Participants(key[1:], val)
+				if err != nil {
+					return err
+				}
+				out.MuSig2Participants[string(key[1:])] = pks
+			default:
+				out.Unknown[string(key)] = val
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+
+	return psbt, nil
+}
+
+// Read one PSBT key-value map up to its 0x00 separator, invoking fn per pair
+func readPSBTMap(r *bytes.Reader, fn func(key, val []byte) error) error {
+	for {
+		key, err := readVarBytes(r)
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return nil // separator
+		}
+		val, err := readVarBytes(r)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+}
+
+// Deserialize transaction output
+func deserializeTxOut(data []byte) (*TxOut, error) {
+	r := bytes.NewReader(data)
+	var out TxOut
+	if err := binary.Read(r, binary.LittleEndian, &out.Value); err != nil {
+		return nil, err
+	}
+	script, err := readVarBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	out.PkScript = script
+	return &out, nil
+}
+
 // removed unused helper
 
-// Create outpoint from string hash and index
+// Create outpoint from a display-order txid hex string and index
 func NewOutPointFromStr(hashStr string, index uint32) (OutPoint, error) {
 	var hash [32]byte
 	if len(hashStr) != 64 {
 		return OutPoint{}, errors.New("invalid hash length")
 	}
 
-	// Convert hex string to bytes
+	// Convert display hex to internal byte order (reversed)
 	for i := 0; i < 32; i++ {
 		val, err := hexToByte(hashStr[i*2 : i*2+2])
 		if err != nil {
 			return OutPoint{}, err
 		}
-		hash[i] = val
+		hash[31-i] = val
 	}
 
 	return OutPoint{Hash: hash, Index: index}, nil
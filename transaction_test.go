@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// A taproot script-path spend with an annex and an empty stack item
+func annexTx() *MsgTx {
+	tx := NewMsgTx(2)
+	control := append([]byte{0xc0}, bytes.Repeat([]byte{0x02}, 32)...)
+	sig := bytes.Repeat([]byte{0xaa}, 64)
+	witness := [][]byte{sig, {}, {0x20, 0x51}, control, {0x50, 0xde, 0xad}}
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{1}, Index: 0}, Sequence: 0xfffffffd, Witness: witness})
+	tx.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Hash: [32]byte{2}, Index: 1}, Sequence: 0xfffffffd})
+	tx.AddTxOut(TxOut{Value: 50_000, PkScript: append([]byte{0x52, 0x20}, bytes.Repeat([]byte{0x03}, 32)...)}) // Witness v2
+	return tx
+}
+
+func TestTxRoundTripKeepsAnnexAndUnknownWitness(t *testing.T) {
+	raw := annexTx().Serialize(true)
+	tx, err := DeserializeMsgTx(raw)
+	if err != nil {
+		t.Fatalf("DeserializeMsgTx: %v", err)
+	}
+	if got := tx.Serialize(true); !bytes.Equal(got, raw) {
+		t.Fatalf("re-serialization changed the transaction")
+	}
+	w := tx.TxIn[0].Witness
+	if len(w) != 5 || len(w[1]) != 0 || w[4][0] != 0x50 || len(tx.TxIn[1].Witness) != 0 {
+		t.Fatalf("witness not preserved: %x", w)
+	}
+}
+
+func TestPSBTRoundTripKeepsUnknownFields(t *testing.T) {
+	tx := annexTx()
+	unsigned := annexTx()
+	for i := range unsigned.TxIn {
+		unsigned.TxIn[i].Witness = nil
+	}
+	p := NewPSBTFromUnsignedTx(unsigned)
+	// Global xpub and proprietary pairs, a tap leaf script, a script-path
+	// MuSig2 nonce and an output tap tree, none of which the sweeper reads
+	p.Unknown["\x01xpub-key-data"] = []byte{0, 1, 2, 3}
+	p.Unknown["\xfc\x05vendor"] = []byte("opaque")
+	p.Inputs[0].FinalScriptWitness = tx.TxIn[0].Witness
+	p.Inputs[1].SighashType = sighashAll | sighashAnyoneCanPay
+	p.Inputs[1].RedeemScript = []byte{0x00, 0x14, 0x01, 0x02}
+	p.Inputs[0].Unknown["\x15"+string(bytes.Repeat([]byte{7}, 33))] = []byte{0x20, 0x51, 0xc0}
+	p.Inputs[1].Unknown["\x1b"+string(bytes.Repeat([]byte{8}, 98))] = bytes.Repeat([]byte{9}, 66)
+	p.Outputs[0].Unknown["\x06"] = []byte{0x00, 0xc0, 0x01, 0x51}
+
+	raw := p.Serialize()
+	q, err := ParsePSBT(raw)
+	if err != nil {
+		t.Fatalf("ParsePSBT: %v", err)
+	}
+	if !bytes.Equal(q.Serialize(), raw) {
+		t.Fatalf("re-serialization dropped or changed fields")
+	}
+	if len(q.Unknown) != 2 || len(q.Inputs[0].Unknown) != 1 || len(q.Inputs[1].Unknown) != 1 || len(q.Outputs[0].Unknown) != 1 {
+		t.Fatalf("unknown fields not kept: %d %d %d %d", len(q.Unknown), len(q.Inputs[0].Unknown), len(q.Inputs[1].Unknown), len(q.Outputs[0].Unknown))
+	}
+	if w := q.Inputs[0].FinalScriptWitness; len(w) != 5 || w[4][0] != 0x50 {
+		t.Fatalf("final witness lost its annex: %x", w)
+	}
+	if in := q.Inputs[1]; in.SighashType != sighashAll|sighashAnyoneCanPay || !bytes.Equal(in.RedeemScript, []byte{0x00, 0x14, 0x01, 0x02}) {
+		t.Fatalf("sighash type or redeem script lost: %#x %x", in.SighashType, in.RedeemScript)
+	}
+}
@@ -0,0 +1,118 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the transaction version setting and the TRUC (v3)
+// topology rules of BIP-431.
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TRUC (BIP-431) limits
+const (
+	trucVersion       = 3
+	trucMaxVSize      = 10_000 // Any TRUC transaction
+	trucChildMaxVSize = 1_000  // A TRUC transaction with an unconfirmed parent
+)
+
+// SetTxVersion sets the nVersion of planned transactions: 1, 2 (default) or 3.
+// Version 3 opts into TRUC relay policy (BIP-431), which keeps packages small
+// so CPFP stays reliable; plans that would break its rules are refused.
+func (s *Sweeper) SetTxVersion(v int32) error {
+	if err := validateTxVersion(v); err != nil {
+		return err
+	}
+	s.txVersion = v
+	return nil
+}
+
+func validateTxVersion(v int32) error {
+	if v < 1 || v > trucVersion {
+		return fmt.Errorf("transaction version must be 1, 2 or 3 (got %d)", v)
+	}
+	return nil
+}
+
+// Enforce the TRUC package rules for a transaction of vsize spending inputs
+func (s *Sweeper) checkTxVersionRules(inputs []UTXO, vsize int64) error {
+	seen := map[string]bool{}
+	var parents []string
+	for _, u := range inputs {
+		if !u.Confirmed && !seen[u.TxID] {
+			seen[u.TxID] = true
+			parents = append(parents, u.TxID)
+		}
+	}
+	sort.Strings(parents)
+
+	if s.txVersion != trucVersion {
+		// Unconfirmed TRUC outputs may only be spent by TRUC transactions
+		for _, txid := range parents {
+			if v, _, err := s.parentTxInfo(txid); err == nil && v == trucVersion {
+				return fmt.Errorf("unconfirmed parent %s is a v3 (TRUC) transaction - only v3 transactions may spend it", txid)
+			}
+		}
+		return nil
+	}
+
+	if vsize > trucMaxVSize {
+		return fmt.Errorf("v3 (TRUC) transactions are limited to %d vB (estimated %d) - spend fewer inputs or use version 2", trucMaxVSize, vsize)
+	}
+	if len(parents) > 1 {
+		return fmt.Errorf("a v3 (TRUC) transaction may have only one unconfirmed parent (spends %d)", len(parents))
+	}
+	for _, txid := range parents {
+		v, ancestors, err := s.parentTxInfo(txid)
+		if err != nil {
+			return err
+		}
+		if v != trucVersion {
+			return fmt.Errorf("a v3 (TRUC) transaction may only spend unconfirmed v3 outputs; parent %s is version %d", txid, v)
+		}
+		if ancestors > 0 {
+			return fmt.Errorf("unconfirmed parent %s has unconfirmed ancestors of its own - TRUC packages are limited to parent and child", txid)
+		}
+		if vsize > trucChildMaxVSize {
+			return fmt.Errorf("a v3 (TRUC) child is limited to %d vB (estimated %d)", trucChildMaxVSize, vsize)
+		}
+		if id := s.pendingChildOf(txid); id != "" {
+			return fmt.Errorf("unconfirmed parent %s already has a pending child (plan %s) - TRUC allows only one", txid, id)
+		}
+	}
+	return nil
+}
+
+// Version and unconfirmed-ancestor count of an unconfirmed parent, from the
+// mempool source when it reports versions, otherwise from our own plans
+func (s *Sweeper) parentTxInfo(txid string) (int32, int, error) {
+	if s.mempool != nil {
+		if info, err := s.mempool.MempoolTx(txid); err == nil && info.Version != 0 {
+			return info.Version, info.UnconfirmedAncestors, nil
+		}
+	}
+	if p, ok := s.plans[txid]; ok {
+		anc := map[string]bool{}
+		for _, in := range p.Inputs {
+			if !in.Confirmed {
+				anc[in.TxID] = true
+			}
+		}
+		return p.RawTx.Version, len(anc), nil
+	}
+	return 0, 0, fmt.Errorf("version of unconfirmed parent %s is unknown - set a mempool source that reports transaction versions", txid)
+}
+
+// ID of an unconfirmed plan spending an output of txid, if any
+func (s *Sweeper) pendingChildOf(txid string) string {
+	for id, p := range s.plans {
+		if !p.inFlight() {
+			continue
+		}
+		for _, in := range p.Inputs {
+			if in.TxID == txid {
+				return id
+			}
+		}
+	}
+	return ""
+}
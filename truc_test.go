@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestTRUCPackageRules(t *testing.T) {
+	s := newTestSweeper(t, WithTxVersion(3), WithUnconfirmedPolicy(true, 5, 5))
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	parent, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend parent: %v", err)
+	}
+	if parent.RawTx.Version != 3 || parent.Settings.TxVersion != 3 {
+		t.Fatalf("expected a v3 transaction")
+	}
+
+	// One child of the v3 parent is fine, a second is not
+	s.ClearIndex()
+	for _, u := range parent.ChangeUTXOs() {
+		if err := s.Index(u); err != nil {
+			t.Fatalf("Index change: %v", err)
+		}
+	}
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 40_000}}); err != nil {
+		t.Fatalf("Spend child: %v", err)
+	}
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}}); err == nil {
+		t.Fatalf("expected a second child of a TRUC parent to be refused")
+	}
+
+	// A v2 transaction may not spend unconfirmed v3 outputs
+	_ = s.SetTxVersion(2)
+	if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 30_000}}); err == nil {
+		t.Fatalf("expected a v2 spend of a v3 parent to be refused")
+	}
+	if err := s.SetTxVersion(4); err == nil {
+		t.Fatalf("expected version 4 to be rejected")
+	}
+}
@@ -0,0 +1,206 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains time-weighted price smoothing for fiat dust thresholds.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultDustPriceWindow is the smoothing window SetDustPriceSmoothing uses
+// when given zero.
+const defaultDustPriceWindow = 24 * time.Hour
+
+// defaultPriceRefresh is how often SetDustPriceProvider samples by default.
+const defaultPriceRefresh = time.Hour
+
+// PriceSample is one price observation kept for smoothing.
+type PriceSample struct {
+	At    time.Time `json:"at"`
+	Price float64   `json:"price"`
+}
+
+// SetDustPriceSmoothing makes UpdateDustPrice convert the fiat dust threshold
+// at the time-weighted average price over window (0 = 24 hours) instead of
+// the spot price, so a brief spike does not reclassify many coins at once.
+// Samples are kept in the KV store and survive restarts. A negative window
+// turns smoothing off.
+func (s *Sweeper) SetDustPriceSmoothing(window time.Duration) {
+	if window == 0 {
+		window = defaultDustPriceWindow
+	}
+	if window < 0 {
+		window = 0
+	}
+	s.dustPriceWindow = window
+}
+
+// UpdateDustPrice asks provider for the BTC price in the fiat currency at
+// now, records it and sets the dust policy's price to the time-weighted
+// average (or the spot price without smoothing). The dust policy must be a
+// FixedDustPolicy (USD) or a FiatDustPolicy in the Sweeper's fiat currency.
+// It returns the price applied.
+func (s *Sweeper) UpdateDustPrice(provider PriceProvider, now time.Time) (float64, error) {
+	if provider == nil {
+		return 0, errors.New("no price provider given")
+	}
+	cur := s.FiatCurrency()
+	switch p := s.dustPolicy.(type) {
+	case FixedDustPolicy:
+		if cur != "USD" {
+			return 0, fmt.Errorf("the USD dust policy cannot use %s prices - use a FiatDustPolicy", cur)
+		}
+	case FiatDustPolicy:
+		if c, _ := normalizeCurrency(p.Currency); c != cur {
+			return 0, fmt.Errorf("dust policy is in %s but the fiat currency is %s", c, cur)
+		}
+	default:
+		return 0, fmt.Errorf("dust policy %T has no fiat price to update", s.dustPolicy)
+	}
+	spot, err := priceIn(provider, cur, now)
+	if err != nil {
+		return 0, fmt.Errorf("price provider failed: %w", err)
+	}
+	if spot <= 0 {
+		return 0, fmt.Errorf("price provider returned a non-positive %s price (%f)", cur, spot)
+	}
+
+	price := spot
+	if s.dustPriceWindow > 0 {
+		samples, err := s.loadPriceSamples(cur)
+		if err != nil {
+			return 0, err
+		}
+		samples = append(samples, PriceSample{At: now.UTC(), Price: spot})
+		samples = prunePriceSamples(samples, now, s.dustPriceWindow)
+		if err := s.savePriceSamples(cur, samples); err != nil {
+			return 0, err
+		}
+		price = twap(samples, now, s.dustPriceWindow)
+	}
+
+	switch p := s.dustPolicy.(type) {
+	case FixedDustPolicy:
+		p.PriceUSDPerBTC = price
+		s.dustPolicy = p
+	case FiatDustPolicy:
+		p.PricePerBTC = price
+		s.dustPolicy = p
+	}
+	if price != spot {
+		s.logger.Printf("dust price: %s spot %.2f, %s average %.2f", cur, spot, s.dustPriceWindow, price)
+	}
+	return price, nil
+}
+
+// DustPriceSamples returns the recorded price samples for the fiat currency,
+// oldest first.
+func (s *Sweeper) DustPriceSamples() ([]PriceSample, error) {
+	return s.loadPriceSamples(s.FiatCurrency())
+}
+
+// SetDustPriceProvider makes planning sample provider for the dust price
+// through UpdateDustPrice at most once every every (0 = 1 hour), so the
+// smoothing window fills with live prices; a Scheduler also samples between
+// runs. When the provider fails, the last price is kept and the failure
+// logged. nil restores the static price.
+func (s *Sweeper) SetDustPriceProvider(provider PriceProvider, every time.Duration) error {
+	if every < 0 {
+		return fmt.Errorf("price refresh interval must be non-negative (got %s)", every)
+	}
+	if provider != nil && s.offline {
+		return errors.New("offline mode cannot consult a price provider - set the price instead")
+	}
+	if every == 0 {
+		every = defaultPriceRefresh
+	}
+	s.priceProvider, s.priceEvery, s.priceSampled = provider, every, time.Time{}
+	return nil
+}
+
+// Sample the dust price from the provider, if one is set and a sample is due
+func (s *Sweeper) refreshDustPrice(now time.Time) {
+	if s.priceProvider == nil || (!s.priceSampled.IsZero() && now.Sub(s.priceSampled) < s.priceEvery) {
+		return
+	}
+	s.priceSampled = now
+	if _, err := s.UpdateDustPrice(s.priceProvider, now); err != nil {
+		s.logger.Printf("dust price provider: %v - keeping the last price", err)
+	}
+}
+
+// KV key of the price samples for a currency
+func priceSamplesKey(cur string) []byte {
+	return []byte("price:samples:" + cur)
+}
+
+// Load price samples from the KV store; samples that cannot be read or
+// decoded are an error rather than a fresh start, which would let one spot
+// price decide the threshold
+func (s *Sweeper) loadPriceSamples(cur string) ([]PriceSample, error) {
+	b, err := s.kv.Get(priceSamplesKey(cur))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s price samples: %w", cur, err)
+	}
+	var samples []PriceSample
+	if err := json.Unmarshal(b, &samples); err != nil {
+		return nil, fmt.Errorf("corrupt %s price samples: %w", cur, err)
+	}
+	return samples, nil
+}
+
+// Persist price samples
+func (s *Sweeper) savePriceSamples(cur string, samples []PriceSample) error {
+	b, err := json.Marshal(samples)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(priceSamplesKey(cur), b)
+}
+
+// Sort samples by time and drop those older than the window, keeping the
+// last one before it: its price still holds at the window's start
+func prunePriceSamples(samples []PriceSample, now time.Time, window time.Duration) []PriceSample {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].At.Before(samples[j].At) })
+	start := now.Add(-window)
+	keep := 0
+	for i, smp := range samples {
+		if !smp.At.After(start) {
+			keep = i
+		}
+	}
+	return samples[keep:]
+}
+
+// Time-weighted average of sorted samples over (now-window, now]. Each price
+// holds until the next sample; time before the first sample is not counted.
+func twap(samples []PriceSample, now time.Time, window time.Duration) float64 {
+	start := now.Add(-window)
+	var sum, total float64
+	for i, smp := range samples {
+		from, to := smp.At, now
+		if i+1 < len(samples) {
+			to = samples[i+1].At
+		}
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(now) {
+			to = now
+		}
+		if d := to.Sub(from).Seconds(); d > 0 {
+			sum += smp.Price * d
+			total += d
+		}
+	}
+	if total == 0 {
+		return samples[len(samples)-1].Price
+	}
+	return sum / total
+}
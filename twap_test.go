@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Prices observed at given times
+type priceSeries map[time.Time]float64
+
+func (p priceSeries) PriceUSD(at time.Time) (float64, error) { return p[at], nil }
+
+func TestDustPriceSmoothing(t *testing.T) {
+	kv := NewMemKV()
+	t0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	prices := priceSeries{t0: 50_000, t0.Add(12 * time.Hour): 50_000, t0.Add(24 * time.Hour): 200_000, t0.Add(25 * time.Hour): 200_000}
+
+	s := newTestSweeper(t, WithKV(kv))
+	s.SetDustPriceSmoothing(0)
+	for _, h := range []time.Duration{0, 12, 24} {
+		if _, err := s.UpdateDustPrice(prices, t0.Add(h*time.Hour)); err != nil {
+			t.Fatalf("UpdateDustPrice: %v", err)
+		}
+	}
+	// The spike has not lasted yet, so the threshold stays at the 50k level
+	if got, want := s.dustPolicy.MinForScript(P2WPKH), dustFromUSD(0.5, 50_000); got != want {
+		t.Fatalf("dust threshold %d after a momentary spike, want %d", got, want)
+	}
+
+	// Samples survive a restart; an hour of 200k moves the average a little
+	s2 := newTestSweeper(t, WithKV(kv))
+	s2.SetDustPriceSmoothing(24 * time.Hour)
+	price, err := s2.UpdateDustPrice(prices, t0.Add(25*time.Hour))
+	if err != nil || math.Abs(price-56_250) > 0.01 {
+		t.Fatalf("average %.2f, %v; want 56250", price, err)
+	}
+	if samples, err := s2.DustPriceSamples(); err != nil || len(samples) != 4 {
+		t.Fatalf("expected the sample before the window to be kept, have %d, %v", len(samples), err)
+	}
+
+	// Without smoothing the spot price applies at once
+	s3 := newTestSweeper(t)
+	if price, _ := s3.UpdateDustPrice(prices, t0.Add(24*time.Hour)); price != 200_000 || s3.dustPolicy.MinForScript(P2WPKH) != 600 {
+		t.Fatalf("spot price %.0f, threshold %d", price, s3.dustPolicy.MinForScript(P2WPKH))
+	}
+	_ = s3.SetDustPolicy(RelayDustPolicy{})
+	if _, err := s3.UpdateDustPrice(prices, t0); err == nil {
+		t.Fatalf("expected the relay dust policy to have no price to update")
+	}
+}
+
+func TestCorruptDustPriceSamples(t *testing.T) {
+	kv := NewMemKV()
+	s := newTestSweeper(t, WithKV(kv))
+	s.SetDustPriceSmoothing(0)
+	_ = kv.Put(priceSamplesKey("USD"), []byte("[{\"at\":"))
+	if _, err := s.UpdateDustPrice(StaticPrice(60_000), time.Now()); err == nil || !strings.Contains(err.Error(), "corrupt USD price samples") {
+		t.Fatalf("expected corrupt samples to be reported, got %v", err)
+	}
+	if b, _ := kv.Get(priceSamplesKey("USD")); string(b) != "[{\"at\":" {
+		t.Fatalf("corrupt samples overwritten: %s", b)
+	}
+	if _, err := s.DustPriceSamples(); err == nil {
+		t.Fatalf("expected DustPriceSamples to report corrupt samples")
+	}
+	s2 := newTestSweeper(t, WithKV(failingGetKV{kv}))
+	s2.SetDustPriceSmoothing(0)
+	if _, err := s2.UpdateDustPrice(StaticPrice(60_000), time.Now()); err == nil || !strings.Contains(err.Error(), "disk error") {
+		t.Fatalf("expected the read failure to be reported, got %v", err)
+	}
+}
+
+func TestDustPriceProvider(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/api/v1/prices" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"time": 1717200000, "USD": 100000, "EUR": 92000}`))
+	}))
+	defer srv.Close()
+	p, err := NewMempoolPriceProvider(srv.URL + "/api")
+	if err != nil {
+		t.Fatalf("NewMempoolPriceProvider: %v", err)
+	}
+	if eur, err := p.PriceIn("eur", time.Time{}); err != nil || eur != 92_000 {
+		t.Fatalf("PriceIn(EUR) = %v, %v", eur, err)
+	}
+	if _, err := p.PriceIn("SEK", time.Time{}); err == nil {
+		t.Fatalf("expected a missing currency to be reported")
+	}
+
+	// Planning samples the provider, at most once per interval
+	s := newTestSweeper(t)
+	if err := s.SetDustPriceProvider(p, time.Hour); err != nil {
+		t.Fatalf("SetDustPriceProvider: %v", err)
+	}
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 500_000, Address: testAddr("in"), Confirmed: true})
+	atomic.StoreInt32(&calls, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}}); err != nil {
+			t.Fatalf("Spend: %v", err)
+		}
+	}
+	if f, _ := s.dustPolicy.(FixedDustPolicy); f.PriceUSDPerBTC != 100_000 || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("dust price %.0f after %d requests, want 100000 after 1", f.PriceUSDPerBTC, calls)
+	}
+
+	// The daemon's scheduler samples between runs once the interval passes
+	sc, _ := NewScheduler(s, nil)
+	sc.Tick(time.Now().Add(2*time.Hour), 0)
+	sc.Wait()
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected the scheduler to sample the price, got %d requests", calls)
+	}
+
+	// The config wires the provider and refuses smoothing without one
+	c := DefaultConfig()
+	c.DustPriceWindow = "24h"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "price_provider_url") {
+		t.Fatalf("expected dust_price_window without a provider to be refused, got %v", err)
+	}
+	c.PriceProviderURL, c.PriceRefreshInterval = srv.URL+"/api", "10m"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	s2 := newTestSweeper(t)
+	if err := c.ApplyToSweeper(s2); err != nil || s2.priceProvider == nil || s2.priceEvery != 10*time.Minute {
+		t.Fatalf("ApplyToSweeper: %v", err)
+	}
+}
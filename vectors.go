@@ -0,0 +1,257 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains the deterministic test vector generator.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TestVectorsVersion is the version of the test vector file format.
+const TestVectorsVersion = 2
+
+// TestVectorsFile is the file name GenerateTestVectors output is written to.
+const TestVectorsFile = "vectors.json"
+
+// vectorPubKey is the key every vector is built for: the compressed public
+// key of private key 1, so anyone can re-sign the vectors.
+const vectorPubKey = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// vectorScriptTypes are the script types the sweeper spends from
+var vectorScriptTypes = []string{"p2wpkh", "p2tr", "p2pkh", "p2wsh_sortedmulti"}
+
+// vectorMultisigKeys are the private keys of the 2-of-3 multisig vector's
+// cosigner xpubs; the first is the sweeper's key.
+var vectorMultisigKeys = []int64{1, 2, 3}
+
+// TestVector is one canonical single-input spend: the coin and destination,
+// their addresses and scripts, and the transaction and PSBT the sweeper
+// plans for them.
+type TestVector struct {
+	Name                    string             `json:"name"`
+	Network                 string             `json:"network"`
+	ScriptType              string             `json:"script_type"`
+	PubKey                  string             `json:"pubkey"`
+	Address                 string             `json:"address"`
+	ScriptPubKey            string             `json:"script_pubkey"`
+	PrevTx                  string             `json:"prev_tx,omitempty"`        // P2PKH only
+	Descriptor              string             `json:"descriptor,omitempty"`     // Multisig only
+	WitnessScript           string             `json:"witness_script,omitempty"` // Multisig only
+	UTXO                    TestVectorUTXO     `json:"utxo"`
+	Destination             string             `json:"destination"`
+	DestinationScriptPubKey string             `json:"destination_script_pubkey"`
+	FeeRate                 int64              `json:"fee_rate"`
+	Outputs                 []TestVectorOutput `json:"outputs"`
+	FeeSats                 int64              `json:"fee_sats"`
+	UnsignedTx              string             `json:"unsigned_tx"`
+	TxID                    string             `json:"txid"`
+	PSBT                    string             `json:"psbt"`
+}
+
+// TestVectorUTXO is the coin a vector spends.
+type TestVectorUTXO struct {
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	ValueSats     int64  `json:"value_sats"`
+	Address       string `json:"address"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// TestVectorOutput is one output of a vector's transaction, in order.
+type TestVectorOutput struct {
+	Address   string `json:"address"`
+	ValueSats int64  `json:"value_sats"`
+	Change    bool   `json:"change,omitempty"`
+}
+
+// TestVectorSet is the published fixture set.
+type TestVectorSet struct {
+	Version   int          `json:"version"`
+	Generator string       `json:"generator"`
+	Vectors   []TestVector `json:"vectors"`
+}
+
+// GenerateTestVectors plans one spend for every script type on every
+// network, from fixed keys and coins, so the output only changes when the
+// sweeper's encoding or planning does. The golden tests compare against it;
+// downstream implementations can check their own output for the same
+// inputs against the published file.
+func GenerateTestVectors() (*TestVectorSet, error) {
+	set := &TestVectorSet{Version: TestVectorsVersion, Generator: "utxo_sweeper " + Version}
+	networks := make([]Network, 0, len(networkNames))
+	for n := range networkNames {
+		networks = append(networks, n)
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i] < networks[j] })
+	for _, n := range networks {
+		for _, st := range vectorScriptTypes {
+			v, err := generateTestVector(n, st)
+			if err != nil {
+				return nil, fmt.Errorf("vector %s/%s: %w", networkNames[n], st, err)
+			}
+			set.Vectors = append(set.Vectors, *v)
+		}
+	}
+	return set, nil
+}
+
+// WriteTestVectors generates the vectors and writes them to dir.
+func WriteTestVectors(dir string) (string, error) {
+	set, err := GenerateTestVectors()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, TestVectorsFile)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write test vectors: %w", err)
+	}
+	return path, nil
+}
+
+// Plan the vector for one network and script type
+func generateTestVector(n Network, st string) (*TestVector, error) {
+	pub, _ := hex.DecodeString(vectorPubKey)
+	s, err := NewSweeper(pub, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetFeeRate(4); err != nil {
+		return nil, err
+	}
+	var addr, desc string
+	var script, witnessScript []byte
+	switch st {
+	case "p2wpkh":
+		addr, err = CreateP2WPKH(Hash160(pub), n)
+		script = BuildP2WPKHScript(Hash160(pub))
+	case "p2tr":
+		if err = s.SetTaprootChangeInternalKey(pub); err != nil {
+			return nil, err
+		}
+		var out []byte
+		if out, err = internalXOnly(pub); err == nil {
+			out, _, err = TaprootOutputKey(out)
+		}
+		if err == nil {
+			addr, err = CreateP2TR(out, n)
+			script = BuildP2TRScript(out)
+		}
+	case "p2pkh":
+		addr, err = CreateP2PKH(Hash160(pub), n)
+		script = BuildP2PKHScript(Hash160(pub))
+	case "p2wsh_sortedmulti":
+		var ms *multisigScript
+		if desc, err = vectorMultisigDescriptor(n); err != nil {
+			return nil, err
+		}
+		var acct *MultisigAccount
+		if acct, err = ParseMultisigDescriptor(desc, n); err == nil {
+			err = s.SetMultisigAccount(acct, 1)
+		}
+		if err == nil {
+			ms, err = acct.derive(false, 0)
+		}
+		if err == nil {
+			addr, witnessScript = ms.Address, ms.WitnessScript
+			script = BuildP2WSHScript(SHA256(ms.WitnessScript))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := networkNames[n] + "_" + st
+	dest, err := CreateP2WPKH(SHA256([]byte("vector destination"))[:20], n)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &TestVector{
+		Name:                    name,
+		Network:                 networkNames[n],
+		ScriptType:              st,
+		PubKey:                  vectorPubKey,
+		Address:                 addr,
+		ScriptPubKey:            hex.EncodeToString(script),
+		Descriptor:              desc,
+		WitnessScript:           hex.EncodeToString(witnessScript),
+		Destination:             dest,
+		DestinationScriptPubKey: hex.EncodeToString(BuildP2WPKHScript(SHA256([]byte("vector destination"))[:20])),
+		FeeRate:                 4,
+	}
+	utxo := UTXO{TxID: hex.EncodeToString(SHA256([]byte(name))), Vout: 0, ValueSats: 500_000, Address: addr, Confirmed: true, Confirmations: 6}
+	if st == "p2pkh" {
+		prev := NewMsgTx(1)
+		prev.AddTxIn(TxIn{PreviousOutPoint: OutPoint{Index: 0xffffffff}, SignatureScript: []byte(name), Sequence: 0xffffffff})
+		prev.AddTxOut(TxOut{Value: utxo.ValueSats, PkScript: script})
+		raw := prev.Serialize(true)
+		v.PrevTx = hex.EncodeToString(raw)
+		utxo.TxID = prev.TxID()
+		s.SetPrevTxSource(vectorPrevTxs{prev.TxID(): raw})
+	}
+	v.UTXO = TestVectorUTXO{TxID: utxo.TxID, Vout: utxo.Vout, ValueSats: utxo.ValueSats, Address: utxo.Address, Confirmations: utxo.Confirmations}
+	if err := s.Index(utxo); err != nil {
+		return nil, err
+	}
+	plan, err := s.Spend([]TxOutput{{Address: dest, ValueSats: 200_000}})
+	if err != nil {
+		return nil, err
+	}
+	psbt, err := plan.PSBT.B64Encode()
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range plan.Outputs {
+		v.Outputs = append(v.Outputs, TestVectorOutput{Address: o.Address, ValueSats: o.ValueSats, Change: plan.IsChange(i)})
+	}
+	v.FeeSats = plan.FeeSats
+	v.UnsignedTx = hex.EncodeToString(plan.RawTx.Serialize(false))
+	v.TxID = plan.RawTx.TxID()
+	v.PSBT = psbt
+	return v, nil
+}
+
+// 2-of-3 wsh(sortedmulti) descriptor over the vector cosigners' xpubs, with
+// its checksum. The xpubs are depth-0 keys with fixed chain codes; tpubs on
+// test networks.
+func vectorMultisigDescriptor(n Network) (string, error) {
+	version := [4]byte{0x04, 0x88, 0xb2, 0x1e}
+	if n == BitcoinTestnet || n == BitcoinRegtest || n == LitecoinTestnet {
+		version = [4]byte{0x04, 0x35, 0x87, 0xcf}
+	}
+	keys := make([]string, 0, len(vectorMultisigKeys))
+	for _, d := range vectorMultisigKeys {
+		k := &ExtendedPubKey{Version: version}
+		copy(k.PubKey[:], compressPubKey(ecMul(&ecPoint{secpGx, secpGy}, big.NewInt(d))))
+		copy(k.ChainCode[:], SHA256([]byte(fmt.Sprintf("vector cosigner %d", d))))
+		keys = append(keys, k.String()+"/<0;1>/*")
+	}
+	desc := "wsh(sortedmulti(2," + strings.Join(keys, ",") + "))"
+	sum, err := descriptorChecksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + sum, nil
+}
+
+// vectorPrevTxs serves the generated previous transactions of P2PKH vectors
+type vectorPrevTxs map[string][]byte
+
+func (m vectorPrevTxs) RawTransaction(txid string) ([]byte, error) {
+	if raw, ok := m[txid]; ok {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("no vector transaction %s", txid)
+}
@@ -0,0 +1,274 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains encrypted export and import of the full wallet state.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// WalletArchiveFormat identifies wallet archive files.
+	WalletArchiveFormat = "utxo-sweeper-wallet"
+	// WalletArchiveVersion is the archive layout written by ExportWallet.
+	WalletArchiveVersion = 1
+
+	walletKDFIterations = 600_000
+	// Archives are read before they authenticate, so a larger count is
+	// refused rather than left to tie up the CPU
+	walletMaxKDFIterations = 10 * walletKDFIterations
+	walletSaltLen          = 16
+)
+
+// walletEnvelope is the on-disk wrapper; everything except the header is encrypted.
+type walletEnvelope struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`  // hex
+	Nonce      string `json:"nonce"` // hex
+	Ciphertext string `json:"ciphertext"`
+}
+
+// WalletArchive is the decrypted content of a wallet archive.
+type WalletArchive struct {
+	Version         int                  `json:"version"`
+	CreatedAt       time.Time            `json:"created_at"`
+	Network         Network              `json:"network"`
+	UTXOs           []UTXO               `json:"utxos"`
+	Plans           []planRecord         `json:"plans"`
+	Templates       []PlanTemplate       `json:"templates,omitempty"`
+	SpendingWallets []WeightedAddr       `json:"spending_wallets,omitempty"`
+	AddressStats    []AddressStats       `json:"address_stats,omitempty"`
+	ScheduleMarkers map[string]RunMarker `json:"schedule_markers,omitempty"`
+}
+
+// ExportWallet writes the wallet state (indexed UTXOs, plan history, templates,
+// spending wallets, address usage and schedule markers) to path as a versioned
+// archive encrypted with AES-256-GCM under a key derived from passphrase.
+func (s *Sweeper) ExportWallet(path, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("a passphrase is required to export the wallet")
+	}
+	arc := WalletArchive{
+		Version:      WalletArchiveVersion,
+		CreatedAt:    time.Now().UTC(),
+		Network:      s.network,
+		UTXOs:        s.indexedUTXOs,
+		AddressStats: s.AddressStats(),
+	}
+	for _, p := range s.PendingPlans() {
+		b, err := s.kv.Get([]byte("plan:" + p.ID))
+		if err != nil {
+			return fmt.Errorf("plan %s is not persisted: %w", p.ID, err)
+		}
+		var rec planRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("plan %s: %w", p.ID, err)
+		}
+		arc.Plans = append(arc.Plans, rec)
+	}
+	for _, name := range s.ListTemplates() {
+		t, err := s.LoadTemplate(name)
+		if err != nil {
+			return err
+		}
+		arc.Templates = append(arc.Templates, *t)
+		if b, err := s.kv.Get([]byte("schedule:last:" + name)); err == nil {
+			var m RunMarker
+			if json.Unmarshal(b, &m) == nil {
+				if arc.ScheduleMarkers == nil {
+					arc.ScheduleMarkers = map[string]RunMarker{}
+				}
+				arc.ScheduleMarkers[name] = m
+			}
+		}
+	}
+	if b, err := s.kv.Get([]byte("alloc:weights")); err == nil {
+		if err := json.Unmarshal(b, &arc.SpendingWallets); err != nil {
+			return fmt.Errorf("spending wallets: %w", err)
+		}
+	}
+
+	plain, err := json.Marshal(arc)
+	if err != nil {
+		return err
+	}
+	env := walletEnvelope{Format: WalletArchiveFormat, Version: WalletArchiveVersion, KDF: "pbkdf2-sha256", Iterations: walletKDFIterations}
+	salt := make([]byte, walletSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := walletCipher(passphrase, salt, env.Iterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	env.Salt = hex.EncodeToString(salt)
+	env.Nonce = hex.EncodeToString(nonce)
+	env.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, plain, env.header()))
+	out, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o600)
+}
+
+// ImportWallet decrypts an archive written by ExportWallet and merges it into
+// the sweeper, persisting everything to the configured KV store. Entries with
+// the same key (outpoint, plan ID, template name) are overwritten.
+func (s *Sweeper) ImportWallet(path, passphrase string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var env walletEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return fmt.Errorf("not a wallet archive: %w", err)
+	}
+	if env.Format != WalletArchiveFormat {
+		return fmt.Errorf("not a wallet archive (format %q)", env.Format)
+	}
+	if env.Version != WalletArchiveVersion {
+		return fmt.Errorf("unsupported wallet archive version %d (this build reads version %d)", env.Version, WalletArchiveVersion)
+	}
+	if env.KDF != "pbkdf2-sha256" || env.Iterations <= 0 {
+		return fmt.Errorf("unsupported key derivation %q", env.KDF)
+	}
+	if env.Iterations > walletMaxKDFIterations {
+		return fmt.Errorf("unsupported key derivation cost of %d iterations (at most %d)", env.Iterations, walletMaxKDFIterations)
+	}
+	salt, err1 := hex.DecodeString(env.Salt)
+	nonce, err2 := hex.DecodeString(env.Nonce)
+	ct, err3 := hex.DecodeString(env.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return fmt.Errorf("corrupt wallet archive: %w", err)
+	}
+	gcm, err := walletCipher(passphrase, salt, env.Iterations)
+	if err != nil {
+		return err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return errors.New("corrupt wallet archive: bad nonce")
+	}
+	plain, err := gcm.Open(nil, nonce, ct, env.header())
+	if err != nil {
+		return errors.New("cannot decrypt wallet archive - wrong passphrase or the file was modified")
+	}
+	var arc WalletArchive
+	if err := json.Unmarshal(plain, &arc); err != nil {
+		return fmt.Errorf("corrupt wallet archive: %w", err)
+	}
+	if arc.Network != s.network {
+		return fmt.Errorf("wallet archive is for network %d but the sweeper uses %d", arc.Network, s.network)
+	}
+	return s.restoreWallet(&arc)
+}
+
+// Merge archived state into the sweeper and its KV store
+func (s *Sweeper) restoreWallet(arc *WalletArchive) error {
+	local := map[string]bool{}
+	for _, u := range s.indexedUTXOs {
+		local[outpointKey(u)] = true
+	}
+	for _, u := range arc.UTXOs {
+		data, _ := json.Marshal(u)
+		if err := s.kv.Put([]byte("utxo:"+outpointKey(u)), data); err != nil {
+			return err
+		}
+		if !local[outpointKey(u)] {
+			s.indexedUTXOs = append(s.indexedUTXOs, u)
+		}
+	}
+	for i := range arc.Plans {
+		p, err := s.planFromRecord(&arc.Plans[i])
+		if err != nil {
+			return fmt.Errorf("plan %s: %w", arc.Plans[i].ID, err)
+		}
+		if err := s.savePlan(p); err != nil {
+			return err
+		}
+		s.plans[p.ID] = p
+	}
+	for _, t := range arc.Templates {
+		if err := s.SaveTemplate(t); err != nil {
+			return fmt.Errorf("template '%s': %w", t.Name, err)
+		}
+	}
+	for name, m := range arc.ScheduleMarkers {
+		b, _ := json.Marshal(m)
+		if err := s.kv.Put([]byte("schedule:last:"+name), b); err != nil {
+			return err
+		}
+	}
+	if len(arc.SpendingWallets) > 0 {
+		if err := s.SetSpendingWallets(arc.SpendingWallets); err != nil {
+			return err
+		}
+	}
+	if len(arc.AddressStats) > 0 {
+		stats := s.loadAddrStats()
+		for _, a := range arc.AddressStats {
+			a := a
+			stats[a.Address] = &a
+		}
+		if err := s.saveAddrStats(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticated header bytes binding format, version and KDF parameters
+func (e *walletEnvelope) header() []byte {
+	return []byte(fmt.Sprintf("%s/%d/%s/%d/%s", e.Format, e.Version, e.KDF, e.Iterations, e.Salt))
+}
+
+// Derive the archive key from the passphrase and build an AES-GCM cipher
+func walletCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := pbkdf2SHA256([]byte(passphrase), salt, iterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var out []byte
+	var ctr [4]byte
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(ctr[:], block)
+		prf.Write(ctr[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
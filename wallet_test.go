@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256Vector(t *testing.T) {
+	// RFC 7914 section 11
+	got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64))
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got != want {
+		t.Fatalf("pbkdf2 = %s, want %s", got, want)
+	}
+}
+
+func TestWalletExportImportRoundTrip(t *testing.T) {
+	s := newTestSweeper(t)
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 200_000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 1, ValueSats: 90_000, Address: testAddr("in"), Confirmed: true})
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if err := s.SaveTemplate(PlanTemplate{Name: "nightly", Kind: TemplateConsolidate, Destinations: []TemplateDestination{{Address: testAddr("cold")}}}); err != nil {
+		t.Fatalf("SaveTemplate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := s.ExportWallet(path, "correct horse"); err != nil {
+		t.Fatalf("ExportWallet: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), testAddr("dest")) {
+		t.Fatalf("archive leaks plaintext")
+	}
+
+	fresh := newTestSweeper(t)
+	if err := fresh.ImportWallet(path, "wrong"); err == nil {
+		t.Fatalf("expected wrong passphrase to fail")
+	}
+	if err := fresh.ImportWallet(path, "correct horse"); err != nil {
+		t.Fatalf("ImportWallet: %v", err)
+	}
+	if len(fresh.GetIndexedUTXOs()) != 2 {
+		t.Fatalf("utxos not restored")
+	}
+	if got, ok := fresh.GetPlan(plan.ID); !ok || got.FeeSats != plan.FeeSats {
+		t.Fatalf("plan not restored")
+	}
+	if _, err := fresh.LoadTemplate("nightly"); err != nil {
+		t.Fatalf("template not restored: %v", err)
+	}
+	if st := fresh.AddressStats(); len(st) != 1 || st[0].Received != 2 {
+		t.Fatalf("address stats not restored: %+v", st)
+	}
+
+	// An archive demanding an absurd key derivation cost is refused up front
+	var env map[string]interface{}
+	_ = json.Unmarshal(raw, &env)
+	env["iterations"] = 2_000_000_000
+	costly, _ := json.Marshal(env)
+	costlyPath := filepath.Join(t.TempDir(), "costly.json")
+	_ = os.WriteFile(costlyPath, costly, 0o600)
+	if err := fresh.ImportWallet(costlyPath, "correct horse"); err == nil || !strings.Contains(err.Error(), "iterations") {
+		t.Fatalf("expected an excessive iteration count to be refused, got %v", err)
+	}
+
+	mainnet := mustNewSweeper(t, []byte("test_pubkey__________33bytes________")[:33], BitcoinMainnet)
+	if err := mainnet.ImportWallet(path, "correct horse"); err == nil {
+		t.Fatalf("expected network mismatch error")
+	}
+}
@@ -0,0 +1,116 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains non-fatal warnings attached to plans.
+package main
+
+import "fmt"
+
+// Plan warning codes
+const (
+	WarnHighFee            = "high_fee"            // Fee is a large share of the amount sent
+	WarnUneconomicalInputs = "uneconomical_inputs" // Inputs, spent or skipped, that cost more to spend than they hold
+	WarnChangeAbsorbed     = "change_absorbed"     // Change below dust or the changeless tolerance was added to the fee
+	WarnAddressReuse       = "address_reuse"       // A recipient or input address has been used before
+	WarnLinkedClusters     = "linked_clusters"     // Privacy selection had to co-spend several address clusters
+)
+
+// highFeeWarnPercent is the fee share of the amount sent that triggers WarnHighFee.
+const highFeeWarnPercent = 2.0
+
+// PlanWarning is a non-fatal finding from planning that callers may want to
+// surface, e.g. "fee is 4.2% of send amount".
+type PlanWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Collect warnings for a freshly assembled plan built at p's fee rate
+func (s *Sweeper) planWarnings(plan *TransactionPlan, p spendParams) []PlanWarning {
+	var warns []PlanWarning
+	add := func(code, format string, a ...any) {
+		warns = append(warns, PlanWarning{Code: code, Message: fmt.Sprintf(format, a...)})
+	}
+
+	var sent int64
+	for i, o := range plan.Outputs {
+		if !plan.IsChange(i) {
+			sent += o.ValueSats
+		}
+	}
+	if sent > 0 {
+		if pct := float64(plan.FeeSats) * 100 / float64(sent); pct >= highFeeWarnPercent {
+			add(WarnHighFee, "fee is %.1f%% of send amount (%d of %d sats)", pct, plan.FeeSats, sent)
+		}
+	}
+
+	spent := 0
+	for _, u := range plan.Inputs {
+		if s.uneconomical(u, p.feeRate) {
+			spent++
+		}
+	}
+	if spent > 0 {
+		add(WarnUneconomicalInputs, "%d inputs cost more to spend than they hold at %s", spent, p.feeRate)
+	}
+	if n := s.uneconomicalSkipped(plan.Inputs, p); n > 0 {
+		add(WarnUneconomicalInputs, "%d uneconomical inputs skipped (worth less than their spending cost at %s)", n, p.feeRate)
+	}
+
+	if plan.DustChangeSats > 0 {
+		add(WarnChangeAbsorbed, "change of %d sats below the dust threshold added to the fee", plan.DustChangeSats)
+	} else if len(plan.Change) == 0 && p.feeRate > 0 {
+		target := p.feeRate.Fee(estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs))
+		if extra := plan.FeeSats - target; extra > 0 {
+			add(WarnChangeAbsorbed, "change of %d sats absorbed into fee (below the dust threshold or changeless tolerance)", extra)
+		}
+	}
+
+	if p.selection == SelectPrivacy {
+		if n := s.linkedClusters(plan.Inputs); n > 1 {
+			add(WarnLinkedClusters, "no single address cluster covers the spend: inputs link %d addresses across %d clusters", plan.LinkedAddresses(), n)
+		}
+	}
+
+	stats := s.loadAddrStats()
+	for i, o := range plan.Outputs {
+		if plan.IsChange(i) {
+			continue
+		}
+		if a, ok := stats[o.Address]; ok && a.Received > 0 {
+			add(WarnAddressReuse, "address reuse detected: output %d pays %s, which already received %d UTXOs", i, o.Address, a.Received)
+		}
+	}
+	seen := map[string]bool{}
+	for _, in := range plan.Inputs {
+		if a, ok := stats[in.Address]; ok && !seen[in.Address] && a.Reused(s.reuseThreshold) {
+			seen[in.Address] = true
+			add(WarnAddressReuse, "address reuse detected: input address %s received %d UTXOs", in.Address, a.Received)
+		}
+	}
+	return warns
+}
+
+// Whether a UTXO is worth less than the fee to spend it at rate
+func (s *Sweeper) uneconomical(u UTXO, rate FeeRate) bool {
+	return u.ValueSats <= rate.Fee(inputVBytes(s, u))
+}
+
+// Count UTXOs of the pool the plan was selected from that are selectable,
+// uneconomical and left out of it
+func (s *Sweeper) uneconomicalSkipped(selected []UTXO, p spendParams) int {
+	used := map[string]bool{}
+	for _, u := range selected {
+		used[outpointKey(u)] = true
+	}
+	n := 0
+	for _, u := range s.candidates(p.pool, p) {
+		if !used[outpointKey(u)] && s.uneconomical(u, p.feeRate) {
+			n++
+		}
+	}
+	return n
+}
+
+// Estimated virtual size of spending a single UTXO
+func inputVBytes(s *Sweeper, u UTXO) int64 {
+	return estimateTxVBytesDetailed(s, []UTXO{u}, nil) - estimateTxVBytesDetailed(s, nil, nil)
+}
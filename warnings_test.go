@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func hasWarning(p *TransactionPlan, code string) bool {
+	for _, w := range p.Warnings {
+		if w.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPlanWarnings(t *testing.T) {
+	s := newTestSweeper(t, WithFeeRate(20), WithDustPolicy(FixedDustPolicy{MinSats: 546}))
+	// 1360 sats cost to spend at 20 sat/vB, so a 1000 sat input is uneconomical
+	_ = s.Index(UTXO{TxID: stringsRepeat("a", 64), Vout: 0, ValueSats: 1000, Address: testAddr("in"), Confirmed: true})
+	_ = s.Index(UTXO{TxID: stringsRepeat("b", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 2 {
+		t.Fatalf("expected the uneconomical input to be spent, got %+v", plan.Inputs)
+	}
+	if !hasWarning(plan, WarnUneconomicalInputs) || !hasWarning(plan, WarnHighFee) {
+		t.Fatalf("expected uneconomical and high-fee warnings, got %+v", plan.Warnings)
+	}
+	// Left out by the selection order, it is still reported
+	plan, err = s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 50_000}}, SpendOptions{Selection: SelectLargestFirst})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Inputs) != 1 || !hasWarning(plan, WarnUneconomicalInputs) {
+		t.Fatalf("expected the skipped uneconomical input to be reported, got %+v %+v", plan.Inputs, plan.Warnings)
+	}
+	if hasWarning(plan, WarnChangeAbsorbed) {
+		t.Fatalf("unexpected change-absorbed warning: %+v", plan.Warnings)
+	}
+
+	// Leave less than dust as change: it goes to the fee, and the recipient
+	// already received a UTXO
+	s.ClearIndex()
+	_ = s.Index(UTXO{TxID: stringsRepeat("c", 64), Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: true})
+	plan, err = s.Spend([]TxOutput{{Address: testAddr("in"), ValueSats: 97_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	if len(plan.Change) != 0 || !hasWarning(plan, WarnChangeAbsorbed) || !hasWarning(plan, WarnAddressReuse) {
+		t.Fatalf("expected absorbed change and address reuse warnings, got %+v", plan.Warnings)
+	}
+}
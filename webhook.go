@@ -0,0 +1,171 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains webhook notifications of plan lifecycle events.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Plan lifecycle events sent to webhooks
+const (
+	EventPlanned   = "plan.created"
+	EventBroadcast = "plan.broadcast"
+	EventConfirmed = "plan.confirmed"
+	EventAnnotated = "plan.annotated"
+)
+
+// WebhookPayload is the JSON body posted for each plan event.
+type WebhookPayload struct {
+	Seq         uint64          `json:"seq,omitempty"` // Outbox sequence number, for deduplication
+	Event       string          `json:"event"`
+	PlanID      string          `json:"plan_id"`
+	Inputs      []UTXO          `json:"inputs"`
+	Outputs     []TxOutput      `json:"outputs"`
+	ChangeIdxs  []int           `json:"change_idxs,omitempty"`
+	FeeSats     int64           `json:"fee_sats"`
+	CreatedAt   time.Time       `json:"created_at"`
+	BroadcastAt *time.Time      `json:"broadcast_at,omitempty"`
+	ConfirmedAt *time.Time      `json:"confirmed_at,omitempty"`
+	Annotation  *PlanAnnotation `json:"annotation,omitempty"`
+	Warnings    []PlanWarning   `json:"warnings,omitempty"`
+	SentAt      time.Time       `json:"sent_at"`
+}
+
+// Webhook posts plan events as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client // nil = a client with a 10s timeout
+}
+
+// SetWebhook sends plan created, annotated, broadcast and confirmed events to wh (nil
+// disables). Events are recorded in the outbox and delivered from the outbox in the background, in
+// order; failures are logged and never fail the operation, and the event
+// stays unacknowledged in the outbox until a later delivery succeeds.
+func (s *Sweeper) SetWebhook(wh *Webhook) error {
+	if wh != nil {
+		u, err := url.Parse(wh.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook URL %q must be an absolute http(s) URL", wh.URL)
+		}
+	}
+	s.webhook = wh
+	return nil
+}
+
+// Send posts one payload and checks for a 2xx response.
+func (wh *Webhook) Send(payload *WebhookPayload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(wh.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("webhook returned " + resp.Status)
+	}
+	return nil
+}
+
+// Build the payload for a plan event
+func webhookPayload(event string, p *TransactionPlan) *WebhookPayload {
+	return &WebhookPayload{
+		Event:       event,
+		PlanID:      p.ID,
+		Inputs:      p.Inputs,
+		Outputs:     p.Outputs,
+		ChangeIdxs:  p.ChangeIdxs,
+		FeeSats:     p.FeeSats,
+		CreatedAt:   p.CreatedAt,
+		BroadcastAt: p.BroadcastAt,
+		ConfirmedAt: p.ConfirmedAt,
+		Annotation:  p.Annotation,
+		Warnings:    p.Warnings,
+		SentAt:      time.Now().UTC(),
+	}
+}
+
+// SetEventOutbox records plan events in the outbox even without a webhook,
+// for consumers that pull them with ReplayEvents and AckEvent. Without a
+// webhook or this, events are not recorded.
+func (s *Sweeper) SetEventOutbox(enabled bool) {
+	s.eventOutbox = enabled
+}
+
+// Record a plan event in the outbox and deliver it to the webhook, if any, in
+// the background so a slow receiver never holds up planning. When the event
+// cannot be recorded it is sent directly, but only if no earlier event is
+// waiting, so the receiver never sees events out of order.
+func (s *Sweeper) notify(event string, p *TransactionPlan) {
+	if s.webhook == nil && !s.eventOutbox {
+		return
+	}
+	payload := webhookPayload(event, p)
+	if _, err := s.recordEvent(payload); err != nil {
+		s.logger.Printf("failed to record %s for plan %s in the outbox: %v", event, p.ID, err)
+		if wh := s.webhook; wh != nil {
+			if n, err := s.outboxPending(); err != nil || n > 0 {
+				s.logger.Printf("webhook %s for plan %s not sent: earlier events are waiting in the outbox", event, p.ID)
+				return
+			}
+			s.webhookWG.Add(1)
+			go func() {
+				defer s.webhookWG.Done()
+				if err := wh.Send(payload); err != nil {
+					s.logger.Printf("webhook %s for plan %s failed: %v", event, p.ID, err)
+				}
+			}()
+		}
+		return
+	}
+	s.kickOutbox()
+}
+
+// Deliver the outbox in the background. One delivery runs at a time so the
+// webhook sees events in order; events recorded meanwhile start another pass.
+func (s *Sweeper) kickOutbox() {
+	if s.webhook == nil {
+		return
+	}
+	s.webhookMu.Lock()
+	defer s.webhookMu.Unlock()
+	if s.webhookBusy {
+		s.webhookAgain = true
+		return
+	}
+	s.webhookBusy = true
+	s.webhookWG.Add(1)
+	go func() {
+		defer s.webhookWG.Done()
+		for {
+			if _, err := s.DeliverOutbox(); err != nil {
+				s.logger.Printf("webhook delivery stopped, events stay in the outbox: %v", err)
+			}
+			s.webhookMu.Lock()
+			again := s.webhookAgain
+			s.webhookAgain, s.webhookBusy = false, again
+			s.webhookMu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// WaitWebhooks blocks until background webhook deliveries have finished.
+// Close calls it before closing storage.
+func (s *Sweeper) WaitWebhooks() {
+	s.webhookWG.Wait()
+}
@@ -0,0 +1,111 @@
+// Package main provides a dependency-free Bitcoin UTXO sweeper library.
+// This file contains risk scoring for unconfirmed (zero-conf) UTXOs.
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// MempoolTxInfo describes an unconfirmed transaction as reported by a backend.
+type MempoolTxInfo struct {
+	SignalsRBF           bool      // The tx or an unconfirmed ancestor signals BIP-125 replaceability
+	FeeRateSatsVB        float64   // Fee rate the transaction pays
+	FirstSeen            time.Time // When the backend first saw the transaction
+	ConflictSeen         bool      // A conflicting spend of one of its inputs has been observed
+	UnconfirmedAncestors int       // Number of unconfirmed ancestors
+	AncestorFeeSats      int64     // Fees of the tx and all its unconfirmed ancestors
+	AncestorVSize        int64     // Virtual size of the tx and all its unconfirmed ancestors
+	Version              int32     // Transaction version (0 = not reported)
+}
+
+// MempoolSource reports mempool details for unconfirmed transactions.
+type MempoolSource interface {
+	MempoolTx(txid string) (*MempoolTxInfo, error)
+}
+
+// ZeroConfScore rates how likely an unconfirmed transaction is to confirm
+// unchanged, from 0 (do not trust) to 100. Conflicting spends are disqualifying;
+// RBF signaling, a fee rate below the sweeper's target, a very recent first-seen
+// time, and unconfirmed ancestors each lower the score.
+func ZeroConfScore(info *MempoolTxInfo, targetFeeRate FeeRate, now time.Time) int {
+	if info == nil || info.ConflictSeen {
+		return 0
+	}
+	score := 100
+	if info.SignalsRBF {
+		score -= 40
+	}
+	if targetFeeRate > 0 {
+		switch {
+		case info.FeeRateSatsVB < targetFeeRate.SatPerVB()/2:
+			score -= 30
+		case info.FeeRateSatsVB < targetFeeRate.SatPerVB():
+			score -= 15
+		}
+	}
+	if !info.FirstSeen.IsZero() {
+		switch age := now.Sub(info.FirstSeen); {
+		case age < time.Minute:
+			score -= 20
+		case age < 10*time.Minute:
+			score -= 10
+		}
+	}
+	if info.UnconfirmedAncestors > 0 {
+		pen := 10 * info.UnconfirmedAncestors
+		if pen > 30 {
+			pen = 30
+		}
+		score -= pen
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// SetZeroConfPolicy requires unconfirmed UTXOs to reach minScore (0-100) before
+// they become selectable, scoring them with data from src (which also becomes
+// the mempool source; nil keeps the one set with SetMempoolSource). A minScore
+// of 0 disables scoring and falls back to the plain allow/deny unconfirmed
+// policy, leaving the mempool source in place for ancestor fees.
+func (s *Sweeper) SetZeroConfPolicy(minScore int, src MempoolSource) error {
+	if minScore < 0 || minScore > 100 {
+		return errors.New("zero-conf minimum score must be between 0 and 100")
+	}
+	if minScore > 0 && src == nil && s.mempool == nil {
+		return errors.New("zero-conf scoring needs a mempool source")
+	}
+	s.minZeroConfScore = minScore
+	if src != nil {
+		s.mempool = src
+	}
+	return nil
+}
+
+// UnconfirmedScore scores an indexed unconfirmed UTXO with the configured
+// mempool source. Confirmed UTXOs always score 100.
+func (s *Sweeper) UnconfirmedScore(u UTXO) (int, error) {
+	if u.Confirmed {
+		return 100, nil
+	}
+	if s.mempool == nil {
+		return 0, errors.New("no mempool source configured")
+	}
+	info, err := s.mempool.MempoolTx(u.TxID)
+	if err != nil {
+		return 0, err
+	}
+	return ZeroConfScore(info, s.feeRate, time.Now()), nil
+}
+
+// Report whether an unconfirmed UTXO passes the zero-conf score policy.
+// Backend errors fail closed.
+func (s *Sweeper) zeroConfAcceptable(u UTXO) bool {
+	if u.Confirmed || s.minZeroConfScore <= 0 {
+		return true
+	}
+	score, err := s.UnconfirmedScore(u)
+	return err == nil && score >= s.minZeroConfScore
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeMempool map[string]*MempoolTxInfo
+
+func (f fakeMempool) MempoolTx(txid string) (*MempoolTxInfo, error) {
+	if info, ok := f[txid]; ok {
+		return info, nil
+	}
+	return nil, errors.New("not in mempool")
+}
+
+func TestZeroConfScorePolicy(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(true, 5, 3)
+	old := time.Now().Add(-time.Hour)
+	safe, risky, conflicted, unknown := stringsRepeat("a", 64), stringsRepeat("b", 64), stringsRepeat("c", 64), stringsRepeat("d", 64)
+	mp := fakeMempool{
+		safe:       {FeeRateSatsVB: 20, FirstSeen: old},
+		risky:      {SignalsRBF: true, FeeRateSatsVB: 1, FirstSeen: time.Now()},
+		conflicted: {ConflictSeen: true, FeeRateSatsVB: 50, FirstSeen: old},
+	}
+	if got := ZeroConfScore(mp[safe], SatPerVByte(10), time.Now()); got != 100 {
+		t.Fatalf("safe score = %d, want 100", got)
+	}
+	if got := ZeroConfScore(mp[conflicted], SatPerVByte(10), time.Now()); got != 0 {
+		t.Fatalf("conflicted score = %d, want 0", got)
+	}
+	if err := s.SetZeroConfPolicy(60, nil); err == nil {
+		t.Fatalf("expected error without a mempool source")
+	}
+	if err := s.SetZeroConfPolicy(60, mp); err != nil {
+		t.Fatalf("SetZeroConfPolicy: %v", err)
+	}
+	for _, id := range []string{safe, risky, conflicted, unknown} {
+		_ = s.Index(UTXO{TxID: id, Vout: 0, ValueSats: 100_000, Address: testAddr("in"), Confirmed: false})
+	}
+	got := s.filterUTXOs(s.indexedUTXOs, spendParams{dustOverride: 546})
+	if len(got) != 1 || got[0].TxID != safe {
+		t.Fatalf("expected only the high-score UTXO to be selectable, got %+v", got)
+	}
+
+	// Turning scoring off keeps the mempool source for ancestor fees, and
+	// scoring can be turned back on against it
+	if err := s.SetZeroConfPolicy(0, nil); err != nil || s.mempool == nil {
+		t.Fatalf("disabling scoring dropped the mempool source: %v", err)
+	}
+	if err := s.SetZeroConfPolicy(60, nil); err != nil {
+		t.Fatalf("re-enabling scoring with the configured source: %v", err)
+	}
+}
+
+func TestPackageFeePaysForLowFeeParent(t *testing.T) {
+	s := newTestSweeper(t)
+	s.SetUnconfirmedPolicy(true, 5, 3)
+	_ = s.SetFeeRate(10)
+	parent := stringsRepeat("e", 64)
+	// Parent paid 1 sat/vB over 200 vB
+	s.SetMempoolSource(fakeMempool{parent: {FeeRateSatsVB: 1, AncestorFeeSats: 200, AncestorVSize: 200}})
+	_ = s.Index(UTXO{TxID: parent, Vout: 0, ValueSats: 300_000, Address: testAddr("in"), Confirmed: false})
+
+	plan, err := s.Spend([]TxOutput{{Address: testAddr("dest"), ValueSats: 100_000}})
+	if err != nil {
+		t.Fatalf("Spend: %v", err)
+	}
+	vb := estimateTxVBytesDetailed(s, plan.Inputs, plan.Outputs)
+	if want := (vb+200)*10 - 200; plan.FeeSats != want {
+		t.Fatalf("fee = %d, want %d (child pays for parent)", plan.FeeSats, want)
+	}
+	if plan.PackageFeeRate < 10 {
+		t.Fatalf("package fee rate %.2f below target", plan.PackageFeeRate)
+	}
+	var out int64
+	for _, o := range plan.Outputs {
+		out += o.ValueSats
+	}
+	if out+plan.FeeSats != 300_000 {
+		t.Fatalf("outputs %d + fee %d != inputs", out, plan.FeeSats)
+	}
+}